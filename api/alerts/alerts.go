@@ -0,0 +1,235 @@
+package alerts
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/metrics"
+)
+
+//Kinds of auth checks watched
+const (
+	Login         = "login"          //Passwords and passkeys
+	OTP           = "otp"            //Two factor, recovery and emailed login codes
+	PasswordReset = "password_reset" //Reset links
+)
+
+//Failures of one kind that raise an alert, zero values turn a limit off
+type Threshold struct {
+	Failures int     //Failed checks within the window, whatever the rate
+	Rate     float64 //Share of the checks within the window that failed, from 0 to 1
+}
+
+type Settings struct {
+	Window     time.Duration
+	MinChecks  int           //Checks within the window before the rate counts, so a few typos at night don't alert
+	Cooldown   time.Duration //Quiet time after an alert of a kind, so an attack sends one alert instead of one per try
+	WebhookURL string        //Gets the alert as JSON
+	SlackURL   string        //Slack incoming webhook
+	Thresholds map[string]Threshold
+}
+
+//Failure spike found in the checks of one kind
+type Alert struct {
+	Kind     string    `json:"kind"`
+	Reason   string    `json:"reason"` //failures or rate, the threshold that was crossed
+	Checks   int       `json:"checks"`
+	Failures int       `json:"failures"`
+	Rate     float64   `json:"rate"`
+	Window   string    `json:"window"`
+	Instance string    `json:"instance"` //Counts are per instance
+	At       time.Time `json:"at"`
+}
+
+func (a Alert) Message() string {
+	return fmt.Sprintf("FixIt alert: %d of %d %s checks failed (%.0f%%) in the last %s on %s", a.Failures, a.Checks, a.Kind, a.Rate*100, a.Window, a.Instance)
+}
+
+type counts struct {
+	checks   int
+	failures int
+}
+
+//Counts checks in buckets covering the window and alerts when a kind crosses its threshold
+type Monitor struct {
+	mu       sync.Mutex
+	settings Settings
+	bucket   time.Duration
+	series   map[string]map[int64]*counts //Counts of each kind by bucket
+	alerted  map[string]time.Time
+}
+
+//Buckets a window is split into, the window slides by one bucket at a time
+const windowBuckets = 20
+
+func NewMonitor(settings Settings) *Monitor {
+	monitor := &Monitor{alerted: map[string]time.Time{}}
+	monitor.Configure(settings)
+	return monitor
+}
+
+//Change the settings, the counts start over when the window changes
+func (m *Monitor) Configure(settings Settings) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if settings.Window != m.settings.Window || m.series == nil {
+		m.series = map[string]map[int64]*counts{}
+		m.bucket = settings.Window / windowBuckets
+		if m.bucket < time.Second {
+			m.bucket = time.Second
+		}
+	}
+	m.settings = settings
+}
+
+//Count a check and send an alert if it makes its kind cross a threshold
+func (m *Monitor) Record(kind string, failed bool) {
+	result := "success"
+	if failed {
+		result = "failure"
+	}
+	metrics.AuthChecks.WithLabelValues(kind, result).Inc()
+
+	alert, settings, ok := m.record(kind, failed, time.Now())
+	if ok {
+		go deliver(settings, alert)
+	}
+}
+
+func (m *Monitor) record(kind string, failed bool, now time.Time) (Alert, Settings, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.series[kind]
+	if !ok {
+		series = map[int64]*counts{}
+		m.series[kind] = series
+	}
+	current := now.UnixNano() / int64(m.bucket)
+	if series[current] == nil {
+		series[current] = &counts{}
+	}
+	series[current].checks++
+	if failed {
+		series[current].failures++
+	}
+
+	total := counts{}
+	for bucket, c := range series {
+		if bucket <= current-windowBuckets {
+			delete(series, bucket)
+			continue
+		}
+		total.checks += c.checks
+		total.failures += c.failures
+	}
+	if !failed {
+		return Alert{}, m.settings, false
+	}
+
+	threshold := m.settings.Thresholds[kind]
+	rate := float64(total.failures) / float64(total.checks)
+	reason := ""
+	switch {
+	case threshold.Failures > 0 && total.failures >= threshold.Failures:
+		reason = "failures"
+	case threshold.Rate > 0 && total.checks >= m.settings.MinChecks && rate >= threshold.Rate:
+		reason = "rate"
+	}
+	if reason == "" || now.Sub(m.alerted[kind]) < m.settings.Cooldown {
+		return Alert{}, m.settings, false
+	}
+	m.alerted[kind] = now
+
+	instance, _ := os.Hostname()
+	return Alert{
+		Kind:     kind,
+		Reason:   reason,
+		Checks:   total.checks,
+		Failures: total.failures,
+		Rate:     rate,
+		Window:   m.settings.Window.String(),
+		Instance: instance,
+		At:       now,
+	}, m.settings, true
+}
+
+var (
+	defaultMonitor *Monitor
+	defaultOnce    sync.Once
+)
+
+//Shared monitor configured from the environment
+func Default() *Monitor {
+	defaultOnce.Do(func() {
+		defaultMonitor = NewMonitor(SettingsFromEnv())
+	})
+	return defaultMonitor
+}
+
+//Count a check with the shared monitor
+func Record(kind string, failed bool) {
+	Default().Record(kind, failed)
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+//Unset or invalid settings take the fallback, 0 turns a limit off
+func envInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+func envRate(name string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil || value < 0 || value > 1 {
+		return fallback
+	}
+	return value
+}
+
+//Settings from the ALERT_* variables
+func SettingsFromEnv() Settings {
+	return Settings{
+		Window:     envDuration("ALERT_WINDOW", 5*time.Minute),
+		MinChecks:  envInt("ALERT_MIN_CHECKS", 50),
+		Cooldown:   envDuration("ALERT_COOLDOWN", 30*time.Minute),
+		WebhookURL: os.Getenv("ALERT_WEBHOOK_URL"),
+		SlackURL:   os.Getenv("ALERT_SLACK_WEBHOOK_URL"),
+		Thresholds: map[string]Threshold{
+			Login:         {Failures: envInt("ALERT_LOGIN_FAILURES", 100), Rate: envRate("ALERT_LOGIN_FAILURE_RATE", 0.5)},
+			OTP:           {Failures: envInt("ALERT_OTP_FAILURES", 30), Rate: envRate("ALERT_OTP_FAILURE_RATE", 0.5)},
+			PasswordReset: {Failures: envInt("ALERT_PASSWORD_RESET_FAILURES", 20), Rate: envRate("ALERT_PASSWORD_RESET_FAILURE_RATE", 0.5)},
+		},
+	}
+}
+
+//Log the alert and post it to the configured hooks
+func deliver(settings Settings, alert Alert) {
+	log.Print(alert.Message())
+	if settings.WebhookURL != "" {
+		err := postJSON(settings.WebhookURL, alert)
+		if err != nil {
+			log.Printf("Sending %s alert to the webhook failed: %v", alert.Kind, err)
+		}
+	}
+	if settings.SlackURL != "" {
+		err := postJSON(settings.SlackURL, map[string]string{"text": alert.Message()})
+		if err != nil {
+			log.Printf("Sending %s alert to Slack failed: %v", alert.Kind, err)
+		}
+	}
+}
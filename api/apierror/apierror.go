@@ -0,0 +1,97 @@
+package apierror
+
+import (
+	"errors"
+	"net/http"
+)
+
+//Codes clients tell failures apart by, the messages are for people and may change
+const (
+	Validation     = "validation_failed"
+	InvalidRequest = "invalid_request"
+	Unauthorized   = "unauthorized"
+	Forbidden      = "forbidden"
+	NotFound       = "not_found"
+	Conflict       = "conflict"
+	TooLarge       = "too_large"
+	RateLimited    = "rate_limited"
+	Timeout        = "timeout"
+	Unavailable    = "service_unavailable"
+	Internal       = "internal_error"
+)
+
+//Failure the API answers with, as {"code": ..., "message": ..., "field": ...}. Field names the request
+//field at fault, by its JSON name, when there is one.
+type Error struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func New(status int, code, field, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message, Field: field}
+}
+
+//A request field missing or not valid, e.g. Invalid("email", "Invalid Email")
+func Invalid(field, message string) *Error {
+	return New(http.StatusUnprocessableEntity, Validation, field, message)
+}
+
+//A request field clashing with an existing record, e.g. Duplicate("username", "Username Already Taken")
+func Duplicate(field, message string) *Error {
+	return New(http.StatusConflict, Conflict, field, message)
+}
+
+//Errors of other packages that know what they mean to the client, such as models.DuplicateUserError
+type Typed interface {
+	APIError() *Error
+}
+
+//The API error for a failure a handler answers with the status. Typed errors keep their own status, so
+//a validation error passed on as a 500 is still a 422. Others get the code of the status.
+func From(status int, err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var typed Typed
+	if errors.As(err, &typed) {
+		return typed.APIError()
+	}
+	return New(status, CodeOf(status), "", err.Error())
+}
+
+//Code of failures answered with the status by handlers that don't say
+func CodeOf(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return InvalidRequest
+	case http.StatusUnprocessableEntity:
+		return Validation
+	case http.StatusUnauthorized:
+		return Unauthorized
+	case http.StatusForbidden:
+		return Forbidden
+	case http.StatusNotFound, http.StatusGone:
+		return NotFound
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusRequestEntityTooLarge:
+		return TooLarge
+	case http.StatusTooManyRequests:
+		return RateLimited
+	case http.StatusGatewayTimeout:
+		return Timeout
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return Unavailable
+	}
+	if status >= 500 {
+		return Internal
+	}
+	return InvalidRequest
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+//Smallest RSA key tokens are signed or checked with
+const minRSABits = 2048
+
+//Key tokens are signed or checked with. Its ID is the RFC 7638 thumbprint of the public key,
+//so every instance loading the same file names it the same way.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Public  crypto.PublicKey
+	private crypto.Signer
+}
+
+//Keys loaded from the JWT_SIGNING_KEY and JWT_VERIFY_KEYS files. Without a signing key
+//tokens are signed with API_SECRET as before.
+type KeySet struct {
+	Signing *Key
+	//Keys checked by ID, the signing key and the ones it replaced
+	Verify map[string]*Key
+}
+
+func (k *KeySet) lookup(id string) *Key {
+	if k == nil {
+		return nil
+	}
+	return k.Verify[id]
+}
+
+//Reads the current signing key from JWT_SIGNING_KEY and the retired ones, still accepted until
+//their tokens expire, from the comma separated JWT_VERIFY_KEYS. Files hold PEM RSA or Ed25519 keys.
+func KeysFromEnv() (*KeySet, error) {
+	keys := &KeySet{Verify: map[string]*Key{}}
+
+	path := strings.TrimSpace(os.Getenv("JWT_SIGNING_KEY"))
+	if path != "" {
+		key, err := loadKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if key.private == nil {
+			return nil, fmt.Errorf("%s: JWT_SIGNING_KEY must be a private key", path)
+		}
+		keys.Signing = key
+		keys.Verify[key.ID] = key
+	}
+	for _, path := range strings.Split(os.Getenv("JWT_VERIFY_KEYS"), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		key, err := loadKey(path)
+		if err != nil {
+			return nil, err
+		}
+		//Only the public half of a retired key is kept
+		key.private = nil
+		if _, ok := keys.Verify[key.ID]; !ok {
+			keys.Verify[key.ID] = key
+		}
+	}
+	return keys, nil
+}
+
+func loadKey(path string) (*Key, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: No PEM Key Found", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		err = fmt.Errorf("Unsupported PEM Block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	key, err := newKey(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return key, nil
+}
+
+func newKey(parsed interface{}) (*Key, error) {
+	key := &Key{}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.private, key.Public = k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Public = k
+	case ed25519.PrivateKey:
+		key.private, key.Public = k, k.Public()
+	case ed25519.PublicKey:
+		key.Public = k
+	default:
+		return nil, errors.New("Only RSA and Ed25519 Keys Are Supported")
+	}
+
+	switch public := key.Public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA Keys Need At Least %d Bits", minRSABits)
+		}
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = SigningMethodEdDSA
+	}
+	sum := sha256.Sum256(key.thumbprintInput())
+	key.ID = base64.RawURLEncoding.EncodeToString(sum[:])
+	return key, nil
+}
+
+//Required members of the JWK in lexical order, as RFC 7638 hashes them
+func (k *Key) thumbprintInput() []byte {
+	jwk := k.JWK()
+	var input []byte
+	if jwk.Kty == "RSA" {
+		input, _ = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N})
+	} else {
+		input, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X})
+	}
+	return input
+}
+
+//Public key as published in the JWKS
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+func (k *Key) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	switch public := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+//Public keys other services verify tokens with, the signing key first
+func JWKS() []JWK {
+	keys := currentKeys()
+	jwks := []JWK{}
+	if keys.Signing != nil {
+		jwks = append(jwks, keys.Signing.JWK())
+	}
+	retired := []string{}
+	for id := range keys.Verify {
+		if keys.Signing == nil || id != keys.Signing.ID {
+			retired = append(retired, id)
+		}
+	}
+	sort.Strings(retired)
+	for _, id := range retired {
+		jwks = append(jwks, keys.Verify[id].JWK())
+	}
+	return jwks
+}
+
+var keySet atomic.Value
+
+func currentKeys() *KeySet {
+	current, _ := keySet.Load().(*KeySet)
+	if current == nil {
+		current = &KeySet{Verify: map[string]*Key{}}
+	}
+	return current
+}
+
+//Changes the keys tokens are signed and checked with from now on
+func ConfigureKeys(k *KeySet) {
+	keySet.Store(k)
+}
@@ -0,0 +1,12 @@
+package auth
+
+//Roles a user can have, carried in the token so checking them needs no database
+const (
+	RoleAdmin    = "admin"
+	RoleProvider = "provider"
+	RoleCustomer = "customer"
+)
+
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleProvider || role == RoleCustomer
+}
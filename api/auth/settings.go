@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+//What tokens are issued with and checked against
+type Settings struct {
+	//iss of the tokens, JWT_ISSUER
+	Issuer string
+	//Accepted aud values, JWT_AUDIENCE separated by commas. New tokens get the first one.
+	Audience []string
+	//How long a token is valid, JWT_TTL
+	TTL time.Duration
+	//Until when tokens from before issuers and expiry were added still work, JWT_ACCEPT_LEGACY_UNTIL
+	//as an RFC 3339 time or a date. They are refused when it's not set.
+	AcceptLegacyUntil time.Time
+	//Until when HS256 tokens signed with API_SECRET still work once a JWT_SIGNING_KEY signs new ones,
+	//JWT_ACCEPT_HMAC_UNTIL like JWT_ACCEPT_LEGACY_UNTIL. They are refused when it's not set.
+	AcceptHMACUntil time.Time
+}
+
+func (s Settings) audience(aud string) bool {
+	for _, accepted := range s.Audience {
+		if aud == accepted {
+			return true
+		}
+	}
+	return false
+}
+
+func SettingsFromEnv() Settings {
+	settings := Settings{
+		Issuer:            strings.TrimSpace(os.Getenv("JWT_ISSUER")),
+		TTL:               720 * time.Hour,
+		AcceptLegacyUntil: cutoffFromEnv("JWT_ACCEPT_LEGACY_UNTIL"),
+		AcceptHMACUntil:   cutoffFromEnv("JWT_ACCEPT_HMAC_UNTIL"),
+	}
+	if settings.Issuer == "" {
+		settings.Issuer = "fixit-api"
+	}
+	for _, audience := range strings.Split(os.Getenv("JWT_AUDIENCE"), ",") {
+		if audience = strings.TrimSpace(audience); audience != "" {
+			settings.Audience = append(settings.Audience, audience)
+		}
+	}
+	if len(settings.Audience) == 0 {
+		settings.Audience = []string{"fixit-app"}
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("JWT_TTL")); err == nil && ttl > 0 {
+		settings.TTL = ttl
+	}
+	return settings
+}
+
+//RFC 3339 time or date in the environment variable, zero when it's empty or invalid
+func cutoffFromEnv(name string) time.Time {
+	until := strings.TrimSpace(os.Getenv(name))
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if cutoff, err := time.Parse(layout, until); err == nil {
+			return cutoff
+		}
+	}
+	return time.Time{}
+}
+
+var settings atomic.Value
+
+func currentSettings() Settings {
+	current, ok := settings.Load().(Settings)
+	if !ok {
+		current = SettingsFromEnv()
+		settings.Store(current)
+	}
+	return current
+}
+
+//Changes the settings of the tokens issued and checked from now on
+func Configure(s Settings) {
+	settings.Store(s)
+}
@@ -1,51 +1,229 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
 )
 
-//Creates jwt to validate user's action
-func CreateToken(user_id uint32) (string, error) {
-	claims := jwt.MapClaims{}
-	claims["authorized"] = true
-	claims["user_id"] = user_id
-	//claims["exp"] = time.Now().Add(time.Hour * 1).Unix() //Token expires after 1 hour
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(os.Getenv("API_SECRET")))
+var (
+	ErrInvalidToken = errors.New("Invalid Token")
+	ErrTokenExpired = errors.New("Token Expired")
+	ErrTokenRevoked = errors.New("Token Revoked")
+	//The revocation check failed, the token is refused rather than let through
+	ErrRevocationUnavailable = errors.New("Could Not Check The Token, Try Again Later")
+)
+
+//How far the clocks of the instances may drift apart when checking the expiry and issue time
+const clockSkew = 30 * time.Second
 
+//What a login token says about its bearer. Tokens from before issuers were added have no
+//issuer, audience, expiry or ID, see Settings.AcceptLegacyUntil.
+type Claims struct {
+	Authorized bool   `json:"authorized"`
+	UserID     uint32 `json:"user_id"`
+	Role       string `json:"role,omitempty"`
+	jwt.StandardClaims
+
+	raw string
 }
 
-//Validate the authenticity of the JWT
-func TokenValid(r *http.Request) error {
-	tokenString := ExtractToken(r)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+//Token ID, empty for legacy tokens
+func (c *Claims) TokenID() string {
+	return c.Id
+}
+
+func (c *Claims) Legacy() bool {
+	return c.Issuer == ""
+}
+
+//What a revoked token is remembered by, its ID or the hash of legacy tokens that have none
+func (c *Claims) RevocationKey() string {
+	if c.Id != "" {
+		return c.Id
+	}
+	return "legacy:" + tokens.Hash(c.raw)
+}
+
+//When the token stops working anyway. Legacy tokens stop at the cutoff for them, nil when there's none.
+func (c *Claims) Expiry() *time.Time {
+	if c.ExpiresAt == 0 {
+		cutoff := currentSettings().AcceptLegacyUntil
+		if cutoff.IsZero() {
+			return nil
+		}
+		return &cutoff
+	}
+	expiry := time.Unix(c.ExpiresAt, 0)
+	return &expiry
+}
+
+//Creates jwt to validate user's action
+func CreateToken(user_id uint32, role string) (string, error) {
+	settings := currentSettings()
+	id, err := tokens.Generate(24)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := Claims{
+		Authorized: true,
+		UserID:     user_id,
+		Role:       role,
+		StandardClaims: jwt.StandardClaims{
+			Id:        id,
+			Issuer:    settings.Issuer,
+			Audience:  settings.Audience[0],
+			Subject:   strconv.FormatUint(uint64(user_id), 10),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(settings.TTL).Unix(),
+		},
+	}
+	key := currentKeys().Signing
+	if key == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(os.Getenv("API_SECRET")))
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+//Key the token claims to be signed with. HS256 tokens are checked with API_SECRET while nothing
+//else signs tokens or before JWT_ACCEPT_HMAC_UNTIL, the rest with the published key named by kid.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	keys := currentKeys()
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if keys.Signing != nil && !time.Now().Before(currentSettings().AcceptHMACUntil) {
+			return nil, errors.New("HMAC Tokens Are No Longer Accepted")
 		}
 		return []byte(os.Getenv("API_SECRET")), nil
-	})
+	}
+	kid, _ := token.Header["kid"].(string)
+	key := keys.lookup(kid)
+	if key == nil {
+		return nil, fmt.Errorf("Unknown Signing Key: %q", kid)
+	}
+	//A key only checks tokens of its own algorithm
+	if key.Method.Alg() != token.Method.Alg() {
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.Public, nil
+}
+
+//Checks the signature, issuer, audience and expiry of a token and returns its claims
+func ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	parser := jwt.Parser{
+		ValidMethods:         []string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg(), SigningMethodEdDSA.Alg()},
+		SkipClaimsValidation: true,
+	}
+	token, err := parser.ParseWithClaims(tokenString, claims, verificationKey)
+	if err != nil || !token.Valid || claims.UserID == 0 {
+		return nil, ErrInvalidToken
+	}
+	claims.raw = tokenString
+
+	settings := currentSettings()
+	now := time.Now()
+	if claims.IssuedAt > now.Add(clockSkew).Unix() {
+		return nil, ErrInvalidToken
+	}
+	if claims.Legacy() {
+		if !now.Before(settings.AcceptLegacyUntil) {
+			return nil, ErrTokenExpired
+		}
+		return claims, nil
+	}
+	if claims.Issuer != settings.Issuer || !settings.audience(claims.Audience) || claims.Id == "" {
+		return nil, ErrInvalidToken
+	}
+	if claims.ExpiresAt == 0 || claims.ExpiresAt < now.Add(-clockSkew).Unix() {
+		return nil, ErrTokenExpired
+	}
+	return claims, nil
+}
+
+//Claims of the request's token, taken from the context once Authenticate checked them.
+//Otherwise the token is parsed and checked against the revoked ones.
+func RequestClaims(r *http.Request) (*Claims, error) {
+	if claims, ok := ClaimsFromContext(r.Context()); ok {
+		return claims, nil
+	}
+	claims, err := ParseToken(ExtractToken(r))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		Pretty(claims)
+	if revoked != nil {
+		isRevoked, err := revoked(r.Context(), claims)
+		if err != nil {
+			return nil, ErrRevocationUnavailable
+		}
+		if isRevoked {
+			return nil, ErrTokenRevoked
+		}
 	}
-	return nil
+	if sessionSeen != nil {
+		sessionSeen(r, claims)
+	}
+	return claims, nil
+}
+
+//Validate the authenticity of the JWT
+func TokenValid(r *http.Request) error {
+	_, err := RequestClaims(r)
+	return err
+}
+
+//Reports whether a token was revoked, see SetRevocationCheck
+var revoked func(ctx context.Context, claims *Claims) (bool, error)
+
+//Installs the check TokenValid runs on every token, tokens it fails for are refused
+func SetRevocationCheck(check func(ctx context.Context, claims *Claims) (bool, error)) {
+	revoked = check
 }
 
+//Told about requests made with valid tokens, see SetSessionTracker
+var sessionSeen func(r *http.Request, claims *Claims)
+
+//Installs what RequestClaims reports valid tokens to, so the sessions they belong to can be recorded
+func SetSessionTracker(track func(r *http.Request, claims *Claims)) {
+	sessionSeen = track
+}
+
+type claimsContextKey struct{}
+
+//Puts checked claims on the context for the controllers
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+//Claims that were checked for this request, if any
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
+
+//Browsers can't set headers on WebSocket connections, so the tracking socket alone may take the token in
+//?token=. Anywhere else it would end up in access logs and referrers.
+var queryTokenPath = regexp.MustCompile(`^/booking/[0-9]+/location/ws$`)
+
 func ExtractToken(r *http.Request) string {
-	keys := r.URL.Query()
-	token := keys.Get("token")
-	if token != "" {
-		return token
+	if queryTokenPath.MatchString(r.URL.Path) {
+		if token := r.URL.Query().Get("token"); token != "" {
+			return token
+		}
 	}
 	bearerToken := r.Header.Get("Authorization")
 	if len(strings.Split(bearerToken, " ")) == 2 {
@@ -55,25 +233,20 @@ func ExtractToken(r *http.Request) string {
 }
 
 func ExtractTokenID(r *http.Request) (uint32, error) {
-	tokenString := ExtractToken(r)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("API_SECRET")), nil
-	})
+	claims, err := RequestClaims(r)
 	if err != nil {
 		return 0, err
 	}
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if ok && token.Valid {
-		uid, err := strconv.ParseUint(fmt.Sprintf("%.0f", claims["user_id"]), 10, 32)
-		if err != nil {
-			return 0, err
-		}
-		return uint32(uid), nil
+	return claims.UserID, nil
+}
+
+//Role the token was issued with, empty for tokens from before roles
+func ExtractTokenRole(r *http.Request) (string, error) {
+	claims, err := RequestClaims(r)
+	if err != nil {
+		return "", err
 	}
-	return 0, nil
+	return claims.Role, nil
 }
 
 //Pretty display the claims licely in the terminal
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+//Secret of the RFC 6238 test vectors, "12345678901234567890" in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+//SHA1 test vectors of RFC 6238 appendix B, the 6 digit codes are the last 6 of its 8 digit ones
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCode(t *testing.T) {
+	key := []byte("12345678901234567890")
+	for _, vector := range rfc6238Vectors {
+		counter := uint64(vector.unix / totpPeriod)
+		if got := totpCode(key, counter); got != vector.code {
+			t.Errorf("totpCode at %d = %q, want %q", vector.unix, got, vector.code)
+		}
+	}
+}
+
+func TestValidateTOTPAt(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		at := time.Unix(vector.unix, 0)
+		step := uint64(vector.unix / totpPeriod)
+
+		tests := []struct {
+			name        string
+			secret      string
+			code        string
+			lastCounter uint64
+			at          time.Time
+			wantStep    uint64
+			wantOK      bool
+		}{
+			{"current step", rfc6238Secret, vector.code, 0, at, step, true},
+			{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", vector.code, 0, at, step, true},
+			{"surrounding spaces", rfc6238Secret, " " + vector.code + "\n", 0, at, step, true},
+			{"one step late", rfc6238Secret, vector.code, 0, at.Add(totpPeriod * time.Second), step, true},
+			{"one step early", rfc6238Secret, vector.code, 0, at.Add(-totpPeriod * time.Second), step, true},
+			{"two steps late", rfc6238Secret, vector.code, 0, at.Add(2 * totpPeriod * time.Second), 0, false},
+			{"two steps early", rfc6238Secret, vector.code, 0, at.Add(-2 * totpPeriod * time.Second), 0, false},
+			{"step already used", rfc6238Secret, vector.code, step, at, 0, false},
+			{"later step used", rfc6238Secret, vector.code, step + 1, at, 0, false},
+			{"earlier step used", rfc6238Secret, vector.code, step - 1, at, step, true},
+			{"wrong code", rfc6238Secret, "000000", 0, at, 0, false},
+			{"short code", rfc6238Secret, vector.code[1:], 0, at, 0, false},
+			{"long code", rfc6238Secret, vector.code + "0", 0, at, 0, false},
+			{"invalid secret", "not base32!", vector.code, 0, at, 0, false},
+			{"other secret", "JBSWY3DPEHPK3PXP", vector.code, 0, at, 0, false},
+		}
+		for _, test := range tests {
+			//Before 1970 isn't a time codes are checked at
+			if test.at.Unix() < 0 {
+				continue
+			}
+			gotStep, gotOK := validateTOTPAt(test.secret, test.code, test.lastCounter, test.at)
+			if gotStep != test.wantStep || gotOK != test.wantOK {
+				t.Errorf("%d %s: validateTOTPAt = %d, %v, want %d, %v", vector.unix, test.name, gotStep, gotOK, test.wantStep, test.wantOK)
+			}
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	step := uint64(time.Now().Unix() / totpPeriod)
+	code := totpCode([]byte("12345678901234567890"), step)
+
+	counter, ok := ValidateTOTP(rfc6238Secret, code, 0)
+	if !ok || counter < step || counter > step+1 {
+		t.Fatalf("ValidateTOTP of the current code = %d, %v, want step %d", counter, ok, step)
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, code, counter); ok {
+		t.Errorf("ValidateTOTP accepted the code again after step %d was used", counter)
+	}
+}
@@ -0,0 +1,181 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/utils/encryption"
+)
+
+//Format version written into every backup
+const formatVersion = 1
+
+//Contents of a backup before compression and encryption
+type Archive struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Tables    []Table   `json:"tables"`
+}
+
+//Rows of one table, values are in the order of the columns
+type Table struct {
+	Name    string          `json:"name"`
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+//Reads every row of the tables of the given models
+func Dump(ctx context.Context, db *gorm.DB, models []interface{}) (*Archive, error) {
+	archive := &Archive{Version: formatVersion, CreatedAt: time.Now().UTC(), Tables: []Table{}}
+
+	for _, model := range models {
+		name := db.NewScope(model).TableName()
+		rows, err := db.DB().QueryContext(ctx, "SELECT * FROM `"+name+"`")
+		if err != nil {
+			return nil, err
+		}
+
+		table := Table{Name: name, Rows: [][]interface{}{}}
+		table.Columns, err = rows.Columns()
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		for rows.Next() {
+			values := make([]interface{}, len(table.Columns))
+			pointers := make([]interface{}, len(values))
+			for i := range values {
+				pointers[i] = &values[i]
+			}
+			err = rows.Scan(pointers...)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			for i, value := range values {
+				switch v := value.(type) {
+				case []byte:
+					values[i] = string(v)
+				case time.Time:
+					values[i] = v.Format("2006-01-02 15:04:05.999999")
+				}
+			}
+			table.Rows = append(table.Rows, values)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		archive.Tables = append(archive.Tables, table)
+	}
+	return archive, nil
+}
+
+//Replaces the contents of the tables with the rows of the archive in one transaction
+func Load(ctx context.Context, db *gorm.DB, archive *Archive) error {
+	if archive.Version != formatVersion {
+		return fmt.Errorf("Unsupported backup version %d", archive.Version)
+	}
+
+	tx, err := db.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	//Rows are inserted table by table, so references are only checked once all are back
+	_, err = tx.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, table := range archive.Tables {
+		_, err = tx.ExecContext(ctx, "DELETE FROM `"+table.Name+"`")
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if len(table.Rows) == 0 {
+			continue
+		}
+
+		columns := make([]string, len(table.Columns))
+		for i, column := range table.Columns {
+			columns[i] = "`" + column + "`"
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",")
+		statement := "INSERT INTO `" + table.Name + "` (" + strings.Join(columns, ",") + ") VALUES (" + placeholders + ")"
+
+		for _, row := range table.Rows {
+			if len(row) != len(columns) {
+				tx.Rollback()
+				return fmt.Errorf("Row of %s has %d values for %d columns", table.Name, len(row), len(columns))
+			}
+			_, err = tx.ExecContext(ctx, statement, row...)
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("Restoring %s failed: %v", table.Name, err)
+			}
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 1")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+//Compresses and encrypts the archive with DATA_ENCRYPTION_KEY
+func Seal(archive *Archive) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	err := json.NewEncoder(writer).Encode(archive)
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := encryption.Encrypt(buffer.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return []byte(sealed), nil
+}
+
+//Decrypts and decompresses a backup made by Seal
+func Open(sealed []byte) (*Archive, error) {
+	compressed, err := encryption.Decrypt(strings.TrimSpace(string(sealed)))
+	if err != nil {
+		return nil, errors.New("Cannot decrypt backup, check DATA_ENCRYPTION_KEY")
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	archive := &Archive{}
+	decoder := json.NewDecoder(reader)
+	decoder.UseNumber() //Keeps large ids exact
+	err = decoder.Decode(archive)
+	if err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
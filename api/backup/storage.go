@@ -0,0 +1,67 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/victorkabata/FixIt-API/api/storage"
+)
+
+//Bucket backups are kept in, BACKUP_BUCKET in the environment
+func Bucket() string {
+	if bucket := os.Getenv("BACKUP_BUCKET"); bucket != "" {
+		return bucket
+	}
+	return storage.S3Settings().Bucket
+}
+
+func newS3() (*s3.S3, error) {
+	s, err := storage.NewAWSSession(storage.S3Settings())
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(s), nil
+}
+
+//Stores a sealed backup under the key, readable only with the bucket credentials
+func Upload(ctx context.Context, key string, sealed []byte) error {
+	client, err := newS3()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(Bucket()),
+		Key:                  aws.String(key),
+		ACL:                  aws.String("private"),
+		Body:                 bytes.NewReader(sealed),
+		ContentLength:        aws.Int64(int64(len(sealed))),
+		ContentType:          aws.String("application/octet-stream"),
+		ServerSideEncryption: aws.String("AES256"),
+	})
+	return storage.S3Error(err)
+}
+
+//Fetches a sealed backup stored by Upload
+func Download(ctx context.Context, key string) ([]byte, error) {
+	client, err := newS3()
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(Bucket()),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, storage.S3Error(err)
+	}
+	defer object.Body.Close()
+
+	body, err := ioutil.ReadAll(object.Body)
+	return body, storage.S3Error(err)
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type entry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+//In-memory key/value store whose entries expire after a time to live
+type Cache struct {
+	mu      sync.RWMutex
+	entries map[string]entry
+}
+
+func New() *Cache {
+	return &Cache{entries: map[string]entry{}}
+}
+
+//Returns the value stored under key if it hasn't expired
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	item, ok := c.entries[key]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(item.expiresAt) {
+		return nil, false
+	}
+	return item.value, true
+}
+
+//Stores value under key for the given time to live
+func (c *Cache) Set(key string, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evictExpired()
+	c.entries[key] = entry{value: value, expiresAt: time.Now().Add(ttl)}
+}
+
+//Removes the value stored under key
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+//Must be called with the lock held
+func (c *Cache) evictExpired() {
+	now := time.Now()
+	for key, item := range c.entries {
+		if now.After(item.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
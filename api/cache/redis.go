@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/victorkabata/FixIt-API/api/dependency"
+)
+
+//Shared cache in Redis
+type Redis struct {
+	client *redis.Client
+}
+
+//Client of a redis:// or rediss:// URL, e.g. redis://:password@localhost:6379/0
+func NewRedis(rawURL string) (*Redis, error) {
+	client, err := NewRedisClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Redis{client: client}, nil
+}
+
+//Redis client of a redis:// or rediss:// URL, with the timeouts the API expects of it
+func NewRedisClient(rawURL string) (*redis.Client, error) {
+	options, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, errors.New("Invalid REDIS_URL")
+	}
+	options.DialTimeout = 2 * time.Second
+	options.ReadTimeout = 2 * time.Second
+	options.WriteTimeout = 2 * time.Second
+	return redis.NewClient(options), nil
+}
+
+//Error replies of the server are permanent, the connection failing may not be
+func redisFailure(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(redis.Error); ok {
+		return dependency.New(dependency.Redis, dependency.Permanent, err)
+	}
+	return dependency.Wrap(dependency.Redis, err)
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := r.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, redisFailure(err)
+	}
+	return value, true, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return redisFailure(r.client.Set(ctx, key, value, ttl).Err())
+}
+
+//The counters are increased in one round trip
+func (r *Redis) Incr(ctx context.Context, keys ...string) error {
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Incr(ctx, key)
+		}
+		return nil
+	})
+	return redisFailure(err)
+}
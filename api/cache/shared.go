@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//Cache shared by every instance of the API, so what one caches or invalidates the others see
+type Shared interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	//A ttl of 0 keeps the value until it is replaced
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	//Adds one to each of the counters, starting those missing at 1
+	Incr(ctx context.Context, keys ...string) error
+}
+
+//Redis at REDIS_URL, or the memory of this instance when it isn't set or is invalid
+func SharedFromEnv() Shared {
+	rawURL := os.Getenv("REDIS_URL")
+	if rawURL == "" {
+		return NewLocal()
+	}
+	client, err := NewRedis(rawURL)
+	if err != nil {
+		log.Printf("%v, caching in memory instead", err)
+		return NewLocal()
+	}
+	return client
+}
+
+//Shared cache kept in memory, for a single instance and development
+type Local struct {
+	cache    *Cache
+	mu       sync.Mutex
+	counters map[string]int64
+}
+
+func NewLocal() *Local {
+	return &Local{cache: New(), counters: map[string]int64{}}
+}
+
+//Counters read as their decimal value, as in Redis
+func (l *Local) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	l.mu.Lock()
+	counter, counted := l.counters[key]
+	l.mu.Unlock()
+	if counted {
+		return []byte(strconv.FormatInt(counter, 10)), true, nil
+	}
+	value, ok := l.cache.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	return value.([]byte), true, nil
+}
+
+func (l *Local) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = 100 * 365 * 24 * time.Hour
+	}
+	l.cache.Set(key, value, ttl)
+	return nil
+}
+
+//Counters never expire
+func (l *Local) Incr(ctx context.Context, keys ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		l.counters[key]++
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/backup"
+	"github.com/victorkabata/FixIt-API/api/geocode"
+	"github.com/victorkabata/FixIt-API/api/models"
+)
+
+//Runs a maintenance subcommand instead of the server, e.g. backup, restore, geo-backfill, upgrade-passwords,
+//export-accounts, import-accounts or set-role
+func RunCommand(args []string) {
+	loadEnv()
+
+	switch args[0] {
+	case "backup":
+		err := runBackup(args[1:])
+		if err != nil {
+			log.Fatalf("Backup failed: %v", err)
+		}
+	case "restore":
+		err := runRestore(args[1:])
+		if err != nil {
+			log.Fatalf("Restore failed: %v", err)
+		}
+	case "geo-backfill":
+		err := runGeoBackfill(args[1:])
+		if err != nil {
+			log.Fatalf("Geocoding backfill failed: %v", err)
+		}
+	case "upgrade-passwords":
+		err := runUpgradePasswords(args[1:])
+		if err != nil {
+			log.Fatalf("Upgrading password hashes failed: %v", err)
+		}
+	case "export-accounts":
+		err := runExportAccounts(args[1:])
+		if err != nil {
+			log.Fatalf("Exporting accounts failed: %v", err)
+		}
+	case "import-accounts":
+		err := runImportAccounts(args[1:])
+		if err != nil {
+			log.Fatalf("Importing accounts failed: %v", err)
+		}
+	case "set-role":
+		err := runSetRole(args[1:])
+		if err != nil {
+			log.Fatalf("Setting the role failed: %v", err)
+		}
+	default:
+		log.Fatalf("Unknown command %q, expected backup, restore, geo-backfill, upgrade-passwords, export-accounts, import-accounts or set-role", args[0])
+	}
+}
+
+func connect() {
+	server.Initialize(os.Getenv("DB_DRIVER"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_NAME"))
+}
+
+//Dumps the tables, encrypts them and uploads them to the backup bucket or writes them to a file
+func runBackup(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := flags.String("o", "", "Write the backup to this file instead of uploading it")
+	flags.Parse(args)
+
+	connect()
+	ctx := context.Background()
+
+	archive, err := backup.Dump(ctx, server.DB, models.Tables())
+	if err != nil {
+		return err
+	}
+	sealed, err := backup.Seal(archive)
+	if err != nil {
+		return err
+	}
+
+	if *output != "" {
+		err = ioutil.WriteFile(*output, sealed, 0600)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Backup written to %s\n", *output)
+		return nil
+	}
+
+	key := "backups/fixit-" + archive.CreatedAt.Format("20060102T150405Z") + ".bak"
+	err = backup.Upload(ctx, key, sealed)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backup uploaded to s3://%s/%s\n", backup.Bucket(), key)
+	return nil
+}
+
+//Replaces the database contents with a backup from the bucket or a file
+func runRestore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	input := flags.String("i", "", "Read the backup from this file instead of the bucket")
+	confirm := flags.Bool("yes", false, "Confirm that the current data will be replaced")
+	flags.Parse(args)
+
+	if *input == "" && flags.NArg() != 1 {
+		return fmt.Errorf("Usage: restore -yes <key> or restore -yes -i <file>")
+	}
+	if !*confirm {
+		return fmt.Errorf("Restoring replaces all current data, run again with -yes")
+	}
+
+	ctx := context.Background()
+
+	var sealed []byte
+	var err error
+	if *input != "" {
+		sealed, err = ioutil.ReadFile(*input)
+	} else {
+		sealed, err = backup.Download(ctx, flags.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+
+	archive, err := backup.Open(sealed)
+	if err != nil {
+		return err
+	}
+
+	connect()
+	err = backup.Load(ctx, server.DB, archive)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %d tables from the backup of %s\n", len(archive.Tables), archive.CreatedAt.Format(time.RFC1123))
+	return nil
+}
+
+//Geocodes users with an address but zeroed coordinates, printing the progress as it goes
+func runGeoBackfill(args []string) error {
+	flags := flag.NewFlagSet("geo-backfill", flag.ExitOnError)
+	limit := flags.Int("limit", 0, "Stop after geocoding this many users")
+	flags.Parse(args)
+
+	connect()
+
+	return server.BackfillCoordinates(context.Background(), *limit, func(progress geocode.Progress) {
+		if progress.Processed == 0 {
+			fmt.Printf("%d users to geocode\n", progress.Total)
+			return
+		}
+		if progress.Processed%10 == 0 || progress.Processed == progress.Total {
+			fmt.Printf("%d/%d processed, %d updated, %d not found, %d failed\n", progress.Processed, progress.Total, progress.Updated, progress.NotFound, progress.Failed)
+		}
+	})
+}
+
+//Upgrades every stored password hash to the current hasher in batches, printing where to resume from
+func runUpgradePasswords(args []string) error {
+	flags := flag.NewFlagSet("upgrade-passwords", flag.ExitOnError)
+	after := flags.Uint("after", 0, "Start after this user ID, the last ID printed by an interrupted run")
+	batch := flags.Int("batch", 100, "Users read at a time")
+	flags.Parse(args)
+	if *batch < 1 {
+		return fmt.Errorf("Invalid batch size %d", *batch)
+	}
+
+	connect()
+	ctx := context.Background()
+
+	progress := models.PasswordUpgradeProgress{LastID: uint32(*after)}
+	for {
+		more, err := models.UpgradePasswordHashes(ctx, server.DB, progress.LastID, *batch, &progress)
+		if err != nil {
+			fmt.Printf("Stopped after user %d, resume with -after %d\n", progress.LastID, progress.LastID)
+			return err
+		}
+		fmt.Printf("%d checked, %d upgraded, %d failed, last user %d\n", progress.Checked, progress.Upgraded, progress.Failed, progress.LastID)
+		if !more {
+			return nil
+		}
+	}
+}
+
+//Writes the accounts with their credentials to a file encrypted with ACCOUNT_TRANSFER_KEY
+func runExportAccounts(args []string) error {
+	flags := flag.NewFlagSet("export-accounts", flag.ExitOnError)
+	output := flags.String("o", "", "Write the accounts to this file")
+	ids := flags.String("ids", "", "Comma separated IDs of the accounts, all of them when left out")
+	flags.Parse(args)
+	if *output == "" {
+		return fmt.Errorf("Usage: export-accounts -o <file> [-ids 1,2]")
+	}
+
+	uids := []uint32{}
+	for _, field := range strings.Split(*ids, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(field), 10, 32)
+		if err != nil {
+			return fmt.Errorf("Invalid user ID %q", field)
+		}
+		uids = append(uids, uint32(id))
+	}
+
+	connect()
+	export, err := models.ExportAccounts(context.Background(), server.DB, uids)
+	if err != nil {
+		return err
+	}
+	sealed, err := models.SealAccountExport(export)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(*output, sealed, 0600)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d accounts written to %s\n", len(export.Accounts), *output)
+	return nil
+}
+
+//Creates the accounts of an encrypted export, printing the new ID of each. Accounts clashing with existing ones
+//are skipped and listed, the others are still imported.
+func runImportAccounts(args []string) error {
+	flags := flag.NewFlagSet("import-accounts", flag.ExitOnError)
+	input := flags.String("i", "", "Read the accounts from this file")
+	flags.Parse(args)
+	if *input == "" {
+		return fmt.Errorf("Usage: import-accounts -i <file>")
+	}
+
+	sealed, err := ioutil.ReadFile(*input)
+	if err != nil {
+		return err
+	}
+	export, err := models.OpenAccountExport(sealed)
+	if err != nil {
+		return err
+	}
+
+	connect()
+	ctx := context.Background()
+
+	imported, skipped := 0, 0
+	for i := range export.Accounts {
+		transfer := &export.Accounts[i]
+		user, err := models.ImportAccount(ctx, server.DB, transfer)
+		if err != nil {
+			fmt.Printf("Skipped user %d (%s): %v\n", transfer.User.ID, transfer.User.Email, err)
+			skipped++
+			continue
+		}
+		fmt.Printf("User %d imported as %d\n", transfer.User.ID, user.ID)
+		imported++
+	}
+	fmt.Printf("%d accounts imported, %d skipped, from the export of %s\n", imported, skipped, export.ExportedAt.Format(time.RFC1123))
+	return nil
+}
+
+//Gives a user a role from the command line, which is how the first admin is made since the /admin routes
+//need an admin's token
+func runSetRole(args []string) error {
+	flags := flag.NewFlagSet("set-role", flag.ExitOnError)
+	email := flags.String("email", "", "Email of the user")
+	role := flags.String("role", "", "customer, provider or admin")
+	flags.Parse(args)
+	if *email == "" || *role == "" {
+		return fmt.Errorf("Usage: set-role -email <email> -role <role>")
+	}
+
+	connect()
+	ctx := context.Background()
+
+	user := models.User{}
+	found, err := user.FindUserByEmail(ctx, server.DB, *email)
+	if err != nil {
+		return err
+	}
+	updated, err := models.SetUserRole(ctx, server.DB, found.ID, *role)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("User %d (%s) is now %s\n", updated.ID, updated.Email, updated.Role)
+	return nil
+}
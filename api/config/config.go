@@ -0,0 +1,82 @@
+package config
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+//Settings that can be changed without a restart. Connections, keys and secrets need one.
+var reloadable = map[string]bool{
+	"LOG_LEVEL":                    true,
+	"SQL_LOG":                      true,
+	"SLOW_QUERY_THRESHOLD":         true,
+	"MAINTENANCE_MODE":             true,
+	"MAINTENANCE_MESSAGE":          true,
+	"MAINTENANCE_RETRY_AFTER":      true,
+	"MIN_APP_VERSION":              true,
+	"LATEST_APP_VERSION":           true,
+	"AUTH_RATE_LIMIT":              true,
+	"PLACES_RATE_LIMIT":            true,
+	"IP_BLOCK_SCORE":               true,
+	"IP_REPUTATION_CACHE_TTL":      true,
+	"RISK_VERIFY_SCORE":            true,
+	"RISK_REVIEW_SCORE":            true,
+	"REVIEWS_REQUIRE_BOOKING":      true,
+	"REVIEW_DAILY_LIMIT":           true,
+	"REVIEW_BURST_THRESHOLD":       true,
+	"REVIEW_EDIT_WINDOW":           true,
+	"REVIEW_REQUEST_DELAY":         true,
+	"MAX_GALLERY_ITEMS":            true,
+	"BOOKING_DEPOSIT_PERCENT":      true,
+	"DEFAULT_SERVICE_RADIUS_KM":    true,
+	"PUBLIC_LOCATION_PRECISION_KM": true,
+	"ACCOUNT_DELETION_GRACE_DAYS":  true,
+	"EMAIL_VERIFICATION":           true,
+	"EMAIL_VERIFICATION_GRACE":     true,
+	"GEOCODER_INTERVAL":            true,
+}
+
+//Whether the setting can be changed without a restart
+func Reloadable(name string) bool {
+	return reloadable[name]
+}
+
+//Reads the env files again and applies the reloadable settings in them, returning the names of the ones that changed.
+//Settings that aren't in the files keep their value so ones set by the platform survive.
+func Reload(filenames ...string) ([]string, error) {
+	values, err := godotenv.Read(filenames...)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := []string{}
+	for name := range reloadable {
+		value, ok := values[name]
+		current, set := os.LookupEnv(name)
+		if !ok || (set && value == current) {
+			continue
+		}
+
+		err = os.Setenv(name, value)
+		if err != nil {
+			return changed, err
+		}
+		changed = append(changed, name)
+	}
+
+	sort.Strings(changed)
+	return changed, nil
+}
+
+//Whether any of the changed settings starts with the prefix
+func Changed(changed []string, prefix string) bool {
+	for _, name := range changed {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,311 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/logger"
+	"github.com/victorkabata/FixIt-API/api/media"
+	"github.com/victorkabata/FixIt-API/api/middlewares"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/storage"
+)
+
+//Endpoint to get the current maintenance state
+func (server *Server) GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	responses.JSON(w, http.StatusOK, middlewares.GetMaintenance(r.Context()))
+}
+
+//Endpoint to switch maintenance mode on or off, on every instance
+func (server *Server) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	state := middlewares.Maintenance{}
+	err = json.Unmarshal(body, &state)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = middlewares.SetMaintenance(r.Context(), state)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, middlewares.GetMaintenance(r.Context()))
+}
+
+//Endpoint to read the runtime counters, e.g. IP reputation lookups and block decisions
+func (server *Server) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	expvar.Handler().ServeHTTP(w, r)
+}
+
+//Whether the request asks for a dry run with ?dry_run=true
+func dryRun(r *http.Request) bool {
+	value, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	return value
+}
+
+//Endpoint to delete users right away, ?dry_run=true only reports what would be deleted
+func (server *Server) BulkDeleteUsers(w http.ResponseWriter, r *http.Request) {
+	server.bulkUserOperation(w, r, models.BulkDeleteUsers)
+}
+
+//Endpoint to lock users out of their accounts, ?dry_run=true only reports what would change
+func (server *Server) BulkSuspendUsers(w http.ResponseWriter, r *http.Request) {
+	server.bulkUserOperation(w, r, models.BulkSuspendUsers)
+}
+
+func (server *Server) bulkUserOperation(w http.ResponseWriter, r *http.Request, operation func(ctx context.Context, db *gorm.DB, uids []uint32, dryRun bool) (*models.AdminOperationResult, error)) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		UserIDs []uint32 `json:"user_ids"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	//Read first, deleted users are gone afterwards
+	areas := server.searchAreas(r.Context(), request.UserIDs...)
+	result, err := operation(r.Context(), server.DB, request.UserIDs, dryRun(r))
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if !dryRun(r) {
+		server.invalidateSearches(r.Context(), areas...)
+	}
+	responses.JSON(w, http.StatusOK, result)
+}
+
+//Endpoint to merge a duplicate account into another one, ?dry_run=true only reports what would move
+func (server *Server) MergeUsers(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		SourceID uint32 `json:"source_id"` //Account that is deleted
+		TargetID uint32 `json:"target_id"` //Account that is kept
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if request.SourceID == 0 || request.TargetID == 0 {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Source And Target"))
+		return
+	}
+
+	areas := server.searchAreas(r.Context(), request.SourceID, request.TargetID)
+	result, err := models.MergeUsers(r.Context(), server.DB, request.SourceID, request.TargetID, dryRun(r))
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if !dryRun(r) {
+		server.invalidateSearches(r.Context(), areas...)
+	}
+	responses.JSON(w, http.StatusOK, result)
+}
+
+//Endpoint to give a user the admin, provider or customer role, they log in again to get it in their token
+func (server *Server) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	uid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		Role string `json:"role"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if !auth.ValidRole(request.Role) {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Invalid Role"))
+		return
+	}
+
+	user, err := models.SetUserRole(r.Context(), server.DB, uint32(uid), request.Role)
+	if err != nil && err.Error() == "User Not Found" {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	server.invalidateSearches(r.Context(), user)
+	responses.JSON(w, http.StatusOK, user.Admin())
+}
+
+//Endpoint to send email to a user again after their address bounced or complained, such as once their mailbox works again
+func (server *Server) ClearEmailStatus(w http.ResponseWriter, r *http.Request) {
+	uid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	err = models.ClearEmailStatus(r.Context(), server.DB, uint32(uid))
+	if err != nil && err.Error() == "User Not Found" {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//Finds the uploaded files no record points at and deletes them unless it is a dry run
+func (server *Server) ReconcileMedia(ctx context.Context, options media.Options) (media.Report, error) {
+	s, err := newAWSSession()
+	if err != nil {
+		return media.Report{}, err
+	}
+	report, err := server.MediaReconciler.Run(ctx, media.NewS3Store(s, storage.S3Settings().Bucket), &models.MediaReferences{DB: server.DB}, options)
+	if err == nil {
+		log.Printf("Media reconciliation found %d orphans of %d files (%d bytes), deleted %d", report.Orphans, report.Scanned, report.OrphanBytes, report.Deleted)
+	}
+	return report, err
+}
+
+//Endpoint to start a reconciliation of uploaded files in the background, ?dry_run=true only reports the orphans
+func (server *Server) StartMediaReconcile(w http.ResponseWriter, r *http.Request) {
+	if server.MediaReconciler.Report().Running {
+		responses.ERROR(w, http.StatusConflict, media.ErrReconcileRunning)
+		return
+	}
+
+	options := media.OptionsFromEnv()
+	options.DryRun = dryRun(r)
+	//The reconciliation outlives the request
+	go func() {
+		_, err := server.ReconcileMedia(context.Background(), options)
+		if err != nil {
+			log.Printf("Media reconciliation failed: %v", err)
+		}
+	}()
+	responses.JSON(w, http.StatusAccepted, map[string]interface{}{"message": "Reconciliation Started", "dry_run": options.DryRun})
+}
+
+//Endpoint to get the report of the running or last reconciliation
+func (server *Server) GetMediaReconcile(w http.ResponseWriter, r *http.Request) {
+	responses.JSON(w, http.StatusOK, server.MediaReconciler.Report())
+}
+
+//Endpoint to list the users taking the most storage
+func (server *Server) GetStorageUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := models.FindStorageUsage(r.Context(), server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, usage)
+}
+
+//Endpoint to get the storage a user takes along with their latest files
+func (server *Server) GetUserStorage(w http.ResponseWriter, r *http.Request) {
+	uid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	usage, err := models.FindUserStorageUsage(r.Context(), server.DB, uint32(uid))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	objects, err := models.FindUserStoredObjects(r.Context(), server.DB, uint32(uid))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, map[string]interface{}{"usage": usage, "objects": objects})
+}
+
+//Longest a temporary log level change can last
+const maxLogOverride = 24 * time.Hour
+
+//Endpoint to get the log level and SQL logging in effect
+func (server *Server) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	responses.JSON(w, http.StatusOK, logger.Current())
+}
+
+//Endpoint to change the log level and SQL logging for a while, 15 minutes unless a duration is given
+func (server *Server) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	current := logger.Current()
+	request := struct {
+		Level    string `json:"level"`
+		SQL      *bool  `json:"sql"`
+		Duration string `json:"duration"` //e.g. 30m
+	}{Level: current.Level, SQL: &current.SQL, Duration: "15m"}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	duration, err := time.ParseDuration(request.Duration)
+	if err != nil || duration <= 0 || duration > maxLogOverride {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Duration Must Be Between 1s And 24h"))
+		return
+	}
+	sql := current.SQL
+	if request.SQL != nil {
+		sql = *request.SQL
+	}
+
+	settings, err := logger.Override(request.Level, sql, duration)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	log.Printf("Log level set to %s, SQL logging %t until %s", settings.Level, settings.SQL, settings.ExpiresAt.Format(time.RFC3339))
+	responses.JSON(w, http.StatusOK, settings)
+}
+
+//Endpoint to end a temporary log level change early
+func (server *Server) ResetLogLevel(w http.ResponseWriter, r *http.Request) {
+	responses.JSON(w, http.StatusOK, logger.ClearOverride())
+}
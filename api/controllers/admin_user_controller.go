@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Body of the admin user actions, the reason is kept in the audit history
+type adminActionRequest struct {
+	Reason string `json:"reason"`
+	//email or phone_number, for manual verification
+	Field string `json:"field"`
+}
+
+//Runs an action of a logged in admin on the user in the path, answering the user as it is afterwards
+func (server *Server) adminUserAction(w http.ResponseWriter, r *http.Request, reasonRequired bool, action func(ctx context.Context, db *gorm.DB, adminID, uid uint32, request adminActionRequest) (*models.User, error)) (*models.User, bool) {
+	uid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	adminID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, false
+	}
+
+	request := adminActionRequest{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return nil, false
+	}
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &request)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return nil, false
+		}
+	}
+	request.Reason = strings.TrimSpace(request.Reason)
+	if reasonRequired && request.Reason == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, apierror.Invalid("reason", "Required Reason"))
+		return nil, false
+	}
+	if utf8.RuneCountInString(request.Reason) > 255 {
+		responses.ERROR(w, http.StatusUnprocessableEntity, apierror.Invalid("reason", "Reason Too Long"))
+		return nil, false
+	}
+
+	user, err := action(r.Context(), server.DB, adminID, uint32(uid), request)
+	if err != nil && err.Error() == "User Not Found" {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return nil, false
+	}
+	if err == models.ErrUserBanned || err == models.ErrUserNotBanned || err == models.ErrUserNotLocked {
+		responses.ERROR(w, http.StatusConflict, err)
+		return nil, false
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return user, true
+}
+
+//Endpoint for admins to ban a user with {"reason": "..."}, logging them out everywhere
+func (server *Server) BanUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := server.adminUserAction(w, r, true, func(ctx context.Context, db *gorm.DB, adminID, uid uint32, request adminActionRequest) (*models.User, error) {
+		if adminID == uid {
+			return nil, apierror.New(http.StatusUnprocessableEntity, apierror.Validation, "", "Admins Cannot Ban Themselves")
+		}
+		return models.BanUser(ctx, db, adminID, uid, request.Reason)
+	})
+	if !ok {
+		return
+	}
+	server.invalidateSearches(r.Context(), user)
+	responses.JSON(w, http.StatusOK, user.Admin())
+}
+
+//Endpoint for admins to lift a user's ban
+func (server *Server) UnbanUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := server.adminUserAction(w, r, false, func(ctx context.Context, db *gorm.DB, adminID, uid uint32, request adminActionRequest) (*models.User, error) {
+		return models.UnbanUser(ctx, db, adminID, uid, request.Reason)
+	})
+	if !ok {
+		return
+	}
+	server.invalidateSearches(r.Context(), user)
+	responses.JSON(w, http.StatusOK, user.Admin())
+}
+
+//Endpoint for admins to unlock a user's account, such as one suspended or rejected in the risk review
+func (server *Server) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := server.adminUserAction(w, r, false, func(ctx context.Context, db *gorm.DB, adminID, uid uint32, request adminActionRequest) (*models.User, error) {
+		return models.UnlockUser(ctx, db, adminID, uid, request.Reason)
+	})
+	if !ok {
+		return
+	}
+	server.invalidateSearches(r.Context(), user)
+	responses.JSON(w, http.StatusOK, user.Admin())
+}
+
+//Endpoint for admins to log a user out and make them choose a new password, emailing them a reset link
+func (server *Server) ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	user, ok := server.adminUserAction(w, r, false, func(ctx context.Context, db *gorm.DB, adminID, uid uint32, request adminActionRequest) (*models.User, error) {
+		return models.RequirePasswordReset(ctx, db, adminID, uid, request.Reason)
+	})
+	if !ok {
+		return
+	}
+	err := server.sendPasswordReset(r.Context(), user)
+	if err != nil {
+		log.Printf("Sending the password reset of user %d failed: %v", user.ID, err)
+	}
+	responses.JSON(w, http.StatusOK, user.Admin())
+}
+
+//Endpoint for admins to mark a user's email or phone number verified with {"field": "email"}
+func (server *Server) VerifyUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := server.adminUserAction(w, r, false, func(ctx context.Context, db *gorm.DB, adminID, uid uint32, request adminActionRequest) (*models.User, error) {
+		switch request.Field {
+		case "email":
+			return models.VerifyUserManually(ctx, db, adminID, uid, models.AdminVerifyEmail, request.Reason)
+		case "phone_number":
+			return models.VerifyUserManually(ctx, db, adminID, uid, models.AdminVerifyPhone, request.Reason)
+		}
+		return nil, apierror.Invalid("field", "Field Must Be email Or phone_number")
+	})
+	if !ok {
+		return
+	}
+	responses.JSON(w, http.StatusOK, user.Admin())
+}
+
+//Endpoint for admins to see the changes admins made to accounts, newest first, for one user with ?user_id=
+//or by one admin with ?admin_id=, a page at a time like the users list
+func (server *Server) GetAdminActions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var ids [2]uint32
+	for i, name := range []string{"user_id", "admin_id"} {
+		if value := query.Get(name); value != "" {
+			id, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				responses.ERROR(w, http.StatusBadRequest, apierror.New(http.StatusBadRequest, apierror.InvalidRequest, name, "Invalid ID"))
+				return
+			}
+			ids[i] = uint32(id)
+		}
+	}
+
+	page := models.PageRequest{Cursor: query.Get("cursor")}
+	var err error
+	if value := query.Get("page"); value != "" {
+		page.Page, err = strconv.Atoi(value)
+		if err != nil || page.Page < 1 {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid Page"))
+			return
+		}
+	}
+	if value := query.Get("per_page"); value != "" {
+		page.PerPage, err = strconv.Atoi(value)
+		if err != nil || page.PerPage < 1 {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid Per Page"))
+			return
+		}
+	}
+
+	actions, info, err := models.FindAdminActions(r.Context(), server.DB, ids[0], ids[1], page)
+	if err == models.ErrInvalidCursor {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, map[string]interface{}{"data": actions, "pagination": info})
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/notifications"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Users one run of the send-announcements job delivers an announcement to
+const announcementBatchSize = 500
+
+//Endpoint for admins to announce something to every user, or to those in a region or with a specialisation.
+//Marketing announcements only go to the users who opted in.
+func (server *Server) CreateAnnouncement(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	announcement := models.Announcement{}
+	err = json.Unmarshal(body, &announcement)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	announcement.Prepare()
+	err = announcement.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	announcementSaved, err := announcement.SaveAnnouncement(r.Context(), server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusAccepted, announcementSaved)
+}
+
+//Endpoint for admins to list announcements and how far their delivery got
+func (server *Server) GetAnnouncements(w http.ResponseWriter, r *http.Request) {
+	announcements, err := models.FindAnnouncements(r.Context(), server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, announcements)
+}
+
+//Delivers the next batch of every pending announcement to the inbox of its users
+func (server *Server) sendAnnouncements(ctx context.Context) error {
+	announcements, err := models.FindPendingAnnouncements(ctx, server.DB)
+	if err != nil {
+		return err
+	}
+
+	for i := range *announcements {
+		announcement := &(*announcements)[i]
+		uids, err := announcement.NextRecipients(ctx, server.DB, announcementBatchSize)
+		if err != nil {
+			return err
+		}
+
+		cursor := announcement.Cursor
+		for _, uid := range uids {
+			err = notifications.Send(ctx, server.DB, uid, notifications.Notice{
+				Kind:      "announcement",
+				Data:      map[string]interface{}{"Title": announcement.Title, "Body": announcement.Body},
+				Digest:    announcement.Digest,
+				Marketing: announcement.Marketing,
+			})
+			//Withdrew their consent since the batch was picked
+			if err == notifications.ErrNoMarketingConsent {
+				err = nil
+			}
+			if err != nil {
+				log.Printf("Delivering announcement %d to user %d failed: %v", announcement.ID, uid, err)
+			}
+			cursor = uid
+		}
+
+		err = announcement.RecordDelivery(ctx, server.DB, cursor, len(uids), len(uids) < announcementBatchSize)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,19 +1,60 @@
 package controllers
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/mysql"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/cache"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/fault"
+	"github.com/victorkabata/FixIt-API/api/geocode"
+	"github.com/victorkabata/FixIt-API/api/jobs"
+	"github.com/victorkabata/FixIt-API/api/logger"
+	"github.com/victorkabata/FixIt-API/api/mailer"
+	"github.com/victorkabata/FixIt-API/api/media"
+	"github.com/victorkabata/FixIt-API/api/middlewares"
 	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/oauth"
+	"github.com/victorkabata/FixIt-API/api/reputation"
+	"github.com/victorkabata/FixIt-API/api/risk"
+	"github.com/victorkabata/FixIt-API/api/selfcheck"
+	"github.com/victorkabata/FixIt-API/api/storage"
+	"github.com/victorkabata/FixIt-API/api/tracking"
 )
 
 type Server struct {
-	DB     *gorm.DB
-	Router *mux.Router
+	DB       *gorm.DB
+	Router   *mux.Router
+	Jobs     *jobs.Scheduler
+	Tracking *tracking.Hub
+	Risk     *risk.Scorer
+	//Limits login, registration and recovery per client address
+	AuthLimiter *middlewares.RateLimiter
+	//Address autocomplete, cached and limited per client address
+	Places        geocode.Suggester
+	PlacesLimiter *middlewares.RateLimiter
+	//Limits availability checks per client address, they tell which accounts exist
+	AvailabilityLimiter *middlewares.RateLimiter
+	//Geocoding of users without coordinates, see BackfillCoordinates
+	GeoBackfill *geocode.Backfill
+	//Removal of stored files no record points at, see ReconcileMedia
+	MediaReconciler *media.Reconciler
+	//Startup checklist, see selfChecks
+	SelfCheck *selfcheck.Runner
+	//Sign in with Google, see GoogleSignIn
+	Google *oauth.Google
+	//Profile pictures and gallery images, see storage.FromEnv
+	Storage storage.Storage
+	//Results of nearby searches, see SearchProviders
+	SearchCache cache.Shared
 }
 
 //Initializes the database connection and mux routers
@@ -43,15 +84,114 @@ func (server *Server) Initialize(Dbdriver, DbUser, DbPassword, DbHost, DbName st
 	// 	}
 	// }
 
-	server.DB.Debug().AutoMigrate(&models.User{}, &models.Post{}, &models.Booking{}, &models.Work{}, &models.Review{}, &models.Transaction{}) //database migration
+	err = logger.Configure(os.Getenv("LOG_LEVEL"), logger.SQLFromEnv())
+	if err != nil {
+		log.Printf("Ignoring LOG_LEVEL: %v", err)
+	}
+	database.RegisterSQLLogger(server.DB)
+	database.RegisterCallbacks(server.DB)
+	database.RegisterSlowQueryLog(server.DB, database.SlowQueryThresholdFromEnv())
+
+	if fault.Enabled() {
+		fmt.Println("Fault injection is enabled")
+		fault.RegisterDBCallbacks(server.DB)
+	}
+
+	models.MigrateEmailVerification(server.DB)
+	models.MigratePlusCodes(server.DB)
+	models.MigrateRoles(server.DB)
+	models.MigratePasswordColumn(server.DB)
+	models.MigrateLoginIndexes(server.DB)
+	models.MigrateUserProfiles(server.DB)
+	server.DB.Debug().AutoMigrate(models.Tables()...) //database migration
+	models.MigrateReviews(server.DB)
+	models.MigrateSearchIndexes(server.DB)
+	server.checkSchema()
+
+	keys, err := auth.KeysFromEnv()
+	if err != nil {
+		log.Fatal("Error loading signing keys: ", err)
+	}
+	auth.ConfigureKeys(keys)
+	if _, err := models.MetadataSchema(); err != nil {
+		log.Printf("%v, no custom profile fields are allowed", err)
+	}
+
+	server.Tracking = tracking.HubFromEnv()
+	server.Risk = risk.Default()
+	server.GeoBackfill = geocode.NewBackfill()
+	server.MediaReconciler = media.NewReconciler()
+	_, err = storage.LoadS3Config()
+	if err != nil {
+		log.Fatal("Error configuring storage: ", err)
+	}
+	server.Storage, err = storage.FromEnv()
+	if err != nil {
+		log.Fatal("Error configuring storage: ", err)
+	}
+	mailer.SetSuppression(func(ctx context.Context, address string) (bool, error) {
+		return models.EmailSuppressed(ctx, server.DB, address)
+	})
+	mailer.SetQueue(func(ctx context.Context, message mailer.Message) error {
+		_, err := models.QueueEmail(ctx, server.DB, message.To, message.Subject, message.Body)
+		return err
+	})
+	server.SelfCheck = selfcheck.NewRunner(server.selfChecks()...)
+	server.Google = oauth.GoogleFromEnv()
+
+	server.AuthLimiter = middlewares.NewAuthRateLimiter()
+	server.Places = geocode.NewSuggesterFromEnv()
+	server.SearchCache = cache.SharedFromEnv()
+	middlewares.UseMaintenanceStore(server.SearchCache)
+	middlewares.LoadMaintenanceFromEnv()
+	server.PlacesLimiter = middlewares.NewRateLimiter(middlewares.PlacesRateLimit(), time.Minute, reputation.Default())
+	server.AvailabilityLimiter = middlewares.NewRateLimiter(middlewares.AvailabilityRateLimit(), time.Minute, reputation.Default())
+
+	auth.SetRevocationCheck(server.tokenRevoked)
+	auth.SetSessionTracker(server.sessionSeen)
 
 	server.Router = mux.NewRouter()
 
 	server.initializeRoutes()
+
+	server.Jobs = jobs.NewScheduler()
+	server.registerJobs()
+}
+
+//Compares the tables with the models after migrating and stops the server on drift that would break queries, unless SCHEMA_DRIFT is warn or off
+func (server *Server) checkSchema() {
+	mode := database.SchemaDriftMode()
+	if mode == "off" {
+		return
+	}
+
+	drifts, err := database.CheckSchema(server.DB, models.Tables())
+	if err != nil {
+		log.Fatal("Error checking the schema: ", err)
+	}
+	if len(drifts) == 0 {
+		return
+	}
+
+	breaking := false
+	report := "Schema drift between the models and the database:\n"
+	for _, drift := range drifts {
+		report += "  " + drift.String() + "\n"
+		breaking = breaking || drift.Breaks
+	}
+	if breaking && mode == "fail" {
+		log.Fatal(report + "Fix the schema or set SCHEMA_DRIFT=warn to start anyway")
+	}
+	log.Print(report)
 }
 
 //Set listening port
 func (server *Server) Run(addr string) {
+	server.Jobs.Start()
+	go server.reloadOnHangup()
+	go server.runDiagnostics()
+	go server.runSelfCheck(context.Background())
+
 	fmt.Println("Listening to port" + addr)
 	log.Fatal(http.ListenAndServe(addr, server.Router))
 }
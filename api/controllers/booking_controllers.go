@@ -5,11 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/metrics"
 	"github.com/victorkabata/FixIt-API/api/models"
 	"github.com/victorkabata/FixIt-API/api/responses"
 	"github.com/victorkabata/FixIt-API/api/utils/formaterror"
@@ -47,12 +50,13 @@ func (server *Server) MakeBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bookingMade, err := booking.SaveBooking(server.DB)
+	bookingMade, err := booking.SaveBooking(r.Context(), server.DB)
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
 		responses.ERROR(w, http.StatusInternalServerError, formattedError)
 		return
 	}
+	metrics.BookingsCreated.Inc()
 
 	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, bookingMade.ID))
 	responses.JSON(w, http.StatusCreated, bookingMade)
@@ -62,7 +66,7 @@ func (server *Server) GetBookings(w http.ResponseWriter, r *http.Request) {
 
 	booking := models.Booking{}
 
-	bookings, err := booking.FindAllBookings(server.DB)
+	bookings, err := booking.FindAllBookings(r.Context(), server.DB)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -83,7 +87,7 @@ func (server *Server) UpdateBooking(w http.ResponseWriter, r *http.Request) {
 
 	// Check if the post exist
 	booking := models.Booking{}
-	err = server.DB.Debug().Model(models.Booking{}).Where("id = ?", pid).Take(&booking).Error
+	err = database.WithContext(r.Context(), server.DB).Debug().Model(models.Booking{}).Where("id = ?", pid).Take(&booking).Error
 	if err != nil {
 		responses.ERROR(w, http.StatusNotFound, errors.New("Booking not found"))
 		return
@@ -107,11 +111,61 @@ func (server *Server) UpdateBooking(w http.ResponseWriter, r *http.Request) {
 
 	bookingUpdate.ID = booking.ID //this is important to tell the model the post id to update, the other update field are set above
 
-	bookingUpdated, err := bookingUpdate.UpdateABooking(server.DB, pid)
+	bookingUpdated, err := bookingUpdate.UpdateABooking(r.Context(), server.DB, pid)
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
 		responses.ERROR(w, http.StatusInternalServerError, formattedError)
 		return
 	}
+
+	if bookingUpdate.Status == models.BookingCompleted && booking.Status != models.BookingCompleted {
+		metrics.BookingsCompleted.Inc()
+		err = models.ScheduleReviewRequest(r.Context(), server.DB, booking.ID)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	if bookingUpdate.Status != booking.Status {
+		server.refreshProviderStats(r.Context(), booking.UserID)
+		if booking.Status == models.BookingConfirmed && bookingUpdate.Status != "" {
+			server.endTracking(r.Context(), booking.ID)
+		}
+	}
 	responses.JSON(w, http.StatusOK, bookingUpdated)
 }
+
+//Endpoint for the customer or provider to mark a confirmed booking completed
+func (server *Server) CompleteBooking(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	booking, customerID, err := models.BookingParties(r.Context(), server.DB, uint32(bid))
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if uid != booking.UserID && uid != customerID {
+		responses.ERROR(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
+		return
+	}
+
+	bookingCompleted, err := models.CompleteBooking(r.Context(), server.DB, booking.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	metrics.BookingsCompleted.Inc()
+	server.refreshProviderStats(r.Context(), booking.UserID)
+	server.endTracking(r.Context(), booking.ID)
+	responses.JSON(w, http.StatusOK, bookingCompleted)
+}
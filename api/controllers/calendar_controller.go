@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Endpoint to get a new calendar feed URL for the current user, any previous URL stops working
+func (server *Server) RotateCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	feed := models.CalendarFeed{}
+	feedRotated, err := feed.RotateCalendarFeed(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]string{
+		"url": feedRotated.URL(),
+	}
+	responses.JSON(w, http.StatusOK, response)
+}
+
+//Endpoint to revoke the current user's calendar feed URL
+func (server *Server) DeleteCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	feed := models.CalendarFeed{}
+	_, err = feed.DeleteCalendarFeed(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]string{
+		"message": "Calendar feed revoked",
+	}
+	responses.JSON(w, http.StatusOK, response)
+}
+
+//Endpoint fetched by calendar apps, authorised by the signature in the URL instead of a JWT
+func (server *Server) GetCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	feed := models.CalendarFeed{}
+	err = feed.VerifyCalendarFeed(r.Context(), server.DB, uint32(uid), r.URL.Query().Get("sig"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	bookings, err := models.FindCalendarBookings(r.Context(), server.DB, uint32(uid))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, models.BookingsICS(*bookings))
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/victorkabata/FixIt-API/api/alerts"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/config"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/logger"
+	"github.com/victorkabata/FixIt-API/api/middlewares"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/passwords"
+	"github.com/victorkabata/FixIt-API/api/reputation"
+	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/risk"
+)
+
+//Reads the .env file again and hands the changed settings to the parts of the server that cache them.
+//Settings read on every use, like the review limits, take effect by being in the environment.
+func (server *Server) ReloadConfig() ([]string, error) {
+	changed, err := config.Reload()
+	if err != nil {
+		return nil, err
+	}
+	if len(changed) == 0 {
+		return changed, nil
+	}
+
+	err = logger.Configure(os.Getenv("LOG_LEVEL"), logger.SQLFromEnv())
+	if err != nil {
+		log.Printf("Ignoring LOG_LEVEL: %v", err)
+	}
+	database.SetSlowQueryThreshold(database.SlowQueryThresholdFromEnv())
+	server.AuthLimiter.SetLimit(middlewares.AuthRateLimit())
+	server.PlacesLimiter.SetLimit(middlewares.PlacesRateLimit())
+	server.AvailabilityLimiter.SetLimit(middlewares.AvailabilityRateLimit())
+	reputation.Default().Configure(reputation.SettingsFromEnv())
+	server.Risk.SetThresholds(risk.ThresholdsFromEnv())
+	alerts.Default().Configure(alerts.SettingsFromEnv())
+	auth.Configure(auth.SettingsFromEnv())
+	passwords.Configure(passwords.SettingsFromEnv())
+	keys, err := auth.KeysFromEnv()
+	if err != nil {
+		log.Printf("Keeping the signing keys: %v", err)
+	} else {
+		auth.ConfigureKeys(keys)
+	}
+	if _, err := models.MetadataSchema(); err != nil {
+		log.Printf("%v, no custom profile fields are allowed", err)
+	}
+
+	//A maintenance window switched on at runtime isn't ended by an unrelated reload
+	if config.Changed(changed, "MAINTENANCE_") {
+		middlewares.LoadMaintenanceFromEnv()
+	}
+
+	log.Printf("Reloaded settings: %v", changed)
+	return changed, nil
+}
+
+//Reloads the settings whenever the process receives SIGHUP
+func (server *Server) reloadOnHangup() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	for range hangup {
+		_, err := server.ReloadConfig()
+		if err != nil {
+			log.Printf("Reloading settings failed: %v", err)
+		}
+	}
+}
+
+//Endpoint to reload the settings that don't need a restart
+func (server *Server) ReloadConfigEndpoint(w http.ResponseWriter, r *http.Request) {
+	changed, err := server.ReloadConfig()
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, map[string]interface{}{"message": "Settings Reloaded", "changed": changed})
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Endpoint to get whether the current user opted in to marketing, when and from where
+func (server *Server) GetMarketingConsent(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	consent, err := models.FindMarketingConsent(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, consent)
+}
+
+//Endpoint to opt the current user in to marketing with {"consented": true, "source": "settings"},
+//or to withdraw with {"consented": false}. Notifications about their account are sent either way.
+func (server *Server) UpdateMarketingConsent(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		Consented *bool  `json:"consented"`
+		Source    string `json:"source"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	//Consent is only ever given explicitly
+	if request.Consented == nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Consented"))
+		return
+	}
+	if request.Source == "" {
+		request.Source = models.ConsentSourceSettings
+	}
+
+	consent, err := models.SetMarketingConsent(r.Context(), server.DB, uid, *request.Consented, request.Source)
+	if err != nil && err.Error() == "Invalid Consent Source" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, consent)
+}
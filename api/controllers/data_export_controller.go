@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/notifications"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Exports built by one run of the build-data-exports job
+const dataExportBatchSize = 5
+
+//Endpoint to ask for an archive of the user's data, emailed as a download link once it is built.
+//With {"protected": true} the link also needs a code emailed when it is opened.
+func (server *Server) RequestDataExport(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		Protected bool `json:"protected"`
+	}{}
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &request)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+
+	user := models.User{}
+	userFound, err := user.FindUserByID(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	//The link and the codes go to the email, which has to be the user's
+	if !userFound.Verified {
+		responses.ERROR(w, http.StatusForbidden, errors.New("Verify Your Email First"))
+		return
+	}
+
+	export, err := models.RequestDataExport(r.Context(), server.DB, uid, request.Protected)
+	if err == models.ErrExportInProgress {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusAccepted, export)
+}
+
+//Endpoint to list the user's exports and how far they got
+func (server *Server) GetDataExports(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	exports, err := models.FindUserDataExports(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, exports)
+}
+
+//Endpoint to trade the token of the emailed link for a short lived link to the archive, once. Protected
+//exports answer the token alone by emailing a code, to be sent along with the token.
+func (server *Server) DownloadDataExport(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		Token string `json:"token"`
+		Code  string `json:"code"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if request.Token == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Token"))
+		return
+	}
+
+	export, err := models.OpenDataExport(r.Context(), server.DB, request.Token)
+	if tooManyAttempts(w, err) {
+		return
+	}
+	if err == models.ErrInvalidExportLink {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if export.Protected {
+		if request.Code == "" {
+			err = server.sendDataExportCode(r.Context(), export)
+			if err != nil {
+				log.Printf("Sending the export code of user %d failed: %v", export.UserID, err)
+				responses.ERROR(w, http.StatusInternalServerError, err)
+				return
+			}
+			responses.JSON(w, http.StatusAccepted, map[string]interface{}{"message": "Verification Code Sent", "code_required": true})
+			return
+		}
+		err = export.CheckCode(r.Context(), server.DB, request.Code)
+		if tooManyAttempts(w, err) {
+			return
+		}
+		if err == models.ErrInvalidExportCode {
+			responses.ERROR(w, http.StatusUnauthorized, err)
+			return
+		}
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	err = export.ClaimDownload(r.Context(), server.DB)
+	if err == models.ErrInvalidExportLink {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	downloadURL, err := models.SignedFileURL(r.Context(), server.Storage, export.FileKey)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, map[string]interface{}{
+		"url":        downloadURL,
+		"expires_in": int(models.PrivateFileURLLifetime.Seconds()),
+		"size":       export.Size,
+	})
+}
+
+func (server *Server) sendDataExportCode(ctx context.Context, export *models.DataExport) error {
+	user := models.User{}
+	owner, err := user.FindUserByID(ctx, server.DB, export.UserID)
+	if err != nil {
+		return err
+	}
+	code, err := export.IssueCode(ctx, server.DB)
+	if err != nil {
+		return err
+	}
+	return notifications.Email(ctx, owner, "data_export_code", map[string]interface{}{
+		"Code":    code,
+		"Minutes": int(models.DataExportCodeLifetime.Minutes()),
+	})
+}
+
+//Builds the requested archives, stores them privately and emails their download links
+func (server *Server) buildDataExports(ctx context.Context) error {
+	exports, err := models.ClaimPendingDataExports(ctx, server.DB, time.Now(), dataExportBatchSize)
+	if err != nil {
+		return err
+	}
+	for i := range *exports {
+		export := &(*exports)[i]
+		err := server.buildDataExport(ctx, export)
+		if err != nil {
+			log.Printf("Exporting the data of user %d failed: %v", export.UserID, err)
+			err = export.Fail(ctx, server.DB, err)
+			if err != nil {
+				log.Printf("Recording export %d failed: %v", export.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (server *Server) buildDataExport(ctx context.Context, export *models.DataExport) error {
+	archive, err := models.BuildUserArchive(ctx, server.DB, export.UserID)
+	if err != nil {
+		return err
+	}
+	token, err := export.Store(ctx, server.DB, server.Storage, archive)
+	if err != nil {
+		return err
+	}
+
+	user := models.User{}
+	owner, err := user.FindUserByID(ctx, server.DB, export.UserID)
+	if err != nil {
+		return err
+	}
+	return notifications.Email(ctx, owner, "data_export_ready", map[string]interface{}{
+		"Hours":     int(models.DataExportLinkLifetime.Hours()),
+		"Protected": export.Protected,
+		"URL":       models.AppBaseURL() + "/data-export?token=" + url.QueryEscape(token),
+	})
+}
+
+//Deletes the archives whose link expired, and downloaded ones once their signed link stopped working
+func (server *Server) deleteStaleDataExports(ctx context.Context) error {
+	exports, err := models.FindStaleDataExports(ctx, server.DB, time.Now())
+	if err != nil {
+		return err
+	}
+	for i := range *exports {
+		err = (*exports)[i].DeleteArchive(ctx, server.DB, server.Storage)
+		if err != nil {
+			log.Printf("Deleting the archive of export %d failed: %v", (*exports)[i].ID, err)
+		}
+	}
+	return nil
+}
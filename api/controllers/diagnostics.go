@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+
+	"github.com/victorkabata/FixIt-API/api/middlewares"
+)
+
+//Serves pprof and expvar on DIAGNOSTICS_ADDR, e.g. 127.0.0.1:6060, behind the admin key.
+//Kept off the public router so profiles can be taken in production without exposing them.
+func (server *Server) runDiagnostics() {
+	addr := os.Getenv("DIAGNOSTICS_ADDR")
+	if addr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", middlewares.SetMiddlewareAdmin(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", middlewares.SetMiddlewareAdmin(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", middlewares.SetMiddlewareAdmin(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", middlewares.SetMiddlewareAdmin(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", middlewares.SetMiddlewareAdmin(pprof.Trace))
+	mux.HandleFunc("/debug/vars", middlewares.SetMiddlewareAdmin(expvar.Handler().ServeHTTP))
+
+	log.Printf("Diagnostics listening on %s", addr)
+	log.Printf("Diagnostics listener stopped: %v", http.ListenAndServe(addr, mux))
+}
@@ -0,0 +1,342 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/notifications"
+	"github.com/victorkabata/FixIt-API/api/payments"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Endpoint for the customer or provider of a completed booking to open a dispute
+func (server *Server) OpenDispute(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	booking, customerID, err := models.BookingParties(r.Context(), server.DB, uint32(bid))
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if uid != booking.UserID && uid != customerID {
+		responses.ERROR(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	dispute := models.Dispute{}
+	err = json.Unmarshal(body, &dispute)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	dispute.Prepare()
+	dispute.BookingID = booking.ID
+	dispute.OpenedBy = uid
+	err = dispute.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	disputeOpened, err := dispute.OpenDispute(r.Context(), server.DB, booking)
+	if err != nil {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+
+	server.notifyBookingParties(r.Context(), booking.UserID, customerID, notifications.Notice{
+		Kind: "dispute_opened",
+		Data: map[string]interface{}{"BookingID": booking.ID},
+	})
+
+	responses.JSON(w, http.StatusCreated, disputeOpened)
+}
+
+//Loads a dispute and checks the current user is a party to its booking
+func (server *Server) findPartyDispute(r *http.Request) (*models.Dispute, *models.Booking, uint32, uint32, int, error) {
+	vars := mux.Vars(r)
+	did, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		return nil, nil, 0, 0, http.StatusBadRequest, err
+	}
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		return nil, nil, 0, 0, http.StatusUnauthorized, errors.New("Unauthorized")
+	}
+
+	disputeFound, booking, customerID, status, err := server.partyDispute(r.Context(), did, uid)
+	return disputeFound, booking, customerID, uid, status, err
+}
+
+//Loads a dispute and checks the user is a party to its booking
+func (server *Server) partyDispute(ctx context.Context, did uint64, uid uint32) (*models.Dispute, *models.Booking, uint32, int, error) {
+	dispute := models.Dispute{}
+	disputeFound, err := dispute.FindDisputeByID(ctx, server.DB, did)
+	if err != nil {
+		return nil, nil, 0, http.StatusNotFound, err
+	}
+
+	booking, customerID, err := models.BookingParties(ctx, server.DB, disputeFound.BookingID)
+	if err != nil {
+		return nil, nil, 0, http.StatusNotFound, err
+	}
+	if uid != booking.UserID && uid != customerID {
+		return nil, nil, 0, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden))
+	}
+	return disputeFound, booking, customerID, http.StatusOK, nil
+}
+
+//Endpoint for the parties of a dispute to follow it
+func (server *Server) GetDispute(w http.ResponseWriter, r *http.Request) {
+	dispute, _, _, _, status, err := server.findPartyDispute(r)
+	if err != nil {
+		responses.ERROR(w, status, err)
+		return
+	}
+	err = server.signEvidenceURLs(r.Context(), dispute.Evidence)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, dispute)
+}
+
+//Fills in short lived links to private evidence, only call it once the user may see the dispute
+func (server *Server) signEvidenceURLs(ctx context.Context, evidence []models.DisputeEvidence) error {
+	for i := range evidence {
+		if evidence[i].FileKey == "" {
+			continue
+		}
+		var err error
+		evidence[i].FileURL, err = models.SignedFileURL(ctx, server.Storage, evidence[i].FileKey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Endpoint for the parties of an open dispute to upload evidence
+func (server *Server) UploadDisputeEvidence(w http.ResponseWriter, r *http.Request) {
+	dispute, booking, customerID, uid, status, err := server.findPartyDispute(r)
+	if err != nil {
+		responses.ERROR(w, status, err)
+		return
+	}
+	if dispute.Status != models.DisputeOpen {
+		responses.ERROR(w, http.StatusConflict, errors.New("Dispute Is Closed"))
+		return
+	}
+
+	file, fileHeader, ok := readImageUpload(w, r)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	//Evidence often shows addresses and documents, so it is never public
+	fileKey, err := models.UploadPrivateFile(r.Context(), server.DB, server.Storage, uid, "disputes", file, fileHeader, maxUploadSize())
+	if err != nil {
+		responses.ERROR(w, uploadErrorStatus(err), err)
+		return
+	}
+
+	evidence := models.DisputeEvidence{
+		UserID:  uid,
+		FileKey: fileKey,
+		Note:    r.FormValue("note"),
+	}
+	evidenceSaved, err := evidence.SaveDisputeEvidence(r.Context(), server.DB, dispute)
+	if err != nil {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	evidenceSaved.FileURL, err = models.SignedFileURL(r.Context(), server.Storage, fileKey)
+	if err != nil {
+		log.Println(err)
+	}
+
+	server.notifyEvidence(r.Context(), booking, customerID, uid)
+
+	responses.JSON(w, http.StatusCreated, evidenceSaved)
+}
+
+//Tells the other party of a dispute that evidence was added
+func (server *Server) notifyEvidence(ctx context.Context, booking *models.Booking, customerID, uid uint32) {
+	otherParty := customerID
+	if uid == customerID {
+		otherParty = booking.UserID
+	}
+	err := notifications.Send(ctx, server.DB, otherParty, notifications.Notice{
+		Kind: "dispute_evidence",
+		Data: map[string]interface{}{"BookingID": booking.ID},
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+//Endpoint for admins to list open disputes
+func (server *Server) GetOpenDisputes(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.DisputeOpen
+	}
+
+	dispute := models.Dispute{}
+	disputes, err := dispute.FindDisputesByStatus(r.Context(), server.DB, status)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, disputes)
+}
+
+//Endpoint for admins to see a dispute with its evidence
+func (server *Server) GetDisputeAdmin(w http.ResponseWriter, r *http.Request) {
+	did, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	dispute := models.Dispute{}
+	disputeFound, err := dispute.FindDisputeByID(r.Context(), server.DB, did)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	err = server.signEvidenceURLs(r.Context(), disputeFound.Evidence)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, disputeFound)
+}
+
+//Endpoint for admins to resolve or reject a dispute, a refund amount is returned to the customer through the payment gateway
+func (server *Server) ResolveDispute(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	did, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		Status       string  `json:"status"`
+		Resolution   string  `json:"resolution"`
+		RefundAmount float64 `json:"refund_amount"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if request.RefundAmount < 0 || request.RefundAmount > 0 && request.Status != models.DisputeResolved {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Invalid Refund Amount"))
+		return
+	}
+
+	dispute := models.Dispute{}
+	disputeFound, err := dispute.FindDisputeByID(r.Context(), server.DB, did)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if disputeFound.Status != models.DisputeOpen {
+		responses.ERROR(w, http.StatusConflict, errors.New("Dispute Is Closed"))
+		return
+	}
+
+	booking, customerID, err := models.BookingParties(r.Context(), server.DB, disputeFound.BookingID)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	var payment *models.Payment
+	if request.RefundAmount > 0 {
+		payment, err = models.FindRefundablePayment(r.Context(), server.DB, booking.ID)
+		if err != nil {
+			responses.ERROR(w, http.StatusConflict, err)
+			return
+		}
+		if request.RefundAmount > payment.Amount {
+			responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Refund Exceeds Payment"))
+			return
+		}
+
+		gateway, err := payments.Get(payment.Gateway)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+		err = gateway.Refund(r.Context(), payment.GatewayReference, request.RefundAmount)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadGateway, err)
+			return
+		}
+	}
+
+	disputeClosed, err := disputeFound.CloseDispute(r.Context(), server.DB, request.Status, request.Resolution, request.RefundAmount)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	if payment != nil {
+		_, err = payment.UpdatePaymentStatus(r.Context(), server.DB, payments.StatusRefunded)
+		if err != nil {
+			log.Printf("Marking payment %d refunded failed: %v", payment.ID, err)
+		}
+	}
+
+	currency := ""
+	if payment != nil {
+		currency = payment.Currency
+	}
+	server.notifyBookingParties(r.Context(), booking.UserID, customerID, notifications.Notice{
+		Kind: "dispute_closed",
+		Data: map[string]interface{}{
+			"BookingID": booking.ID,
+			"Status":    disputeClosed.Status,
+			"Refund":    disputeClosed.RefundAmount,
+			"Currency":  currency,
+		},
+	})
+
+	responses.JSON(w, http.StatusOK, disputeClosed)
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/mailer"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Emails sent by one run of the send-emails job
+const emailBatchSize = 20
+
+//Sends the queued emails that are due, failures are retried by later runs
+func (server *Server) sendQueuedEmails(ctx context.Context) error {
+	emails, err := models.ClaimQueuedEmails(ctx, server.DB, time.Now(), emailBatchSize)
+	if err != nil {
+		return err
+	}
+	for i := range *emails {
+		email := &(*emails)[i]
+		err := mailer.Deliver(ctx, mailer.Message{To: email.Recipient, Subject: email.Subject, Body: email.Body})
+		suppressed := err == mailer.ErrSuppressed
+		if suppressed {
+			err = nil
+		}
+		if err != nil {
+			log.Printf("Attempt %d of email %d failed: %v", email.Attempts, email.ID, err)
+		}
+		err = email.FinishSending(ctx, server.DB, suppressed, err)
+		if err != nil {
+			log.Printf("Recording email %d failed: %v", email.ID, err)
+		}
+	}
+	return nil
+}
+
+//Endpoint to look through the send log, filtered by ?status= and ?recipient=
+func (server *Server) GetOutboundEmails(w http.ResponseWriter, r *http.Request) {
+	emails, err := models.FindOutboundEmails(r.Context(), server.DB, models.OutboundEmailFilter{
+		Status:    r.URL.Query().Get("status"),
+		Recipient: r.URL.Query().Get("recipient"),
+	})
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, emails)
+}
+
+//Endpoint to list the addresses no email is sent to
+func (server *Server) GetEmailSuppressions(w http.ResponseWriter, r *http.Request) {
+	suppressions, err := models.FindEmailSuppressions(r.Context(), server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, suppressions)
+}
+
+//Endpoint to stop sending email to an address
+func (server *Server) AddEmailSuppression(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		Address string `json:"address"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if strings.TrimSpace(request.Address) == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Address"))
+		return
+	}
+
+	err = models.SuppressEmail(r.Context(), server.DB, request.Address, models.EmailSuppressedManually)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusCreated, map[string]string{"message": "Address Suppressed"})
+}
+
+//Endpoint to send email to an address again, given as ?address=
+func (server *Server) RemoveEmailSuppression(w http.ResponseWriter, r *http.Request) {
+	removed, err := models.UnsuppressEmail(r.Context(), server.DB, r.URL.Query().Get("address"))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !removed {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Address Not Suppressed"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/victorkabata/FixIt-API/api/mailer"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Endpoint receiving bounce and complaint webhooks of the email provider. Addresses that bounced for good
+//or reported email as spam are marked on the user and get no more email.
+func (server *Server) EmailWebhook(w http.ResponseWriter, r *http.Request) {
+	source, err := mailer.GetEventSource(mux.Vars(r)["provider"])
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	events, err := source.ParseWebhook(r, body)
+	if err == mailer.ErrInvalidSignature {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	for _, event := range events {
+		//Soft bounces such as full mailboxes may go through later
+		if !event.Permanent {
+			continue
+		}
+		status := models.EmailBounced
+		if event.Type == mailer.EventComplaint {
+			status = models.EmailComplained
+		}
+		marked, err := models.MarkEmailUndeliverable(r.Context(), server.DB, event.Email, status)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+		if marked > 0 {
+			log.Printf("Marked %s as %s after a %s %s: %s", event.Email, status, source.Name(), event.Type, event.Reason)
+		}
+	}
+	responses.JSON(w, http.StatusOK, map[string]string{"message": "Received"})
+}
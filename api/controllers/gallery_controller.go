@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Endpoint to add a photo to the current user's gallery
+func (server *Server) UploadGalleryItem(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	file, _, ok := readImageUpload(w, r)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	//Checked before uploading, so a rejected photo leaves nothing in the storage backend
+	item := models.GalleryItem{Caption: r.FormValue("caption")}
+	item.Prepare()
+	item.UserID = uid
+	err = item.ValidateCaption()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = models.CheckGalleryRoom(r.Context(), server.DB, uid)
+	if err == models.ErrGalleryFull {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	item.ImageURL, err = models.UploadImage(r.Context(), server.DB, server.Storage, uid, "gallery", file)
+	if err != nil {
+		responses.ERROR(w, uploadErrorStatus(err), err)
+		return
+	}
+
+	itemSaved, err := item.SaveGalleryItem(r.Context(), server.DB)
+	if err != nil {
+		server.deleteUpload(r.Context(), uid, item.ImageURL)
+		status := http.StatusInternalServerError
+		if err == models.ErrGalleryFull {
+			status = http.StatusUnprocessableEntity
+		}
+		responses.ERROR(w, status, err)
+		return
+	}
+	responses.JSON(w, http.StatusCreated, itemSaved)
+}
+
+//Endpoint to get a user's gallery
+func (server *Server) GetUserGallery(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	item := models.GalleryItem{}
+	items, err := item.FindUserGallery(r.Context(), server.DB, uint32(uid))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, items)
+}
+
+//Endpoint to change the caption of a gallery photo
+func (server *Server) UpdateGalleryItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	item := models.GalleryItem{}
+	err = json.Unmarshal(body, &item)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	item.Prepare()
+
+	itemUpdated, err := item.UpdateCaption(r.Context(), server.DB, gid, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, itemUpdated)
+}
+
+//Endpoint to reorder the current user's gallery
+func (server *Server) ReorderGallery(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		IDs []uint64 `json:"ids"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = models.ReorderGallery(r.Context(), server.DB, uid, request.IDs)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	item := models.GalleryItem{}
+	items, err := item.FindUserGallery(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, items)
+}
+
+//Endpoint to remove a photo from the current user's gallery
+func (server *Server) DeleteGalleryItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	item := models.GalleryItem{}
+	_, err = item.DeleteGalleryItem(r.Context(), server.DB, gid, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	response := map[string]string{
+		"message": "Photo deleted",
+	}
+	responses.JSON(w, http.StatusOK, response)
+}
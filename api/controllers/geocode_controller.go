@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/victorkabata/FixIt-API/api/geocode"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Geocodes users with an address but zeroed coordinates so the nearby search can find them
+func (server *Server) BackfillCoordinates(ctx context.Context, limit int, report func(geocode.Progress)) error {
+	options := geocode.OptionsFromEnv()
+	options.Limit = limit
+	return server.GeoBackfill.Run(ctx, &models.UserLocations{DB: server.DB}, geocode.NewNominatimFromEnv(), options, report)
+}
+
+//Endpoint to start geocoding users without coordinates in the background
+func (server *Server) StartGeoBackfill(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		Limit int `json:"limit"` //Optional cap on how many users are geocoded
+	}{}
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &request)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+
+	if server.GeoBackfill.Progress().Running {
+		responses.ERROR(w, http.StatusConflict, geocode.ErrBackfillRunning)
+		return
+	}
+
+	//The backfill outlives the request
+	go func() {
+		err := server.BackfillCoordinates(context.Background(), request.Limit, nil)
+		if err != nil {
+			log.Printf("Geocoding backfill failed: %v", err)
+		}
+	}()
+
+	responses.JSON(w, http.StatusAccepted, map[string]interface{}{"message": "Backfill Started"})
+}
+
+//Endpoint to get the progress of the running or last geocoding backfill
+func (server *Server) GetGeoBackfill(w http.ResponseWriter, r *http.Request) {
+	responses.JSON(w, http.StatusOK, server.GeoBackfill.Progress())
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"net/http"
+	"os"
 
 	"github.com/victorkabata/FixIt-API/api/responses"
 )
@@ -10,3 +11,22 @@ func (server *Server) Home(w http.ResponseWriter, r *http.Request) {
 	responses.JSON(w, http.StatusOK, "Welcome To The FixIt-API API")
 
 }
+
+//Endpoint returning the configuration the mobile apps need on startup
+func (server *Server) AppConfig(w http.ResponseWriter, r *http.Request) {
+	config := map[string]string{
+		"min_app_version":    os.Getenv("MIN_APP_VERSION"),
+		"latest_app_version": os.Getenv("LATEST_APP_VERSION"),
+	}
+	responses.JSON(w, http.StatusOK, config)
+}
+
+//Endpoint used by load balancers to check that the API and database are up
+func (server *Server) Health(w http.ResponseWriter, r *http.Request) {
+	err := server.DB.DB().Ping()
+	if err != nil {
+		responses.JSON(w, http.StatusServiceUnavailable, map[string]string{"status": "unavailable", "database": err.Error()})
+		return
+	}
+	responses.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
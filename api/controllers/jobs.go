@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/media"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/notifications"
+)
+
+//Registers the background jobs of the API
+func (server *Server) registerJobs() {
+	server.Jobs.Every("purge-deleted-accounts", time.Hour, func(ctx context.Context) error {
+		purged, err := models.PurgeScheduledDeletions(ctx, server.DB, time.Now())
+		if purged > 0 {
+			log.Printf("Purged %d accounts scheduled for deletion", purged)
+		}
+		return err
+	})
+
+	server.Jobs.Every("purge-revoked-tokens", time.Hour, func(ctx context.Context) error {
+		_, err := models.PurgeRevokedTokens(ctx, server.DB, time.Now())
+		if err != nil {
+			return err
+		}
+		_, err = models.PurgeSessions(ctx, server.DB, time.Now())
+		return err
+	})
+
+	server.Jobs.Every("send-emails", 10*time.Second, server.sendQueuedEmails)
+	server.Jobs.Every("purge-email-log", 24*time.Hour, func(ctx context.Context) error {
+		_, err := models.PurgeOutboundEmails(ctx, server.DB, time.Now())
+		return err
+	})
+	server.Jobs.Every("send-review-requests", 5*time.Minute, server.sendReviewRequests)
+	server.Jobs.Every("send-digests", time.Hour, server.sendDigests)
+	server.Jobs.Every("send-weekly-stats", 24*time.Hour, server.sendWeeklyStats)
+	server.Jobs.Every("refresh-provider-stats", 24*time.Hour, server.refreshAllProviderStats)
+	server.Jobs.Every("send-announcements", time.Minute, server.sendAnnouncements)
+	server.Jobs.Every("expire-uploads", time.Hour, server.expireUploads)
+	server.Jobs.Every("sweep-profile-pictures", 24*time.Hour, server.sweepProfilePictures)
+	server.Jobs.Every("build-data-exports", time.Minute, server.buildDataExports)
+	server.Jobs.Every("delete-stale-data-exports", 15*time.Minute, server.deleteStaleDataExports)
+	if media.ModeFromEnv() != "off" {
+		server.Jobs.Every("reconcile-media", 24*time.Hour, func(ctx context.Context) error {
+			_, err := server.ReconcileMedia(ctx, media.OptionsFromEnv())
+			return err
+		})
+	}
+}
+
+//Asks customers of completed bookings to review their provider once the delay has passed
+func (server *Server) sendReviewRequests(ctx context.Context) error {
+	requests, err := models.FindDueReviewRequests(ctx, server.DB, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, request := range *requests {
+		user := models.User{}
+		provider, err := user.FindUserByID(ctx, server.DB, request.ProviderID)
+		if err != nil {
+			log.Printf("Review request %d: %v", request.ID, err)
+			continue
+		}
+
+		err = notifications.Send(ctx, server.DB, request.CustomerID, notifications.Notice{
+			Kind: "review_request",
+			Data: map[string]interface{}{
+				"Provider":  html.UnescapeString(provider.Username),
+				"BookingID": request.BookingID,
+				"URL":       fmt.Sprintf("%s/bookings/%d/review", models.AppBaseURL(), request.BookingID),
+			},
+		})
+		if err != nil {
+			log.Printf("Review request %d: %v", request.ID, err)
+			continue
+		}
+
+		err = request.MarkSent(ctx, server.DB)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Digests emailed by one run of the send-digests job, the rest wait for the next run
+const digestBatchSize = 200
+
+//Emails every user whose digest is due their waiting low priority notifications in one message
+func (server *Server) sendDigests(ctx context.Context) error {
+	now := time.Now()
+	digests, err := models.FindDueDigests(ctx, server.DB, now, digestBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, digest := range *digests {
+		if digest.User.DigestFrequency != models.DigestOff {
+			err = notifications.SendDigest(ctx, digest)
+			if err != nil {
+				log.Printf("Sending the digest of user %d failed: %v", digest.User.ID, err)
+				continue
+			}
+		}
+		err = models.MarkDigestSent(ctx, server.DB, digest.User.ID, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Tells providers how their week went, once a week and only after a week with bookings or reviews
+func (server *Server) sendWeeklyStats(ctx context.Context) error {
+	stats, err := models.FindWeeklyStats(ctx, server.DB, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, week := range *stats {
+		err = notifications.Send(ctx, server.DB, week.UserID, notifications.Notice{
+			Kind: "weekly_stats",
+			Data: map[string]interface{}{
+				"BookingsCompleted": week.BookingsCompleted,
+				"Reviews":           week.Reviews,
+				"AverageRating":     week.AverageRating,
+			},
+			Digest: true,
+		})
+		if err != nil {
+			log.Printf("Sending the weekly stats of user %d failed: %v", week.UserID, err)
+		}
+	}
+	return nil
+}
+
+//Recomputes the stats of providers with recent bookings, so bookings older than the window stop counting
+func (server *Server) refreshAllProviderStats(ctx context.Context) error {
+	now := time.Now()
+	uids, err := models.FindProvidersForStats(ctx, server.DB, now)
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		_, err = models.RefreshProviderStats(ctx, server.DB, uid, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Recomputes the provider's stats after one of their bookings or quotes changed, a failure waits for the daily run
+func (server *Server) refreshProviderStats(ctx context.Context, uid uint32) {
+	_, err := models.RefreshProviderStats(ctx, server.DB, uid, time.Now())
+	if err != nil {
+		log.Printf("Refreshing the stats of provider %d failed: %v", uid, err)
+	}
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/middlewares"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/utils/formaterror"
+)
+
+//Endpoint to generate a deep link into the app
+func (server *Server) CreateDeepLink(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		models.DeepLink
+		ExpiresIn int64 `json:"expires_in"` //Seconds until the link expires, 0 for never
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	link := request.DeepLink
+	link.Prepare()
+	link.UserID = uid
+	link.ExpiresAt = nil
+	if request.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(request.ExpiresIn) * time.Second)
+		link.ExpiresAt = &expiresAt
+	}
+
+	err = link.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	linkCreated, err := link.SaveDeepLink(r.Context(), server.DB)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+
+	responses.JSON(w, http.StatusCreated, linkCreated)
+}
+
+//Endpoint to open a short link
+func (server *Server) OpenShortLink(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	link := models.DeepLink{}
+	linkFound, err := link.FindDeepLinkByCode(r.Context(), server.DB, vars["code"])
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	//Signed links only open with their signature
+	if !linkFound.Short {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Link Not Found"))
+		return
+	}
+
+	server.openDeepLink(w, r, linkFound)
+}
+
+//Endpoint to open a signed link
+func (server *Server) OpenSignedLink(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	link := models.DeepLink{}
+	linkFound, err := link.FindDeepLinkByCode(r.Context(), server.DB, query.Get("code"))
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	if !linkFound.VerifySignature(query.Get("sig")) {
+		responses.ERROR(w, http.StatusForbidden, errors.New("Invalid Link Signature"))
+		return
+	}
+
+	server.openDeepLink(w, r, linkFound)
+}
+
+//Records the open and returns where the app should navigate to
+func (server *Server) openDeepLink(w http.ResponseWriter, r *http.Request, link *models.DeepLink) {
+	if link.Expired() {
+		responses.ERROR(w, http.StatusGone, errors.New("Link Expired"))
+		return
+	}
+
+	err := link.RecordOpen(r.Context(), server.DB, models.DeepLinkOpen{
+		UserAgent: r.UserAgent(),
+		IPAddress: middlewares.ClientIP(r),
+		Referrer:  r.Referer(),
+	})
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	scheme := os.Getenv("APP_SCHEME")
+	if scheme == "" {
+		scheme = "fixit"
+	}
+
+	response := map[string]interface{}{
+		"kind":      link.Kind,
+		"target_id": link.TargetID,
+		"app_url":   fmt.Sprintf("%s://%s/%d", scheme, link.Kind, link.TargetID),
+	}
+	responses.JSON(w, http.StatusOK, response)
+}
@@ -1,32 +1,137 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/victorkabata/FixIt-API/api/alerts"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/middlewares"
 	"github.com/victorkabata/FixIt-API/api/models"
 	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/risk"
 	"github.com/victorkabata/FixIt-API/api/utils/formaterror"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
+//Credentials and context of a login attempt
+type loginAttempt struct {
+	Login            models.LoginIdentifier
+	Password         string
+	OTP              string //Authenticator or recovery code
+	VerificationCode string //Emailed code asked for on risky logins
+	IP               string
+	//The user unlocked a passkey with their fingerprint, face or PIN, which is a second factor of its own
+	UserVerified bool
+}
+
 //Endpoint to signin users
-func (server *Server) SignIn(email, password string) (int, map[string]interface{}) {
+func (server *Server) SignIn(ctx context.Context, attempt loginAttempt) (int, map[string]interface{}) {
+	userFound, err := models.CheckCredentials(ctx, server.DB, attempt.Login, attempt.Password)
+	recordAuthCheck(alerts.Login, err, models.ErrInvalidCredentials)
+	if err == models.ErrInvalidCredentials {
+		return http.StatusUnauthorized, map[string]interface{}{"message": err.Error()}
+	}
+	if err != nil {
+		return http.StatusInternalServerError, map[string]interface{}{"message": err.Error()}
+	}
+	return server.completeSignIn(ctx, userFound, attempt)
+}
+
+//Checks that apply however the user proved who they are, then returns the user with a token
+func (server *Server) completeSignIn(ctx context.Context, userFound *models.User, attempt loginAttempt) (int, map[string]interface{}) {
 	var err error
 
-	user := models.User{}
+	if userFound.BannedAt != nil {
+		return http.StatusForbidden, map[string]interface{}{"message": "Account Banned"}
+	}
+	if userFound.Locked && userFound.LockReason == models.LockReverted {
+		return http.StatusForbidden, map[string]interface{}{"message": "Account Locked, Reset Your Password To Unlock It", "password_reset_required": true}
+	}
+	if userFound.Locked {
+		return http.StatusForbidden, map[string]interface{}{"message": "Account Locked"}
+	}
+	if userFound.PasswordResetRequired {
+		return http.StatusForbidden, map[string]interface{}{"message": "Password Reset Required", "password_reset_required": true}
+	}
+	if !userFound.CanLogInUnverified(time.Now()) {
+		return http.StatusForbidden, map[string]interface{}{"message": "Email Not Verified", "email_verification_required": true}
+	}
+	if userFound.RiskStatus == models.RiskReview {
+		return http.StatusForbidden, map[string]interface{}{"message": "Account Under Review"}
+	}
+
+	assessment := server.assessRisk(ctx, userFound.ID, risk.Signal{Action: risk.Login, UserID: userFound.ID, Email: userFound.Email, Phone: userFound.PhoneNumber(), IP: attempt.IP})
+	if assessment.Decision == risk.Review {
+		err = models.SetRiskStatus(ctx, server.DB, userFound.ID, models.RiskReview)
+		if err != nil {
+			return http.StatusInternalServerError, map[string]interface{}{"message": err.Error()}
+		}
+		return http.StatusForbidden, map[string]interface{}{"message": "Account Under Review"}
+	}
 
-	err = server.DB.Debug().Model(models.User{}).Where("email = ?", email).Take(&user).Error
-	if err != nil {
-		return http.StatusUnauthorized, map[string]interface{}{"message": "User not found"}
+	//Accounts with two factor enabled need a code from the authenticator app or a recovery code
+	if attempt.UserVerified {
+		//Nothing more to ask for
+	} else if userFound.TwoFactorEnabled {
+		if attempt.OTP == "" {
+			return http.StatusUnauthorized, map[string]interface{}{"message": "Two Factor Code Required", "two_factor_required": true}
+		}
+		err = models.VerifyTwoFactor(ctx, server.DB, userFound.ID, userFound.TwoFactorSecret, attempt.OTP, true)
+		recordAuthCheck(alerts.OTP, err, models.ErrInvalidTwoFactorCode)
+		if wait, ok := err.(*models.TooManyAttemptsError); ok {
+			return http.StatusTooManyRequests, map[string]interface{}{"message": wait.Error(), "retry_after": wait.RetryAfter(), "two_factor_required": true}
+		}
+		if err == models.ErrInvalidTwoFactorCode {
+			return http.StatusUnauthorized, map[string]interface{}{"message": err.Error(), "two_factor_required": true}
+		}
+		if err != nil {
+			return http.StatusInternalServerError, map[string]interface{}{"message": err.Error()}
+		}
+	} else if userFound.RiskStatus == models.RiskVerify || assessment.Decision == risk.Verify {
+		//Risky logins without a second factor are confirmed with a code sent to the account's email
+		if attempt.VerificationCode == "" {
+			err = server.sendLoginCode(ctx, userFound)
+			if err != nil {
+				return http.StatusInternalServerError, map[string]interface{}{"message": err.Error()}
+			}
+			return http.StatusUnauthorized, map[string]interface{}{"message": "Verification Code Sent", "verification_required": true}
+		}
+		err = models.UseLoginCode(ctx, server.DB, userFound.ID, attempt.VerificationCode)
+		recordAuthCheck(alerts.OTP, err, models.ErrInvalidLoginCode)
+		if wait, ok := err.(*models.TooManyAttemptsError); ok {
+			return http.StatusTooManyRequests, map[string]interface{}{"message": wait.Error(), "retry_after": wait.RetryAfter(), "verification_required": true}
+		}
+		if err == models.ErrInvalidLoginCode {
+			return http.StatusUnauthorized, map[string]interface{}{"message": err.Error(), "verification_required": true}
+		}
+		if err != nil {
+			return http.StatusInternalServerError, map[string]interface{}{"message": err.Error()}
+		}
 	}
-	err = models.VerifyPassword(user.Password, password)
-	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword {
-		return http.StatusUnauthorized, map[string]interface{}{"message": "Incorrect password"}
+	if userFound.RiskStatus == models.RiskVerify {
+		err = models.SetRiskStatus(ctx, server.DB, userFound.ID, models.RiskClear)
+		if err != nil {
+			return http.StatusInternalServerError, map[string]interface{}{"message": err.Error()}
+		}
+	}
+	server.loadReputation(ctx, userFound)
+	server.loadProfile(ctx, userFound)
+	response := responses.PrepareResponse(userFound)
+
+	//Logging in during the grace period cancels a scheduled deletion
+	if userFound.DeletionScheduledAt != nil {
+		err = userFound.CancelDeletion(ctx, server.DB, userFound.ID)
+		if err != nil {
+			return http.StatusInternalServerError, map[string]interface{}{"message": err.Error()}
+		}
+		response["message"] = "Account deletion cancelled"
 	}
-	response := responses.PrepareResponse(&user)
 
 	return http.StatusOK, response
 }
@@ -38,13 +143,25 @@ func (server *Server) Login(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
-	user := models.User{}
-	err = json.Unmarshal(body, &user)
+	credentials := struct {
+		models.User
+		Password         string `json:"password"`
+		Identifier       string `json:"identifier"`        //Email, E.164 phone number or username, instead of the field of its own
+		OTP              string `json:"otp"`               //Authenticator or recovery code for accounts with two factor enabled
+		VerificationCode string `json:"verification_code"` //Emailed code when the login is flagged as risky
+	}{}
+	err = json.Unmarshal(body, &credentials)
 	if err != nil {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
+	user := credentials.User
+	user.Password = credentials.Password
+	if credentials.Identifier != "" {
+		login := models.ParseLoginIdentifier(credentials.Identifier)
+		user.Email, user.Phone, user.Username = login.Email, login.Phone, login.Username
+	}
 	user.Prepare()
 	err = user.Validate("login")
 	if err != nil {
@@ -52,11 +169,73 @@ func (server *Server) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	status, login := server.SignIn(user.Email, user.Password)
+	status, login := server.SignIn(r.Context(), loginAttempt{
+		Login:            models.LoginIdentifier{Email: user.Email, Phone: user.Phone, Username: user.Username},
+		Password:         user.Password,
+		OTP:              credentials.OTP,
+		VerificationCode: credentials.VerificationCode,
+		IP:               middlewares.ClientIP(r),
+	})
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
 		responses.ERROR(w, http.StatusUnprocessableEntity, formattedError)
 		return
 	}
+	writeLogin(w, status, login)
+}
+
+//Writes the result of a sign in, telling clients that hit the attempt limits when to try again
+func writeLogin(w http.ResponseWriter, status int, login map[string]interface{}) {
+	if retryAfter, ok := login["retry_after"].(int); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
 	responses.JSON(w, status, login)
 }
+
+//Counts a check towards the failure alerts. Wrong credentials or codes and tries held back by the attempt
+//delays are failures, other errors say nothing about the caller and aren't counted.
+func recordAuthCheck(kind string, err error, invalid error) {
+	if _, ok := err.(*models.TooManyAttemptsError); ok || err == invalid {
+		alerts.Record(kind, true)
+	} else if err == nil {
+		alerts.Record(kind, false)
+	}
+}
+
+//Answers 429 with Retry-After when err is a *models.TooManyAttemptsError
+func tooManyAttempts(w http.ResponseWriter, err error) bool {
+	wait, ok := err.(*models.TooManyAttemptsError)
+	if !ok {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(wait.RetryAfter()))
+	responses.ERROR(w, http.StatusTooManyRequests, wait)
+	return true
+}
+
+//Endpoint to log out, the token is refused from now on until it would have expired
+func (server *Server) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	err := models.RevokeToken(r.Context(), server.DB, claims.UserID, claims.RevocationKey(), claims.Expiry())
+	if err == nil {
+		err = models.EndSession(r.Context(), server.DB, claims.RevocationKey())
+	}
+	if err != nil {
+		log.Printf("Logging out user %d failed: %v", claims.UserID, err)
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, map[string]string{"message": "Logged Out"})
+}
+
+//Endpoint publishing the public keys tokens are signed with, so other services can check them
+//without the secret. Retired keys stay listed until JWT_VERIFY_KEYS drops them.
+func (server *Server) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	responses.JSON(w, http.StatusOK, map[string]interface{}{"keys": auth.JWKS()})
+}
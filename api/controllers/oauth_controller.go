@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/victorkabata/FixIt-API/api/alerts"
+	"github.com/victorkabata/FixIt-API/api/metrics"
+	"github.com/victorkabata/FixIt-API/api/middlewares"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/oauth"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Endpoint to log in with Google, creating the user on the first sign in. Apps send the ID token
+//they got from Google, the web sends the authorization code and the redirect URI it used.
+func (server *Server) GoogleSignIn(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		IDToken          string `json:"id_token"`
+		Code             string `json:"code"`
+		RedirectURI      string `json:"redirect_uri"`
+		OTP              string `json:"otp"`
+		VerificationCode string `json:"verification_code"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	var claims *oauth.Claims
+	switch {
+	case request.IDToken != "":
+		claims, err = server.Google.VerifyIDToken(r.Context(), request.IDToken)
+	case request.Code != "" && request.RedirectURI != "":
+		claims, err = server.Google.Exchange(r.Context(), request.Code, request.RedirectURI)
+	default:
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required ID Token Or Code And Redirect URI"))
+		return
+	}
+	if err == oauth.ErrInvalidToken {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err == oauth.ErrNotConfigured {
+		responses.ERROR(w, http.StatusNotImplemented, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Google sign in failed: %v", err)
+		responses.ERROR(w, http.StatusBadGateway, errors.New("Google Sign In Unavailable"))
+		return
+	}
+
+	user, created, err := models.SignInWithIdentity(r.Context(), server.DB, models.ExternalAccount{
+		Provider:      claims.Provider,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+		Picture:       claims.Picture,
+	})
+	if link, ok := err.(*models.LinkRequiredError); ok {
+		responses.JSON(w, http.StatusConflict, map[string]interface{}{
+			"message":       link.Error(),
+			"link_required": true,
+			"link_token":    link.Token,
+		})
+		return
+	}
+	if err == models.ErrUnverifiedProviderEmail {
+		responses.ERROR(w, http.StatusForbidden, err)
+		return
+	}
+	if duplicate, ok := err.(*models.DuplicateUserError); ok {
+		responses.ERROR(w, http.StatusConflict, duplicate)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if created {
+		metrics.Registrations.WithLabelValues(claims.Provider).Inc()
+		if user.Verified {
+			metrics.UsersVerified.Inc()
+		}
+	}
+
+	status, login := server.completeSignIn(r.Context(), user, loginAttempt{
+		Login:            models.LoginIdentifier{Email: user.Email},
+		OTP:              request.OTP,
+		VerificationCode: request.VerificationCode,
+		IP:               middlewares.ClientIP(r),
+	})
+	if created && status == http.StatusOK {
+		status = http.StatusCreated
+	}
+	writeLogin(w, status, login)
+}
+
+//Endpoint to link a provider account to the existing account with the same email. The owner proves the
+//account is theirs with its password, or with a code emailed to them when they send the link token alone.
+func (server *Server) LinkIdentity(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		LinkToken string `json:"link_token"`
+		Password  string `json:"password"`
+		Code      string `json:"code"`
+		OTP       string `json:"otp"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if request.LinkToken == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Link Token"))
+		return
+	}
+
+	link, err := models.FindIdentityLink(r.Context(), server.DB, request.LinkToken)
+	if err == models.ErrInvalidLinkToken {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	existing := models.User{}
+	owner, err := existing.FindUserByID(r.Context(), server.DB, link.UserID)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, models.ErrInvalidLinkToken)
+		return
+	}
+
+	var proven bool
+	switch {
+	case request.Password != "":
+		proven = models.VerifyPassword(owner.Password, request.Password) == nil
+		alerts.Record(alerts.Login, !proven)
+	case request.Code != "":
+		err = models.UseLoginCode(r.Context(), server.DB, owner.ID, request.Code)
+		recordAuthCheck(alerts.OTP, err, models.ErrInvalidLoginCode)
+		if tooManyAttempts(w, err) {
+			return
+		}
+		if err != nil && err != models.ErrInvalidLoginCode {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+		proven = err == nil
+	default:
+		err = server.sendLoginCode(r.Context(), owner)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+		responses.JSON(w, http.StatusAccepted, map[string]interface{}{"message": "Verification Code Sent", "verification_required": true})
+		return
+	}
+
+	user, err := models.CompleteIdentityLink(r.Context(), server.DB, link, proven)
+	if err == models.ErrLinkProofFailed {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err == models.ErrInvalidLinkToken || err == models.ErrIdentityAlreadyLinked {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	//Linking doesn't get around the second factor or the other login checks
+	status, login := server.completeSignIn(r.Context(), user, loginAttempt{
+		Login: models.LoginIdentifier{Email: user.Email},
+		OTP:   request.OTP,
+		IP:    middlewares.ClientIP(r),
+	})
+	writeLogin(w, status, login)
+}
@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/victorkabata/FixIt-API/api/alerts"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/middlewares"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/webauthn"
+)
+
+//Binary fields of a WebAuthn response, base64url encoded as PublicKeyCredential.toJSON() gives them
+type passkeyResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AttestationObject string `json:"attestationObject"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+}
+
+//Decodes the named fields of the response, an error naming the first one that isn't base64url
+func (p passkeyResponse) decode(fields ...string) (map[string][]byte, error) {
+	values := map[string]string{
+		"clientDataJSON":    p.ClientDataJSON,
+		"attestationObject": p.AttestationObject,
+		"authenticatorData": p.AuthenticatorData,
+		"signature":         p.Signature,
+	}
+	decoded := map[string][]byte{}
+	for _, field := range fields {
+		value, err := webauthn.Decode(values[field])
+		if err != nil || len(value) == 0 {
+			return nil, errors.New("Invalid " + field)
+		}
+		decoded[field] = value
+	}
+	return decoded, nil
+}
+
+//Endpoint to start adding a passkey, returns the options for navigator.credentials.create()
+func (server *Server) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	user := models.User{}
+	userFound, err := user.FindUserByID(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	existing, err := models.FindWebAuthnCredentials(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(*existing) >= models.MaxPasskeys {
+		responses.ERROR(w, http.StatusConflict, models.ErrTooManyPasskeys)
+		return
+	}
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = models.SaveWebAuthnChallenge(r.Context(), server.DB, uid, models.PasskeyRegister, challenge)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	params := []map[string]interface{}{}
+	for _, alg := range webauthn.Algorithms {
+		params = append(params, map[string]interface{}{"type": "public-key", "alg": alg})
+	}
+	//The authenticator already holding one of the user's passkeys shouldn't make another
+	exclude := []map[string]interface{}{}
+	for _, credential := range *existing {
+		exclude = append(exclude, map[string]interface{}{"type": "public-key", "id": credential.CredentialID})
+	}
+	party := webauthn.RelyingPartyFromEnv()
+	responses.JSON(w, http.StatusOK, map[string]interface{}{
+		"publicKey": map[string]interface{}{
+			"challenge": challenge,
+			"rp":        map[string]string{"id": party.ID, "name": party.Name},
+			"user": map[string]string{
+				"id":          webauthn.Encode([]byte(strconv.FormatUint(uint64(uid), 10))),
+				"name":        userFound.Email,
+				"displayName": userFound.Username,
+			},
+			"pubKeyCredParams":   params,
+			"excludeCredentials": exclude,
+			"timeout":            webauthn.TimeoutMillis,
+			"attestation":        "none",
+			//Discoverable so logging in needs no username
+			"authenticatorSelection": map[string]string{"residentKey": "required", "userVerification": "preferred"},
+		},
+	})
+}
+
+//Endpoint to finish adding a passkey with the response of navigator.credentials.create()
+func (server *Server) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		Name     string          `json:"name"`
+		Response passkeyResponse `json:"response"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	decoded, err := request.Response.decode("clientDataJSON", "attestationObject")
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	registration, err := webauthn.RelyingPartyFromEnv().VerifyRegistration(decoded["clientDataJSON"], decoded["attestationObject"])
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = models.UseWebAuthnChallenge(r.Context(), server.DB, uid, models.PasskeyRegister, registration.Challenge)
+	if err == models.ErrInvalidPasskeyChallenge {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	credential := models.WebAuthnCredential{
+		UserID:         uid,
+		CredentialID:   webauthn.Encode(registration.CredentialID),
+		PublicKey:      registration.PublicKey,
+		Algorithm:      registration.Algorithm,
+		SignCount:      registration.SignCount,
+		Name:           request.Name,
+		BackupEligible: registration.BackupEligible,
+	}
+	credential.Prepare()
+	credentialSaved, err := credential.SaveWebAuthnCredential(r.Context(), server.DB)
+	if err == models.ErrPasskeyRegistered || err == models.ErrTooManyPasskeys {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusCreated, credentialSaved)
+}
+
+//Endpoint to list the current user's passkeys
+func (server *Server) GetPasskeys(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	credentials, err := models.FindWebAuthnCredentials(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, credentials)
+}
+
+//Endpoint to remove one of the current user's passkeys
+func (server *Server) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	err = models.DeleteWebAuthnCredential(r.Context(), server.DB, uid, id)
+	if err != nil && err.Error() == "Passkey Not Found" {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response := map[string]string{
+		"message": "Passkey deleted",
+	}
+	responses.JSON(w, http.StatusOK, response)
+}
+
+//Endpoint to start logging in with a passkey, returns the options for navigator.credentials.get(). No
+//username is asked for, so it can't tell which accounts have passkeys.
+func (server *Server) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = models.SaveWebAuthnChallenge(r.Context(), server.DB, 0, models.PasskeyLogin, challenge)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, map[string]interface{}{
+		"publicKey": map[string]interface{}{
+			"challenge":        challenge,
+			"rpId":             webauthn.RelyingPartyFromEnv().ID,
+			"timeout":          webauthn.TimeoutMillis,
+			"userVerification": "preferred",
+		},
+	})
+}
+
+//Endpoint to log in with the response of navigator.credentials.get(). Passkeys the user unlocked stand in
+//for the second factor, others still need the code like a password login.
+func (server *Server) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		ID               string          `json:"id"`
+		Response         passkeyResponse `json:"response"`
+		OTP              string          `json:"otp"`
+		VerificationCode string          `json:"verification_code"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	decoded, err := request.Response.decode("clientDataJSON", "authenticatorData", "signature")
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	rawID, err := webauthn.Decode(request.ID)
+	if err != nil || len(rawID) == 0 {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Invalid id"))
+		return
+	}
+
+	//Unknown and removed passkeys fail the same way as bad signatures
+	credential, err := models.FindWebAuthnCredential(r.Context(), server.DB, webauthn.Encode(rawID))
+	if err != nil && err.Error() != "Passkey Not Found" {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	var assertion *webauthn.Assertion
+	if err == nil {
+		assertion, err = webauthn.RelyingPartyFromEnv().VerifyAssertion(decoded["clientDataJSON"], decoded["authenticatorData"], decoded["signature"], credential.PublicKey)
+	}
+	if err == nil {
+		err = models.UseWebAuthnChallenge(r.Context(), server.DB, 0, models.PasskeyLogin, assertion.Challenge)
+		if err != nil && err != models.ErrInvalidPasskeyChallenge {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if err == nil {
+		err = credential.RecordUse(r.Context(), server.DB, assertion.SignCount)
+		if err != nil && err != models.ErrPasskeyCloned {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if err != nil {
+		alerts.Record(alerts.Login, true)
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Invalid Passkey"))
+		return
+	}
+	alerts.Record(alerts.Login, false)
+
+	user := models.User{}
+	userFound, err := user.FindUserByID(r.Context(), server.DB, credential.UserID)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Invalid Passkey"))
+		return
+	}
+	status, login := server.completeSignIn(r.Context(), userFound, loginAttempt{
+		Login:            models.LoginIdentifier{Email: userFound.Email},
+		OTP:              request.OTP,
+		VerificationCode: request.VerificationCode,
+		IP:               middlewares.ClientIP(r),
+		UserVerified:     assertion.UserVerified,
+	})
+	writeLogin(w, status, login)
+}
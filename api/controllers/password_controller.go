@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/alerts"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/notifications"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Rejects tokens issued before the user's last password reset and the ones logged out. Errors are returned
+//so the token is refused when it can't be checked.
+func (server *Server) tokenRevoked(ctx context.Context, claims *auth.Claims) (bool, error) {
+	revoked, err := models.TokensRevoked(ctx, server.DB, claims.UserID, time.Unix(claims.IssuedAt, 0))
+	if err == nil && !revoked {
+		revoked, err = models.TokenRevoked(ctx, server.DB, claims.RevocationKey())
+	}
+	if err != nil {
+		log.Printf("Checking the tokens of user %d failed: %v", claims.UserID, err)
+	}
+	return revoked, err
+}
+
+//Endpoint to email a password reset link, it answers the same whether or not the address has an account
+func (server *Server) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		Email string `json:"email"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if strings.TrimSpace(request.Email) == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Email"))
+		return
+	}
+
+	user := models.User{}
+	userFound, err := user.FindUserByEmail(r.Context(), server.DB, html.EscapeString(strings.TrimSpace(request.Email)))
+	if err == nil {
+		//Sent in the background so the answer takes as long for addresses without an account
+		go func() {
+			err := server.sendPasswordReset(context.Background(), userFound)
+			if err != nil {
+				log.Printf("Sending the password reset of user %d failed: %v", userFound.ID, err)
+			}
+		}()
+	}
+	responses.JSON(w, http.StatusAccepted, map[string]string{"message": "If the address has an account, a reset link is on its way"})
+}
+
+func (server *Server) sendPasswordReset(ctx context.Context, user *models.User) error {
+	token, err := models.IssuePasswordReset(ctx, server.DB, user.ID)
+	if err != nil {
+		return err
+	}
+
+	resetURL := models.AppBaseURL() + "/reset-password?token=" + url.QueryEscape(token)
+	return notifications.Email(ctx, user, "password_reset", map[string]interface{}{
+		"Minutes": int(models.PasswordResetLifetime.Minutes()),
+		"URL":     resetURL,
+	})
+}
+
+//Endpoint to set a new password with the token from the reset email, logging out every session of the user
+func (server *Server) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if request.Token == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Token"))
+		return
+	}
+	if request.NewPassword == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Password"))
+		return
+	}
+
+	user, err := models.ResetPassword(r.Context(), server.DB, request.Token, request.NewPassword)
+	recordAuthCheck(alerts.PasswordReset, err, models.ErrInvalidResetLink)
+	if tooManyAttempts(w, err) {
+		return
+	}
+	if err == models.ErrInvalidResetLink {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	if weak, ok := err.(*models.WeakPasswordError); ok {
+		responses.ERROR(w, http.StatusUnprocessableEntity, weak)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = notifications.Email(r.Context(), user, "password_reset_done", nil)
+	if err != nil {
+		log.Println(err)
+	}
+	responses.JSON(w, http.StatusOK, map[string]string{"message": "Password reset, log in with the new password"})
+}
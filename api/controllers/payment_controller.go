@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/payments"
+	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
+)
+
+//Share of the agreed price collected up front, BOOKING_DEPOSIT_PERCENT in the environment
+func bookingDepositPercent() float64 {
+	percent, err := strconv.ParseFloat(os.Getenv("BOOKING_DEPOSIT_PERCENT"), 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		return 20
+	}
+	return percent
+}
+
+//Currency deposits are charged in, PAYMENT_CURRENCY in the environment
+func paymentCurrency() string {
+	currency := os.Getenv("PAYMENT_CURRENCY")
+	if currency == "" {
+		return "KES"
+	}
+	return strings.ToUpper(currency)
+}
+
+//Endpoint for the customer of a confirmed booking to pay its deposit
+func (server *Server) CreateBookingPayment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	booking, customerID, err := models.BookingParties(r.Context(), server.DB, uint32(bid))
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if uid != customerID {
+		responses.ERROR(w, http.StatusForbidden, errors.New("Only The Customer Can Pay"))
+		return
+	}
+	if booking.Status != models.BookingConfirmed {
+		responses.ERROR(w, http.StatusConflict, errors.New("Booking Is Not Confirmed"))
+		return
+	}
+	payable, err := models.HasPayoutAccount(r.Context(), server.DB, booking.UserID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !payable {
+		responses.ERROR(w, http.StatusConflict, errors.New("Provider Has No Payout Details"))
+		return
+	}
+	if booking.PaymentStatus == payments.StatusPending || booking.PaymentStatus == payments.StatusSucceeded {
+		responses.ERROR(w, http.StatusConflict, errors.New("Booking Is Already Paid"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		Gateway string `json:"gateway"`
+		Phone   string `json:"phone_number"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	gateway, err := payments.Get(request.Gateway)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	price, err := strconv.ParseFloat(booking.Bid, 64)
+	if err != nil || price <= 0 {
+		responses.ERROR(w, http.StatusConflict, errors.New("Booking Has No Agreed Price"))
+		return
+	}
+
+	reference, err := tokens.Generate(24)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	payment := models.Payment{
+		BookingID: booking.ID,
+		UserID:    uid,
+		Gateway:   gateway.Name(),
+		Reference: reference,
+		Amount:    price * bookingDepositPercent() / 100,
+		Currency:  paymentCurrency(),
+	}
+
+	intent, err := gateway.CreateIntent(r.Context(), payments.Intent{
+		Reference:   payment.Reference,
+		Amount:      payment.Amount,
+		Currency:    payment.Currency,
+		Phone:       request.Phone,
+		Description: fmt.Sprintf("FixIt booking #%d deposit", booking.ID),
+	})
+	if err != nil {
+		responses.ERROR(w, http.StatusBadGateway, err)
+		return
+	}
+	payment.GatewayReference = intent.GatewayReference
+
+	paymentSaved, err := payment.SavePayment(r.Context(), server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := struct {
+		*models.Payment
+		ClientSecret string `json:"client_secret,omitempty"`
+		Instructions string `json:"instructions,omitempty"`
+	}{paymentSaved, intent.ClientSecret, intent.Instructions}
+	responses.JSON(w, http.StatusCreated, response)
+}
+
+//Endpoint receiving payment status webhooks, the gateway verifies the signature
+func (server *Server) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gateway, err := payments.Get(vars["gateway"])
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	event, err := gateway.ParseWebhook(r, body)
+	if err == payments.ErrInvalidSignature {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	response := map[string]string{
+		"message": "Received",
+	}
+	if event == nil {
+		responses.JSON(w, http.StatusOK, response)
+		return
+	}
+
+	payment := models.Payment{}
+	paymentFound, err := payment.FindPaymentByGatewayReference(r.Context(), server.DB, gateway.Name(), event.GatewayReference)
+	if err != nil {
+		//Unknown payments are acknowledged so the gateway stops retrying them
+		log.Printf("Ignoring %s webhook for %s: %v", gateway.Name(), event.GatewayReference, err)
+		responses.JSON(w, http.StatusOK, response)
+		return
+	}
+	if event.Reference != "" && event.Reference != paymentFound.Reference {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Payment Reference Mismatch"))
+		return
+	}
+	//Whole units are collected, so the amount asked for was rounded up
+	if event.Amount != 0 && event.Amount != math.Ceil(paymentFound.Amount) {
+		log.Printf("%s reported %.2f paid for payment %d of %.2f", gateway.Name(), event.Amount, paymentFound.ID, paymentFound.Amount)
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Payment Amount Mismatch"))
+		return
+	}
+
+	_, err = paymentFound.UpdatePaymentStatus(r.Context(), server.DB, event.Status)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, response)
+}
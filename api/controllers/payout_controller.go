@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Payout account together with its decrypted details, only ever sent to the owner
+type payoutResponse struct {
+	*models.PayoutAccount
+	Details *models.PayoutDetails `json:"details"`
+}
+
+//Endpoint for the current user to set where their earnings are paid out
+func (server *Server) SavePayoutDetails(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	details := models.PayoutDetails{}
+	err = json.Unmarshal(body, &details)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	details.Prepare()
+	err = details.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	account := models.PayoutAccount{UserID: uid}
+	err = account.SetDetails(details)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	accountSaved, err := account.SavePayoutAccount(r.Context(), server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, payoutResponse{accountSaved, &details})
+}
+
+//Endpoint for the current user to read their payout details
+func (server *Server) GetPayoutDetails(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	account := models.PayoutAccount{}
+	accountFound, err := account.FindPayoutAccount(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	details, err := accountFound.DecryptDetails()
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, payoutResponse{accountFound, details})
+}
+
+//Endpoint for the current user to remove their payout details
+func (server *Server) DeletePayoutDetails(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	account := models.PayoutAccount{}
+	_, err = account.DeletePayoutAccount(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	response := map[string]string{
+		"message": "Payout details deleted",
+	}
+	responses.JSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/dependency"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/sms"
+	"github.com/victorkabata/FixIt-API/api/templates"
+)
+
+//Endpoint to text the current user a code confirming their phone number, at most once a minute
+func (server *Server) SendPhoneCode(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	user := models.User{}
+	userFound, err := user.FindUserByID(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	phoneCode, code, err := models.IssuePhoneCode(r.Context(), server.DB, uid)
+	switch err {
+	case nil:
+	case models.ErrPhoneCodeTooSoon:
+		responses.ERROR(w, http.StatusTooManyRequests, err)
+		return
+	case models.ErrPhoneVerified:
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	case models.ErrPhoneNumberAbsent, models.ErrPhoneNotE164, models.ErrPhoneOptedOut:
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	default:
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	message, err := templates.Render("phone_code", userFound.Locale, map[string]interface{}{
+		"Code":    code,
+		"Minutes": int(models.PhoneCodeLifetime.Minutes()),
+	})
+	if err == nil {
+		err = sms.Send(r.Context(), sms.Message{To: phoneCode.Phone, Body: message.Body})
+	}
+	if status, ok := dependency.Status(err); ok {
+		responses.ERROR(w, status, errors.New("Sending The Code Failed"))
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusAccepted, phoneCode)
+}
+
+//Endpoint to confirm the current user's phone number with {"code": "123456"} from the text
+func (server *Server) VerifyPhone(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		Code string `json:"code"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if request.Code == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Code"))
+		return
+	}
+
+	err = models.VerifyPhoneCode(r.Context(), server.DB, uid, request.Code)
+	if tooManyAttempts(w, err) {
+		return
+	}
+	if err == models.ErrInvalidPhoneCode {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, map[string]interface{}{"message": "Phone Number Verified", "phone_verified": true})
+}
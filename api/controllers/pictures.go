@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/storage"
+)
+
+//Profile pictures younger than this are left to the sweeper, they may be picked before signing up and not be set yet
+const pictureSweepMinAge = 24 * time.Hour
+
+//Stored files behind the user's picture URLs, from the tracked keys or the URLs of users from before they were tracked
+func (server *Server) pictureKeys(user *models.User) []string {
+	if user.ImageKeys != "" {
+		return strings.Split(user.ImageKeys, ",")
+	}
+	keys := []string{}
+	for _, url := range user.PictureURLs() {
+		if key, ok := storage.KeyFromURL(server.Storage, url); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+//Tracks the files behind new picture URLs and deletes those of the picture they replaced, previousUser is nil
+//for new users. Failures are logged, what is left behind is deleted by the sweep-profile-pictures job.
+func (server *Server) pictureChanged(ctx context.Context, previousUser, updatedUser *models.User) {
+	if previousUser != nil && previousUser.ImageURL == updatedUser.ImageURL &&
+		previousUser.ThumbnailURL == updatedUser.ThumbnailURL && previousUser.MediumURL == updatedUser.MediumURL {
+		return
+	}
+
+	tracked := *updatedUser
+	tracked.ImageKeys = ""
+	keys := server.pictureKeys(&tracked)
+	err := models.SetUserImageKeys(ctx, server.DB, updatedUser.ID, keys)
+	if err != nil {
+		log.Printf("Tracking the picture of user %d failed: %v", updatedUser.ID, err)
+		return
+	}
+	updatedUser.ImageKeys = strings.Join(keys, ",")
+
+	if previousUser != nil {
+		server.deleteReplacedPicture(ctx, updatedUser.ID, server.pictureKeys(previousUser), keys)
+	}
+}
+
+//Deletes the files of a replaced picture that aren't part of the new one. Only the user's own uploads are
+//deleted, and only once nothing points at them, so a user can't delete someone else's picture by setting its URL.
+func (server *Server) deleteReplacedPicture(ctx context.Context, uid uint32, previousKeys, keys []string) {
+	current := map[string]bool{}
+	for _, key := range keys {
+		current[key] = true
+	}
+	replaced := []string{}
+	for _, key := range previousKeys {
+		if !current[key] {
+			replaced = append(replaced, key)
+		}
+	}
+
+	objects, err := models.FindOwnedStoredObjects(ctx, server.DB, uid, replaced)
+	if err == nil {
+		_, err = server.deleteUnusedPictures(ctx, *objects)
+	}
+	if err != nil {
+		log.Printf("Deleting the replaced picture of user %d failed: %v", uid, err)
+	}
+}
+
+//Deletes an image uploaded for something that wasn't saved after all
+func (server *Server) deleteUpload(ctx context.Context, uid uint32, url string) {
+	key, ok := storage.KeyFromURL(server.Storage, url)
+	if !ok {
+		return
+	}
+	err := server.Storage.Delete(ctx, key)
+	if err == nil {
+		err = models.MarkStoredObjectsDeleted(ctx, server.DB, []string{key})
+	}
+	if err != nil {
+		log.Printf("Deleting upload %s of user %d failed: %v", key, uid, err)
+	}
+}
+
+//Deletes the stored files no user picture, post or gallery item points at and returns how many were deleted
+func (server *Server) deleteUnusedPictures(ctx context.Context, objects []models.StoredObject) (int, error) {
+	urls := []string{}
+	for _, object := range objects {
+		urls = append(urls, server.Storage.URL(object.Key))
+	}
+	inUse, err := models.ImagesInUse(ctx, server.DB, urls)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := []string{}
+	for _, object := range objects {
+		if inUse[server.Storage.URL(object.Key)] {
+			continue
+		}
+		err = server.Storage.Delete(ctx, object.Key)
+		if err != nil {
+			log.Printf("Deleting unused picture %s failed: %v", object.Key, err)
+			continue
+		}
+		deleted = append(deleted, object.Key)
+	}
+	return len(deleted), models.MarkStoredObjectsDeleted(ctx, server.DB, deleted)
+}
+
+//Deletes the profile pictures and variants nothing points at, such as those replaced while the storage backend
+//was down or uploaded and never set. Unlike the media reconciliation it works with every storage backend.
+func (server *Server) sweepProfilePictures(ctx context.Context) error {
+	before := time.Now().Add(-pictureSweepMinAge)
+	var afterID uint64
+	total := 0
+	for {
+		objects, err := models.FindStoredObjectsBefore(ctx, server.DB, "profile", before, afterID, 500)
+		if err != nil {
+			return err
+		}
+		if len(*objects) == 0 {
+			break
+		}
+		deleted, err := server.deleteUnusedPictures(ctx, *objects)
+		if err != nil {
+			return err
+		}
+		total += deleted
+		afterID = (*objects)[len(*objects)-1].ID
+	}
+	if total > 0 {
+		log.Printf("Deleted %d unused profile pictures", total)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/victorkabata/FixIt-API/api/dependency"
+	"github.com/victorkabata/FixIt-API/api/geo"
+	"github.com/victorkabata/FixIt-API/api/geocode"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Endpoint to suggest addresses for a partly typed one, proxied so clients don't need the provider key
+func (server *Server) SuggestPlaces(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	text := strings.TrimSpace(query.Get("q"))
+	if length := utf8.RuneCountInString(text); length < 3 || length > 200 {
+		responses.ERROR(w, http.StatusBadRequest, errors.New("Query Must Be 3 To 200 Characters"))
+		return
+	}
+
+	suggestQuery := geocode.SuggestQuery{
+		Text:    text,
+		Country: query.Get("country"),
+		Session: query.Get("session"),
+	}
+	if len(suggestQuery.Country) > 2 {
+		responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid Country"))
+		return
+	}
+	if query.Get("lat") != "" || query.Get("lng") != "" {
+		latitude, latErr := strconv.ParseFloat(query.Get("lat"), 64)
+		longitude, lngErr := strconv.ParseFloat(query.Get("lng"), 64)
+		if latErr != nil || lngErr != nil || geo.Validate(latitude, longitude) != nil {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid Location"))
+			return
+		}
+		suggestQuery.Near = &geo.Point{Latitude: latitude, Longitude: longitude}
+	}
+
+	suggestions, err := server.Places.Suggest(r.Context(), suggestQuery)
+	if err != nil {
+		status, ok := dependency.Status(err)
+		if !ok {
+			status = http.StatusBadGateway
+		}
+		responses.ERROR(w, status, errors.New("Address Suggestions Unavailable"))
+		return
+	}
+	responses.JSON(w, http.StatusOK, suggestions)
+}
+
+//Endpoint to convert a plus code to coordinates with ?code=, or coordinates to a plus code with ?lat=&lng=
+func (server *Server) ConvertPlusCode(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if code := query.Get("code"); code != "" {
+		point, err := geo.DecodePlusCode(code)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return
+		}
+		responses.JSON(w, http.StatusOK, map[string]interface{}{
+			"plus_code": geo.EncodePlusCode(point, geo.PlusCodeLength),
+			"latitude":  point.Latitude,
+			"longitude": point.Longitude,
+		})
+		return
+	}
+
+	latitude, latErr := strconv.ParseFloat(query.Get("lat"), 64)
+	longitude, lngErr := strconv.ParseFloat(query.Get("lng"), 64)
+	if latErr != nil || lngErr != nil || geo.Validate(latitude, longitude) != nil {
+		responses.ERROR(w, http.StatusBadRequest, errors.New("Required Code Or Location"))
+		return
+	}
+	responses.JSON(w, http.StatusOK, map[string]interface{}{
+		"plus_code": geo.EncodePlusCode(geo.Point{Latitude: latitude, Longitude: longitude}, geo.PlusCodeLength),
+		"latitude":  latitude,
+		"longitude": longitude,
+	})
+}
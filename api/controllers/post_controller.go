@@ -1,20 +1,21 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"io/ioutil"
+	"log"
 	"net/http"
-	"os"
 	"strconv"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/gorilla/mux"
 	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/database"
 	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/notifications"
 	"github.com/victorkabata/FixIt-API/api/responses"
 	"github.com/victorkabata/FixIt-API/api/utils/formaterror"
 )
@@ -51,22 +52,62 @@ func (server *Server) CreatePost(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
 		return
 	}
-	postCreated, err := post.UploadPost(server.DB)
+	postCreated, err := post.UploadPost(r.Context(), server.DB)
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
 		responses.ERROR(w, http.StatusInternalServerError, formattedError)
 		return
 	}
+	//Sent in the background so posting doesn't wait on every provider around
+	go server.notifyNearbyProviders(context.Background(), *postCreated)
+
 	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, postCreated.ID))
 	responses.JSON(w, http.StatusCreated, postCreated)
 }
 
+//Tells providers of the post's category whose service area covers it about the new job, in their digest
+func (server *Server) notifyNearbyProviders(ctx context.Context, post models.Post) {
+	if post.Latitude == 0 && post.Longitude == 0 {
+		return
+	}
+	user := models.User{}
+	providers, err := user.SearchProviders(ctx, server.DB, models.ProviderFilter{
+		Specialisation: post.Category,
+		Nearby:         true,
+		Latitude:       float64(post.Latitude),
+		Longitude:      float64(post.Longitude),
+	})
+	if err != nil {
+		log.Printf("Finding providers near post %d failed: %v", post.ID, err)
+		return
+	}
+
+	for _, provider := range *providers {
+		if provider.ID == post.UserID {
+			continue
+		}
+		err = notifications.Send(ctx, server.DB, provider.ID, notifications.Notice{
+			Kind: "nearby_job",
+			Data: map[string]interface{}{
+				"Category":    html.UnescapeString(post.Category),
+				"Description": html.UnescapeString(post.Description),
+				"Address":     html.UnescapeString(post.Address),
+				"Distance":    *provider.Distance,
+			},
+			Digest: true,
+		})
+		if err != nil {
+			log.Printf("Notifying user %d of post %d failed: %v", provider.ID, post.ID, err)
+		}
+	}
+}
+
 //Controller to get all posts
 func (server *Server) GetPosts(w http.ResponseWriter, r *http.Request) {
 
 	post := models.Post{}
 
-	posts, err := post.FindAllPosts(server.DB)
+	posts, err := post.FindAllPosts(r.Context(), server.DB)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -85,7 +126,7 @@ func (server *Server) GetPost(w http.ResponseWriter, r *http.Request) {
 	}
 	post := models.Post{}
 
-	postReceived, err := post.FindPostByID(server.DB, pid)
+	postReceived, err := post.FindPostByID(r.Context(), server.DB, pid)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -202,7 +243,7 @@ func (server *Server) UpdatePost(w http.ResponseWriter, r *http.Request) {
 
 	post.Prepare()
 
-	updatedPost, err := post.UpdateAPost(server.DB, uint32(pid))
+	updatedPost, err := post.UpdateAPost(r.Context(), server.DB, uint32(pid))
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
 		responses.ERROR(w, http.StatusInternalServerError, formattedError)
@@ -233,7 +274,7 @@ func (server *Server) DeletePost(w http.ResponseWriter, r *http.Request) {
 
 	// Check if the post exist
 	post := models.Post{}
-	err = server.DB.Debug().Model(models.Post{}).Where("id = ?", pid).Take(&post).Error
+	err = database.WithContext(r.Context(), server.DB).Debug().Model(models.Post{}).Where("id = ?", pid).Take(&post).Error
 	if err != nil {
 		responses.ERROR(w, http.StatusNotFound, errors.New("Post Not Foundkp"))
 		return
@@ -244,7 +285,7 @@ func (server *Server) DeletePost(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 		return
 	}
-	_, err = post.DeleteAPost(server.DB, pid, uid)
+	_, err = post.DeleteAPost(r.Context(), server.DB, pid, uid)
 	if err != nil {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
@@ -259,40 +300,24 @@ func (server *Server) DeletePost(w http.ResponseWriter, r *http.Request) {
 }
 
 //Controller to upload post image to AWS S3
-func UploadPostPic(w http.ResponseWriter, r *http.Request) {
+func (server *Server) UploadPostPic(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	maxSize := int64(10 << 20) // allow only 10MB of file size
-
-	err := r.ParseMultipartForm(maxSize)
-	if err != nil {
-		responses.ERROR(w, http.StatusRequestEntityTooLarge, errors.New("File too large"))
-		return
-	}
-
-	file, fileHeader, err := r.FormFile("upload")
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+	file, fileHeader, ok := readImageUpload(w, r)
+	if !ok {
 		return
 	}
 	defer file.Close()
 
-	// create an AWS session
-	s, err := session.NewSession(&aws.Config{
-		Region: aws.String("us-east-2"),
-		Credentials: credentials.NewStaticCredentials(
-			os.Getenv("AWS_SECRET_ID"),  // Secrete id
-			os.Getenv("AWS_SECRET_KEY"), // secret key
-			""),
-	})
-
+	s, err := newAWSSession()
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
 	}
 
-	fileName, err := models.UploadPostPicToS3("post", s, file, fileHeader)
+	fileName, err := models.UploadPostPicToS3(r.Context(), server.DB, uploaderID(r), "post", s, file, fileHeader, maxUploadSize())
 	if err != nil {
-		responses.ERROR(w, http.StatusInternalServerError, err)
+		responses.ERROR(w, uploadErrorStatus(err), err)
 		return
 	}
 
@@ -315,7 +340,7 @@ func (server *Server) GetPostBooking(w http.ResponseWriter, r *http.Request) {
 	}
 	booking := models.Booking{}
 
-	postBookings, err := booking.FindPostBookings(server.DB, pid)
+	postBookings, err := booking.FindPostBookings(r.Context(), server.DB, pid)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -334,7 +359,7 @@ func (server *Server) GetUserPosts(w http.ResponseWriter, r *http.Request) {
 	}
 	post := models.Post{}
 
-	userPosts, err := post.FindUserPosts(server.DB, pid)
+	userPosts, err := post.FindUserPosts(r.Context(), server.DB, pid)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/storage"
+)
+
+//How long the link to upload a profile picture to works
+const presignedUploadLifetime = 15 * time.Minute
+
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+//Profile pictures of a user go under their own prefix, so one user can't claim another's upload
+func profileUploadPrefix(uid uint32) string {
+	return fmt.Sprintf("profile/%d-", uid)
+}
+
+//Endpoint to get a link the app uploads a profile picture to directly, followed by CompleteProfilePicUpload
+func (server *Server) PresignProfilePicUpload(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	presigner, ok := server.Storage.(storage.Presigner)
+	if !ok {
+		responses.ERROR(w, http.StatusNotImplemented, errors.New("Direct Uploads Not Supported By The Storage Backend"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		ContentType string `json:"content_type"`
+		Size        int64  `json:"size"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	extension, ok := imageExtensions[request.ContentType]
+	if !ok {
+		responses.ERROR(w, http.StatusUnsupportedMediaType, errors.New("Only JPEG, PNG, GIF and WebP images are allowed"))
+		return
+	}
+	if request.Size <= 0 || request.Size > maxImageSize {
+		responses.ERROR(w, http.StatusRequestEntityTooLarge, errors.New("File too large"))
+		return
+	}
+
+	key := profileUploadPrefix(uid) + bson.NewObjectId().Hex() + extension
+	uploadURL, headers, err := presigner.PresignUpload(key, request.ContentType, presignedUploadLifetime)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	signedHeaders := map[string]string{}
+	for name := range headers {
+		signedHeaders[name] = headers.Get(name)
+	}
+	responses.JSON(w, http.StatusCreated, map[string]interface{}{
+		"key":        key,
+		"upload_url": uploadURL,
+		"method":     "PUT",
+		"headers":    signedHeaders,
+		"expires_at": time.Now().Add(presignedUploadLifetime),
+	})
+}
+
+//Endpoint the app calls once the direct upload is done, to check the file and make it the user's profile picture
+func (server *Server) CompleteProfilePicUpload(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	presigner, ok := server.Storage.(storage.Presigner)
+	if !ok {
+		responses.ERROR(w, http.StatusNotImplemented, errors.New("Direct Uploads Not Supported By The Storage Backend"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		Key string `json:"key"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if !strings.HasPrefix(request.Key, profileUploadPrefix(uid)) || strings.Contains(request.Key[len("profile/"):], "/") {
+		responses.ERROR(w, http.StatusForbidden, errors.New("Invalid Upload Key"))
+		return
+	}
+
+	size, contentType, err := presigner.Inspect(r.Context(), request.Key)
+	if err == storage.ErrNotFound {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Upload Not Found"))
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	//The link can't limit what is sent, so files that aren't images or are too large are removed here
+	if size > maxImageSize || !allowedImageTypes[contentType] {
+		err = server.Storage.Delete(r.Context(), request.Key)
+		if err != nil {
+			log.Printf("Deleting rejected upload %s of user %d failed: %v", request.Key, uid, err)
+		}
+		if size > maxImageSize {
+			responses.ERROR(w, http.StatusRequestEntityTooLarge, errors.New("File too large"))
+			return
+		}
+		responses.ERROR(w, http.StatusUnsupportedMediaType, errors.New("Only JPEG, PNG, GIF and WebP images are allowed"))
+		return
+	}
+
+	//The upload is replaced by its processed version, stripped of EXIF data, and its variants are added
+	data, err := presigner.Download(r.Context(), request.Key, maxImageSize)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	picture, err := models.ProcessUploadedProfilePic(r.Context(), server.DB, server.Storage, uid, request.Key, data)
+	if err != nil {
+		status := uploadErrorStatus(err)
+		if status != http.StatusInternalServerError {
+			deleteErr := server.Storage.Delete(r.Context(), request.Key)
+			if deleteErr != nil {
+				log.Printf("Deleting rejected upload %s of user %d failed: %v", request.Key, uid, deleteErr)
+			}
+		}
+		responses.ERROR(w, status, err)
+		return
+	}
+
+	user := models.User{}
+	previousUser, err := user.FindUserByID(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = models.SetUserProfilePicture(r.Context(), server.DB, uid, picture)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	server.deleteReplacedPicture(r.Context(), uid, server.pictureKeys(previousUser), picture.Keys)
+	responses.JSON(w, http.StatusOK, picture)
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/victorkabata/FixIt-API/api/geo"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Endpoint to download a provider's contact details as a vCard
+func (server *Server) GetProviderVCard(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	uid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user := models.User{}
+	provider, err := user.FindUserByID(r.Context(), server.DB, uint32(uid))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	card, err := provider.VCard()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vcard; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"provider-%d.vcf\"", provider.ID))
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, card)
+}
+
+//Endpoint to search providers by specialisation, region, max price and, with lat and lng, by distance
+func (server *Server) SearchProviders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := models.ProviderFilter{
+		Specialisation: strings.TrimSpace(query.Get("specialisation")),
+		Region:         strings.TrimSpace(query.Get("region")),
+	}
+	if maxPrice := query.Get("max_price"); maxPrice != "" {
+		price, err := strconv.ParseFloat(maxPrice, 64)
+		if err != nil || price < 0 {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid Max Price"))
+			return
+		}
+		filter.MaxPrice = price
+	}
+	if query.Get("lat") != "" || query.Get("lng") != "" {
+		latitude, err := strconv.ParseFloat(query.Get("lat"), 64)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, geo.ErrInvalidLatitude)
+			return
+		}
+		longitude, err := strconv.ParseFloat(query.Get("lng"), 64)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, geo.ErrInvalidLongitude)
+			return
+		}
+		err = geo.Validate(latitude, longitude)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return
+		}
+		filter.Nearby = true
+		filter.Latitude = latitude
+		filter.Longitude = longitude
+	}
+	if radius := query.Get("radius_km"); radius != "" {
+		radiusKm, err := strconv.ParseFloat(radius, 64)
+		if err != nil || radiusKm <= 0 {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid Radius"))
+			return
+		}
+		filter.RadiusKm = radiusKm
+	}
+	if list := query.Get("languages"); list != "" {
+		languages, err := models.ParseLanguages(list)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return
+		}
+		filter.Languages = languages
+	}
+	metadata, err := models.ParseMetadataFilters(query)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	filter.Metadata = metadata
+
+	//Nearby searches crowd the same few streets in busy areas, so their results are cached by grid cell
+	ttl := searchCacheTTL()
+	var key string
+	if filter.Nearby && ttl > 0 {
+		snapSearchPoint(&filter)
+		if generation, ok := server.searchGeneration(r.Context(), filter); ok {
+			key = searchCacheKey(generation, filter)
+			cached, found, err := server.SearchCache.Get(r.Context(), key)
+			if err != nil {
+				log.Printf("Reading the search cache failed: %v", err)
+			}
+			if found {
+				responses.JSON(w, http.StatusOK, json.RawMessage(cached))
+				return
+			}
+		}
+	}
+
+	user := models.User{}
+	providers, err := user.SearchProviders(r.Context(), server.DB, filter)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if key != "" {
+		body, err := json.Marshal(providers)
+		if err == nil {
+			err = server.SearchCache.Set(r.Context(), key, body, ttl)
+		}
+		if err != nil {
+			log.Printf("Caching the search failed: %v", err)
+		}
+	}
+	responses.JSON(w, http.StatusOK, providers)
+}
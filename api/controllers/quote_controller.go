@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/notifications"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Endpoint for the provider of a booking to quote a price
+func (server *Server) SubmitQuote(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	booking, customerID, err := models.BookingParties(r.Context(), server.DB, uint32(bid))
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if uid != booking.UserID {
+		responses.ERROR(w, http.StatusForbidden, errors.New("Only The Provider Can Quote"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	quote := models.Quote{}
+	err = json.Unmarshal(body, &quote)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	quote.Prepare()
+	quote.BookingID = booking.ID
+	quote.AuthorID = uid
+	err = quote.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	quoteSaved, err := quote.SubmitQuote(r.Context(), server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+
+	server.notifyBookingParties(r.Context(), booking.UserID, customerID, notifications.Notice{
+		Kind: "quote_submitted",
+		Data: map[string]interface{}{"BookingID": booking.ID, "Amount": quoteSaved.Amount},
+	})
+
+	responses.JSON(w, http.StatusCreated, quoteSaved)
+}
+
+//Endpoint to get the quote history of a booking, limited to its customer and provider
+func (server *Server) GetBookingQuotes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	booking, customerID, err := models.BookingParties(r.Context(), server.DB, uint32(bid))
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if uid != booking.UserID && uid != customerID {
+		responses.ERROR(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
+		return
+	}
+
+	quote := models.Quote{}
+	quotes, err := quote.FindBookingQuotes(r.Context(), server.DB, booking.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, quotes)
+}
+
+//Endpoint to accept, decline or counter an open quote on a booking
+func (server *Server) RespondToQuote(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	qid, err := strconv.ParseUint(vars["quote_id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	booking, customerID, err := models.BookingParties(r.Context(), server.DB, uint32(bid))
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if uid != booking.UserID && uid != customerID {
+		responses.ERROR(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		Action  string  `json:"action"`
+		Amount  float64 `json:"amount"`
+		Message string  `json:"message"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	var counter *models.Quote
+	if request.Action == "counter" {
+		counter = &models.Quote{Amount: request.Amount, Message: request.Message}
+		counter.Prepare()
+		counter.BookingID = booking.ID
+		counter.AuthorID = uid
+		err = counter.Validate()
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+
+	quote := models.Quote{}
+	result, err := quote.RespondToQuote(r.Context(), server.DB, booking.ID, qid, uid, request.Action, counter)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	notice := notifications.Notice{Data: map[string]interface{}{"BookingID": booking.ID, "Amount": result.Amount}}
+	switch request.Action {
+	case "accept":
+		notice.Kind = "booking_confirmed"
+	case "decline":
+		notice.Kind = "quote_declined"
+	case "counter":
+		notice.Kind = "quote_countered"
+	}
+	server.notifyBookingParties(r.Context(), booking.UserID, customerID, notice)
+	server.refreshProviderStats(r.Context(), booking.UserID)
+
+	responses.JSON(w, http.StatusOK, result)
+}
+
+//Notify both the provider and the customer of a booking
+func (server *Server) notifyBookingParties(ctx context.Context, providerID, customerID uint32, notice notifications.Notice) {
+	for _, uid := range []uint32{providerID, customerID} {
+		err := notifications.Send(ctx, server.DB, uid, notice)
+		if err != nil {
+			log.Printf("Notifying user %d of %s failed: %v", uid, notice.Kind, err)
+		}
+	}
+}
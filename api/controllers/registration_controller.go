@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/notifications"
+	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/templates"
+)
+
+//Endpoint to sign up as a customer, see models.CustomerRegistration
+func (server *Server) RegisterCustomer(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	registration := models.CustomerRegistration{}
+	err = json.Unmarshal(body, &registration)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	if registration.Locale == "" {
+		registration.Locale = templates.FromAcceptLanguage(r.Header.Get("Accept-Language"))
+	}
+	user, err := registration.User()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	server.register(w, r, user, nil)
+}
+
+//Endpoint to sign up as a provider with a specialisation and an identity document, see
+//models.ProviderRegistration. Providers are left out of searches until an admin approves the document.
+func (server *Server) RegisterProvider(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	registration := models.ProviderRegistration{}
+	err = json.Unmarshal(body, &registration)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	if registration.Locale == "" {
+		registration.Locale = templates.FromAcceptLanguage(r.Header.Get("Accept-Language"))
+	}
+	user, verification, err := registration.User()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	server.register(w, r, user, verification)
+}
+
+//Endpoint to get the identity document the current provider submitted and where its review is
+func (server *Server) GetProviderVerification(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	verification, err := models.FindProviderVerification(r.Context(), server.DB, uid)
+	if err != nil && err.Error() == "Verification Not Found" {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, verification)
+}
+
+//Endpoint for providers to submit their identity document, the first time when they signed up without
+//one or again after it was rejected
+func (server *Server) SubmitProviderVerification(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	user := models.User{}
+	userFound, err := user.FindUserByID(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if userFound.Role != auth.RoleProvider {
+		responses.ERROR(w, http.StatusForbidden, errors.New("Only Providers Are Verified"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	verification := models.ProviderVerification{}
+	err = json.Unmarshal(body, &verification)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	verification.Prepare()
+	verification.UserID = uid
+	err = verification.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	verificationSubmitted, err := verification.SubmitProviderVerification(r.Context(), server.DB)
+	if err == models.ErrDocumentRegistered || err == models.ErrProviderVerificationDone {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusAccepted, verificationSubmitted)
+}
+
+//Endpoint for admins to list identity documents by ?status=, pending by default, oldest first
+func (server *Server) GetProviderVerifications(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.KYCPending
+	}
+	verifications, err := models.FindProviderVerifications(r.Context(), server.DB, status)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, verifications)
+}
+
+//Endpoint for admins to approve a provider's identity document with {"status": "approved"}, or to
+//reject it with {"status": "rejected", "reason": "..."}. The provider is notified either way.
+func (server *Server) ReviewProviderVerification(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+
+	vid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	adminID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	verificationReviewed, err := models.ReviewProviderVerification(r.Context(), server.DB, vid, adminID, request.Status, request.Reason)
+	if err != nil && err.Error() == "Verification Not Found" {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = notifications.Send(r.Context(), server.DB, verificationReviewed.UserID, notifications.Notice{
+		Kind: "kyc_reviewed",
+		Data: map[string]interface{}{
+			"Status": verificationReviewed.Status,
+			"Reason": verificationReviewed.Reason,
+		},
+	})
+	if err != nil {
+		log.Printf("Notifying user %d of kyc_reviewed failed: %v", verificationReviewed.UserID, err)
+	}
+	server.invalidateSearchesOf(r.Context(), verificationReviewed.UserID)
+	responses.JSON(w, http.StatusOK, verificationReviewed)
+}
@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/storage"
+)
+
+//Evidence can also be a PDF, such as a receipt or a quote
+var allowedEvidenceTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+func allowedUploadType(kind, contentType string) bool {
+	if kind == models.UploadDisputeEvidence {
+		return allowedEvidenceTypes[contentType]
+	}
+	return allowedImageTypes[contentType]
+}
+
+func unsupportedUploadType(kind string) error {
+	if kind == models.UploadDisputeEvidence {
+		return errors.New("Only JPEG, PNG, GIF and WebP images and PDFs are allowed")
+	}
+	return errors.New("Only JPEG, PNG, GIF and WebP images are allowed")
+}
+
+//Endpoint to start a resumable upload of a gallery photo or dispute evidence. The file is then sent
+//in parts of models.UploadPartSize bytes, the last one smaller, and completed once all of them arrived.
+func (server *Server) StartUpload(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		Kind        string `json:"kind"`
+		DisputeID   uint64 `json:"dispute_id"`
+		Filename    string `json:"filename"`
+		Size        int64  `json:"size"`
+		ContentType string `json:"content_type"`
+		Note        string `json:"note"` //Caption of a photo or note on evidence
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	upload := models.Upload{
+		Kind:        request.Kind,
+		TargetID:    request.DisputeID,
+		Filename:    request.Filename,
+		Size:        request.Size,
+		ContentType: request.ContentType,
+		Note:        request.Note,
+	}
+	upload.Prepare()
+	upload.UserID = uid
+	err = upload.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if !allowedUploadType(upload.Kind, upload.ContentType) {
+		responses.ERROR(w, http.StatusUnsupportedMediaType, unsupportedUploadType(upload.Kind))
+		return
+	}
+
+	//Resumable uploads go to the uploads bucket, evidence there can only be signed by the s3 backend
+	if _, ok := server.Storage.(*storage.S3); !ok && upload.Kind == models.UploadDisputeEvidence {
+		responses.ERROR(w, http.StatusNotImplemented, errors.New("Resumable Evidence Uploads Not Supported By The Storage Backend"))
+		return
+	}
+
+	//Checked now so the file isn't sent for nothing, and again once it arrived
+	if upload.Kind == models.UploadDisputeEvidence {
+		dispute, _, _, status, err := server.partyDispute(r.Context(), upload.TargetID, uid)
+		if err != nil {
+			responses.ERROR(w, status, err)
+			return
+		}
+		if dispute.Status != models.DisputeOpen {
+			responses.ERROR(w, http.StatusConflict, errors.New("Dispute Is Closed"))
+			return
+		}
+	}
+
+	s, err := newAWSSession()
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	uploadStarted, err := upload.SaveUpload(r.Context(), server.DB, s)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusCreated, uploadResponse(uploadStarted))
+}
+
+//Status of an upload with what the client needs to carry on
+func uploadResponse(upload *models.Upload) map[string]interface{} {
+	return map[string]interface{}{
+		"upload":     upload,
+		"part_size":  models.UploadPartSize,
+		"part_count": upload.PartCount(),
+		"next_part":  upload.NextPart(),
+	}
+}
+
+//Loads an upload of the current user
+func (server *Server) findUpload(r *http.Request) (*models.Upload, int, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		return nil, http.StatusUnauthorized, errors.New("Unauthorized")
+	}
+	upload, err := models.FindUpload(r.Context(), server.DB, id, uid)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	return upload, http.StatusOK, nil
+}
+
+//Endpoint to see which parts of an upload arrived, so an interrupted client knows where to resume
+func (server *Server) GetUpload(w http.ResponseWriter, r *http.Request) {
+	upload, status, err := server.findUpload(r)
+	if err != nil {
+		responses.ERROR(w, status, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, uploadResponse(upload))
+}
+
+//Endpoint to send one part of an upload as the raw request body, sending a part again replaces it
+func (server *Server) UploadPart(w http.ResponseWriter, r *http.Request) {
+	upload, status, err := server.findUpload(r)
+	if err != nil {
+		responses.ERROR(w, status, err)
+		return
+	}
+	n, err := strconv.ParseInt(mux.Vars(r)["number"], 10, 64)
+	if err != nil || n < 1 || n > upload.PartCount() {
+		responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid Part Number"))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, upload.PartSize(n))
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusRequestEntityTooLarge, errors.New("Part too large"))
+		return
+	}
+	if int64(len(body)) != upload.PartSize(n) {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Part Has The Wrong Size"))
+		return
+	}
+	//Sniff the content instead of trusting the content type the upload was started with
+	if n == 1 && !allowedUploadType(upload.Kind, http.DetectContentType(body)) {
+		responses.ERROR(w, http.StatusUnsupportedMediaType, unsupportedUploadType(upload.Kind))
+		return
+	}
+
+	s, err := newAWSSession()
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	part, err := upload.SaveUploadPart(r.Context(), server.DB, s, n, body)
+	if err == models.ErrUploadNotReceiving {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, part)
+}
+
+//Endpoint to finish an upload once all parts arrived. The file is processed in the background,
+//clients follow the upload until it is done and result_id holds the gallery item or evidence.
+func (server *Server) CompleteUpload(w http.ResponseWriter, r *http.Request) {
+	upload, status, err := server.findUpload(r)
+	if err != nil {
+		responses.ERROR(w, status, err)
+		return
+	}
+	err = upload.StartProcessing(r.Context(), server.DB)
+	if err == models.ErrUploadIncomplete {
+		responses.JSON(w, http.StatusConflict, uploadResponse(upload))
+		return
+	}
+	if err == models.ErrUploadNotReceiving {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusAccepted, uploadResponse(upload))
+	go server.processUpload(context.Background(), upload)
+}
+
+//Joins the parts of a completed upload and creates what it was for
+func (server *Server) processUpload(ctx context.Context, upload *models.Upload) {
+	resultID, err := server.saveUploadResult(ctx, upload)
+	if err != nil {
+		log.Printf("Processing upload %d of user %d failed: %v", upload.ID, upload.UserID, err)
+	}
+	err = upload.FinishUpload(ctx, server.DB, resultID, err)
+	if err != nil {
+		log.Printf("Finishing upload %d of user %d failed: %v", upload.ID, upload.UserID, err)
+	}
+}
+
+func (server *Server) saveUploadResult(ctx context.Context, upload *models.Upload) (uint64, error) {
+	s, err := newAWSSession()
+	if err != nil {
+		return 0, err
+	}
+	err = upload.CompleteS3Upload(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+	err = models.SaveStoredObject(ctx, server.DB, &models.StoredObject{
+		Key:         upload.Key,
+		UserID:      upload.UserID,
+		Size:        upload.Size,
+		ContentType: upload.ContentType,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if upload.Kind == models.UploadGallery {
+		item := models.GalleryItem{ImageURL: storage.S3Settings().URL(upload.Key)}
+		item.Prepare()
+		item.Caption = upload.Note //Escaped when the upload started
+		item.UserID = upload.UserID
+		err = item.Validate()
+		if err != nil {
+			return 0, err
+		}
+		itemSaved, err := item.SaveGalleryItem(ctx, server.DB)
+		if err != nil {
+			return 0, err
+		}
+		return itemSaved.ID, nil
+	}
+
+	dispute, booking, customerID, _, err := server.partyDispute(ctx, upload.TargetID, upload.UserID)
+	if err != nil {
+		return 0, err
+	}
+	evidence := models.DisputeEvidence{
+		UserID:  upload.UserID,
+		FileKey: upload.Key,
+		Note:    upload.Note,
+	}
+	evidenceSaved, err := evidence.SaveDisputeEvidence(ctx, server.DB, dispute)
+	if err != nil {
+		return 0, err
+	}
+	server.notifyEvidence(ctx, booking, customerID, upload.UserID)
+	return evidenceSaved.ID, nil
+}
+
+//Endpoint to give up on an upload that is still receiving parts
+func (server *Server) CancelUpload(w http.ResponseWriter, r *http.Request) {
+	upload, status, err := server.findUpload(r)
+	if err != nil {
+		responses.ERROR(w, status, err)
+		return
+	}
+	if upload.Status != models.UploadReceiving {
+		responses.ERROR(w, http.StatusConflict, models.ErrUploadNotReceiving)
+		return
+	}
+	s, err := newAWSSession()
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = upload.DeleteUpload(r.Context(), server.DB, s)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//Throws away uploads that were never completed, along with their parts in storage
+func (server *Server) expireUploads(ctx context.Context) error {
+	uploads, err := models.FindExpiredUploads(ctx, server.DB, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(*uploads) == 0 {
+		return nil
+	}
+	s, err := newAWSSession()
+	if err != nil {
+		return err
+	}
+	for i := range *uploads {
+		err = (*uploads)[i].DeleteUpload(ctx, server.DB, s)
+		if err != nil {
+			log.Printf("Expiring upload %d failed: %v", (*uploads)[i].ID, err)
+		}
+	}
+	return nil
+}
@@ -5,11 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/metrics"
 	"github.com/victorkabata/FixIt-API/api/models"
 	"github.com/victorkabata/FixIt-API/api/responses"
 	"github.com/victorkabata/FixIt-API/api/utils/formaterror"
@@ -47,13 +51,47 @@ func (server *Server) CreateReview(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	reviewCreated, err := review.UploadReview(server.DB)
+	err = review.CheckReviewBooking(r.Context(), server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusForbidden, err)
+		return
+	}
+
+	err = review.Screen(r.Context(), server.DB, time.Now())
+	if err == models.ErrReviewRateLimited {
+		responses.ERROR(w, http.StatusTooManyRequests, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	reviewCreated, err := review.UploadReview(r.Context(), server.DB)
+	if err == models.ErrAlreadyReviewed {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
 		responses.ERROR(w, http.StatusInternalServerError, formattedError)
 		return
 	}
+	metrics.ReviewsPosted.WithLabelValues(reviewCreated.Status).Inc()
+
+	if reviewCreated.BookingID != 0 {
+		err = models.LinkReviewRequest(r.Context(), server.DB, reviewCreated.BookingID, reviewCreated.ID)
+		if err != nil {
+			log.Println(err)
+		}
+	}
 	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, reviewCreated.ID))
+	if reviewCreated.Status == models.ReviewHeld {
+		//Held reviews are only published once a moderator approves them
+		responses.JSON(w, http.StatusAccepted, reviewCreated)
+		return
+	}
+	server.invalidateSearchesOf(r.Context(), reviewCreated.WorkerID)
 	responses.JSON(w, http.StatusCreated, reviewCreated)
 
 }
@@ -63,7 +101,7 @@ func (server *Server) GetReviews(w http.ResponseWriter, r *http.Request) {
 
 	review := models.Review{}
 
-	reviews, err := review.FindAllReviews(server.DB)
+	reviews, err := review.FindAllReviews(r.Context(), server.DB)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -84,7 +122,7 @@ func (server *Server) GetUserReviews(w http.ResponseWriter, r *http.Request) {
 
 	review := models.Review{}
 
-	reviewsRecieved, err := review.FindUserReviews(server.DB, pid)
+	reviewsRecieved, err := review.FindUserReviews(r.Context(), server.DB, pid)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -113,7 +151,7 @@ func (server *Server) UpdateReview(w http.ResponseWriter, r *http.Request) {
 
 	// Check if the review exist
 	review := models.Review{}
-	err = server.DB.Debug().Model(models.Review{}).Where("id = ?", pid).Take(&review).Error
+	err = database.WithContext(r.Context(), server.DB).Debug().Model(models.Review{}).Where("id = ?", pid).Take(&review).Error
 	if err != nil {
 		responses.ERROR(w, http.StatusNotFound, errors.New("Review not found"))
 		return
@@ -124,6 +162,11 @@ func (server *Server) UpdateReview(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 		return
 	}
+
+	if !review.Editable(time.Now()) {
+		responses.ERROR(w, http.StatusForbidden, errors.New("Review Can No Longer Be Edited"))
+		return
+	}
 	// Read the data posted
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -154,15 +197,82 @@ func (server *Server) UpdateReview(w http.ResponseWriter, r *http.Request) {
 
 	reviewUpdate.ID = review.ID //this is important to tell the model the trbiew id to update, the other update field are set above
 
-	reviewUpdated, err := reviewUpdate.UpdateReview(server.DB)
+	reviewUpdated, err := reviewUpdate.UpdateReview(r.Context(), server.DB, &review)
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
 		responses.ERROR(w, http.StatusInternalServerError, formattedError)
 		return
 	}
+	server.invalidateSearchesOf(r.Context(), review.WorkerID, reviewUpdated.WorkerID)
 	responses.JSON(w, http.StatusOK, reviewUpdated)
 }
 
+//Controller to get the earlier versions of a review
+func (server *Server) GetReviewHistory(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+
+	rid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	history, err := models.FindReviewHistory(r.Context(), server.DB, rid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, history)
+}
+
+//Controller for admins to list reviews held for moderation
+func (server *Server) GetHeldReviews(w http.ResponseWriter, r *http.Request) {
+
+	reviews, err := models.FindHeldReviews(r.Context(), server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, reviews)
+}
+
+//Controller for admins to publish or reject a held review
+func (server *Server) ModerateReview(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+
+	rid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		Status string `json:"status"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	review := models.Review{}
+	reviewModerated, err := review.ModerateReview(r.Context(), server.DB, rid, request.Status)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	server.invalidateSearchesOf(r.Context(), reviewModerated.WorkerID)
+	responses.JSON(w, http.StatusOK, reviewModerated)
+}
+
 //Controller to delete review
 func (server *Server) DeleteReview(w http.ResponseWriter, r *http.Request) {
 
@@ -184,7 +294,7 @@ func (server *Server) DeleteReview(w http.ResponseWriter, r *http.Request) {
 
 	// Check if the review exist
 	review := models.Review{}
-	err = server.DB.Debug().Model(models.Review{}).Where("id = ?", pid).Take(&review).Error
+	err = database.WithContext(r.Context(), server.DB).Debug().Model(models.Review{}).Where("id = ?", pid).Take(&review).Error
 	if err != nil {
 		responses.ERROR(w, http.StatusNotFound, errors.New("Review Not Foundkp"))
 		return
@@ -196,7 +306,7 @@ func (server *Server) DeleteReview(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = review.DeleteReview(server.DB, pid, uid)
+	_, err = review.DeleteReview(r.Context(), server.DB, pid, uid)
 	if err != nil {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
@@ -207,5 +317,6 @@ func (server *Server) DeleteReview(w http.ResponseWriter, r *http.Request) {
 		"message": "Review deleted",
 	}
 
+	server.invalidateSearchesOf(r.Context(), review.WorkerID)
 	responses.JSON(w, http.StatusNoContent, response)
 }
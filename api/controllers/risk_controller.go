@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/notifications"
+	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/risk"
+)
+
+//Scores the action and logs the assessment against the user, logging failures are not fatal
+func (server *Server) assessRisk(ctx context.Context, uid uint32, signal risk.Signal) risk.Assessment {
+	assessment := server.Risk.Assess(ctx, signal)
+
+	err := models.SaveRiskAssessment(ctx, server.DB, uid, signal, assessment)
+	if err != nil {
+		log.Printf("Saving %s risk assessment of user %d failed: %v", signal.Action, uid, err)
+	}
+	return assessment
+}
+
+//Emails a one-time code the user types back to finish logging in
+func (server *Server) sendLoginCode(ctx context.Context, user *models.User) error {
+	code, err := models.IssueLoginCode(ctx, server.DB, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return notifications.Email(ctx, user, "login_code", map[string]interface{}{
+		"Minutes": int(models.LoginCodeLifetime.Minutes()),
+		"Code":    code,
+	})
+}
+
+//Endpoint to list the accounts held for manual review
+func (server *Server) GetRiskReviewQueue(w http.ResponseWriter, r *http.Request) {
+	queue, err := models.FindRiskReviewQueue(r.Context(), server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, queue)
+}
+
+//Endpoint to approve or reject an account held for manual review
+func (server *Server) DecideRiskReview(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	uid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		Action string `json:"action"` //approve or reject
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if request.Action != "approve" && request.Action != "reject" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Invalid Action"))
+		return
+	}
+
+	user, err := models.DecideRiskReview(r.Context(), server.DB, uint32(uid), request.Action == "approve")
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, user.Admin())
+}
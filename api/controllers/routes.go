@@ -1,37 +1,183 @@
 package controllers
 
-import "github.com/victorkabata/FixIt-API/api/middlewares"
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/fault"
+	"github.com/victorkabata/FixIt-API/api/middlewares"
+	"github.com/victorkabata/FixIt-API/api/storage"
+)
 
 //Initializes all the endpoints/routes.
 func (s *Server) initializeRoutes() {
 
+	s.Router.Use(middlewares.SetMiddlewareMaintenance)
+	s.Router.Use(middlewares.SetMiddlewareAppVersion)
+	s.Router.Use(fault.Middleware)
+	s.Router.Use(middlewares.SetMiddlewareHandlerName)
+	s.Router.Use(middlewares.SetMiddlewareDeadline)
+
 	// Home Route
 	s.Router.HandleFunc("/", middlewares.SetMiddlewareJSON(s.Home)).Methods("GET")
 
+	//Prometheus metrics
+	s.Router.Handle("/metrics", middlewares.SetMiddlewareMetrics(promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer, promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+	))).Methods("GET")
+
+	//Public keys of the login tokens
+	s.Router.HandleFunc("/.well-known/jwks.json", middlewares.SetMiddlewareJSON(s.GetJWKS)).Methods("GET")
+
+	//Health check route
+	s.Router.HandleFunc("/health", middlewares.SetMiddlewareJSON(s.Health)).Methods("GET")
+
+	//Files of the local storage backend
+	if local, ok := s.Storage.(*storage.Local); ok {
+		s.Router.PathPrefix("/media/").Handler(local.Handler("/media/")).Methods("GET")
+		s.Router.PathPrefix(local.PrivateURL + "/").Handler(local.PrivateHandler(local.PrivateURL + "/")).Methods("GET")
+	}
+
+	//App config route
+	s.Router.HandleFunc("/app-config", middlewares.SetMiddlewareJSON(s.AppConfig)).Methods("GET")
+
 	//Register Route
-	s.Router.HandleFunc("/register", middlewares.SetMiddlewareJSON(s.CreateUser)).Methods("POST")
+	s.Router.HandleFunc("/register", middlewares.SetMiddlewareJSON(s.AuthLimiter.Middleware(s.CreateUser))).Methods("POST")
+	s.Router.HandleFunc("/register/customer", middlewares.SetMiddlewareJSON(s.AuthLimiter.Middleware(s.RegisterCustomer))).Methods("POST")
+	s.Router.HandleFunc("/register/provider", middlewares.SetMiddlewareJSON(s.AuthLimiter.Middleware(s.RegisterProvider))).Methods("POST")
+	s.Router.HandleFunc("/verify-email", middlewares.SetMiddlewareJSON(s.VerifyEmail)).Methods("GET", "POST")
+	s.Router.HandleFunc("/verify-email/resend", middlewares.SetMiddlewareJSON(s.AuthLimiter.Middleware(s.ResendEmailVerification))).Methods("POST")
+	s.Router.HandleFunc("/verify-phone", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.VerifyPhone))).Methods("POST")
+	s.Router.HandleFunc("/verify-phone/send", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.SendPhoneCode))).Methods("POST")
 
 	// Login Route
-	s.Router.HandleFunc("/login", middlewares.SetMiddlewareJSON(s.Login)).Methods("POST")
+	s.Router.HandleFunc("/login", middlewares.SetMiddlewareJSON(s.AuthLimiter.Middleware(s.Login))).Methods("POST")
+	s.Router.HandleFunc("/passkeys/login/begin", middlewares.SetMiddlewareJSON(s.AuthLimiter.Middleware(s.BeginPasskeyLogin))).Methods("POST")
+	s.Router.HandleFunc("/passkeys/login/finish", middlewares.SetMiddlewareJSON(s.AuthLimiter.Middleware(s.FinishPasskeyLogin))).Methods("POST")
+	s.Router.HandleFunc("/passkeys/register/begin", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.BeginPasskeyRegistration))).Methods("POST")
+	s.Router.HandleFunc("/passkeys/register/finish", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.FinishPasskeyRegistration))).Methods("POST")
+	s.Router.HandleFunc("/users/me/sessions", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.GetSessions))).Methods("GET")
+	s.Router.HandleFunc("/users/me/sessions/{id}", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.DeleteSession))).Methods("DELETE")
+	s.Router.HandleFunc("/users/me/passkeys", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.GetPasskeys))).Methods("GET")
+	s.Router.HandleFunc("/users/me/passkeys/{id}", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.DeletePasskey))).Methods("DELETE")
+	s.Router.HandleFunc("/auth/google", middlewares.SetMiddlewareJSON(s.AuthLimiter.Middleware(s.GoogleSignIn))).Methods("POST")
+	s.Router.HandleFunc("/logout", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.Logout))).Methods("POST")
+	s.Router.HandleFunc("/auth/link", middlewares.SetMiddlewareJSON(s.AuthLimiter.Middleware(s.LinkIdentity))).Methods("POST")
+
+	//Two factor and account recovery routes
+	s.Router.HandleFunc("/users/me/2fa", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.EnrollTwoFactor))).Methods("POST")
+	s.Router.HandleFunc("/users/me/2fa/confirm", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.ConfirmTwoFactor))).Methods("POST")
+	s.Router.HandleFunc("/users/me/2fa/recovery-codes", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.RegenerateRecoveryCodes))).Methods("POST")
+	s.Router.HandleFunc("/account/recover", middlewares.SetMiddlewareJSON(s.AuthLimiter.Middleware(s.RecoverAccount))).Methods("POST")
+	s.Router.HandleFunc("/forgot-password", middlewares.SetMiddlewareJSON(s.AuthLimiter.Middleware(s.ForgotPassword))).Methods("POST")
+	s.Router.HandleFunc("/reset-password", middlewares.SetMiddlewareJSON(s.AuthLimiter.Middleware(s.ResetPassword))).Methods("POST")
+	s.Router.HandleFunc("/account/revert", middlewares.SetMiddlewareJSON(s.ConfirmSecurityChangeRevert)).Methods("GET")
+	s.Router.HandleFunc("/account/revert", middlewares.SetMiddlewareJSON(s.RevertSecurityChange)).Methods("POST")
+
+	//Address autocomplete
+	s.Router.HandleFunc("/places/suggest", middlewares.SetMiddlewareJSON(s.PlacesLimiter.Middleware(s.SuggestPlaces))).Methods("GET")
+	s.Router.HandleFunc("/places/plus-code", middlewares.SetMiddlewareJSON(s.ConvertPlusCode)).Methods("GET")
 
 	//Upload profile pic
-	s.Router.HandleFunc("/profile", middlewares.SetMiddlewareJSON(UploadProfilePic)).Methods("POST")
+	s.Router.HandleFunc("/profile", middlewares.SetMiddlewareJSON(s.UploadProfilePic)).Methods("POST")
+	s.Router.HandleFunc("/profile/upload-url", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.PresignProfilePicUpload))).Methods("POST")
+	s.Router.HandleFunc("/profile/upload-complete", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.CompleteProfilePicUpload))).Methods("POST")
 
 	//Users routes
-	s.Router.HandleFunc("/users", middlewares.SetMiddlewareJSON(s.GetUsers)).Methods("GET")
+	s.Router.HandleFunc("/users/me", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.DeleteMe))).Methods("DELETE")
+	s.Router.HandleFunc("/users/me/password", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.ChangePassword))).Methods("PUT")
+	s.Router.HandleFunc("/users/availability", middlewares.SetMiddlewareJSON(s.AvailabilityLimiter.Middleware(s.CheckAvailability))).Methods("GET")
 	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareJSON(s.GetUser)).Methods("GET")
-	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateUser))).Methods("PUT")
-	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteUser)).Methods("DELETE")
+	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.UpdateUser))).Methods("PUT")
+	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.PatchUser))).Methods("PATCH")
+	s.Router.HandleFunc("/users/{id}/password", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.ChangePassword))).Methods("PUT")
+	s.Router.HandleFunc("/users/{id}", middlewares.Authenticate(s.DeleteUser)).Methods("DELETE")
+
+	//Marketing consent routes
+	s.Router.HandleFunc("/users/me/marketing-consent", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.GetMarketingConsent))).Methods("GET")
+	s.Router.HandleFunc("/users/me/marketing-consent", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.UpdateMarketingConsent))).Methods("PUT")
+
+	//Provider identity check routes
+	s.Router.HandleFunc("/users/me/kyc", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.GetProviderVerification))).Methods("GET")
+	s.Router.HandleFunc("/users/me/kyc", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.SubmitProviderVerification))).Methods("POST")
+
+	//Data export routes
+	s.Router.HandleFunc("/users/me/export", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.RequestDataExport))).Methods("POST")
+	s.Router.HandleFunc("/users/me/exports", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.GetDataExports))).Methods("GET")
+	s.Router.HandleFunc("/exports/download", middlewares.SetMiddlewareJSON(s.AuthLimiter.Middleware(s.DownloadDataExport))).Methods("POST")
+
+	//Device routes
+	s.Router.HandleFunc("/users/me/devices", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.RegisterDevice))).Methods("POST")
+	s.Router.HandleFunc("/users/me/devices", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.GetDevices))).Methods("GET")
+	s.Router.HandleFunc("/users/me/devices/{id}", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.DeleteDevice))).Methods("DELETE")
+
+	//Dispute routes
+	s.Router.HandleFunc("/disputes/{id}", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.GetDispute))).Methods("GET")
+	s.Router.HandleFunc("/disputes/{id}/evidence", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.UploadDisputeEvidence))).Methods("POST")
+
+	//Payment routes
+	s.Router.HandleFunc("/users/me/payout", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.SavePayoutDetails))).Methods("PUT")
+	s.Router.HandleFunc("/users/me/payout", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.GetPayoutDetails))).Methods("GET")
+	s.Router.HandleFunc("/users/me/payout", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.DeletePayoutDetails))).Methods("DELETE")
+	s.Router.HandleFunc("/payments/webhooks/{gateway}", middlewares.SetMiddlewareJSON(s.PaymentWebhook)).Methods("POST")
+	s.Router.HandleFunc("/email/webhooks/{provider}", middlewares.SetMiddlewareJSON(s.EmailWebhook)).Methods("POST")
+	s.Router.HandleFunc("/sms/webhooks/{provider}", middlewares.SetMiddlewareJSON(s.SMSWebhook)).Methods("POST")
+
+	//Notification routes
+	s.Router.HandleFunc("/users/me/notifications", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.GetNotifications))).Methods("GET")
+	s.Router.HandleFunc("/users/me/notifications/{id}/read", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.MarkNotificationRead))).Methods("PUT")
+
+	//Calendar routes
+	s.Router.HandleFunc("/users/me/calendar-feed", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.RotateCalendarFeed))).Methods("POST")
+	s.Router.HandleFunc("/users/me/calendar-feed", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.DeleteCalendarFeed))).Methods("DELETE")
+	s.Router.HandleFunc("/calendar/{id}/bookings.ics", s.GetCalendarFeed).Methods("GET")
+
+	//Gallery routes
+	s.Router.HandleFunc("/users/me/gallery", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.UploadGalleryItem))).Methods("POST")
+	s.Router.HandleFunc("/users/me/gallery/order", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.ReorderGallery))).Methods("PUT")
+	s.Router.HandleFunc("/users/me/gallery/{id}", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.UpdateGalleryItem))).Methods("PUT")
+	s.Router.HandleFunc("/users/me/gallery/{id}", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.DeleteGalleryItem))).Methods("DELETE")
+	s.Router.HandleFunc("/users/{id}/gallery", middlewares.SetMiddlewareJSON(s.GetUserGallery)).Methods("GET")
+
+	//Resumable uploads of gallery photos and dispute evidence
+	s.Router.HandleFunc("/uploads", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.StartUpload))).Methods("POST")
+	s.Router.HandleFunc("/uploads/{id}", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.GetUpload))).Methods("GET")
+	s.Router.HandleFunc("/uploads/{id}", middlewares.Authenticate(s.CancelUpload)).Methods("DELETE")
+	s.Router.HandleFunc("/uploads/{id}/parts/{number}", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.UploadPart))).Methods("PUT")
+	s.Router.HandleFunc("/uploads/{id}/complete", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.CompleteUpload))).Methods("POST")
+
+	//Service routes
+	s.Router.HandleFunc("/users/me/services", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.CreateServiceOffering))).Methods("POST")
+	s.Router.HandleFunc("/users/me/services/{id}", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.UpdateServiceOffering))).Methods("PUT")
+	s.Router.HandleFunc("/users/me/services/{id}", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.DeleteServiceOffering))).Methods("DELETE")
+	s.Router.HandleFunc("/users/{id}/services", middlewares.SetMiddlewareJSON(s.GetUserServiceOfferings)).Methods("GET")
+
+	//Availability and onboarding routes
+	s.Router.HandleFunc("/users/me/availability", middlewares.SetMiddlewareJSON(middlewares.RequireRole(auth.RoleProvider)(s.SetAvailability))).Methods("PUT")
+	s.Router.HandleFunc("/users/{id}/availability", middlewares.SetMiddlewareJSON(s.GetAvailability)).Methods("GET")
+	s.Router.HandleFunc("/users/me/onboarding", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.GetOnboarding))).Methods("GET")
+
+	//Statistics routes
+	s.Router.HandleFunc("/stats/public", middlewares.SetMiddlewareJSON(s.GetPublicStats)).Methods("GET")
+
+	//Provider routes
+	s.Router.HandleFunc("/providers/search", middlewares.SetMiddlewareJSON(s.SearchProviders)).Methods("GET")
+	s.Router.HandleFunc("/providers/{id}/vcard", s.GetProviderVCard).Methods("GET")
+
+	//Deep link routes
+	s.Router.HandleFunc("/links", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.CreateDeepLink))).Methods("POST")
+	s.Router.HandleFunc("/links/open", middlewares.SetMiddlewareJSON(s.OpenSignedLink)).Methods("GET")
+	s.Router.HandleFunc("/l/{code}", middlewares.SetMiddlewareJSON(s.OpenShortLink)).Methods("GET")
 
 	//Upload profile pic
-	s.Router.HandleFunc("/postpic", middlewares.SetMiddlewareJSON(UploadPostPic)).Methods("POST")
+	s.Router.HandleFunc("/postpic", middlewares.SetMiddlewareJSON(s.UploadPostPic)).Methods("POST")
 
 	//Post routes
 	s.Router.HandleFunc("/posts", middlewares.SetMiddlewareJSON(s.CreatePost)).Methods("POST")
 	s.Router.HandleFunc("/posts", middlewares.SetMiddlewareJSON(s.GetPosts)).Methods("GET")
 	s.Router.HandleFunc("/post/{id}", middlewares.SetMiddlewareJSON(s.GetPost)).Methods("GET")
-	s.Router.HandleFunc("/post/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdatePost))).Methods("PUT")
-	s.Router.HandleFunc("/posts/{id}", middlewares.SetMiddlewareAuthentication(s.DeletePost)).Methods("DELETE")
+	s.Router.HandleFunc("/post/{id}", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.UpdatePost))).Methods("PUT")
+	s.Router.HandleFunc("/posts/{id}", middlewares.Authenticate(s.DeletePost)).Methods("DELETE")
 
 	s.Router.HandleFunc("/posts/user/{id}", middlewares.SetMiddlewareJSON(s.GetUserPosts)).Methods("GET")
 
@@ -41,6 +187,14 @@ func (s *Server) initializeRoutes() {
 	s.Router.HandleFunc("/booking", middlewares.SetMiddlewareJSON(s.MakeBooking)).Methods("POST")
 	s.Router.HandleFunc("/booking", middlewares.SetMiddlewareJSON(s.GetBookings)).Methods("GET")
 	s.Router.HandleFunc("/booking/{id}", middlewares.SetMiddlewareJSON(s.UpdateBooking)).Methods("PUT")
+	s.Router.HandleFunc("/booking/{id}/quotes", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.SubmitQuote))).Methods("POST")
+	s.Router.HandleFunc("/booking/{id}/quotes", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.GetBookingQuotes))).Methods("GET")
+	s.Router.HandleFunc("/booking/{id}/payments", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.CreateBookingPayment))).Methods("POST")
+	s.Router.HandleFunc("/booking/{id}/complete", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.CompleteBooking))).Methods("PUT")
+	s.Router.HandleFunc("/booking/{id}/disputes", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.OpenDispute))).Methods("POST")
+	s.Router.HandleFunc("/booking/{id}/location", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.GetBookingLocation))).Methods("GET")
+	s.Router.HandleFunc("/booking/{id}/location/ws", middlewares.Authenticate(s.TrackBooking)).Methods("GET")
+	s.Router.HandleFunc("/booking/{id}/quotes/{quote_id}", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.RespondToQuote))).Methods("PUT")
 
 	//Work routes
 	s.Router.HandleFunc("/work", middlewares.SetMiddlewareJSON(s.CreateWork)).Methods("POST")
@@ -51,13 +205,62 @@ func (s *Server) initializeRoutes() {
 	//Review routes
 	s.Router.HandleFunc("/review", middlewares.SetMiddlewareJSON(s.GetReviews)).Methods("GET")
 	s.Router.HandleFunc("/review/{id}", middlewares.SetMiddlewareJSON(s.GetUserReviews)).Methods("GET")
+	s.Router.HandleFunc("/review/{id}/history", middlewares.SetMiddlewareJSON(s.GetReviewHistory)).Methods("GET")
 	s.Router.HandleFunc("/review", middlewares.SetMiddlewareJSON(s.CreateReview)).Methods("POST")
-	s.Router.HandleFunc("/review/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateReview))).Methods("PUT")
-	s.Router.HandleFunc("/review/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteReview)).Methods("DELETE")
+	s.Router.HandleFunc("/review/{id}", middlewares.SetMiddlewareJSON(middlewares.Authenticate(s.UpdateReview))).Methods("PUT")
+	s.Router.HandleFunc("/review/{id}", middlewares.Authenticate(s.DeleteReview)).Methods("DELETE")
 
 	//Transaction routes
 	s.Router.HandleFunc("/transactions", middlewares.SetMiddlewareJSON(s.CreateTransaction)).Methods("POST")
 	s.Router.HandleFunc("/transactions", middlewares.SetMiddlewareJSON(s.GetTransactions)).Methods("GET")
 	s.Router.HandleFunc("/transaction/{id}", middlewares.SetMiddlewareJSON(s.GetTransaction)).Methods("GET")
 	s.Router.HandleFunc("/transaction/user/{id}", middlewares.SetMiddlewareJSON(s.GetUserTransactions)).Methods("GET")
+
+	//Admin routes, for logged in admins only. Changes to accounts are kept in the audit history.
+	admin := s.Router.PathPrefix("/admin").Subrouter()
+	admin.Use(middlewares.RequireRoleHandler(auth.RoleAdmin))
+	admin.HandleFunc("/users", middlewares.SetMiddlewareJSON(s.GetUsers)).Methods("GET")
+	admin.HandleFunc("/users/{id}/ban", middlewares.SetMiddlewareJSON(s.BanUser)).Methods("POST")
+	admin.HandleFunc("/users/{id}/ban", middlewares.SetMiddlewareJSON(s.UnbanUser)).Methods("DELETE")
+	admin.HandleFunc("/users/{id}/lock", middlewares.SetMiddlewareJSON(s.UnlockUser)).Methods("DELETE")
+	admin.HandleFunc("/users/{id}/password-reset", middlewares.SetMiddlewareJSON(s.ForcePasswordReset)).Methods("POST")
+	admin.HandleFunc("/users/{id}/verify", middlewares.SetMiddlewareJSON(s.VerifyUser)).Methods("POST")
+	admin.HandleFunc("/users/{id}/restore", middlewares.SetMiddlewareJSON(s.RestoreUser)).Methods("POST")
+	admin.HandleFunc("/audit", middlewares.SetMiddlewareJSON(s.GetAdminActions)).Methods("GET")
+	admin.HandleFunc("/maintenance", middlewares.SetMiddlewareJSON(s.GetMaintenance)).Methods("GET")
+	admin.HandleFunc("/config/reload", middlewares.SetMiddlewareJSON(s.ReloadConfigEndpoint)).Methods("POST")
+	admin.HandleFunc("/log-level", middlewares.SetMiddlewareJSON(s.GetLogLevel)).Methods("GET")
+	admin.HandleFunc("/log-level", middlewares.SetMiddlewareJSON(s.SetLogLevel)).Methods("PUT")
+	admin.HandleFunc("/log-level", middlewares.SetMiddlewareJSON(s.ResetLogLevel)).Methods("DELETE")
+	admin.HandleFunc("/self-check", middlewares.SetMiddlewareJSON(s.GetSelfCheck)).Methods("GET")
+	admin.HandleFunc("/self-check", middlewares.SetMiddlewareJSON(s.RunSelfCheck)).Methods("POST")
+	admin.HandleFunc("/metrics", s.GetMetrics).Methods("GET")
+	admin.HandleFunc("/maintenance", middlewares.SetMiddlewareJSON(s.SetMaintenance)).Methods("PUT")
+	admin.HandleFunc("/reviews/held", middlewares.SetMiddlewareJSON(s.GetHeldReviews)).Methods("GET")
+	admin.HandleFunc("/reviews/{id}", middlewares.SetMiddlewareJSON(s.ModerateReview)).Methods("PUT")
+	admin.HandleFunc("/kyc", middlewares.SetMiddlewareJSON(s.GetProviderVerifications)).Methods("GET")
+	admin.HandleFunc("/kyc/{id}", middlewares.SetMiddlewareJSON(s.ReviewProviderVerification)).Methods("PUT")
+	admin.HandleFunc("/disputes", middlewares.SetMiddlewareJSON(s.GetOpenDisputes)).Methods("GET")
+	admin.HandleFunc("/disputes/{id}", middlewares.SetMiddlewareJSON(s.GetDisputeAdmin)).Methods("GET")
+	admin.HandleFunc("/disputes/{id}", middlewares.SetMiddlewareJSON(s.ResolveDispute)).Methods("PUT")
+	admin.HandleFunc("/risk/queue", middlewares.SetMiddlewareJSON(s.GetRiskReviewQueue)).Methods("GET")
+	admin.HandleFunc("/risk/users/{id}", middlewares.SetMiddlewareJSON(s.DecideRiskReview)).Methods("PUT")
+	admin.HandleFunc("/geo-backfill", middlewares.SetMiddlewareJSON(s.StartGeoBackfill)).Methods("POST")
+	admin.HandleFunc("/geo-backfill", middlewares.SetMiddlewareJSON(s.GetGeoBackfill)).Methods("GET")
+	admin.HandleFunc("/media/reconcile", middlewares.SetMiddlewareJSON(s.StartMediaReconcile)).Methods("POST")
+	admin.HandleFunc("/media/reconcile", middlewares.SetMiddlewareJSON(s.GetMediaReconcile)).Methods("GET")
+	admin.HandleFunc("/storage", middlewares.SetMiddlewareJSON(s.GetStorageUsage)).Methods("GET")
+	admin.HandleFunc("/users/{id}/storage", middlewares.SetMiddlewareJSON(s.GetUserStorage)).Methods("GET")
+	admin.HandleFunc("/users/delete", middlewares.SetMiddlewareJSON(s.BulkDeleteUsers)).Methods("POST")
+	admin.HandleFunc("/users/suspend", middlewares.SetMiddlewareJSON(s.BulkSuspendUsers)).Methods("POST")
+	admin.HandleFunc("/users/{id}/role", middlewares.SetMiddlewareJSON(s.SetUserRole)).Methods("PUT")
+	admin.HandleFunc("/users/{id}/email-status", middlewares.SetMiddlewareJSON(s.ClearEmailStatus)).Methods("DELETE")
+	admin.HandleFunc("/emails", middlewares.SetMiddlewareJSON(s.GetOutboundEmails)).Methods("GET")
+	admin.HandleFunc("/emails/suppressions", middlewares.SetMiddlewareJSON(s.GetEmailSuppressions)).Methods("GET")
+	admin.HandleFunc("/emails/suppressions", middlewares.SetMiddlewareJSON(s.AddEmailSuppression)).Methods("POST")
+	admin.HandleFunc("/emails/suppressions", middlewares.SetMiddlewareJSON(s.RemoveEmailSuppression)).Methods("DELETE")
+	admin.HandleFunc("/announcements", middlewares.SetMiddlewareJSON(s.CreateAnnouncement)).Methods("POST")
+	admin.HandleFunc("/announcements", middlewares.SetMiddlewareJSON(s.GetAnnouncements)).Methods("GET")
+	admin.HandleFunc("/templates/missing", middlewares.SetMiddlewareJSON(s.GetMissingTranslations)).Methods("GET")
+	admin.HandleFunc("/users/merge", middlewares.SetMiddlewareJSON(s.MergeUsers)).Methods("POST")
 }
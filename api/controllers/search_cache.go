@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/geo"
+	"github.com/victorkabata/FixIt-API/api/models"
+)
+
+//Cached searches are dropped by tiles of this many degrees. Each tile has a generation in its key, bumped
+//when a provider whose service area reaches the tile changes, and the old entries are left to expire.
+const searchTileDegrees = 0.5
+
+func searchTile(degrees float64) int {
+	return int(math.Floor(degrees / searchTileDegrees))
+}
+
+//Key of the generation of the tile holding the point
+func searchTileKey(latitude, longitude float64) string {
+	if longitude >= 180 {
+		longitude -= 360
+	}
+	return searchTileKeyAt(searchTile(latitude), searchTile(longitude))
+}
+
+func searchTileKeyAt(row, column int) string {
+	return "search:tile:" + strconv.Itoa(row) + ":" + strconv.Itoa(column)
+}
+
+//Keys of the generations of every tile the box reaches into
+func searchTileKeys(box geo.Box) []string {
+	columns := [][2]int{{searchTile(box.MinLongitude), searchTile(box.MaxLongitude)}}
+	if box.CrossesAntimeridian() {
+		columns = [][2]int{{searchTile(box.MinLongitude), searchTile(180) - 1}, {searchTile(-180), searchTile(box.MaxLongitude)}}
+	}
+	keys := []string{}
+	for row := searchTile(box.MinLatitude); row <= searchTile(box.MaxLatitude); row++ {
+		for _, span := range columns {
+			for column := span[0]; column <= span[1]; column++ {
+				keys = append(keys, searchTileKeyAt(row, column))
+			}
+		}
+	}
+	return keys
+}
+
+//How long nearby search results are cached, SEARCH_CACHE_TTL, 30s by default and 0 to turn it off
+func searchCacheTTL() time.Duration {
+	configured := os.Getenv("SEARCH_CACHE_TTL")
+	if configured == "" {
+		return 30 * time.Second
+	}
+	ttl, err := time.ParseDuration(configured)
+	if err != nil || ttl < 0 {
+		return 30 * time.Second
+	}
+	return ttl
+}
+
+//Decimal places nearby searches round the searcher's coordinates to, SEARCH_CACHE_PRECISION from 1 to 4,
+//2 by default which is about a kilometre
+func searchCachePrecision() int {
+	precision, err := strconv.Atoi(os.Getenv("SEARCH_CACHE_PRECISION"))
+	if err != nil || precision < 1 || precision > 4 {
+		return 2
+	}
+	return precision
+}
+
+//Moves the searcher to the corner of their grid cell, so everyone searching from the cell shares results
+func snapSearchPoint(filter *models.ProviderFilter) {
+	scale := math.Pow(10, float64(searchCachePrecision()))
+	filter.Latitude = math.Round(filter.Latitude*scale) / scale
+	filter.Longitude = math.Round(filter.Longitude*scale) / scale
+}
+
+//Key of the search's results, the same filters in any order give the same key
+func searchCacheKey(generation string, filter models.ProviderFilter) string {
+	parts := []string{
+		strings.ToLower(filter.Specialisation),
+		strings.ToLower(filter.Region),
+		strconv.FormatFloat(filter.MaxPrice, 'f', -1, 64),
+		strconv.FormatFloat(filter.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(filter.Longitude, 'f', -1, 64),
+		strconv.FormatFloat(filter.RadiusKm, 'f', -1, 64),
+		strings.Join(filter.Languages, ","),
+	}
+	//Languages and metadata filters come sorted
+	for _, metadata := range filter.Metadata {
+		part := metadata.Key + "=" + metadata.Value
+		if metadata.Min != nil {
+			part += fmt.Sprintf(">%v", *metadata.Min)
+		}
+		if metadata.Max != nil {
+			part += fmt.Sprintf("<%v", *metadata.Max)
+		}
+		parts = append(parts, part)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return "search:" + generation + ":" + hex.EncodeToString(sum[:16])
+}
+
+//Current generation of the cached searches from the tile of the snapped search point, failures are logged
+//and searched without the cache
+func (server *Server) searchGeneration(ctx context.Context, filter models.ProviderFilter) (string, bool) {
+	generation, found, err := server.SearchCache.Get(ctx, searchTileKey(filter.Latitude, filter.Longitude))
+	if err != nil {
+		log.Printf("Reading the search cache failed: %v", err)
+		return "", false
+	}
+	if !found {
+		return "0", true
+	}
+	return string(generation), true
+}
+
+//Drops the cached searches the users show up in after a change to what searches return, such as a profile
+//or a rating. Users who moved are passed before and after, so the searches from both places are dropped.
+func (server *Server) invalidateSearches(ctx context.Context, users ...*models.User) {
+	if server.SearchCache == nil || len(users) == 0 {
+		return
+	}
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, user := range users {
+		for _, key := range searchTileKeys(user.ServiceArea()) {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	err := server.SearchCache.Incr(ctx, keys...)
+	if err != nil {
+		log.Printf("Invalidating the search cache failed: %v", err)
+	}
+}
+
+//The users by ID as invalidateSearches takes them. Read before deleting users for good, failures are
+//logged and their searches expire on their own.
+func (server *Server) searchAreas(ctx context.Context, uids ...uint32) []*models.User {
+	if server.SearchCache == nil {
+		return nil
+	}
+	users, err := models.FindServiceAreas(ctx, server.DB, uids)
+	if err != nil {
+		log.Printf("Reading the service areas of users %v failed: %v", uids, err)
+		return nil
+	}
+	areas := make([]*models.User, len(users))
+	for i := range users {
+		areas[i] = &users[i]
+	}
+	return areas
+}
+
+//Drops the cached searches the users show up in, by ID
+func (server *Server) invalidateSearchesOf(ctx context.Context, uids ...uint32) {
+	server.invalidateSearches(ctx, server.searchAreas(ctx, uids...)...)
+}
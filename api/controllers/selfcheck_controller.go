@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/logger"
+	"github.com/victorkabata/FixIt-API/api/mailer"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/selfcheck"
+	"github.com/victorkabata/FixIt-API/api/storage"
+	"github.com/victorkabata/FixIt-API/api/utils/encryption"
+)
+
+//Checklist run at startup and from the admin endpoint
+func (server *Server) selfChecks() []selfcheck.Check {
+	return []selfcheck.Check{
+		{Name: "config", Run: checkConfig},
+		{Name: "database", Run: func(ctx context.Context) (string, error) {
+			return "Ping", server.DB.DB().PingContext(ctx)
+		}},
+		{Name: "migrations", Run: server.checkMigrations},
+		{Name: "storage", Run: checkStorage},
+		{Name: "mailer", Run: func(ctx context.Context) (string, error) {
+			configured, err := mailer.Ping(ctx)
+			if !configured {
+				return "SMTP_HOST not set, emails are only logged", selfcheck.ErrSkipped
+			}
+			return "SMTP greeting from " + os.Getenv("SMTP_HOST"), err
+		}},
+	}
+}
+
+//Settings the API can't work without, and optional ones that are set but invalid
+func checkConfig(ctx context.Context) (string, error) {
+	missing := []string{}
+	for _, name := range []string{"API_SECRET", "DB_DRIVER", "DB_HOST", "DB_NAME", "DB_USER"} {
+		if os.Getenv(name) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("Missing %s", strings.Join(missing, ", "))
+	}
+
+	err := storage.S3ConfigFromEnv().Validate()
+	if err != nil {
+		return "", err
+	}
+
+	notes := []string{}
+	if os.Getenv("DATA_ENCRYPTION_KEY") == "" {
+		notes = append(notes, "DATA_ENCRYPTION_KEY not set, payout details and backups are unavailable")
+	} else if _, err := encryption.Encrypt([]byte("selfcheck")); err != nil {
+		return "", err
+	}
+	if os.Getenv("ADMIN_API_KEY") == "" {
+		notes = append(notes, "ADMIN_API_KEY not set, admin routes are closed")
+	}
+	return strings.Join(notes, "; "), nil
+}
+
+//Tables and columns the models need are in place
+func (server *Server) checkMigrations(ctx context.Context) (string, error) {
+	drifts, err := database.CheckSchema(server.DB, models.Tables())
+	if err != nil {
+		return "", err
+	}
+
+	broken := []string{}
+	for _, drift := range drifts {
+		if drift.Breaks {
+			broken = append(broken, drift.String())
+		}
+	}
+	if len(broken) > 0 {
+		return "", errors.New(strings.Join(broken, "; "))
+	}
+	return fmt.Sprintf("%d tables match the models", len(models.Tables())), nil
+}
+
+//Writes and removes a canary object to prove the upload bucket is writable
+func checkStorage(ctx context.Context) (string, error) {
+	if os.Getenv("AWS_SECRET_ID") == "" {
+		return "AWS_SECRET_ID not set, uploads are unavailable", selfcheck.ErrSkipped
+	}
+
+	s, err := newAWSSession()
+	if err != nil {
+		return "", err
+	}
+	client := s3.New(s)
+	uploadBucket := storage.S3Settings().Bucket
+	key := fmt.Sprintf("selfcheck/canary-%d", time.Now().UnixNano())
+
+	_, err = client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(uploadBucket),
+		Key:    aws.String(key),
+		ACL:    aws.String("private"),
+		Body:   bytes.NewReader([]byte("ok")),
+	})
+	if err != nil {
+		return "", err
+	}
+	_, err = client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(uploadBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	return "Wrote and removed s3://" + uploadBucket + "/" + key, nil
+}
+
+//Runs the checklist and logs every result
+func (server *Server) runSelfCheck(ctx context.Context) selfcheck.Report {
+	report := server.SelfCheck.Run(ctx)
+	for _, result := range report.Results {
+		fields := logger.Fields{"check": result.Name, "status": result.Status, "detail": result.Detail, "duration_ms": result.DurationMs}
+		if result.Status == selfcheck.StatusFailed {
+			fields["error"] = result.Error
+			logger.Error("Self check failed", fields)
+			continue
+		}
+		logger.Info("Self check", fields)
+	}
+	return report
+}
+
+//Endpoint to get the last self check report
+func (server *Server) GetSelfCheck(w http.ResponseWriter, r *http.Request) {
+	report := server.SelfCheck.Last()
+	if report == nil {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Self Check Hasn't Run Yet"))
+		return
+	}
+	responses.JSON(w, http.StatusOK, report)
+}
+
+//Endpoint to run the self check again
+func (server *Server) RunSelfCheck(w http.ResponseWriter, r *http.Request) {
+	report := server.runSelfCheck(r.Context())
+	status := http.StatusOK
+	if !report.OK {
+		status = http.StatusServiceUnavailable
+	}
+	responses.JSON(w, status, report)
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/cache"
+	"github.com/victorkabata/FixIt-API/api/middlewares"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Tokens whose session was written lately, by this instance
+var sessionTouches = cache.New()
+
+//Records the session of a valid token, at most once per SessionTouchInterval
+func (server *Server) sessionSeen(r *http.Request, claims *auth.Claims) {
+	key := claims.RevocationKey()
+	if _, ok := sessionTouches.Get(key); ok {
+		return
+	}
+	sessionTouches.Set(key, true, models.SessionTouchInterval)
+
+	err := models.TouchSession(r.Context(), server.DB, models.Session{
+		UserID:     claims.UserID,
+		TokenKey:   key,
+		UserAgent:  r.UserAgent(),
+		IP:         middlewares.ClientIP(r),
+		IssuedAt:   time.Unix(claims.IssuedAt, 0),
+		ExpiresAt:  claims.Expiry(),
+		LastSeenAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Recording the session of user %d failed: %v", claims.UserID, err)
+	}
+}
+
+//Endpoint listing where the current user is logged in
+func (server *Server) GetSessions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	sessions, err := models.FindSessions(r.Context(), server.DB, claims.UserID, time.Now())
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	for i := range *sessions {
+		(*sessions)[i].Current = (*sessions)[i].TokenKey == claims.RevocationKey()
+	}
+	responses.JSON(w, http.StatusOK, sessions)
+}
+
+//Endpoint to log out one of the current user's devices
+func (server *Server) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	err = models.RevokeSession(r.Context(), server.DB, uid, id)
+	if err != nil && err.Error() == "Session Not Found" {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, map[string]string{"message": "Session Revoked"})
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/sms"
+)
+
+//Endpoint receiving replies and delivery reports of the SMS provider. Replying STOP stops texting the number
+//and START resumes it, codes that couldn't be delivered are marked so the owner can ask for another at once.
+func (server *Server) SMSWebhook(w http.ResponseWriter, r *http.Request) {
+	source, err := sms.GetEventSource(mux.Vars(r)["provider"])
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	events, err := source.ParseWebhook(r, body)
+	if err == sms.ErrInvalidSignature {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	for _, event := range events {
+		if event.Type == sms.EventFailed {
+			marked, err := models.MarkPhoneCodeUndelivered(r.Context(), server.DB, event.Phone, event.Reason)
+			if err != nil {
+				responses.ERROR(w, http.StatusInternalServerError, err)
+				return
+			}
+			if marked > 0 {
+				log.Printf("Code to %s was not delivered by %s: %s", event.Phone, source.Name(), event.Reason)
+			}
+			continue
+		}
+
+		//Other replies are nothing we act on
+		keyword := sms.Keyword(event.Text)
+		if keyword == "" {
+			continue
+		}
+		changed, err := models.SetSMSOptOut(r.Context(), server.DB, event.Phone, keyword == sms.KeywordStop)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+		if changed > 0 {
+			log.Printf("%s replied %s through %s, updated %d users", event.Phone, keyword, source.Name(), changed)
+		}
+	}
+	responses.JSON(w, http.StatusOK, map[string]string{"message": "Received"})
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/cache"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+const publicStatsTTL = 15 * time.Minute
+
+var statsCache = cache.New()
+
+//Endpoint returning public provider statistics, cached heavily
+func (server *Server) GetPublicStats(w http.ResponseWriter, r *http.Request) {
+	stats, ok := statsCache.Get("public")
+	if !ok {
+		freshStats, err := models.FindPublicStats(r.Context(), server.DB)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+		statsCache.Set("public", freshStats, publicStatsTTL)
+		stats = freshStats
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(publicStatsTTL.Seconds())))
+	responses.JSON(w, http.StatusOK, stats)
+}
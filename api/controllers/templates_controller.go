@@ -0,0 +1,17 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/templates"
+)
+
+//Endpoint for admins to list the templates each locale has no translation of, those fall back to a more general locale
+func (server *Server) GetMissingTranslations(w http.ResponseWriter, r *http.Request) {
+	responses.JSON(w, http.StatusOK, map[string]interface{}{
+		"default_locale": templates.DefaultLocale,
+		"locales":        templates.Locales(),
+		"missing":        templates.Missing(),
+	})
+}
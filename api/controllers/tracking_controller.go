@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/geo"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/tracking"
+)
+
+const (
+	trackingPingInterval = 30 * time.Second
+	trackingWriteTimeout = 10 * time.Second
+	//How often open connections check that their booking is still confirmed, for changes no one ended the tracking of
+	trackingStatusInterval = time.Minute
+)
+
+//Mobile apps connect directly, so the origin isn't checked. Access is limited by the booking participants instead.
+var trackingUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+//Loads an accepted booking and reports whether the current user is its provider
+func (server *Server) findTrackedBooking(r *http.Request) (*models.Booking, bool, int, error) {
+	vars := mux.Vars(r)
+	bid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		return nil, false, http.StatusBadRequest, err
+	}
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		return nil, false, http.StatusUnauthorized, errors.New("Unauthorized")
+	}
+
+	booking, customerID, err := models.BookingParties(r.Context(), server.DB, uint32(bid))
+	if err != nil {
+		return nil, false, http.StatusNotFound, err
+	}
+	if uid != booking.UserID && uid != customerID {
+		return nil, false, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden))
+	}
+	if booking.Status != models.BookingConfirmed {
+		return nil, false, http.StatusConflict, errors.New("Booking Is Not Active")
+	}
+	return booking, uid == booking.UserID, http.StatusOK, nil
+}
+
+//Endpoint to get the last known location of the provider of an active booking
+func (server *Server) GetBookingLocation(w http.ResponseWriter, r *http.Request) {
+	booking, _, status, err := server.findTrackedBooking(r)
+	if err != nil {
+		responses.ERROR(w, status, err)
+		return
+	}
+
+	location, ok, err := server.Tracking.Last(r.Context(), booking.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if !ok {
+		responses.ERROR(w, http.StatusNotFound, errors.New("No Location Yet"))
+		return
+	}
+	responses.JSON(w, http.StatusOK, location)
+}
+
+//WebSocket endpoint of an active booking. The provider sends its location and the customer receives every update.
+func (server *Server) TrackBooking(w http.ResponseWriter, r *http.Request) {
+	booking, isProvider, status, err := server.findTrackedBooking(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		responses.ERROR(w, status, err)
+		return
+	}
+
+	conn, err := trackingUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go server.watchTrackedBooking(conn, booking.ID, done)
+
+	if isProvider {
+		server.receiveLocations(conn, booking.ID)
+	} else {
+		server.sendLocations(conn, booking.ID)
+	}
+}
+
+//Lets go of everyone tracking a booking that is no longer confirmed, on every instance
+func (server *Server) endTracking(ctx context.Context, bid uint32) {
+	err := server.Tracking.End(ctx, bid)
+	if err != nil {
+		log.Printf("Ending the tracking of booking %d failed: %v", bid, err)
+	}
+}
+
+//Closes the connection once the booking is no longer confirmed, checking until done is closed
+func (server *Server) watchTrackedBooking(conn *websocket.Conn, bid uint32, done <-chan struct{}) {
+	check := time.NewTicker(trackingStatusInterval)
+	defer check.Stop()
+	for {
+		select {
+		case <-check.C:
+			booking, _, err := models.BookingParties(context.Background(), server.DB, bid)
+			if err != nil && !gorm.IsRecordNotFoundError(err) {
+				log.Printf("Checking the status of tracked booking %d failed: %v", bid, err)
+				continue
+			}
+			if err == nil && booking.Status == models.BookingConfirmed {
+				continue
+			}
+			closeTracking(conn)
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+//Tells the other side the booking is no longer tracked and closes the connection
+func closeTracking(conn *websocket.Conn) {
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Booking Is Not Active")
+	conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(trackingWriteTimeout))
+	conn.Close()
+}
+
+//Reads location updates from the provider's connection until it closes
+func (server *Server) receiveLocations(conn *websocket.Conn, bid uint32) {
+	//Only followed to close the connection when the tracking ends
+	updates, unsubscribe, err := server.Tracking.Subscribe(context.Background(), bid)
+	if err == nil {
+		defer unsubscribe()
+		go func() {
+			for range updates {
+			}
+			closeTracking(conn)
+		}()
+	}
+
+	for {
+		location := tracking.Location{}
+		err := conn.ReadJSON(&location)
+		if err != nil {
+			return
+		}
+		if geo.Validate(location.Latitude, location.Longitude) != nil {
+			continue
+		}
+
+		location.BookingID = bid
+		location.UpdatedAt = time.Now()
+		err = server.Tracking.Publish(context.Background(), location)
+		if err != nil {
+			log.Printf("Publishing the location of booking %d failed: %v", bid, err)
+		}
+	}
+}
+
+//Writes location updates to the customer's connection until either side goes away
+func (server *Server) sendLocations(conn *websocket.Conn, bid uint32) {
+	updates, unsubscribe, err := server.Tracking.Subscribe(context.Background(), bid)
+	if err != nil {
+		log.Printf("Following the locations of booking %d failed: %v", bid, err)
+		return
+	}
+	defer unsubscribe()
+
+	//Reading is only needed to notice the customer closing the connection
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if location, ok, _ := server.Tracking.Last(context.Background(), bid); ok {
+		conn.SetWriteDeadline(time.Now().Add(trackingWriteTimeout))
+		if conn.WriteJSON(location) != nil {
+			return
+		}
+	}
+
+	ping := time.NewTicker(trackingPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case location, ok := <-updates:
+			if !ok {
+				closeTracking(conn)
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(trackingWriteTimeout))
+			if conn.WriteJSON(location) != nil {
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(trackingWriteTimeout))
+			if conn.WriteMessage(websocket.PingMessage, nil) != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -48,7 +48,7 @@ func (server *Server) CreateTransaction(w http.ResponseWriter, r *http.Request)
 		responses.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
 		return
 	}
-	transactionCreated, err := transaction.UploadTransaction(server.DB)
+	transactionCreated, err := transaction.UploadTransaction(r.Context(), server.DB)
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
 		responses.ERROR(w, http.StatusInternalServerError, formattedError)
@@ -63,7 +63,7 @@ func (server *Server) GetTransactions(w http.ResponseWriter, r *http.Request) {
 
 	transaction := models.Transaction{}
 
-	transactions, err := transaction.FindAllTransactions(server.DB)
+	transactions, err := transaction.FindAllTransactions(r.Context(), server.DB)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -84,7 +84,7 @@ func (server *Server) GetTransaction(w http.ResponseWriter, r *http.Request) {
 
 	transaction := models.Transaction{}
 
-	transactionReceived, err := transaction.FindTransactionByID(server.DB, pid)
+	transactionReceived, err := transaction.FindTransactionByID(r.Context(), server.DB, pid)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -103,7 +103,7 @@ func (server *Server) GetUserTransactions(w http.ResponseWriter, r *http.Request
 	}
 	transaction := models.Transaction{}
 
-	userTransactions, err := transaction.FindTransactionByUserID(server.DB, pid)
+	userTransactions, err := transaction.FindTransactionByUserID(r.Context(), server.DB, pid)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
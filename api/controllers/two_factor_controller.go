@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/victorkabata/FixIt-API/api/alerts"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Endpoint to start two factor enrollment for the current user
+func (server *Server) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	user := models.User{}
+	userFound, err := user.FindUserByID(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if userFound.TwoFactorEnabled {
+		responses.ERROR(w, http.StatusConflict, errors.New("Two Factor Already Enabled"))
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = user.UpdateTwoFactor(r.Context(), server.DB, uid, secret, false)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]string{
+		"secret":      secret,
+		"otpauth_url": auth.TOTPURL(secret, userFound.Email),
+	}
+	responses.JSON(w, http.StatusOK, response)
+}
+
+//Endpoint to confirm two factor enrollment with a first code, returning the recovery codes
+func (server *Server) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	uid, userFound, ok := server.verifyTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+	if userFound.TwoFactorEnabled {
+		responses.ERROR(w, http.StatusConflict, errors.New("Two Factor Already Enabled"))
+		return
+	}
+
+	err := userFound.UpdateTwoFactor(r.Context(), server.DB, uid, userFound.TwoFactorSecret, true)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.sendRecoveryCodes(w, r, uid)
+}
+
+//Endpoint to replace the current user's recovery codes
+func (server *Server) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	uid, userFound, ok := server.verifyTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+	if !userFound.TwoFactorEnabled {
+		responses.ERROR(w, http.StatusConflict, errors.New("Two Factor Not Enabled"))
+		return
+	}
+
+	server.sendRecoveryCodes(w, r, uid)
+}
+
+//Endpoint to recover an account with a recovery code after losing both password and second factor
+func (server *Server) RecoverAccount(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		Email        string `json:"email"`
+		RecoveryCode string `json:"recovery_code"`
+		NewPassword  string `json:"new_password"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if request.Email == "" || request.RecoveryCode == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Email And Recovery Code"))
+		return
+	}
+	if request.NewPassword == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Password"))
+		return
+	}
+
+	//Checked before the recovery code, which is used up once it is right, and before looking up the
+	//account so the answer doesn't tell whether the email has one
+	err = models.ValidatePassword(r.Context(), request.NewPassword, &models.User{Email: request.Email})
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	user := models.User{}
+	userFound, err := user.FindUserByEmail(r.Context(), server.DB, request.Email)
+	if err != nil || !userFound.TwoFactorEnabled {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Invalid Recovery Code"))
+		return
+	}
+
+	err = models.VerifyTwoFactor(r.Context(), server.DB, userFound.ID, "", request.RecoveryCode, true)
+	recordAuthCheck(alerts.OTP, err, models.ErrInvalidTwoFactorCode)
+	if tooManyAttempts(w, err) {
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Invalid Recovery Code"))
+		return
+	}
+
+	//The second factor is lost, so it is switched off and has to be enrolled again
+	err = user.UpdatePassword(r.Context(), server.DB, userFound.ID, request.NewPassword)
+	if err == nil {
+		err = user.UpdateTwoFactor(r.Context(), server.DB, userFound.ID, "", false)
+	}
+	if err == nil {
+		err = models.DeleteRecoveryCodes(r.Context(), server.DB, userFound.ID)
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	userFound.TwoFactorEnabled = false
+	server.loadProfile(r.Context(), userFound)
+	responses.JSON(w, http.StatusOK, responses.PrepareResponse(userFound))
+}
+
+//Reads the code in the request body and checks it against the current user's secret
+func (server *Server) verifyTwoFactorCode(w http.ResponseWriter, r *http.Request) (uint32, *models.User, bool) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return 0, nil, false
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return 0, nil, false
+	}
+
+	request := struct {
+		Code string `json:"code"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return 0, nil, false
+	}
+
+	user := models.User{}
+	userFound, err := user.FindUserByID(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return 0, nil, false
+	}
+	if userFound.TwoFactorSecret == "" {
+		responses.ERROR(w, http.StatusConflict, errors.New("Two Factor Enrollment Not Started"))
+		return 0, nil, false
+	}
+	err = models.VerifyTwoFactor(r.Context(), server.DB, uid, userFound.TwoFactorSecret, request.Code, false)
+	recordAuthCheck(alerts.OTP, err, models.ErrInvalidTwoFactorCode)
+	if tooManyAttempts(w, err) {
+		return 0, nil, false
+	}
+	if err == models.ErrInvalidTwoFactorCode {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Invalid Code"))
+		return 0, nil, false
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return 0, nil, false
+	}
+	return uid, userFound, true
+}
+
+//Generates new recovery codes, as JSON or as a text file when ?download=true
+func (server *Server) sendRecoveryCodes(w http.ResponseWriter, r *http.Request, uid uint32) {
+	codes, err := models.GenerateRecoveryCodes(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if r.URL.Query().Get("download") == "true" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"fixit-recovery-codes.txt\"")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "FixIt recovery codes. Each code can only be used once.\r\n\r\n%s\r\n", strings.Join(codes, "\r\n"))
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":        "Store these recovery codes somewhere safe. Each code can only be used once.",
+		"recovery_codes": codes,
+	}
+	responses.JSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/victorkabata/FixIt-API/api/imaging"
+	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/storage"
+)
+
+//Largest image that can be processed, such as a profile picture uploaded straight to the bucket
+const maxImageSize = int64(imaging.MaxBytes)
+
+//Uploads beyond this are kept in temporary files while the request is read instead of in memory
+const multipartMemory = 1 << 20
+
+//Largest multipart upload in bytes from MAX_UPLOAD_SIZE, 10MB by default
+func maxUploadSize() int64 {
+	size, err := strconv.ParseInt(os.Getenv("MAX_UPLOAD_SIZE"), 10, 64)
+	if err != nil || size <= 0 {
+		return 10 << 20
+	}
+	return size
+}
+
+var allowedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+//Reads the "upload" file of a multipart request, rejecting files that are too large or aren't images.
+//The caller has to close the returned file.
+func readImageUpload(w http.ResponseWriter, r *http.Request) (multipart.File, *multipart.FileHeader, bool) {
+	maxSize := maxUploadSize()
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+(1<<20))
+
+	err := r.ParseMultipartForm(multipartMemory)
+	if err != nil {
+		responses.ERROR(w, http.StatusRequestEntityTooLarge, errors.New("File too large"))
+		return nil, nil, false
+	}
+
+	file, fileHeader, err := r.FormFile("upload")
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return nil, nil, false
+	}
+
+	if fileHeader.Size > maxSize {
+		file.Close()
+		responses.ERROR(w, http.StatusRequestEntityTooLarge, errors.New("File too large"))
+		return nil, nil, false
+	}
+
+	//Sniff the content instead of trusting the extension or the client's content type
+	head := make([]byte, 512)
+	n, _ := file.Read(head)
+	_, err = file.Seek(0, 0)
+	if err != nil {
+		file.Close()
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return nil, nil, false
+	}
+	if !allowedImageTypes[http.DetectContentType(head[:n])] {
+		file.Close()
+		responses.ERROR(w, http.StatusUnsupportedMediaType, errors.New("Only JPEG, PNG, GIF and WebP images are allowed"))
+		return nil, nil, false
+	}
+
+	return file, fileHeader, true
+}
+
+//Status of an upload that failed to be processed or stored, the client's fault unless storing it failed
+func uploadErrorStatus(err error) int {
+	switch err {
+	case imaging.ErrTooLarge, storage.ErrTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case imaging.ErrUnsupportedType:
+		return http.StatusUnsupportedMediaType
+	case imaging.ErrInvalidImage:
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+//Creates an AWS session in the configured region with the credentials from the environment
+func newAWSSession() (*session.Session, error) {
+	return storage.NewAWSSession(storage.S3Settings())
+}
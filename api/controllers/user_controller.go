@@ -1,21 +1,28 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
-	"os"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/gorilla/mux"
 	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/metrics"
+	"github.com/victorkabata/FixIt-API/api/middlewares"
 	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/notifications"
 	"github.com/victorkabata/FixIt-API/api/responses"
+	"github.com/victorkabata/FixIt-API/api/risk"
+	"github.com/victorkabata/FixIt-API/api/templates"
 	"github.com/victorkabata/FixIt-API/api/utils/formaterror"
 )
 
@@ -26,44 +33,180 @@ func (server *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 	}
 
-	user := models.User{}
-	err = json.Unmarshal(body, &user)
+	//The password is never serialized with the user, it is read on its own
+	input := struct {
+		models.User
+		Password string `json:"password"`
+	}{}
+	err = json.Unmarshal(body, &input)
 	if err != nil {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
+	user := input.User
+	user.Password = input.Password
 
+	if user.Locale == "" {
+		user.Locale = templates.FromAcceptLanguage(r.Header.Get("Accept-Language"))
+	}
 	user.Prepare()
 	err = user.Validate("")
 	if err != nil {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
+	server.register(w, r, &user, nil)
+}
+
+//Tells signup forms whether the username, email and phone number in the query are still free, e.g.
+//{"username": true, "email": false}. Registration still checks, a detail can be taken in between.
+func (server *Server) CheckAvailability(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	available, err := models.CheckAvailability(r.Context(), server.DB, query.Get("username"), query.Get("email"), query.Get("phone"))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, available)
+}
+
+//Creates the validated user shared by the registration flows. Providers signing up with an identity
+//document have it stored for review, providers without one submit it later.
+func (server *Server) register(w http.ResponseWriter, r *http.Request, user *models.User, verification *models.ProviderVerification) {
+	err := models.CheckPasswordBreach(r.Context(), user.Password)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if verification != nil {
+		registered, err := models.DocumentRegistered(r.Context(), server.DB, 0, verification.DocumentHash)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+		if registered {
+			responses.ERROR(w, http.StatusConflict, models.ErrDocumentRegistered)
+			return
+		}
+	}
+
+	signal := risk.Signal{Action: risk.Register, Email: user.Email, Phone: user.PhoneNumber(), IP: middlewares.ClientIP(r)}
+	assessment := server.Risk.Assess(r.Context(), signal)
 
-	userCreated, err := user.SaveUser(server.DB)
+	userCreated, err := user.SaveUser(r.Context(), server.DB)
+	if duplicate, ok := err.(*models.DuplicateUserError); ok {
+		responses.ERROR(w, http.StatusConflict, duplicate)
+		return
+	}
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
 		responses.ERROR(w, http.StatusInternalServerError, formattedError)
 		return
 	}
+	metrics.Registrations.WithLabelValues("password").Inc()
+	server.pictureChanged(r.Context(), nil, userCreated)
 
 	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, userCreated.ID))
 
+	//Someone registering the same document meanwhile leaves the provider pending without one, they can submit another
+	if verification != nil {
+		verification.UserID = userCreated.ID
+		_, err = verification.SubmitProviderVerification(r.Context(), server.DB)
+		if err != nil {
+			log.Printf("Saving the identity document of user %d failed: %v", userCreated.ID, err)
+		}
+	}
+
+	err = models.SaveRiskAssessment(r.Context(), server.DB, userCreated.ID, signal, assessment)
+	if err != nil {
+		log.Printf("Saving register risk assessment of user %d failed: %v", userCreated.ID, err)
+	}
+
+	err = server.sendEmailVerification(r.Context(), userCreated)
+	if err != nil {
+		log.Printf("Sending the verification email of user %d failed: %v", userCreated.ID, err)
+	}
+
+	//Risky sign ups get no token, they either confirm a code at first login or wait for a review
+	switch assessment.Decision {
+	case risk.Review:
+		err = models.SetRiskStatus(r.Context(), server.DB, userCreated.ID, models.RiskReview)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+		responses.JSON(w, http.StatusAccepted, map[string]interface{}{"message": "Account Under Review", "user_id": userCreated.ID})
+		return
+	case risk.Verify:
+		err = models.SetRiskStatus(r.Context(), server.DB, userCreated.ID, models.RiskVerify)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+		responses.JSON(w, http.StatusCreated, map[string]interface{}{"message": "Verification Required", "user_id": userCreated.ID, "verification_required": true})
+		return
+	}
+
 	response := responses.PrepareResponse(userCreated)
 	responses.JSON(w, http.StatusCreated, response)
 }
 
-//Endpoint to get all users
+//Endpoint to get all users a page at a time, by ?page=&per_page= or by the ?cursor= of the previous page.
+//Filtered by ?specialisation=&region=&country=&role=&banned=true, searched with ?q= and ordered by ?sort=username,-created_at
 func (server *Server) GetUsers(w http.ResponseWriter, r *http.Request) {
 
 	user := models.User{}
 
-	users, err := user.FindAllUsers(server.DB)
+	query := r.URL.Query()
+	filter := models.UserQuery{
+		Specialisation: strings.TrimSpace(query.Get("specialisation")),
+		Region:         strings.TrimSpace(query.Get("region")),
+		Country:        strings.TrimSpace(query.Get("country")),
+		Role:           strings.TrimSpace(query.Get("role")),
+		Text:           strings.TrimSpace(query.Get("q")),
+		Banned:         query.Get("banned") == "true",
+	}
+	if filter.Role != "" && !auth.ValidRole(filter.Role) {
+		responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid Role"))
+		return
+	}
+	if utf8.RuneCountInString(filter.Text) > 100 {
+		responses.ERROR(w, http.StatusBadRequest, errors.New("Search Text Too Long"))
+		return
+	}
+	var err error
+	filter.Sort, err = models.ParseUserSort(query.Get("sort"))
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page := models.PageRequest{Cursor: query.Get("cursor")}
+	if value := query.Get("page"); value != "" {
+		page.Page, err = strconv.Atoi(value)
+		if err != nil || page.Page < 1 {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid Page"))
+			return
+		}
+	}
+	if value := query.Get("per_page"); value != "" {
+		page.PerPage, err = strconv.Atoi(value)
+		if err != nil || page.PerPage < 1 {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid Per Page"))
+			return
+		}
+	}
+
+	users, info, err := user.FindAllUsers(r.Context(), server.DB, filter, page)
+	if err == models.ErrInvalidCursor || err == models.ErrCursorWithSort {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, users)
+	responses.JSON(w, http.StatusOK, map[string]interface{}{"data": models.AdminUsers(*users), "pagination": info})
 }
 
 //Endpoint to get user based on the ID
@@ -76,11 +219,52 @@ func (server *Server) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	user := models.User{}
-	userGotten, err := user.FindUserByID(server.DB, uint32(uid))
+	userGotten, err := user.FindUserByID(r.Context(), server.DB, uint32(uid))
 	if err != nil {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
+
+	item := models.GalleryItem{}
+	gallery, err := item.FindUserGallery(r.Context(), server.DB, userGotten.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	userGotten.Gallery = *gallery
+
+	service := models.ServiceOffering{}
+	services, err := service.FindUserServiceOfferings(r.Context(), server.DB, userGotten.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	userGotten.Services = *services
+
+	err = userGotten.LoadReputation(r.Context(), server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	stats, err := models.FindProviderStats(r.Context(), server.DB, []uint32{userGotten.ID})
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	userGotten.Stats = stats[userGotten.ID]
+	err = userGotten.LoadProfile(r.Context(), server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	//Everyone else sees the location blurred
+	if auth.TokenValid(r) == nil {
+		if tokenID, err := auth.ExtractTokenID(r); err == nil && tokenID == userGotten.ID {
+			userGotten.ShowToOwner()
+		}
+	}
+
 	responses.JSON(w, http.StatusOK, userGotten)
 }
 
@@ -120,21 +304,312 @@ func (server *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	existing := models.User{}
+	previousUser, err := existing.FindUserByID(r.Context(), server.DB, uint32(uid))
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
 	user.Prepare()
+	//The required fields are those of the role the user has, updates don't change it
+	user.Role = previousUser.Role
 	err = user.Validate("update")
 	if err != nil {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	updatedUser, err := user.UpdateAUser(server.DB, uint32(uid))
+	updatedUser, err := user.UpdateAUser(r.Context(), server.DB, uint32(uid))
+	if duplicate, ok := err.(*models.DuplicateUserError); ok {
+		responses.ERROR(w, http.StatusConflict, duplicate)
+		return
+	}
 	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = server.userUpdated(r.Context(), previousUser, updatedUser, false)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.loadReputation(r.Context(), updatedUser)
+	response := responses.PrepareResponse(updatedUser)
+	responses.JSON(w, http.StatusOK, response)
+}
+
+//The reputation only adds to responses about the user themselves, so failing to load it is logged and left at zero
+func (server *Server) loadReputation(ctx context.Context, user *models.User) {
+	err := user.LoadReputation(ctx, server.DB)
+	if err != nil {
+		log.Printf("Loading the reputation of user %d failed: %v", user.ID, err)
+	}
+}
+
+//Same for the address and custom fields, which are left empty
+func (server *Server) loadProfile(ctx context.Context, user *models.User) {
+	err := user.LoadProfile(ctx, server.DB)
+	if err != nil {
+		log.Printf("Loading the profile of user %d failed: %v", user.ID, err)
+	}
+}
+
+//Endpoint to change only the fields sent, the password changes through ChangePassword
+func (server *Server) PatchUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	patch := map[string]json.RawMessage{}
+	err = json.Unmarshal(body, &patch)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	tokenID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if tokenID != uint32(uid) {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+		return
+	}
+
+	existing := models.User{}
+	previousUser, err := existing.FindUserByID(r.Context(), server.DB, uint32(uid))
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	//Required fields are checked on the whole profile
+	err = previousUser.LoadProfile(r.Context(), server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	user := *previousUser
+	err = user.ApplyPatch(patch)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = user.Validate("patch")
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	updatedUser, err := user.PatchAUser(r.Context(), server.DB, uint32(uid), patch)
+	if duplicate, ok := err.(*models.DuplicateUserError); ok {
+		responses.ERROR(w, http.StatusConflict, duplicate)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = server.userUpdated(r.Context(), previousUser, updatedUser, false)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
+	server.loadReputation(r.Context(), updatedUser)
+	responses.JSON(w, http.StatusOK, responses.PrepareResponse(updatedUser))
+}
 
+//Endpoint for the current user to change their password, logging out their other sessions.
+//Served at /users/me/password and /users/{id}/password with their own ID.
+func (server *Server) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if id, ok := mux.Vars(r)["id"]; ok && id != strconv.FormatUint(uint64(uid), 10) {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if request.CurrentPassword == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Current Password"))
+		return
+	}
+	if request.NewPassword == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Password"))
+		return
+	}
+
+	existing := models.User{}
+	previousUser, err := existing.FindUserByID(r.Context(), server.DB, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	updatedUser, err := models.ChangePassword(r.Context(), server.DB, uid, request.CurrentPassword, request.NewPassword)
+	if tooManyAttempts(w, err) {
+		return
+	}
+	if err == models.ErrIncorrectPassword {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+	if weak, ok := err.(*models.WeakPasswordError); ok {
+		responses.ERROR(w, http.StatusUnprocessableEntity, weak)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.notifySecurityChanges(r.Context(), previousUser, updatedUser, true)
+
+	//The token sent back replaces the ones revoked
+	server.loadProfile(r.Context(), updatedUser)
 	response := responses.PrepareResponse(updatedUser)
+	response["message"] = "Password changed, other devices were logged out"
+	responses.JSON(w, http.StatusOK, response)
+}
+
+//Follows up on a profile change, asking the owner to confirm security changes and a new email address
+func (server *Server) userUpdated(ctx context.Context, previousUser, updatedUser *models.User, passwordChanged bool) error {
+	server.notifySecurityChanges(ctx, previousUser, updatedUser, passwordChanged)
+	server.pictureChanged(ctx, previousUser, updatedUser)
+	server.invalidateSearches(ctx, previousUser, updatedUser)
+
+	//A new address has to be verified again, and whatever bounced was the old one
+	if previousUser.Email != updatedUser.Email {
+		err := models.SetEmailVerified(ctx, server.DB, updatedUser.ID, false)
+		if err == nil {
+			err = models.SetEmailStatus(ctx, server.DB, updatedUser.ID, models.EmailDeliverable)
+		}
+		if err != nil {
+			return err
+		}
+		updatedUser.Verified = false
+		updatedUser.EmailStatus = models.EmailDeliverable
+		err = server.sendEmailVerification(ctx, updatedUser)
+		if err != nil {
+			log.Printf("Sending the verification email of user %d failed: %v", updatedUser.ID, err)
+		}
+	}
+	//So does a new phone number, the owner asks for the code when they are ready
+	if previousUser.Phone != updatedUser.Phone {
+		err := models.SetPhoneVerified(ctx, server.DB, updatedUser.ID, false)
+		if err != nil {
+			return err
+		}
+		updatedUser.PhoneVerified = false
+	}
+	return nil
+}
+
+//Emails the previous address about email, phone and password changes with a link to revert them
+func (server *Server) notifySecurityChanges(ctx context.Context, previousUser, updatedUser *models.User, passwordChanged bool) {
+	changes := map[string]string{}
+	if previousUser.Email != updatedUser.Email {
+		changes["email"] = previousUser.Email
+	}
+	if previousUser.Phone != updatedUser.Phone {
+		changes["phone"] = previousUser.Phone
+	}
+	if passwordChanged {
+		changes["password"] = previousUser.Password
+	}
+
+	for field, oldValue := range changes {
+		token, err := models.RecordSecurityChange(ctx, server.DB, previousUser.ID, field, oldValue)
+		if err != nil {
+			log.Printf("Recording %s change of user %d failed: %v", field, previousUser.ID, err)
+			continue
+		}
+
+		revertURL := models.AppBaseURL() + "/account/revert?token=" + url.QueryEscape(token)
+		//Sent to the previous address, in case the change was someone else taking over the account
+		err = notifications.Email(ctx, previousUser, "security_change", map[string]interface{}{
+			"Field": field,
+			"Hours": int(models.SecurityChangeRevertWindow.Hours()),
+			"URL":   revertURL,
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+//Endpoint the link in the notification email opens, it only describes the change. Mail scanners and link
+//previews open links too, so the change is undone by a POST to the same URL.
+func (server *Server) ConfirmSecurityChangeRevert(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		responses.ERROR(w, http.StatusBadRequest, errors.New("Required Token"))
+		return
+	}
+
+	change := models.SecurityChange{}
+	found, err := change.FindRevertableChange(r.Context(), server.DB, token)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"field":      found.Field,
+		"changed_at": found.CreatedAt,
+		"expires_at": found.ExpiresAt,
+		"message":    fmt.Sprintf("POST to this link to revert the %s change, the account will be locked until the password is reset", found.Field),
+	}
+	responses.JSON(w, http.StatusOK, response)
+}
+
+//Endpoint to undo an email, phone or password change from the link in the notification email
+func (server *Server) RevertSecurityChange(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		responses.ERROR(w, http.StatusBadRequest, errors.New("Required Token"))
+		return
+	}
+
+	change := models.SecurityChange{}
+	reverted, err := change.RevertSecurityChange(r.Context(), server.DB, token)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response := map[string]string{
+		"message": fmt.Sprintf("The %s change was reverted and the account is locked, reset the password to unlock it", reverted.Field),
+	}
 	responses.JSON(w, http.StatusOK, response)
 }
 
@@ -156,11 +631,17 @@ func (server *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 		return
 	}
-	if tokenID != 0 && tokenID != uint32(uid) {
+	role, err := auth.ExtractTokenRole(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	//Admins can delete any account
+	if tokenID != 0 && tokenID != uint32(uid) && role != auth.RoleAdmin {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 		return
 	}
-	_, err = user.DeleteAUser(server.DB, uint32(uid))
+	_, err = user.DeleteAUser(r.Context(), server.DB, uint32(uid))
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -170,50 +651,83 @@ func (server *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		"message": "Account Deleted",
 	}
 
+	server.invalidateSearchesOf(r.Context(), uint32(uid))
 	responses.JSON(w, http.StatusOK, response)
 }
 
-//Endpoint to upload user profile pic
-func UploadProfilePic(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	maxSize := int64(10 << 20) // allow only 10MB of file size
-
-	err := r.ParseMultipartForm(maxSize)
+//Endpoint for admins to bring back a deleted account within the grace period
+func (server *Server) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	uid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
 	if err != nil {
-		responses.ERROR(w, http.StatusRequestEntityTooLarge, errors.New("File too large"))
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	user, err := models.RestoreUser(r.Context(), server.DB, uint32(uid))
+	if err == models.ErrNotRestorable {
+		responses.ERROR(w, http.StatusNotFound, err)
 		return
 	}
-
-	file, fileHeader, err := r.FormFile("upload")
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	defer file.Close()
+	server.invalidateSearches(r.Context(), user)
+	responses.JSON(w, http.StatusOK, user.Admin())
+}
 
-	// create an AWS session
-	s, err := session.NewSession(&aws.Config{
-		Region: aws.String("us-east-2"),
-		Credentials: credentials.NewStaticCredentials(
-			os.Getenv("AWS_SECRET_ID"),  // Secrete id
-			os.Getenv("AWS_SECRET_KEY"), // secret key
-			""),
-	})
+//Endpoint for users to delete their own account after a grace period
+func (server *Server) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
 	if err != nil {
-		responses.ERROR(w, http.StatusInternalServerError, err)
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
 	}
 
-	fileName, err := models.UploadProfilePicToS3("profile", s, file, fileHeader)
+	deletionAt := time.Now().Add(models.AccountDeletionGrace())
+
+	user := models.User{}
+	err = user.ScheduleDeletion(r.Context(), server.DB, uid, deletionAt)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	imageURL := map[string]string{
-		"imageURL": fileName,
+	response := map[string]interface{}{
+		"message":               "Account scheduled for deletion. Log in again before then to cancel.",
+		"deletion_scheduled_at": deletionAt,
 	}
+	responses.JSON(w, http.StatusAccepted, response)
+}
 
-	responses.JSON(w, http.StatusCreated, imageURL)
+//Endpoint to upload user profile pic
+func (server *Server) UploadProfilePic(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	file, _, ok := readImageUpload(w, r)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	//The app sends the URLs back as the image_url, thumbnail_url and medium_url of the user
+	picture, err := models.UploadProfilePic(r.Context(), server.DB, server.Storage, uploaderID(r), "profile", file)
+	if err != nil {
+		responses.ERROR(w, uploadErrorStatus(err), err)
+		return
+	}
+
+	responses.JSON(w, http.StatusCreated, picture)
+
+}
 
+//User uploading a file, 0 when it is picked before signing up
+func uploaderID(r *http.Request) uint32 {
+	if auth.TokenValid(r) != nil {
+		return 0
+	}
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		return 0
+	}
+	return uid
 }
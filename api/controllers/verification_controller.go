@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/notifications"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Emails the user a signed link that verifies their address
+func (server *Server) sendEmailVerification(ctx context.Context, user *models.User) error {
+	token := user.EmailVerificationToken(time.Now().Add(models.EmailVerificationLifetime))
+	verifyURL := models.AppBaseURL() + "/verify-email?token=" + url.QueryEscape(token)
+
+	return notifications.Email(ctx, user, "email_verification", map[string]interface{}{
+		"Hours": int(models.EmailVerificationLifetime.Hours()),
+		"URL":   verifyURL,
+	})
+}
+
+//Endpoint to verify an email address from the link in the verification email
+func (server *Server) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		responses.ERROR(w, http.StatusBadRequest, errors.New("Required Token"))
+		return
+	}
+
+	user, err := models.VerifyEmail(r.Context(), server.DB, token)
+	if err == models.ErrInvalidVerificationLink || err == models.ErrVerificationLinkExpired {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, map[string]interface{}{"message": "Email Verified", "user_id": user.ID})
+}
+
+//Endpoint to send the verification email again, it answers the same whether or not the address has an account
+func (server *Server) ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		Email string `json:"email"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if strings.TrimSpace(request.Email) == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Email"))
+		return
+	}
+
+	user := models.User{}
+	userFound, err := user.FindUserByEmail(r.Context(), server.DB, html.EscapeString(strings.TrimSpace(request.Email)))
+	if err == nil && !userFound.Verified {
+		//Sent in the background so the answer takes as long for addresses without an account
+		go func() {
+			err := server.sendEmailVerification(context.Background(), userFound)
+			if err != nil {
+				log.Printf("Sending the verification email of user %d failed: %v", userFound.ID, err)
+			}
+		}()
+	}
+	responses.JSON(w, http.StatusAccepted, map[string]string{"message": "If the address needs verifying, a new link is on its way"})
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/database"
 	"github.com/victorkabata/FixIt-API/api/models"
 	"github.com/victorkabata/FixIt-API/api/responses"
 	"github.com/victorkabata/FixIt-API/api/utils/formaterror"
@@ -47,7 +48,7 @@ func (server *Server) CreateWork(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	workCreated, err := work.UploadWork(server.DB)
+	workCreated, err := work.UploadWork(r.Context(), server.DB)
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
 		responses.ERROR(w, http.StatusInternalServerError, formattedError)
@@ -67,7 +68,7 @@ func (server *Server) GetWork(w http.ResponseWriter, r *http.Request) {
 	}
 	work := models.Work{}
 
-	workReceived, err := work.FindWorkByID(server.DB, pid)
+	workReceived, err := work.FindWorkByID(r.Context(), server.DB, pid)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -88,7 +89,7 @@ func (server *Server) UpdateWork(w http.ResponseWriter, r *http.Request) {
 
 	// Check if the work exist
 	work := models.Work{}
-	err = server.DB.Debug().Model(models.Work{}).Where("id = ?", pid).Take(&work).Error
+	err = database.WithContext(r.Context(), server.DB).Debug().Model(models.Work{}).Where("id = ?", pid).Take(&work).Error
 	if err != nil {
 		responses.ERROR(w, http.StatusNotFound, errors.New("Work not found"))
 		return
@@ -120,7 +121,7 @@ func (server *Server) UpdateWork(w http.ResponseWriter, r *http.Request) {
 
 	workUpdate.ID = work.ID //this is important to tell the model the trbiew id to update, the other update field are set above
 
-	workUpdated, err := workUpdate.UpdateWork(server.DB)
+	workUpdated, err := workUpdate.UpdateWork(r.Context(), server.DB)
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
 		responses.ERROR(w, http.StatusInternalServerError, formattedError)
@@ -139,7 +140,7 @@ func (server *Server) GetUserWorks(w http.ResponseWriter, r *http.Request) {
 	}
 	work := models.Work{}
 
-	userWorks, err := work.FindUserWorks(server.DB, pid)
+	userWorks, err := work.FindUserWorks(r.Context(), server.DB, pid)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
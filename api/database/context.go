@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+)
+
+const contextKey = "fixit:context"
+
+//Attaches the request context to the db handle so queries see its cancellation. It is only checked
+//before a query starts, one already running is not interrupted.
+func WithContext(ctx context.Context, db *gorm.DB) *gorm.DB {
+	return db.Set(contextKey, ctx)
+}
+
+//Returns the context attached to a query, or the background context
+func Context(scope *gorm.Scope) context.Context {
+	if value, ok := scope.Get(contextKey); ok {
+		if ctx, ok := value.(context.Context); ok && ctx != nil {
+			return ctx
+		}
+	}
+	return context.Background()
+}
+
+//Stops queries from running once their request has been cancelled or timed out
+func RegisterCallbacks(db *gorm.DB) {
+	checkContext := func(scope *gorm.Scope) {
+		if err := Context(scope).Err(); err != nil {
+			scope.Err(err)
+		}
+	}
+
+	db.Callback().Create().Before("gorm:create").Register("context:create", checkContext)
+	db.Callback().Query().Before("gorm:query").Register("context:query", checkContext)
+	db.Callback().RowQuery().Before("gorm:row_query").Register("context:row_query", checkContext)
+	db.Callback().Update().Before("gorm:update").Register("context:update", checkContext)
+	db.Callback().Delete().Before("gorm:delete").Register("context:delete", checkContext)
+
+	//Writes refused by a unique index fail with a DuplicateKeyError whatever the driver
+	db.Callback().Create().After("gorm:create").Register("errors:create", translateErrors)
+	db.Callback().Update().After("gorm:update").Register("errors:update", translateErrors)
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+)
+
+//A row refused by a unique index. Column is the column of the index when it can be told from its name,
+//Key the name of the index as the driver gave it.
+type DuplicateKeyError struct {
+	Table  string
+	Column string
+	Key    string
+	Err    error
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DuplicateKeyError) Unwrap() error {
+	return e.Err
+}
+
+//Conflict on the column, e.g. Email Already Taken
+func (e *DuplicateKeyError) APIError() *apierror.Error {
+	if e.Column == "" {
+		return apierror.Duplicate("", "Already Exists")
+	}
+	words := strings.Split(e.Column, "_")
+	for i, word := range words {
+		if word == "id" || word == "url" {
+			words[i] = strings.ToUpper(word)
+		} else if word != "" {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return apierror.Duplicate(e.Column, strings.Join(words, " ")+" Already Taken")
+}
+
+//Recognises duplicate key errors of the MySQL driver, PostgreSQL drivers (lib/pq and pgx) and SQLite.
+//Errors already translated are returned as they are.
+func DuplicateKey(err error) (*DuplicateKeyError, bool) {
+	if err == nil {
+		return nil, false
+	}
+	var duplicate *DuplicateKeyError
+	if errors.As(err, &duplicate) {
+		return duplicate, true
+	}
+
+	var key string
+	var mysqlErr *mysql.MySQLError
+	var pgErr interface{ SQLState() string }
+	message := err.Error()
+	switch {
+	//Duplicate entry 'a@b.com' for key 'users.email', without the table before MySQL 8
+	case errors.As(err, &mysqlErr):
+		if mysqlErr.Number != 1062 {
+			return nil, false
+		}
+		if at := strings.LastIndex(mysqlErr.Message, " for key "); at >= 0 {
+			key = quoted(mysqlErr.Message[at:], "'")
+		}
+	//duplicate key value violates unique constraint "users_email_key"
+	case errors.As(err, &pgErr) && pgErr.SQLState() == "23505",
+		strings.Contains(message, "duplicate key value violates unique constraint"):
+		key = quoted(message, `"`)
+	//UNIQUE constraint failed: users.email
+	case strings.Contains(message, "UNIQUE constraint failed: "):
+		key = message[strings.Index(message, "UNIQUE constraint failed: ")+len("UNIQUE constraint failed: "):]
+		key = strings.TrimSpace(strings.Split(key, ",")[0])
+	default:
+		return nil, false
+	}
+
+	duplicate = &DuplicateKeyError{Key: key, Err: err}
+	if dot := strings.LastIndex(key, "."); dot >= 0 {
+		duplicate.Table, key = key[:dot], key[dot+1:]
+	}
+	duplicate.Column = columnOf(key, duplicate.Table)
+	return duplicate, true
+}
+
+//The first value between the quotes in the message
+func quoted(message, quote string) string {
+	start := strings.Index(message, quote)
+	if start < 0 {
+		return ""
+	}
+	end := strings.Index(message[start+1:], quote)
+	if end < 0 {
+		return ""
+	}
+	return message[start+1 : start+1+end]
+}
+
+//Column of a single column index by its name: the column itself for MySQL unique columns and SQLite,
+//uix_<table>_<column> for gorm's unique indexes and <table>_<column>_key for PostgreSQL's
+func columnOf(key, table string) string {
+	key = strings.TrimSuffix(key, "_key")
+	for _, prefix := range []string{"uix_", "idx_"} {
+		key = strings.TrimPrefix(key, prefix)
+	}
+	if table != "" {
+		key = strings.TrimPrefix(key, table+"_")
+	}
+	return key
+}
+
+//Replaces duplicate key errors of writes with a DuplicateKeyError naming the table
+func translateErrors(scope *gorm.Scope) {
+	duplicate, ok := DuplicateKey(scope.DB().Error)
+	if !ok {
+		return
+	}
+	if duplicate.Table == "" {
+		duplicate.Table = scope.TableName()
+		duplicate.Column = columnOf(duplicate.Key, duplicate.Table)
+	}
+	scope.DB().Error = duplicate
+}
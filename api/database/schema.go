@@ -0,0 +1,114 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+//Difference between a model and its live table
+type SchemaDrift struct {
+	Table   string
+	Column  string
+	Problem string
+	Breaks  bool //Queries on the table will fail, leftover columns usually don't matter
+}
+
+func (d SchemaDrift) String() string {
+	if d.Column == "" {
+		return d.Table + ": " + d.Problem
+	}
+	return d.Table + "." + d.Column + ": " + d.Problem
+}
+
+//What to do on drift at startup, SCHEMA_DRIFT in the environment: fail (default), warn or off
+func SchemaDriftMode() string {
+	switch mode := strings.ToLower(os.Getenv("SCHEMA_DRIFT")); mode {
+	case "warn", "off":
+		return mode
+	default:
+		return "fail"
+	}
+}
+
+//Broad family of a column type, types of different families can't hold each other's values
+func typeFamily(sqlType string) string {
+	sqlType = strings.ToLower(sqlType)
+	switch {
+	case strings.Contains(sqlType, "char"), strings.Contains(sqlType, "text"), strings.Contains(sqlType, "enum"):
+		return "text"
+	case strings.Contains(sqlType, "date"), strings.Contains(sqlType, "time"):
+		return "time"
+	case strings.Contains(sqlType, "int"), strings.Contains(sqlType, "bool"), strings.Contains(sqlType, "decimal"),
+		strings.Contains(sqlType, "float"), strings.Contains(sqlType, "double"), strings.Contains(sqlType, "numeric"):
+		return "number"
+	case strings.Contains(sqlType, "blob"), strings.Contains(sqlType, "binary"):
+		return "binary"
+	}
+	return ""
+}
+
+//Compares the live tables with the models and lists missing tables and columns,
+//columns holding another type of value and columns the models don't know about
+func CheckSchema(db *gorm.DB, models []interface{}) ([]SchemaDrift, error) {
+	drifts := []SchemaDrift{}
+
+	for _, model := range models {
+		scope := db.NewScope(model)
+		table := scope.TableName()
+
+		if !scope.Dialect().HasTable(table) {
+			drifts = append(drifts, SchemaDrift{Table: table, Problem: "table is missing", Breaks: true})
+			continue
+		}
+
+		rows, err := db.DB().Query("SELECT * FROM `" + table + "` LIMIT 0")
+		if err != nil {
+			return nil, err
+		}
+		columnTypes, err := rows.ColumnTypes()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		live := map[string]string{}
+		for _, column := range columnTypes {
+			live[column.Name()] = column.DatabaseTypeName()
+		}
+
+		expected := map[string]bool{}
+		for _, field := range scope.GetModelStruct().StructFields {
+			if !field.IsNormal || field.IsIgnored {
+				continue
+			}
+			expected[field.DBName] = true
+
+			liveType, ok := live[field.DBName]
+			if !ok {
+				drifts = append(drifts, SchemaDrift{Table: table, Column: field.DBName, Problem: "column is missing", Breaks: true})
+				continue
+			}
+
+			modelType := scope.Dialect().DataTypeOf(field)
+			if want, got := typeFamily(modelType), typeFamily(liveType); want != "" && got != "" && want != got {
+				drifts = append(drifts, SchemaDrift{Table: table, Column: field.DBName, Problem: fmt.Sprintf("expected %s, found %s", modelType, strings.ToLower(liveType)), Breaks: true})
+			}
+		}
+
+		extra := []string{}
+		for column := range live {
+			if !expected[column] {
+				extra = append(extra, column)
+			}
+		}
+		sort.Strings(extra)
+		for _, column := range extra {
+			drifts = append(drifts, SchemaDrift{Table: table, Column: column, Problem: "column is not in the model"})
+		}
+	}
+	return drifts, nil
+}
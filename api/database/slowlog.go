@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/victorkabata/FixIt-API/api/logger"
+)
+
+const (
+	startKey   = "fixit:query_start"
+	handlerKey = "fixit:handler"
+)
+
+//Duration of every query by operation, table and calling handler
+var queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "db_query_duration_seconds",
+	Help:    "Duration of database queries.",
+	Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+}, []string{"operation", "table", "handler"})
+
+func init() {
+	prometheus.MustRegister(queryDuration)
+}
+
+type handlerContextKey struct{}
+
+//Names the handler on the request context so queries can be traced back to it
+func WithHandler(ctx context.Context, handler string) context.Context {
+	return context.WithValue(ctx, handlerContextKey{}, handler)
+}
+
+//Handler named on the context, or "background" for jobs and commands
+func Handler(ctx context.Context) string {
+	if handler, ok := ctx.Value(handlerContextKey{}).(string); ok && handler != "" {
+		return handler
+	}
+	return "background"
+}
+
+//Current threshold of the slow query log in nanoseconds
+var slowQueryThreshold int64
+
+//Change the duration from which queries are logged
+func SetSlowQueryThreshold(threshold time.Duration) {
+	atomic.StoreInt64(&slowQueryThreshold, int64(threshold))
+}
+
+//Queries at least this slow are logged, SLOW_QUERY_THRESHOLD in the environment
+func SlowQueryThresholdFromEnv() time.Duration {
+	threshold, err := time.ParseDuration(os.Getenv("SLOW_QUERY_THRESHOLD"))
+	if err != nil || threshold <= 0 {
+		return 200 * time.Millisecond
+	}
+	return threshold
+}
+
+//Times every query into the histogram and logs the slow ones with their duration, rows and handler
+func RegisterSlowQueryLog(db *gorm.DB, threshold time.Duration) {
+	SetSlowQueryThreshold(threshold)
+
+	start := func(scope *gorm.Scope) {
+		scope.InstanceSet(startKey, time.Now())
+	}
+
+	finish := func(operation string) func(scope *gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			value, ok := scope.InstanceGet(startKey)
+			if !ok {
+				return
+			}
+			duration := time.Since(value.(time.Time))
+			handler := Handler(Context(scope))
+			table := scope.TableName()
+
+			queryDuration.WithLabelValues(operation, table, handler).Observe(duration.Seconds())
+
+			if duration < time.Duration(atomic.LoadInt64(&slowQueryThreshold)) {
+				return
+			}
+			fields := logger.Fields{
+				"operation":   operation,
+				"table":       table,
+				"handler":     handler,
+				"duration_ms": float64(duration.Microseconds()) / 1000,
+				"rows":        scope.DB().RowsAffected,
+				"sql":         strings.TrimSpace(scope.SQL),
+			}
+			if scope.HasError() {
+				fields["error"] = scope.DB().Error
+			}
+			logger.Warn("Slow query", fields)
+		}
+	}
+
+	db.Callback().Create().Before("gorm:create").Register("slowlog:start_create", start)
+	db.Callback().Create().After("gorm:create").Register("slowlog:create", finish("create"))
+	db.Callback().Query().Before("gorm:query").Register("slowlog:start_query", start)
+	db.Callback().Query().After("gorm:query").Register("slowlog:query", finish("query"))
+	db.Callback().RowQuery().Before("gorm:row_query").Register("slowlog:start_row_query", start)
+	db.Callback().RowQuery().After("gorm:row_query").Register("slowlog:row_query", finish("row_query"))
+	db.Callback().Update().Before("gorm:update").Register("slowlog:start_update", start)
+	db.Callback().Update().After("gorm:update").Register("slowlog:update", finish("update"))
+	db.Callback().Delete().Before("gorm:delete").Register("slowlog:start_delete", start)
+	db.Callback().Delete().After("gorm:delete").Register("slowlog:delete", finish("delete"))
+}
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"log"
+	"os"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/logger"
+)
+
+//Prints the statements of Debug() queries only while SQL logging is on, errors are always printed
+type sqlLogger struct {
+	gorm.Logger
+}
+
+func (l sqlLogger) Print(values ...interface{}) {
+	if len(values) > 0 && values[0] == "sql" && !logger.SQLEnabled() {
+		return
+	}
+	l.Logger.Print(values...)
+}
+
+//Routes the SQL log of the handle through the runtime SQL logging switch
+func RegisterSQLLogger(db *gorm.DB) {
+	db.SetLogger(sqlLogger{gorm.Logger{LogWriter: log.New(os.Stdout, "\r\n", 0)}})
+}
@@ -0,0 +1,133 @@
+package dependency
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/victorkabata/FixIt-API/api/fault"
+)
+
+//Outside services whose failures are typed
+const (
+	S3       = "s3"
+	GCS      = "gcs"
+	Email    = "email"
+	Geocoder = "geocoder"
+	Places   = "places"
+	SMS      = "sms"
+	Redis    = "redis"
+)
+
+//How a dependency failed, which decides whether to try again and what the client is told
+type Kind string
+
+const (
+	//Down, busy or too slow, the same call may work later
+	Retryable Kind = "retryable"
+	//Failed in a way trying again won't fix, such as bad credentials or a missing bucket
+	Permanent Kind = "permanent"
+	//Refused what it was sent, such as an address that doesn't take email
+	Rejected Kind = "rejected"
+)
+
+//Failures by dependency and kind
+var failures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "dependency_failures_total",
+	Help: "Failures of outside services by dependency and kind.",
+}, []string{"dependency", "kind"})
+
+func init() {
+	prometheus.MustRegister(failures)
+}
+
+//Failure of an outside service, the original error stays reachable with errors.Is and errors.As
+type Error struct {
+	Dependency string
+	Kind       Kind
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return e.Dependency + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+//Types a failure of the dependency and counts it
+func New(dependency string, kind Kind, err error) error {
+	failures.WithLabelValues(dependency, string(kind)).Inc()
+	return &Error{Dependency: dependency, Kind: kind, Err: err}
+}
+
+//Types a failure of the dependency by its error: network errors, deadlines and injected faults
+//are retryable, anything else is permanent. Nil stays nil and typed errors are returned as they are.
+func Wrap(dependency string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := As(err); ok {
+		return err
+	}
+	return New(dependency, classify(err), err)
+}
+
+func classify(err error) Kind {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return Retryable
+	case errors.Is(err, fault.ErrInjected):
+		return Retryable
+	case errors.As(err, &netErr):
+		return Retryable
+	}
+	return Permanent
+}
+
+//Types a failure by the HTTP status the dependency answered with. Throttling and server errors
+//are retryable, requests it couldn't process are rejected and the rest, like bad credentials, permanent.
+func FromStatus(dependency string, status int, err error) error {
+	kind := Permanent
+	switch {
+	case status == http.StatusTooManyRequests, status == http.StatusRequestTimeout, status >= 500:
+		kind = Retryable
+	case status == http.StatusBadRequest, status == http.StatusNotFound, status == http.StatusConflict,
+		status == http.StatusRequestEntityTooLarge, status == http.StatusUnprocessableEntity:
+		kind = Rejected
+	}
+	return New(dependency, kind, err)
+}
+
+//The typed failure in the error's chain, if any
+func As(err error) (*Error, bool) {
+	var typed *Error
+	ok := errors.As(err, &typed)
+	return typed, ok
+}
+
+//Whether the error is a failure of a dependency that may go away by trying again
+func IsRetryable(err error) bool {
+	typed, ok := As(err)
+	return ok && typed.Kind == Retryable
+}
+
+//Status to answer a failed dependency with: 503 while trying again may work, 502 when it won't
+//and 422 when it refused what the client sent. False for errors that aren't from a dependency.
+func Status(err error) (int, bool) {
+	typed, ok := As(err)
+	if !ok {
+		return 0, false
+	}
+	switch typed.Kind {
+	case Retryable:
+		return http.StatusServiceUnavailable, true
+	case Rejected:
+		return http.StatusUnprocessableEntity, true
+	}
+	return http.StatusBadGateway, true
+}
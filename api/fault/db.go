@@ -0,0 +1,20 @@
+package fault
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//Hooks fault injection into every create, query, update and delete made through gorm
+func RegisterDBCallbacks(db *gorm.DB) {
+	inject := func(scope *gorm.Scope) {
+		if err := Inject(database.Context(scope), DB); err != nil {
+			scope.Err(err)
+		}
+	}
+
+	db.Callback().Create().Before("gorm:create").Register("fault:create", inject)
+	db.Callback().Query().Before("gorm:query").Register("fault:query", inject)
+	db.Callback().Update().Before("gorm:update").Register("fault:update", inject)
+	db.Callback().Delete().Before("gorm:delete").Register("fault:delete", inject)
+}
@@ -0,0 +1,108 @@
+package fault
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Dependencies faults can be injected into
+const (
+	DB    = "db"
+	S3    = "s3"
+	Email = "email"
+)
+
+var ErrInjected = errors.New("Injected fault")
+
+//Latency and error rate injected into calls to a dependency
+type Config struct {
+	Delay     time.Duration
+	ErrorRate float64
+}
+
+type contextKey struct{}
+
+//Fault injection is only available when explicitly switched on and APP_ENV is development or test,
+//an unset APP_ENV counts as production
+func Enabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("FAULT_INJECTION"))
+	env := os.Getenv("APP_ENV")
+	return enabled && (env == "development" || env == "test")
+}
+
+//Reads the configured faults of a dependency, e.g. FAULT_DB_DELAY=200ms and FAULT_DB_ERROR_RATE=0.1
+func configFromEnv(target string) Config {
+	prefix := "FAULT_" + strings.ToUpper(target) + "_"
+
+	delay, _ := time.ParseDuration(os.Getenv(prefix + "DELAY"))
+	errorRate, _ := strconv.ParseFloat(os.Getenv(prefix+"ERROR_RATE"), 64)
+	return Config{Delay: delay, ErrorRate: errorRate}
+}
+
+//Reads per request faults from the X-Fault-Target, X-Fault-Delay and X-Fault-Error-Rate headers
+func configFromRequest(r *http.Request) map[string]Config {
+	targets := r.Header.Get("X-Fault-Target")
+	if targets == "" {
+		return nil
+	}
+
+	delay, _ := time.ParseDuration(r.Header.Get("X-Fault-Delay"))
+	errorRate, _ := strconv.ParseFloat(r.Header.Get("X-Fault-Error-Rate"), 64)
+
+	configs := map[string]Config{}
+	for _, target := range strings.Split(targets, ",") {
+		configs[strings.ToLower(strings.TrimSpace(target))] = Config{Delay: delay, ErrorRate: errorRate}
+	}
+	return configs
+}
+
+//Attaches the faults requested through headers to the request context
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		configs := configFromRequest(r)
+		if configs != nil {
+			r = r.WithContext(context.WithValue(r.Context(), contextKey{}, configs))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+//Delays and possibly fails a call to the target dependency.
+//Faults requested on the request take precedence over the environment configuration.
+func Inject(ctx context.Context, target string) error {
+	if !Enabled() {
+		return nil
+	}
+
+	config := configFromEnv(target)
+	if configs, ok := ctx.Value(contextKey{}).(map[string]Config); ok {
+		if requested, ok := configs[target]; ok {
+			config = requested
+		}
+	}
+
+	if config.Delay > 0 {
+		timer := time.NewTimer(config.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if config.ErrorRate > 0 && rand.Float64() < config.ErrorRate {
+		return ErrInjected
+	}
+	return nil
+}
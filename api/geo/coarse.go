@@ -0,0 +1,41 @@
+package geo
+
+import (
+	"hash/fnv"
+	"math"
+	"strconv"
+)
+
+//Kilometers per degree of latitude
+const kmPerDegree = math.Pi * EarthRadiusKm / 180
+
+//Hides a point within a grid cell about cellKm wide. The point is snapped to its cell and then moved
+//to a spot in the cell picked from the seed, so the same seed always lands on the same spot and
+//repeating the request reveals nothing more than the cell. A cellKm of 0 or less returns the point.
+func Coarsen(p Point, cellKm float64, seed uint64) Point {
+	if cellKm <= 0 {
+		return p
+	}
+
+	latStep := cellKm / kmPerDegree
+	latCell := math.Floor((p.Latitude + 90) / latStep)
+	latitude := -90 + (latCell+jitter(seed, 0))*latStep
+
+	//Cells get wider in degrees towards the poles, sized at the middle of the row so the whole row shares them
+	rowKm := kmPerDegree * math.Cos(radians(math.Min(math.Abs(-90+(latCell+0.5)*latStep), 89)))
+	lngStep := math.Min(cellKm/rowKm, 360)
+	lngCell := math.Floor((p.Longitude + 180) / lngStep)
+	longitude := -180 + (lngCell+jitter(seed, 1))*lngStep
+
+	return Point{
+		Latitude:  math.Max(math.Min(latitude, 90), -90),
+		Longitude: math.Max(math.Min(longitude, 180), -180),
+	}
+}
+
+//Offset in the cell between 0.1 and 0.9, kept off the edges so it can't fall into a neighbouring cell
+func jitter(seed uint64, axis int) float64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(strconv.FormatUint(seed, 10) + ":" + strconv.Itoa(axis)))
+	return 0.1 + 0.8*float64(hash.Sum64()%1000)/1000
+}
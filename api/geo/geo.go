@@ -0,0 +1,150 @@
+package geo
+
+import (
+	"errors"
+	"math"
+)
+
+//Mean radius of the earth in km
+const EarthRadiusKm = 6371.0088
+
+//WGS84 ellipsoid used by GPS
+const (
+	wgs84A = 6378.137              //Equatorial radius in km
+	wgs84F = 1 / 298.257223563     //Flattening
+	wgs84B = wgs84A * (1 - wgs84F) //Polar radius in km
+)
+
+var (
+	ErrInvalidLatitude  = errors.New("Invalid Latitude")
+	ErrInvalidLongitude = errors.New("Invalid Longitude")
+)
+
+//Coordinate in degrees
+type Point struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+//Checks the latitude is within ±90 and the longitude within ±180
+func Validate(latitude, longitude float64) error {
+	if math.IsNaN(latitude) || latitude < -90 || latitude > 90 {
+		return ErrInvalidLatitude
+	}
+	if math.IsNaN(longitude) || longitude < -180 || longitude > 180 {
+		return ErrInvalidLongitude
+	}
+	return nil
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
+
+//Great-circle distance in km on a spherical earth, off by up to 0.5% but cheap
+func HaversineKm(a, b Point) float64 {
+	dLat := radians(b.Latitude - a.Latitude)
+	dLng := radians(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(radians(a.Latitude))*math.Cos(radians(b.Latitude))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadiusKm * math.Asin(math.Sqrt(math.Min(1, h)))
+}
+
+//Distance in km on the WGS84 ellipsoid using Vincenty's formula, accurate to millimetres.
+//Nearly antipodal points where it doesn't converge fall back to the haversine distance.
+func GeodesicKm(a, b Point) float64 {
+	L := radians(b.Longitude - a.Longitude)
+	U1 := math.Atan((1 - wgs84F) * math.Tan(radians(a.Latitude)))
+	U2 := math.Atan((1 - wgs84F) * math.Tan(radians(b.Latitude)))
+	sinU1, cosU1 := math.Sincos(U1)
+	sinU2, cosU2 := math.Sincos(U2)
+
+	lambda := L
+	for i := 0; i < 200; i++ {
+		sinLambda, cosLambda := math.Sincos(lambda)
+		sinSigma := math.Sqrt(math.Pow(cosU2*sinLambda, 2) + math.Pow(cosU1*sinU2-sinU1*cosU2*cosLambda, 2))
+		if sinSigma == 0 {
+			return 0 //Same point
+		}
+		cosSigma := sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma := math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cos2Alpha := 1 - sinAlpha*sinAlpha
+		cos2SigmaM := 0.0
+		if cos2Alpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cos2Alpha //Zero on the equator
+		}
+		C := wgs84F / 16 * cos2Alpha * (4 + wgs84F*(4-3*cos2Alpha))
+		previous := lambda
+		lambda = L + (1-C)*wgs84F*sinAlpha*(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+
+		if math.Abs(lambda-previous) < 1e-12 {
+			u2 := cos2Alpha * (wgs84A*wgs84A - wgs84B*wgs84B) / (wgs84B * wgs84B)
+			A := 1 + u2/16384*(4096+u2*(-768+u2*(320-175*u2)))
+			B := u2 / 1024 * (256 + u2*(-128+u2*(74-47*u2)))
+			deltaSigma := B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+				B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+			return wgs84B * A * (sigma - deltaSigma)
+		}
+	}
+	return HaversineKm(a, b)
+}
+
+//Latitude and longitude range around a point, used to narrow searches before the exact distance
+type Box struct {
+	MinLatitude  float64 `json:"min_latitude"`
+	MaxLatitude  float64 `json:"max_latitude"`
+	MinLongitude float64 `json:"min_longitude"`
+	MaxLongitude float64 `json:"max_longitude"`
+}
+
+//Whether the box wraps around the 180th meridian, then MinLongitude is greater than MaxLongitude
+func (b Box) CrossesAntimeridian() bool {
+	return b.MinLongitude > b.MaxLongitude
+}
+
+func (b Box) Contains(p Point) bool {
+	if p.Latitude < b.MinLatitude || p.Latitude > b.MaxLatitude {
+		return false
+	}
+	if b.CrossesAntimeridian() {
+		return p.Longitude >= b.MinLongitude || p.Longitude <= b.MaxLongitude
+	}
+	return p.Longitude >= b.MinLongitude && p.Longitude <= b.MaxLongitude
+}
+
+//Smallest box holding every point within radiusKm of the center. Near the poles it spans all longitudes.
+func BoundingBox(center Point, radiusKm float64) Box {
+	angular := radiusKm / EarthRadiusKm
+	lat := radians(center.Latitude)
+	lng := radians(center.Longitude)
+
+	minLat, maxLat := lat-angular, lat+angular
+	if minLat <= -math.Pi/2 || maxLat >= math.Pi/2 {
+		return Box{
+			MinLatitude:  math.Max(degrees(minLat), -90),
+			MaxLatitude:  math.Min(degrees(maxLat), 90),
+			MinLongitude: -180,
+			MaxLongitude: 180,
+		}
+	}
+
+	deltaLng := math.Asin(math.Sin(angular) / math.Cos(lat))
+	minLng, maxLng := lng-deltaLng, lng+deltaLng
+	if minLng < -math.Pi {
+		minLng += 2 * math.Pi
+	}
+	if maxLng > math.Pi {
+		maxLng -= 2 * math.Pi
+	}
+	return Box{
+		MinLatitude:  degrees(minLat),
+		MaxLatitude:  degrees(maxLat),
+		MinLongitude: degrees(minLng),
+		MaxLongitude: degrees(maxLng),
+	}
+}
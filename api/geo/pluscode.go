@@ -0,0 +1,171 @@
+package geo
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+//Open Location Code (plus code) encoding, see https://github.com/google/open-location-code
+
+//Digits of the plus codes stored with addresses, a cell of about 3 by 3 meters
+const PlusCodeLength = 11
+
+const (
+	plusCodeAlphabet  = "23456789CFGHJMPQRVWX"
+	plusCodeSeparator = '+'
+	plusCodePadding   = '0'
+	plusSeparatorPos  = 8
+	plusPairLength    = 10
+	plusMaxLength     = 15
+	plusBase          = 20
+	plusGridRows      = 5
+	plusGridColumns   = 4
+	//Cells per degree after the pair digits and after all grid digits
+	plusPairPrecision     = 8000
+	plusFinalLatPrecision = plusPairPrecision * 3125 //plusGridRows^5
+	plusFinalLngPrecision = plusPairPrecision * 1024 //plusGridColumns^5
+)
+
+var (
+	ErrInvalidPlusCode = errors.New("Invalid Plus Code")
+	//Short codes like "9G8F+6X Zurich" need a reference location that isn't known here
+	ErrShortPlusCode = errors.New("Plus Code Must Include The Area Code")
+)
+
+//Plus code of the cell holding the point, length digits long (10 to 15)
+func EncodePlusCode(p Point, length int) string {
+	if length < plusPairLength {
+		length = plusPairLength
+	}
+	if length > plusMaxLength {
+		length = plusMaxLength
+	}
+
+	latitude := math.Min(math.Max(p.Latitude, -90), 90)
+	longitude := math.Mod(p.Longitude+180, 360)
+	if longitude < 0 {
+		longitude += 360
+	}
+	//Rounded first so float error doesn't push a point on a cell edge into the cell below
+	latValue := int64(math.Round((latitude+90)*plusFinalLatPrecision*1e6) / 1e6)
+	//The north pole belongs to the cell below it
+	if latValue >= 180*plusFinalLatPrecision {
+		latValue = 180*plusFinalLatPrecision - 1
+	}
+	lngValue := int64(math.Round(longitude*plusFinalLngPrecision*1e6) / 1e6)
+	if lngValue >= 360*plusFinalLngPrecision {
+		lngValue -= 360 * plusFinalLngPrecision
+	}
+
+	digits := make([]byte, plusMaxLength)
+	for i := plusMaxLength - 1; i >= plusPairLength; i-- {
+		digits[i] = plusCodeAlphabet[(latValue%plusGridRows)*plusGridColumns+lngValue%plusGridColumns]
+		latValue /= plusGridRows
+		lngValue /= plusGridColumns
+	}
+	for i := plusPairLength - 1; i > 0; i -= 2 {
+		digits[i] = plusCodeAlphabet[lngValue%plusBase]
+		digits[i-1] = plusCodeAlphabet[latValue%plusBase]
+		latValue /= plusBase
+		lngValue /= plusBase
+	}
+
+	return string(digits[:plusSeparatorPos]) + string(plusCodeSeparator) + string(digits[plusSeparatorPos:length])
+}
+
+//Whether the code is a full plus code, padded codes for larger areas included
+func ValidPlusCode(code string) bool {
+	_, err := normalizePlusCode(code)
+	return err == nil
+}
+
+//Center of the cell of a full plus code
+func DecodePlusCode(code string) (Point, error) {
+	digits, err := normalizePlusCode(code)
+	if err != nil {
+		return Point{}, err
+	}
+
+	var latValue, lngValue int64
+	placeValue := int64(plusBase * plusBase * plusBase * plusBase)
+	pairs := len(digits)
+	if pairs > plusPairLength {
+		pairs = plusPairLength
+	}
+	for i := 0; i < pairs; i += 2 {
+		latValue += int64(strings.IndexByte(plusCodeAlphabet, digits[i])) * placeValue
+		lngValue += int64(strings.IndexByte(plusCodeAlphabet, digits[i+1])) * placeValue
+		if i < pairs-2 {
+			placeValue /= plusBase
+		}
+	}
+	latitude := float64(latValue) / plusPairPrecision
+	longitude := float64(lngValue) / plusPairPrecision
+	latSize := float64(placeValue) / plusPairPrecision
+	lngSize := latSize
+
+	if len(digits) > plusPairLength {
+		rowValue := int64(625)    //plusGridRows^4
+		columnValue := int64(256) //plusGridColumns^4
+		var latExtra, lngExtra int64
+		for i := plusPairLength; i < len(digits); i++ {
+			digit := int64(strings.IndexByte(plusCodeAlphabet, digits[i]))
+			latExtra += digit / plusGridColumns * rowValue
+			lngExtra += digit % plusGridColumns * columnValue
+			if i < len(digits)-1 {
+				rowValue /= plusGridRows
+				columnValue /= plusGridColumns
+			}
+		}
+		latitude += float64(latExtra) / plusFinalLatPrecision
+		longitude += float64(lngExtra) / plusFinalLngPrecision
+		latSize = float64(rowValue) / plusFinalLatPrecision
+		lngSize = float64(columnValue) / plusFinalLngPrecision
+	}
+
+	center := Point{
+		Latitude:  math.Min(latitude-90+latSize/2, 90),
+		Longitude: math.Min(longitude-180+lngSize/2, 180),
+	}
+	return center, nil
+}
+
+//Checks a full plus code and returns its digits without the separator and padding
+func normalizePlusCode(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	separator := strings.IndexByte(code, plusCodeSeparator)
+	if separator < 0 || separator != strings.LastIndexByte(code, plusCodeSeparator) || separator%2 == 1 {
+		return "", ErrInvalidPlusCode
+	}
+	if separator < plusSeparatorPos {
+		return "", ErrShortPlusCode
+	}
+	if separator > plusSeparatorPos || len(code)-separator == 2 {
+		return "", ErrInvalidPlusCode
+	}
+
+	digits := code[:separator]
+	if padding := strings.IndexByte(digits, plusCodePadding); padding >= 0 {
+		//Padding stands for whole pairs at the end and cannot be followed by more digits
+		if padding == 0 || padding%2 == 1 || strings.Trim(digits[padding:], string(plusCodePadding)) != "" || len(code) > separator+1 {
+			return "", ErrInvalidPlusCode
+		}
+		digits = digits[:padding]
+	}
+	digits += code[separator+1:]
+	if len(digits) > plusMaxLength {
+		digits = digits[:plusMaxLength]
+	}
+
+	for i := 0; i < len(digits); i++ {
+		if strings.IndexByte(plusCodeAlphabet, digits[i]) < 0 {
+			return "", ErrInvalidPlusCode
+		}
+	}
+	//The first pair can't go past 90 degrees north or 180 east
+	if strings.IndexByte(plusCodeAlphabet, digits[0]) > 8 || strings.IndexByte(plusCodeAlphabet, digits[1]) > 17 {
+		return "", ErrInvalidPlusCode
+	}
+	return digits, nil
+}
@@ -0,0 +1,175 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/dependency"
+)
+
+//Returned when a backfill is started while another one is running
+var ErrBackfillRunning = errors.New("Backfill Already Running")
+
+//Record that has an address but no coordinates
+type Pending struct {
+	ID      uint32
+	Address string
+}
+
+//Where a backfill reads addresses from and writes coordinates to
+type Store interface {
+	CountPending(ctx context.Context) (int, error)
+	NextPending(ctx context.Context, afterID uint32, limit int) ([]Pending, error)
+	SaveCoordinates(ctx context.Context, id uint32, latitude, longitude float64) error
+}
+
+//How a backfill runs
+type Options struct {
+	BatchSize int
+	Interval  time.Duration //Pause between geocoder requests
+	Limit     int           //Stop after this many records, 0 for all
+}
+
+//Interval between geocoder requests from GEOCODER_INTERVAL, Nominatim allows one request per second
+func OptionsFromEnv() Options {
+	interval, err := time.ParseDuration(os.Getenv("GEOCODER_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = time.Second
+	}
+	return Options{BatchSize: 50, Interval: interval}
+}
+
+//State of a backfill
+type Progress struct {
+	Running    bool       `json:"running"`
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Updated    int        `json:"updated"`
+	NotFound   int        `json:"not_found"`
+	Failed     int        `json:"failed"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Error      string     `json:"error,omitempty"`
+}
+
+//Geocodes pending records in batches, one backfill at a time
+type Backfill struct {
+	mu       sync.Mutex
+	progress Progress
+}
+
+func NewBackfill() *Backfill {
+	return &Backfill{}
+}
+
+//Snapshot of the current or last backfill
+func (b *Backfill) Progress() Progress {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.progress
+}
+
+//Geocode the pending records, report is called after every record
+func (b *Backfill) Run(ctx context.Context, store Store, geocoder Geocoder, options Options, report func(Progress)) error {
+	b.mu.Lock()
+	if b.progress.Running {
+		b.mu.Unlock()
+		return ErrBackfillRunning
+	}
+	now := time.Now()
+	b.progress = Progress{Running: true, StartedAt: &now}
+	b.mu.Unlock()
+
+	err := b.run(ctx, store, geocoder, options, report)
+
+	b.mu.Lock()
+	finished := time.Now()
+	b.progress.Running = false
+	b.progress.FinishedAt = &finished
+	if err != nil {
+		b.progress.Error = err.Error()
+	}
+	b.mu.Unlock()
+	return err
+}
+
+func (b *Backfill) update(change func(progress *Progress), report func(Progress)) {
+	b.mu.Lock()
+	change(&b.progress)
+	snapshot := b.progress
+	b.mu.Unlock()
+
+	if report != nil {
+		report(snapshot)
+	}
+}
+
+func (b *Backfill) run(ctx context.Context, store Store, geocoder Geocoder, options Options, report func(Progress)) error {
+	total, err := store.CountPending(ctx)
+	if err != nil {
+		return err
+	}
+	if options.Limit > 0 && options.Limit < total {
+		total = options.Limit
+	}
+	b.update(func(progress *Progress) { progress.Total = total }, report)
+
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+
+	//Records that fail keep their zero coordinates, paging by id keeps them from coming back
+	var afterID uint32
+	processed := 0
+	for processed < total {
+		batch, err := store.NextPending(ctx, afterID, options.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		for _, pending := range batch {
+			if processed >= total {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+
+			afterID = pending.ID
+			processed++
+
+			latitude, longitude, err := geocoder.Geocode(ctx, pending.Address)
+			if err == nil {
+				err = store.SaveCoordinates(ctx, pending.ID, latitude, longitude)
+			}
+
+			b.update(func(progress *Progress) {
+				progress.Processed++
+				switch {
+				case err == nil:
+					progress.Updated++
+				case err == ErrNotFound:
+					progress.NotFound++
+				default:
+					progress.Failed++
+				}
+			}, report)
+			if err != nil && err != ErrNotFound {
+				log.Printf("Geocoding record %d failed: %v", pending.ID, err)
+			}
+			//Every other record would fail the same way, such as with a blocked or misconfigured geocoder
+			if failure, ok := dependency.As(err); ok && failure.Kind == dependency.Permanent {
+				return err
+			}
+		}
+	}
+	return nil
+}
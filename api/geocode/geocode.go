@@ -0,0 +1,93 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/dependency"
+	"github.com/victorkabata/FixIt-API/api/httpclient"
+)
+
+//Returned when the geocoder has no match for the address
+var ErrNotFound = errors.New("Address Not Found")
+
+//Turns addresses into coordinates
+type Geocoder interface {
+	Geocode(ctx context.Context, address string) (latitude, longitude float64, err error)
+}
+
+//Geocoder backed by a Nominatim (OpenStreetMap) server
+type Nominatim struct {
+	BaseURL   string
+	UserAgent string //Nominatim's usage policy asks for an identifying agent
+	Email     string
+	Client    *http.Client
+}
+
+func NewNominatimFromEnv() *Nominatim {
+	baseURL := os.Getenv("GEOCODER_URL")
+	if baseURL == "" {
+		baseURL = "https://nominatim.openstreetmap.org"
+	}
+	return &Nominatim{
+		BaseURL:   baseURL,
+		UserAgent: "FixIt-API geocoder",
+		Email:     os.Getenv("GEOCODER_EMAIL"),
+		Client:    httpclient.New("geocoder", 10*time.Second),
+	}
+}
+
+func (n *Nominatim) Geocode(ctx context.Context, address string) (float64, float64, error) {
+	query := url.Values{}
+	query.Set("q", address)
+	query.Set("format", "json")
+	query.Set("limit", "1")
+	if n.Email != "" {
+		query.Set("email", n.Email)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, n.BaseURL+"/search?"+query.Encode(), nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	request.Header.Set("User-Agent", n.UserAgent)
+
+	response, err := n.Client.Do(request)
+	if err != nil {
+		return 0, 0, dependency.Wrap(dependency.Geocoder, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return 0, 0, dependency.FromStatus(dependency.Geocoder, response.StatusCode, fmt.Errorf("Geocoding failed with status %d", response.StatusCode))
+	}
+
+	results := []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&results)
+	if err != nil {
+		return 0, 0, dependency.Wrap(dependency.Geocoder, err)
+	}
+	if len(results) == 0 {
+		return 0, 0, ErrNotFound
+	}
+
+	latitude, err := strconv.ParseFloat(results[0].Lat, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	longitude, err := strconv.ParseFloat(results[0].Lon, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return latitude, longitude, nil
+}
@@ -0,0 +1,208 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/cache"
+	"github.com/victorkabata/FixIt-API/api/dependency"
+	"github.com/victorkabata/FixIt-API/api/geo"
+	"github.com/victorkabata/FixIt-API/api/httpclient"
+)
+
+//Address suggested for what the user typed so far. Coordinates are only given by providers that return them.
+type Suggestion struct {
+	Description string   `json:"description"`
+	PlaceID     string   `json:"place_id,omitempty"`
+	Latitude    *float64 `json:"latitude,omitempty"`
+	Longitude   *float64 `json:"longitude,omitempty"`
+}
+
+//What to suggest addresses for
+type SuggestQuery struct {
+	Text    string
+	Country string     //ISO 3166-1 alpha-2 code, optional
+	Near    *geo.Point //Bias towards this point, optional
+	Session string     //Groups the requests of one search, lowers the Google bill
+}
+
+func (q SuggestQuery) key() string {
+	key := strings.ToLower(strings.TrimSpace(q.Text)) + "|" + strings.ToLower(q.Country)
+	if q.Near != nil {
+		//Nearby searches share results within about a kilometre
+		key += fmt.Sprintf("|%.2f,%.2f", q.Near.Latitude, q.Near.Longitude)
+	}
+	return key
+}
+
+//Places autocomplete provider
+type Suggester interface {
+	Suggest(ctx context.Context, query SuggestQuery) ([]Suggestion, error)
+}
+
+//Google Places autocomplete, the key stays on the server
+type GooglePlaces struct {
+	APIKey  string
+	BaseURL string
+	Client  *http.Client
+}
+
+func (g *GooglePlaces) Suggest(ctx context.Context, query SuggestQuery) ([]Suggestion, error) {
+	params := url.Values{}
+	params.Set("input", query.Text)
+	params.Set("key", g.APIKey)
+	if query.Country != "" {
+		params.Set("components", "country:"+strings.ToLower(query.Country))
+	}
+	if query.Near != nil {
+		params.Set("location", fmt.Sprintf("%f,%f", query.Near.Latitude, query.Near.Longitude))
+		params.Set("radius", "50000")
+	}
+	if query.Session != "" {
+		params.Set("sessiontoken", query.Session)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, g.BaseURL+"/maps/api/place/autocomplete/json?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := g.Client.Do(request)
+	if err != nil {
+		return nil, dependency.Wrap(dependency.Places, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, dependency.FromStatus(dependency.Places, response.StatusCode, fmt.Errorf("Places autocomplete failed with status %d", response.StatusCode))
+	}
+
+	result := struct {
+		Status      string `json:"status"`
+		Error       string `json:"error_message"`
+		Predictions []struct {
+			Description string `json:"description"`
+			PlaceID     string `json:"place_id"`
+		} `json:"predictions"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return nil, dependency.Wrap(dependency.Places, err)
+	}
+	if result.Status != "OK" && result.Status != "ZERO_RESULTS" {
+		return nil, dependency.New(dependency.Places, placesFailure(result.Status), fmt.Errorf("Places autocomplete failed: %s %s", result.Status, result.Error))
+	}
+
+	suggestions := []Suggestion{}
+	for _, prediction := range result.Predictions {
+		suggestions = append(suggestions, Suggestion{Description: prediction.Description, PlaceID: prediction.PlaceID})
+	}
+	return suggestions, nil
+}
+
+//Kind of failure of a Places status: over the quota or an error on Google's side may pass,
+//a refused key won't and an invalid request is the query's fault
+func placesFailure(status string) dependency.Kind {
+	switch status {
+	case "OVER_QUERY_LIMIT", "UNKNOWN_ERROR":
+		return dependency.Retryable
+	case "INVALID_REQUEST":
+		return dependency.Rejected
+	}
+	return dependency.Permanent
+}
+
+//Suggestions from a Nominatim search, used when no Google key is configured
+func (n *Nominatim) Suggest(ctx context.Context, query SuggestQuery) ([]Suggestion, error) {
+	params := url.Values{}
+	params.Set("q", query.Text)
+	params.Set("format", "json")
+	params.Set("limit", "5")
+	if query.Country != "" {
+		params.Set("countrycodes", strings.ToLower(query.Country))
+	}
+	if n.Email != "" {
+		params.Set("email", n.Email)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, n.BaseURL+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", n.UserAgent)
+
+	response, err := n.Client.Do(request)
+	if err != nil {
+		return nil, dependency.Wrap(dependency.Geocoder, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, dependency.FromStatus(dependency.Geocoder, response.StatusCode, fmt.Errorf("Place search failed with status %d", response.StatusCode))
+	}
+
+	results := []struct {
+		PlaceID     int64  `json:"place_id"`
+		DisplayName string `json:"display_name"`
+		Lat         string `json:"lat"`
+		Lon         string `json:"lon"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&results)
+	if err != nil {
+		return nil, dependency.Wrap(dependency.Geocoder, err)
+	}
+
+	suggestions := []Suggestion{}
+	for _, result := range results {
+		suggestion := Suggestion{Description: result.DisplayName, PlaceID: strconv.FormatInt(result.PlaceID, 10)}
+		latitude, latErr := strconv.ParseFloat(result.Lat, 64)
+		longitude, lngErr := strconv.ParseFloat(result.Lon, 64)
+		if latErr == nil && lngErr == nil {
+			suggestion.Latitude = &latitude
+			suggestion.Longitude = &longitude
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions, nil
+}
+
+//Caches the suggestions of a provider so repeated prefixes don't cost a request
+type CachedSuggester struct {
+	Suggester Suggester
+	TTL       time.Duration
+	cache     *cache.Cache
+}
+
+func (c *CachedSuggester) Suggest(ctx context.Context, query SuggestQuery) ([]Suggestion, error) {
+	key := query.key()
+	if cached, ok := c.cache.Get(key); ok {
+		return cached.([]Suggestion), nil
+	}
+
+	suggestions, err := c.Suggester.Suggest(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.Set(key, suggestions, c.TTL)
+	return suggestions, nil
+}
+
+//Google Places when GOOGLE_PLACES_API_KEY is set, otherwise Nominatim, cached for PLACES_CACHE_TTL
+func NewSuggesterFromEnv() *CachedSuggester {
+	var suggester Suggester = NewNominatimFromEnv()
+	if key := os.Getenv("GOOGLE_PLACES_API_KEY"); key != "" {
+		suggester = &GooglePlaces{APIKey: key, BaseURL: "https://maps.googleapis.com", Client: httpclient.New("places", 10*time.Second)}
+	}
+
+	ttl, err := time.ParseDuration(os.Getenv("PLACES_CACHE_TTL"))
+	if err != nil || ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &CachedSuggester{Suggester: suggester, TTL: ttl, cache: cache.New()}
+}
@@ -0,0 +1,90 @@
+package httpclient
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Pooling and retries of every outbound client, read from the environment once
+type Settings struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	Retries             int
+	RetryWait           time.Duration
+}
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+//Settings from the HTTP_CLIENT_* variables
+func SettingsFromEnv() Settings {
+	return Settings{
+		MaxIdleConns:        envInt("HTTP_CLIENT_MAX_IDLE_CONNS", 100),
+		MaxIdleConnsPerHost: envInt("HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST", 10),
+		IdleConnTimeout:     envDuration("HTTP_CLIENT_IDLE_CONN_TIMEOUT", 90*time.Second),
+		Retries:             envInt("HTTP_CLIENT_RETRIES", 2),
+		RetryWait:           envDuration("HTTP_CLIENT_RETRY_WAIT", 250*time.Millisecond),
+	}
+}
+
+var (
+	once     sync.Once
+	settings Settings
+	pool     *http.Transport
+)
+
+//Connection pool shared by every integration so keep-alive connections are reused across them
+func shared() (*http.Transport, Settings) {
+	once.Do(func() {
+		settings = SettingsFromEnv()
+		pool = &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          settings.MaxIdleConns,
+			MaxIdleConnsPerHost:   settings.MaxIdleConnsPerHost,
+			IdleConnTimeout:       settings.IdleConnTimeout,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		}
+	})
+	return pool, settings
+}
+
+//Client of an integration like "stripe" or "nominatim". The name labels its metrics and logs and
+//HTTP_CLIENT_TIMEOUT_<NAME> overrides the timeout, which covers every retry of a request.
+func New(integration string, timeout time.Duration) *http.Client {
+	pool, settings := shared()
+	key := "HTTP_CLIENT_TIMEOUT_" + strings.ToUpper(integration)
+	return &http.Client{
+		Timeout: envDuration(key, timeout),
+		Transport: &transport{
+			integration: integration,
+			retries:     settings.Retries,
+			wait:        settings.RetryWait,
+			next:        pool,
+		},
+	}
+}
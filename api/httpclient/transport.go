@@ -0,0 +1,151 @@
+package httpclient
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/logger"
+)
+
+//Longest Retry-After that is waited for, longer ones give up straight away
+const maxRetryAfter = 5 * time.Second
+
+//Duration of every attempt of an outbound request by integration, method and status
+var requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "outbound_request_duration_seconds",
+	Help:    "Duration of requests to outside services.",
+	Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+}, []string{"integration", "method", "status"})
+
+func init() {
+	prometheus.MustRegister(requestDuration)
+}
+
+//Answers that are worth trying again, the service is busy or one of its hosts is down
+var retryStatuses = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+//Retries the failed attempts of safe requests and traces every attempt
+type transport struct {
+	integration string
+	retries     int
+	wait        time.Duration
+	next        http.RoundTripper
+}
+
+//Only requests that can't do anything twice are retried: reads, or writes carrying an idempotency key
+func retryable(request *http.Request) bool {
+	if request.Body != nil && request.Body != http.NoBody && request.GetBody == nil {
+		return false
+	}
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return request.Header.Get("Idempotency-Key") != ""
+}
+
+func (t *transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	retries := t.retries
+	if !retryable(request) {
+		retries = 0
+	}
+
+	for attempt := 1; ; attempt++ {
+		response, err := t.attempt(request, attempt)
+		if attempt > retries || !(err != nil || retryStatuses[response.StatusCode]) {
+			return response, err
+		}
+		if request.Context().Err() != nil {
+			return response, err
+		}
+
+		wait := t.backoff(attempt, response)
+		if wait < 0 {
+			return response, err
+		}
+		if deadline, ok := request.Context().Deadline(); ok && time.Until(deadline) < wait {
+			return response, err
+		}
+
+		retry := request.Clone(request.Context())
+		if request.GetBody != nil {
+			body, bodyErr := request.GetBody()
+			if bodyErr != nil {
+				return response, err
+			}
+			retry.Body = body
+		}
+		if response != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64<<10))
+			response.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-request.Context().Done():
+			timer.Stop()
+			return nil, request.Context().Err()
+		case <-timer.C:
+		}
+		request = retry
+	}
+}
+
+//Doubles the wait after every attempt with some jitter, or waits as long as the service asked.
+//A negative wait means the service asked for longer than is worth waiting.
+func (t *transport) backoff(attempt int, response *http.Response) time.Duration {
+	if response != nil {
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+			if wait := time.Duration(seconds) * time.Second; wait <= maxRetryAfter {
+				return wait
+			}
+			return -1
+		}
+	}
+	wait := t.wait << uint(attempt-1)
+	return wait + time.Duration(rand.Int63n(int64(wait)/2+1))
+}
+
+//Sends one attempt, timing it into the histogram and logging it with the handler it was made for
+func (t *transport) attempt(request *http.Request, attempt int) (*http.Response, error) {
+	start := time.Now()
+	response, err := t.next.RoundTrip(request)
+	duration := time.Since(start)
+
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(response.StatusCode)
+	}
+	requestDuration.WithLabelValues(t.integration, request.Method, status).Observe(duration.Seconds())
+
+	fields := logger.Fields{
+		"integration": t.integration,
+		"method":      request.Method,
+		"host":        request.URL.Host,
+		"path":        request.URL.Path,
+		"status":      status,
+		"attempt":     attempt,
+		"handler":     database.Handler(request.Context()),
+		"duration_ms": float64(duration.Microseconds()) / 1000,
+	}
+	if err != nil {
+		fields["error"] = err
+		logger.Warn("Outbound request failed", fields)
+	} else if response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests {
+		logger.Warn("Outbound request failed", fields)
+	} else {
+		logger.Debug("Outbound request", fields)
+	}
+	return response, err
+}
@@ -0,0 +1,132 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif" //Registered for image.Decode
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	MaxBytes  = 10 << 20 //Largest image accepted
+	MaxPixels = 40e6     //Largest image decoded, so a small file can't claim a huge canvas
+)
+
+var (
+	ErrUnsupportedType = errors.New("Only JPEG, PNG, GIF and WebP images are allowed")
+	ErrTooLarge        = errors.New("Image Too Large")
+	ErrInvalidImage    = errors.New("Invalid Image")
+)
+
+//Sizes made of every profile picture, by name
+var Variants = []Variant{
+	{Name: "thumbnail", Width: 150, Height: 150, Crop: true},
+	{Name: "medium", Width: 600, Height: 600},
+}
+
+type Variant struct {
+	Name          string
+	Width, Height int
+	Crop          bool //Cut to fill the box, otherwise the image fits inside it
+}
+
+//Encoded image ready to store
+type Image struct {
+	Data        []byte
+	ContentType string
+	Extension   string
+}
+
+//The image with its metadata removed and the variants made from it.
+//WebP images can't be decoded here, so they have their metadata removed and no variants.
+type Processed struct {
+	Original Image
+	Variants map[string]Image
+}
+
+//Check an uploaded image, remove its EXIF and other metadata, turn it upright and make its variants
+func Process(data []byte, variants []Variant) (*Processed, error) {
+	if len(data) > MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	if contentType == "image/webp" {
+		stripped, err := stripWebPMetadata(data)
+		if err != nil {
+			return nil, err
+		}
+		return &Processed{Original: Image{Data: stripped, ContentType: contentType, Extension: ".webp"}, Variants: map[string]Image{}}, nil
+	}
+	if contentType != "image/jpeg" && contentType != "image/png" && contentType != "image/gif" {
+		return nil, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || float64(config.Width)*float64(config.Height) > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	upright := toNRGBA(decoded)
+	if contentType == "image/jpeg" {
+		upright = orient(upright, jpegOrientation(data))
+	}
+
+	processed := &Processed{Variants: map[string]Image{}}
+	switch contentType {
+	case "image/gif":
+		//Kept as is so animations survive, GIF has no EXIF. The variants are of the first frame.
+		processed.Original = Image{Data: data, ContentType: contentType, Extension: ".gif"}
+	default:
+		//Encoding the pixels again leaves every metadata block of the upload behind
+		processed.Original, err = encode(upright, contentType, 90)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	variantType := contentType
+	if variantType == "image/gif" {
+		variantType = "image/png"
+	}
+	for _, variant := range variants {
+		var resized *image.NRGBA
+		if variant.Crop {
+			resized = fill(upright, variant.Width, variant.Height)
+		} else {
+			resized = fit(upright, variant.Width, variant.Height)
+		}
+		processed.Variants[variant.Name], err = encode(resized, variantType, 85)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return processed, nil
+}
+
+func encode(img image.Image, contentType string, quality int) (Image, error) {
+	var buffer bytes.Buffer
+	var err error
+	extension := ".png"
+	if contentType == "image/jpeg" {
+		extension = ".jpg"
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: quality})
+	} else {
+		contentType = "image/png"
+		err = png.Encode(&buffer, img)
+	}
+	if err != nil {
+		return Image{}, err
+	}
+	return Image{Data: buffer.Bytes(), ContentType: contentType, Extension: extension}, nil
+}
@@ -0,0 +1,81 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	converted := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(converted, converted.Bounds(), img, bounds.Min, draw.Src)
+	return converted
+}
+
+//Scaled down to fit inside the box keeping its proportions, images already inside it are left as they are
+func fit(img *image.NRGBA, width, height int) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w <= width && h <= height {
+		return img
+	}
+	if w*height > h*width {
+		return resize(img, width, max(1, h*width/w))
+	}
+	return resize(img, max(1, w*height/h), height)
+}
+
+//Cut from the middle to the box's proportions and scaled down to fill it
+func fill(img *image.NRGBA, width, height int) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	cropW, cropH := w, h
+	if w*height > h*width {
+		cropW = max(1, h*width/height)
+	} else {
+		cropH = max(1, w*height/width)
+	}
+	x, y := (w-cropW)/2, (h-cropH)/2
+	cropped := toNRGBA(img.SubImage(image.Rect(x, y, x+cropW, y+cropH)))
+	if cropW <= width && cropH <= height {
+		return cropped
+	}
+	return resize(cropped, width, height)
+}
+
+//Scaled down by averaging the source pixels each new pixel covers, weighted by their opacity
+func resize(img *image.NRGBA, width, height int) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	resized := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*h/height, max((y+1)*h/height, y*h/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*w/width, max((x+1)*w/width, x*w/width+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := img.Pix[sy*img.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					pixel := row[sx*4 : sx*4+4]
+					alpha := uint64(pixel[3])
+					r += uint64(pixel[0]) * alpha
+					g += uint64(pixel[1]) * alpha
+					b += uint64(pixel[2]) * alpha
+					a += alpha
+					n++
+				}
+			}
+			out := resized.Pix[y*resized.Stride+x*4:]
+			if a > 0 {
+				out[0], out[1], out[2] = uint8(r/a), uint8(g/a), uint8(b/a)
+			}
+			out[3] = uint8(a / n)
+		}
+	}
+	return resized
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
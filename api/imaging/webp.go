@@ -0,0 +1,54 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+//Flags of the VP8X chunk telling readers EXIF and XMP chunks follow
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+//Drops the EXIF and XMP chunks of a WebP file and clears their flags, leaving the image data as it is
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || !bytes.Equal(data[:4], []byte("RIFF")) || !bytes.Equal(data[8:12], []byte("WEBP")) {
+		return nil, ErrInvalidImage
+	}
+
+	var stripped bytes.Buffer
+	stripped.Write(data[:12])
+	for offset := 12; offset < len(data); {
+		if offset+8 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		fourCC := string(data[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		end := offset + 8 + size + size%2 //Chunks are padded to an even size
+		if size < 0 || end > len(data) {
+			//Some writers leave out the padding of the last chunk
+			if offset+8+size != len(data) {
+				return nil, ErrInvalidImage
+			}
+			end = len(data)
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte{}, data[offset:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			stripped.Write(chunk)
+		default:
+			stripped.Write(data[offset:end])
+		}
+		offset = end
+	}
+
+	out := stripped.Bytes()
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
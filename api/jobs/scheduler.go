@@ -0,0 +1,80 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+//Background task run on a fixed interval
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+//Runs the registered jobs in the background until stopped
+type Scheduler struct {
+	mu      sync.Mutex
+	jobs    []Job
+	started bool
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+//Register a job to run every interval once the scheduler is started
+func (s *Scheduler) Every(name string, interval time.Duration, run func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := Job{Name: name, Interval: interval, Run: run}
+	s.jobs = append(s.jobs, job)
+	if s.started {
+		go s.loop(job)
+	}
+}
+
+//Start running all registered jobs
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return
+	}
+	s.started = true
+
+	for _, job := range s.jobs {
+		go s.loop(job)
+	}
+}
+
+func (s *Scheduler) loop(job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.runOnce(job)
+	}
+}
+
+//Runs a job, recovering from panics so one failing job doesn't take the API down
+func (s *Scheduler) runOnce(job Job) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("Job %s panicked: %v", job.Name, err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), job.Interval)
+	defer cancel()
+
+	start := time.Now()
+	err := job.Run(ctx)
+	if err != nil {
+		log.Printf("Job %s failed after %v: %v", job.Name, time.Since(start), err)
+	}
+}
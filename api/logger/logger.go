@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+//Extra context of a log entry
+type Fields map[string]interface{}
+
+var output = log.New(os.Stderr, "", 0)
+
+//Levels from the most to the least verbose
+var levels = map[string]int32{"debug": 0, "info": 1, "warn": 2, "error": 3}
+
+//Entries below this level are dropped
+var minLevel = levels["info"]
+
+//Level of a name like debug or warn, an empty name is info
+func parseLevel(name string) (int32, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = "info"
+	}
+	level, ok := levels[name]
+	if !ok {
+		return 0, errors.New("Unknown Log Level")
+	}
+	return level, nil
+}
+
+//Name of the least severe level that is written
+func Level() string {
+	current := atomic.LoadInt32(&minLevel)
+	for name, level := range levels {
+		if level == current {
+			return name
+		}
+	}
+	return "info"
+}
+
+//Writes the entry as one JSON object per line so logs can be searched by field
+func write(level, message string, fields Fields) {
+	if levels[level] < atomic.LoadInt32(&minLevel) {
+		return
+	}
+
+	entry := map[string]interface{}{}
+	for key, value := range fields {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		entry[key] = value
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level
+	entry["message"] = message
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		output.Printf("%s %s %v", level, message, fields)
+		return
+	}
+	output.Println(string(line))
+}
+
+func Debug(message string, fields Fields) {
+	write("debug", message, fields)
+}
+
+func Info(message string, fields Fields) {
+	write("info", message, fields)
+}
+
+func Warn(message string, fields Fields) {
+	write("warn", message, fields)
+}
+
+func Error(message string, fields Fields) {
+	write("error", message, fields)
+}
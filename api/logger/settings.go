@@ -0,0 +1,125 @@
+package logger
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//Verbosity of the logs, with the time a temporary change ends
+type Settings struct {
+	Level     string     `json:"level"`
+	SQL       bool       `json:"sql"` //Whether every SQL statement is printed
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+var (
+	settingsMu sync.Mutex
+	configured = Settings{Level: "info", SQL: true}
+	overridden *time.Timer
+	expiresAt  *time.Time
+	sqlEnabled int32 = 1
+)
+
+//Whether SQL statements should be printed
+func SQLEnabled() bool {
+	return atomic.LoadInt32(&sqlEnabled) == 1
+}
+
+//SQL logging from SQL_LOG in the environment, on unless set to false
+func SQLFromEnv() bool {
+	enabled, err := strconv.ParseBool(os.Getenv("SQL_LOG"))
+	return err != nil || enabled
+}
+
+//Must be called with settingsMu held
+func apply(settings Settings) error {
+	level, err := parseLevel(settings.Level)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&minLevel, level)
+
+	var sql int32
+	if settings.SQL {
+		sql = 1
+	}
+	atomic.StoreInt32(&sqlEnabled, sql)
+	return nil
+}
+
+//Set the configured verbosity, it takes effect right away unless a temporary change is active
+func Configure(level string, sql bool) error {
+	_, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	configured = Settings{Level: level, SQL: sql}
+	if overridden != nil {
+		return nil
+	}
+	return apply(configured)
+}
+
+//Change the verbosity for the given time, after which the configured settings return
+func Override(level string, sql bool, duration time.Duration) (Settings, error) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	err := apply(Settings{Level: level, SQL: sql})
+	if err != nil {
+		return Settings{}, err
+	}
+
+	if overridden != nil {
+		overridden.Stop()
+	}
+	ends := time.Now().Add(duration)
+	expiresAt = &ends
+
+	//A timer that fires while being replaced finds itself replaced and leaves the new change alone
+	var timer *time.Timer
+	timer = time.AfterFunc(duration, func() {
+		settingsMu.Lock()
+		defer settingsMu.Unlock()
+		if overridden == timer {
+			overridden = nil
+			expiresAt = nil
+			apply(configured)
+		}
+	})
+	overridden = timer
+	return current(), nil
+}
+
+//End a temporary change and go back to the configured settings
+func ClearOverride() Settings {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	if overridden != nil {
+		overridden.Stop()
+		overridden = nil
+		expiresAt = nil
+	}
+	apply(configured)
+	return current()
+}
+
+//Verbosity in effect
+func Current() Settings {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	return current()
+}
+
+//Must be called with settingsMu held
+func current() Settings {
+	return Settings{Level: Level(), SQL: SQLEnabled(), ExpiresAt: expiresAt}
+}
@@ -0,0 +1,70 @@
+package mailer
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+)
+
+//Delivery problems reported by email providers
+const (
+	EventBounce    = "bounce"
+	EventComplaint = "complaint"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("Unknown Email Provider")
+	ErrInvalidSignature = errors.New("Invalid Webhook Signature")
+)
+
+//Delivery problem of a sent email reported by the provider
+type Event struct {
+	Email     string
+	Type      string
+	Permanent bool //Hard bounces, the address will never take email
+	Reason    string
+}
+
+//Email provider such as SES or SendGrid that reports bounces and complaints to a webhook
+type EventSource interface {
+	Name() string
+	//Verify a webhook and read the events in it, none when it carries nothing relevant
+	ParseWebhook(r *http.Request, body []byte) ([]Event, error)
+}
+
+var (
+	eventSources     = map[string]EventSource{}
+	eventSourcesLock sync.RWMutex
+	eventSourcesOnce sync.Once
+)
+
+//Make an event source available by its name
+func RegisterEventSource(source EventSource) {
+	eventSourcesLock.Lock()
+	defer eventSourcesLock.Unlock()
+	eventSources[source.Name()] = source
+}
+
+//Register the event sources configured in the environment
+func registerEventSourcesFromEnv() {
+	if os.Getenv("SES_WEBHOOK_SECRET") != "" {
+		RegisterEventSource(NewSESFromEnv())
+	}
+	if os.Getenv("SENDGRID_WEBHOOK_KEY") != "" {
+		RegisterEventSource(NewSendGridFromEnv())
+	}
+}
+
+//Find a registered event source by name
+func GetEventSource(name string) (EventSource, error) {
+	eventSourcesOnce.Do(registerEventSourcesFromEnv)
+
+	eventSourcesLock.RLock()
+	defer eventSourcesLock.RUnlock()
+	source, ok := eventSources[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return source, nil
+}
@@ -0,0 +1,205 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/dependency"
+	"github.com/victorkabata/FixIt-API/api/fault"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+//Delivers emails, implemented by SMTP and by a logger for development
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+//Sends emails through the SMTP server configured in the environment
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	body := strings.Join([]string{
+		"From: " + m.From,
+		"To: " + message.To,
+		"Subject: " + message.Subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		message.Body,
+	}, "\r\n")
+
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{message.To}, []byte(body))
+}
+
+//Connects and greets the SMTP server without sending anything
+func (m *SMTPMailer) Ping(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", m.Host+":"+m.Port)
+	if err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	err = client.Hello("localhost")
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+//Prints emails instead of sending them, used when no SMTP server is configured
+type LogMailer struct{}
+
+func (m *LogMailer) Send(ctx context.Context, message Message) error {
+	log.Printf("Email to %s: %s\n%s", message.To, message.Subject, message.Body)
+	return nil
+}
+
+var (
+	defaultMailer Mailer
+	defaultOnce   sync.Once
+	suppressed    func(ctx context.Context, address string) (bool, error)
+	queue         func(ctx context.Context, message Message) error
+)
+
+//Returned by Deliver for addresses that no longer take email
+var ErrSuppressed = errors.New("Address Suppressed")
+
+//Set how Deliver tells addresses that no longer take email apart, such as ones that bounced for good.
+//Called at start up, before anything is sent.
+func SetSuppression(check func(ctx context.Context, address string) (bool, error)) {
+	suppressed = check
+}
+
+//Set where Send queues emails so they are delivered in the background and retried. Called at start up,
+//without a queue Send delivers right away.
+func SetQueue(enqueue func(ctx context.Context, message Message) error) {
+	queue = enqueue
+}
+
+//Picks the mailer from the environment
+func New() Mailer {
+	if os.Getenv("SMTP_HOST") == "" {
+		return &LogMailer{}
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	return &SMTPMailer{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     port,
+		Username: os.Getenv("SMTP_USER"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+	}
+}
+
+//Sends an email, through the queue when there is one
+func Send(ctx context.Context, message Message) error {
+	if queue != nil {
+		return queue(ctx, message)
+	}
+
+	err := Deliver(ctx, message)
+	if err == ErrSuppressed {
+		log.Printf("Not emailing %s, the address bounced or complained before", message.To)
+		return nil
+	}
+	return err
+}
+
+//Sends an email right away with the default mailer, ErrSuppressed when the address no longer takes email
+func Deliver(ctx context.Context, message Message) error {
+	defaultOnce.Do(func() {
+		defaultMailer = New()
+	})
+
+	err := fault.Inject(ctx, fault.Email)
+	if err != nil {
+		return dependency.Wrap(dependency.Email, err)
+	}
+
+	//Sending to them anyway hurts the reputation of the sender
+	if suppressed != nil {
+		skip, err := suppressed(ctx, message.To)
+		if err != nil {
+			log.Printf("Checking whether %s takes email failed: %v", message.To, err)
+		}
+		if skip {
+			return ErrSuppressed
+		}
+	}
+
+	err = defaultMailer.Send(ctx, message)
+	if err != nil {
+		return deliveryError(message.To, err)
+	}
+	return nil
+}
+
+//Types a failed delivery by the SMTP reply, see dependency.Error. The server refusing the recipient is
+//rejected, other refusals for good are permanent and temporary ones (4xx) retryable like network errors.
+func deliveryError(to string, err error) error {
+	failure := fmt.Errorf("Sending email to %s failed: %w", to, err)
+	var reply *textproto.Error
+	if !errors.As(err, &reply) {
+		return dependency.Wrap(dependency.Email, failure)
+	}
+	switch {
+	case reply.Code < 500:
+		return dependency.New(dependency.Email, dependency.Retryable, failure)
+	case reply.Code == 550, reply.Code == 551, reply.Code == 553:
+		return dependency.New(dependency.Email, dependency.Rejected, failure)
+	}
+	return dependency.New(dependency.Email, dependency.Permanent, failure)
+}
+
+//Checks that the default mailer can reach its server, false when it doesn't use one
+func Ping(ctx context.Context) (bool, error) {
+	defaultOnce.Do(func() {
+		defaultMailer = New()
+	})
+
+	smtpMailer, ok := defaultMailer.(*SMTPMailer)
+	if !ok {
+		return false, nil
+	}
+	return true, smtpMailer.Ping(ctx)
+}
@@ -0,0 +1,108 @@
+package mailer
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+//How old a signed webhook may be, so captured ones can't be replayed later
+const sendGridWebhookTolerance = 5 * time.Minute
+
+//SendGrid, whose signed event webhook posts batches of events about sent emails
+type SendGrid struct {
+	PublicKey *ecdsa.PublicKey //Verification key of the signed event webhook, from SENDGRID_WEBHOOK_KEY
+}
+
+func NewSendGridFromEnv() *SendGrid {
+	sendGrid := &SendGrid{}
+	der, err := base64.StdEncoding.DecodeString(os.Getenv("SENDGRID_WEBHOOK_KEY"))
+	if err == nil {
+		var key interface{}
+		key, err = x509.ParsePKIXPublicKey(der)
+		if publicKey, ok := key.(*ecdsa.PublicKey); ok {
+			sendGrid.PublicKey = publicKey
+		}
+	}
+	if sendGrid.PublicKey == nil {
+		//Every webhook is rejected until the key is fixed
+		log.Printf("Invalid SENDGRID_WEBHOOK_KEY: %v", err)
+	}
+	return sendGrid
+}
+
+func (s *SendGrid) Name() string {
+	return "sendgrid"
+}
+
+//Verifies the signature header, an ECDSA signature of the timestamp header followed by the body,
+//and that the timestamp is recent
+func (s *SendGrid) verifySignature(r *http.Request, body []byte) bool {
+	if s.PublicKey == nil {
+		return false
+	}
+	timestamp := r.Header.Get("X-Twilio-Email-Event-Webhook-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > sendGridWebhookTolerance || age < -sendGridWebhookTolerance {
+		return false
+	}
+	der, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Twilio-Email-Event-Webhook-Signature"))
+	if err != nil {
+		return false
+	}
+	var signature struct {
+		R, S *big.Int
+	}
+	rest, err := asn1.Unmarshal(der, &signature)
+	if err != nil || len(rest) > 0 {
+		return false
+	}
+	digest := sha256.Sum256(append([]byte(timestamp), body...))
+	return ecdsa.Verify(s.PublicKey, digest[:], signature.R, signature.S)
+}
+
+func (s *SendGrid) ParseWebhook(r *http.Request, body []byte) ([]Event, error) {
+	if !s.verifySignature(r, body) {
+		return nil, ErrInvalidSignature
+	}
+
+	batch := []struct {
+		Email  string `json:"email"`
+		Event  string `json:"event"`
+		Type   string `json:"type"` //bounce or blocked on bounce events
+		Reason string `json:"reason"`
+	}{}
+	err := json.Unmarshal(body, &batch)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []Event{}
+	for _, event := range batch {
+		switch event.Event {
+		case "bounce":
+			//Blocked emails were refused for now, such as by a full mailbox or a spam filter
+			events = append(events, Event{Email: event.Email, Type: EventBounce, Permanent: event.Type != "blocked", Reason: event.Reason})
+		case "dropped":
+			//SendGrid drops emails to addresses that bounced before without trying them
+			if event.Reason == "Bounced Address" {
+				events = append(events, Event{Email: event.Email, Type: EventBounce, Permanent: true, Reason: event.Reason})
+			}
+		case "spamreport":
+			events = append(events, Event{Email: event.Email, Type: EventComplaint, Permanent: true, Reason: "spamreport"})
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+//Signature header value as SendGrid makes it, a base64 ASN.1 ECDSA signature of the timestamp and body
+func sendGridSignature(t *testing.T, key *ecdsa.PrivateKey, timestamp, body string) string {
+	t.Helper()
+	digest := sha256.Sum256([]byte(timestamp + body))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func TestSendGridVerifySignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `[{"email":"a@example.com","event":"bounce","type":"bounce"}]`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	at := func(offset time.Duration) string {
+		return strconv.FormatInt(time.Now().Add(offset).Unix(), 10)
+	}
+	valid := sendGridSignature(t, key, now, body)
+
+	tests := []struct {
+		name      string
+		key       *ecdsa.PublicKey
+		timestamp string
+		signature string
+		body      string
+		want      bool
+	}{
+		{"valid", &key.PublicKey, now, valid, body, true},
+		{"slightly ahead", &key.PublicKey, at(time.Minute), sendGridSignature(t, key, at(time.Minute), body), body, true},
+		{"tampered body", &key.PublicKey, now, valid, strings.Replace(body, "a@example.com", "b@example.com", 1), false},
+		{"timestamp changed", &key.PublicKey, at(-time.Minute), valid, body, false},
+		{"other key", &key.PublicKey, now, sendGridSignature(t, other, now, body), body, false},
+		{"older than the tolerance", &key.PublicKey, at(-sendGridWebhookTolerance - time.Minute), sendGridSignature(t, key, at(-sendGridWebhookTolerance-time.Minute), body), body, false},
+		{"further ahead than the tolerance", &key.PublicKey, at(sendGridWebhookTolerance + time.Minute), sendGridSignature(t, key, at(sendGridWebhookTolerance+time.Minute), body), body, false},
+		{"timestamp not a number", &key.PublicKey, "now", sendGridSignature(t, key, "now", body), body, false},
+		{"no timestamp", &key.PublicKey, "", sendGridSignature(t, key, "", body), body, false},
+		{"signature not base64", &key.PublicKey, now, "not base64!", body, false},
+		{"signature not ASN.1", &key.PublicKey, now, base64.StdEncoding.EncodeToString([]byte("signature")), body, false},
+		{"no key configured", nil, now, valid, body, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/emails/webhooks/sendgrid", strings.NewReader(test.body))
+			r.Header.Set("X-Twilio-Email-Event-Webhook-Timestamp", test.timestamp)
+			r.Header.Set("X-Twilio-Email-Event-Webhook-Signature", test.signature)
+			s := &SendGrid{PublicKey: test.key}
+			if got := s.verifySignature(r, []byte(test.body)); got != test.want {
+				t.Errorf("verifySignature = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package mailer
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/httpclient"
+)
+
+//Amazon SES, whose bounces and complaints arrive through an SNS topic subscribed to the webhook
+//with the secret in the URL, as SNS doesn't sign with a key of ours
+type SES struct {
+	Secret string
+	Client *http.Client
+}
+
+func NewSESFromEnv() *SES {
+	return &SES{
+		Secret: os.Getenv("SES_WEBHOOK_SECRET"),
+		Client: httpclient.New("ses", 10*time.Second),
+	}
+}
+
+func (s *SES) Name() string {
+	return "ses"
+}
+
+//Subscriptions are only confirmed with SNS itself
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com$`)
+
+func (s *SES) ParseWebhook(r *http.Request, body []byte) ([]Event, error) {
+	if s.Secret == "" || subtle.ConstantTimeCompare([]byte(s.Secret), []byte(r.URL.Query().Get("secret"))) != 1 {
+		return nil, ErrInvalidSignature
+	}
+
+	envelope := struct {
+		Type         string `json:"Type"`
+		Message      string `json:"Message"`
+		SubscribeURL string `json:"SubscribeURL"`
+	}{}
+	err := json.Unmarshal(body, &envelope)
+	if err != nil {
+		return nil, err
+	}
+	switch envelope.Type {
+	case "SubscriptionConfirmation":
+		return nil, s.confirmSubscription(r.Context(), envelope.SubscribeURL)
+	case "Notification":
+	default:
+		return nil, nil
+	}
+
+	notification := struct {
+		NotificationType string `json:"notificationType"`
+		EventType        string `json:"eventType"` //Used instead by SES event publishing
+		Bounce           struct {
+			BounceType        string `json:"bounceType"`
+			BouncedRecipients []struct {
+				EmailAddress   string `json:"emailAddress"`
+				DiagnosticCode string `json:"diagnosticCode"`
+			} `json:"bouncedRecipients"`
+		} `json:"bounce"`
+		Complaint struct {
+			ComplainedRecipients []struct {
+				EmailAddress string `json:"emailAddress"`
+			} `json:"complainedRecipients"`
+			ComplaintFeedbackType string `json:"complaintFeedbackType"`
+		} `json:"complaint"`
+	}{}
+	err = json.Unmarshal([]byte(envelope.Message), &notification)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []Event{}
+	notificationType := notification.NotificationType
+	if notificationType == "" {
+		notificationType = notification.EventType
+	}
+	switch notificationType {
+	case "Bounce":
+		for _, recipient := range notification.Bounce.BouncedRecipients {
+			events = append(events, Event{
+				Email:     recipient.EmailAddress,
+				Type:      EventBounce,
+				Permanent: notification.Bounce.BounceType == "Permanent",
+				Reason:    recipient.DiagnosticCode,
+			})
+		}
+	case "Complaint":
+		for _, recipient := range notification.Complaint.ComplainedRecipients {
+			events = append(events, Event{
+				Email:     recipient.EmailAddress,
+				Type:      EventComplaint,
+				Permanent: true,
+				Reason:    notification.Complaint.ComplaintFeedbackType,
+			})
+		}
+	}
+	return events, nil
+}
+
+//Opening the link SNS sent starts the deliveries to the webhook
+func (s *SES) confirmSubscription(ctx context.Context, subscribeURL string) error {
+	link, err := url.Parse(subscribeURL)
+	if err != nil || link.Scheme != "https" || !snsHost.MatchString(link.Host) {
+		return fmt.Errorf("Invalid SNS subscribe URL %q", subscribeURL)
+	}
+	request, err := http.NewRequest(http.MethodGet, link.String(), nil)
+	if err != nil {
+		return err
+	}
+	response, err := s.Client.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Confirming the SNS subscription failed with status %d", response.StatusCode)
+	}
+	return nil
+}
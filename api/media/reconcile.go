@@ -0,0 +1,183 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Returned when a reconciliation is started while another one is running
+var ErrReconcileRunning = errors.New("Reconciliation Already Running")
+
+//Folders uploads are stored under, backups and anything else in the bucket are never looked at
+var Prefixes = []string{"profile/", "post/", "gallery/", "disputes/"}
+
+//Metrics of reconciliations, served with the other expvars on /admin/metrics
+var metrics = expvar.NewMap("media_reconcile")
+
+//Stored file
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+//Where the files are stored
+type Store interface {
+	//Calls page with the objects under the prefix, a page at a time
+	List(ctx context.Context, prefix string, page func([]Object) error) error
+	Delete(ctx context.Context, keys []string) error
+}
+
+//Which stored files records still point at
+type References interface {
+	Referenced(ctx context.Context, keys []string) (map[string]bool, error)
+	Deleted(ctx context.Context, keys []string) error //Told about the orphans that were deleted
+}
+
+//How a reconciliation runs
+type Options struct {
+	DryRun bool          //Only report the orphans
+	MinAge time.Duration //Files younger than this are skipped, their record may not be saved yet
+}
+
+//Mode of the scheduled reconciliation from MEDIA_RECONCILE: off, report (the default) or delete
+func ModeFromEnv() string {
+	switch mode := strings.ToLower(os.Getenv("MEDIA_RECONCILE")); mode {
+	case "off", "delete":
+		return mode
+	default:
+		return "report"
+	}
+}
+
+//Skips files uploaded in the last day
+func OptionsFromEnv() Options {
+	return Options{DryRun: ModeFromEnv() != "delete", MinAge: 24 * time.Hour}
+}
+
+//State of a reconciliation
+type Report struct {
+	Running     bool       `json:"running"`
+	DryRun      bool       `json:"dry_run"`
+	Scanned     int        `json:"scanned"`
+	Orphans     int        `json:"orphans"`
+	OrphanBytes int64      `json:"orphan_bytes"`
+	Deleted     int        `json:"deleted"`
+	Sample      []string   `json:"sample,omitempty"` //First orphans found
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	Error       string     `json:"error,omitempty"`
+}
+
+const sampleSize = 100
+
+//Finds stored files no record points at and deletes them, one reconciliation at a time
+type Reconciler struct {
+	mu     sync.Mutex
+	report Report
+}
+
+func NewReconciler() *Reconciler {
+	return &Reconciler{}
+}
+
+//Snapshot of the current or last reconciliation
+func (c *Reconciler) Report() Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	report := c.report
+	report.Sample = append([]string{}, c.report.Sample...)
+	return report
+}
+
+//Go through the files under Prefixes and delete the orphans, or only count them on dry runs
+func (c *Reconciler) Run(ctx context.Context, store Store, references References, options Options) (Report, error) {
+	c.mu.Lock()
+	if c.report.Running {
+		c.mu.Unlock()
+		return Report{}, ErrReconcileRunning
+	}
+	now := time.Now()
+	c.report = Report{Running: true, DryRun: options.DryRun, StartedAt: &now}
+	c.mu.Unlock()
+
+	err := c.run(ctx, store, references, options)
+
+	c.mu.Lock()
+	finished := time.Now()
+	c.report.Running = false
+	c.report.FinishedAt = &finished
+	if err != nil {
+		c.report.Error = err.Error()
+	}
+	c.mu.Unlock()
+
+	metrics.Add("runs", 1)
+	if err != nil {
+		metrics.Add("failed_runs", 1)
+	}
+	return c.Report(), err
+}
+
+func (c *Reconciler) run(ctx context.Context, store Store, references References, options Options) error {
+	cutoff := time.Now().Add(-options.MinAge)
+	for _, prefix := range Prefixes {
+		err := store.List(ctx, prefix, func(objects []Object) error {
+			keys := []string{}
+			for _, object := range objects {
+				if object.LastModified.Before(cutoff) {
+					keys = append(keys, object.Key)
+				}
+			}
+			referenced, err := references.Referenced(ctx, keys)
+			if err != nil {
+				return err
+			}
+
+			orphans := []string{}
+			var orphanBytes int64
+			for _, object := range objects {
+				if object.LastModified.Before(cutoff) && !referenced[object.Key] {
+					orphans = append(orphans, object.Key)
+					orphanBytes += object.Size
+				}
+			}
+			c.mu.Lock()
+			c.report.Scanned += len(objects)
+			c.report.Orphans += len(orphans)
+			c.report.OrphanBytes += orphanBytes
+			for i := 0; i < len(orphans) && len(c.report.Sample) < sampleSize; i++ {
+				c.report.Sample = append(c.report.Sample, orphans[i])
+			}
+			c.mu.Unlock()
+			metrics.Add("scanned", int64(len(objects)))
+			metrics.Add("orphans", int64(len(orphans)))
+
+			if options.DryRun || len(orphans) == 0 {
+				return nil
+			}
+			err = store.Delete(ctx, orphans)
+			if err == nil {
+				err = references.Deleted(ctx, orphans)
+			}
+			if err != nil {
+				return err
+			}
+			c.mu.Lock()
+			c.report.Deleted += len(orphans)
+			c.mu.Unlock()
+			metrics.Add("deleted", int64(len(orphans)))
+			metrics.Add("deleted_bytes", orphanBytes)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
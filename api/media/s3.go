@@ -0,0 +1,64 @@
+package media
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/victorkabata/FixIt-API/api/storage"
+)
+
+//Files in an S3 bucket
+type S3Store struct {
+	Client *s3.S3
+	Bucket string
+}
+
+func NewS3Store(s *session.Session, bucket string) *S3Store {
+	return &S3Store{Client: s3.New(s), Bucket: bucket}
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string, page func([]Object) error) error {
+	var pageErr error
+	err := s.Client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(prefix),
+	}, func(output *s3.ListObjectsV2Output, last bool) bool {
+		objects := []Object{}
+		for _, object := range output.Contents {
+			objects = append(objects, Object{
+				Key:          aws.StringValue(object.Key),
+				Size:         aws.Int64Value(object.Size),
+				LastModified: aws.TimeValue(object.LastModified),
+			})
+		}
+		pageErr = page(objects)
+		return pageErr == nil
+	})
+	if err != nil {
+		return storage.S3Error(err)
+	}
+	return pageErr
+}
+
+//Deletes up to 1000 keys, the most one S3 request takes and the most a listed page holds
+func (s *S3Store) Delete(ctx context.Context, keys []string) error {
+	objects := []*s3.ObjectIdentifier{}
+	for _, key := range keys {
+		objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(key)})
+	}
+	output, err := s.Client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(s.Bucket),
+		Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+	})
+	if err != nil {
+		return storage.S3Error(err)
+	}
+	if len(output.Errors) > 0 {
+		return fmt.Errorf("Deleting %d of %d objects failed, the first %s: %s", len(output.Errors), len(keys),
+			aws.StringValue(output.Errors[0].Key), aws.StringValue(output.Errors[0].Message))
+	}
+	return nil
+}
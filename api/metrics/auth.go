@@ -0,0 +1,14 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+//Checks of passwords, codes and reset links by kind (login, otp or password_reset) and result (success or failure).
+//Tries held back by the attempt delays count as failures.
+var AuthChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "auth_checks_total",
+	Help: "Checks of credentials, codes and reset links.",
+}, []string{"kind", "result"})
+
+func init() {
+	prometheus.MustRegister(AuthChecks)
+}
@@ -0,0 +1,37 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+//Business events counted since the process started, dashboards graph their rate or increase across instances
+var (
+	//By how the account was made: password or the identity provider, such as google
+	Registrations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "registrations_total",
+		Help: "Accounts registered.",
+	}, []string{"method"})
+
+	UsersVerified = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "users_verified_total",
+		Help: "Email addresses verified, by the link in the verification email or by the identity provider at sign up.",
+	})
+
+	BookingsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "bookings_created_total",
+		Help: "Bookings made.",
+	})
+
+	BookingsCompleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "bookings_completed_total",
+		Help: "Bookings marked completed.",
+	})
+
+	//By the status the review got: Published, or Held for moderation
+	ReviewsPosted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "reviews_posted_total",
+		Help: "Reviews posted.",
+	}, []string{"status"})
+)
+
+func init() {
+	prometheus.MustRegister(Registrations, UsersVerified, BookingsCreated, BookingsCompleted, ReviewsPosted)
+}
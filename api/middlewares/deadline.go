@@ -0,0 +1,81 @@
+package middlewares
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//Header the edge proxy or the app sets to how long it waits for the answer, such as 1500 (milliseconds) or 1.5s.
+//It can only shorten the budget of a request.
+const DeadlineHeader = "X-Request-Timeout"
+
+//Routes moving files, which get the long budget, by method and path template
+var longRoutes = map[string]bool{
+	"POST /profile":                    true,
+	"POST /profile/upload-complete":    true,
+	"POST /postpic":                    true,
+	"POST /users/me/gallery":           true,
+	"POST /disputes/{id}/evidence":     true,
+	"PUT /uploads/{id}/parts/{number}": true,
+	"POST /uploads/{id}/complete":      true,
+	"GET /media/":                      true,
+}
+
+func envTimeout(name string, fallback time.Duration) time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || timeout <= 0 {
+		return fallback
+	}
+	return timeout
+}
+
+//Budget of a request: REQUEST_TIMEOUT, or REQUEST_TIMEOUT_LONG for uploads and admin routes, cut down to the
+//X-Request-Timeout header when that is shorter. Read on every request, so a reload changes it.
+func RequestBudget(r *http.Request) time.Duration {
+	handler := database.Handler(r.Context())
+	budget := envTimeout("REQUEST_TIMEOUT", 2*time.Second)
+	if longRoutes[handler] || strings.HasPrefix(handler, r.Method+" /admin/") {
+		budget = envTimeout("REQUEST_TIMEOUT_LONG", time.Minute)
+	}
+
+	header := strings.TrimSpace(r.Header.Get(DeadlineHeader))
+	if header == "" {
+		return budget
+	}
+	requested, err := time.ParseDuration(header)
+	if milliseconds, intErr := strconv.Atoi(header); intErr == nil {
+		requested, err = time.Duration(milliseconds)*time.Millisecond, nil
+	}
+	if err == nil && requested > 0 && requested < budget {
+		return requested
+	}
+	return budget
+}
+
+//Gives every request a deadline of its budget. The context carries it to the database, S3 and outside APIs,
+//which give up once it passes, and responses.ERROR answers 504 for what failed because of it.
+//Runs after SetMiddlewareHandlerName, which names the route the budget depends on.
+func SetMiddlewareDeadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//Websockets, such as live tracking, stay open as long as the client wants
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		budget := RequestBudget(r)
+		ctx, cancel := context.WithTimeout(r.Context(), budget)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+		if ctx.Err() == context.DeadlineExceeded {
+			log.Printf("%s ran past its %s budget", database.Handler(ctx), budget)
+		}
+	})
+}
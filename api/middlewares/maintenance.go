@@ -0,0 +1,140 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/cache"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Operator controlled maintenance state
+type Maintenance struct {
+	Enabled    bool   `json:"enabled"`
+	Message    string `json:"message"`
+	RetryAfter int    `json:"retry_after"` //Seconds clients should wait before retrying
+}
+
+//Key of the state in the shared cache
+const maintenanceKey = "maintenance"
+
+//How long an instance answers from its copy of the state before reading the shared one again
+const maintenanceRefresh = 5 * time.Second
+
+//Routes that stay open during maintenance so admins can still sign in and reach /admin/
+var maintenanceExempt = map[string]bool{
+	"/health":                true,
+	"/login":                 true,
+	"/passkeys/login/begin":  true,
+	"/passkeys/login/finish": true,
+	"/auth/google":           true,
+	"/.well-known/jwks.json": true,
+}
+
+var (
+	maintenanceMu     sync.Mutex
+	maintenanceStore  cache.Shared = cache.NewLocal()
+	maintenanceState               = Maintenance{}
+	maintenanceReadAt time.Time
+)
+
+//Keeps the state in the cache shared by every instance, so switching maintenance on one switches it on all
+func UseMaintenanceStore(store cache.Shared) {
+	maintenanceMu.Lock()
+	maintenanceStore = store
+	maintenanceReadAt = time.Time{}
+	maintenanceMu.Unlock()
+}
+
+//Sets the maintenance state from the environment, when MAINTENANCE_MODE is in it. Otherwise the shared
+//state is kept, so an instance starting doesn't end a window switched on at runtime.
+func LoadMaintenanceFromEnv() {
+	if os.Getenv("MAINTENANCE_MODE") == "" {
+		return
+	}
+	enabled, _ := strconv.ParseBool(os.Getenv("MAINTENANCE_MODE"))
+	retryAfter, _ := strconv.Atoi(os.Getenv("MAINTENANCE_RETRY_AFTER"))
+	err := SetMaintenance(context.Background(), Maintenance{
+		Enabled:    enabled,
+		Message:    os.Getenv("MAINTENANCE_MESSAGE"),
+		RetryAfter: retryAfter,
+	})
+	if err != nil {
+		log.Printf("Storing the maintenance state failed: %v", err)
+	}
+}
+
+func SetMaintenance(ctx context.Context, state Maintenance) error {
+	if state.Message == "" {
+		state.Message = "The service is undergoing maintenance. Please try again later."
+	}
+	if state.RetryAfter <= 0 {
+		state.RetryAfter = 300
+	}
+	stored, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	err = maintenanceStore.Set(ctx, maintenanceKey, stored, 0)
+	if err != nil {
+		return err
+	}
+	maintenanceState, maintenanceReadAt = state, time.Now()
+	return nil
+}
+
+//Shared maintenance state, as read at most maintenanceRefresh ago. The last state read is kept while
+//the shared cache can't be reached.
+func GetMaintenance(ctx context.Context) Maintenance {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	if time.Since(maintenanceReadAt) < maintenanceRefresh {
+		return maintenanceState
+	}
+	maintenanceReadAt = time.Now()
+
+	stored, found, err := maintenanceStore.Get(ctx, maintenanceKey)
+	if err != nil {
+		log.Printf("Reading the maintenance state failed: %v", err)
+		return maintenanceState
+	}
+	state := Maintenance{}
+	if found && json.Unmarshal(stored, &state) != nil {
+		return maintenanceState
+	}
+	maintenanceState = state
+	return maintenanceState
+}
+
+//Answers 503 to every route except health checks, sign in and admin routes while in maintenance.
+func SetMiddlewareMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if maintenanceExempt[r.URL.Path] || strings.HasPrefix(r.URL.Path, "/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		state := GetMaintenance(r.Context())
+		if !state.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", strconv.Itoa(state.RetryAfter))
+		responses.JSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"message":     state.Message,
+			"maintenance": true,
+			"retry_after": state.RetryAfter,
+		})
+	})
+}
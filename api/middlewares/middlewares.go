@@ -1,10 +1,17 @@
 package middlewares
 
 import (
+	"crypto/subtle"
 	"errors"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 
+	"github.com/gorilla/mux"
 	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/database"
 	"github.com/victorkabata/FixIt-API/api/responses"
 )
 
@@ -16,14 +23,156 @@ func SetMiddlewareJSON(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-//Checks the validity of the tokens provided.
-func SetMiddlewareAuthentication(next http.HandlerFunc) http.HandlerFunc {
+//Checks the token and puts its claims on the request context, where auth.ExtractTokenID and the other
+//helpers of the controllers find them without parsing the token again.
+func Authenticate(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := auth.TokenValid(r)
-		if err != nil {
+		claims, ok := authenticated(w, r)
+		if !ok {
+			return
+		}
+		next(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
+	}
+}
+
+//Claims of a valid token, otherwise it answers 401. Expired tokens are told apart so apps can log in again,
+//and tokens that couldn't be checked get 503 so they retry.
+func authenticated(w http.ResponseWriter, r *http.Request) (*auth.Claims, bool) {
+	claims, err := auth.RequestClaims(r)
+	if err == auth.ErrTokenExpired {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return nil, false
+	}
+	if err == auth.ErrRevocationUnavailable {
+		responses.ERROR(w, http.StatusServiceUnavailable, err)
+		return nil, false
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, false
+	}
+	return claims, true
+}
+
+//Allows only users whose token carries one of the roles, the token is checked like Authenticate does
+func RequireRole(roles ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := authenticated(w, r)
+			if !ok {
+				return
+			}
+			for _, allowed := range roles {
+				if claims.Role == allowed {
+					next(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
+					return
+				}
+			}
+			responses.ERROR(w, http.StatusForbidden, errors.New("Forbidden"))
+		}
+	}
+}
+
+//RequireRole for a group of routes, such as a subrouter used with Use
+func RequireRoleHandler(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return RequireRole(roles...)(next.ServeHTTP)
+	}
+}
+
+//Allows only operators holding the admin API key, for the internal diagnostics listener.
+func SetMiddlewareAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminKey := os.Getenv("ADMIN_API_KEY")
+		if adminKey == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Key")), []byte(adminKey)) != 1 {
 			responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 			return
 		}
 		next(w, r)
 	}
 }
+
+//Rejects app clients older than the configured minimum version.
+func SetMiddlewareAppVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		minVersion := os.Getenv("MIN_APP_VERSION")
+		appVersion := r.Header.Get("X-App-Version")
+
+		if minVersion == "" || appVersion == "" || r.URL.Path == "/app-config" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if CompareVersions(appVersion, minVersion) < 0 {
+			w.Header().Set("Content-Type", "application/json")
+			responses.JSON(w, http.StatusUpgradeRequired, map[string]string{
+				"message":         "Upgrade Required",
+				"app_version":     appVersion,
+				"min_app_version": minVersion,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+//Compares two dotted version strings, returning -1, 0 or 1.
+func CompareVersions(a, b string) int {
+	partsA := strings.Split(strings.TrimPrefix(strings.TrimSpace(a), "v"), ".")
+	partsB := strings.Split(strings.TrimPrefix(strings.TrimSpace(b), "v"), ".")
+
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var numA, numB int
+		if i < len(partsA) {
+			numA, _ = strconv.Atoi(strings.SplitN(partsA[i], "-", 2)[0])
+		}
+		if i < len(partsB) {
+			numB, _ = strconv.Atoi(strings.SplitN(partsB[i], "-", 2)[0])
+		}
+		if numA < numB {
+			return -1
+		}
+		if numA > numB {
+			return 1
+		}
+	}
+	return 0
+}
+
+//Address of the client, taken from X-Forwarded-For when TRUST_PROXY_HEADERS is true.
+func ClientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY_HEADERS") == "true" {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+//Names the matched route on the request context, e.g. "GET /users/{id}", for query logs and metrics.
+func SetMiddlewareHandlerName(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				r = r.WithContext(database.WithHandler(r.Context(), r.Method+" "+template))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+//Allows only scrapers sending METRICS_TOKEN as a bearer token.
+func SetMiddlewareMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := os.Getenv("METRICS_TOKEN")
+		if token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,134 @@
+package middlewares
+
+import (
+	"errors"
+	"expvar"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/reputation"
+	"github.com/victorkabata/FixIt-API/api/responses"
+)
+
+//Requests turned away for going over the limit
+var rateLimited = expvar.NewInt("rate_limited_requests")
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+//Limits requests per client address in fixed windows. Addresses with a bad reputation are
+//blocked outright and doubtful ones get half the limit.
+type RateLimiter struct {
+	mu         sync.Mutex
+	windows    map[string]*rateWindow
+	limit      int
+	Window     time.Duration
+	Reputation *reputation.Checker
+}
+
+func NewRateLimiter(limit int, window time.Duration, checker *reputation.Checker) *RateLimiter {
+	return &RateLimiter{windows: map[string]*rateWindow{}, limit: limit, Window: window, Reputation: checker}
+}
+
+//Requests per minute allowed on the auth routes, AUTH_RATE_LIMIT in the environment
+func AuthRateLimit() int {
+	limit, err := strconv.Atoi(os.Getenv("AUTH_RATE_LIMIT"))
+	if err != nil || limit <= 0 {
+		return 10
+	}
+	return limit
+}
+
+//Requests per minute allowed on the address suggestions, PLACES_RATE_LIMIT in the environment
+func PlacesRateLimit() int {
+	limit, err := strconv.Atoi(os.Getenv("PLACES_RATE_LIMIT"))
+	if err != nil || limit <= 0 {
+		return 30
+	}
+	return limit
+}
+
+//Requests per minute allowed on the signup availability check, AVAILABILITY_RATE_LIMIT in the environment
+func AvailabilityRateLimit() int {
+	limit, err := strconv.Atoi(os.Getenv("AVAILABILITY_RATE_LIMIT"))
+	if err != nil || limit <= 0 {
+		return 30
+	}
+	return limit
+}
+
+//Limiter for the login, registration and recovery routes
+func NewAuthRateLimiter() *RateLimiter {
+	return NewRateLimiter(AuthRateLimit(), time.Minute, reputation.Default())
+}
+
+//Change the requests allowed per window, counts of the current windows are kept
+func (l *RateLimiter) SetLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+}
+
+func (l *RateLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+//Counts the request and returns how long the client must wait when it is over the limit
+func (l *RateLimiter) take(ip string, limit int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	window, ok := l.windows[ip]
+	if !ok || now.Sub(window.start) >= l.Window {
+		//Drop finished windows so the map doesn't grow forever
+		for other, w := range l.windows {
+			if now.Sub(w.start) >= l.Window {
+				delete(l.windows, other)
+			}
+		}
+		window = &rateWindow{start: now}
+		l.windows[ip] = window
+	}
+
+	window.count++
+	if window.count > limit {
+		return window.start.Add(l.Window).Sub(now)
+	}
+	return 0
+}
+
+//Rejects blocked addresses and clients over the limit.
+func (l *RateLimiter) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := ClientIP(r)
+
+		limit := l.Limit()
+		if l.Reputation != nil {
+			blocked, verdict := l.Reputation.Blocked(r.Context(), ip, "ratelimit")
+			if blocked {
+				responses.ERROR(w, http.StatusForbidden, errors.New("Forbidden"))
+				return
+			}
+			if verdict.Score*2 >= l.Reputation.BlockScore() && limit > 1 {
+				limit /= 2
+			}
+		}
+
+		wait := l.take(ip, limit)
+		if wait > 0 {
+			rateLimited.Add(1)
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			responses.ERROR(w, http.StatusTooManyRequests, errors.New("Too Many Requests"))
+			return
+		}
+		next(w, r)
+	}
+}
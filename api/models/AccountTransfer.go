@@ -0,0 +1,290 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/utils/encryption"
+	"golang.org/x/crypto/hkdf"
+)
+
+//Format version written into every account export
+const accountExportVersion = 3
+
+var (
+	ErrMissingTransferKey = errors.New("ACCOUNT_TRANSFER_KEY must be set to the same secret on both deployments")
+	ErrExportNotOpened    = errors.New("Export Cannot Be Decrypted, Check ACCOUNT_TRANSFER_KEY")
+)
+
+//Accounts moved to another deployment of the API, see ExportAccounts
+type AccountExport struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Accounts   []AccountTransfer `json:"accounts"`
+}
+
+//An account with what it logs in with, so its owner keeps their password, second factor, passkeys and
+//sign in providers. User carries the whole account as its owner sees it.
+type AccountTransfer struct {
+	User         User   `json:"user"`
+	PasswordHash string `json:"password_hash"`
+	//Stored number, the user's is blank for the placeholders of provider sign ups
+	Phone           string             `json:"phone"`
+	TwoFactorSecret string             `json:"two_factor_secret,omitempty"`
+	RecoveryCodes   []string           `json:"recovery_codes"` //Hashes of the unused codes
+	Identities      []IdentityTransfer `json:"identities"`
+	Passkeys        []PasskeyTransfer  `json:"passkeys"`
+}
+
+//Linked sign in provider account, see Identity
+type IdentityTransfer struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+//Registered passkey, see WebAuthnCredential
+type PasskeyTransfer struct {
+	CredentialID   string     `json:"credential_id"`
+	PublicKey      []byte     `json:"public_key"`
+	Algorithm      int        `json:"algorithm"`
+	SignCount      uint32     `json:"sign_count"`
+	Name           string     `json:"name"`
+	BackupEligible bool       `json:"synced"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+//File written by SealAccountExport. The export is encrypted with AES-GCM, which also detects changes to it,
+//under a key derived from ACCOUNT_TRANSFER_KEY and the salt.
+type sealedAccountExport struct {
+	Salt   string `json:"salt"`
+	Export string `json:"export"`
+}
+
+//Key of an export, derived from the secret shared by the deployments exporting and importing accounts,
+//ACCOUNT_TRANSFER_KEY in the environment, and the salt of the file
+func accountTransferKey(salt []byte) ([]byte, error) {
+	secret := os.Getenv("ACCOUNT_TRANSFER_KEY")
+	if len(secret) < 32 {
+		return nil, ErrMissingTransferKey
+	}
+	key := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), salt, []byte("fixit account export")), key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+//Reads the accounts with the ids, or every account when there are none. Deleted accounts are left out.
+func ExportAccounts(ctx context.Context, db *gorm.DB, uids []uint32) (*AccountExport, error) {
+	db = database.WithContext(ctx, db)
+
+	users := []User{}
+	query := db.Debug().Model(&User{}).Order("id asc")
+	if len(uids) > 0 {
+		query = query.Where("id in (?)", uids)
+	}
+	err := query.Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	err = LoadUserProfiles(ctx, db, users)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &AccountExport{Version: accountExportVersion, ExportedAt: time.Now().UTC(), Accounts: []AccountTransfer{}}
+	for _, user := range users {
+		transfer := AccountTransfer{User: user, PasswordHash: user.Password, Phone: user.Phone, TwoFactorSecret: user.TwoFactorSecret, RecoveryCodes: []string{}, Identities: []IdentityTransfer{}, Passkeys: []PasskeyTransfer{}}
+		transfer.User.ShowToOwner()
+
+		codes := []RecoveryCode{}
+		err = db.Debug().Model(&RecoveryCode{}).Where("user_id = ? and used_at is null", user.ID).Find(&codes).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, code := range codes {
+			transfer.RecoveryCodes = append(transfer.RecoveryCodes, code.CodeHash)
+		}
+
+		identities := []Identity{}
+		err = db.Debug().Model(&Identity{}).Where("user_id = ?", user.ID).Find(&identities).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, identity := range identities {
+			transfer.Identities = append(transfer.Identities, IdentityTransfer{Provider: identity.Provider, Subject: identity.Subject, Email: identity.Email, CreatedAt: identity.CreatedAt})
+		}
+
+		passkeys := []WebAuthnCredential{}
+		err = db.Debug().Model(&WebAuthnCredential{}).Where("user_id = ?", user.ID).Find(&passkeys).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, passkey := range passkeys {
+			transfer.Passkeys = append(transfer.Passkeys, PasskeyTransfer{
+				CredentialID:   passkey.CredentialID,
+				PublicKey:      passkey.PublicKey,
+				Algorithm:      passkey.Algorithm,
+				SignCount:      passkey.SignCount,
+				Name:           passkey.Name,
+				BackupEligible: passkey.BackupEligible,
+				LastUsedAt:     passkey.LastUsedAt,
+				CreatedAt:      passkey.CreatedAt,
+			})
+		}
+		export.Accounts = append(export.Accounts, transfer)
+	}
+	return export, nil
+}
+
+//Encodes the export encrypted with ACCOUNT_TRANSFER_KEY, it holds password hashes and second factor secrets
+func SealAccountExport(export *AccountExport) ([]byte, error) {
+	salt := make([]byte, 16)
+	_, err := io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return nil, err
+	}
+	key, err := accountTransferKey(salt)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(export)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := encryption.EncryptWithKey(key, encoded)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(sealedAccountExport{Salt: base64.StdEncoding.EncodeToString(salt), Export: sealed})
+}
+
+//Decodes an export made by SealAccountExport, refusing it unless it was encrypted with ACCOUNT_TRANSFER_KEY
+//and is unchanged
+func OpenAccountExport(sealed []byte) (*AccountExport, error) {
+	file := sealedAccountExport{}
+	err := json.Unmarshal(sealed, &file)
+	if err != nil {
+		return nil, err
+	}
+	salt, err := base64.StdEncoding.DecodeString(file.Salt)
+	if err != nil || len(salt) == 0 {
+		return nil, ErrExportNotOpened
+	}
+	key, err := accountTransferKey(salt)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := encryption.DecryptWithKey(key, file.Export)
+	if err != nil {
+		return nil, ErrExportNotOpened
+	}
+
+	export := &AccountExport{}
+	err = json.Unmarshal(encoded, export)
+	if err != nil {
+		return nil, err
+	}
+	if export.Version != accountExportVersion {
+		return nil, fmt.Errorf("Unsupported export version %d", export.Version)
+	}
+	return export, nil
+}
+
+//Creates the exported account under a new ID with its password hash, second factor, passkeys and linked
+//providers as they were. Accounts whose username, email or phone number is taken here are refused with a
+//DuplicateUserError, and nothing of an account is kept unless all of it is.
+func ImportAccount(ctx context.Context, db *gorm.DB, transfer *AccountTransfer) (*User, error) {
+	db = database.WithContext(ctx, db)
+
+	user := transfer.User
+	user.ID = 0
+	user.Phone = transfer.Phone
+	user.TwoFactorSecret = transfer.TwoFactorSecret
+	user.DeletedAt = nil
+	user.DeletionScheduledAt = nil
+	passwordHash := transfer.PasswordHash
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		existing := User{}
+		err := tx.Debug().Unscoped().Model(&User{}).Where("email = ? or username = ? or phone = ?", user.Email, user.Username, user.Phone).Take(&existing).Error
+		if err == nil {
+			return user.duplicateOf(&existing)
+		}
+		if !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+
+		err = tx.Debug().Create(&user).Error
+		if err != nil {
+			if field, ok := duplicateKeyField(err); ok {
+				return &DuplicateUserError{Field: field}
+			}
+			return err
+		}
+		//Saving hashes the password again, the exported hash goes back in unchanged
+		err = tx.Debug().Model(&User{}).Where("id = ?", user.ID).UpdateColumns(map[string]interface{}{"password": passwordHash, "created_at": transfer.User.CreatedAt}).Error
+		if err != nil {
+			return err
+		}
+		user.Password = passwordHash
+		err = tx.Debug().Model(&UserProfile{}).Create(&UserProfile{UserID: user.ID, Address: user.Address, Metadata: user.Metadata, UpdatedAt: time.Now()}).Error
+		if err != nil {
+			return err
+		}
+
+		for _, hash := range transfer.RecoveryCodes {
+			err = tx.Debug().Model(&RecoveryCode{}).Create(&RecoveryCode{UserID: user.ID, CodeHash: hash, CreatedAt: time.Now()}).Error
+			if err != nil {
+				return err
+			}
+		}
+		for _, identity := range transfer.Identities {
+			err = tx.Debug().Model(&Identity{}).Create(&Identity{UserID: user.ID, Provider: identity.Provider, Subject: identity.Subject, Email: identity.Email, CreatedAt: identity.CreatedAt, UpdatedAt: time.Now()}).Error
+			if _, duplicate := database.DuplicateKey(err); duplicate {
+				return ErrIdentityAlreadyLinked
+			}
+			if err != nil {
+				return err
+			}
+		}
+		for _, passkey := range transfer.Passkeys {
+			err = tx.Debug().Model(&WebAuthnCredential{}).Create(&WebAuthnCredential{
+				UserID:         user.ID,
+				CredentialID:   passkey.CredentialID,
+				PublicKey:      passkey.PublicKey,
+				Algorithm:      passkey.Algorithm,
+				SignCount:      passkey.SignCount,
+				Name:           passkey.Name,
+				BackupEligible: passkey.BackupEligible,
+				LastUsedAt:     passkey.LastUsedAt,
+				CreatedAt:      passkey.CreatedAt,
+			}).Error
+			if _, duplicate := database.DuplicateKey(err); duplicate {
+				return ErrPasskeyRegistered
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return &User{}, err
+	}
+	return &user, nil
+}
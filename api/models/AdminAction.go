@@ -0,0 +1,193 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//What an admin did to an account
+const (
+	AdminBan           = "ban"
+	AdminUnban         = "unban"
+	AdminUnlock        = "unlock"
+	AdminPasswordReset = "password_reset"
+	AdminVerifyEmail   = "verify_email"
+	AdminVerifyPhone   = "verify_phone"
+)
+
+var (
+	ErrUserBanned    = errors.New("User Already Banned")
+	ErrUserNotBanned = errors.New("User Not Banned")
+	ErrUserNotLocked = errors.New("User Not Locked")
+)
+
+//Change an admin made to a user's account, kept when the account is deleted so the history stays whole
+type AdminAction struct {
+	ID        uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	AdminID   uint32    `gorm:"not null;index" json:"admin_id"`
+	UserID    uint32    `gorm:"not null;index" json:"user_id"`
+	Action    string    `gorm:"size:30;not null" json:"action"`
+	Reason    string    `gorm:"size:255;not null;default:''" json:"reason"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP;index" json:"created_at"`
+}
+
+//Applies the change to the user and records it in the same transaction, a user that doesn't exist is an error
+func recordAdminAction(ctx context.Context, db *gorm.DB, adminID, uid uint32, action, reason string, apply func(tx *gorm.DB, user *User) error) (*User, error) {
+	db = database.WithContext(ctx, db)
+
+	user := User{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Debug().Model(&User{}).Set("gorm:query_option", "FOR UPDATE").Where("id = ?", uid).Take(&user).Error
+		if gorm.IsRecordNotFoundError(err) {
+			return errors.New("User Not Found")
+		}
+		if err != nil {
+			return err
+		}
+		err = apply(tx, &user)
+		if err != nil {
+			return err
+		}
+		return tx.Debug().Model(&AdminAction{}).Create(&AdminAction{AdminID: adminID, UserID: uid, Action: action, Reason: reason, CreatedAt: time.Now()}).Error
+	})
+	if err != nil {
+		return &User{}, err
+	}
+	return &user, nil
+}
+
+//Bans the user for good, unlike a lock the owner can't lift it. Their tokens are revoked and their devices
+//forgotten, so they are logged out everywhere.
+func BanUser(ctx context.Context, db *gorm.DB, adminID, uid uint32, reason string) (*User, error) {
+	return recordAdminAction(ctx, db, adminID, uid, AdminBan, reason, func(tx *gorm.DB, user *User) error {
+		if user.BannedAt != nil {
+			return ErrUserBanned
+		}
+		now := time.Now()
+		err := tx.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumns(
+			map[string]interface{}{
+				"banned_at":          now,
+				"tokens_valid_after": now,
+				"updated_at":         now,
+			},
+		).Error
+		if err != nil {
+			return err
+		}
+		user.BannedAt = &now
+		return tx.Debug().Where("user_id = ?", uid).Delete(&Device{}).Error
+	})
+}
+
+//Lifts the ban of the user, they log in again as before
+func UnbanUser(ctx context.Context, db *gorm.DB, adminID, uid uint32, reason string) (*User, error) {
+	return recordAdminAction(ctx, db, adminID, uid, AdminUnban, reason, func(tx *gorm.DB, user *User) error {
+		if user.BannedAt == nil {
+			return ErrUserNotBanned
+		}
+		user.BannedAt = nil
+		return tx.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumns(
+			map[string]interface{}{
+				"banned_at":  nil,
+				"updated_at": time.Now(),
+			},
+		).Error
+	})
+}
+
+//Lifts the lock of the user whatever locked it, a suspension, a rejected risk review or a reverted change
+func UnlockUser(ctx context.Context, db *gorm.DB, adminID, uid uint32, reason string) (*User, error) {
+	return recordAdminAction(ctx, db, adminID, uid, AdminUnlock, reason, func(tx *gorm.DB, user *User) error {
+		if !user.Locked {
+			return ErrUserNotLocked
+		}
+		user.Locked, user.LockReason = false, ""
+		return tx.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumns(
+			map[string]interface{}{
+				"locked":      false,
+				"lock_reason": "",
+				"updated_at":  time.Now(),
+			},
+		).Error
+	})
+}
+
+//Logs the user out everywhere and keeps them from logging in until they reset their password
+func RequirePasswordReset(ctx context.Context, db *gorm.DB, adminID, uid uint32, reason string) (*User, error) {
+	return recordAdminAction(ctx, db, adminID, uid, AdminPasswordReset, reason, func(tx *gorm.DB, user *User) error {
+		now := time.Now()
+		user.PasswordResetRequired = true
+		return tx.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumns(
+			map[string]interface{}{
+				"password_reset_required": true,
+				"tokens_valid_after":      now,
+				"updated_at":              now,
+			},
+		).Error
+	})
+}
+
+//Marks the user's email or phone number verified, for owners who proved it some other way
+func VerifyUserManually(ctx context.Context, db *gorm.DB, adminID, uid uint32, action, reason string) (*User, error) {
+	column := "verified"
+	if action == AdminVerifyPhone {
+		column = "phone_verified"
+	}
+	return recordAdminAction(ctx, db, adminID, uid, action, reason, func(tx *gorm.DB, user *User) error {
+		if action == AdminVerifyPhone && !user.HasPhone() {
+			return apierror.Invalid("field", "User Has No Phone Number")
+		}
+		user.Verified = user.Verified || action == AdminVerifyEmail
+		user.PhoneVerified = user.PhoneVerified || action == AdminVerifyPhone
+		return tx.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumns(
+			map[string]interface{}{
+				column:       true,
+				"updated_at": time.Now(),
+			},
+		).Error
+	})
+}
+
+//Changes admins made to accounts, newest first, narrowed to one user or one admin when their IDs are given
+func FindAdminActions(ctx context.Context, db *gorm.DB, uid, adminID uint32, page PageRequest) (*[]AdminAction, *PageInfo, error) {
+	db = database.WithContext(ctx, db)
+
+	page.normalize()
+	info := PageInfo{PerPage: page.PerPage}
+	if page.Cursor == "" {
+		info.Page = page.Page
+	}
+
+	search := &searchBuilder{}
+	if uid != 0 {
+		search.where("user_id = ?", uid)
+	}
+	if adminID != 0 {
+		search.where("admin_id = ?", adminID)
+	}
+	err := search.apply(db.Debug().Model(&AdminAction{})).Count(&info.Total).Error
+	if err != nil {
+		return &[]AdminAction{}, &PageInfo{}, err
+	}
+
+	query, err := page.apply(search.apply(db.Debug().Model(&AdminAction{})).Order("created_at desc, id desc"))
+	if err != nil {
+		return &[]AdminAction{}, &PageInfo{}, err
+	}
+	actions := []AdminAction{}
+	err = query.Find(&actions).Error
+	if err != nil {
+		return &[]AdminAction{}, &PageInfo{}, err
+	}
+	if len(actions) > page.PerPage {
+		actions = actions[:page.PerPage]
+		last := actions[len(actions)-1]
+		info.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	return &actions, &info, nil
+}
@@ -0,0 +1,213 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//Most users a bulk operation can touch at once
+const MaxBulkUsers = 100
+
+//Records only the owner uses, deleted along with the account
+func userPrivateRecords() []interface{} {
+	return []interface{}{&Device{}, &RecoveryCode{}, &SecurityChange{}, &GalleryItem{}, &ServiceOffering{}, &Notification{}, &PayoutAccount{}, &CalendarFeed{}, &RiskAssessment{}, &LoginCode{}, &PasswordReset{}, &Identity{}, &IdentityLink{}, &VerificationAttempt{}, &Upload{}, &MarketingConsent{}, &ProviderVerification{}, &AvailabilitySlot{}, &PhoneCode{}, &ProviderStats{}, &WebAuthnCredential{}, &Session{}, &UserProfile{}}
+}
+
+//Columns pointing at a user on records that are kept, moved over when accounts are merged
+var userReferences = []struct {
+	Model  interface{}
+	Column string
+}{
+	{&Post{}, "user_id"}, {&Post{}, "worker_id"},
+	{&Booking{}, "user_id"},
+	{&Work{}, "user_id"}, {&Work{}, "worker_id"},
+	{&Review{}, "user_id"}, {&Review{}, "worker_id"},
+	{&Transaction{}, "user_id"}, {&Transaction{}, "worker_id"},
+	{&Quote{}, "author_id"},
+	{&Payment{}, "user_id"},
+	{&Dispute{}, "user_id"},
+	{&DeepLink{}, "user_id"},
+	{&ReviewRequest{}, "customer_id"}, {&ReviewRequest{}, "provider_id"},
+	{&GalleryItem{}, "user_id"},
+	{&ServiceOffering{}, "user_id"},
+	{&Notification{}, "user_id"},
+	{&Device{}, "user_id"},
+	{&Identity{}, "user_id"},
+	{&StoredObject{}, "user_id"},
+}
+
+//What a bulk admin operation changed, or would change on a dry run
+type AdminOperationResult struct {
+	Operation string           `json:"operation"`
+	DryRun    bool             `json:"dry_run"`
+	UserIDs   []uint32         `json:"user_ids"`
+	Affected  map[string]int64 `json:"affected"` //Rows by table, or table.column for moved references
+}
+
+func (a *AdminOperationResult) count(tx *gorm.DB, key string) {
+	if tx.RowsAffected > 0 {
+		a.Affected[key] += tx.RowsAffected
+	}
+}
+
+//Runs the operation in a transaction, a dry run reports the same changes and rolls them back
+func runAdminOperation(ctx context.Context, db *gorm.DB, operation string, dryRun bool, apply func(tx *gorm.DB, result *AdminOperationResult) error) (*AdminOperationResult, error) {
+	db = database.WithContext(ctx, db)
+
+	result := &AdminOperationResult{Operation: operation, DryRun: dryRun, UserIDs: []uint32{}, Affected: map[string]int64{}}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return &AdminOperationResult{}, tx.Error
+	}
+
+	err := apply(tx, result)
+	if err != nil {
+		tx.Rollback()
+		return &AdminOperationResult{}, err
+	}
+
+	if dryRun {
+		err = tx.Rollback().Error
+	} else {
+		err = tx.Commit().Error
+	}
+	if err != nil {
+		return &AdminOperationResult{}, err
+	}
+	return result, nil
+}
+
+//Ids of the given users that exist, locked for the rest of the transaction
+func lockUsers(tx *gorm.DB, uids []uint32) ([]uint32, error) {
+	if len(uids) == 0 || len(uids) > MaxBulkUsers {
+		return nil, errors.New("Between 1 and 100 Users Required")
+	}
+
+	users := []User{}
+	err := tx.Debug().Model(&User{}).Set("gorm:query_option", "FOR UPDATE").Where("id IN (?)", uids).Order("id asc").Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+
+	found := []uint32{}
+	for _, user := range users {
+		found = append(found, user.ID)
+	}
+	return found, nil
+}
+
+//Delete the users right away along with their private records
+func BulkDeleteUsers(ctx context.Context, db *gorm.DB, uids []uint32, dryRun bool) (*AdminOperationResult, error) {
+	return runAdminOperation(ctx, db, "delete", dryRun, func(tx *gorm.DB, result *AdminOperationResult) error {
+		found, err := lockUsers(tx, uids)
+		if err != nil {
+			return err
+		}
+		result.UserIDs = found
+		if len(found) == 0 {
+			return nil
+		}
+
+		for _, record := range userPrivateRecords() {
+			deleted := tx.Debug().Where("user_id IN (?)", found).Delete(record)
+			if deleted.Error != nil {
+				return deleted.Error
+			}
+			result.count(deleted, tx.NewScope(record).TableName())
+		}
+
+		deleted := tx.Debug().Unscoped().Where("id IN (?)", found).Delete(&User{})
+		if deleted.Error != nil {
+			return deleted.Error
+		}
+		result.count(deleted, "users")
+		return nil
+	})
+}
+
+//Lock the users out of their accounts and sign out their devices
+func BulkSuspendUsers(ctx context.Context, db *gorm.DB, uids []uint32, dryRun bool) (*AdminOperationResult, error) {
+	return runAdminOperation(ctx, db, "suspend", dryRun, func(tx *gorm.DB, result *AdminOperationResult) error {
+		found, err := lockUsers(tx, uids)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			return nil
+		}
+
+		//Only the users that weren't locked already
+		users := []User{}
+		err = tx.Debug().Model(&User{}).Where("id IN (?) and locked = ?", found, false).Order("id asc").Find(&users).Error
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			result.UserIDs = append(result.UserIDs, user.ID)
+		}
+		if len(result.UserIDs) == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		updated := tx.Debug().Model(&User{}).Where("id IN (?)", result.UserIDs).UpdateColumns(map[string]interface{}{"locked": true, "lock_reason": LockSuspended, "tokens_valid_after": now, "updated_at": now})
+		if updated.Error != nil {
+			return updated.Error
+		}
+		result.count(updated, "users")
+
+		deleted := tx.Debug().Where("user_id IN (?)", result.UserIDs).Delete(&Device{})
+		if deleted.Error != nil {
+			return deleted.Error
+		}
+		result.count(deleted, "devices")
+		return nil
+	})
+}
+
+//Move everything of the source account over to the target account and delete the source
+func MergeUsers(ctx context.Context, db *gorm.DB, sourceID, targetID uint32, dryRun bool) (*AdminOperationResult, error) {
+	if sourceID == targetID {
+		return &AdminOperationResult{}, errors.New("Cannot Merge An Account Into Itself")
+	}
+
+	return runAdminOperation(ctx, db, "merge", dryRun, func(tx *gorm.DB, result *AdminOperationResult) error {
+		found, err := lockUsers(tx, []uint32{sourceID, targetID})
+		if err != nil {
+			return err
+		}
+		if len(found) != 2 {
+			return errors.New("User Not Found")
+		}
+		result.UserIDs = []uint32{sourceID, targetID}
+
+		for _, reference := range userReferences {
+			moved := tx.Debug().Model(reference.Model).Where(reference.Column+" = ?", sourceID).UpdateColumn(reference.Column, targetID)
+			if moved.Error != nil {
+				return moved.Error
+			}
+			result.count(moved, tx.NewScope(reference.Model).TableName()+"."+reference.Column)
+		}
+
+		//Secrets and settings of the source account aren't carried over
+		for _, record := range userPrivateRecords() {
+			deleted := tx.Debug().Where("user_id = ?", sourceID).Delete(record)
+			if deleted.Error != nil {
+				return deleted.Error
+			}
+			result.count(deleted, tx.NewScope(record).TableName())
+		}
+
+		deleted := tx.Debug().Unscoped().Where("id = ?", sourceID).Delete(&User{})
+		if deleted.Error != nil {
+			return deleted.Error
+		}
+		result.count(deleted, "users")
+		return nil
+	})
+}
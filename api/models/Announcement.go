@@ -0,0 +1,145 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//States of an announcement
+const (
+	AnnouncementQueued  = "queued"
+	AnnouncementSending = "sending"
+	AnnouncementSent    = "sent"
+)
+
+//Message from the admins to every user, or to those in a region or with a specialisation.
+//Delivered in batches by the send-announcements job, Cursor is the last user it reached.
+type Announcement struct {
+	ID             uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	Title          string     `gorm:"size:255;not null" json:"title"`
+	Body           string     `gorm:"size:1000;not null" json:"body"`
+	Region         string     `gorm:"size:255;not null;default:''" json:"region"`         //Only users in the region, all regions when empty
+	Specialisation string     `gorm:"size:255;not null;default:''" json:"specialisation"` //Only providers with the specialisation, all users when empty
+	Digest         bool       `gorm:"not null;default:false" json:"digest"`               //Emailed in digests instead of right away
+	Marketing      bool       `gorm:"not null;default:false" json:"marketing"`            //Promotional, only users who opted in to marketing get it
+	Status         string     `gorm:"size:20;not null;index" json:"status"`
+	Cursor         uint32     `gorm:"not null;default:0" json:"-"`
+	Recipients     int        `gorm:"not null;default:0" json:"recipients"`
+	SentAt         *time.Time `json:"sent_at"`
+	CreatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (a *Announcement) Prepare() {
+	a.ID = 0
+	a.Title = strings.TrimSpace(a.Title)
+	a.Body = strings.TrimSpace(a.Body)
+	a.Region = html.EscapeString(strings.TrimSpace(a.Region))
+	a.Specialisation = html.EscapeString(strings.TrimSpace(a.Specialisation))
+	a.Status = AnnouncementQueued
+	a.Cursor = 0
+	a.Recipients = 0
+	a.SentAt = nil
+	a.CreatedAt = time.Now()
+	a.UpdatedAt = time.Now()
+}
+
+func (a *Announcement) Validate() error {
+	if a.Title == "" {
+		return apierror.Invalid("title", "Required Title")
+	}
+	if len(a.Title) > 255 {
+		return errors.New("Title Too Long")
+	}
+	if a.Body == "" {
+		return apierror.Invalid("body", "Required Body")
+	}
+	if len(a.Body) > 1000 {
+		return errors.New("Body Too Long")
+	}
+	return nil
+}
+
+//Queue the announcement for the send-announcements job
+func (a *Announcement) SaveAnnouncement(ctx context.Context, db *gorm.DB) (*Announcement, error) {
+	db = database.WithContext(ctx, db)
+
+	err := db.Debug().Model(&Announcement{}).Create(&a).Error
+	if err != nil {
+		return &Announcement{}, err
+	}
+	return a, nil
+}
+
+//Latest announcements
+func FindAnnouncements(ctx context.Context, db *gorm.DB) (*[]Announcement, error) {
+	db = database.WithContext(ctx, db)
+
+	announcements := []Announcement{}
+	err := db.Debug().Model(&Announcement{}).Order("created_at desc").Limit(100).Find(&announcements).Error
+	if err != nil {
+		return &[]Announcement{}, err
+	}
+	return &announcements, nil
+}
+
+//Announcements still being delivered, oldest first
+func FindPendingAnnouncements(ctx context.Context, db *gorm.DB) (*[]Announcement, error) {
+	db = database.WithContext(ctx, db)
+
+	announcements := []Announcement{}
+	err := db.Debug().Model(&Announcement{}).Where("status in (?)", []string{AnnouncementQueued, AnnouncementSending}).
+		Order("created_at asc").Find(&announcements).Error
+	if err != nil {
+		return &[]Announcement{}, err
+	}
+	return &announcements, nil
+}
+
+//IDs of the next users the announcement goes to, after its cursor
+func (a *Announcement) NextRecipients(ctx context.Context, db *gorm.DB, limit int) ([]uint32, error) {
+	db = database.WithContext(ctx, db)
+
+	search := &searchBuilder{}
+	search.where("id > ?", a.Cursor)
+	if a.Region != "" {
+		search.where("region = ?", a.Region)
+	}
+	if a.Specialisation != "" {
+		search.contains("specialisation", a.Specialisation)
+	}
+	if a.Marketing {
+		search.where("id in (?)", db.Model(&MarketingConsent{}).Select("user_id").
+			Where("opted_in_at is not null and withdrawn_at is null").SubQuery())
+	}
+	uids := []uint32{}
+	err := search.apply(db.Debug().Model(&User{})).Order("id asc").Limit(limit).Pluck("id", &uids).Error
+	return uids, err
+}
+
+//Move the cursor past the users the announcement was delivered to, marking it sent when there are none left
+func (a *Announcement) RecordDelivery(ctx context.Context, db *gorm.DB, cursor uint32, delivered int, done bool) error {
+	db = database.WithContext(ctx, db)
+
+	now := time.Now()
+	a.Cursor, a.Recipients, a.Status = cursor, a.Recipients+delivered, AnnouncementSending
+	columns := map[string]interface{}{
+		"cursor":     cursor,
+		"recipients": gorm.Expr("recipients + ?", delivered),
+		"status":     AnnouncementSending,
+		"updated_at": now,
+	}
+	if done {
+		a.Status, a.SentAt = AnnouncementSent, &now
+		columns["status"] = AnnouncementSent
+		columns["sent_at"] = now
+	}
+	return db.Debug().Model(&Announcement{}).Where("id = ?", a.ID).UpdateColumns(columns).Error
+}
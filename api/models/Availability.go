@@ -0,0 +1,103 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//Hours a provider takes work on one day of the week, in their local time as HH:MM
+type AvailabilitySlot struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"-"`
+	UserID    uint32    `gorm:"not null;index" json:"-"`
+	Weekday   int       `gorm:"not null" json:"weekday"` //0 is Sunday, like time.Weekday
+	Starts    string    `gorm:"size:5;not null" json:"starts"`
+	Ends      string    `gorm:"size:5;not null" json:"ends"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"-"`
+}
+
+//Most slots a provider can have in a week, a few per day
+const MaxAvailabilitySlots = 28
+
+func (s *AvailabilitySlot) Validate() error {
+	if s.Weekday < int(time.Sunday) || s.Weekday > int(time.Saturday) {
+		return errors.New("Invalid Weekday")
+	}
+	starts, err := time.Parse("15:04", s.Starts)
+	if err != nil {
+		return errors.New("Invalid Start Time")
+	}
+	ends, err := time.Parse("15:04", s.Ends)
+	if err != nil {
+		return errors.New("Invalid End Time")
+	}
+	if !ends.After(starts) {
+		return errors.New("End Time Is Before Start Time")
+	}
+	//Stored zero padded, so the times sort and compare as text
+	s.Starts, s.Ends = starts.Format("15:04"), ends.Format("15:04")
+	return nil
+}
+
+//The provider's week, by day and then start time
+func FindAvailability(ctx context.Context, db *gorm.DB, uid uint32) (*[]AvailabilitySlot, error) {
+	db = database.WithContext(ctx, db)
+
+	slots := []AvailabilitySlot{}
+	err := db.Debug().Model(&AvailabilitySlot{}).Where("user_id = ?", uid).Order("weekday asc, starts asc").Find(&slots).Error
+	if err != nil {
+		return &[]AvailabilitySlot{}, err
+	}
+	return &slots, nil
+}
+
+//Whether the provider set any hours
+func HasAvailability(ctx context.Context, db *gorm.DB, uid uint32) (bool, error) {
+	db = database.WithContext(ctx, db)
+
+	count := 0
+	err := db.Debug().Model(&AvailabilitySlot{}).Where("user_id = ?", uid).Count(&count).Error
+	return count > 0, err
+}
+
+//Replace the provider's week with the slots, an empty list clears it. Slots of a day must not overlap.
+func SetAvailability(ctx context.Context, db *gorm.DB, uid uint32, slots []AvailabilitySlot) (*[]AvailabilitySlot, error) {
+	db = database.WithContext(ctx, db)
+
+	if len(slots) > MaxAvailabilitySlots {
+		return &[]AvailabilitySlot{}, errors.New("Too Many Availability Slots")
+	}
+	for i := range slots {
+		if err := slots[i].Validate(); err != nil {
+			return &[]AvailabilitySlot{}, err
+		}
+		for j := 0; j < i; j++ {
+			//HH:MM compares in time order as text
+			if slots[i].Weekday == slots[j].Weekday && slots[i].Starts < slots[j].Ends && slots[j].Starts < slots[i].Ends {
+				return &[]AvailabilitySlot{}, errors.New("Overlapping Availability Slots")
+			}
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Debug().Where("user_id = ?", uid).Delete(&AvailabilitySlot{}).Error
+		if err != nil {
+			return err
+		}
+		for i := range slots {
+			slots[i].ID, slots[i].UserID, slots[i].CreatedAt = 0, uid, time.Now()
+			err = tx.Debug().Model(&AvailabilitySlot{}).Create(&slots[i]).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return &[]AvailabilitySlot{}, err
+	}
+	return FindAvailability(ctx, db, uid)
+}
@@ -1,25 +1,29 @@
 package models
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"html"
 	"strings"
 	"time"
 
 	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/database"
 )
 
 type Booking struct {
-	ID        uint32    `gorm:"primary_key;auto_increment" json:"id"`
-	UserID    uint32    `gorm:"not null" json:"user_id"`
-	PostID    uint32    `gorm:"not null" json:"post_id"`
-	Comment   string    `gorm:"not null" json:"comment"`
-	Bid       string    `gorm:"not null" json:"bid"`
-	Status    string    `gorm:"not null" json:"status"`
-	User      User      `json:"user"`
-	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	ID            uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID        uint32     `gorm:"not null" json:"user_id"`
+	PostID        uint32     `gorm:"not null" json:"post_id"`
+	Comment       string     `gorm:"not null" json:"comment"`
+	Bid           string     `gorm:"not null" json:"bid"`
+	Status        string     `gorm:"not null" json:"status"`
+	PaymentStatus string     `gorm:"size:20;not null;default:'Unpaid'" json:"payment_status"` //Unpaid until a deposit is started through a payment gateway
+	ScheduledAt   *time.Time `json:"scheduled_at"`                                            //When the job is to be done, if agreed
+	User          User       `json:"user"`
+	CreatedAt     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
 }
 
 func (b *Booking) Prepare() {
@@ -27,6 +31,7 @@ func (b *Booking) Prepare() {
 	b.Comment = html.EscapeString(strings.TrimSpace(b.Comment))
 	b.Bid = html.EscapeString(strings.TrimSpace(b.Bid))
 	b.Status = "Pending"
+	b.PaymentStatus = PaymentUnpaid
 	b.User = User{}
 	b.CreatedAt = time.Now()
 	b.UpdatedAt = time.Now()
@@ -35,21 +40,22 @@ func (b *Booking) Prepare() {
 func (b *Booking) Validate() error {
 
 	if b.Comment == "" {
-		return errors.New("Required Comment")
+		return apierror.Invalid("comment", "Required Comment")
 	}
 	if b.Bid == "" {
-		return errors.New("Required Bid")
+		return apierror.Invalid("bid", "Required Bid")
 	}
 	if b.UserID < 1 {
-		return errors.New("Required User ID")
+		return apierror.Invalid("user_id", "Required User ID")
 	}
 	if b.PostID < 1 {
-		return errors.New("Required Post ID")
+		return apierror.Invalid("post_id", "Required Post ID")
 	}
 	return nil
 }
 
-func (b *Booking) FindAllBookings(db *gorm.DB) (*[]Booking, error) {
+func (b *Booking) FindAllBookings(ctx context.Context, db *gorm.DB) (*[]Booking, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 
 	booking := []Booking{}
@@ -72,7 +78,8 @@ func (b *Booking) FindAllBookings(db *gorm.DB) (*[]Booking, error) {
 }
 
 //Create a new booking for a post.
-func (b *Booking) SaveBooking(db *gorm.DB) (*Booking, error) {
+func (b *Booking) SaveBooking(ctx context.Context, db *gorm.DB) (*Booking, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 	err = db.Debug().Model(&Booking{}).Create(&b).Error
 	if err != nil {
@@ -89,11 +96,12 @@ func (b *Booking) SaveBooking(db *gorm.DB) (*Booking, error) {
 }
 
 //Update the status of an existing booking.
-func (b *Booking) UpdateABooking(db *gorm.DB, pid uint64) (*Booking, error) {
+func (b *Booking) UpdateABooking(ctx context.Context, db *gorm.DB, pid uint64) (*Booking, error) {
+	db = database.WithContext(ctx, db)
 
 	var err error
 
-	err = db.Debug().Model(&Booking{}).Where("id = ?", pid).UpdateColumns(Booking{Status: b.Status, UpdatedAt: time.Now()}).Error
+	err = db.Debug().Model(&Booking{}).Where("id = ?", pid).UpdateColumns(Booking{Status: b.Status, ScheduledAt: b.ScheduledAt, UpdatedAt: time.Now()}).Error
 	if err != nil {
 		return &Booking{}, err
 	}
@@ -0,0 +1,193 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
+)
+
+//How long a calendar event lasts when the booking doesn't say
+const calendarEventDuration = time.Hour
+
+//Calendar feed of a provider's accepted bookings. The feed URL is signed with the nonce,
+//so replacing or deleting the nonce revokes every URL handed out before.
+type CalendarFeed struct {
+	UserID    uint32    `gorm:"primary_key;auto_increment:false" json:"user_id"`
+	Nonce     string    `gorm:"size:32;not null" json:"-"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func calendarFeedMessage(uid uint32, nonce string) string {
+	return fmt.Sprintf("calendar:%d:%s", uid, nonce)
+}
+
+//Signature carried by the feed URL
+func (c *CalendarFeed) Signature() string {
+	return tokens.Sign(os.Getenv("API_SECRET"), calendarFeedMessage(c.UserID, c.Nonce))
+}
+
+//Public URL of the feed
+func (c *CalendarFeed) URL() string {
+	return fmt.Sprintf("%s/calendar/%d/bookings.ics?sig=%s", AppBaseURL(), c.UserID, c.Signature())
+}
+
+//Create the user's feed, or replace its signature which revokes the old URL
+func (c *CalendarFeed) RotateCalendarFeed(ctx context.Context, db *gorm.DB, uid uint32) (*CalendarFeed, error) {
+	db = database.WithContext(ctx, db)
+
+	nonce, err := tokens.Generate(32)
+	if err != nil {
+		return &CalendarFeed{}, err
+	}
+
+	c.UserID = uid
+	c.Nonce = nonce
+	c.CreatedAt = time.Now()
+	err = db.Debug().Model(&CalendarFeed{}).Save(&c).Error
+	if err != nil {
+		return &CalendarFeed{}, err
+	}
+	return c, nil
+}
+
+//Revoke the user's feed
+func (c *CalendarFeed) DeleteCalendarFeed(ctx context.Context, db *gorm.DB, uid uint32) (int64, error) {
+	db = database.WithContext(ctx, db)
+
+	db = db.Debug().Model(&CalendarFeed{}).Where("user_id = ?", uid).Delete(&CalendarFeed{})
+	if db.Error != nil {
+		return 0, db.Error
+	}
+	return db.RowsAffected, nil
+}
+
+//Find the feed of a user if the signature is still valid
+func (c *CalendarFeed) VerifyCalendarFeed(ctx context.Context, db *gorm.DB, uid uint32, signature string) error {
+	db = database.WithContext(ctx, db)
+
+	err := db.Debug().Model(&CalendarFeed{}).Where("user_id = ?", uid).Take(&c).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return errors.New("Invalid Calendar Link")
+	}
+	if err != nil {
+		return err
+	}
+	if !tokens.Verify(os.Getenv("API_SECRET"), calendarFeedMessage(c.UserID, c.Nonce), signature) {
+		return errors.New("Invalid Calendar Link")
+	}
+	return nil
+}
+
+//Booking shown in a calendar together with the job it is for
+type CalendarBooking struct {
+	Booking
+	Post Post
+}
+
+//Get the accepted bookings of a provider for their calendar
+func FindCalendarBookings(ctx context.Context, db *gorm.DB, uid uint32) (*[]CalendarBooking, error) {
+	db = database.WithContext(ctx, db)
+
+	bookings := []Booking{}
+	err := db.Debug().Model(&Booking{}).Where("user_id = ? and status in (?)", uid, []string{BookingConfirmed, BookingCompleted}).Order("id desc").Limit(500).Find(&bookings).Error
+	if err != nil {
+		return &[]CalendarBooking{}, err
+	}
+
+	entries := []CalendarBooking{}
+	for _, booking := range bookings {
+		post := Post{}
+		err = db.Debug().Model(&Post{}).Where("id = ?", booking.PostID).Take(&post).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return &[]CalendarBooking{}, err
+		}
+		entries = append(entries, CalendarBooking{Booking: booking, Post: post})
+	}
+	return &entries, nil
+}
+
+//Render bookings as an iCalendar feed. Events keep their UID across fetches so calendar apps update them in place.
+func BookingsICS(entries []CalendarBooking) string {
+	var feed strings.Builder
+
+	line := func(format string, args ...interface{}) {
+		feed.WriteString(icsFold(fmt.Sprintf(format, args...)))
+		feed.WriteString("\r\n")
+	}
+	stamp := func(t time.Time) string {
+		return t.UTC().Format("20060102T150405Z")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//FixIt//Bookings//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:FixIt bookings")
+	for _, entry := range entries {
+		summary := entry.Post.Category
+		if summary == "" {
+			summary = fmt.Sprintf("Booking #%d", entry.ID)
+		}
+
+		line("BEGIN:VEVENT")
+		line("UID:fixit-booking-%d", entry.ID)
+		line("DTSTAMP:%s", stamp(entry.UpdatedAt))
+		line("LAST-MODIFIED:%s", stamp(entry.UpdatedAt))
+		line("SEQUENCE:%d", entry.UpdatedAt.Unix())
+		if entry.ScheduledAt != nil {
+			line("DTSTART:%s", stamp(*entry.ScheduledAt))
+			line("DTEND:%s", stamp(entry.ScheduledAt.Add(calendarEventDuration)))
+		} else {
+			//Unscheduled bookings show as an all day event on the day they were accepted
+			line("DTSTART;VALUE=DATE:%s", entry.UpdatedAt.UTC().Format("20060102"))
+		}
+		line("SUMMARY:%s", icsEscape(html.UnescapeString(summary)))
+		if entry.Post.Description != "" {
+			line("DESCRIPTION:%s", icsEscape(html.UnescapeString(entry.Post.Description)))
+		}
+		if entry.Post.Address != "" {
+			line("LOCATION:%s", icsEscape(html.UnescapeString(entry.Post.Address)))
+		}
+		if entry.Post.Latitude != 0 || entry.Post.Longitude != 0 {
+			line("GEO:%f;%f", entry.Post.Latitude, entry.Post.Longitude)
+		}
+		line("STATUS:CONFIRMED")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+
+	return feed.String()
+}
+
+//Escape the characters reserved by the iCalendar format
+func icsEscape(value string) string {
+	return vCardEscape(value)
+}
+
+//Fold lines longer than the 75 octets iCalendar allows
+func icsFold(value string) string {
+	if len(value) <= 75 {
+		return value
+	}
+
+	var folded strings.Builder
+	width := 0
+	for _, r := range value {
+		size := len(string(r))
+		if width+size > 75 {
+			folded.WriteString("\r\n ")
+			width = 1
+		}
+		folded.WriteRune(r)
+		width += size
+	}
+	return folded.String()
+}
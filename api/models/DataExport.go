@@ -0,0 +1,436 @@
+package models
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/storage"
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
+)
+
+//How long the download link of an export works before the archive is deleted
+const DataExportLinkLifetime = 72 * time.Hour
+
+//How long the code emailed for a protected export works
+const DataExportCodeLifetime = 15 * time.Minute
+
+//How long a build may run before another instance takes the export over
+const dataExportBuildLease = 30 * time.Minute
+
+const (
+	DataExportPending    = "pending"
+	DataExportBuilding   = "building"
+	DataExportReady      = "ready"
+	DataExportDownloaded = "downloaded"
+	DataExportFailed     = "failed"
+	DataExportExpired    = "expired"
+)
+
+//Codes of protected exports
+const AttemptsDataExportCode = "data_export_code"
+
+var (
+	ErrExportInProgress  = errors.New("Export Already In Progress")
+	ErrInvalidExportLink = errors.New("Invalid Download Link")
+	ErrInvalidExportCode = errors.New("Invalid Verification Code")
+)
+
+//Archive of everything kept about a user, stored privately and downloaded once through an emailed link.
+//Protected exports also need a code sent to the user's email when the link is opened.
+type DataExport struct {
+	ID     uint64 `gorm:"primary_key;auto_increment" json:"id"`
+	UserID uint32 `gorm:"not null;index" json:"user_id"`
+	//Random ID in front of the download token, so links can't be found by counting
+	PublicID  string `gorm:"size:32;not null;default:'';index" json:"-"`
+	Status    string `gorm:"size:20;not null;index" json:"status"`
+	Protected bool   `gorm:"not null;default:false" json:"protected"`
+	FileKey   string `gorm:"size:255;not null;default:''" json:"-"`
+	Size      int64  `gorm:"not null;default:0" json:"size"`
+	TokenHash string `gorm:"size:64;not null;default:''" json:"-"`
+	//Tries at the token, counted on the export so other people's guesses can't throw it away
+	TokenAttempts int        `gorm:"not null;default:0" json:"-"`
+	TokenRetryAt  *time.Time `json:"-"`
+	CodeHash      string     `gorm:"size:64;not null;default:''" json:"-"`
+	CodeExpiresAt *time.Time `json:"-"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	DownloadedAt  *time.Time `json:"downloaded_at"`
+	Error         string     `gorm:"size:255;not null;default:''" json:"error,omitempty"`
+	CreatedAt     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+//Records of the user that go in the archive, by the column pointing at them
+var userExportRecords = []struct {
+	Model  interface{}
+	Column string
+}{
+	{&Post{}, "user_id"},
+	{&Booking{}, "user_id"},
+	{&Work{}, "user_id"},
+	{&Review{}, "user_id"},
+	{&Transaction{}, "user_id"},
+	{&Quote{}, "author_id"},
+	{&Payment{}, "user_id"},
+	{&Dispute{}, "user_id"},
+	{&GalleryItem{}, "user_id"},
+	{&ServiceOffering{}, "user_id"},
+	{&Notification{}, "user_id"},
+	{&Device{}, "user_id"},
+	{&Identity{}, "user_id"},
+	{&SecurityChange{}, "user_id"},
+	{&PayoutAccount{}, "user_id"},
+	{&MarketingConsent{}, "user_id"},
+	{&ProviderVerification{}, "user_id"},
+	{&AvailabilitySlot{}, "user_id"},
+	{&WebAuthnCredential{}, "user_id"},
+	{&Session{}, "user_id"},
+}
+
+//Queue an export of the user's data, one at a time
+func RequestDataExport(ctx context.Context, db *gorm.DB, uid uint32, protected bool) (*DataExport, error) {
+	db = database.WithContext(ctx, db)
+
+	count := 0
+	err := db.Debug().Model(&DataExport{}).Where("user_id = ? and status in (?)", uid, []string{DataExportPending, DataExportBuilding}).Count(&count).Error
+	if err != nil {
+		return &DataExport{}, err
+	}
+	if count > 0 {
+		return &DataExport{}, ErrExportInProgress
+	}
+
+	export := DataExport{
+		UserID:    uid,
+		Status:    DataExportPending,
+		Protected: protected,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	err = db.Debug().Model(&DataExport{}).Create(&export).Error
+	if err != nil {
+		return &DataExport{}, err
+	}
+	return &export, nil
+}
+
+//Exports of the user, latest first
+func FindUserDataExports(ctx context.Context, db *gorm.DB, uid uint32) (*[]DataExport, error) {
+	db = database.WithContext(ctx, db)
+
+	exports := []DataExport{}
+	err := db.Debug().Model(&DataExport{}).Where("user_id = ?", uid).Order("id desc").Limit(20).Find(&exports).Error
+	return &exports, err
+}
+
+//Take the exports waiting to be built, and ones whose build stopped with its instance
+func ClaimPendingDataExports(ctx context.Context, db *gorm.DB, now time.Time, limit int) (*[]DataExport, error) {
+	db = database.WithContext(ctx, db)
+
+	due := []DataExport{}
+	err := db.Debug().Model(&DataExport{}).Where("status = ? or (status = ? and updated_at <= ?)", DataExportPending, DataExportBuilding, now.Add(-dataExportBuildLease)).
+		Order("id asc").Limit(limit).Find(&due).Error
+	if err != nil {
+		return &[]DataExport{}, err
+	}
+
+	claimed := []DataExport{}
+	for _, export := range due {
+		claim := db.Debug().Model(&DataExport{}).Where("id = ? and status = ? and updated_at = ?", export.ID, export.Status, export.UpdatedAt).UpdateColumns(
+			map[string]interface{}{
+				"status":     DataExportBuilding,
+				"updated_at": now,
+			},
+		)
+		if claim.Error != nil {
+			return &claimed, claim.Error
+		}
+		if claim.RowsAffected == 1 {
+			export.Status, export.UpdatedAt = DataExportBuilding, now
+			claimed = append(claimed, export)
+		}
+	}
+	return &claimed, nil
+}
+
+//Zip archive with the user's account and a JSON file per kind of record
+func BuildUserArchive(ctx context.Context, db *gorm.DB, uid uint32) ([]byte, error) {
+	db = database.WithContext(ctx, db)
+
+	user := User{}
+	err := db.Debug().Model(&User{}).Where("id = ?", uid).Take(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	err = user.LoadProfile(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	user.ShowToOwner()
+
+	buffer := &bytes.Buffer{}
+	archive := zip.NewWriter(buffer)
+	err = writeArchiveJSON(archive, "account.json", user)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range userExportRecords {
+		rows := reflect.New(reflect.SliceOf(reflect.TypeOf(record.Model).Elem()))
+		err = db.Debug().Model(record.Model).Where(record.Column+" = ?", uid).Find(rows.Interface()).Error
+		if err != nil {
+			return nil, err
+		}
+		if rows.Elem().Len() == 0 {
+			continue
+		}
+		err = writeArchiveJSON(archive, db.NewScope(record.Model).TableName()+".json", rows.Interface())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = archive.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func writeArchiveJSON(archive *zip.Writer, name string, value interface{}) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+//Store the archive privately and make the export ready, returning the download token to email
+func (e *DataExport) Store(ctx context.Context, db *gorm.DB, store storage.Storage, archive []byte) (string, error) {
+	db = database.WithContext(ctx, db)
+
+	key := "exports/" + strconv.FormatUint(uint64(e.UserID), 10) + "/" + bson.NewObjectId().Hex() + ".zip"
+	err := store.UploadPrivate(ctx, key, bytes.NewReader(archive), "application/zip")
+	if err != nil {
+		return "", err
+	}
+
+	publicID, err := tokens.Generate(32)
+	if err != nil {
+		return "", err
+	}
+	secret, err := tokens.Generate(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	expires := now.Add(DataExportLinkLifetime)
+	e.Status, e.FileKey, e.Size, e.PublicID, e.TokenHash, e.ExpiresAt = DataExportReady, key, int64(len(archive)), publicID, tokens.Hash(secret), &expires
+	err = db.Debug().Model(&DataExport{}).Where("id = ?", e.ID).UpdateColumns(
+		map[string]interface{}{
+			"status":         e.Status,
+			"file_key":       e.FileKey,
+			"size":           e.Size,
+			"public_id":      e.PublicID,
+			"token_hash":     e.TokenHash,
+			"token_attempts": 0,
+			"token_retry_at": nil,
+			"expires_at":     expires,
+			"updated_at":     now,
+		},
+	).Error
+	if err != nil {
+		return "", err
+	}
+	//The public ID in front finds the export, so wrong secrets can be counted against it
+	return e.PublicID + "." + secret, nil
+}
+
+//Record why the archive couldn't be built
+func (e *DataExport) Fail(ctx context.Context, db *gorm.DB, failure error) error {
+	db = database.WithContext(ctx, db)
+
+	e.Status, e.Error = DataExportFailed, failure.Error()
+	if len(e.Error) > 255 {
+		e.Error = e.Error[:255]
+	}
+	return db.Debug().Model(&DataExport{}).Where("id = ?", e.ID).UpdateColumns(
+		map[string]interface{}{
+			"status":     e.Status,
+			"error":      e.Error,
+			"updated_at": time.Now(),
+		},
+	).Error
+}
+
+//Find the ready export of a download token and check its secret. Tries are counted on the export and wait
+//longer after each wrong one, like codes, but the link is never thrown away for them.
+func OpenDataExport(ctx context.Context, db *gorm.DB, token string) (*DataExport, error) {
+	db = database.WithContext(ctx, db)
+
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return &DataExport{}, ErrInvalidExportLink
+	}
+
+	now := time.Now()
+	tx := db.Begin()
+	if tx.Error != nil {
+		return &DataExport{}, tx.Error
+	}
+	export := DataExport{}
+	err := tx.Debug().Model(&DataExport{}).Set("gorm:query_option", "FOR UPDATE").
+		Where("public_id = ? and status = ? and expires_at > ?", parts[0], DataExportReady, now).Take(&export).Error
+	if gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return &DataExport{}, ErrInvalidExportLink
+	}
+	if err != nil {
+		tx.Rollback()
+		return &DataExport{}, err
+	}
+	if export.TokenRetryAt != nil && now.Before(*export.TokenRetryAt) {
+		tx.Rollback()
+		return &DataExport{}, &TooManyAttemptsError{RetryAt: *export.TokenRetryAt}
+	}
+
+	//The row is locked while the try is counted, so parallel guesses can't get around the delays
+	valid := subtle.ConstantTimeCompare([]byte(tokens.Hash(parts[1])), []byte(export.TokenHash)) == 1
+	columns := map[string]interface{}{"token_attempts": 0, "token_retry_at": nil}
+	if !valid {
+		export.TokenAttempts++
+		columns["token_attempts"], columns["token_retry_at"] = export.TokenAttempts, now.Add(verificationDelay(export.TokenAttempts))
+	}
+	err = tx.Debug().Model(&DataExport{}).Where("id = ?", export.ID).UpdateColumns(columns).Error
+	if err != nil {
+		tx.Rollback()
+		return &DataExport{}, err
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return &DataExport{}, err
+	}
+	if !valid {
+		return &DataExport{}, ErrInvalidExportLink
+	}
+	return &export, nil
+}
+
+//Replace the code of a protected export with a new one and return it in plain form
+func (e *DataExport) IssueCode(ctx context.Context, db *gorm.DB) (string, error) {
+	db = database.WithContext(ctx, db)
+
+	code, err := tokens.Generate(8)
+	if err != nil {
+		return "", err
+	}
+	code = strings.ToUpper(code)
+
+	expires := time.Now().Add(DataExportCodeLifetime)
+	e.CodeHash, e.CodeExpiresAt = tokens.Hash(code), &expires
+	err = db.Debug().Model(&DataExport{}).Where("id = ?", e.ID).UpdateColumns(
+		map[string]interface{}{
+			"code_hash":       e.CodeHash,
+			"code_expires_at": expires,
+			"updated_at":      time.Now(),
+		},
+	).Error
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+//Check the emailed code of a protected export, too many wrong tries throw the code away
+func (e *DataExport) CheckCode(ctx context.Context, db *gorm.DB, code string) error {
+	db = database.WithContext(ctx, db)
+
+	attempts, err := StartVerificationAttempt(ctx, db, e.UserID, AttemptsDataExportCode)
+	if err != nil {
+		return err
+	}
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+	valid := e.CodeHash != "" && e.CodeExpiresAt != nil && e.CodeExpiresAt.After(time.Now()) &&
+		subtle.ConstantTimeCompare([]byte(tokens.Hash(code)), []byte(e.CodeHash)) == 1
+	if !valid {
+		if attempts >= MaxVerificationAttempts {
+			err = db.Debug().Model(&DataExport{}).Where("id = ?", e.ID).UpdateColumns(
+				map[string]interface{}{"code_hash": "", "code_expires_at": nil, "updated_at": time.Now()},
+			).Error
+			if err == nil {
+				err = ClearVerificationAttempts(ctx, db, e.UserID, AttemptsDataExportCode)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return ErrInvalidExportCode
+	}
+	return ClearVerificationAttempts(ctx, db, e.UserID, AttemptsDataExportCode)
+}
+
+//Use the link up, only the first of downloads racing each other gets the archive
+func (e *DataExport) ClaimDownload(ctx context.Context, db *gorm.DB) error {
+	db = database.WithContext(ctx, db)
+
+	now := time.Now()
+	claim := db.Debug().Model(&DataExport{}).Where("id = ? and status = ?", e.ID, DataExportReady).UpdateColumns(
+		map[string]interface{}{
+			"status":        DataExportDownloaded,
+			"downloaded_at": now,
+			"code_hash":     "",
+			"updated_at":    now,
+		},
+	)
+	if claim.Error != nil {
+		return claim.Error
+	}
+	if claim.RowsAffected == 0 {
+		return ErrInvalidExportLink
+	}
+	e.Status, e.DownloadedAt = DataExportDownloaded, &now
+	return nil
+}
+
+//Archives to delete: ones whose link expired or was never sent, and downloaded ones once the signed link to them stopped working
+func FindStaleDataExports(ctx context.Context, db *gorm.DB, now time.Time) (*[]DataExport, error) {
+	db = database.WithContext(ctx, db)
+
+	stale := []DataExport{}
+	err := db.Debug().Model(&DataExport{}).Where("file_key <> ''").
+		Where("(status = ? and expires_at <= ?) or status in (?) or (status = ? and downloaded_at <= ?)",
+			DataExportReady, now, []string{DataExportExpired, DataExportFailed}, DataExportDownloaded, now.Add(-PrivateFileURLLifetime)).
+		Limit(100).Find(&stale).Error
+	return &stale, err
+}
+
+//Delete the archive of the export from storage, keeping the record
+func (e *DataExport) DeleteArchive(ctx context.Context, db *gorm.DB, store storage.Storage) error {
+	db = database.WithContext(ctx, db)
+
+	err := store.Delete(ctx, e.FileKey)
+	if err != nil {
+		return err
+	}
+
+	columns := map[string]interface{}{"file_key": "", "updated_at": time.Now()}
+	if e.Status == DataExportReady {
+		e.Status = DataExportExpired
+		columns["status"] = e.Status
+	}
+	e.FileKey = ""
+	return db.Debug().Model(&DataExport{}).Where("id = ?", e.ID).UpdateColumns(columns).Error
+}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
+)
+
+//Kinds of app screens a deep link can point to
+var deepLinkKinds = map[string]bool{
+	"profile": true,
+	"booking": true,
+	"review":  true,
+}
+
+type DeepLink struct {
+	ID        uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	Code      string     `gorm:"size:32;not null;unique" json:"code"`
+	Kind      string     `gorm:"size:20;not null" json:"kind"`
+	TargetID  uint32     `gorm:"not null" json:"target_id"`
+	UserID    uint32     `gorm:"not null" json:"user_id"`
+	Short     bool       `gorm:"not null" json:"short"`
+	Opens     uint32     `gorm:"not null;default:0" json:"opens"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	URL       string     `gorm:"-" json:"url"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+//Record of a deep link being opened, used for attribution
+type DeepLinkOpen struct {
+	ID         uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	DeepLinkID uint64    `gorm:"not null;index" json:"deep_link_id"`
+	UserAgent  string    `gorm:"size:255" json:"user_agent"`
+	IPAddress  string    `gorm:"size:45" json:"ip_address"`
+	Referrer   string    `gorm:"size:255" json:"referrer"`
+	CreatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (d *DeepLink) Prepare() {
+	d.ID = 0
+	d.Code = ""
+	d.Opens = 0
+	d.Kind = strings.ToLower(strings.TrimSpace(d.Kind))
+	d.CreatedAt = time.Now()
+}
+
+func (d *DeepLink) Validate() error {
+	if !deepLinkKinds[d.Kind] {
+		return errors.New("Invalid Link Kind")
+	}
+	if d.TargetID < 1 {
+		return apierror.Invalid("target_id", "Required Target ID")
+	}
+	if d.UserID < 1 {
+		return apierror.Invalid("user_id", "Required User ID")
+	}
+	if d.ExpiresAt != nil && d.ExpiresAt.Before(time.Now()) {
+		return errors.New("Expiry Must Be In The Future")
+	}
+	return nil
+}
+
+//Message covered by the link signature
+func (d *DeepLink) signedPayload() string {
+	var expiry int64
+	if d.ExpiresAt != nil {
+		expiry = d.ExpiresAt.Unix()
+	}
+	return fmt.Sprintf("%s:%s:%d:%d", d.Code, d.Kind, d.TargetID, expiry)
+}
+
+//Base URL of the web app that links sent to users point to
+func AppBaseURL() string {
+	baseURL := os.Getenv("APP_LINK_BASE_URL")
+	if baseURL == "" {
+		baseURL = "https://fixit.app"
+	}
+	return strings.TrimRight(baseURL, "/")
+}
+
+//Build the public URL of the link, short or signed
+func (d *DeepLink) BuildURL() string {
+	baseURL := AppBaseURL()
+
+	if d.Short {
+		return baseURL + "/l/" + d.Code
+	}
+
+	query := url.Values{}
+	query.Set("code", d.Code)
+	query.Set("kind", d.Kind)
+	query.Set("id", fmt.Sprintf("%d", d.TargetID))
+	if d.ExpiresAt != nil {
+		query.Set("exp", fmt.Sprintf("%d", d.ExpiresAt.Unix()))
+	}
+	query.Set("sig", tokens.Sign(os.Getenv("API_SECRET"), d.signedPayload()))
+	return baseURL + "/links/open?" + query.Encode()
+}
+
+//Check the signature of a signed link against the stored link
+func (d *DeepLink) VerifySignature(signature string) bool {
+	return tokens.Verify(os.Getenv("API_SECRET"), d.signedPayload(), signature)
+}
+
+func (d *DeepLink) Expired() bool {
+	return d.ExpiresAt != nil && d.ExpiresAt.Before(time.Now())
+}
+
+//Save a new deep link with a unique code. Short codes can collide, a taken one is replaced by another
+//a few times before giving up.
+func (d *DeepLink) SaveDeepLink(ctx context.Context, db *gorm.DB) (*DeepLink, error) {
+	db = database.WithContext(ctx, db)
+	var err error
+
+	length := 24
+	if d.Short {
+		length = 7
+	}
+	for attempt := 0; ; attempt++ {
+		d.Code, err = tokens.Generate(length)
+		if err != nil {
+			return &DeepLink{}, err
+		}
+		err = db.Debug().Model(&DeepLink{}).Create(&d).Error
+		if _, duplicate := database.DuplicateKey(err); !duplicate || attempt == 5 {
+			break
+		}
+	}
+	if err != nil {
+		return &DeepLink{}, err
+	}
+	d.URL = d.BuildURL()
+	return d, nil
+}
+
+//Find a deep link using its code
+func (d *DeepLink) FindDeepLinkByCode(ctx context.Context, db *gorm.DB, code string) (*DeepLink, error) {
+	db = database.WithContext(ctx, db)
+	err := db.Debug().Model(&DeepLink{}).Where("code = ?", code).Take(&d).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &DeepLink{}, errors.New("Link Not Found")
+	}
+	if err != nil {
+		return &DeepLink{}, err
+	}
+	d.URL = d.BuildURL()
+	return d, nil
+}
+
+//Record that the link was opened
+func (d *DeepLink) RecordOpen(ctx context.Context, db *gorm.DB, open DeepLinkOpen) error {
+	db = database.WithContext(ctx, db)
+	open.DeepLinkID = d.ID
+	open.CreatedAt = time.Now()
+
+	err := db.Debug().Model(&DeepLinkOpen{}).Create(&open).Error
+	if err != nil {
+		return err
+	}
+	err = db.Debug().Model(&DeepLink{}).Where("id = ?", d.ID).UpdateColumn("opens", gorm.Expr("opens + ?", 1)).Error
+	if err != nil {
+		return err
+	}
+	d.Opens++
+	return nil
+}
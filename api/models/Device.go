@@ -0,0 +1,151 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+const (
+	maxDevicesPerUser = 10
+	staleDeviceAge    = 90 * 24 * time.Hour
+)
+
+var devicePlatforms = map[string]bool{
+	"android": true,
+	"ios":     true,
+	"web":     true,
+}
+
+//Model of a user's device registered for push notifications
+type Device struct {
+	ID         uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	UserID     uint32    `gorm:"not null;index" json:"user_id"`
+	Platform   string    `gorm:"size:20;not null" json:"platform"`
+	PushToken  string    `gorm:"size:255;not null;unique" json:"push_token"`
+	AppVersion string    `gorm:"size:30" json:"app_version"`
+	Locale     string    `gorm:"size:20" json:"locale"`
+	LastSeenAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"last_seen_at"`
+	CreatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (d *Device) Prepare() {
+	d.ID = 0
+	d.Platform = strings.ToLower(strings.TrimSpace(d.Platform))
+	d.PushToken = strings.TrimSpace(d.PushToken)
+	d.AppVersion = html.EscapeString(strings.TrimSpace(d.AppVersion))
+	d.Locale = html.EscapeString(strings.TrimSpace(d.Locale))
+	d.LastSeenAt = time.Now()
+	d.CreatedAt = time.Now()
+	d.UpdatedAt = time.Now()
+}
+
+func (d *Device) Validate() error {
+	if d.UserID < 1 {
+		return apierror.Invalid("user_id", "Required User ID")
+	}
+	if !devicePlatforms[d.Platform] {
+		return errors.New("Invalid Platform")
+	}
+	if d.PushToken == "" {
+		return apierror.Invalid("push_token", "Required Push Token")
+	}
+	return nil
+}
+
+//Register a device, reusing the existing record when the push token is already known
+func (d *Device) SaveDevice(ctx context.Context, db *gorm.DB) (*Device, error) {
+	db = database.WithContext(ctx, db)
+	var err error
+
+	existing := Device{}
+	err = db.Debug().Model(&Device{}).Where("push_token = ?", d.PushToken).Take(&existing).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return &Device{}, err
+	}
+
+	if existing.ID != 0 {
+		err = db.Debug().Model(&Device{}).Where("id = ?", existing.ID).UpdateColumns(
+			map[string]interface{}{
+				"user_id":      d.UserID,
+				"platform":     d.Platform,
+				"app_version":  d.AppVersion,
+				"locale":       d.Locale,
+				"last_seen_at": time.Now(),
+				"updated_at":   time.Now(),
+			},
+		).Error
+		if err != nil {
+			return &Device{}, err
+		}
+		d.ID = existing.ID
+		d.CreatedAt = existing.CreatedAt
+	} else {
+		err = db.Debug().Model(&Device{}).Create(&d).Error
+		if err != nil {
+			return &Device{}, err
+		}
+	}
+
+	err = PruneDevices(ctx, db, d.UserID)
+	if err != nil {
+		return &Device{}, err
+	}
+	return d, nil
+}
+
+//Get all devices registered by a user
+func (d *Device) FindUserDevices(ctx context.Context, db *gorm.DB, uid uint32) (*[]Device, error) {
+	db = database.WithContext(ctx, db)
+	devices := []Device{}
+
+	err := db.Debug().Model(&Device{}).Where("user_id = ?", uid).Order("last_seen_at desc").Find(&devices).Error
+	if err != nil {
+		return &[]Device{}, err
+	}
+	return &devices, nil
+}
+
+//Remove a device belonging to a user
+func (d *Device) DeleteADevice(ctx context.Context, db *gorm.DB, id uint64, uid uint32) (int64, error) {
+	db = database.WithContext(ctx, db)
+
+	db = db.Debug().Model(&Device{}).Where("id = ? and user_id = ?", id, uid).Take(&Device{}).Delete(&Device{})
+
+	if db.Error != nil {
+		if gorm.IsRecordNotFoundError(db.Error) {
+			return 0, errors.New("Device not found")
+		}
+		return 0, db.Error
+	}
+	return db.RowsAffected, nil
+}
+
+//Drop stale devices and keep only the most recently seen devices of a user
+func PruneDevices(ctx context.Context, db *gorm.DB, uid uint32) error {
+	db = database.WithContext(ctx, db)
+	err := db.Debug().Where("user_id = ? and last_seen_at < ?", uid, time.Now().Add(-staleDeviceAge)).Delete(&Device{}).Error
+	if err != nil {
+		return err
+	}
+
+	devices := []Device{}
+	err = db.Debug().Model(&Device{}).Where("user_id = ?", uid).Order("last_seen_at desc").Offset(maxDevicesPerUser).Limit(100).Find(&devices).Error
+	if err != nil {
+		return err
+	}
+	for i := range devices {
+		err = db.Debug().Where("id = ?", devices[i].ID).Delete(&Device{}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
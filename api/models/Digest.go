@@ -0,0 +1,172 @@
+package models
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//How often a user gets the digest of their low priority notifications, off leaves them in the inbox only
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+	DigestOff    = "off"
+)
+
+var digestPeriods = map[string]time.Duration{
+	DigestDaily:  24 * time.Hour,
+	DigestWeekly: 7 * 24 * time.Hour,
+}
+
+func ValidDigestFrequency(frequency string) bool {
+	_, ok := digestPeriods[frequency]
+	return ok || frequency == DigestOff
+}
+
+//Most notifications one digest lists, older ones are still marked as sent
+const MaxDigestItems = 20
+
+//A user whose digest is due and the notifications that go in it, newest first
+type PendingDigest struct {
+	User          User
+	Notifications []Notification
+	Total         int //Notifications waiting, including those past MaxDigestItems
+}
+
+//Users whose digest is due: a period after their last one, or for their first one after their oldest waiting notification
+func FindDueDigests(ctx context.Context, db *gorm.DB, now time.Time, limit int) (*[]PendingDigest, error) {
+	db = database.WithContext(ctx, db)
+
+	waiting := []struct {
+		UserID uint32
+		Oldest time.Time
+		Total  int
+	}{}
+	err := db.Debug().Model(&Notification{}).Select("user_id, min(created_at) as oldest, count(*) as total").
+		Where("digest = ? and digested_at is null", true).Group("user_id").Order("oldest asc").Scan(&waiting).Error
+	if err != nil {
+		return &[]PendingDigest{}, err
+	}
+
+	due := []PendingDigest{}
+	for _, user := range waiting {
+		if len(due) == limit {
+			break
+		}
+		recipient := User{}
+		err := db.Debug().Model(&User{}).Where("id = ?", user.UserID).Take(&recipient).Error
+		if gorm.IsRecordNotFoundError(err) {
+			continue
+		}
+		if err != nil {
+			return &due, err
+		}
+
+		//Users who turned digests off have theirs marked sent without an email
+		if period, ok := digestPeriods[recipient.DigestFrequency]; ok {
+			last := user.Oldest
+			if recipient.LastDigestAt != nil {
+				last = *recipient.LastDigestAt
+			}
+			if now.Sub(last) < period {
+				continue
+			}
+		}
+
+		notifications := []Notification{}
+		err = db.Debug().Model(&Notification{}).Where("user_id = ? and digest = ? and digested_at is null", user.UserID, true).
+			Order("created_at desc, id desc").Limit(MaxDigestItems).Find(&notifications).Error
+		if err != nil {
+			return &due, err
+		}
+		due = append(due, PendingDigest{User: recipient, Notifications: notifications, Total: user.Total})
+	}
+	return &due, nil
+}
+
+//Mark the notifications of the user waiting since before now as sent in a digest
+func MarkDigestSent(ctx context.Context, db *gorm.DB, uid uint32, now time.Time) error {
+	db = database.WithContext(ctx, db)
+
+	err := db.Debug().Model(&Notification{}).Where("user_id = ? and digest = ? and digested_at is null and created_at <= ?", uid, true, now).
+		UpdateColumn("digested_at", now).Error
+	if err != nil {
+		return err
+	}
+	return db.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumns(
+		map[string]interface{}{
+			"last_digest_at": now,
+			"updated_at":     now,
+		},
+	).Error
+}
+
+//Activity of a provider over the last week
+type WeeklyStats struct {
+	UserID            uint32
+	BookingsCompleted int
+	Reviews           int
+	AverageRating     float64 //Of the reviews of the week, 0 without any
+}
+
+//Stats of the providers with activity in the week before now who haven't had theirs in that week
+func FindWeeklyStats(ctx context.Context, db *gorm.DB, now time.Time) (*[]WeeklyStats, error) {
+	db = database.WithContext(ctx, db)
+	since := now.Add(-digestPeriods[DigestWeekly])
+
+	byUser := map[uint32]*WeeklyStats{}
+	stats := func(uid uint32) *WeeklyStats {
+		if byUser[uid] == nil {
+			byUser[uid] = &WeeklyStats{UserID: uid}
+		}
+		return byUser[uid]
+	}
+
+	completed := []struct {
+		UserID uint32
+		Total  int
+	}{}
+	err := db.Debug().Model(&Booking{}).Select("user_id, count(*) as total").
+		Where("status = ? and updated_at > ?", BookingCompleted, since).Group("user_id").Scan(&completed).Error
+	if err != nil {
+		return &[]WeeklyStats{}, err
+	}
+	for _, row := range completed {
+		stats(row.UserID).BookingsCompleted = row.Total
+	}
+
+	reviews := []struct {
+		WorkerID uint32
+		Total    int
+		Average  float64
+	}{}
+	err = db.Debug().Model(&Review{}).Select("worker_id, count(*) as total, avg(rating) as average").
+		Where("status = ? and created_at > ?", ReviewPublished, since).Group("worker_id").Scan(&reviews).Error
+	if err != nil {
+		return &[]WeeklyStats{}, err
+	}
+	for _, row := range reviews {
+		stats(row.WorkerID).Reviews = row.Total
+		stats(row.WorkerID).AverageRating = math.Round(row.Average*10) / 10
+	}
+
+	sent := []uint32{}
+	err = db.Debug().Model(&Notification{}).Where("kind = ? and created_at > ?", "weekly_stats", since).Pluck("distinct user_id", &sent).Error
+	if err != nil {
+		return &[]WeeklyStats{}, err
+	}
+	for _, uid := range sent {
+		delete(byUser, uid)
+	}
+
+	result := []WeeklyStats{}
+	for _, row := range byUser {
+		result = append(result, *row)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].UserID < result[j].UserID })
+	return &result, nil
+}
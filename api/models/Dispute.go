@@ -0,0 +1,236 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/payments"
+)
+
+//Booking state disputes can be opened on
+const BookingCompleted = "Completed"
+
+//Dispute states
+const (
+	DisputeOpen     = "Open"
+	DisputeResolved = "Resolved"
+	DisputeRejected = "Rejected"
+)
+
+//Disagreement over a completed booking, settled by an admin
+type Dispute struct {
+	ID           uint64            `gorm:"primary_key;auto_increment" json:"id"`
+	BookingID    uint32            `gorm:"not null;index" json:"booking_id"`
+	OpenedBy     uint32            `gorm:"not null" json:"opened_by"`
+	Reason       string            `gorm:"size:1000;not null" json:"reason"`
+	Status       string            `gorm:"size:20;not null" json:"status"`
+	Resolution   string            `gorm:"size:1000" json:"resolution"`
+	RefundAmount float64           `gorm:"not null;default:0" json:"refund_amount"`
+	Evidence     []DisputeEvidence `json:"evidence,omitempty"`
+	History      []DisputeEvent    `json:"history,omitempty"`
+	ResolvedAt   *time.Time        `json:"resolved_at"`
+	CreatedAt    time.Time         `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt    time.Time         `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+//File submitted by a party to support their side of a dispute
+type DisputeEvidence struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	DisputeID uint64    `gorm:"not null;index" json:"dispute_id"`
+	UserID    uint32    `gorm:"not null" json:"user_id"`
+	FileURL   string    `gorm:"size:255;not null" json:"file_url"` //Signed link filled in when the file is private
+	FileKey   string    `gorm:"size:255" json:"-"`                 //Key of the private file, empty for files uploaded public
+	Note      string    `gorm:"size:1000" json:"note"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+//State change of a dispute, ActorID is 0 for admins
+type DisputeEvent struct {
+	ID         uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	DisputeID  uint64    `gorm:"not null;index" json:"dispute_id"`
+	ActorID    uint32    `gorm:"not null" json:"actor_id"`
+	FromStatus string    `gorm:"size:20" json:"from_status"`
+	ToStatus   string    `gorm:"size:20;not null" json:"to_status"`
+	Note       string    `gorm:"size:1000" json:"note"`
+	CreatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (d *Dispute) Prepare() {
+	d.ID = 0
+	d.Reason = html.EscapeString(strings.TrimSpace(d.Reason))
+	d.Status = DisputeOpen
+	d.Resolution = ""
+	d.RefundAmount = 0
+	d.Evidence = nil
+	d.History = nil
+	d.ResolvedAt = nil
+	d.CreatedAt = time.Now()
+	d.UpdatedAt = time.Now()
+}
+
+func (d *Dispute) Validate() error {
+	if d.BookingID < 1 {
+		return apierror.Invalid("booking_id", "Required Booking ID")
+	}
+	if d.OpenedBy < 1 {
+		return apierror.Invalid("user_id", "Required User ID")
+	}
+	if d.Reason == "" {
+		return apierror.Invalid("reason", "Required Reason")
+	}
+	return nil
+}
+
+//Open a dispute on a completed booking, a booking can only have one open dispute
+func (d *Dispute) OpenDispute(ctx context.Context, db *gorm.DB, booking *Booking) (*Dispute, error) {
+	db = database.WithContext(ctx, db)
+
+	if booking.Status != BookingCompleted {
+		return &Dispute{}, errors.New("Only Completed Bookings Can Be Disputed")
+	}
+
+	tx := db.Begin()
+	var open int
+	err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&Dispute{}).Where("booking_id = ? and status = ?", booking.ID, DisputeOpen).Count(&open).Error
+	if err != nil {
+		tx.Rollback()
+		return &Dispute{}, err
+	}
+	if open > 0 {
+		tx.Rollback()
+		return &Dispute{}, errors.New("Booking Already Has An Open Dispute")
+	}
+
+	err = tx.Debug().Model(&Dispute{}).Create(&d).Error
+	if err != nil {
+		tx.Rollback()
+		return &Dispute{}, err
+	}
+	err = tx.Debug().Model(&DisputeEvent{}).Create(&DisputeEvent{DisputeID: d.ID, ActorID: d.OpenedBy, ToStatus: DisputeOpen, Note: d.Reason, CreatedAt: time.Now()}).Error
+	if err != nil {
+		tx.Rollback()
+		return &Dispute{}, err
+	}
+	return d, tx.Commit().Error
+}
+
+//Find a dispute with its evidence and history
+func (d *Dispute) FindDisputeByID(ctx context.Context, db *gorm.DB, id uint64) (*Dispute, error) {
+	db = database.WithContext(ctx, db)
+
+	err := db.Debug().Model(&Dispute{}).Where("id = ?", id).Take(&d).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Dispute{}, errors.New("Dispute not found")
+	}
+	if err != nil {
+		return &Dispute{}, err
+	}
+
+	err = db.Debug().Model(&DisputeEvidence{}).Where("dispute_id = ?", d.ID).Order("id asc").Find(&d.Evidence).Error
+	if err != nil {
+		return &Dispute{}, err
+	}
+	err = db.Debug().Model(&DisputeEvent{}).Where("dispute_id = ?", d.ID).Order("id asc").Find(&d.History).Error
+	if err != nil {
+		return &Dispute{}, err
+	}
+	return d, nil
+}
+
+//Get disputes in a state, oldest first so admins work through them in order
+func (d *Dispute) FindDisputesByStatus(ctx context.Context, db *gorm.DB, status string) (*[]Dispute, error) {
+	db = database.WithContext(ctx, db)
+
+	disputes := []Dispute{}
+	err := db.Debug().Model(&Dispute{}).Where("status = ?", status).Order("created_at asc").Limit(100).Find(&disputes).Error
+	if err != nil {
+		return &[]Dispute{}, err
+	}
+	return &disputes, nil
+}
+
+//Attach evidence to an open dispute
+func (e *DisputeEvidence) SaveDisputeEvidence(ctx context.Context, db *gorm.DB, dispute *Dispute) (*DisputeEvidence, error) {
+	db = database.WithContext(ctx, db)
+
+	if dispute.Status != DisputeOpen {
+		return &DisputeEvidence{}, errors.New("Dispute Is Closed")
+	}
+
+	e.ID = 0
+	e.DisputeID = dispute.ID
+	e.Note = html.EscapeString(strings.TrimSpace(e.Note))
+	e.CreatedAt = time.Now()
+	err := db.Debug().Model(&DisputeEvidence{}).Create(&e).Error
+	if err != nil {
+		return &DisputeEvidence{}, err
+	}
+	return e, nil
+}
+
+//Find the successful payment of a booking, which is what a dispute refunds
+func FindRefundablePayment(ctx context.Context, db *gorm.DB, bid uint32) (*Payment, error) {
+	db = database.WithContext(ctx, db)
+
+	payment := Payment{}
+	err := db.Debug().Model(&Payment{}).Where("booking_id = ? and status = ?", bid, payments.StatusSucceeded).Order("id desc").Take(&payment).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Payment{}, errors.New("Booking Has No Refundable Payment")
+	}
+	if err != nil {
+		return &Payment{}, err
+	}
+	return &payment, nil
+}
+
+//Close an open dispute as resolved or rejected and record it in the history
+func (d *Dispute) CloseDispute(ctx context.Context, db *gorm.DB, status, resolution string, refundAmount float64) (*Dispute, error) {
+	db = database.WithContext(ctx, db)
+
+	if status != DisputeResolved && status != DisputeRejected {
+		return &Dispute{}, errors.New("Invalid Dispute Status")
+	}
+	resolution = html.EscapeString(strings.TrimSpace(resolution))
+	now := time.Now()
+
+	tx := db.Begin()
+	update := tx.Debug().Model(&Dispute{}).Where("id = ? and status = ?", d.ID, DisputeOpen).UpdateColumns(
+		map[string]interface{}{
+			"status":        status,
+			"resolution":    resolution,
+			"refund_amount": refundAmount,
+			"resolved_at":   now,
+			"updated_at":    now,
+		},
+	)
+	if update.Error != nil {
+		tx.Rollback()
+		return &Dispute{}, update.Error
+	}
+	if update.RowsAffected == 0 {
+		tx.Rollback()
+		return &Dispute{}, errors.New("Dispute Is Closed")
+	}
+	err := tx.Debug().Model(&DisputeEvent{}).Create(&DisputeEvent{DisputeID: d.ID, FromStatus: d.Status, ToStatus: status, Note: resolution, CreatedAt: now}).Error
+	if err != nil {
+		tx.Rollback()
+		return &Dispute{}, err
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return &Dispute{}, err
+	}
+
+	d.Status = status
+	d.Resolution = resolution
+	d.RefundAmount = refundAmount
+	d.ResolvedAt = &now
+	d.UpdatedAt = now
+	return d, nil
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//Why email is no longer sent to a user, deliverable addresses have no status
+const (
+	EmailDeliverable = ""
+	EmailBounced     = "bounced"
+	EmailComplained  = "complained"
+)
+
+//Reason of suppressions added by admins
+const EmailSuppressedManually = "manual"
+
+//Address no email is sent to, whether or not a user has it
+type EmailSuppression struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	Address   string    `gorm:"size:100;not null;unique" json:"address"`
+	Reason    string    `gorm:"size:20;not null" json:"reason"` //bounced, complained or manual
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+//Addresses are stored escaped, like the emails of users
+func emailAddress(address string) string {
+	return html.EscapeString(strings.TrimSpace(address))
+}
+
+//Stop sending email to the address, an address already suppressed takes the new reason
+func SuppressEmail(ctx context.Context, db *gorm.DB, address, reason string) error {
+	db = database.WithContext(ctx, db)
+
+	suppression := EmailSuppression{Address: emailAddress(address), Reason: reason, CreatedAt: time.Now()}
+	err := db.Debug().Model(&EmailSuppression{}).Create(&suppression).Error
+	if _, duplicate := duplicateKeyField(err); duplicate {
+		return db.Debug().Model(&EmailSuppression{}).Where("address = ?", suppression.Address).UpdateColumn("reason", reason).Error
+	}
+	return err
+}
+
+//Send email to the address again, returns whether it was suppressed
+func UnsuppressEmail(ctx context.Context, db *gorm.DB, address string) (bool, error) {
+	db = database.WithContext(ctx, db)
+
+	remove := db.Debug().Where("address = ?", emailAddress(address)).Delete(&EmailSuppression{})
+	return remove.RowsAffected > 0, remove.Error
+}
+
+//Latest suppressed addresses
+func FindEmailSuppressions(ctx context.Context, db *gorm.DB) (*[]EmailSuppression, error) {
+	db = database.WithContext(ctx, db)
+
+	suppressions := []EmailSuppression{}
+	err := db.Debug().Model(&EmailSuppression{}).Order("created_at desc").Limit(100).Find(&suppressions).Error
+	if err != nil {
+		return &[]EmailSuppression{}, err
+	}
+	return &suppressions, nil
+}
+
+//Suppress the address and mark the users with it as not taking email, returns how many users there were
+func MarkEmailUndeliverable(ctx context.Context, db *gorm.DB, email, status string) (int64, error) {
+	db = database.WithContext(ctx, db)
+
+	err := SuppressEmail(ctx, db, email, status)
+	if err != nil {
+		return 0, err
+	}
+	update := db.Debug().Model(&User{}).Where("email = ?", emailAddress(email)).UpdateColumns(
+		map[string]interface{}{
+			"email_status": status,
+			"updated_at":   time.Now(),
+		},
+	)
+	return update.RowsAffected, update.Error
+}
+
+//Set or clear the email status of a user
+func SetEmailStatus(ctx context.Context, db *gorm.DB, uid uint32, status string) error {
+	db = database.WithContext(ctx, db)
+
+	return db.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumns(
+		map[string]interface{}{
+			"email_status": status,
+			"updated_at":   time.Now(),
+		},
+	).Error
+}
+
+//Send email to the user again, clearing their status and the suppression of their address
+func ClearEmailStatus(ctx context.Context, db *gorm.DB, uid uint32) error {
+	user := User{}
+	userFound, err := user.FindUserByID(ctx, db, uid)
+	if gorm.IsRecordNotFoundError(err) {
+		return errors.New("User Not Found")
+	}
+	if err != nil {
+		return err
+	}
+	_, err = UnsuppressEmail(ctx, db, userFound.Email)
+	if err != nil {
+		return err
+	}
+	return SetEmailStatus(ctx, db, uid, EmailDeliverable)
+}
+
+//Whether email to the address is suppressed
+func EmailSuppressed(ctx context.Context, db *gorm.DB, address string) (bool, error) {
+	db = database.WithContext(ctx, db)
+
+	var count int
+	err := db.Debug().Model(&EmailSuppression{}).Where("address = ?", emailAddress(address)).Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/metrics"
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
+)
+
+//How long the link in a verification email stays valid
+const EmailVerificationLifetime = 72 * time.Hour
+
+//Login policies for accounts that haven't verified their email, EMAIL_VERIFICATION in the environment
+const (
+	EmailVerificationOptional = "optional" //Unverified accounts log in as usual
+	EmailVerificationGrace    = "grace"    //Unverified accounts log in until the grace period after sign up ends
+	EmailVerificationRequired = "required" //Unverified accounts cannot log in
+)
+
+var (
+	ErrInvalidVerificationLink = errors.New("Invalid Verification Link")
+	ErrVerificationLinkExpired = errors.New("Verification Link Expired")
+)
+
+//Login policy for unverified accounts, grace when unset
+func EmailVerificationPolicy() string {
+	switch policy := strings.ToLower(os.Getenv("EMAIL_VERIFICATION")); policy {
+	case EmailVerificationOptional, EmailVerificationRequired:
+		return policy
+	}
+	return EmailVerificationGrace
+}
+
+//How long after sign up an unverified account can still log in under the grace policy, EMAIL_VERIFICATION_GRACE in the environment
+func EmailVerificationGracePeriod() time.Duration {
+	grace, err := time.ParseDuration(os.Getenv("EMAIL_VERIFICATION_GRACE"))
+	if err != nil || grace < 0 {
+		return 72 * time.Hour
+	}
+	return grace
+}
+
+//Whether the login policy lets the account in
+func (u *User) CanLogInUnverified(now time.Time) bool {
+	if u.Verified {
+		return true
+	}
+	switch EmailVerificationPolicy() {
+	case EmailVerificationOptional:
+		return true
+	case EmailVerificationRequired:
+		return false
+	}
+	return now.Before(u.CreatedAt.Add(EmailVerificationGracePeriod()))
+}
+
+//The signature covers the address, so changing the email invalidates links sent to the old one
+func emailVerificationMessage(uid uint32, email string, expires int64) string {
+	return fmt.Sprintf("verify-email:%d:%s:%d", uid, strings.ToLower(email), expires)
+}
+
+//Signed token for the verification link, valid until expires
+func (u *User) EmailVerificationToken(expires time.Time) string {
+	signature := tokens.Sign(os.Getenv("API_SECRET"), emailVerificationMessage(u.ID, u.Email, expires.Unix()))
+	return fmt.Sprintf("%d.%d.%s", u.ID, expires.Unix(), signature)
+}
+
+//Mark the account of a verification token as verified
+func VerifyEmail(ctx context.Context, db *gorm.DB, token string) (*User, error) {
+	db = database.WithContext(ctx, db)
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return &User{}, ErrInvalidVerificationLink
+	}
+	uid, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return &User{}, ErrInvalidVerificationLink
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return &User{}, ErrInvalidVerificationLink
+	}
+
+	user := User{}
+	err = db.Debug().Model(&User{}).Where("id = ?", uid).Take(&user).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &User{}, ErrInvalidVerificationLink
+	}
+	if err != nil {
+		return &User{}, err
+	}
+	if !tokens.Verify(os.Getenv("API_SECRET"), emailVerificationMessage(user.ID, user.Email, expires), parts[2]) {
+		return &User{}, ErrInvalidVerificationLink
+	}
+	if time.Now().Unix() > expires {
+		return &User{}, ErrVerificationLinkExpired
+	}
+	if user.Verified {
+		return &user, nil
+	}
+
+	err = SetEmailVerified(ctx, db, user.ID, true)
+	if err != nil {
+		return &User{}, err
+	}
+	user.Verified = true
+	metrics.UsersVerified.Inc()
+	return &user, nil
+}
+
+//Set whether the user's current email is verified
+func SetEmailVerified(ctx context.Context, db *gorm.DB, uid uint32, verified bool) error {
+	db = database.WithContext(ctx, db)
+
+	return db.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumns(
+		map[string]interface{}{
+			"verified":   verified,
+			"updated_at": time.Now(),
+		},
+	).Error
+}
+
+//Adds the verified column, marking accounts that existed before email verification as verified so the policy doesn't lock them out
+func MigrateEmailVerification(db *gorm.DB) {
+	if !db.HasTable(&User{}) || db.Dialect().HasColumn("users", "verified") {
+		return
+	}
+	err := db.AutoMigrate(&User{}).Error
+	if err != nil {
+		return
+	}
+	db.Model(&User{}).UpdateColumn("verified", true)
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"html"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//Photo of past work shown on a provider's public profile
+type GalleryItem struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32    `gorm:"not null;index" json:"user_id"`
+	ImageURL  string    `gorm:"size:255;not null" json:"image_url"`
+	Caption   string    `gorm:"size:255" json:"caption"`
+	Position  uint32    `gorm:"not null;default:0" json:"position"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+//Maximum number of gallery photos per user, MAX_GALLERY_ITEMS in the environment
+func MaxGalleryItems() int {
+	max, err := strconv.Atoi(os.Getenv("MAX_GALLERY_ITEMS"))
+	if err != nil || max <= 0 {
+		return 12
+	}
+	return max
+}
+
+func (g *GalleryItem) Prepare() {
+	g.ID = 0
+	g.Caption = html.EscapeString(strings.TrimSpace(g.Caption))
+	g.CreatedAt = time.Now()
+	g.UpdatedAt = time.Now()
+}
+
+var ErrGalleryFull = errors.New("Gallery Is Full")
+
+func (g *GalleryItem) Validate() error {
+	if g.UserID < 1 {
+		return apierror.Invalid("user_id", "Required User ID")
+	}
+	if g.ImageURL == "" {
+		return apierror.Invalid("image_url", "Required Image")
+	}
+	return g.ValidateCaption()
+}
+
+//Checked on its own before the photo is uploaded
+func (g *GalleryItem) ValidateCaption() error {
+	if len(g.Caption) > 255 {
+		return errors.New("Caption Too Long")
+	}
+	return nil
+}
+
+//ErrGalleryFull when the user has as many photos as they may, checked again when a photo is saved
+func CheckGalleryRoom(ctx context.Context, db *gorm.DB, uid uint32) error {
+	db = database.WithContext(ctx, db)
+
+	_, err := galleryPosition(db, uid)
+	return err
+}
+
+//Position of the next photo of the user's gallery, ErrGalleryFull when there is no room for it
+func galleryPosition(db *gorm.DB, uid uint32) (int, error) {
+	var count int
+	err := db.Debug().Model(&GalleryItem{}).Where("user_id = ?", uid).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	if count >= MaxGalleryItems() {
+		return 0, ErrGalleryFull
+	}
+	return count, nil
+}
+
+//Add a photo at the end of the user's gallery
+func (g *GalleryItem) SaveGalleryItem(ctx context.Context, db *gorm.DB) (*GalleryItem, error) {
+	db = database.WithContext(ctx, db)
+
+	count, err := galleryPosition(db, g.UserID)
+	if err != nil {
+		return &GalleryItem{}, err
+	}
+
+	g.Position = uint32(count)
+	err = db.Debug().Model(&GalleryItem{}).Create(&g).Error
+	if err != nil {
+		return &GalleryItem{}, err
+	}
+	return g, nil
+}
+
+//Get the photos of a user's gallery in display order
+func (g *GalleryItem) FindUserGallery(ctx context.Context, db *gorm.DB, uid uint32) (*[]GalleryItem, error) {
+	db = database.WithContext(ctx, db)
+
+	items := []GalleryItem{}
+	err := db.Debug().Model(&GalleryItem{}).Where("user_id = ?", uid).Order("position asc, id asc").Find(&items).Error
+	if err != nil {
+		return &[]GalleryItem{}, err
+	}
+	return &items, nil
+}
+
+//Update the caption of a photo belonging to the user
+func (g *GalleryItem) UpdateCaption(ctx context.Context, db *gorm.DB, id uint64, uid uint32) (*GalleryItem, error) {
+	db = database.WithContext(ctx, db)
+
+	db = db.Debug().Model(&GalleryItem{}).Where("id = ? and user_id = ?", id, uid).Take(&GalleryItem{}).UpdateColumns(
+		map[string]interface{}{
+			"caption":    g.Caption,
+			"updated_at": time.Now(),
+		},
+	)
+	if db.Error != nil {
+		if gorm.IsRecordNotFoundError(db.Error) {
+			return &GalleryItem{}, errors.New("Photo not found")
+		}
+		return &GalleryItem{}, db.Error
+	}
+
+	err := db.Debug().Model(&GalleryItem{}).Where("id = ?", id).Take(&g).Error
+	if err != nil {
+		return &GalleryItem{}, err
+	}
+	return g, nil
+}
+
+//Reorder the user's gallery, ids lists the photos in their new order
+func ReorderGallery(ctx context.Context, db *gorm.DB, uid uint32, ids []uint64) error {
+	db = database.WithContext(ctx, db)
+
+	tx := db.Begin()
+	for position, id := range ids {
+		err := tx.Debug().Model(&GalleryItem{}).Where("id = ? and user_id = ?", id, uid).UpdateColumn("position", position).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+//Remove a photo from the user's gallery
+func (g *GalleryItem) DeleteGalleryItem(ctx context.Context, db *gorm.DB, id uint64, uid uint32) (int64, error) {
+	db = database.WithContext(ctx, db)
+
+	db = db.Debug().Model(&GalleryItem{}).Where("id = ? and user_id = ?", id, uid).Take(&GalleryItem{}).Delete(&GalleryItem{})
+
+	if db.Error != nil {
+		if gorm.IsRecordNotFoundError(db.Error) {
+			return 0, errors.New("Photo not found")
+		}
+		return 0, db.Error
+	}
+	return db.RowsAffected, nil
+}
@@ -0,0 +1,311 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
+)
+
+//Account at a sign in provider such as Google that logs in to a user
+type Identity struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32    `gorm:"not null;index" json:"user_id"`
+	Provider  string    `gorm:"size:20;not null;unique_index:idx_identities_provider_subject" json:"provider"`
+	Subject   string    `gorm:"size:255;not null;unique_index:idx_identities_provider_subject" json:"-"`
+	Email     string    `gorm:"size:100;not null" json:"email"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+//Account the provider vouched for
+type ExternalAccount struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+//How long the owner of an existing account has to confirm linking a provider account to it
+const IdentityLinkLifetime = 15 * time.Minute
+
+//Wrong passwords or codes a pending link takes before it is dropped
+const maxIdentityLinkAttempts = 5
+
+var (
+	ErrUnverifiedProviderEmail = errors.New("The Provider Has Not Verified This Email")
+	ErrInvalidLinkToken        = errors.New("Invalid Or Expired Link Token")
+	ErrLinkProofFailed         = errors.New("Incorrect Password Or Code")
+	ErrIdentityAlreadyLinked   = errors.New("Provider Account Already Linked")
+)
+
+//Provider account waiting for the owner of the account with the same email to prove it is theirs
+type IdentityLink struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32    `gorm:"not null;index" json:"user_id"`
+	Provider  string    `gorm:"size:20;not null" json:"provider"`
+	Subject   string    `gorm:"size:255;not null" json:"-"`
+	Email     string    `gorm:"size:100;not null" json:"email"`
+	TokenHash string    `gorm:"size:64;not null;unique" json:"-"`
+	Attempts  int       `gorm:"not null;default:0" json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+//Returned when the provider account's email belongs to an existing user, who has to confirm the link
+type LinkRequiredError struct {
+	Token  string //Sent back with the proof to /auth/link
+	UserID uint32
+}
+
+func (e *LinkRequiredError) Error() string {
+	return "An Account With This Email Exists, Confirm It Is Yours To Link It"
+}
+
+//Phone numbers stand in for accounts created through a provider, the column is unique and required
+const placeholderPhonePrefix = "oauth:"
+
+//Whether the user has given a real phone number
+func (u *User) HasPhone() bool {
+	return u.Phone != "" && !strings.HasPrefix(u.Phone, placeholderPhonePrefix)
+}
+
+//The phone number the user gave, blank when the column holds a placeholder
+func (u *User) PhoneNumber() string {
+	if !u.HasPhone() {
+		return ""
+	}
+	return u.Phone
+}
+
+var usernameCharacters = regexp.MustCompile(`[^a-z0-9_.]+`)
+
+//Find the user of the provider account, or create a user for it. When a user already has the email
+//a *LinkRequiredError is returned instead, the owner proves the account is theirs with CompleteIdentityLink.
+//Returns whether the user was created.
+func SignInWithIdentity(ctx context.Context, db *gorm.DB, account ExternalAccount) (*User, bool, error) {
+	db = database.WithContext(ctx, db)
+
+	user := User{}
+	err := db.Debug().Model(&User{}).Joins("join identities on identities.user_id = users.id").
+		Where("identities.provider = ? and identities.subject = ?", account.Provider, account.Subject).Take(&user).Error
+	if err == nil {
+		return &user, false, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return &User{}, false, err
+	}
+
+	//Without a verified email anyone could claim someone else's address at the provider
+	if !account.EmailVerified || account.Email == "" {
+		return &User{}, false, ErrUnverifiedProviderEmail
+	}
+	email := html.EscapeString(strings.TrimSpace(account.Email))
+
+	existing := User{}
+	err = db.Debug().Model(&User{}).Where("email = ?", email).Take(&existing).Error
+	if err == nil {
+		return &User{}, false, startIdentityLink(ctx, db, &existing, account, email)
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return &User{}, false, err
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return &User{}, false, tx.Error
+	}
+	err = createIdentityUser(tx, &user, account, email)
+	if err == nil {
+		err = createIdentity(tx, user.ID, account.Provider, account.Subject, email)
+	}
+	if err != nil {
+		tx.Rollback()
+		//Someone registered the email since it was looked up, it's linked like any other existing account
+		if duplicate, ok := err.(*DuplicateUserError); ok && duplicate.Field == "email" {
+			if db.Debug().Model(&User{}).Where("email = ?", email).Take(&existing).Error == nil {
+				return &User{}, false, startIdentityLink(ctx, db, &existing, account, email)
+			}
+		}
+		return &User{}, false, err
+	}
+	return &user, true, tx.Commit().Error
+}
+
+func createIdentity(tx *gorm.DB, uid uint32, provider, subject, email string) error {
+	identity := Identity{
+		UserID:    uid,
+		Provider:  provider,
+		Subject:   subject,
+		Email:     email,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	return tx.Debug().Model(&Identity{}).Create(&identity).Error
+}
+
+//Creates a user for a provider account, with an unusable random password and a placeholder phone number
+func createIdentityUser(tx *gorm.DB, user *User, account ExternalAccount, email string) error {
+	password, err := tokens.Generate(32)
+	if err != nil {
+		return err
+	}
+
+	base := strings.ToLower(account.Name)
+	if base == "" {
+		base = strings.ToLower(email[:strings.Index(email+"@", "@")])
+	}
+	base = strings.Trim(usernameCharacters.ReplaceAllString(strings.Replace(base, " ", ".", -1), ""), ".")
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > 30 {
+		base = base[:30]
+	}
+
+	username := base
+	for attempt := 0; ; attempt++ {
+		var count int
+		//Deleted accounts keep their username until they are purged
+		err = tx.Debug().Unscoped().Model(&User{}).Where("username = ?", username).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			break
+		}
+		if attempt == 5 {
+			return &DuplicateUserError{Field: "username"}
+		}
+		suffix, err := tokens.Generate(3)
+		if err != nil {
+			return err
+		}
+		username = base + "." + strings.ToLower(suffix)
+	}
+
+	*user = User{
+		Username:  username,
+		Email:     email,
+		Phone:     placeholderPhonePrefix + tokens.Hash(account.Provider + ":" + account.Subject)[:19],
+		ImageURL:  account.Picture,
+		Password:  password,
+		Role:      auth.RoleCustomer,
+		Verified:  true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	err = tx.Debug().Create(user).Error
+	if field, ok := duplicateKeyField(err); ok {
+		return &DuplicateUserError{Field: field}
+	}
+	return err
+}
+
+//Record a pending link and return the error carrying its token
+func startIdentityLink(ctx context.Context, db *gorm.DB, user *User, account ExternalAccount, email string) error {
+	token, err := tokens.Generate(32)
+	if err != nil {
+		return err
+	}
+
+	//Only the latest attempt to link the provider account stays valid
+	err = db.Debug().Where("user_id = ? and provider = ?", user.ID, account.Provider).Delete(&IdentityLink{}).Error
+	if err != nil {
+		return err
+	}
+
+	link := IdentityLink{
+		UserID:    user.ID,
+		Provider:  account.Provider,
+		Subject:   account.Subject,
+		Email:     email,
+		TokenHash: tokens.Hash(token),
+		ExpiresAt: time.Now().Add(IdentityLinkLifetime),
+		CreatedAt: time.Now(),
+	}
+	err = db.Debug().Model(&IdentityLink{}).Create(&link).Error
+	if err != nil {
+		return err
+	}
+	return &LinkRequiredError{Token: token, UserID: user.ID}
+}
+
+//Find a pending link that hasn't expired
+func FindIdentityLink(ctx context.Context, db *gorm.DB, token string) (*IdentityLink, error) {
+	db = database.WithContext(ctx, db)
+
+	link := IdentityLink{}
+	err := db.Debug().Model(&IdentityLink{}).Where("token_hash = ? and expires_at > ?", tokens.Hash(token), time.Now()).Take(&link).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &IdentityLink{}, ErrInvalidLinkToken
+	}
+	if err != nil {
+		return &IdentityLink{}, err
+	}
+	return &link, nil
+}
+
+//Link the provider account once the owner proved the account is theirs, proven reports whether the password
+//or code they gave was right. Wrong ones count against the link until it is dropped.
+func CompleteIdentityLink(ctx context.Context, db *gorm.DB, link *IdentityLink, proven bool) (*User, error) {
+	db = database.WithContext(ctx, db)
+
+	if !proven {
+		err := db.Debug().Model(&IdentityLink{}).Where("id = ?", link.ID).UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error
+		if err == nil && link.Attempts+1 >= maxIdentityLinkAttempts {
+			err = db.Debug().Where("id = ?", link.ID).Delete(&IdentityLink{}).Error
+		}
+		if err != nil {
+			return &User{}, err
+		}
+		return &User{}, ErrLinkProofFailed
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return &User{}, tx.Error
+	}
+
+	//Deleting the link first makes sure it is only used once
+	remove := tx.Debug().Where("id = ?", link.ID).Delete(&IdentityLink{})
+	if remove.Error != nil {
+		tx.Rollback()
+		return &User{}, remove.Error
+	}
+	if remove.RowsAffected == 0 {
+		tx.Rollback()
+		return &User{}, ErrInvalidLinkToken
+	}
+
+	err := createIdentity(tx, link.UserID, link.Provider, link.Subject, link.Email)
+	if _, duplicate := duplicateKeyField(err); duplicate {
+		tx.Rollback()
+		return &User{}, ErrIdentityAlreadyLinked
+	}
+	if err == nil {
+		//The provider verified the address and the owner proved the account, so the email counts as verified
+		err = tx.Debug().Model(&User{}).Where("id = ?", link.UserID).UpdateColumn("verified", true).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return &User{}, err
+	}
+
+	user := User{}
+	err = tx.Debug().Model(&User{}).Where("id = ?", link.UserID).Take(&user).Error
+	if err != nil {
+		tx.Rollback()
+		return &User{}, err
+	}
+	return &user, tx.Commit().Error
+}
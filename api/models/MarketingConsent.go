@@ -0,0 +1,130 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//Where a user opted in to marketing
+const (
+	ConsentSourceSettings     = "settings"
+	ConsentSourceRegistration = "registration"
+	ConsentSourceCampaign     = "campaign"
+)
+
+var consentSources = map[string]bool{
+	ConsentSourceSettings:     true,
+	ConsentSourceRegistration: true,
+	ConsentSourceCampaign:     true,
+}
+
+func ValidConsentSource(source string) bool {
+	return consentSources[source]
+}
+
+//A user's explicit opt-in to marketing, kept apart from the notifications their bookings and account
+//send. A withdrawn consent stays with its dates until the user opts in again.
+type MarketingConsent struct {
+	ID          uint64     `gorm:"primary_key;auto_increment" json:"-"`
+	UserID      uint32     `gorm:"not null;unique_index" json:"-"`
+	Consented   bool       `gorm:"-" json:"consented"`
+	Source      string     `gorm:"size:30;not null;default:''" json:"source"`
+	OptedInAt   *time.Time `json:"opted_in_at"`
+	WithdrawnAt *time.Time `json:"withdrawn_at"`
+	CreatedAt   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"-"`
+	UpdatedAt   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (c *MarketingConsent) Active() bool {
+	return c.OptedInAt != nil && c.WithdrawnAt == nil
+}
+
+//The user's consent, not consented when they never gave one
+func FindMarketingConsent(ctx context.Context, db *gorm.DB, uid uint32) (*MarketingConsent, error) {
+	db = database.WithContext(ctx, db)
+
+	consent := MarketingConsent{}
+	err := db.Debug().Model(&MarketingConsent{}).Where("user_id = ?", uid).Take(&consent).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &MarketingConsent{UserID: uid}, nil
+	}
+	if err != nil {
+		return &MarketingConsent{}, err
+	}
+	consent.Consented = consent.Active()
+	return &consent, nil
+}
+
+func HasMarketingConsent(ctx context.Context, db *gorm.DB, uid uint32) (bool, error) {
+	consent, err := FindMarketingConsent(ctx, db, uid)
+	if err != nil {
+		return false, err
+	}
+	return consent.Consented, nil
+}
+
+//Opt the user in to marketing from the source, or withdraw their consent. Opting in again keeps the
+//first opt-in, withdrawing drops the marketing notifications still waiting for their digest.
+func SetMarketingConsent(ctx context.Context, db *gorm.DB, uid uint32, consented bool, source string) (*MarketingConsent, error) {
+	db = database.WithContext(ctx, db)
+
+	if consented && !ValidConsentSource(source) {
+		return &MarketingConsent{}, errors.New("Invalid Consent Source")
+	}
+	consent, err := FindMarketingConsent(ctx, db, uid)
+	if err != nil {
+		return &MarketingConsent{}, err
+	}
+	if consent.Consented == consented {
+		return consent, nil
+	}
+
+	now := time.Now()
+	if consented {
+		if consent.ID == 0 {
+			consent = &MarketingConsent{UserID: uid, Source: source, OptedInAt: &now, CreatedAt: now, UpdatedAt: now}
+			err = db.Debug().Model(&MarketingConsent{}).Create(consent).Error
+			//Opted in from another request meanwhile
+			if _, duplicate := duplicateKeyField(err); duplicate {
+				return FindMarketingConsent(ctx, db, uid)
+			}
+		} else {
+			consent.Source, consent.OptedInAt, consent.WithdrawnAt, consent.UpdatedAt = source, &now, nil, now
+			err = db.Debug().Model(&MarketingConsent{}).Where("id = ?", consent.ID).UpdateColumns(
+				map[string]interface{}{
+					"source":       source,
+					"opted_in_at":  now,
+					"withdrawn_at": nil,
+					"updated_at":   now,
+				},
+			).Error
+		}
+		if err != nil {
+			return &MarketingConsent{}, err
+		}
+		consent.Consented = true
+		return consent, nil
+	}
+
+	consent.WithdrawnAt, consent.UpdatedAt = &now, now
+	err = db.Debug().Model(&MarketingConsent{}).Where("id = ?", consent.ID).UpdateColumns(
+		map[string]interface{}{
+			"withdrawn_at": now,
+			"updated_at":   now,
+		},
+	).Error
+	if err != nil {
+		return &MarketingConsent{}, err
+	}
+	err = db.Debug().Model(&Notification{}).Where("user_id = ? and marketing = ? and digest = ? and digested_at is null", uid, true, true).
+		UpdateColumn("digested_at", now).Error
+	if err != nil {
+		return &MarketingConsent{}, err
+	}
+	consent.Consented = false
+	return consent, nil
+}
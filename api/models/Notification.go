@@ -0,0 +1,73 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//Entry in a user's in-app inbox
+type Notification struct {
+	ID        uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32     `gorm:"not null;index" json:"user_id"`
+	Kind      string     `gorm:"size:50;not null" json:"kind"`
+	Title     string     `gorm:"size:255;not null" json:"title"`
+	Body      string     `gorm:"size:1000" json:"body"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	//Low priority, emailed in the user's digest instead of on its own
+	Digest     bool       `gorm:"not null;default:false;index:idx_notifications_digest" json:"-"`
+	DigestedAt *time.Time `gorm:"index:idx_notifications_digest" json:"-"`
+	//Sent only to users with a marketing consent, see MarketingConsent
+	Marketing bool `gorm:"not null;default:false" json:"marketing"`
+}
+
+//Add a notification to the user's inbox
+func (n *Notification) SaveNotification(ctx context.Context, db *gorm.DB) (*Notification, error) {
+	db = database.WithContext(ctx, db)
+	n.CreatedAt = time.Now()
+	err := db.Debug().Model(&Notification{}).Create(&n).Error
+	if err != nil {
+		return &Notification{}, err
+	}
+	return n, nil
+}
+
+//Get the latest notifications in a user's inbox
+func (n *Notification) FindUserNotifications(ctx context.Context, db *gorm.DB, uid uint32) (*[]Notification, error) {
+	db = database.WithContext(ctx, db)
+
+	notifications := []Notification{}
+	err := db.Debug().Model(&Notification{}).Where("user_id = ?", uid).Order("created_at desc, id desc").Limit(100).Find(&notifications).Error
+	if err != nil {
+		return &[]Notification{}, err
+	}
+	return &notifications, nil
+}
+
+//Mark a notification in the user's inbox as read
+func (n *Notification) MarkRead(ctx context.Context, db *gorm.DB, id uint64, uid uint32) (*Notification, error) {
+	db = database.WithContext(ctx, db)
+
+	err := db.Debug().Model(&Notification{}).Where("id = ? and user_id = ?", id, uid).Take(&n).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Notification{}, errors.New("Notification not found")
+	}
+	if err != nil {
+		return &Notification{}, err
+	}
+	if n.ReadAt != nil {
+		return n, nil
+	}
+
+	now := time.Now()
+	err = db.Debug().Model(&Notification{}).Where("id = ?", n.ID).UpdateColumn("read_at", now).Error
+	if err != nil {
+		return &Notification{}, err
+	}
+	n.ReadAt = &now
+	return n, nil
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/auth"
+)
+
+//Steps of a new account's onboarding, in the order the app shows them
+const (
+	OnboardingVerifyEmail       = "verify_email"
+	OnboardingVerifyPhone       = "verify_phone"
+	OnboardingAddPhoto          = "add_photo"
+	OnboardingAddSpecialisation = "add_specialisation"
+	OnboardingSetAvailability   = "set_availability"
+)
+
+type OnboardingStep struct {
+	Step string `json:"step"`
+	Done bool   `json:"done"`
+}
+
+//Where the user is in onboarding. Providers have the specialisation and availability steps on top of
+//everyone's, Remaining lists the steps not done yet in order.
+type Onboarding struct {
+	Steps     []OnboardingStep `json:"steps"`
+	Remaining []string         `json:"remaining"`
+	Complete  bool             `json:"complete"`
+}
+
+//The user's onboarding, worked out from their account every time so it can't go stale
+func FindOnboarding(ctx context.Context, db *gorm.DB, uid uint32) (*Onboarding, error) {
+	user := User{}
+	userFound, err := user.FindUserByID(ctx, db, uid)
+	if err != nil {
+		return &Onboarding{}, err
+	}
+
+	steps := []OnboardingStep{
+		{Step: OnboardingVerifyEmail, Done: userFound.Verified},
+		{Step: OnboardingVerifyPhone, Done: userFound.HasPhone() && userFound.PhoneVerified},
+		{Step: OnboardingAddPhoto, Done: userFound.ImageURL != ""},
+	}
+	if userFound.Role == auth.RoleProvider {
+		available, err := HasAvailability(ctx, db, uid)
+		if err != nil {
+			return &Onboarding{}, err
+		}
+		steps = append(steps,
+			OnboardingStep{Step: OnboardingAddSpecialisation, Done: userFound.Specialisation != ""},
+			OnboardingStep{Step: OnboardingSetAvailability, Done: available},
+		)
+	}
+
+	onboarding := Onboarding{Steps: steps, Remaining: []string{}}
+	for _, step := range steps {
+		if !step.Done {
+			onboarding.Remaining = append(onboarding.Remaining, step.Step)
+		}
+	}
+	onboarding.Complete = len(onboarding.Remaining) == 0
+	return &onboarding, nil
+}
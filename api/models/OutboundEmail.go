@@ -0,0 +1,170 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/dependency"
+)
+
+//States of a queued email
+const (
+	OutboundEmailQueued     = "queued"
+	OutboundEmailSending    = "sending"
+	OutboundEmailSent       = "sent"
+	OutboundEmailFailed     = "failed"     //Gave up after MaxEmailAttempts
+	OutboundEmailSuppressed = "suppressed" //Not sent, the address no longer takes email
+)
+
+const (
+	MaxEmailAttempts = 5
+	EmailSendLease   = 5 * time.Minute     //An email being sent is tried again after this, in case the sender died
+	EmailLogLifetime = 30 * 24 * time.Hour //How long the send log keeps emails that are done
+)
+
+//Email waiting to be sent or already handled, the send log admins look at
+type OutboundEmail struct {
+	ID            uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	Recipient     string     `gorm:"size:255;not null;index" json:"recipient"`
+	Subject       string     `gorm:"size:255;not null" json:"subject"`
+	Body          string     `gorm:"type:text" json:"-"` //Holds reset links and codes, cleared once the email is done
+	Status        string     `gorm:"size:20;not null;index:idx_outbound_emails_due" json:"status"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index:idx_outbound_emails_due" json:"next_attempt_at"`
+	LastError     string     `gorm:"size:255" json:"last_error,omitempty"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+//Queue an email for the send-emails job
+func QueueEmail(ctx context.Context, db *gorm.DB, recipient, subject, body string) (*OutboundEmail, error) {
+	db = database.WithContext(ctx, db)
+
+	if len(subject) > 255 {
+		subject = subject[:255]
+	}
+	email := OutboundEmail{
+		Recipient:     recipient,
+		Subject:       subject,
+		Body:          body,
+		Status:        OutboundEmailQueued,
+		NextAttemptAt: time.Now(),
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	err := db.Debug().Model(&OutboundEmail{}).Create(&email).Error
+	if err != nil {
+		return &OutboundEmail{}, err
+	}
+	return &email, nil
+}
+
+//Claim emails that are due, so other instances leave them alone while they are sent
+func ClaimQueuedEmails(ctx context.Context, db *gorm.DB, now time.Time, limit int) (*[]OutboundEmail, error) {
+	db = database.WithContext(ctx, db)
+
+	due := []OutboundEmail{}
+	err := db.Debug().Model(&OutboundEmail{}).Where("status in (?) and next_attempt_at <= ?", []string{OutboundEmailQueued, OutboundEmailSending}, now).
+		Order("next_attempt_at asc").Limit(limit).Find(&due).Error
+	if err != nil {
+		return &[]OutboundEmail{}, err
+	}
+
+	claimed := []OutboundEmail{}
+	for _, email := range due {
+		claim := db.Debug().Model(&OutboundEmail{}).Where("id = ? and status = ? and next_attempt_at = ?", email.ID, email.Status, email.NextAttemptAt).UpdateColumns(
+			map[string]interface{}{
+				"status":          OutboundEmailSending,
+				"next_attempt_at": now.Add(EmailSendLease),
+				"attempts":        gorm.Expr("attempts + 1"),
+				"updated_at":      now,
+			},
+		)
+		if claim.Error != nil {
+			return &claimed, claim.Error
+		}
+		if claim.RowsAffected == 1 {
+			email.Status = OutboundEmailSending
+			email.Attempts++
+			claimed = append(claimed, email)
+		}
+	}
+	return &claimed, nil
+}
+
+//Record how sending went. Failures are tried again later, waiting twice as long each time, until MaxEmailAttempts.
+//Emails the mail server refused for good fail right away.
+func (e *OutboundEmail) FinishSending(ctx context.Context, db *gorm.DB, suppressed bool, failure error) error {
+	db = database.WithContext(ctx, db)
+
+	now := time.Now()
+	columns := map[string]interface{}{"updated_at": now}
+	switch {
+	case suppressed:
+		e.Status = OutboundEmailSuppressed
+	case failure == nil:
+		e.Status, e.SentAt = OutboundEmailSent, &now
+		columns["sent_at"] = now
+	case e.Attempts < MaxEmailAttempts && retryableFailure(failure):
+		e.Status, e.NextAttemptAt = OutboundEmailQueued, now.Add(time.Duration(1<<uint(e.Attempts-1))*time.Minute)
+		columns["next_attempt_at"] = e.NextAttemptAt
+	default:
+		e.Status = OutboundEmailFailed
+	}
+	columns["status"] = e.Status
+
+	if failure != nil {
+		e.LastError = failure.Error()
+		if len(e.LastError) > 255 {
+			e.LastError = e.LastError[:255]
+		}
+		columns["last_error"] = e.LastError
+	}
+	if e.Status != OutboundEmailQueued {
+		e.Body = ""
+		columns["body"] = ""
+	}
+	return db.Debug().Model(&OutboundEmail{}).Where("id = ?", e.ID).UpdateColumns(columns).Error
+}
+
+//Whether sending again may work, failures that aren't typed are assumed to
+func retryableFailure(err error) bool {
+	typed, ok := dependency.As(err)
+	return !ok || typed.Kind == dependency.Retryable
+}
+
+//Filters of the send log, zero values are ignored
+type OutboundEmailFilter struct {
+	Status    string
+	Recipient string
+}
+
+//Latest emails of the send log matching the filter
+func FindOutboundEmails(ctx context.Context, db *gorm.DB, filter OutboundEmailFilter) (*[]OutboundEmail, error) {
+	db = database.WithContext(ctx, db)
+
+	query := db.Debug().Model(&OutboundEmail{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Recipient != "" {
+		query = query.Where("recipient = ?", filter.Recipient)
+	}
+	emails := []OutboundEmail{}
+	err := query.Order("created_at desc").Limit(100).Find(&emails).Error
+	if err != nil {
+		return &[]OutboundEmail{}, err
+	}
+	return &emails, nil
+}
+
+//Delete the emails that were done before the send log lifetime
+func PurgeOutboundEmails(ctx context.Context, db *gorm.DB, now time.Time) (int64, error) {
+	db = database.WithContext(ctx, db)
+
+	purge := db.Debug().Where("status in (?) and updated_at <= ?", []string{OutboundEmailSent, OutboundEmailFailed, OutboundEmailSuppressed}, now.Add(-EmailLogLifetime)).Delete(&OutboundEmail{})
+	return purge.RowsAffected, purge.Error
+}
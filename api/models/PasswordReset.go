@@ -0,0 +1,203 @@
+package models
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
+)
+
+//How long the link in a password reset email stays valid
+const PasswordResetLifetime = time.Hour
+
+var ErrInvalidResetLink = errors.New("Invalid Reset Link")
+
+//One-time token emailed to reset a forgotten password, only its hash is stored
+type PasswordReset struct {
+	ID        uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32     `gorm:"not null;index" json:"user_id"`
+	TokenHash string     `gorm:"size:64;not null;unique" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+//Replace the user's pending resets with a new one and return the plain token
+func IssuePasswordReset(ctx context.Context, db *gorm.DB, uid uint32) (string, error) {
+	db = database.WithContext(ctx, db)
+
+	secret, err := tokens.Generate(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = db.Debug().Where("user_id = ? and used_at is null", uid).Delete(&PasswordReset{}).Error
+	if err != nil {
+		return "", err
+	}
+
+	reset := PasswordReset{
+		UserID:    uid,
+		TokenHash: tokens.Hash(secret),
+		ExpiresAt: time.Now().Add(PasswordResetLifetime),
+		CreatedAt: time.Now(),
+	}
+	err = db.Debug().Model(&PasswordReset{}).Create(&reset).Error
+	if err != nil {
+		return "", err
+	}
+	//The ID in front finds the reset, so wrong secrets can be counted against it
+	return fmt.Sprintf("%d.%s", reset.ID, secret), nil
+}
+
+//Find the pending reset of a token and check its secret, too many wrong tries throw the reset away
+func checkPasswordReset(ctx context.Context, db *gorm.DB, token string) (*PasswordReset, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return &PasswordReset{}, ErrInvalidResetLink
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return &PasswordReset{}, ErrInvalidResetLink
+	}
+
+	reset := PasswordReset{}
+	err = db.Debug().Model(&PasswordReset{}).Where("id = ? and used_at is null and expires_at > ?", id, time.Now()).Take(&reset).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &PasswordReset{}, ErrInvalidResetLink
+	}
+	if err != nil {
+		return &PasswordReset{}, err
+	}
+
+	attempts, err := StartVerificationAttempt(ctx, db, reset.UserID, AttemptsPasswordReset)
+	if err != nil {
+		return &PasswordReset{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(tokens.Hash(parts[1])), []byte(reset.TokenHash)) != 1 {
+		if attempts >= MaxVerificationAttempts {
+			err = db.Debug().Where("id = ?", reset.ID).Delete(&PasswordReset{}).Error
+			if err == nil {
+				err = ClearVerificationAttempts(ctx, db, reset.UserID, AttemptsPasswordReset)
+			}
+			if err != nil {
+				return &PasswordReset{}, err
+			}
+		}
+		return &PasswordReset{}, ErrInvalidResetLink
+	}
+	return &reset, nil
+}
+
+//Use a reset token to set a new password, revoking every token issued to the user before and unlocking an
+//account locked by a reverted change
+func ResetPassword(ctx context.Context, db *gorm.DB, token, password string) (*User, error) {
+	db = database.WithContext(ctx, db)
+
+	pending, err := checkPasswordReset(ctx, db, token)
+	if err != nil {
+		return &User{}, err
+	}
+	owner := User{}
+	ownerFound, err := owner.FindUserByID(ctx, db, pending.UserID)
+	if err != nil {
+		return &User{}, ErrInvalidResetLink
+	}
+	//The link was right, so a weak password doesn't count as a wrong try
+	err = ValidatePassword(ctx, password, ownerFound)
+	if err != nil {
+		clearErr := ClearVerificationAttempts(ctx, db, pending.UserID, AttemptsPasswordReset)
+		if clearErr != nil {
+			return &User{}, clearErr
+		}
+		return &User{}, err
+	}
+
+	hashedPassword, err := Hash(password)
+	if err != nil {
+		return &User{}, err
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return &User{}, tx.Error
+	}
+
+	reset := PasswordReset{}
+	err = tx.Debug().Model(&PasswordReset{}).Set("gorm:query_option", "FOR UPDATE").Where("id = ?", pending.ID).Take(&reset).Error
+	if gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return &User{}, ErrInvalidResetLink
+	}
+	if err != nil {
+		tx.Rollback()
+		return &User{}, err
+	}
+	if reset.UsedAt != nil || reset.ExpiresAt.Before(time.Now()) {
+		tx.Rollback()
+		return &User{}, ErrInvalidResetLink
+	}
+
+	now := time.Now()
+	err = tx.Debug().Model(&User{}).Where("id = ?", reset.UserID).UpdateColumns(
+		map[string]interface{}{
+			"password":                string(hashedPassword),
+			"password_reset_required": false,
+			"tokens_valid_after":      now,
+			"updated_at":              now,
+		},
+	).Error
+	//Resetting proves the owner has the email again, which unlocks an account they locked by reverting a change
+	if err == nil {
+		err = tx.Debug().Model(&User{}).Where("id = ? and locked = ? and lock_reason = ?", reset.UserID, true, LockReverted).UpdateColumns(
+			map[string]interface{}{
+				"locked":      false,
+				"lock_reason": "",
+			},
+		).Error
+	}
+	if err == nil {
+		err = tx.Debug().Model(&PasswordReset{}).Where("id = ?", reset.ID).UpdateColumn("used_at", now).Error
+	}
+	if err == nil {
+		err = tx.Debug().Where("user_id = ? and used_at is null", reset.UserID).Delete(&PasswordReset{}).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return &User{}, err
+	}
+
+	user := User{}
+	err = tx.Debug().Model(&User{}).Where("id = ?", reset.UserID).Take(&user).Error
+	if err != nil {
+		tx.Rollback()
+		return &User{}, err
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return &User{}, err
+	}
+	return &user, ClearVerificationAttempts(ctx, db, user.ID, AttemptsPasswordReset)
+}
+
+//Whether a token of the user issued at the given time was revoked, a missing user revokes all of them
+func TokensRevoked(ctx context.Context, db *gorm.DB, uid uint32, issuedAt time.Time) (bool, error) {
+	db = database.WithContext(ctx, db)
+
+	user := User{}
+	err := db.Debug().Model(&User{}).Select("id, tokens_valid_after").Where("id = ?", uid).Take(&user).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return user.TokensValidAfter != nil && issuedAt.Unix() < user.TokensValidAfter.Unix(), nil
+}
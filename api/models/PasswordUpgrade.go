@@ -0,0 +1,65 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/passwords"
+)
+
+//Longest hash the password column holds, see MigratePasswordColumn
+const maxPasswordHashLength = 255
+
+//Returned for hashes wrapped so many times the result no longer fits the column
+var errPasswordHashTooLong = errors.New("Upgraded Password Hash Too Long")
+
+//Counts of a pass over stored passwords, LastID is where the next batch starts
+type PasswordUpgradeProgress struct {
+	LastID   uint32 `json:"last_id"`
+	Checked  int    `json:"checked"`
+	Upgraded int    `json:"upgraded"`
+	Failed   int    `json:"failed"`
+}
+
+//Upgrades the stored password hashes of the next users after afterID to the current hasher without their
+//passwords, see passwords.Upgrade. Deleted accounts are included since they can be restored. A hash is only
+//replaced while it is still the one read, so passwords changed or rehashed at login meanwhile are kept.
+//Hashes already current are skipped, so running it again resumes where it stopped.
+func UpgradePasswordHashes(ctx context.Context, db *gorm.DB, afterID uint32, limit int, progress *PasswordUpgradeProgress) (bool, error) {
+	db = database.WithContext(ctx, db).Unscoped()
+
+	users := []User{}
+	err := db.Debug().Model(&User{}).Select("id, password").Where("id > ?", afterID).Order("id asc").Limit(limit).Find(&users).Error
+	if err != nil {
+		return false, err
+	}
+	for _, user := range users {
+		progress.LastID = user.ID
+		progress.Checked++
+
+		upgraded, changed, err := passwords.Upgrade(user.Password)
+		if err == nil && changed && len(upgraded) > maxPasswordHashLength {
+			err = errPasswordHashTooLong
+		}
+		if err != nil {
+			//Plain text and unknown hashes are left for a password reset
+			log.Printf("Upgrading the password hash of user %d failed: %v", user.ID, err)
+			progress.Failed++
+			continue
+		}
+		if !changed {
+			continue
+		}
+		update := db.Debug().Model(&User{}).Where("id = ? and password = ?", user.ID, user.Password).UpdateColumn("password", upgraded)
+		if update.Error != nil {
+			return false, update.Error
+		}
+		if update.RowsAffected > 0 {
+			progress.Upgraded++
+		}
+	}
+	return len(users) == limit, nil
+}
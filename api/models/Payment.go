@@ -0,0 +1,98 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/payments"
+)
+
+//Booking payment states
+const (
+	PaymentUnpaid = "Unpaid"
+)
+
+//Deposit paid on a booking through a payment gateway
+type Payment struct {
+	ID               uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	BookingID        uint32    `gorm:"not null;index" json:"booking_id"`
+	UserID           uint32    `gorm:"not null" json:"user_id"`
+	Gateway          string    `gorm:"size:20;not null" json:"gateway"`
+	Reference        string    `gorm:"size:64;not null;unique" json:"reference"`
+	GatewayReference string    `gorm:"size:255;not null;index" json:"gateway_reference"`
+	Amount           float64   `gorm:"not null" json:"amount"`
+	Currency         string    `gorm:"size:3;not null" json:"currency"`
+	Status           string    `gorm:"size:20;not null" json:"status"`
+	CreatedAt        time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt        time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+//Record a payment started with a gateway and mark the booking as awaiting payment
+func (p *Payment) SavePayment(ctx context.Context, db *gorm.DB) (*Payment, error) {
+	db = database.WithContext(ctx, db)
+
+	p.Status = payments.StatusPending
+	p.CreatedAt = time.Now()
+	p.UpdatedAt = time.Now()
+
+	tx := db.Begin()
+	err := tx.Debug().Model(&Payment{}).Create(&p).Error
+	if err != nil {
+		tx.Rollback()
+		return &Payment{}, err
+	}
+	err = tx.Debug().Model(&Booking{}).Where("id = ?", p.BookingID).UpdateColumns(map[string]interface{}{"payment_status": p.Status, "updated_at": time.Now()}).Error
+	if err != nil {
+		tx.Rollback()
+		return &Payment{}, err
+	}
+	return p, tx.Commit().Error
+}
+
+//Find a payment by the reference the gateway gave it
+func (p *Payment) FindPaymentByGatewayReference(ctx context.Context, db *gorm.DB, gateway, reference string) (*Payment, error) {
+	db = database.WithContext(ctx, db)
+
+	err := db.Debug().Model(&Payment{}).Where("gateway = ? and gateway_reference = ?", gateway, reference).Take(&p).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Payment{}, errors.New("Payment not found")
+	}
+	if err != nil {
+		return &Payment{}, err
+	}
+	return p, nil
+}
+
+//Apply a status reported by the gateway to the payment and its booking. Webhooks can arrive
+//more than once and out of order, so only pending payments succeeding or failing and refunds of successful
+//payments apply. A payment can't be refunded before it succeeded.
+func (p *Payment) UpdatePaymentStatus(ctx context.Context, db *gorm.DB, status string) (bool, error) {
+	db = database.WithContext(ctx, db)
+
+	allowed := p.Status == payments.StatusPending && (status == payments.StatusSucceeded || status == payments.StatusFailed) ||
+		p.Status == payments.StatusSucceeded && status == payments.StatusRefunded
+	if !allowed {
+		return false, nil
+	}
+
+	tx := db.Begin()
+	err := tx.Debug().Model(&Payment{}).Where("id = ? and status = ?", p.ID, p.Status).UpdateColumns(map[string]interface{}{"status": status, "updated_at": time.Now()}).Error
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	err = tx.Debug().Model(&Booking{}).Where("id = ?", p.BookingID).UpdateColumns(map[string]interface{}{"payment_status": status, "updated_at": time.Now()}).Error
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return false, err
+	}
+	p.Status = status
+	return true, nil
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/utils/encryption"
+)
+
+//Ways a provider can be paid out
+const (
+	PayoutMobileMoney = "mobile_money"
+	PayoutBank        = "bank"
+)
+
+//Where a provider's earnings are sent, readable only by the provider
+type PayoutDetails struct {
+	Method        string `json:"method"`
+	Provider      string `json:"provider,omitempty"` //Mobile money operator, e.g. mpesa
+	Phone         string `json:"phone_number,omitempty"`
+	BankName      string `json:"bank_name,omitempty"`
+	BranchCode    string `json:"branch_code,omitempty"`
+	AccountName   string `json:"account_name,omitempty"`
+	AccountNumber string `json:"account_number,omitempty"`
+}
+
+func (d *PayoutDetails) Prepare() {
+	d.Method = strings.ToLower(strings.TrimSpace(d.Method))
+	d.Provider = strings.ToLower(strings.TrimSpace(d.Provider))
+	d.Phone = strings.TrimSpace(d.Phone)
+	d.BankName = strings.TrimSpace(d.BankName)
+	d.BranchCode = strings.TrimSpace(d.BranchCode)
+	d.AccountName = strings.TrimSpace(d.AccountName)
+	d.AccountNumber = strings.Replace(strings.TrimSpace(d.AccountNumber), " ", "", -1)
+}
+
+func (d *PayoutDetails) Validate() error {
+	switch d.Method {
+	case PayoutMobileMoney:
+		if d.Provider == "" {
+			return apierror.Invalid("provider", "Required Mobile Money Provider")
+		}
+		if d.Phone == "" {
+			return apierror.Invalid("phone_number", "Required Phone Number")
+		}
+	case PayoutBank:
+		if d.BankName == "" {
+			return apierror.Invalid("bank_name", "Required Bank Name")
+		}
+		if d.AccountName == "" {
+			return apierror.Invalid("account_name", "Required Account Name")
+		}
+		if len(d.AccountNumber) < 4 {
+			return apierror.Invalid("account_number", "Required Account Number")
+		}
+	default:
+		return errors.New("Invalid Payout Method")
+	}
+	return nil
+}
+
+//Masked description safe to show, e.g. "mpesa ****5678"
+func (d *PayoutDetails) Summary() string {
+	number, name := d.AccountNumber, d.BankName
+	if d.Method == PayoutMobileMoney {
+		number, name = d.Phone, d.Provider
+	}
+	if len(number) > 4 {
+		number = number[len(number)-4:]
+	}
+	return name + " ****" + number
+}
+
+//Stored payout details, encrypted at rest
+type PayoutAccount struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32    `gorm:"not null;unique" json:"user_id"`
+	Method    string    `gorm:"size:20;not null" json:"method"`
+	Summary   string    `gorm:"size:100;not null" json:"summary"`
+	Details   string    `gorm:"type:text;not null" json:"-"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+//Encrypt the details into the account
+func (p *PayoutAccount) SetDetails(details PayoutDetails) error {
+	plaintext, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	p.Details, err = encryption.Encrypt(plaintext)
+	if err != nil {
+		return err
+	}
+	p.Method = details.Method
+	p.Summary = details.Summary()
+	return nil
+}
+
+//Decrypt the details stored in the account
+func (p *PayoutAccount) DecryptDetails() (*PayoutDetails, error) {
+	plaintext, err := encryption.Decrypt(p.Details)
+	if err != nil {
+		return &PayoutDetails{}, err
+	}
+	details := PayoutDetails{}
+	err = json.Unmarshal(plaintext, &details)
+	if err != nil {
+		return &PayoutDetails{}, err
+	}
+	return &details, nil
+}
+
+//Create or replace the user's payout account
+func (p *PayoutAccount) SavePayoutAccount(ctx context.Context, db *gorm.DB) (*PayoutAccount, error) {
+	db = database.WithContext(ctx, db)
+
+	existing := PayoutAccount{}
+	err := db.Debug().Model(&PayoutAccount{}).Where("user_id = ?", p.UserID).Take(&existing).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return &PayoutAccount{}, err
+	}
+
+	p.UpdatedAt = time.Now()
+	if existing.ID == 0 {
+		p.CreatedAt = time.Now()
+		err = db.Debug().Model(&PayoutAccount{}).Create(&p).Error
+	} else {
+		p.ID = existing.ID
+		p.CreatedAt = existing.CreatedAt
+		err = db.Debug().Model(&PayoutAccount{}).Where("id = ?", existing.ID).UpdateColumns(
+			map[string]interface{}{
+				"method":     p.Method,
+				"summary":    p.Summary,
+				"details":    p.Details,
+				"updated_at": p.UpdatedAt,
+			},
+		).Error
+	}
+	if err != nil {
+		return &PayoutAccount{}, err
+	}
+	return p, nil
+}
+
+//Find the user's payout account
+func (p *PayoutAccount) FindPayoutAccount(ctx context.Context, db *gorm.DB, uid uint32) (*PayoutAccount, error) {
+	db = database.WithContext(ctx, db)
+
+	err := db.Debug().Model(&PayoutAccount{}).Where("user_id = ?", uid).Take(&p).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &PayoutAccount{}, errors.New("Payout details not found")
+	}
+	if err != nil {
+		return &PayoutAccount{}, err
+	}
+	return p, nil
+}
+
+//Whether the user can be paid out
+func HasPayoutAccount(ctx context.Context, db *gorm.DB, uid uint32) (bool, error) {
+	db = database.WithContext(ctx, db)
+
+	var count int
+	err := db.Debug().Model(&PayoutAccount{}).Where("user_id = ?", uid).Count(&count).Error
+	return count > 0, err
+}
+
+//Remove the user's payout account
+func (p *PayoutAccount) DeletePayoutAccount(ctx context.Context, db *gorm.DB, uid uint32) (int64, error) {
+	db = database.WithContext(ctx, db)
+
+	db = db.Debug().Model(&PayoutAccount{}).Where("user_id = ?", uid).Take(&PayoutAccount{}).Delete(&PayoutAccount{})
+	if db.Error != nil {
+		if gorm.IsRecordNotFoundError(db.Error) {
+			return 0, errors.New("Payout details not found")
+		}
+		return 0, db.Error
+	}
+	return db.RowsAffected, nil
+}
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
+)
+
+const (
+	//How long a code texted to a phone stays valid
+	PhoneCodeLifetime = 10 * time.Minute
+	//How long to wait before texting another code, texts cost money
+	PhoneCodeResendInterval = time.Minute
+)
+
+var (
+	ErrInvalidPhoneCode  = errors.New("Invalid Verification Code")
+	ErrPhoneCodeTooSoon  = errors.New("Wait Before Requesting Another Code")
+	ErrPhoneVerified     = errors.New("Phone Number Already Verified")
+	ErrPhoneNumberAbsent = errors.New("Add A Phone Number First")
+	ErrPhoneNotE164      = errors.New("Phone Number Must Start With The Country Code")
+	ErrPhoneOptedOut     = errors.New("Texts To This Number Were Stopped, Reply START To Get Them Again")
+)
+
+//One-time code texted to confirm the user owns their phone number. It only confirms the number it was
+//sent to, so changing the number in between makes it useless.
+type PhoneCode struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"-"`
+	UserID    uint32    `gorm:"not null;unique_index" json:"-"`
+	Phone     string    `gorm:"size:25;not null" json:"phone_number"`
+	CodeHash  string    `gorm:"size:64;not null" json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+	//Set when the provider reported the text undelivered, another code can be asked for right away
+	DeliveryFailedAt *time.Time `json:"delivery_failed_at,omitempty"`
+	DeliveryError    string     `gorm:"size:100;not null;default:''" json:"-"`
+	CreatedAt        time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+//Six random digits, easy to type from a text
+func newPhoneCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+//Replace the user's phone code with a new one for their current number and return it in plain form
+func IssuePhoneCode(ctx context.Context, db *gorm.DB, uid uint32) (*PhoneCode, string, error) {
+	db = database.WithContext(ctx, db)
+
+	user := User{}
+	userFound, err := user.FindUserByID(ctx, db, uid)
+	if err != nil {
+		return &PhoneCode{}, "", err
+	}
+	if !userFound.HasPhone() {
+		return &PhoneCode{}, "", ErrPhoneNumberAbsent
+	}
+	if userFound.PhoneVerified {
+		return &PhoneCode{}, "", ErrPhoneVerified
+	}
+	if userFound.SMSOptedOut {
+		return &PhoneCode{}, "", ErrPhoneOptedOut
+	}
+	//SMS providers only take international numbers
+	if !e164Phone.MatchString(userFound.Phone) {
+		return &PhoneCode{}, "", ErrPhoneNotE164
+	}
+
+	previous := PhoneCode{}
+	err = db.Debug().Model(&PhoneCode{}).Where("user_id = ?", uid).Take(&previous).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return &PhoneCode{}, "", err
+	}
+	if err == nil && previous.Phone == userFound.Phone && previous.DeliveryFailedAt == nil && time.Since(previous.CreatedAt) < PhoneCodeResendInterval {
+		return &PhoneCode{}, "", ErrPhoneCodeTooSoon
+	}
+
+	code, err := newPhoneCode()
+	if err != nil {
+		return &PhoneCode{}, "", err
+	}
+	phoneCode := PhoneCode{
+		UserID:    uid,
+		Phone:     userFound.Phone,
+		CodeHash:  tokens.Hash(code),
+		ExpiresAt: time.Now().Add(PhoneCodeLifetime),
+		CreatedAt: time.Now(),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Debug().Where("user_id = ?", uid).Delete(&PhoneCode{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Debug().Model(&PhoneCode{}).Create(&phoneCode).Error
+	})
+	if err != nil {
+		return &PhoneCode{}, "", err
+	}
+	return &phoneCode, code, nil
+}
+
+//Check a texted code and mark the number it was sent to verified, too many wrong tries throw the code away
+func VerifyPhoneCode(ctx context.Context, db *gorm.DB, uid uint32, code string) error {
+	db = database.WithContext(ctx, db)
+
+	attempts, err := StartVerificationAttempt(ctx, db, uid, AttemptsPhoneCode)
+	if err != nil {
+		return err
+	}
+
+	phoneCode := PhoneCode{}
+	err = db.Debug().Model(&PhoneCode{}).Where("user_id = ? and code_hash = ? and expires_at > ?", uid, tokens.Hash(strings.TrimSpace(code)), time.Now()).Take(&phoneCode).Error
+	if gorm.IsRecordNotFoundError(err) {
+		if attempts >= MaxVerificationAttempts {
+			err = db.Debug().Where("user_id = ?", uid).Delete(&PhoneCode{}).Error
+			if err == nil {
+				err = ClearVerificationAttempts(ctx, db, uid, AttemptsPhoneCode)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return ErrInvalidPhoneCode
+	}
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		//Only the number the code went to, the user may have changed it since
+		update := tx.Debug().Model(&User{}).Where("id = ? and phone = ?", uid, phoneCode.Phone).UpdateColumns(
+			map[string]interface{}{
+				"phone_verified": true,
+				"updated_at":     time.Now(),
+			},
+		)
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return ErrInvalidPhoneCode
+		}
+		return tx.Debug().Where("user_id = ?", uid).Delete(&PhoneCode{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	return ClearVerificationAttempts(ctx, db, uid, AttemptsPhoneCode)
+}
+
+//Set whether the user's current phone number is verified, a new number has to be verified again and
+//starts out getting texts whatever the old one replied
+func SetPhoneVerified(ctx context.Context, db *gorm.DB, uid uint32, verified bool) error {
+	db = database.WithContext(ctx, db)
+
+	columns := map[string]interface{}{
+		"phone_verified": verified,
+		"updated_at":     time.Now(),
+	}
+	if !verified {
+		columns["sms_opted_out"] = false
+	}
+	return db.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumns(columns).Error
+}
+
+//Marks the unexpired code texted to the number as undelivered with the provider's reason, returns how many
+//codes there were. Codes are the only texts sent, so any failure for the number is the code's.
+func MarkPhoneCodeUndelivered(ctx context.Context, db *gorm.DB, phone, reason string) (int64, error) {
+	db = database.WithContext(ctx, db)
+
+	if len(reason) > 100 {
+		reason = reason[:100]
+	}
+	update := db.Debug().Model(&PhoneCode{}).Where("phone = ? and expires_at > ? and delivery_failed_at is null", phone, time.Now()).UpdateColumns(
+		map[string]interface{}{
+			"delivery_failed_at": time.Now(),
+			"delivery_error":     reason,
+		},
+	)
+	return update.RowsAffected, update.Error
+}
+
+//Stops or resumes texting the users with the number, returning how many there were. Stopping also
+//withdraws their marketing consent, starting again doesn't give it back.
+func SetSMSOptOut(ctx context.Context, db *gorm.DB, phone string, optedOut bool) (int64, error) {
+	db = database.WithContext(ctx, db)
+
+	users := []User{}
+	err := db.Debug().Model(&User{}).Select("id").Where("phone = ? and sms_opted_out = ?", phone, !optedOut).Find(&users).Error
+	if err != nil || len(users) == 0 {
+		return 0, err
+	}
+	uids := make([]uint32, len(users))
+	for i := range users {
+		uids[i] = users[i].ID
+	}
+	err = db.Debug().Model(&User{}).Where("id in (?)", uids).UpdateColumns(
+		map[string]interface{}{
+			"sms_opted_out": optedOut,
+			"updated_at":    time.Now(),
+		},
+	).Error
+	if err != nil {
+		return 0, err
+	}
+	if optedOut {
+		for _, uid := range uids {
+			_, err = SetMarketingConsent(ctx, db, uid, false, "")
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	return int64(len(uids)), nil
+}
@@ -1,20 +1,18 @@
 package models
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"html"
 	"mime/multipart"
-	"net/http"
-	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/globalsign/mgo/bson"
 	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/storage"
 )
 
 type Post struct {
@@ -53,22 +51,23 @@ func (p *Post) Prepare() {
 
 func (p *Post) Validate() error {
 	if p.Description == "" {
-		return errors.New("Required Description")
+		return apierror.Invalid("description", "Required Description")
 	}
 	if p.Category == "" {
-		return errors.New("Required Category")
+		return apierror.Invalid("category", "Required Category")
 	}
 	if p.UserID < 1 {
-		return errors.New("Required User ID")
+		return apierror.Invalid("user_id", "Required User ID")
 	}
 	if p.ImageURL == "" {
-		return errors.New("Required Image")
+		return apierror.Invalid("image_url", "Required Image")
 	}
 	return nil
 }
 
 //Upload a new post
-func (p *Post) UploadPost(db *gorm.DB) (*Post, error) {
+func (p *Post) UploadPost(ctx context.Context, db *gorm.DB) (*Post, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 	err = db.Debug().Model(&Post{}).Create(&p).Error
 	if err != nil {
@@ -84,7 +83,8 @@ func (p *Post) UploadPost(db *gorm.DB) (*Post, error) {
 }
 
 //Return all posts
-func (p *Post) FindAllPosts(db *gorm.DB) (*[]Post, error) {
+func (p *Post) FindAllPosts(ctx context.Context, db *gorm.DB) (*[]Post, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 
 	posts := []Post{}
@@ -106,7 +106,8 @@ func (p *Post) FindAllPosts(db *gorm.DB) (*[]Post, error) {
 }
 
 //Return all post from specific user
-func (p *Post) FindPostByID(db *gorm.DB, pid uint64) (*Post, error) {
+func (p *Post) FindPostByID(ctx context.Context, db *gorm.DB, pid uint64) (*Post, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 	err = db.Debug().Model(&Post{}).Where("id = ?", pid).Take(&p).Error
 	if err != nil {
@@ -139,7 +140,8 @@ func (p *Post) FindPostByID(db *gorm.DB, pid uint64) (*Post, error) {
 // 	return p, nil
 // }
 
-func (p *Post) UpdateAPost(db *gorm.DB, pid uint32) (*Post, error) {
+func (p *Post) UpdateAPost(ctx context.Context, db *gorm.DB, pid uint32) (*Post, error) {
+	db = database.WithContext(ctx, db)
 
 	db = db.Debug().Model(&Post{}).Where("id = ?", pid).Take(&Post{}).UpdateColumns(
 		map[string]interface{}{
@@ -161,7 +163,8 @@ func (p *Post) UpdateAPost(db *gorm.DB, pid uint32) (*Post, error) {
 }
 
 //Delete a post
-func (p *Post) DeleteAPost(db *gorm.DB, pid uint64, uid uint32) (int64, error) {
+func (p *Post) DeleteAPost(ctx context.Context, db *gorm.DB, pid uint64, uid uint32) (int64, error) {
+	db = database.WithContext(ctx, db)
 
 	db = db.Debug().Model(&Post{}).Where("id = ? and user_id = ?", pid, uid).Take(&Post{}).Delete(&Post{})
 
@@ -175,36 +178,19 @@ func (p *Post) DeleteAPost(db *gorm.DB, pid uint64, uid uint32) (int64, error) {
 }
 
 //Upload an post image to AWS S3
-func UploadPostPicToS3(path string, s *session.Session, file multipart.File, fileHeader *multipart.FileHeader) (string, error) {
-	urlLink := "https://vickikbt-fixit-app.s3.us-east-2.amazonaws.com/"
-
-	size := fileHeader.Size
-	buffer := make([]byte, size)
-	file.Read(buffer)
-
-	// create a unique file name for the file
-	tempFileName := path + "/" + bson.NewObjectId().Hex() + filepath.Ext(fileHeader.Filename)
-
-	_, err := s3.New(s).PutObject(&s3.PutObjectInput{
-		Bucket:               aws.String("vickikbt-fixit-app"), //Bucket name
-		Key:                  aws.String(tempFileName),         //File name
-		ACL:                  aws.String("public-read"),        // Access type- public
-		Body:                 bytes.NewReader(buffer),
-		ContentLength:        aws.Int64(int64(size)),
-		ContentType:          aws.String(http.DetectContentType(buffer)),
-		ContentDisposition:   aws.String("attachment"),
-		ServerSideEncryption: aws.String("AES256"),
-		StorageClass:         aws.String("INTELLIGENT_TIERING"),
-	})
+func UploadPostPicToS3(ctx context.Context, db *gorm.DB, uid uint32, path string, s *session.Session, file multipart.File, fileHeader *multipart.FileHeader, maxSize int64) (string, error) {
+	config := storage.S3Settings()
+	tempFileName, err := putS3Object(ctx, db, uid, path, config.ACL, s, file, fileHeader, maxSize)
 	if err != nil {
 		return "", err
 	}
 
-	return urlLink + tempFileName, err
+	return config.URL(tempFileName), err
 }
 
 //Find booking of a post
-func (b *Booking) FindPostBookings(db *gorm.DB, pid uint64) (*[]Booking, error) {
+func (b *Booking) FindPostBookings(ctx context.Context, db *gorm.DB, pid uint64) (*[]Booking, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 
 	booking := []Booking{}
@@ -235,7 +221,8 @@ func (b *Booking) FindPostBookings(db *gorm.DB, pid uint64) (*[]Booking, error)
 	return &booking, err
 }
 
-func (p *Post) FindUserPosts(db *gorm.DB, pid uint64) (*[]Post, error) {
+func (p *Post) FindUserPosts(ctx context.Context, db *gorm.DB, pid uint64) (*[]Post, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 
 	post := []Post{}
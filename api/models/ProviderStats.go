@@ -0,0 +1,209 @@
+package models
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+const (
+	//Bookings made within this long count towards a provider's stats
+	ProviderStatsWindow = 90 * 24 * time.Hour
+	//Fewest bookings or responses a rate is shown for, one declined booking shouldn't make a 0% provider
+	ProviderStatsMinSample = 5
+	//A confirmed booking untouched for this long is counted as not completed
+	ProviderStatsOverdue = 14 * 24 * time.Hour
+)
+
+//How responsive and reliable a provider has been lately, recomputed when their bookings and quotes change
+//and daily so old bookings fall out of the window. Rates are nil until there are enough bookings.
+type ProviderStats struct {
+	ID     uint64 `gorm:"primary_key;auto_increment" json:"-"`
+	UserID uint32 `gorm:"not null;unique_index" json:"-"`
+	//Median minutes the provider took to answer a customer's counter offer
+	ResponseMinutes *float64 `json:"median_response_minutes"`
+	Responses       int      `gorm:"not null" json:"responses"`
+	//Share of decided bookings that were agreed, out of confirmed, completed and declined ones
+	AcceptanceRate *float64 `json:"acceptance_rate"`
+	Decided        int      `gorm:"not null" json:"-"`
+	//Share of agreed bookings that were completed, out of completed and overdue confirmed ones
+	CompletionRate *float64  `json:"completion_rate"`
+	Agreed         int       `gorm:"not null" json:"-"`
+	UpdatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+//Rank of the provider in searches between 0 and 1, the mean of acceptance, completion and how quickly they
+//respond. Providers without stats yet rank in the middle so new providers still get seen.
+func (s *ProviderStats) Score() float64 {
+	if s == nil {
+		return 0.5
+	}
+	parts := []float64{}
+	if s.AcceptanceRate != nil {
+		parts = append(parts, *s.AcceptanceRate)
+	}
+	if s.CompletionRate != nil {
+		parts = append(parts, *s.CompletionRate)
+	}
+	if s.ResponseMinutes != nil {
+		//An hour is worth half, a day next to nothing
+		parts = append(parts, 1/(1+*s.ResponseMinutes/60))
+	}
+	if len(parts) == 0 {
+		return 0.5
+	}
+	sum := 0.0
+	for _, part := range parts {
+		sum += part
+	}
+	return sum / float64(len(parts))
+}
+
+func rate(part, whole int) *float64 {
+	if whole < ProviderStatsMinSample {
+		return nil
+	}
+	//Two decimals is plenty for a percentage
+	value := math.Round(float64(part)/float64(whole)*100) / 100
+	return &value
+}
+
+//Work out the provider's stats from their bookings and quotes and store them
+func RefreshProviderStats(ctx context.Context, db *gorm.DB, uid uint32, now time.Time) (*ProviderStats, error) {
+	db = database.WithContext(ctx, db)
+	since := now.Add(-ProviderStatsWindow)
+
+	stats := ProviderStats{UserID: uid, UpdatedAt: now}
+
+	bookings := []Booking{}
+	err := db.Debug().Model(&Booking{}).Select("id, status, updated_at").Where("user_id = ? and created_at > ?", uid, since).Find(&bookings).Error
+	if err != nil {
+		return &ProviderStats{}, err
+	}
+	accepted, completed := 0, 0
+	bids := []uint32{}
+	for _, booking := range bookings {
+		bids = append(bids, booking.ID)
+		switch booking.Status {
+		case BookingCompleted:
+			accepted++
+			completed++
+			stats.Decided++
+			stats.Agreed++
+		case BookingConfirmed:
+			accepted++
+			stats.Decided++
+			if now.Sub(booking.UpdatedAt) > ProviderStatsOverdue {
+				stats.Agreed++
+			}
+		case BookingDeclined:
+			stats.Decided++
+		}
+	}
+	stats.AcceptanceRate = rate(accepted, stats.Decided)
+	stats.CompletionRate = rate(completed, stats.Agreed)
+
+	//Counter offers by the customer that the provider has answered, the answer is the last update
+	quotes := []Quote{}
+	if len(bids) > 0 {
+		err = db.Debug().Model(&Quote{}).Select("created_at, updated_at").
+			Where("booking_id in (?) and author_id <> ? and status <> ?", bids, uid, QuotePending).Find(&quotes).Error
+		if err != nil {
+			return &ProviderStats{}, err
+		}
+	}
+	minutes := []float64{}
+	for _, quote := range quotes {
+		minutes = append(minutes, math.Max(quote.UpdatedAt.Sub(quote.CreatedAt).Minutes(), 0))
+	}
+	stats.Responses = len(minutes)
+	if len(minutes) >= ProviderStatsMinSample {
+		sort.Float64s(minutes)
+		median := minutes[len(minutes)/2]
+		if len(minutes)%2 == 0 {
+			median = (minutes[len(minutes)/2-1] + median) / 2
+		}
+		median = math.Round(median)
+		stats.ResponseMinutes = &median
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Debug().Where("user_id = ?", uid).Delete(&ProviderStats{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Debug().Model(&ProviderStats{}).Create(&stats).Error
+	})
+	if err != nil {
+		return &ProviderStats{}, err
+	}
+	return &stats, nil
+}
+
+//Providers whose stats may have changed since the last daily run: those with bookings in the window and
+//those with stored stats, whose bookings may have just left it
+func FindProvidersForStats(ctx context.Context, db *gorm.DB, now time.Time) ([]uint32, error) {
+	db = database.WithContext(ctx, db)
+
+	uids := []uint32{}
+	err := db.Debug().Model(&Booking{}).Where("created_at > ?", now.Add(-ProviderStatsWindow)).Pluck("distinct user_id", &uids).Error
+	if err != nil {
+		return []uint32{}, err
+	}
+	stored := []uint32{}
+	err = db.Debug().Model(&ProviderStats{}).Pluck("user_id", &stored).Error
+	if err != nil {
+		return []uint32{}, err
+	}
+
+	seen := map[uint32]bool{}
+	for _, uid := range uids {
+		seen[uid] = true
+	}
+	for _, uid := range stored {
+		if !seen[uid] {
+			seen[uid] = true
+			uids = append(uids, uid)
+		}
+	}
+	return uids, nil
+}
+
+//Stats of each of the users keyed by id, users without stats yet are left out
+func FindProviderStats(ctx context.Context, db *gorm.DB, uids []uint32) (map[uint32]*ProviderStats, error) {
+	db = database.WithContext(ctx, db)
+
+	byUser := map[uint32]*ProviderStats{}
+	if len(uids) == 0 {
+		return byUser, nil
+	}
+	stats := []ProviderStats{}
+	err := db.Debug().Model(&ProviderStats{}).Where("user_id in (?)", uids).Find(&stats).Error
+	if err != nil {
+		return byUser, err
+	}
+	for i := range stats {
+		byUser[stats[i].UserID] = &stats[i]
+	}
+	return byUser, nil
+}
+
+//Load the stats of each of the users
+func LoadProviderStats(ctx context.Context, db *gorm.DB, users []User) error {
+	uids := make([]uint32, len(users))
+	for i := range users {
+		uids[i] = users[i].ID
+	}
+	stats, err := FindProviderStats(ctx, db, uids)
+	if err != nil {
+		return err
+	}
+	for i := range users {
+		users[i].Stats = stats[users[i].ID]
+	}
+	return nil
+}
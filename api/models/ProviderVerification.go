@@ -0,0 +1,208 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
+)
+
+//Where a provider is in the identity checks (KYC). Customers and providers who signed up before the
+//checks have none, new providers are left out of searches until they are approved.
+const (
+	KYCPending  = "pending"
+	KYCApproved = "approved"
+	KYCRejected = "rejected"
+)
+
+//Identity documents providers can be checked with
+var kycDocumentTypes = map[string]bool{
+	"national_id": true,
+	"passport":    true,
+	"alien_id":    true,
+}
+
+var (
+	ErrDocumentRegistered       = errors.New("Document Already Registered")
+	ErrProviderVerificationDone = errors.New("Verification Already Approved")
+)
+
+//Identity document a provider submitted for the checks. The number is kept for the admins comparing it
+//with the registry, its hash stops one document from verifying several accounts.
+type ProviderVerification struct {
+	ID             uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID         uint32     `gorm:"not null;unique_index" json:"user_id"`
+	LegalName      string     `gorm:"size:255;not null" json:"legal_name"`
+	DocumentType   string     `gorm:"size:20;not null" json:"document_type"`
+	DocumentNumber string     `gorm:"size:50;not null" json:"document_number"`
+	DocumentHash   string     `gorm:"size:64;not null;unique_index" json:"-"`
+	Status         string     `gorm:"size:20;not null;index" json:"status"`
+	Reason         string     `gorm:"size:255;not null;default:''" json:"reason"` //Why it was rejected, shown to the provider
+	ReviewedBy     uint32     `gorm:"not null;default:0" json:"reviewed_by"`
+	ReviewedAt     *time.Time `json:"reviewed_at"`
+	CreatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (v *ProviderVerification) Prepare() {
+	v.ID = 0
+	v.LegalName = html.EscapeString(strings.TrimSpace(v.LegalName))
+	v.DocumentType = strings.ToLower(strings.TrimSpace(v.DocumentType))
+	v.DocumentNumber = strings.ToUpper(strings.Join(strings.Fields(v.DocumentNumber), ""))
+	v.DocumentHash = tokens.Hash(v.DocumentType + ":" + v.DocumentNumber)
+	v.Status = KYCPending
+	v.Reason = ""
+	v.ReviewedBy = 0
+	v.ReviewedAt = nil
+	v.CreatedAt = time.Now()
+	v.UpdatedAt = time.Now()
+}
+
+func (v *ProviderVerification) Validate() error {
+	if v.LegalName == "" {
+		return apierror.Invalid("legal_name", "Required Legal Name")
+	}
+	if !kycDocumentTypes[v.DocumentType] {
+		return errors.New("Invalid Document Type")
+	}
+	if len(v.DocumentNumber) < 5 || len(v.DocumentNumber) > 50 {
+		return errors.New("Invalid Document Number")
+	}
+	return nil
+}
+
+//Whether another account already submitted the document
+func DocumentRegistered(ctx context.Context, db *gorm.DB, uid uint32, hash string) (bool, error) {
+	db = database.WithContext(ctx, db)
+
+	count := 0
+	err := db.Debug().Model(&ProviderVerification{}).Where("document_hash = ? and user_id <> ?", hash, uid).Count(&count).Error
+	return count > 0, err
+}
+
+//Store the provider's document for review, replacing one that was rejected, and mark them pending
+func (v *ProviderVerification) SubmitProviderVerification(ctx context.Context, db *gorm.DB) (*ProviderVerification, error) {
+	db = database.WithContext(ctx, db)
+
+	registered, err := DocumentRegistered(ctx, db, v.UserID, v.DocumentHash)
+	if err != nil {
+		return &ProviderVerification{}, err
+	}
+	if registered {
+		return &ProviderVerification{}, ErrDocumentRegistered
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		existing := ProviderVerification{}
+		err := tx.Debug().Model(&ProviderVerification{}).Set("gorm:query_option", "FOR UPDATE").Where("user_id = ?", v.UserID).Take(&existing).Error
+		switch {
+		case gorm.IsRecordNotFoundError(err):
+			err = tx.Debug().Create(v).Error
+		case err != nil:
+			return err
+		case existing.Status == KYCApproved:
+			return ErrProviderVerificationDone
+		default:
+			v.ID, v.CreatedAt = existing.ID, existing.CreatedAt
+			err = tx.Debug().Save(v).Error
+		}
+		if _, duplicate := duplicateKeyField(err); duplicate {
+			return ErrDocumentRegistered
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Debug().Model(&User{}).Where("id = ?", v.UserID).UpdateColumns(
+			map[string]interface{}{"kyc_status": KYCPending, "updated_at": time.Now()},
+		).Error
+	})
+	if err != nil {
+		return &ProviderVerification{}, err
+	}
+	return v, nil
+}
+
+//The user's submission, if any
+func FindProviderVerification(ctx context.Context, db *gorm.DB, uid uint32) (*ProviderVerification, error) {
+	db = database.WithContext(ctx, db)
+
+	verification := ProviderVerification{}
+	err := db.Debug().Model(&ProviderVerification{}).Where("user_id = ?", uid).Take(&verification).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &ProviderVerification{}, errors.New("Verification Not Found")
+	}
+	if err != nil {
+		return &ProviderVerification{}, err
+	}
+	return &verification, nil
+}
+
+//Submissions with the status, oldest first so they are reviewed in order
+func FindProviderVerifications(ctx context.Context, db *gorm.DB, status string) (*[]ProviderVerification, error) {
+	db = database.WithContext(ctx, db)
+
+	verifications := []ProviderVerification{}
+	err := db.Debug().Model(&ProviderVerification{}).Where("status = ?", status).Order("created_at asc").Limit(100).Find(&verifications).Error
+	if err != nil {
+		return &[]ProviderVerification{}, err
+	}
+	return &verifications, nil
+}
+
+//Approve or reject a pending submission, the provider's status follows it
+func ReviewProviderVerification(ctx context.Context, db *gorm.DB, id uint64, reviewer uint32, status, reason string) (*ProviderVerification, error) {
+	db = database.WithContext(ctx, db)
+
+	if status != KYCApproved && status != KYCRejected {
+		return &ProviderVerification{}, errors.New("Invalid Status")
+	}
+	reason = html.EscapeString(strings.TrimSpace(reason))
+	if status == KYCRejected && reason == "" {
+		return &ProviderVerification{}, apierror.Invalid("reason", "Required Reason")
+	}
+	if status == KYCApproved {
+		reason = ""
+	}
+
+	verification := ProviderVerification{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Debug().Model(&ProviderVerification{}).Set("gorm:query_option", "FOR UPDATE").Where("id = ?", id).Take(&verification).Error
+		if gorm.IsRecordNotFoundError(err) {
+			return errors.New("Verification Not Found")
+		}
+		if err != nil {
+			return err
+		}
+		if verification.Status != KYCPending {
+			return errors.New("Verification Already Reviewed")
+		}
+
+		now := time.Now()
+		verification.Status, verification.Reason, verification.ReviewedBy, verification.ReviewedAt = status, reason, reviewer, &now
+		err = tx.Debug().Model(&ProviderVerification{}).Where("id = ?", id).UpdateColumns(
+			map[string]interface{}{
+				"status":      status,
+				"reason":      reason,
+				"reviewed_by": reviewer,
+				"reviewed_at": now,
+				"updated_at":  now,
+			},
+		).Error
+		if err != nil {
+			return err
+		}
+		return tx.Debug().Model(&User{}).Where("id = ?", verification.UserID).UpdateColumns(
+			map[string]interface{}{"kyc_status": status, "updated_at": now},
+		).Error
+	})
+	if err != nil {
+		return &ProviderVerification{}, err
+	}
+	return &verification, nil
+}
@@ -0,0 +1,212 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//Quote states
+const (
+	QuotePending   = "Pending"
+	QuoteAccepted  = "Accepted"
+	QuoteDeclined  = "Declined"
+	QuoteCountered = "Countered"
+)
+
+//Booking states driven by the quote workflow
+const (
+	BookingNegotiating = "Negotiating"
+	BookingConfirmed   = "Confirmed"
+	BookingDeclined    = "Declined"
+)
+
+//Price offered on a booking by the provider or, when countering, by the customer
+type Quote struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	BookingID uint32    `gorm:"not null;index" json:"booking_id"`
+	AuthorID  uint32    `gorm:"not null" json:"author_id"`
+	Amount    float64   `gorm:"not null" json:"amount"`
+	Message   string    `gorm:"size:1000" json:"message"`
+	Status    string    `gorm:"size:20;not null" json:"status"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (q *Quote) Prepare() {
+	q.ID = 0
+	q.Message = html.EscapeString(strings.TrimSpace(q.Message))
+	q.Status = QuotePending
+	q.CreatedAt = time.Now()
+	q.UpdatedAt = time.Now()
+}
+
+func (q *Quote) Validate() error {
+	if q.BookingID < 1 {
+		return apierror.Invalid("booking_id", "Required Booking ID")
+	}
+	if q.AuthorID < 1 {
+		return apierror.Invalid("author_id", "Required Author ID")
+	}
+	if q.Amount <= 0 {
+		return apierror.Invalid("amount", "Required Amount")
+	}
+	return nil
+}
+
+//Find the customer and provider of a booking, the customer is the owner of the booked post
+func BookingParties(ctx context.Context, db *gorm.DB, bid uint32) (*Booking, uint32, error) {
+	db = database.WithContext(ctx, db)
+
+	booking := Booking{}
+	err := db.Debug().Model(&Booking{}).Where("id = ?", bid).Take(&booking).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Booking{}, 0, errors.New("Booking not found")
+	}
+	if err != nil {
+		return &Booking{}, 0, err
+	}
+
+	post := Post{}
+	err = db.Debug().Model(&Post{}).Where("id = ?", booking.PostID).Take(&post).Error
+	if err != nil {
+		return &Booking{}, 0, err
+	}
+	return &booking, post.UserID, nil
+}
+
+//Submit the provider's quote on a booking, only one quote can be open at a time
+func (q *Quote) SubmitQuote(ctx context.Context, db *gorm.DB) (*Quote, error) {
+	db = database.WithContext(ctx, db)
+
+	tx := db.Begin()
+	booking := Booking{}
+	err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&Booking{}).Where("id = ?", q.BookingID).Take(&booking).Error
+	if err != nil {
+		tx.Rollback()
+		return &Quote{}, err
+	}
+	if booking.Status == BookingConfirmed {
+		tx.Rollback()
+		return &Quote{}, errors.New("Booking Already Confirmed")
+	}
+
+	var open int
+	err = tx.Debug().Model(&Quote{}).Where("booking_id = ? and status = ?", q.BookingID, QuotePending).Count(&open).Error
+	if err != nil {
+		tx.Rollback()
+		return &Quote{}, err
+	}
+	if open > 0 {
+		tx.Rollback()
+		return &Quote{}, errors.New("A Quote Is Awaiting A Response")
+	}
+
+	err = tx.Debug().Model(&Quote{}).Create(&q).Error
+	if err != nil {
+		tx.Rollback()
+		return &Quote{}, err
+	}
+	err = tx.Debug().Model(&Booking{}).Where("id = ?", q.BookingID).UpdateColumns(Booking{Status: BookingNegotiating, UpdatedAt: time.Now()}).Error
+	if err != nil {
+		tx.Rollback()
+		return &Quote{}, err
+	}
+	return q, tx.Commit().Error
+}
+
+//Get the quote history of a booking, oldest first
+func (q *Quote) FindBookingQuotes(ctx context.Context, db *gorm.DB, bid uint32) (*[]Quote, error) {
+	db = database.WithContext(ctx, db)
+
+	quotes := []Quote{}
+	err := db.Debug().Model(&Quote{}).Where("booking_id = ?", bid).Order("id asc").Find(&quotes).Error
+	if err != nil {
+		return &[]Quote{}, err
+	}
+	return &quotes, nil
+}
+
+//Accept, decline or counter an open quote. Accepting confirms the booking at the quoted amount,
+//countering closes the quote and opens a new one by the responder. Returns the quote now open, if any.
+func (q *Quote) RespondToQuote(ctx context.Context, db *gorm.DB, bid uint32, qid uint64, responderID uint32, action string, counter *Quote) (*Quote, error) {
+	db = database.WithContext(ctx, db)
+
+	tx := db.Begin()
+	err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&Quote{}).Where("id = ? and booking_id = ?", qid, bid).Take(&q).Error
+	if gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return &Quote{}, errors.New("Quote not found")
+	}
+	if err != nil {
+		tx.Rollback()
+		return &Quote{}, err
+	}
+	if q.Status != QuotePending {
+		tx.Rollback()
+		return &Quote{}, errors.New("Quote Is No Longer Open")
+	}
+	if q.AuthorID == responderID {
+		tx.Rollback()
+		return &Quote{}, errors.New("Cannot Respond To Own Quote")
+	}
+
+	var quoteStatus, bookingStatus string
+	bookingColumns := map[string]interface{}{"updated_at": time.Now()}
+	switch action {
+	case "accept":
+		quoteStatus, bookingStatus = QuoteAccepted, BookingConfirmed
+		bookingColumns["bid"] = strconv.FormatFloat(q.Amount, 'f', 2, 64)
+	case "decline":
+		quoteStatus, bookingStatus = QuoteDeclined, BookingDeclined
+	case "counter":
+		if counter == nil {
+			tx.Rollback()
+			return &Quote{}, apierror.Invalid("counter", "Required Counter Quote")
+		}
+		quoteStatus, bookingStatus = QuoteCountered, BookingNegotiating
+	default:
+		tx.Rollback()
+		return &Quote{}, errors.New("Invalid Action")
+	}
+	bookingColumns["status"] = bookingStatus
+
+	err = tx.Debug().Model(&Quote{}).Where("id = ?", q.ID).UpdateColumns(map[string]interface{}{"status": quoteStatus, "updated_at": time.Now()}).Error
+	if err != nil {
+		tx.Rollback()
+		return &Quote{}, err
+	}
+	q.Status = quoteStatus
+
+	err = tx.Debug().Model(&Booking{}).Where("id = ?", q.BookingID).UpdateColumns(bookingColumns).Error
+	if err != nil {
+		tx.Rollback()
+		return &Quote{}, err
+	}
+
+	if action == "counter" {
+		counter.BookingID = q.BookingID
+		counter.AuthorID = responderID
+		err = tx.Debug().Model(&Quote{}).Create(&counter).Error
+		if err != nil {
+			tx.Rollback()
+			return &Quote{}, err
+		}
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		return &Quote{}, err
+	}
+	if action == "counter" {
+		return counter, nil
+	}
+	return q, nil
+}
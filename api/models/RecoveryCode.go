@@ -0,0 +1,128 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
+)
+
+const recoveryCodeCount = 10
+
+var ErrInvalidTwoFactorCode = errors.New("Invalid Two Factor Code")
+
+//One-time code that recovers an account when the second factor is lost
+type RecoveryCode struct {
+	ID        uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32     `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+//Strips the dash and casing from a code typed back by the user
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+}
+
+//Replace the user's recovery codes with a fresh set, returning the plain codes once
+func GenerateRecoveryCodes(ctx context.Context, db *gorm.DB, uid uint32) ([]string, error) {
+	db = database.WithContext(ctx, db)
+
+	err := db.Debug().Where("user_id = ?", uid).Delete(&RecoveryCode{}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	codes := []string{}
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := tokens.Generate(10)
+		if err != nil {
+			return nil, err
+		}
+		code = strings.ToLower(code)
+
+		recoveryCode := RecoveryCode{
+			UserID:    uid,
+			CodeHash:  tokens.Hash(code),
+			CreatedAt: time.Now(),
+		}
+		err = db.Debug().Model(&RecoveryCode{}).Create(&recoveryCode).Error
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+//Mark an unused recovery code of the user as used
+func UseRecoveryCode(ctx context.Context, db *gorm.DB, uid uint32, code string) error {
+	db = database.WithContext(ctx, db)
+
+	recoveryCode := RecoveryCode{}
+	err := db.Debug().Model(&RecoveryCode{}).Where("user_id = ? and code_hash = ? and used_at is null", uid, tokens.Hash(normalizeRecoveryCode(code))).Take(&recoveryCode).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return errors.New("Invalid Recovery Code")
+	}
+	if err != nil {
+		return err
+	}
+
+	return db.Debug().Model(&RecoveryCode{}).Where("id = ?", recoveryCode.ID).UpdateColumn("used_at", time.Now()).Error
+}
+
+//Remove all recovery codes of the user
+func DeleteRecoveryCodes(ctx context.Context, db *gorm.DB, uid uint32) error {
+	db = database.WithContext(ctx, db)
+	return db.Debug().Where("user_id = ?", uid).Delete(&RecoveryCode{}).Error
+}
+
+//Check an authenticator code, or a recovery code when allowed, counting the try so codes can't be enumerated.
+//An empty secret only accepts recovery codes. Each authenticator code is accepted once.
+func VerifyTwoFactor(ctx context.Context, db *gorm.DB, uid uint32, secret, code string, allowRecovery bool) error {
+	_, err := StartVerificationAttempt(ctx, db, uid, AttemptsTwoFactor)
+	if err != nil {
+		return err
+	}
+
+	valid := false
+	if secret != "" {
+		valid, err = useTOTP(ctx, db, uid, secret, code)
+		if err != nil {
+			return err
+		}
+	}
+	if !valid && allowRecovery {
+		valid = UseRecoveryCode(ctx, db, uid, code) == nil
+	}
+	if !valid {
+		return ErrInvalidTwoFactorCode
+	}
+	return ClearVerificationAttempts(ctx, db, uid, AttemptsTwoFactor)
+}
+
+//Accept an authenticator code of a time step after the last one used. The step is stored only if it is still
+//newer, so of two requests with the same code one gets in.
+func useTOTP(ctx context.Context, db *gorm.DB, uid uint32, secret, code string) (bool, error) {
+	db = database.WithContext(ctx, db)
+	user := User{}
+	err := db.Debug().Model(&User{}).Select("two_factor_counter").Where("id = ?", uid).Take(&user).Error
+	if err != nil {
+		return false, err
+	}
+	counter, ok := auth.ValidateTOTP(secret, code, user.TwoFactorCounter)
+	if !ok {
+		return false, nil
+	}
+	update := db.Debug().Model(&User{}).Where("id = ? and two_factor_counter < ?", uid, counter).UpdateColumn("two_factor_counter", counter)
+	if update.Error != nil {
+		return false, update.Error
+	}
+	return update.RowsAffected == 1, nil
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/victorkabata/FixIt-API/api/apierror"
+)
+
+//Body of a customer's sign up, only what a customer needs to book
+type CustomerRegistration struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone_number"`
+	Password string `json:"password"`
+	Locale   string `json:"locale"`
+	Address  string `json:"address"`
+	Region   string `json:"region"`
+	Country  string `json:"country"`
+	//Coordinates or a plus code of where the customer is
+	Latitude  float32   `json:"latitude"`
+	Longitude float32   `json:"longitude"`
+	PlusCode  string    `json:"plus_code"`
+	Languages Languages `json:"languages"`
+}
+
+//Body of a provider's sign up, a customer's with what they offer and the identity document the
+//admins check before the provider shows up in searches
+type ProviderRegistration struct {
+	CustomerRegistration
+	Specialisation string  `json:"specialisation"`
+	ServiceRadius  float64 `json:"service_radius_km"`
+	LegalName      string  `json:"legal_name"`
+	DocumentType   string  `json:"document_type"`
+	DocumentNumber string  `json:"document_number"`
+}
+
+//The customer to create, prepared and validated against the fields REQUIRED_FIELDS_CUSTOMER asks for
+func (c *CustomerRegistration) User() (*User, error) {
+	user := c.user()
+	user.Prepare()
+	return user, user.Validate("")
+}
+
+func (c *CustomerRegistration) user() *User {
+	user := User{
+		Username:  c.Username,
+		Email:     c.Email,
+		Phone:     c.Phone,
+		Password:  c.Password,
+		Locale:    c.Locale,
+		Address:   c.Address,
+		Region:    c.Region,
+		Country:   c.Country,
+		Latitude:  c.Latitude,
+		Longitude: c.Longitude,
+		PlusCode:  c.PlusCode,
+		Languages: c.Languages,
+	}
+	return &user
+}
+
+//The provider to create, waiting for the identity checks, and their identity document. Providers always
+//need a specialisation and a document, then the fields REQUIRED_FIELDS_PROVIDER asks for.
+func (p *ProviderRegistration) User() (*User, *ProviderVerification, error) {
+	user := p.CustomerRegistration.user()
+	user.Specialisation = p.Specialisation
+	user.ServiceRadius = p.ServiceRadius
+	user.Prepare()
+	verification := ProviderVerification{
+		LegalName:      p.LegalName,
+		DocumentType:   p.DocumentType,
+		DocumentNumber: p.DocumentNumber,
+	}
+	verification.Prepare()
+
+	if user.Specialisation == "" {
+		return user, &verification, apierror.Invalid("specialisation", "Required Specialisation")
+	}
+	if user.ServiceRadius < 0 || user.ServiceRadius > MaxServiceRadius {
+		return user, &verification, errors.New("Invalid Service Radius")
+	}
+	if err := user.Validate(""); err != nil {
+		return user, &verification, err
+	}
+	return user, &verification, verification.Validate()
+}
@@ -1,54 +1,213 @@
 package models
 
 import (
+	"context"
 	"errors"
 	"html"
+	"math"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/database"
 )
 
+//Returned when the customer already reviewed the booking
+var ErrAlreadyReviewed = errors.New("Booking Already Reviewed")
+
+//One review per booking, or per customer and provider for reviews made without a booking
 type Review struct {
 	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
-	UserID    uint32    `gorm:"not null;unique" json:"user_id"`
-	WorkerID  uint32    `gorm:"not null;unique" json:"worker_id"`
+	UserID    uint32    `gorm:"not null;unique_index:idx_reviews_booking" json:"user_id"`
+	WorkerID  uint32    `gorm:"not null;unique_index:idx_reviews_booking;index" json:"worker_id"`
+	BookingID uint32    `gorm:"not null;default:0;unique_index:idx_reviews_booking" json:"booking_id"`
 	User      User      `json:"user"`
 	Rating    uint32    `gorm:"not null" json:"rating"`
 	Comment   string    `gorm:"not null" json:"comment"`
+	Status    string    `gorm:"size:20;not null;default:'Published';index" json:"status"`
+	HeldFor   string    `gorm:"size:255" json:"held_for,omitempty"` //Why the review waits for moderation
 	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
 }
 
+//Average rating and number of published reviews of a provider
+type Reputation struct {
+	AverageRating float64 `json:"average_rating"`
+	ReviewCount   int     `json:"review_count"`
+}
+
+//Reputation of each of the users keyed by id, users without published reviews are left out
+func FindReputations(ctx context.Context, db *gorm.DB, uids []uint32) (map[uint32]Reputation, error) {
+	db = database.WithContext(ctx, db)
+
+	reputations := map[uint32]Reputation{}
+	if len(uids) == 0 {
+		return reputations, nil
+	}
+	rows, err := db.Debug().Model(&Review{}).Select("worker_id, avg(rating), count(*)").
+		Where("worker_id in (?) and status = ?", uids, ReviewPublished).Group("worker_id").Rows()
+	if err != nil {
+		return reputations, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var uid uint32
+		var reputation Reputation
+		err = rows.Scan(&uid, &reputation.AverageRating, &reputation.ReviewCount)
+		if err != nil {
+			return reputations, err
+		}
+		//One decimal is what the apps show
+		reputation.AverageRating = math.Round(reputation.AverageRating*10) / 10
+		reputations[uid] = reputation
+	}
+	return reputations, rows.Err()
+}
+
+//Load the reputation of each of the users
+func LoadReputations(ctx context.Context, db *gorm.DB, users []User) error {
+	uids := make([]uint32, len(users))
+	for i := range users {
+		uids[i] = users[i].ID
+	}
+	reputations, err := FindReputations(ctx, db, uids)
+	if err != nil {
+		return err
+	}
+	for i := range users {
+		users[i].Reputation = reputations[users[i].ID]
+	}
+	return nil
+}
+
+//Load the reputation of the user
+func (u *User) LoadReputation(ctx context.Context, db *gorm.DB) error {
+	reputations, err := FindReputations(ctx, db, []uint32{u.ID})
+	if err != nil {
+		return err
+	}
+	u.Reputation = reputations[u.ID]
+	return nil
+}
+
+//Rating and comment of a review before it was edited
+type ReviewEdit struct {
+	ID       uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	ReviewID uint64    `gorm:"not null;index" json:"review_id"`
+	Rating   uint32    `gorm:"not null" json:"rating"`
+	Comment  string    `gorm:"not null" json:"comment"`
+	EditedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"edited_at"`
+}
+
 func (r *Review) Prepare() {
 	r.ID = 0
 	r.User = User{}
 	//r.Rating = 0
 	r.Comment = html.EscapeString(strings.TrimSpace(r.Comment))
+	r.Status = ReviewPublished
+	r.HeldFor = ""
 	r.CreatedAt = time.Now()
 	r.UpdatedAt = time.Now()
 }
 
 func (r *Review) Validate() error {
 	if r.UserID < 1 {
-		return errors.New("Required user id")
+		return apierror.Invalid("user_id", "Required user id")
 	}
 	if r.WorkerID < 1 {
-		return errors.New("Required worker id")
+		return apierror.Invalid("worker_id", "Required worker id")
 	}
 	if r.Rating < 0 {
-		return errors.New("Required rating")
+		return apierror.Invalid("rating", "Required rating")
 	}
 	if r.Comment == "" {
-		return errors.New("Required comment")
+		return apierror.Invalid("comment", "Required comment")
+	}
+	return nil
+}
+
+//Check the reviewer may review the provider, filling in the booking the review is for.
+//Without a booking id the most recent completed booking between them is used.
+func (r *Review) CheckReviewBooking(ctx context.Context, db *gorm.DB) error {
+	db = database.WithContext(ctx, db)
+
+	if r.BookingID != 0 {
+		booking, customerID, err := BookingParties(ctx, db, r.BookingID)
+		if err != nil {
+			return err
+		}
+		if customerID != r.UserID || booking.UserID != r.WorkerID {
+			return errors.New("Booking Does Not Match Review")
+		}
+		if booking.Status != BookingCompleted {
+			return errors.New("Only Completed Bookings Can Be Reviewed")
+		}
+		return nil
+	}
+
+	if !ReviewsRequireBooking() {
+		return nil
+	}
+
+	booking := Booking{}
+	err := db.Debug().Model(&Booking{}).
+		Joins("JOIN posts ON posts.id = bookings.post_id").
+		Where("bookings.user_id = ? and posts.user_id = ? and bookings.status = ?", r.WorkerID, r.UserID, BookingCompleted).
+		Order("bookings.updated_at desc").Take(&booking).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return errors.New("Only Customers With A Completed Booking Can Review")
 	}
+	if err != nil {
+		return err
+	}
+	r.BookingID = booking.ID
 	return nil
 }
 
+//Reviews used to be limited to one per reviewer and one per provider by unique columns,
+//drop those indexes so reviews can be made per booking
+func MigrateReviews(db *gorm.DB) {
+	for _, index := range []string{"user_id", "worker_id"} {
+		if db.Dialect().HasIndex("reviews", index) {
+			db.Model(&Review{}).RemoveIndex(index)
+		}
+	}
+}
+
+//How long after posting a review can still be edited, REVIEW_EDIT_WINDOW in the environment
+func ReviewEditWindow() time.Duration {
+	window, err := time.ParseDuration(os.Getenv("REVIEW_EDIT_WINDOW"))
+	if err != nil || window < 0 {
+		return 7 * 24 * time.Hour
+	}
+	return window
+}
+
+//Whether the review can still be edited
+func (r *Review) Editable(now time.Time) bool {
+	return now.Before(r.CreatedAt.Add(ReviewEditWindow()))
+}
+
 //Upload a new rating
-func (r *Review) UploadReview(db *gorm.DB) (*Review, error) {
+func (r *Review) UploadReview(ctx context.Context, db *gorm.DB) (*Review, error) {
+	db = database.WithContext(ctx, db)
 	var err error
+
+	var existing int
+	err = db.Debug().Model(&Review{}).Where("user_id = ? and worker_id = ? and booking_id = ?", r.UserID, r.WorkerID, r.BookingID).Count(&existing).Error
+	if err != nil {
+		return &Review{}, err
+	}
+	if existing > 0 {
+		return &Review{}, ErrAlreadyReviewed
+	}
+
 	err = db.Debug().Model(&Review{}).Create(&r).Error
+	if _, duplicate := duplicateKeyField(err); duplicate {
+		return &Review{}, ErrAlreadyReviewed
+	}
 	if err != nil {
 		return &Review{}, err
 	}
@@ -63,12 +222,13 @@ func (r *Review) UploadReview(db *gorm.DB) (*Review, error) {
 }
 
 //Return all reviews
-func (r *Review) FindAllReviews(db *gorm.DB) (*[]Review, error) {
+func (r *Review) FindAllReviews(ctx context.Context, db *gorm.DB) (*[]Review, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 
 	reviews := []Review{}
 
-	err = db.Debug().Model(&Post{}).Order("created_at desc").Limit(100).Find(&reviews).Error
+	err = db.Debug().Model(&Review{}).Where("status = ?", ReviewPublished).Order("created_at desc").Limit(100).Find(&reviews).Error
 	if err != nil {
 		return &[]Review{}, err
 	}
@@ -85,13 +245,14 @@ func (r *Review) FindAllReviews(db *gorm.DB) (*[]Review, error) {
 }
 
 //Return all reviews for specific user
-func (r *Review) FindUserReviews(db *gorm.DB, pid uint64) (*[]Review, error) {
+func (r *Review) FindUserReviews(ctx context.Context, db *gorm.DB, pid uint64) (*[]Review, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 	//var ratings uint32
 
 	reviews := []Review{}
 
-	err = db.Debug().Model(&Review{}).Order("created_at desc").Limit(100).Where("worker_id=?", pid).Find(&reviews).Error
+	err = db.Debug().Model(&Review{}).Order("created_at desc").Limit(100).Where("worker_id=? and status=?", pid, ReviewPublished).Find(&reviews).Error
 	if err != nil {
 		return &[]Review{}, err
 	}
@@ -109,11 +270,23 @@ func (r *Review) FindUserReviews(db *gorm.DB, pid uint64) (*[]Review, error) {
 	return &reviews, nil
 }
 
-//Update an existing review
-func (r *Review) UpdateReview(db *gorm.DB) (*Review, error) {
+//Update an existing review, keeping its previous rating and comment in the history
+func (r *Review) UpdateReview(ctx context.Context, db *gorm.DB, previous *Review) (*Review, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 
-	err = db.Debug().Model(&Review{}).Where("id=?", r.ID).Updates(Review{Rating: r.Rating, Comment: r.Comment}).Error
+	tx := db.Begin()
+	err = tx.Debug().Model(&ReviewEdit{}).Create(&ReviewEdit{ReviewID: previous.ID, Rating: previous.Rating, Comment: previous.Comment, EditedAt: time.Now()}).Error
+	if err != nil {
+		tx.Rollback()
+		return &Review{}, err
+	}
+	err = tx.Debug().Model(&Review{}).Where("id=?", r.ID).Updates(Review{Rating: r.Rating, Comment: r.Comment}).Error
+	if err != nil {
+		tx.Rollback()
+		return &Review{}, err
+	}
+	err = tx.Commit().Error
 	if err != nil {
 		return &Review{}, err
 	}
@@ -126,8 +299,21 @@ func (r *Review) UpdateReview(db *gorm.DB) (*Review, error) {
 	return r, nil
 }
 
+//Get the earlier versions of a review, oldest first
+func FindReviewHistory(ctx context.Context, db *gorm.DB, rid uint64) (*[]ReviewEdit, error) {
+	db = database.WithContext(ctx, db)
+
+	edits := []ReviewEdit{}
+	err := db.Debug().Model(&ReviewEdit{}).Where("review_id = ?", rid).Order("id asc").Find(&edits).Error
+	if err != nil {
+		return &[]ReviewEdit{}, err
+	}
+	return &edits, nil
+}
+
 //Delete a review
-func (r *Review) DeleteReview(db *gorm.DB, pid uint64, uid uint32) (int64, error) {
+func (r *Review) DeleteReview(ctx context.Context, db *gorm.DB, pid uint64, uid uint32) (int64, error) {
+	db = database.WithContext(ctx, db)
 
 	db = db.Debug().Model(&Review{}).Where("id = ? and user_id = ?", pid, uid).Take(&Review{}).Delete(&Review{})
 
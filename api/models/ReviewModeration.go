@@ -0,0 +1,154 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//Review states
+const (
+	ReviewPublished = "Published"
+	ReviewHeld      = "Held"
+	ReviewRejected  = "Rejected"
+)
+
+//Returned when the author posted too many reviews recently
+var ErrReviewRateLimited = errors.New("Too Many Reviews, Try Again Later")
+
+//Similarity above which two comments count as the same text
+const duplicateReviewSimilarity = 0.8
+
+func envInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+//Reviews an author can post per day, REVIEW_DAILY_LIMIT in the environment
+func ReviewDailyLimit() int {
+	return envInt("REVIEW_DAILY_LIMIT", 5)
+}
+
+//Reviews within an hour after which further ones are held, REVIEW_BURST_THRESHOLD in the environment
+func ReviewBurstThreshold() int {
+	return envInt("REVIEW_BURST_THRESHOLD", 3)
+}
+
+//Check a new review against the author's recent reviews. Authors over the daily limit are refused,
+//bursts and comments repeating an earlier review are held for moderation.
+func (r *Review) Screen(ctx context.Context, db *gorm.DB, now time.Time) error {
+	db = database.WithContext(ctx, db)
+
+	recent := []Review{}
+	err := db.Debug().Model(&Review{}).Where("user_id = ? and created_at > ?", r.UserID, now.Add(-24*time.Hour)).Find(&recent).Error
+	if err != nil {
+		return err
+	}
+	if len(recent) >= ReviewDailyLimit() {
+		return ErrReviewRateLimited
+	}
+
+	lastHour := 0
+	for _, review := range recent {
+		if review.CreatedAt.After(now.Add(-time.Hour)) {
+			lastHour++
+		}
+	}
+	if lastHour >= ReviewBurstThreshold() {
+		r.hold(fmt.Sprintf("%d reviews within an hour", lastHour+1))
+		return nil
+	}
+
+	previous := []Review{}
+	err = db.Debug().Model(&Review{}).Where("user_id = ?", r.UserID).Order("created_at desc").Limit(50).Find(&previous).Error
+	if err != nil {
+		return err
+	}
+	for _, review := range previous {
+		if commentSimilarity(r.Comment, review.Comment) >= duplicateReviewSimilarity {
+			r.hold(fmt.Sprintf("Repeats the text of review %d", review.ID))
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *Review) hold(reason string) {
+	r.Status = ReviewHeld
+	r.HeldFor = reason
+}
+
+//Jaccard similarity of the word sets of two comments, 1 for identical text
+func commentSimilarity(a, b string) float64 {
+	wordsA, wordsB := commentWords(a), commentWords(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for word := range wordsA {
+		if wordsB[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(wordsA)+len(wordsB)-shared)
+}
+
+//Lower case words of a comment without punctuation
+func commentWords(comment string) map[string]bool {
+	words := map[string]bool{}
+	fields := strings.FieldsFunc(strings.ToLower(html.UnescapeString(comment)), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsNumber(c)
+	})
+	for _, word := range fields {
+		words[word] = true
+	}
+	return words
+}
+
+//Get reviews waiting for moderation, oldest first
+func FindHeldReviews(ctx context.Context, db *gorm.DB) (*[]Review, error) {
+	db = database.WithContext(ctx, db)
+
+	reviews := []Review{}
+	err := db.Debug().Model(&Review{}).Where("status = ?", ReviewHeld).Order("created_at asc").Limit(100).Find(&reviews).Error
+	if err != nil {
+		return &[]Review{}, err
+	}
+	return &reviews, nil
+}
+
+//Publish or reject a held review
+func (r *Review) ModerateReview(ctx context.Context, db *gorm.DB, rid uint64, status string) (*Review, error) {
+	db = database.WithContext(ctx, db)
+
+	if status != ReviewPublished && status != ReviewRejected {
+		return &Review{}, errors.New("Invalid Review Status")
+	}
+
+	update := db.Debug().Model(&Review{}).Where("id = ? and status = ?", rid, ReviewHeld).UpdateColumns(map[string]interface{}{"status": status, "updated_at": time.Now()})
+	if update.Error != nil {
+		return &Review{}, update.Error
+	}
+	if update.RowsAffected == 0 {
+		return &Review{}, errors.New("Review Is Not Held")
+	}
+
+	err := db.Debug().Model(&Review{}).Where("id = ?", rid).Take(&r).Error
+	if err != nil {
+		return &Review{}, err
+	}
+	return r, nil
+}
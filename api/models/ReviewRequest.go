@@ -0,0 +1,128 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//Reminder asking the customer of a completed booking to review the provider
+type ReviewRequest struct {
+	ID         uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	BookingID  uint32     `gorm:"not null;unique" json:"booking_id"`
+	CustomerID uint32     `gorm:"not null;index" json:"customer_id"`
+	ProviderID uint32     `gorm:"not null" json:"provider_id"`
+	SendAt     time.Time  `gorm:"not null;index" json:"send_at"`
+	SentAt     *time.Time `json:"sent_at"`
+	ReviewID   *uint64    `json:"review_id"`
+	CreatedAt  time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+//Wait between completing a booking and asking for a review, REVIEW_REQUEST_DELAY in the environment
+func ReviewRequestDelay() time.Duration {
+	delay, err := time.ParseDuration(os.Getenv("REVIEW_REQUEST_DELAY"))
+	if err != nil || delay < 0 {
+		return 2 * time.Hour
+	}
+	return delay
+}
+
+//Whether only customers with a completed booking can review a provider, REVIEWS_REQUIRE_BOOKING in the environment
+func ReviewsRequireBooking() bool {
+	required, err := strconv.ParseBool(os.Getenv("REVIEWS_REQUIRE_BOOKING"))
+	if err != nil {
+		return true
+	}
+	return required
+}
+
+//Mark a confirmed booking completed and schedule the review request
+func CompleteBooking(ctx context.Context, db *gorm.DB, bid uint32) (*Booking, error) {
+	db = database.WithContext(ctx, db)
+
+	booking, customerID, err := BookingParties(ctx, db, bid)
+	if err != nil {
+		return &Booking{}, err
+	}
+	if booking.Status != BookingConfirmed {
+		return &Booking{}, errors.New("Only Confirmed Bookings Can Be Completed")
+	}
+
+	tx := db.Begin()
+	err = tx.Debug().Model(&Booking{}).Where("id = ?", bid).UpdateColumns(Booking{Status: BookingCompleted, UpdatedAt: time.Now()}).Error
+	if err != nil {
+		tx.Rollback()
+		return &Booking{}, err
+	}
+	err = scheduleReviewRequest(tx, booking.ID, customerID, booking.UserID)
+	if err != nil {
+		tx.Rollback()
+		return &Booking{}, err
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return &Booking{}, err
+	}
+
+	booking.Status = BookingCompleted
+	return booking, nil
+}
+
+//Schedule the review request of a booking that was completed some other way, e.g. by a status update
+func ScheduleReviewRequest(ctx context.Context, db *gorm.DB, bid uint32) error {
+	db = database.WithContext(ctx, db)
+
+	booking, customerID, err := BookingParties(ctx, db, bid)
+	if err != nil {
+		return err
+	}
+	return scheduleReviewRequest(db, booking.ID, customerID, booking.UserID)
+}
+
+//A booking only ever gets one review request
+func scheduleReviewRequest(db *gorm.DB, bid, customerID, providerID uint32) error {
+	request := ReviewRequest{
+		BookingID:  bid,
+		CustomerID: customerID,
+		ProviderID: providerID,
+		SendAt:     time.Now().Add(ReviewRequestDelay()),
+		CreatedAt:  time.Now(),
+	}
+	return db.Debug().Where(ReviewRequest{BookingID: bid}).FirstOrCreate(&request).Error
+}
+
+//Get review requests that are due and whose booking hasn't been reviewed yet
+func FindDueReviewRequests(ctx context.Context, db *gorm.DB, now time.Time) (*[]ReviewRequest, error) {
+	db = database.WithContext(ctx, db)
+
+	requests := []ReviewRequest{}
+	err := db.Debug().Model(&ReviewRequest{}).Where("send_at <= ? and sent_at is null and review_id is null", now).Order("send_at asc").Limit(100).Find(&requests).Error
+	if err != nil {
+		return &[]ReviewRequest{}, err
+	}
+	return &requests, nil
+}
+
+//Record that the review request was sent
+func (r *ReviewRequest) MarkSent(ctx context.Context, db *gorm.DB) error {
+	db = database.WithContext(ctx, db)
+
+	now := time.Now()
+	err := db.Debug().Model(&ReviewRequest{}).Where("id = ?", r.ID).UpdateColumn("sent_at", now).Error
+	if err != nil {
+		return err
+	}
+	r.SentAt = &now
+	return nil
+}
+
+//Link the review to the booking's review request so no reminder is sent after it
+func LinkReviewRequest(ctx context.Context, db *gorm.DB, bid uint32, reviewID uint64) error {
+	db = database.WithContext(ctx, db)
+	return db.Debug().Model(&ReviewRequest{}).Where("booking_id = ?", bid).UpdateColumn("review_id", reviewID).Error
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//Token that was logged out, kept until it expires. Legacy tokens expire at JWT_ACCEPT_LEGACY_UNTIL.
+type RevokedToken struct {
+	ID        uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	TokenID   string     `gorm:"size:100;not null;unique" json:"-"`
+	UserID    uint32     `gorm:"not null;index" json:"user_id"`
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+//Revoke a token by its ID until it expires, revoking it again changes nothing
+func RevokeToken(ctx context.Context, db *gorm.DB, uid uint32, tokenID string, expiresAt *time.Time) error {
+	db = database.WithContext(ctx, db)
+
+	err := db.Debug().Model(&RevokedToken{}).Create(&RevokedToken{
+		TokenID:   tokenID,
+		UserID:    uid,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}).Error
+	if _, duplicate := duplicateKeyField(err); duplicate {
+		return nil
+	}
+	return err
+}
+
+//Whether the token with the ID was logged out
+func TokenRevoked(ctx context.Context, db *gorm.DB, tokenID string) (bool, error) {
+	db = database.WithContext(ctx, db)
+
+	count := 0
+	err := db.Debug().Model(&RevokedToken{}).Where("token_id = ?", tokenID).Count(&count).Error
+	return count > 0, err
+}
+
+//Delete the revoked tokens that have expired since, they are refused for their expiry anyway
+func PurgeRevokedTokens(ctx context.Context, db *gorm.DB, now time.Time) (int64, error) {
+	db = database.WithContext(ctx, db)
+
+	purge := db.Debug().Where("expires_at is not null and expires_at <= ?", now).Delete(&RevokedToken{})
+	return purge.RowsAffected, purge.Error
+}
@@ -0,0 +1,183 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/risk"
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
+)
+
+//Risk states of an account
+const (
+	RiskClear    = ""       //Nothing pending
+	RiskVerify   = "verify" //Next login needs an emailed code
+	RiskReview   = "review" //Held until an admin approves it
+	RiskRejected = "rejected"
+)
+
+//How long an emailed login code stays valid
+const LoginCodeLifetime = 15 * time.Minute
+
+//Returned when an emailed login code doesn't match
+var ErrInvalidLoginCode = errors.New("Invalid Verification Code")
+
+//Log of a scored registration or login
+type RiskAssessment struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32    `gorm:"not null;index" json:"user_id"`
+	Action    string    `gorm:"size:20;not null" json:"action"`
+	IPAddress string    `gorm:"size:45" json:"ip_address"`
+	Score     int       `gorm:"not null" json:"score"`
+	Decision  string    `gorm:"size:20;not null" json:"decision"`
+	Findings  string    `gorm:"type:text" json:"-"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+//One-time code emailed to confirm a risky login
+type LoginCode struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32    `gorm:"not null;index" json:"user_id"`
+	CodeHash  string    `gorm:"size:64;not null" json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+//Account waiting in the manual review queue with the assessments that put it there
+type RiskReviewItem struct {
+	User        AdminUser        `json:"user"`
+	Assessments []RiskAssessment `json:"assessments"`
+}
+
+//Store the assessment of a user's action
+func SaveRiskAssessment(ctx context.Context, db *gorm.DB, uid uint32, signal risk.Signal, assessment risk.Assessment) error {
+	db = database.WithContext(ctx, db)
+
+	findings, err := json.Marshal(assessment.Findings)
+	if err != nil {
+		return err
+	}
+
+	record := RiskAssessment{
+		UserID:    uid,
+		Action:    signal.Action,
+		IPAddress: signal.IP,
+		Score:     assessment.Score,
+		Decision:  assessment.Decision,
+		Findings:  string(findings),
+		CreatedAt: time.Now(),
+	}
+	return db.Debug().Model(&RiskAssessment{}).Create(&record).Error
+}
+
+//Move the account into a risk state, an account already held for review stays held
+func SetRiskStatus(ctx context.Context, db *gorm.DB, uid uint32, status string) error {
+	db = database.WithContext(ctx, db)
+	return db.Debug().Model(&User{}).Where("id = ? and risk_status <> ?", uid, RiskReview).UpdateColumn("risk_status", status).Error
+}
+
+//Accounts held for manual review, oldest first
+func FindRiskReviewQueue(ctx context.Context, db *gorm.DB) (*[]RiskReviewItem, error) {
+	db = database.WithContext(ctx, db)
+
+	users := []User{}
+	err := db.Debug().Model(&User{}).Where("risk_status = ?", RiskReview).Order("created_at asc").Limit(100).Find(&users).Error
+	if err != nil {
+		return &[]RiskReviewItem{}, err
+	}
+
+	queue := []RiskReviewItem{}
+	for i := range users {
+		item := RiskReviewItem{User: users[i].Admin(), Assessments: []RiskAssessment{}}
+		err = db.Debug().Model(&RiskAssessment{}).Where("user_id = ?", users[i].ID).Order("created_at desc").Limit(10).Find(&item.Assessments).Error
+		if err != nil {
+			return &[]RiskReviewItem{}, err
+		}
+		queue = append(queue, item)
+	}
+	return &queue, nil
+}
+
+//Approve or reject an account held for review, rejected accounts are locked and logged out
+func DecideRiskReview(ctx context.Context, db *gorm.DB, uid uint32, approve bool) (*User, error) {
+	db = database.WithContext(ctx, db)
+
+	now := time.Now()
+	columns := map[string]interface{}{"risk_status": RiskClear, "updated_at": now}
+	if !approve {
+		columns = map[string]interface{}{"risk_status": RiskRejected, "locked": true, "lock_reason": LockRisk, "tokens_valid_after": now, "updated_at": now}
+	}
+
+	update := db.Debug().Model(&User{}).Where("id = ? and risk_status = ?", uid, RiskReview).UpdateColumns(columns)
+	if update.Error != nil {
+		return &User{}, update.Error
+	}
+	if update.RowsAffected == 0 {
+		return &User{}, errors.New("Account Not In Review")
+	}
+
+	user := User{}
+	return user.FindUserByID(ctx, db, uid)
+}
+
+//Replace the user's login code with a new one and return it in plain form
+func IssueLoginCode(ctx context.Context, db *gorm.DB, uid uint32) (string, error) {
+	db = database.WithContext(ctx, db)
+
+	err := db.Debug().Where("user_id = ?", uid).Delete(&LoginCode{}).Error
+	if err != nil {
+		return "", err
+	}
+
+	code, err := tokens.Generate(8)
+	if err != nil {
+		return "", err
+	}
+	code = strings.ToUpper(code)
+
+	loginCode := LoginCode{
+		UserID:    uid,
+		CodeHash:  tokens.Hash(code),
+		ExpiresAt: time.Now().Add(LoginCodeLifetime),
+		CreatedAt: time.Now(),
+	}
+	err = db.Debug().Model(&LoginCode{}).Create(&loginCode).Error
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+//Check an emailed login code and use it up, too many wrong tries throw the code away
+func UseLoginCode(ctx context.Context, db *gorm.DB, uid uint32, code string) error {
+	db = database.WithContext(ctx, db)
+
+	attempts, err := StartVerificationAttempt(ctx, db, uid, AttemptsLoginCode)
+	if err != nil {
+		return err
+	}
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+	remove := db.Debug().Where("user_id = ? and code_hash = ? and expires_at > ?", uid, tokens.Hash(code), time.Now()).Delete(&LoginCode{})
+	if remove.Error != nil {
+		return remove.Error
+	}
+	if remove.RowsAffected == 0 {
+		if attempts >= MaxVerificationAttempts {
+			err = db.Debug().Where("user_id = ?", uid).Delete(&LoginCode{}).Error
+			if err == nil {
+				err = ClearVerificationAttempts(ctx, db, uid, AttemptsLoginCode)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return ErrInvalidLoginCode
+	}
+	return ClearVerificationAttempts(ctx, db, uid, AttemptsLoginCode)
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
+)
+
+//How long the revert link of a security change stays valid
+const SecurityChangeRevertWindow = 72 * time.Hour
+
+//Record of a change to a user's email, phone or password that can be reverted
+type SecurityChange struct {
+	ID         uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID     uint32     `gorm:"not null;index" json:"user_id"`
+	Field      string     `gorm:"size:20;not null" json:"field"` //email, phone or password
+	OldValue   string     `gorm:"size:255;not null" json:"-"`
+	TokenHash  string     `gorm:"size:64;not null;unique" json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevertedAt *time.Time `json:"reverted_at"`
+	CreatedAt  time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+//Columns a security change can be reverted on
+var securityChangeColumns = map[string]string{
+	"email":    "email",
+	"phone":    "phone",
+	"password": "password",
+}
+
+//Record a security change and return the plain revert token
+func RecordSecurityChange(ctx context.Context, db *gorm.DB, uid uint32, field, oldValue string) (string, error) {
+	db = database.WithContext(ctx, db)
+
+	if _, ok := securityChangeColumns[field]; !ok {
+		return "", errors.New("Unknown Security Field")
+	}
+
+	token, err := tokens.Generate(32)
+	if err != nil {
+		return "", err
+	}
+
+	change := SecurityChange{
+		UserID:    uid,
+		Field:     field,
+		OldValue:  oldValue,
+		TokenHash: tokens.Hash(token),
+		ExpiresAt: time.Now().Add(SecurityChangeRevertWindow),
+		CreatedAt: time.Now(),
+	}
+	err = db.Debug().Model(&SecurityChange{}).Create(&change).Error
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+//Find the change behind a revert link that can still be reverted
+func (s *SecurityChange) FindRevertableChange(ctx context.Context, db *gorm.DB, token string) (*SecurityChange, error) {
+	db = database.WithContext(ctx, db)
+	err := findRevertable(db, s, token)
+	if err != nil {
+		return &SecurityChange{}, err
+	}
+	return s, nil
+}
+
+func findRevertable(db *gorm.DB, s *SecurityChange, token string) error {
+	err := db.Debug().Model(&SecurityChange{}).Where("token_hash = ?", tokens.Hash(token)).Take(s).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return errors.New("Invalid Revert Link")
+	}
+	if err != nil {
+		return err
+	}
+	if s.RevertedAt != nil {
+		return errors.New("Change Already Reverted")
+	}
+	if s.ExpiresAt.Before(time.Now()) {
+		return errors.New("Revert Link Expired")
+	}
+	return nil
+}
+
+//Restore the previous value of a security change and lock the account until the owner resets the password.
+//The change is marked reverted in the same transaction, so the link works once.
+func (s *SecurityChange) RevertSecurityChange(ctx context.Context, db *gorm.DB, token string) (*SecurityChange, error) {
+	db = database.WithContext(ctx, db)
+
+	tx := db.Begin()
+	err := findRevertable(tx.Set("gorm:query_option", "FOR UPDATE"), s, token)
+	if err != nil {
+		tx.Rollback()
+		return &SecurityChange{}, err
+	}
+
+	//Whoever made the change is logged out, the owner unlocks the account by resetting the password
+	now := time.Now()
+	columns := map[string]interface{}{
+		securityChangeColumns[s.Field]: s.OldValue,
+		"locked":                       true,
+		"lock_reason":                  LockReverted,
+		"tokens_valid_after":           now,
+		"updated_at":                   now,
+	}
+	//The restored number is confirmed again
+	if s.Field == "phone" {
+		columns["phone_verified"] = false
+		columns["sms_opted_out"] = false
+	}
+	err = tx.Debug().Model(&User{}).Where("id = ?", s.UserID).UpdateColumns(columns).Error
+	if err != nil {
+		tx.Rollback()
+		return &SecurityChange{}, err
+	}
+
+	err = tx.Debug().Model(&SecurityChange{}).Where("id = ?", s.ID).UpdateColumn("reverted_at", now).Error
+	if err != nil {
+		tx.Rollback()
+		return &SecurityChange{}, err
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return &SecurityChange{}, err
+	}
+	s.RevertedAt = &now
+	return s, nil
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//Units a service can be priced in
+var serviceUnits = map[string]bool{
+	"job":  true,
+	"hour": true,
+	"day":  true,
+	"item": true,
+	"sqm":  true,
+}
+
+//Service a provider offers and its price range
+type ServiceOffering struct {
+	ID          uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	UserID      uint32    `gorm:"not null;index" json:"user_id"`
+	Title       string    `gorm:"size:255;not null" json:"title"`
+	Description string    `gorm:"size:1000" json:"description"`
+	PriceMin    float64   `gorm:"not null;index" json:"price_min"`
+	PriceMax    float64   `gorm:"not null" json:"price_max"`
+	Unit        string    `gorm:"size:20;not null" json:"unit"`
+	CreatedAt   time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (s *ServiceOffering) Prepare() {
+	s.ID = 0
+	s.Title = html.EscapeString(strings.TrimSpace(s.Title))
+	s.Description = html.EscapeString(strings.TrimSpace(s.Description))
+	s.Unit = strings.ToLower(strings.TrimSpace(s.Unit))
+	if s.Unit == "" {
+		s.Unit = "job"
+	}
+	if s.PriceMax == 0 {
+		s.PriceMax = s.PriceMin
+	}
+	s.CreatedAt = time.Now()
+	s.UpdatedAt = time.Now()
+}
+
+func (s *ServiceOffering) Validate() error {
+	if s.UserID < 1 {
+		return apierror.Invalid("user_id", "Required User ID")
+	}
+	if s.Title == "" {
+		return apierror.Invalid("title", "Required Title")
+	}
+	if s.PriceMin < 0 {
+		return errors.New("Invalid Price")
+	}
+	if s.PriceMax < s.PriceMin {
+		return errors.New("Maximum Price Is Below Minimum Price")
+	}
+	if !serviceUnits[s.Unit] {
+		return errors.New("Invalid Unit")
+	}
+	return nil
+}
+
+//Add a service to a provider's profile
+func (s *ServiceOffering) SaveServiceOffering(ctx context.Context, db *gorm.DB) (*ServiceOffering, error) {
+	db = database.WithContext(ctx, db)
+	err := db.Debug().Model(&ServiceOffering{}).Create(&s).Error
+	if err != nil {
+		return &ServiceOffering{}, err
+	}
+	return s, nil
+}
+
+//Get the services a provider offers, cheapest first
+func (s *ServiceOffering) FindUserServiceOfferings(ctx context.Context, db *gorm.DB, uid uint32) (*[]ServiceOffering, error) {
+	db = database.WithContext(ctx, db)
+
+	services := []ServiceOffering{}
+	err := db.Debug().Model(&ServiceOffering{}).Where("user_id = ?", uid).Order("price_min asc, id asc").Find(&services).Error
+	if err != nil {
+		return &[]ServiceOffering{}, err
+	}
+	return &services, nil
+}
+
+//Update a service belonging to the provider
+func (s *ServiceOffering) UpdateServiceOffering(ctx context.Context, db *gorm.DB, id uint64, uid uint32) (*ServiceOffering, error) {
+	db = database.WithContext(ctx, db)
+
+	db = db.Debug().Model(&ServiceOffering{}).Where("id = ? and user_id = ?", id, uid).Take(&ServiceOffering{}).UpdateColumns(
+		map[string]interface{}{
+			"title":       s.Title,
+			"description": s.Description,
+			"price_min":   s.PriceMin,
+			"price_max":   s.PriceMax,
+			"unit":        s.Unit,
+			"updated_at":  time.Now(),
+		},
+	)
+	if db.Error != nil {
+		if gorm.IsRecordNotFoundError(db.Error) {
+			return &ServiceOffering{}, errors.New("Service not found")
+		}
+		return &ServiceOffering{}, db.Error
+	}
+
+	err := db.Debug().Model(&ServiceOffering{}).Where("id = ?", id).Take(&s).Error
+	if err != nil {
+		return &ServiceOffering{}, err
+	}
+	return s, nil
+}
+
+//Remove a service from the provider's profile
+func (s *ServiceOffering) DeleteServiceOffering(ctx context.Context, db *gorm.DB, id uint64, uid uint32) (int64, error) {
+	db = database.WithContext(ctx, db)
+
+	db = db.Debug().Model(&ServiceOffering{}).Where("id = ? and user_id = ?", id, uid).Take(&ServiceOffering{}).Delete(&ServiceOffering{})
+
+	if db.Error != nil {
+		if gorm.IsRecordNotFoundError(db.Error) {
+			return 0, errors.New("Service not found")
+		}
+		return 0, db.Error
+	}
+	return db.RowsAffected, nil
+}
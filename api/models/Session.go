@@ -0,0 +1,115 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//How often a session's last seen time is written, requests in between don't touch the database
+const SessionTouchInterval = time.Minute
+
+//A login token in use on one of the user's devices, recorded from the first request made with it.
+//Revoking the session revokes its token.
+type Session struct {
+	ID        uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32     `gorm:"not null;index" json:"-"`
+	TokenKey  string     `gorm:"size:100;not null;unique_index" json:"-"` //See auth.Claims.RevocationKey
+	UserAgent string     `gorm:"size:255;not null" json:"user_agent"`
+	IP        string     `gorm:"size:45;not null" json:"ip_address"`
+	IssuedAt  time.Time  `json:"issued_at"`
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at"` //Nil for legacy tokens
+	//Within SessionTouchInterval
+	LastSeenAt time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	//Whether it is the session making the request
+	Current bool `gorm:"-" json:"current"`
+}
+
+//Record a request made with a token, creating its session the first time
+func TouchSession(ctx context.Context, db *gorm.DB, session Session) error {
+	db = database.WithContext(ctx, db)
+
+	if len(session.UserAgent) > 255 {
+		session.UserAgent = session.UserAgent[:255]
+	}
+	update := db.Debug().Model(&Session{}).Where("token_key = ?", session.TokenKey).UpdateColumns(
+		map[string]interface{}{
+			"user_agent":   session.UserAgent,
+			"ip":           session.IP,
+			"last_seen_at": session.LastSeenAt,
+		},
+	)
+	if update.Error != nil || update.RowsAffected > 0 {
+		return update.Error
+	}
+
+	session.ID = 0
+	session.CreatedAt = session.LastSeenAt
+	err := db.Debug().Model(&Session{}).Create(&session).Error
+	//Another instance recorded it first
+	if _, duplicate := duplicateKeyField(err); duplicate {
+		return nil
+	}
+	return err
+}
+
+//Sessions of the user whose tokens still work, most recently seen first. Tokens issued before the
+//user's tokens were last revoked, by a password change for one, are left out.
+func FindSessions(ctx context.Context, db *gorm.DB, uid uint32, now time.Time) (*[]Session, error) {
+	db = database.WithContext(ctx, db)
+
+	user := User{}
+	err := db.Debug().Model(&User{}).Select("id, tokens_valid_after").Where("id = ?", uid).Take(&user).Error
+	if err != nil {
+		return &[]Session{}, err
+	}
+
+	query := db.Debug().Model(&Session{}).Where("user_id = ? and (expires_at is null or expires_at > ?)", uid, now)
+	if user.TokensValidAfter != nil {
+		query = query.Where("issued_at >= ?", user.TokensValidAfter.Truncate(time.Second))
+	}
+	sessions := []Session{}
+	err = query.Order("last_seen_at desc").Find(&sessions).Error
+	if err != nil {
+		return &[]Session{}, err
+	}
+	return &sessions, nil
+}
+
+//Log out one of the user's sessions by revoking its token
+func RevokeSession(ctx context.Context, db *gorm.DB, uid uint32, id uint64) error {
+	db = database.WithContext(ctx, db)
+
+	session := Session{}
+	err := db.Debug().Model(&Session{}).Where("id = ? and user_id = ?", id, uid).Take(&session).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return errors.New("Session Not Found")
+	}
+	if err != nil {
+		return err
+	}
+	err = RevokeToken(ctx, db, uid, session.TokenKey, session.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	return EndSession(ctx, db, session.TokenKey)
+}
+
+//Forget the session of a token that was logged out
+func EndSession(ctx context.Context, db *gorm.DB, tokenKey string) error {
+	db = database.WithContext(ctx, db)
+
+	return db.Debug().Where("token_key = ?", tokenKey).Delete(&Session{}).Error
+}
+
+//Delete the sessions whose tokens have expired
+func PurgeSessions(ctx context.Context, db *gorm.DB, now time.Time) (int64, error) {
+	db = database.WithContext(ctx, db)
+
+	purge := db.Debug().Where("expires_at is not null and expires_at <= ?", now).Delete(&Session{})
+	return purge.RowsAffected, purge.Error
+}
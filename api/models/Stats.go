@@ -0,0 +1,58 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+type SpecialisationCount struct {
+	Specialisation string `json:"specialisation"`
+	Providers      uint64 `json:"providers"`
+}
+
+type RegionCount struct {
+	Region    string `json:"region"`
+	Country   string `json:"country"`
+	Providers uint64 `json:"providers"`
+}
+
+//Non-sensitive aggregates shown on the marketing site and app landing screens
+type PublicStats struct {
+	TotalProviders   uint64                `json:"total_providers"`
+	BySpecialisation []SpecialisationCount `json:"by_specialisation"`
+	ByRegion         []RegionCount         `json:"by_region"`
+	GeneratedAt      time.Time             `json:"generated_at"`
+}
+
+//Count providers per specialisation and per region
+func FindPublicStats(ctx context.Context, db *gorm.DB) (*PublicStats, error) {
+	db = database.WithContext(ctx, db)
+	var err error
+
+	stats := PublicStats{
+		BySpecialisation: []SpecialisationCount{},
+		ByRegion:         []RegionCount{},
+		GeneratedAt:      time.Now(),
+	}
+	providers := db.Debug().Model(&User{}).Where("specialisation <> ''")
+
+	err = providers.Count(&stats.TotalProviders).Error
+	if err != nil {
+		return &PublicStats{}, err
+	}
+
+	err = providers.Select("specialisation, count(*) as providers").Group("specialisation").Order("providers desc").Scan(&stats.BySpecialisation).Error
+	if err != nil {
+		return &PublicStats{}, err
+	}
+
+	err = providers.Select("region, country, count(*) as providers").Where("region <> ''").Group("region, country").Order("providers desc").Scan(&stats.ByRegion).Error
+	if err != nil {
+		return &PublicStats{}, err
+	}
+
+	return &stats, nil
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//States of a stored object
+const (
+	StoredObjectStored  = "stored"
+	StoredObjectDeleted = "deleted"
+)
+
+//File put in the upload bucket, recorded so storage can be audited per user
+type StoredObject struct {
+	ID          uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	Key         string    `gorm:"size:255;not null;unique" json:"key"`
+	UserID      uint32    `gorm:"not null;index" json:"user_id"`         //Who uploaded it
+	Purpose     string    `gorm:"size:20;not null;index" json:"purpose"` //Folder it is under, such as profile or disputes
+	Size        int64     `gorm:"not null" json:"size"`
+	ContentType string    `gorm:"size:100;not null" json:"content_type"`
+	Checksum    string    `gorm:"size:64;not null;default:''" json:"checksum"` //SHA-256, empty for files joined from resumable upload parts
+	Status      string    `gorm:"size:20;not null;index" json:"status"`
+	CreatedAt   time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+//Storage taken by a user
+type StorageUsage struct {
+	UserID  uint32 `json:"user_id"`
+	Objects int    `json:"objects"`
+	Bytes   int64  `json:"bytes"`
+}
+
+//Record a file that was just stored
+func SaveStoredObject(ctx context.Context, db *gorm.DB, object *StoredObject) error {
+	db = database.WithContext(ctx, db)
+
+	object.ID = 0
+	if object.Purpose == "" {
+		object.Purpose = strings.SplitN(object.Key, "/", 2)[0]
+	}
+	object.Status = StoredObjectStored
+	object.CreatedAt = time.Now()
+	object.UpdatedAt = time.Now()
+	return db.Debug().Model(&StoredObject{}).Create(object).Error
+}
+
+//Record a stored file unless it already has a record, for files the client reports more than once
+func SaveStoredObjectOnce(ctx context.Context, db *gorm.DB, object *StoredObject) error {
+	err := SaveStoredObject(ctx, db, object)
+	if _, duplicate := duplicateKeyField(err); duplicate {
+		return nil
+	}
+	return err
+}
+
+//Mark the records of deleted files, files without a record are left alone
+func MarkStoredObjectsDeleted(ctx context.Context, db *gorm.DB, keys []string) error {
+	db = database.WithContext(ctx, db)
+
+	if len(keys) == 0 {
+		return nil
+	}
+	return db.Debug().Model(&StoredObject{}).Where("`key` IN (?)", keys).UpdateColumns(
+		map[string]interface{}{
+			"status":     StoredObjectDeleted,
+			"updated_at": time.Now(),
+		},
+	).Error
+}
+
+//Users taking the most storage, largest first
+func FindStorageUsage(ctx context.Context, db *gorm.DB) (*[]StorageUsage, error) {
+	db = database.WithContext(ctx, db)
+
+	usage := []StorageUsage{}
+	err := db.Debug().Model(&StoredObject{}).Select("user_id, count(*) as objects, sum(size) as bytes").
+		Where("status = ?", StoredObjectStored).Group("user_id").Order("bytes desc").Limit(100).Scan(&usage).Error
+	if err != nil {
+		return &[]StorageUsage{}, err
+	}
+	return &usage, nil
+}
+
+//Storage taken by the user
+func FindUserStorageUsage(ctx context.Context, db *gorm.DB, uid uint32) (*StorageUsage, error) {
+	db = database.WithContext(ctx, db)
+
+	usage := StorageUsage{UserID: uid}
+	row := db.Debug().Model(&StoredObject{}).Select("count(*), coalesce(sum(size), 0)").
+		Where("user_id = ? and status = ?", uid, StoredObjectStored).Row()
+	err := row.Scan(&usage.Objects, &usage.Bytes)
+	if err != nil {
+		return &StorageUsage{}, err
+	}
+	return &usage, nil
+}
+
+//Files the user stored, newest first
+func FindUserStoredObjects(ctx context.Context, db *gorm.DB, uid uint32) (*[]StoredObject, error) {
+	db = database.WithContext(ctx, db)
+
+	objects := []StoredObject{}
+	err := db.Debug().Model(&StoredObject{}).Where("user_id = ? and status = ?", uid, StoredObjectStored).
+		Order("created_at desc").Limit(100).Find(&objects).Error
+	if err != nil {
+		return &[]StoredObject{}, err
+	}
+	return &objects, nil
+}
+
+//Records of the files among keys the user may have deleted: their own uploads and those picked before signing up
+func FindOwnedStoredObjects(ctx context.Context, db *gorm.DB, uid uint32, keys []string) (*[]StoredObject, error) {
+	db = database.WithContext(ctx, db)
+
+	objects := []StoredObject{}
+	if len(keys) == 0 {
+		return &objects, nil
+	}
+	err := db.Debug().Model(&StoredObject{}).Where("`key` IN (?) and user_id in (?) and status = ?", keys, []uint32{uid, 0}, StoredObjectStored).Find(&objects).Error
+	if err != nil {
+		return &[]StoredObject{}, err
+	}
+	return &objects, nil
+}
+
+//Page of the stored files for a purpose uploaded before a time, after the ID of the previous page
+func FindStoredObjectsBefore(ctx context.Context, db *gorm.DB, purpose string, before time.Time, afterID uint64, limit int) (*[]StoredObject, error) {
+	db = database.WithContext(ctx, db)
+
+	objects := []StoredObject{}
+	err := db.Debug().Model(&StoredObject{}).Where("purpose = ? and status = ? and created_at <= ? and id > ?", purpose, StoredObjectStored, before, afterID).
+		Order("id asc").Limit(limit).Find(&objects).Error
+	if err != nil {
+		return &[]StoredObject{}, err
+	}
+	return &objects, nil
+}
+
+//Which of the image URLs a user picture, post or gallery item still points at
+func ImagesInUse(ctx context.Context, db *gorm.DB, urls []string) (map[string]bool, error) {
+	db = database.WithContext(ctx, db)
+
+	inUse := map[string]bool{}
+	if len(urls) == 0 {
+		return inUse, nil
+	}
+	columns := []struct {
+		Model  interface{}
+		Column string
+	}{
+		{&User{}, "image_url"},
+		{&User{}, "thumbnail_url"},
+		{&User{}, "medium_url"},
+		{&Post{}, "image_url"},
+		{&GalleryItem{}, "image_url"},
+	}
+	for _, column := range columns {
+		found := []string{}
+		err := db.Debug().Model(column.Model).Where(column.Column+" IN (?)", urls).Pluck(column.Column, &found).Error
+		if err != nil {
+			return inUse, err
+		}
+		for _, url := range found {
+			inUse[url] = true
+		}
+	}
+	return inUse, nil
+}
@@ -1,12 +1,14 @@
 package models
 
 import (
-	"errors"
+	"context"
 	"html"
 	"strings"
 	"time"
 
 	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/database"
 )
 
 type Transaction struct {
@@ -37,28 +39,29 @@ func (t *Transaction) Prepare() {
 
 func (t *Transaction) Validate() error {
 	if t.Type == "" {
-		return errors.New("Required Type")
+		return apierror.Invalid("type", "Required Type")
 	}
 	if t.Amount == "" {
-		return errors.New("Required Amount")
+		return apierror.Invalid("amount", "Required Amount")
 	}
 	if t.UserID < 1 {
-		return errors.New("Required User ID")
+		return apierror.Invalid("user_id", "Required User ID")
 	}
 	if t.WorkerID < 1 {
-		return errors.New("Required Worker ID")
+		return apierror.Invalid("worker_id", "Required Worker ID")
 	}
 	if t.PostID < 1 {
-		return errors.New("Required Post ID")
+		return apierror.Invalid("post_id", "Required Post ID")
 	}
 	if t.WorkID < 1 {
-		return errors.New("Required Work ID")
+		return apierror.Invalid("work_id", "Required Work ID")
 	}
 	return nil
 }
 
 //Create a new transaction
-func (t *Transaction) UploadTransaction(db *gorm.DB) (*Transaction, error) {
+func (t *Transaction) UploadTransaction(ctx context.Context, db *gorm.DB) (*Transaction, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 
 	err = db.Debug().Model(&Transaction{}).Create(&t).Error
@@ -91,7 +94,8 @@ func (t *Transaction) UploadTransaction(db *gorm.DB) (*Transaction, error) {
 }
 
 //Return all transactions
-func (t *Transaction) FindAllTransactions(db *gorm.DB) (*[]Transaction, error) {
+func (t *Transaction) FindAllTransactions(ctx context.Context, db *gorm.DB) (*[]Transaction, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 
 	transactions := []Transaction{}
@@ -131,7 +135,8 @@ func (t *Transaction) FindAllTransactions(db *gorm.DB) (*[]Transaction, error) {
 }
 
 //Return transaction based on id
-func (t *Transaction) FindTransactionByID(db *gorm.DB, pid uint64) (*Transaction, error) {
+func (t *Transaction) FindTransactionByID(ctx context.Context, db *gorm.DB, pid uint64) (*Transaction, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 
 	err = db.Debug().Model(&Transaction{}).Where("id = ?", pid).Take(&t).Error
@@ -165,7 +170,8 @@ func (t *Transaction) FindTransactionByID(db *gorm.DB, pid uint64) (*Transaction
 }
 
 //Return transaction based on user id
-func (t *Transaction) FindTransactionByUserID(db *gorm.DB, pid uint64) (*[]Transaction, error) {
+func (t *Transaction) FindTransactionByUserID(ctx context.Context, db *gorm.DB, pid uint64) (*[]Transaction, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 
 	transactions := []Transaction{}
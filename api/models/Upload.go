@@ -0,0 +1,333 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"html"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/globalsign/mgo/bson"
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/fault"
+	"github.com/victorkabata/FixIt-API/api/storage"
+)
+
+//What a resumable upload becomes once it is complete
+const (
+	UploadGallery         = "gallery"
+	UploadDisputeEvidence = "dispute_evidence"
+)
+
+//States of a resumable upload
+const (
+	UploadReceiving  = "receiving"
+	UploadProcessing = "processing"
+	UploadDone       = "done"
+	UploadFailed     = "failed"
+)
+
+const (
+	UploadPartSize = int64(5 << 20)  //Size of every part but the last, the smallest S3 takes
+	MaxUploadSize  = int64(50 << 20) //Largest file a resumable upload takes
+	UploadLifetime = 24 * time.Hour  //Uploads not completed by then are thrown away
+)
+
+var (
+	ErrUploadNotReceiving = errors.New("Upload Is Not Receiving Parts")
+	ErrUploadIncomplete   = errors.New("Upload Is Missing Parts")
+)
+
+//File sent in parts so clients on flaky connections can resume where they stopped
+type Upload struct {
+	ID          uint64       `gorm:"primary_key;auto_increment" json:"id"`
+	UserID      uint32       `gorm:"not null;index" json:"user_id"`
+	Kind        string       `gorm:"size:20;not null" json:"kind"`
+	TargetID    uint64       `gorm:"not null;default:0" json:"target_id,omitempty"` //Dispute of evidence
+	Filename    string       `gorm:"size:255;not null" json:"filename"`
+	Size        int64        `gorm:"not null" json:"size"`
+	ContentType string       `gorm:"size:100;not null" json:"content_type"`
+	Note        string       `gorm:"size:1000" json:"note"` //Caption of photos, note of evidence
+	Key         string       `gorm:"size:255;not null" json:"-"`
+	S3UploadID  string       `gorm:"size:255;not null" json:"-"`
+	Status      string       `gorm:"size:20;not null;index" json:"status"`
+	ResultID    uint64       `gorm:"not null;default:0" json:"result_id,omitempty"` //Gallery item or evidence created
+	Error       string       `gorm:"size:255" json:"error,omitempty"`
+	Parts       []UploadPart `gorm:"-" json:"parts"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+	CreatedAt   time.Time    `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt   time.Time    `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+//Part of an upload that reached storage, sending it again replaces it
+type UploadPart struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"-"`
+	UploadID  uint64    `gorm:"not null;unique_index:idx_upload_parts_upload_number" json:"-"`
+	Number    int64     `gorm:"not null;unique_index:idx_upload_parts_upload_number" json:"number"`
+	Size      int64     `gorm:"not null" json:"size"`
+	ETag      string    `gorm:"size:100;not null" json:"-"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (u *Upload) Prepare() {
+	u.ID = 0
+	u.Filename = html.EscapeString(filepath.Base(strings.TrimSpace(u.Filename)))
+	u.Note = html.EscapeString(strings.TrimSpace(u.Note))
+	u.Status = UploadReceiving
+	u.ResultID = 0
+	u.Error = ""
+	u.ExpiresAt = time.Now().Add(UploadLifetime)
+	u.CreatedAt = time.Now()
+	u.UpdatedAt = time.Now()
+}
+
+func (u *Upload) Validate() error {
+	if u.Kind != UploadGallery && u.Kind != UploadDisputeEvidence {
+		return errors.New("Invalid Upload Kind")
+	}
+	if u.Kind == UploadDisputeEvidence && u.TargetID == 0 {
+		return apierror.Invalid("dispute_id", "Required Dispute ID")
+	}
+	if u.Filename == "" || u.Filename == "." {
+		return apierror.Invalid("filename", "Required Filename")
+	}
+	if u.Size <= 0 {
+		return apierror.Invalid("size", "Required Size")
+	}
+	if u.Size > MaxUploadSize {
+		return errors.New("File too large")
+	}
+	if len(u.Note) > 1000 {
+		return errors.New("Note Too Long")
+	}
+	return nil
+}
+
+//Number of parts the file is sent in
+func (u *Upload) PartCount() int64 {
+	return (u.Size + UploadPartSize - 1) / UploadPartSize
+}
+
+//Size part number n must have, only the last part is smaller
+func (u *Upload) PartSize(n int64) int64 {
+	if n < u.PartCount() {
+		return UploadPartSize
+	}
+	return u.Size - (n-1)*UploadPartSize
+}
+
+//First part that hasn't reached storage, 0 when all have
+func (u *Upload) NextPart() int64 {
+	received := map[int64]bool{}
+	for _, part := range u.Parts {
+		received[part.Number] = true
+	}
+	for n := int64(1); n <= u.PartCount(); n++ {
+		if !received[n] {
+			return n
+		}
+	}
+	return 0
+}
+
+//Start the upload in storage and record it
+func (u *Upload) SaveUpload(ctx context.Context, db *gorm.DB, s *session.Session) (*Upload, error) {
+	db = database.WithContext(ctx, db)
+
+	//Evidence often shows addresses and documents, so only signed links open it
+	config := storage.S3Settings()
+	path, acl := "gallery", config.ACL
+	if u.Kind == UploadDisputeEvidence {
+		path, acl = "disputes", s3.ObjectCannedACLPrivate
+	}
+
+	err := fault.Inject(ctx, fault.S3)
+	if err != nil {
+		return &Upload{}, storage.S3Error(err)
+	}
+	u.Key = path + "/" + bson.NewObjectId().Hex() + filepath.Ext(u.Filename)
+	started, err := s3.New(s).CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(config.Bucket),
+		Key:                  aws.String(u.Key),
+		ACL:                  aws.String(acl),
+		ContentType:          aws.String(u.ContentType),
+		ContentDisposition:   aws.String("attachment"),
+		ServerSideEncryption: aws.String("AES256"),
+		StorageClass:         aws.String(config.StorageClass),
+	})
+	if err != nil {
+		return &Upload{}, storage.S3Error(err)
+	}
+	u.S3UploadID = aws.StringValue(started.UploadId)
+
+	err = db.Debug().Model(&Upload{}).Create(&u).Error
+	if err != nil {
+		return &Upload{}, err
+	}
+	u.Parts = []UploadPart{}
+	return u, nil
+}
+
+//Get an upload of the user with the parts received so far
+func FindUpload(ctx context.Context, db *gorm.DB, id uint64, uid uint32) (*Upload, error) {
+	db = database.WithContext(ctx, db)
+
+	upload := Upload{}
+	err := db.Debug().Model(&Upload{}).Where("id = ? and user_id = ?", id, uid).Take(&upload).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Upload{}, errors.New("Upload Not Found")
+	}
+	if err != nil {
+		return &Upload{}, err
+	}
+	err = db.Debug().Model(&UploadPart{}).Where("upload_id = ?", upload.ID).Order("number asc").Find(&upload.Parts).Error
+	if err != nil {
+		return &Upload{}, err
+	}
+	return &upload, nil
+}
+
+//Send part number n to storage and record it, the caller checks its size
+func (u *Upload) SaveUploadPart(ctx context.Context, db *gorm.DB, s *session.Session, n int64, body []byte) (*UploadPart, error) {
+	db = database.WithContext(ctx, db)
+
+	if u.Status != UploadReceiving || time.Now().After(u.ExpiresAt) {
+		return &UploadPart{}, ErrUploadNotReceiving
+	}
+
+	err := fault.Inject(ctx, fault.S3)
+	if err != nil {
+		return &UploadPart{}, storage.S3Error(err)
+	}
+	sent, err := s3.New(s).UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(storage.S3Settings().Bucket),
+		Key:           aws.String(u.Key),
+		UploadId:      aws.String(u.S3UploadID),
+		PartNumber:    aws.Int64(n),
+		Body:          bytes.NewReader(body),
+		ContentLength: aws.Int64(int64(len(body))),
+	})
+	if err != nil {
+		return &UploadPart{}, storage.S3Error(err)
+	}
+
+	part := UploadPart{UploadID: u.ID, Number: n, Size: int64(len(body)), ETag: aws.StringValue(sent.ETag), CreatedAt: time.Now()}
+	tx := db.Begin()
+	if tx.Error != nil {
+		return &UploadPart{}, tx.Error
+	}
+	err = tx.Debug().Where("upload_id = ? and number = ?", u.ID, n).Delete(&UploadPart{}).Error
+	if err == nil {
+		err = tx.Debug().Model(&UploadPart{}).Create(&part).Error
+	}
+	if err == nil {
+		err = tx.Debug().Model(&Upload{}).Where("id = ?", u.ID).UpdateColumn("updated_at", time.Now()).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return &UploadPart{}, err
+	}
+	return &part, tx.Commit().Error
+}
+
+//Move an upload that has all its parts to processing, only one request gets to
+func (u *Upload) StartProcessing(ctx context.Context, db *gorm.DB) error {
+	db = database.WithContext(ctx, db)
+
+	if u.NextPart() != 0 {
+		return ErrUploadIncomplete
+	}
+	update := db.Debug().Model(&Upload{}).Where("id = ? and status = ?", u.ID, UploadReceiving).UpdateColumns(
+		map[string]interface{}{
+			"status":     UploadProcessing,
+			"updated_at": time.Now(),
+		},
+	)
+	if update.Error != nil {
+		return update.Error
+	}
+	if update.RowsAffected == 0 {
+		return ErrUploadNotReceiving
+	}
+	u.Status = UploadProcessing
+	return nil
+}
+
+//Join the parts in storage into the file
+func (u *Upload) CompleteS3Upload(ctx context.Context, s *session.Session) error {
+	parts := []*s3.CompletedPart{}
+	for _, part := range u.Parts {
+		parts = append(parts, &s3.CompletedPart{ETag: aws.String(part.ETag), PartNumber: aws.Int64(part.Number)})
+	}
+	sort.Slice(parts, func(i, j int) bool { return *parts[i].PartNumber < *parts[j].PartNumber })
+
+	_, err := s3.New(s).CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(storage.S3Settings().Bucket),
+		Key:             aws.String(u.Key),
+		UploadId:        aws.String(u.S3UploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	return storage.S3Error(err)
+}
+
+//Record how processing ended, with the gallery item or evidence it created or the reason it failed
+func (u *Upload) FinishUpload(ctx context.Context, db *gorm.DB, resultID uint64, failure error) error {
+	db = database.WithContext(ctx, db)
+
+	u.Status, u.ResultID = UploadDone, resultID
+	if failure != nil {
+		u.Status, u.Error = UploadFailed, failure.Error()
+		if len(u.Error) > 255 {
+			u.Error = u.Error[:255]
+		}
+	}
+	return db.Debug().Model(&Upload{}).Where("id = ?", u.ID).UpdateColumns(
+		map[string]interface{}{
+			"status":     u.Status,
+			"result_id":  u.ResultID,
+			"error":      u.Error,
+			"updated_at": time.Now(),
+		},
+	).Error
+}
+
+//Throw away an upload and the parts already in storage
+func (u *Upload) DeleteUpload(ctx context.Context, db *gorm.DB, s *session.Session) error {
+	db = database.WithContext(ctx, db)
+
+	if u.Status == UploadReceiving {
+		_, err := s3.New(s).AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(storage.S3Settings().Bucket),
+			Key:      aws.String(u.Key),
+			UploadId: aws.String(u.S3UploadID),
+		})
+		if err != nil {
+			return storage.S3Error(err)
+		}
+	}
+	err := db.Debug().Where("upload_id = ?", u.ID).Delete(&UploadPart{}).Error
+	if err != nil {
+		return err
+	}
+	return db.Debug().Where("id = ?", u.ID).Delete(&Upload{}).Error
+}
+
+//Get uploads that were never completed in time
+func FindExpiredUploads(ctx context.Context, db *gorm.DB, now time.Time) (*[]Upload, error) {
+	db = database.WithContext(ctx, db)
+
+	uploads := []Upload{}
+	err := db.Debug().Model(&Upload{}).Where("status = ? and expires_at <= ?", UploadReceiving, now).Limit(100).Find(&uploads).Error
+	if err != nil {
+		return &[]Upload{}, err
+	}
+	return &uploads, nil
+}
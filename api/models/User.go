@@ -1,23 +1,42 @@
 package models
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"html"
+	"io"
+	"io/ioutil"
 	"log"
 	"mime/multipart"
 	"net/http"
+	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/badoux/checkmail"
 	"github.com/globalsign/mgo/bson"
+	"github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/fault"
+	"github.com/victorkabata/FixIt-API/api/geo"
+	"github.com/victorkabata/FixIt-API/api/imaging"
+	"github.com/victorkabata/FixIt-API/api/passwords"
+	"github.com/victorkabata/FixIt-API/api/storage"
+	"github.com/victorkabata/FixIt-API/api/templates"
 )
 
 //Model of the user table in database
@@ -27,42 +46,247 @@ type User struct {
 	Email          string  `gorm:"size:100;not null;unique" json:"email"`
 	Phone          string  `gorm:"size:25;not null;unique" json:"phone_number"`
 	ImageURL       string  `gorm:"size:255;unique" json:"image_url"`
-	Specialisation string  `gorm:"size:255;not null" json:"specialisation"`
+	ThumbnailURL   string  `gorm:"size:255;not null;default:''" json:"thumbnail_url"` //Variants of the profile picture made when it is uploaded
+	MediumURL      string  `gorm:"size:255;not null;default:''" json:"medium_url"`
+	ImageKeys      string  `gorm:"size:1024;not null;default:''" json:"-"` //Stored files behind the picture URLs, comma separated, deleted when the picture is replaced
+	Specialisation string  `gorm:"size:255;not null;index:idx_users_specialisation" json:"specialisation"`
 	Latitude       float32 `gorm:"size:255;not null" json:"latitude"`
 	Longitude      float32 `gorm:"size:255;not null" json:"longitude"`
-	Address        string  `gorm:"size:255;not null" json:"address"`
-	Region         string  `gorm:"size:255;not null" json:"region"`
-	Country        string  `gorm:"size:255;not null" json:"country"`
-	//Review         []Review  `json:"reviews"`
-	Password  string    `gorm:"size:100;not null" json:"password"`
-	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	PlusCode       string  `gorm:"size:20;not null;default:''" json:"plus_code"` //Open Location Code of the coordinates, for places without a street address
+	Address        string  `gorm:"-" json:"address"`                             //Kept in user_profiles with the metadata, see UserProfile
+	Region         string  `gorm:"size:255;not null;index:idx_users_region" json:"region"`
+	Country        string  `gorm:"size:255;not null;index:idx_users_country" json:"country"`
+	HideEmail      bool    `gorm:"not null;default:false" json:"hide_email"`
+	HidePhone      bool    `gorm:"not null;default:false" json:"hide_phone"`
+	ServiceRadius  float64 `gorm:"not null;default:0" json:"service_radius_km"` //Distance from the base location the provider travels, 0 uses the default
+	//ISO 639 codes of the languages the user speaks, see ValidLanguage
+	Languages Languages `gorm:"size:255;not null;default:''" json:"languages"`
+	//Custom profile fields of the deployment, see MetadataSchema
+	Metadata Metadata `gorm:"-" json:"metadata"`
+	//Second factor
+	TwoFactorSecret  string `gorm:"size:64" json:"-"`
+	TwoFactorEnabled bool   `gorm:"not null;default:false" json:"two_factor_enabled"`
+	//Time step of the last authenticator code accepted, see auth.ValidateTOTP
+	TwoFactorCounter uint64 `gorm:"not null;default:0" json:"-"`
+	//admin, provider or customer, see auth.RoleAdmin
+	Role string `gorm:"size:20;not null;default:'customer';index:idx_users_role" json:"role"`
+	//Locked accounts cannot log in until the owner proves ownership again or an admin unlocks them
+	Locked bool `gorm:"not null;default:false" json:"locked"`
+	//Why the account is locked, see LockReverted
+	LockReason string `gorm:"size:20;not null;default:''" json:"lock_reason"`
+	//Set when an admin banned the account, which only an admin lifts, see BanUser
+	BannedAt *time.Time `json:"banned_at,omitempty"`
+	//Set when an admin made the owner choose a new password, logging in waits for the reset
+	PasswordResetRequired bool `gorm:"not null;default:false" json:"password_reset_required"`
+	//Set once the owner opens the link in the verification email, see EmailVerificationPolicy
+	Verified bool `gorm:"not null;default:false" json:"verified"`
+	//Set once the owner enters the code texted to the number, see VerifyPhoneCode
+	PhoneVerified bool `gorm:"not null;default:false" json:"phone_verified"`
+	//Set when the owner replied STOP to a text, nothing is texted to them until they reply START
+	SMSOptedOut bool `gorm:"not null;default:false" json:"sms_opted_out"`
+	//Language tag emails and notifications are written in, such as sw or sw-ke, see templates.Chain
+	Locale string `gorm:"size:20;not null;default:''" json:"locale"`
+	//How often low priority notifications are emailed together, see DigestDaily
+	DigestFrequency string     `gorm:"size:10;not null;default:'daily'" json:"digest_frequency"`
+	LastDigestAt    *time.Time `json:"-"`
+	//Set when email to the address bounced for good or was reported as spam, see EmailBounced
+	EmailStatus string `gorm:"size:20;not null;default:''" json:"email_status"`
+	//Identity checks of providers, see KYCPending. Empty for customers and providers from before the checks.
+	KYCStatus string `gorm:"size:20;not null;default:''" json:"kyc_status"`
+	//Set by risk scoring, see RiskVerify and RiskReview
+	RiskStatus string `gorm:"size:20;not null;default:''" json:"-"`
+	//Tokens issued before this were revoked, see RevokeTokens
+	TokensValidAfter *time.Time `json:"-"`
+	//Set when the owner asked for the account to be deleted, logging in before then cancels it
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+	//Set when the account was deleted, it can be restored until AccountDeletionGrace has passed
+	DeletedAt *time.Time `sql:"index" json:"-"`
+	//Photos of past work, loaded for the public profile
+	Gallery []GalleryItem `gorm:"-" json:"gallery,omitempty"`
+	//Services and prices, loaded for the public profile
+	Services []ServiceOffering `gorm:"-" json:"services,omitempty"`
+	//Distance from the searcher, only set in nearby searches
+	Distance *float64 `gorm:"-" json:"distance_km,omitempty"`
+	//Whether the whole account is serialized, see ShowToOwner
+	owner bool
+	//Average rating and review count from published reviews, loaded where the user is shown to others
+	Reputation `gorm:"-"`
+	//Response time, acceptance and completion of a provider, loaded for the public profile and searches
+	Stats     *ProviderStats `gorm:"-" json:"stats,omitempty"`
+	Password  string         `gorm:"size:255;not null" json:"-"`
+	CreatedAt time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
 }
 
 //Model the response of user-related endpoints
 type ResponseUser struct {
-	ID             uint32  `json:"id"`
-	Username       string  `json:"username"`
-	Email          string  `json:"email"`
-	Phone          string  `json:"phone_number"`
-	ImageURL       string  `json:"image_url"`
-	Specialisation string  `json:"specialisation"`
-	Latitude       float32 `json:"latitude"`
-	Longitude      float32 `json:"longitude"`
-	Address        string  `json:"address"`
-	Region         string  `json:"region"`
-	Country        string  `json:"country"`
-	Token          string  `json:"token"`
-	//Review         Review  `json:"reviews"`
-}
-
-//Encrypt password
+	ID             uint32    `json:"id"`
+	Username       string    `json:"username"`
+	Email          string    `json:"email"`
+	Phone          string    `json:"phone_number"`
+	ImageURL       string    `json:"image_url"`
+	ThumbnailURL   string    `json:"thumbnail_url"`
+	MediumURL      string    `json:"medium_url"`
+	Specialisation string    `json:"specialisation"`
+	Latitude       float32   `json:"latitude"`
+	Longitude      float32   `json:"longitude"`
+	PlusCode       string    `json:"plus_code"`
+	Address        string    `json:"address"`
+	Region         string    `json:"region"`
+	Country        string    `json:"country"`
+	KYCStatus      string    `json:"kyc_status"`
+	Languages      Languages `json:"languages"`
+	Token          string    `json:"token"`
+	AverageRating  float64   `json:"average_rating"`
+	ReviewCount    int       `json:"review_count"`
+}
+
+//Why an account is locked
+const (
+	LockReverted  = "reverted"  //The owner reverted a change to their account, resetting the password unlocks it
+	LockSuspended = "suspended" //Suspended by an admin
+	LockRisk      = "risk"      //Rejected in the risk review
+)
+
+//Encrypt password with the configured hasher, see the passwords package
 func Hash(password string) ([]byte, error) {
-	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := passwords.Hash(password)
+	return []byte(hashedPassword), err
 }
 
 func VerifyPassword(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	_, err := passwords.Verify(hashedPassword, password)
+	return err
+}
+
+//Same error for an unknown email and a wrong password, so logins don't tell which addresses have accounts
+var ErrInvalidCredentials = errors.New("Invalid Credentials")
+
+//What a user logs in with, the first of email, phone and username that is set
+type LoginIdentifier struct {
+	Email    string
+	Phone    string
+	Username string
+}
+
+//Phone numbers in E.164 form, + and the country code then up to 15 digits in all
+var e164Phone = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+//Tells whether what the user typed is an email, an E.164 phone number, spaces and dashes allowed, or a username
+func ParseLoginIdentifier(identifier string) LoginIdentifier {
+	identifier = strings.TrimSpace(identifier)
+	if strings.Contains(identifier, "@") {
+		return LoginIdentifier{Email: identifier}
+	}
+	phone := strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(identifier)
+	if e164Phone.MatchString(phone) {
+		return LoginIdentifier{Phone: phone}
+	}
+	return LoginIdentifier{Username: identifier}
+}
+
+func (l LoginIdentifier) findUser(ctx context.Context, db *gorm.DB) (*User, error) {
+	user := User{}
+	switch {
+	case l.Email != "":
+		return user.FindUserByEmail(ctx, db, l.Email)
+	case l.Phone != "":
+		return user.FindUserByPhone(ctx, db, l.Phone)
+	}
+	return user.FindUserByUsername(ctx, db, l.Username)
+}
+
+//Find the user with the email, phone or username and check the password. Unknown accounts are checked
+//against a decoy hash of the same cost, so they take as long to answer as wrong passwords. A password stored
+//with an older hasher or cost is hashed again with the current one.
+func CheckCredentials(ctx context.Context, db *gorm.DB, login LoginIdentifier, password string) (*User, error) {
+	userFound, err := login.findUser(ctx, db)
+	if err != nil && err.Error() != "User Not Found" {
+		return &User{}, err
+	}
+	if err != nil {
+		passwords.Decoy(password)
+		return &User{}, ErrInvalidCredentials
+	}
+	rehash, err := passwords.Verify(userFound.Password, password)
+	if err != nil {
+		return &User{}, ErrInvalidCredentials
+	}
+	if rehash {
+		err = userFound.rehashPassword(ctx, db, password)
+		if err != nil {
+			log.Printf("Rehashing the password of user %d failed: %v", userFound.ID, err)
+		}
+	}
+	return userFound, nil
+}
+
+//Replace the stored hash of a password that was just checked with one of the current hasher.
+//The old hash must still be there, so a password changed meanwhile isn't overwritten.
+func (u *User) rehashPassword(ctx context.Context, db *gorm.DB, password string) error {
+	db = database.WithContext(ctx, db)
+
+	hashedPassword, err := passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	err = db.Debug().Model(&User{}).Where("id = ? and password = ?", u.ID, u.Password).UpdateColumn("password", hashedPassword).Error
+	if err != nil {
+		return err
+	}
+	u.Password = hashedPassword
+	return nil
+}
+
+//Widens the password column for Argon2id hashes, which outgrow bcrypt's 60 characters with large parameters
+func MigratePasswordColumn(db *gorm.DB) {
+	if !db.HasTable(&User{}) {
+		return
+	}
+	var length int
+	row := db.Raw("select character_maximum_length from information_schema.columns where table_schema = database() and table_name = 'users' and column_name = 'password'").Row()
+	if row.Scan(&length) != nil || length >= 255 {
+		return
+	}
+	db.Model(&User{}).ModifyColumn("password", "varchar(255) not null")
+}
+
+//Drops the login indexes that copied the password hash next to the email and phone number, the unique
+//indexes of the columns serve the lookups
+func MigrateLoginIndexes(db *gorm.DB) {
+	if !db.HasTable(&User{}) {
+		return
+	}
+	for _, index := range []string{"idx_users_email_login", "idx_users_phone_login"} {
+		if db.Dialect().HasIndex("users", index) {
+			db.Model(&User{}).RemoveIndex(index)
+		}
+	}
+}
+
+//Full text indexes of the users list's text search, which gorm can't declare on the columns
+var searchIndexes = []struct{ table, name, columns string }{
+	{"users", "idx_users_search", "username, specialisation"},
+	{"user_profiles", "idx_user_profiles_address", "address"},
+}
+
+//Adds the full text indexes of the users list's text search, once the tables exist. The search can't
+//run without them, so failing to add one stops the server.
+func MigrateSearchIndexes(db *gorm.DB) {
+	for _, index := range searchIndexes {
+		if !db.HasTable(index.table) || db.Dialect().HasIndex(index.table, index.name) {
+			continue
+		}
+		err := db.Exec("CREATE FULLTEXT INDEX " + index.name + " ON " + index.table + " (" + index.columns + ")").Error
+		//Duplicate key name, another instance starting at the same time added it first
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1061 {
+			continue
+		}
+		if err != nil {
+			log.Fatalf("Error adding the full text index %s: %v", index.name, err)
+		}
+	}
 }
 
 //Hash password before saving to db
@@ -83,7 +307,22 @@ func (u *User) Prepare() {
 	u.Email = html.EscapeString(strings.TrimSpace(u.Email))
 	u.Phone = html.EscapeString(strings.TrimSpace(u.Phone))
 	u.ImageURL = html.EscapeString(strings.TrimSpace(u.ImageURL))
+	u.ThumbnailURL = html.EscapeString(strings.TrimSpace(u.ThumbnailURL))
+	u.MediumURL = html.EscapeString(strings.TrimSpace(u.MediumURL))
 	u.Specialisation = html.EscapeString(strings.TrimSpace(u.Specialisation))
+	u.Locale = templates.Normalize(u.Locale)
+	if u.DigestFrequency == "" {
+		u.DigestFrequency = DigestDaily
+	}
+	u.Verified = false //Only the link in the verification email verifies an address
+	u.PhoneVerified = false
+	//Only admins give out the admin role, providers are the users offering a specialisation
+	u.Role = auth.RoleCustomer
+	u.KYCStatus = ""
+	if u.Specialisation != "" {
+		u.Role = auth.RoleProvider
+		u.KYCStatus = KYCPending
+	}
 	u.CreatedAt = time.Now()
 	u.UpdatedAt = time.Now()
 }
@@ -91,100 +330,483 @@ func (u *User) Prepare() {
 //User input validation
 func (u *User) Validate(action string) error {
 	switch strings.ToLower(action) {
-	case "update":
-		if u.Username == "" {
-			return errors.New("Required Username")
-		}
+	//Users log in with their email, phone number or username
+	case "login":
 		if u.Password == "" {
-			return errors.New("Required Password")
+			return apierror.Invalid("password", "Required Password")
 		}
-		if u.Phone == "" {
-			return errors.New("Required Phone Number")
+		if u.Email == "" && u.Phone == "" && u.Username == "" {
+			return apierror.Invalid("email", "Required Email, Phone Number Or Username")
 		}
-		if u.Email == "" {
-			return errors.New("Required Email")
-		}
-		if err := checkmail.ValidateFormat(u.Email); err != nil {
-			return errors.New("Invalid Email")
+		if u.Email != "" {
+			if err := checkmail.ValidateFormat(u.Email); err != nil {
+				return apierror.Invalid("email", "Invalid Email")
+			}
 		}
-		if u.Specialisation == "" {
-			return errors.New("Required Specialisation")
-		}
-		// if u.Latitude == 0 {
-		// 	return errors.New("Required Location")
-		// }
-		// if u.Longitude == 0 {
-		// 	return errors.New("Required Longitude")
-		// }
-
 		return nil
-	case "login":
-		if u.Password == "" {
-			return errors.New("Required Password")
+
+	//Full and partial updates leave the password alone, it changes through ChangePassword
+	case "update", "patch":
+		if u.Username == "" {
+			return apierror.Invalid("username", "Required Username")
 		}
 		if u.Email == "" {
-			return errors.New("Required Email")
+			return apierror.Invalid("email", "Required Email")
 		}
 		if err := checkmail.ValidateFormat(u.Email); err != nil {
-			return errors.New("Invalid Email")
+			return apierror.Invalid("email", "Invalid Email")
 		}
-		return nil
+		if u.ServiceRadius < 0 || u.ServiceRadius > MaxServiceRadius {
+			return apierror.Invalid("service_radius_km", "Invalid Service Radius")
+		}
+		return u.validateProfile()
 
 	default:
 		if u.Username == "" {
-			return errors.New("Required Username")
+			return apierror.Invalid("username", "Required Username")
 		}
 		if u.Password == "" {
-			return errors.New("Required Password")
-		}
-		if u.Phone == "" {
-			return errors.New("Required Phone Number")
+			return apierror.Invalid("password", "Required Password")
 		}
 		if u.Email == "" {
-			return errors.New("Required Email")
+			return apierror.Invalid("email", "Required Email")
 		}
 		if err := checkmail.ValidateFormat(u.Email); err != nil {
-			return errors.New("Invalid Email")
+			return apierror.Invalid("email", "Invalid Email")
 		}
-		return nil
+		if err := checkPasswordPolicy(u.Password, u); err != nil {
+			return err
+		}
+		return u.validateProfile()
+	}
+}
+
+//Checks shared by registration and updates, ending with the fields the role requires, see RequiredFields
+func (u *User) validateProfile() error {
+	if u.Locale != "" && !templates.Valid(u.Locale) {
+		return apierror.Invalid("locale", "Invalid Locale")
+	}
+	if !ValidDigestFrequency(u.DigestFrequency) {
+		return apierror.Invalid("digest_frequency", "Invalid Digest Frequency")
 	}
+	if err := u.resolvePlusCode(); err != nil {
+		return err
+	}
+	if err := geo.Validate(float64(u.Latitude), float64(u.Longitude)); err != nil {
+		return err
+	}
+	languages, err := u.Languages.normalize()
+	if err != nil {
+		return err
+	}
+	u.Languages = languages
+	if err := u.Metadata.validate(); err != nil {
+		return err
+	}
+	return u.checkRequiredFields()
 }
 
-//Save user to database
-func (u *User) SaveUser(db *gorm.DB) (*User, error) {
+//Fills in missing coordinates from the plus code, then sets the plus code from the coordinates so the two agree
+func (u *User) resolvePlusCode() error {
+	if u.PlusCode != "" {
+		point, err := geo.DecodePlusCode(u.PlusCode)
+		if err != nil {
+			return err
+		}
+		if u.Latitude == 0 && u.Longitude == 0 {
+			u.Latitude = float32(point.Latitude)
+			u.Longitude = float32(point.Longitude)
+		}
+	}
+	if u.Latitude != 0 || u.Longitude != 0 {
+		u.PlusCode = geo.EncodePlusCode(geo.Point{Latitude: float64(u.Latitude), Longitude: float64(u.Longitude)}, geo.PlusCodeLength)
+	}
+	return nil
+}
+
+//Returned when a new account collides with an existing one
+type DuplicateUserError struct {
+	Field string
+}
+
+func (e *DuplicateUserError) Error() string {
+	switch e.Field {
+	case "username":
+		return "Username Already Taken"
+	case "phone":
+		return "Phone Number Already Taken"
+	case "image_url":
+		return "Image Already Taken"
+	default:
+		return "Email Already Taken"
+	}
+}
+
+//Conflict on the field by its JSON name
+func (e *DuplicateUserError) APIError() *apierror.Error {
+	field := e.Field
+	if field == "phone" {
+		field = "phone_number"
+	}
+	return apierror.Duplicate(field, e.Error())
+}
+
+//Save user to database. Taken emails and phone numbers are looked up first to name the field, without
+//locking; the unique indexes decide between concurrent registrations and the loser gets a DuplicateUserError too
+func (u *User) SaveUser(ctx context.Context, db *gorm.DB) (*User, error) {
+	db = database.WithContext(ctx, db)
 	var err error
-	err = db.Debug().Create(&u).Error
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return &User{}, tx.Error
+	}
+
+	//Deleted accounts keep theirs since they can be restored
+	existing := User{}
+	err = tx.Debug().Unscoped().Model(&User{}).Select("email, phone").Where("email = ? or phone = ?", u.Email, u.Phone).Take(&existing).Error
+	if err == nil {
+		tx.Rollback()
+		if existing.Email == u.Email {
+			return &User{}, &DuplicateUserError{Field: "email"}
+		}
+		return &User{}, &DuplicateUserError{Field: "phone"}
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return &User{}, err
+	}
+
+	err = tx.Debug().Create(&u).Error
+	if err != nil {
+		tx.Rollback()
+		if field, ok := duplicateKeyField(err); ok {
+			return &User{}, &DuplicateUserError{Field: field}
+		}
+		return &User{}, err
+	}
+	err = tx.Debug().Model(&UserProfile{}).Create(&UserProfile{UserID: u.ID, Address: u.Address, Metadata: u.Metadata, UpdatedAt: time.Now()}).Error
+	if err != nil {
+		tx.Rollback()
+		return &User{}, err
+	}
+
+	err = tx.Commit().Error
 	if err != nil {
 		return &User{}, err
 	}
 	return u, nil
 }
 
-//Get all users
-func (u *User) FindAllUsers(db *gorm.DB) (*[]User, error) {
+//Which unique detail of the user is already used by the existing account
+func (u *User) duplicateOf(existing *User) error {
+	switch {
+	case existing.Email == u.Email:
+		return &DuplicateUserError{Field: "email"}
+	case existing.Username == u.Username:
+		return &DuplicateUserError{Field: "username"}
+	default:
+		return &DuplicateUserError{Field: "phone"}
+	}
+}
+
+//Detects duplicate key errors and the user field whose unique index raised them, see database.DuplicateKey
+func duplicateKeyField(err error) (string, bool) {
+	duplicate, ok := database.DuplicateKey(err)
+	if !ok {
+		return "", false
+	}
+	for _, field := range []string{"username", "email", "phone", "image_url"} {
+		if strings.Contains(duplicate.Key, field) {
+			return field, true
+		}
+	}
+	return "email", true
+}
+
+//Which of the username, email and phone number a new account could still take, by their JSON names.
+//Empty ones are left out. Values are prepared as registration prepares them, and deleted accounts keep
+//theirs since they can be restored.
+func CheckAvailability(ctx context.Context, db *gorm.DB, username, email, phone string) (map[string]bool, error) {
+	db = database.WithContext(ctx, db).Unscoped()
+
+	candidate := User{Username: username, Email: email, Phone: phone}
+	candidate.Prepare()
+	if candidate.Username == "" && candidate.Email == "" && candidate.Phone == "" {
+		return nil, apierror.Invalid("username", "Required Username, Email Or Phone Number")
+	}
+	if candidate.Email != "" {
+		if err := checkmail.ValidateFormat(candidate.Email); err != nil {
+			return nil, apierror.Invalid("email", "Invalid Email")
+		}
+	}
+	//Placeholders of accounts signed up through a provider are never taken by a new account
+	if strings.HasPrefix(candidate.Phone, placeholderPhonePrefix) {
+		return nil, apierror.Invalid("phone_number", "Invalid Phone Number")
+	}
+
+	available := map[string]bool{}
+	for _, check := range []struct{ field, column, value string }{
+		{"username", "username", candidate.Username},
+		{"email", "email", candidate.Email},
+		{"phone_number", "phone", candidate.Phone},
+	} {
+		if check.value == "" {
+			continue
+		}
+		count := 0
+		err := db.Debug().Model(&User{}).Where(check.column+" = ?", check.value).Count(&count).Error
+		if err != nil {
+			return nil, err
+		}
+		available[check.field] = count == 0
+	}
+	return available, nil
+}
+
+//Filters, search text and order of the users list. Empty fields don't filter.
+type UserQuery struct {
+	Specialisation string
+	Region         string
+	Country        string
+	Role           string
+	//Only banned users
+	Banned bool
+	//Words starting words of the username and specialisation, or of the address
+	Text string
+	//Applied in turn, newest first when empty
+	Sort []UserSort
+}
+
+//Column the users list is ordered by
+type UserSort struct {
+	Column     sqlClause
+	Descending bool
+}
+
+//Columns the users list can be sorted by, by the name clients give
+var userSortColumns = map[string]sqlClause{
+	"username":       "username",
+	"email":          "email",
+	"specialisation": "specialisation",
+	"region":         "region",
+	"country":        "country",
+	"created_at":     "created_at",
+}
+
+//Most sort columns a request can combine
+const maxUserSorts = 3
+
+var (
+	ErrInvalidSort = errors.New("Invalid Sort")
+	//Cursors point into the newest first order, other orders page by number
+	ErrCursorWithSort = errors.New("Cursors Only Work Without A Sort")
+)
+
+//Reads a comma separated sort such as specialisation,-created_at, a minus sorting that column descending
+func ParseUserSort(value string) ([]UserSort, error) {
+	sorts := []UserSort{}
+	seen := map[sqlClause]bool{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		order := UserSort{}
+		if strings.HasPrefix(field, "-") {
+			order.Descending = true
+			field = field[1:]
+		}
+		column, ok := userSortColumns[field]
+		if !ok || seen[column] {
+			return nil, ErrInvalidSort
+		}
+		seen[column] = true
+		order.Column = column
+		sorts = append(sorts, order)
+	}
+	if len(sorts) > maxUserSorts {
+		return nil, ErrInvalidSort
+	}
+	return sorts, nil
+}
+
+//Scope narrowing users to the filters and search text. The filters but banned use an index each, and the
+//text is searched for with the full text indexes of users and user_profiles, see MigrateSearchIndexes.
+func (q UserQuery) filtered(db *gorm.DB) *gorm.DB {
+	search := &searchBuilder{}
+	if q.Specialisation != "" {
+		search.where("specialisation = ?", q.Specialisation)
+	}
+	if q.Region != "" {
+		search.where("region = ?", q.Region)
+	}
+	if q.Country != "" {
+		search.where("country = ?", q.Country)
+	}
+	if q.Role != "" {
+		search.where("role = ?", q.Role)
+	}
+	if q.Banned {
+		search.where("banned_at IS NOT NULL")
+	}
+	if words := fullTextWords(q.Text); words != "" {
+		search.where("MATCH (users.username, users.specialisation) AGAINST (? IN BOOLEAN MODE) OR "+
+			"users.id IN (SELECT user_id FROM user_profiles WHERE MATCH (address) AGAINST (? IN BOOLEAN MODE))", words, words)
+	}
+	return search.apply(db)
+}
+
+//Scope ordering users by the sort, the ID breaking ties so pages don't overlap
+func (q UserQuery) sorted(db *gorm.DB) *gorm.DB {
+	if len(q.Sort) == 0 {
+		return db.Order("created_at desc, id desc")
+	}
+	for _, order := range q.Sort {
+		direction := " asc"
+		if order.Descending {
+			direction = " desc"
+		}
+		db = db.Order(string(order.Column) + direction)
+	}
+	return db.Order("id asc")
+}
+
+//Get the users matching the query, a page at a time
+func (u *User) FindAllUsers(ctx context.Context, db *gorm.DB, filter UserQuery, page PageRequest) (*[]User, *PageInfo, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 
+	if page.Cursor != "" && len(filter.Sort) > 0 {
+		return &[]User{}, &PageInfo{}, ErrCursorWithSort
+	}
 	users := []User{}
+	page.normalize()
+	info := PageInfo{PerPage: page.PerPage}
+	if page.Cursor == "" {
+		info.Page = page.Page
+	}
+
+	err = db.Debug().Model(&User{}).Scopes(filter.filtered).Count(&info.Total).Error
+	if err != nil {
+		return &[]User{}, &PageInfo{}, err
+	}
+
+	query, err := page.apply(db.Debug().Model(&User{}).Scopes(filter.filtered, filter.sorted))
+	if err != nil {
+		return &[]User{}, &PageInfo{}, err
+	}
+	err = query.Find(&users).Error
+	if err != nil {
+		return &[]User{}, &PageInfo{}, err
+	}
+	if len(users) > page.PerPage {
+		users = users[:page.PerPage]
+		last := users[len(users)-1]
+		if len(filter.Sort) == 0 {
+			info.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+		}
+	}
+
+	err = LoadReputations(ctx, db, users)
+	if err != nil {
+		return &[]User{}, &PageInfo{}, err
+	}
+	err = LoadUserProfiles(ctx, db, users)
+	if err != nil {
+		return &[]User{}, &PageInfo{}, err
+	}
+	return &users, &info, nil
+}
+
+//Filters for searching providers, zero values are ignored
+type ProviderFilter struct {
+	Specialisation string
+	Region         string
+	MaxPrice       float64
+	//Searcher's location, providers whose service radius doesn't reach it are left out
+	Nearby    bool
+	Latitude  float64
+	Longitude float64
+	RadiusKm  float64 //Optional cap on how far away providers may be
+	//Providers speaking any of them
+	Languages Languages
+	//Searchable custom fields, see ParseMetadataFilters
+	Metadata []MetadataFilter
+}
+
+//Find providers matching the filter, a max price matches providers with any service starting at or below it
+func (u *User) SearchProviders(ctx context.Context, db *gorm.DB, filter ProviderFilter) (*[]User, error) {
+	db = database.WithContext(ctx, db)
+
+	//Providers still waiting for the identity checks, or who failed them, aren't offered
+	search := &searchBuilder{}
+	search.where("kyc_status not in (?, ?)", KYCPending, KYCRejected)
+	if filter.Specialisation != "" {
+		search.contains("specialisation", filter.Specialisation)
+	}
+	if filter.Region != "" {
+		search.where("region = ?", filter.Region)
+	}
+	if filter.MaxPrice > 0 {
+		search.where("id IN (?)", db.Model(&ServiceOffering{}).Select("user_id").Where("price_min <= ?", filter.MaxPrice).QueryExpr())
+	}
+
+	withLanguages(search, filter.Languages)
+	withMetadata(db, search, filter.Metadata)
+
+	if filter.Nearby {
+		withinBox(search, providerSearchBox(geo.Point{Latitude: filter.Latitude, Longitude: filter.Longitude}, filter.RadiusKm))
+		search.where(providerDistance+" <= IF(service_radius > 0, service_radius, ?)", filter.Latitude, filter.Latitude, filter.Longitude, DefaultServiceRadius())
+		if filter.RadiusKm > 0 {
+			search.where(providerDistance+" <= ?", filter.Latitude, filter.Latitude, filter.Longitude, filter.RadiusKm)
+		}
+	}
 
-	err = db.Debug().Model(&User{}).Order("created_at desc").Limit(100).Find(&users).Error
+	query := search.apply(db.Debug().Model(&User{}))
+	users := []User{}
+	err := query.Order("created_at desc").Limit(100).Find(&users).Error
 	if err != nil {
 		return &[]User{}, err
 	}
 
-	// if len(users) > 0 {
-	// 	for i, _ := range users {
-	// 		err := db.Debug().Model(&Review{}).Where("user_id=?", users[i].ID).Take(&users[i].Review).Error
-	// 		if err != nil {
-	// 			return &[]User{}, err
-	// 		}
-	// 	}
-	// }
+	//Measured to the blurred location, the exact one could be found from distances to a few searched points
+	if filter.Nearby {
+		for i := range users {
+			distance := geo.GeodesicKm(geo.Point{Latitude: filter.Latitude, Longitude: filter.Longitude}, users[i].PublicLocation())
+			users[i].Distance = &distance
+		}
+	}
 
-	return &users, err
+	err = LoadReputations(ctx, db, users)
+	if err != nil {
+		return &[]User{}, err
+	}
+	err = LoadProviderStats(ctx, db, users)
+	if err != nil {
+		return &[]User{}, err
+	}
+	err = LoadUserProfiles(ctx, db, users)
+	if err != nil {
+		return &[]User{}, err
+	}
+
+	//Nearest first in nearby searches, otherwise the most responsive and reliable providers first
+	if filter.Nearby {
+		sort.SliceStable(users, func(i, j int) bool {
+			return *users[i].Distance < *users[j].Distance
+		})
+	} else {
+		sort.SliceStable(users, func(i, j int) bool {
+			return users[i].Stats.Score() > users[j].Stats.Score()
+		})
+	}
+	return &users, nil
 }
 
 //Find user based on id
-func (u *User) FindUserByID(db *gorm.DB, uid uint32) (*User, error) {
+func (u *User) FindUserByID(ctx context.Context, db *gorm.DB, uid uint32) (*User, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 	err = db.Debug().Model(User{}).Where("id = ?", uid).Take(&u).Error
 	if err != nil {
@@ -196,33 +818,82 @@ func (u *User) FindUserByID(db *gorm.DB, uid uint32) (*User, error) {
 	return u, err
 }
 
-//Update user details
-func (u *User) UpdateAUser(db *gorm.DB, uid uint32) (*User, error) {
+//Find user based on email, served by the unique index of the column
+func (u *User) FindUserByEmail(ctx context.Context, db *gorm.DB, email string) (*User, error) {
+	db = database.WithContext(ctx, db)
+	err := db.Debug().Model(User{}).Where("email = ?", strings.TrimSpace(email)).Take(&u).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &User{}, errors.New("User Not Found")
+	}
+	if err != nil {
+		return &User{}, err
+	}
+	return u, nil
+}
 
-	// To hash the password
-	err := u.BeforeSave()
+//Find user based on username
+func (u *User) FindUserByUsername(ctx context.Context, db *gorm.DB, username string) (*User, error) {
+	db = database.WithContext(ctx, db)
+	err := db.Debug().Model(User{}).Where("username = ?", strings.TrimSpace(username)).Take(&u).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &User{}, errors.New("User Not Found")
+	}
 	if err != nil {
-		log.Fatal(err)
+		return &User{}, err
 	}
+	return u, nil
+}
 
-	db = db.Debug().Model(&User{}).Where("id = ?", uid).Take(&User{}).UpdateColumns(
+//Find user based on phone number, served by the unique index of the column
+func (u *User) FindUserByPhone(ctx context.Context, db *gorm.DB, phone string) (*User, error) {
+	db = database.WithContext(ctx, db)
+	err := db.Debug().Model(User{}).Where("phone = ?", strings.TrimSpace(phone)).Take(&u).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &User{}, errors.New("User Not Found")
+	}
+	if err != nil {
+		return &User{}, err
+	}
+	return u, nil
+}
+
+//Update user details
+func (u *User) UpdateAUser(ctx context.Context, db *gorm.DB, uid uint32) (*User, error) {
+	db = database.WithContext(ctx, db)
+
+	//The password changes through ChangePassword only
+	update := db.Debug().Model(&User{}).Where("id = ?", uid).Take(&User{}).UpdateColumns(
 		map[string]interface{}{
-			"username":       u.Username,
-			"email":          u.Email,
-			"phone":          u.Phone,
-			"image_url":      u.ImageURL,
-			"specialisation": u.Specialisation,
-			"latitude":       u.Latitude,
-			"longitude":      u.Longitude,
-			"address":        u.Address,
-			"region":         u.Region,
-			"country":        u.Country,
-			"password":       u.Password,
-			"updated_at":     time.Now(),
+			"username":         u.Username,
+			"email":            u.Email,
+			"phone":            u.Phone,
+			"image_url":        u.ImageURL,
+			"thumbnail_url":    u.ThumbnailURL,
+			"medium_url":       u.MediumURL,
+			"specialisation":   u.Specialisation,
+			"latitude":         u.Latitude,
+			"longitude":        u.Longitude,
+			"plus_code":        u.PlusCode,
+			"region":           u.Region,
+			"country":          u.Country,
+			"hide_email":       u.HideEmail,
+			"hide_phone":       u.HidePhone,
+			"service_radius":   u.ServiceRadius,
+			"locale":           u.Locale,
+			"digest_frequency": u.DigestFrequency,
+			"languages":        u.Languages,
+			"updated_at":       time.Now(),
 		},
 	)
-	if db.Error != nil {
-		return &User{}, db.Error
+	if field, ok := duplicateKeyField(update.Error); ok {
+		return &User{}, &DuplicateUserError{Field: field}
+	}
+	if update.Error != nil {
+		return &User{}, update.Error
+	}
+	err := saveUserProfile(db, uid, map[string]interface{}{"address": u.Address, "metadata": u.Metadata})
+	if err != nil {
+		return &User{}, err
 	}
 	// This is the display the updated user
 	err = db.Debug().Model(&User{}).Where("id = ?", uid).Take(&u).Error
@@ -232,8 +903,264 @@ func (u *User) UpdateAUser(db *gorm.DB, uid uint32) (*User, error) {
 	return u, nil
 }
 
-//Delete user account using id
-func (u *User) DeleteAUser(db *gorm.DB, uid uint32) (int64, error) {
+//Fields a partial update can change by their JSON name, with their column
+var patchableUserFields = map[string]string{
+	"username":          "username",
+	"email":             "email",
+	"phone_number":      "phone",
+	"image_url":         "image_url",
+	"thumbnail_url":     "thumbnail_url",
+	"medium_url":        "medium_url",
+	"specialisation":    "specialisation",
+	"latitude":          "latitude",
+	"longitude":         "longitude",
+	"plus_code":         "plus_code",
+	"address":           "address",
+	"region":            "region",
+	"country":           "country",
+	"hide_email":        "hide_email",
+	"hide_phone":        "hide_phone",
+	"service_radius_km": "service_radius",
+	"locale":            "locale",
+	"digest_frequency":  "digest_frequency",
+	"languages":         "languages",
+	"metadata":          "metadata",
+}
+
+//Overwrite the fields in the patch and leave the others as they are, validate the user afterwards
+func (u *User) ApplyPatch(patch map[string]json.RawMessage) error {
+	for field := range patch {
+		if _, ok := patchableUserFields[field]; !ok {
+			return fmt.Errorf("Field %s Cannot Be Updated", field)
+		}
+	}
+	raw, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(raw, u)
+	if err != nil {
+		return err
+	}
+
+	//Only the fields sent are escaped, the others already were
+	for field := range patch {
+		switch field {
+		case "username":
+			u.Username = html.EscapeString(strings.TrimSpace(u.Username))
+		case "email":
+			u.Email = html.EscapeString(strings.TrimSpace(u.Email))
+		case "phone_number":
+			u.Phone = html.EscapeString(strings.TrimSpace(u.Phone))
+		case "image_url":
+			u.ImageURL = html.EscapeString(strings.TrimSpace(u.ImageURL))
+		case "thumbnail_url":
+			u.ThumbnailURL = html.EscapeString(strings.TrimSpace(u.ThumbnailURL))
+		case "medium_url":
+			u.MediumURL = html.EscapeString(strings.TrimSpace(u.MediumURL))
+		case "specialisation":
+			u.Specialisation = html.EscapeString(strings.TrimSpace(u.Specialisation))
+		case "locale":
+			u.Locale = templates.Normalize(u.Locale)
+		}
+	}
+
+	//Whichever of the plus code and the coordinates was sent wins over the stored other
+	_, plusCode := patch["plus_code"]
+	_, latitude := patch["latitude"]
+	_, longitude := patch["longitude"]
+	if plusCode && !latitude && !longitude {
+		u.Latitude, u.Longitude = 0, 0
+	}
+	if !plusCode && (latitude || longitude) {
+		u.PlusCode = ""
+	}
+	return nil
+}
+
+//Store only the fields named in the patch, along with the location fields derived from each other
+func (u *User) PatchAUser(ctx context.Context, db *gorm.DB, uid uint32, patch map[string]json.RawMessage) (*User, error) {
+	db = database.WithContext(ctx, db)
+
+	values := map[string]interface{}{
+		"username":          u.Username,
+		"email":             u.Email,
+		"phone_number":      u.Phone,
+		"image_url":         u.ImageURL,
+		"thumbnail_url":     u.ThumbnailURL,
+		"medium_url":        u.MediumURL,
+		"specialisation":    u.Specialisation,
+		"latitude":          u.Latitude,
+		"longitude":         u.Longitude,
+		"plus_code":         u.PlusCode,
+		"address":           u.Address,
+		"region":            u.Region,
+		"country":           u.Country,
+		"hide_email":        u.HideEmail,
+		"hide_phone":        u.HidePhone,
+		"service_radius_km": u.ServiceRadius,
+		"locale":            u.Locale,
+		"digest_frequency":  u.DigestFrequency,
+		"languages":         u.Languages,
+		"metadata":          u.Metadata,
+	}
+	columns := map[string]interface{}{"updated_at": time.Now()}
+	profileColumns := map[string]interface{}{}
+	for field := range patch {
+		if field == "address" || field == "metadata" {
+			profileColumns[field] = values[field]
+			continue
+		}
+		columns[patchableUserFields[field]] = values[field]
+		if field == "latitude" || field == "longitude" || field == "plus_code" {
+			columns["latitude"], columns["longitude"], columns["plus_code"] = u.Latitude, u.Longitude, u.PlusCode
+		}
+	}
+
+	err := db.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumns(columns).Error
+	if field, ok := duplicateKeyField(err); ok {
+		return &User{}, &DuplicateUserError{Field: field}
+	}
+	if err != nil {
+		return &User{}, err
+	}
+	if len(profileColumns) > 0 {
+		err = saveUserProfile(db, uid, profileColumns)
+		if err != nil {
+			return &User{}, err
+		}
+	}
+	user := User{}
+	userFound, err := user.FindUserByID(ctx, db, uid)
+	if err != nil {
+		return &User{}, err
+	}
+	err = userFound.LoadProfile(ctx, db)
+	if err != nil {
+		return &User{}, err
+	}
+	return userFound, nil
+}
+
+var ErrIncorrectPassword = errors.New("Incorrect Password")
+
+//Change the password after checking the current one, revoking every token issued to the user before
+func ChangePassword(ctx context.Context, db *gorm.DB, uid uint32, current, password string) (*User, error) {
+	db = database.WithContext(ctx, db)
+
+	//A stolen token alone shouldn't be enough to guess the password and take the account over
+	_, err := StartVerificationAttempt(ctx, db, uid, AttemptsPasswordChange)
+	if err != nil {
+		return &User{}, err
+	}
+	user := User{}
+	userFound, err := user.FindUserByID(ctx, db, uid)
+	if err != nil {
+		return &User{}, err
+	}
+	if VerifyPassword(userFound.Password, current) != nil {
+		return &User{}, ErrIncorrectPassword
+	}
+	err = ClearVerificationAttempts(ctx, db, uid, AttemptsPasswordChange)
+	if err != nil {
+		return &User{}, err
+	}
+	err = ValidatePassword(ctx, password, userFound)
+	if err != nil {
+		return &User{}, err
+	}
+
+	hashedPassword, err := Hash(password)
+	if err != nil {
+		return &User{}, err
+	}
+	now := time.Now()
+	err = db.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumns(
+		map[string]interface{}{
+			"password":           string(hashedPassword),
+			"tokens_valid_after": now,
+			"updated_at":         now,
+		},
+	).Error
+	if err != nil {
+		return &User{}, err
+	}
+	changed := User{}
+	return changed.FindUserByID(ctx, db, uid)
+}
+
+//Change the role of a user, revoking their tokens which carry the old one
+func SetUserRole(ctx context.Context, db *gorm.DB, uid uint32, role string) (*User, error) {
+	db = database.WithContext(ctx, db)
+
+	if !auth.ValidRole(role) {
+		return &User{}, errors.New("Invalid Role")
+	}
+
+	update := db.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumns(
+		map[string]interface{}{
+			"role":               role,
+			"tokens_valid_after": time.Now(),
+			"updated_at":         time.Now(),
+		},
+	)
+	if update.Error != nil {
+		return &User{}, update.Error
+	}
+	if update.RowsAffected == 0 {
+		return &User{}, errors.New("User Not Found")
+	}
+
+	user := User{}
+	return user.FindUserByID(ctx, db, uid)
+}
+
+//Adds the role column, making the users with a specialisation providers
+func MigrateRoles(db *gorm.DB) {
+	if !db.HasTable(&User{}) || db.Dialect().HasColumn("users", "role") {
+		return
+	}
+	err := db.AutoMigrate(&User{}).Error
+	if err != nil {
+		return
+	}
+	db.Model(&User{}).Where("specialisation <> ''").UpdateColumn("role", auth.RoleProvider)
+}
+
+//Store a new password, hashing it first
+func (u *User) UpdatePassword(ctx context.Context, db *gorm.DB, uid uint32, password string) error {
+	db = database.WithContext(ctx, db)
+
+	hashedPassword, err := Hash(password)
+	if err != nil {
+		return err
+	}
+
+	return db.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumns(
+		map[string]interface{}{
+			"password":   string(hashedPassword),
+			"updated_at": time.Now(),
+		},
+	).Error
+}
+
+//Store the second factor secret and whether it is enforced at login
+func (u *User) UpdateTwoFactor(ctx context.Context, db *gorm.DB, uid uint32, secret string, enabled bool) error {
+	db = database.WithContext(ctx, db)
+
+	return db.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumns(
+		map[string]interface{}{
+			"two_factor_secret":  secret,
+			"two_factor_enabled": enabled,
+			"updated_at":         time.Now(),
+		},
+	).Error
+}
+
+//Delete user account using id. The account is only marked deleted, lookups and logins leave it out
+//and it can be restored with RestoreUser until it is purged.
+func (u *User) DeleteAUser(ctx context.Context, db *gorm.DB, uid uint32) (int64, error) {
+	db = database.WithContext(ctx, db)
 
 	db = db.Debug().Model(&User{}).Where("id = ?", uid).Take(&User{}).Delete(&User{})
 
@@ -243,30 +1170,398 @@ func (u *User) DeleteAUser(db *gorm.DB, uid uint32) (int64, error) {
 	return db.RowsAffected, nil
 }
 
-func UploadProfilePicToS3(path string, s *session.Session, file multipart.File, fileHeader *multipart.FileHeader) (string, error) {
-	urlLink := "https://vickikbt-fixit-app.s3.us-east-2.amazonaws.com/"
+//How long deleted accounts can be restored and accounts scheduled for deletion wait, ACCOUNT_DELETION_GRACE_DAYS in the environment
+func AccountDeletionGrace() time.Duration {
+	graceDays, err := strconv.Atoi(os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"))
+	if err != nil || graceDays < 0 {
+		graceDays = 30
+	}
+	return time.Duration(graceDays) * 24 * time.Hour
+}
 
-	size := fileHeader.Size
-	buffer := make([]byte, size)
-	file.Read(buffer)
+//Returned when the account wasn't deleted or was already purged
+var ErrNotRestorable = errors.New("No Deleted Account To Restore")
+
+//Bring back a deleted account still in its grace period. Tokens issued before are revoked, the owner logs in again.
+func RestoreUser(ctx context.Context, db *gorm.DB, uid uint32) (*User, error) {
+	db = database.WithContext(ctx, db)
+
+	now := time.Now()
+	restore := db.Debug().Unscoped().Model(&User{}).Where("id = ? and deleted_at is not null and deleted_at > ?", uid, now.Add(-AccountDeletionGrace())).UpdateColumns(
+		map[string]interface{}{
+			"deleted_at":         gorm.Expr("NULL"),
+			"tokens_valid_after": now,
+			"updated_at":         now,
+		},
+	)
+	if restore.Error != nil {
+		return &User{}, restore.Error
+	}
+	if restore.RowsAffected == 0 {
+		return &User{}, ErrNotRestorable
+	}
+
+	user := User{}
+	return user.FindUserByID(ctx, db, uid)
+}
+
+//Schedule the account for deletion once the grace period ends
+func (u *User) ScheduleDeletion(ctx context.Context, db *gorm.DB, uid uint32, at time.Time) error {
+	db = database.WithContext(ctx, db)
+	return db.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumn("deletion_scheduled_at", at).Error
+}
+
+//Cancel a scheduled deletion of the account
+func (u *User) CancelDeletion(ctx context.Context, db *gorm.DB, uid uint32) error {
+	db = database.WithContext(ctx, db)
+	return db.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumn("deletion_scheduled_at", gorm.Expr("NULL")).Error
+}
+
+//Delete the accounts scheduled for deletion and the deleted accounts whose grace period has ended, along with their private records.
+//Only failing to find them is returned, accounts that fail to purge are logged and skipped.
+func PurgeScheduledDeletions(ctx context.Context, db *gorm.DB, now time.Time) (int64, error) {
+	db = database.WithContext(ctx, db).Unscoped()
+
+	users := []User{}
+	err := db.Debug().Model(&User{}).Where("(deletion_scheduled_at is not null and deletion_scheduled_at <= ?) or (deleted_at is not null and deleted_at <= ?)",
+		now, now.Add(-AccountDeletionGrace())).Limit(100).Find(&users).Error
+	if err != nil {
+		return 0, err
+	}
+
+	//Each account goes whole or not at all, one that fails is logged and left for the next run
+	var purged int64
+	for i := range users {
+		uid := users[i].ID
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for _, record := range userPrivateRecords() {
+				err := tx.Debug().Where("user_id = ?", uid).Delete(record).Error
+				if err != nil {
+					return err
+				}
+			}
+			return tx.Debug().Where("id = ?", uid).Delete(&User{}).Error
+		})
+		if err != nil {
+			log.Printf("Purging user %d failed: %v", uid, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+//Returned for contact cards of accounts that aren't listed providers
+var ErrProviderNotFound = errors.New("Provider Not Found")
+
+//Whether others are shown the account as a provider, banned accounts and accounts being deleted are not
+func (u *User) ListedProvider() bool {
+	return u.Role == auth.RoleProvider && u.BannedAt == nil && u.DeletionScheduledAt == nil && u.DeletedAt == nil
+}
+
+//Contact card of a listed provider in vCard 3.0 format, leaving out hidden fields and the street address
+func (u *User) VCard() (string, error) {
+	if !u.ListedProvider() {
+		return "", ErrProviderNotFound
+	}
+	var card strings.Builder
+
+	line := func(format string, args ...interface{}) {
+		card.WriteString(fmt.Sprintf(format, args...))
+		card.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCARD")
+	line("VERSION:3.0")
+	line("FN:%s", vCardEscape(html.UnescapeString(u.Username)))
+	line("N:%s;;;;", vCardEscape(html.UnescapeString(u.Username)))
+	if u.Specialisation != "" {
+		line("TITLE:%s", vCardEscape(html.UnescapeString(u.Specialisation)))
+	}
+	if u.HasPhone() && !u.HidePhone {
+		line("TEL;TYPE=CELL:%s", vCardEscape(html.UnescapeString(u.Phone)))
+	}
+	if u.Email != "" && !u.HideEmail {
+		line("EMAIL;TYPE=INTERNET:%s", vCardEscape(html.UnescapeString(u.Email)))
+	}
+	if u.Region != "" || u.Country != "" {
+		line("ADR;TYPE=WORK:;;;%s;;;%s", vCardEscape(u.Region), vCardEscape(u.Country))
+	}
+	if u.ImageURL != "" {
+		line("PHOTO;VALUE=URI:%s", u.ImageURL)
+	}
+	line("UID:fixit-user-%d", u.ID)
+	line("REV:%s", u.UpdatedAt.UTC().Format("20060102T150405Z"))
+	line("END:VCARD")
+
+	return card.String(), nil
+}
+
+//Escape the characters reserved by the vCard format
+func vCardEscape(value string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", ";", "\\;", ",", "\\,", "\r\n", "\\n", "\n", "\\n")
+	return replacer.Replace(value)
+}
+
+//URLs of a profile picture and the variants made of it, variants are empty for images that can't be resized such as WebP
+type ProfilePicture struct {
+	ImageURL     string   `json:"imageURL"`
+	ThumbnailURL string   `json:"thumbnailURL"`
+	MediumURL    string   `json:"mediumURL"`
+	Keys         []string `json:"-"`
+}
+
+//Read an uploaded image and check it with imaging.Process, making the variants given
+func processImage(ctx context.Context, file multipart.File, variants []imaging.Variant) (*imaging.Processed, error) {
+	buffer, err := ioutil.ReadAll(io.LimitReader(file, imaging.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	err = fault.Inject(ctx, fault.S3)
+	if err != nil {
+		return nil, storage.S3Error(err)
+	}
+	return imaging.Process(buffer, variants)
+}
+
+//Store an image with the storage backend and record it as uploaded by the user
+func storeImage(ctx context.Context, db *gorm.DB, store storage.Storage, uid uint32, path, key string, image imaging.Image, once bool) error {
+	err := store.Upload(ctx, key, image.Data, image.ContentType)
+	if err != nil {
+		return err
+	}
+
+	checksum := sha256.Sum256(image.Data)
+	object := &StoredObject{
+		Key:         key,
+		UserID:      uid,
+		Purpose:     path,
+		Size:        int64(len(image.Data)),
+		ContentType: image.ContentType,
+		Checksum:    hex.EncodeToString(checksum[:]),
+	}
+	if once {
+		err = SaveStoredObjectOnce(ctx, db, object)
+	} else {
+		err = SaveStoredObject(ctx, db, object)
+	}
+	if err != nil {
+		//Only the S3 bucket is reconciled, so the file isn't left behind without its record
+		if deleteErr := store.Delete(ctx, key); deleteErr != nil {
+			log.Printf("Deleting unrecorded file %s failed: %v", key, deleteErr)
+		}
+		return err
+	}
+	return nil
+}
+
+//Store a public image, such as a gallery photo, without its metadata and return its URL
+func UploadImage(ctx context.Context, db *gorm.DB, store storage.Storage, uid uint32, path string, file multipart.File) (string, error) {
+	processed, err := processImage(ctx, file, nil)
+	if err != nil {
+		return "", err
+	}
+	key := path + "/" + bson.NewObjectId().Hex() + processed.Original.Extension
+	err = storeImage(ctx, db, store, uid, path, key, processed.Original, false)
+	if err != nil {
+		return "", err
+	}
+	return store.URL(key), nil
+}
+
+//Store a profile picture without its metadata along with its thumbnail and medium variants
+func UploadProfilePic(ctx context.Context, db *gorm.DB, store storage.Storage, uid uint32, path string, file multipart.File) (*ProfilePicture, error) {
+	processed, err := processImage(ctx, file, imaging.Variants)
+	if err != nil {
+		return nil, err
+	}
+	key := path + "/" + bson.NewObjectId().Hex() + processed.Original.Extension
+	return saveProfilePicture(ctx, db, store, uid, path, key, processed, false)
+}
+
+//Replace a profile picture uploaded straight to the storage backend with its processed version and add its variants
+func ProcessUploadedProfilePic(ctx context.Context, db *gorm.DB, store storage.Storage, uid uint32, key string, data []byte) (*ProfilePicture, error) {
+	processed, err := imaging.Process(data, imaging.Variants)
+	if err != nil {
+		return nil, err
+	}
+	return saveProfilePicture(ctx, db, store, uid, "profile", key, processed, true)
+}
+
+//Variants are stored next to the image, profile/abc.jpg has profile/abc_thumbnail.jpg
+func saveProfilePicture(ctx context.Context, db *gorm.DB, store storage.Storage, uid uint32, path, key string, processed *imaging.Processed, once bool) (*ProfilePicture, error) {
+	err := storeImage(ctx, db, store, uid, path, key, processed.Original, once)
+	if err != nil {
+		return nil, err
+	}
+	picture := &ProfilePicture{ImageURL: store.URL(key), Keys: []string{key}}
+
+	base := strings.TrimSuffix(key, filepath.Ext(key))
+	for name, variant := range processed.Variants {
+		variantKey := base + "_" + name + variant.Extension
+		err = storeImage(ctx, db, store, uid, path, variantKey, variant, once)
+		if err != nil {
+			return nil, err
+		}
+		picture.Keys = append(picture.Keys, variantKey)
+		switch name {
+		case "thumbnail":
+			picture.ThumbnailURL = store.URL(variantKey)
+		case "medium":
+			picture.MediumURL = store.URL(variantKey)
+		}
+	}
+	return picture, nil
+}
+
+//Point the user's profile picture and its variants at an uploaded image
+func SetUserProfilePicture(ctx context.Context, db *gorm.DB, uid uint32, picture *ProfilePicture) error {
+	db = database.WithContext(ctx, db)
+
+	return db.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumns(
+		map[string]interface{}{
+			"image_url":     picture.ImageURL,
+			"thumbnail_url": picture.ThumbnailURL,
+			"medium_url":    picture.MediumURL,
+			"image_keys":    strings.Join(picture.Keys, ","),
+			"updated_at":    time.Now(),
+		},
+	).Error
+}
+
+//Profile picture URLs of the user that are set
+func (u *User) PictureURLs() []string {
+	urls := []string{}
+	for _, url := range []string{u.ImageURL, u.ThumbnailURL, u.MediumURL} {
+		if url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+//Track the stored files behind the user's picture URLs
+func SetUserImageKeys(ctx context.Context, db *gorm.DB, uid uint32, keys []string) error {
+	db = database.WithContext(ctx, db)
+
+	return db.Debug().Model(&User{}).Where("id = ?", uid).UpdateColumns(
+		map[string]interface{}{
+			"image_keys": strings.Join(keys, ","),
+			"updated_at": time.Now(),
+		},
+	).Error
+}
+
+//How long a signed link to a private file works
+const PrivateFileURLLifetime = 15 * time.Minute
+
+//Stream a file only signed links can open, such as dispute evidence, to the storage backend under path,
+//failing with storage.ErrTooLarge past maxSize bytes, and return its key
+func UploadPrivateFile(ctx context.Context, db *gorm.DB, store storage.Storage, uid uint32, path string, file multipart.File, fileHeader *multipart.FileHeader, maxSize int64) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	contentType := http.DetectContentType(head[:n])
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+
+	err = fault.Inject(ctx, fault.S3)
+	if err != nil {
+		return "", storage.S3Error(err)
+	}
+
+	key := path + "/" + bson.NewObjectId().Hex() + filepath.Ext(fileHeader.Filename)
+	checksum := sha256.New()
+	body := &storage.LimitedReader{Reader: io.TeeReader(file, checksum), Limit: maxSize}
+	err = store.UploadPrivate(ctx, key, body, contentType)
+	if body.Count > body.Limit {
+		return "", storage.ErrTooLarge
+	}
+	if err != nil {
+		return "", err
+	}
+
+	//Without its record the file is left for the media reconciliation to clean up
+	err = SaveStoredObject(ctx, db, &StoredObject{
+		Key:         key,
+		UserID:      uid,
+		Purpose:     path,
+		Size:        body.Count,
+		ContentType: contentType,
+		Checksum:    hex.EncodeToString(checksum.Sum(nil)),
+	})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+//Short lived link to a private file, callers check the user may see the file first
+func SignedFileURL(ctx context.Context, store storage.Storage, key string) (string, error) {
+	return store.SignedURL(ctx, key, PrivateFileURLLifetime)
+}
+
+//Stream the file to S3 under path, failing with storage.ErrTooLarge past maxSize bytes, and record it as uploaded by the user.
+//The uploader holds one part in memory at a time whatever the size of the file.
+func putS3Object(ctx context.Context, db *gorm.DB, uid uint32, path, acl string, s *session.Session, file multipart.File, fileHeader *multipart.FileHeader, maxSize int64) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	contentType := http.DetectContentType(head[:n])
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+
+	err = fault.Inject(ctx, fault.S3)
+	if err != nil {
+		return "", storage.S3Error(err)
+	}
 
 	// create a unique file name for the file
 	tempFileName := path + "/" + bson.NewObjectId().Hex() + filepath.Ext(fileHeader.Filename)
 
-	_, err := s3.New(s).PutObject(&s3.PutObjectInput{
-		Bucket:               aws.String("vickikbt-fixit-app"), //Bucket name
-		Key:                  aws.String(tempFileName),         //File name
-		ACL:                  aws.String("public-read"),        // Access type- public
-		Body:                 bytes.NewReader(buffer),
-		ContentLength:        aws.Int64(int64(size)),
-		ContentType:          aws.String(http.DetectContentType(buffer)),
+	config := storage.S3Settings()
+	checksum := sha256.New()
+	body := &storage.LimitedReader{Reader: io.TeeReader(file, checksum), Limit: maxSize}
+	uploader := s3manager.NewUploader(s, func(u *s3manager.Uploader) {
+		u.Concurrency = 1
+	})
+	_, err = uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:               aws.String(config.Bucket), //Bucket name
+		Key:                  aws.String(tempFileName),  //File name
+		ACL:                  aws.String(acl),           // Access type
+		Body:                 body,
+		ContentType:          aws.String(contentType),
 		ContentDisposition:   aws.String("attachment"),
 		ServerSideEncryption: aws.String("AES256"),
-		StorageClass:         aws.String("INTELLIGENT_TIERING"),
+		StorageClass:         aws.String(config.StorageClass),
 	})
+	if body.Count > body.Limit {
+		//The uploader aborts the parts sent so far
+		return "", storage.ErrTooLarge
+	}
 	if err != nil {
-		return "", err
+		return "", storage.S3Error(err)
 	}
 
-	return urlLink + tempFileName, err
+	//Without its record the file is left for the media reconciliation to clean up
+	err = SaveStoredObject(ctx, db, &StoredObject{
+		Key:         tempFileName,
+		UserID:      uid,
+		Purpose:     path,
+		Size:        body.Count,
+		ContentType: contentType,
+		Checksum:    hex.EncodeToString(checksum.Sum(nil)),
+	})
+	if err != nil {
+		return "", err
+	}
+	return tempFileName, nil
 }
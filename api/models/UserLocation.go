@@ -0,0 +1,87 @@
+package models
+
+import (
+	"context"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/geo"
+	"github.com/victorkabata/FixIt-API/api/geocode"
+)
+
+//Users with an address but no coordinates, read and updated by the geocoding backfill
+type UserLocations struct {
+	DB *gorm.DB
+}
+
+func (l *UserLocations) pending(ctx context.Context) *gorm.DB {
+	db := database.WithContext(ctx, l.DB)
+	withAddress := db.Model(&UserProfile{}).Select("user_id").Where("address <> ''").QueryExpr()
+	return db.Debug().Model(&User{}).Where("latitude = 0 and longitude = 0 and id in (?)", withAddress)
+}
+
+func (l *UserLocations) CountPending(ctx context.Context) (int, error) {
+	var count int
+	err := l.pending(ctx).Count(&count).Error
+	return count, err
+}
+
+func (l *UserLocations) NextPending(ctx context.Context, afterID uint32, limit int) ([]geocode.Pending, error) {
+	users := []User{}
+	err := l.pending(ctx).Where("id > ?", afterID).Order("id asc").Limit(limit).Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	err = LoadUserProfiles(ctx, l.DB, users)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []geocode.Pending{}
+	for _, user := range users {
+		parts := []string{}
+		for _, part := range []string{user.Address, user.Region, user.Country} {
+			if part = strings.TrimSpace(html.UnescapeString(part)); part != "" {
+				parts = append(parts, part)
+			}
+		}
+		pending = append(pending, geocode.Pending{ID: user.ID, Address: strings.Join(parts, ", ")})
+	}
+	return pending, nil
+}
+
+func (l *UserLocations) SaveCoordinates(ctx context.Context, id uint32, latitude, longitude float64) error {
+	db := database.WithContext(ctx, l.DB)
+	return db.Debug().Model(&User{}).Where("id = ?", id).UpdateColumns(
+		map[string]interface{}{
+			"latitude":   latitude,
+			"longitude":  longitude,
+			"plus_code":  geo.EncodePlusCode(geo.Point{Latitude: latitude, Longitude: longitude}, geo.PlusCodeLength),
+			"updated_at": time.Now(),
+		},
+	).Error
+}
+
+//Adds the plus code column and fills it in for users who already have coordinates
+func MigratePlusCodes(db *gorm.DB) {
+	if !db.HasTable(&User{}) || db.Dialect().HasColumn("users", "plus_code") {
+		return
+	}
+	err := db.AutoMigrate(&User{}).Error
+	if err != nil {
+		return
+	}
+
+	users := []User{}
+	err = db.Model(&User{}).Select("id, latitude, longitude").Where("latitude <> 0 or longitude <> 0").Find(&users).Error
+	if err != nil {
+		return
+	}
+	for _, user := range users {
+		point := geo.Point{Latitude: float64(user.Latitude), Longitude: float64(user.Longitude)}
+		db.Model(&User{}).Where("id = ?", user.ID).UpdateColumn("plus_code", geo.EncodePlusCode(point, geo.PlusCodeLength))
+	}
+}
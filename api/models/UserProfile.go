@@ -0,0 +1,110 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//Rarely read details of a user, kept out of the users table so logins and token checks read a slim row.
+//Loaded into User.Address and User.Metadata where the whole profile is shown.
+type UserProfile struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"-"`
+	UserID    uint32    `gorm:"not null;unique_index" json:"-"`
+	Address   string    `gorm:"size:255;not null;default:''" json:"address"`
+	Metadata  Metadata  `gorm:"type:json" json:"metadata"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+//Profiles of the users by user ID, users without one are left out
+func FindUserProfiles(ctx context.Context, db *gorm.DB, uids []uint32) (map[uint32]UserProfile, error) {
+	db = database.WithContext(ctx, db)
+
+	byUser := map[uint32]UserProfile{}
+	if len(uids) == 0 {
+		return byUser, nil
+	}
+	profiles := []UserProfile{}
+	err := db.Debug().Model(&UserProfile{}).Where("user_id in (?)", uids).Find(&profiles).Error
+	if err != nil {
+		return byUser, err
+	}
+	for _, profile := range profiles {
+		byUser[profile.UserID] = profile
+	}
+	return byUser, nil
+}
+
+//Load the profile of each of the users
+func LoadUserProfiles(ctx context.Context, db *gorm.DB, users []User) error {
+	uids := make([]uint32, len(users))
+	for i := range users {
+		uids[i] = users[i].ID
+	}
+	profiles, err := FindUserProfiles(ctx, db, uids)
+	if err != nil {
+		return err
+	}
+	for i := range users {
+		profile := profiles[users[i].ID]
+		users[i].Address, users[i].Metadata = profile.Address, profile.Metadata
+	}
+	return nil
+}
+
+//Load the profile of the user
+func (u *User) LoadProfile(ctx context.Context, db *gorm.DB) error {
+	profiles, err := FindUserProfiles(ctx, db, []uint32{u.ID})
+	if err != nil {
+		return err
+	}
+	profile := profiles[u.ID]
+	u.Address, u.Metadata = profile.Address, profile.Metadata
+	return nil
+}
+
+//Write the given profile columns of the user, creating the profile the first time
+func saveUserProfile(db *gorm.DB, uid uint32, columns map[string]interface{}) error {
+	count := 0
+	err := db.Debug().Model(&UserProfile{}).Where("user_id = ?", uid).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if count == 0 {
+		err = db.Debug().Model(&UserProfile{}).Create(&UserProfile{UserID: uid, UpdatedAt: now}).Error
+		//Another request created it first, it is updated below all the same
+		if _, duplicate := duplicateKeyField(err); err != nil && !duplicate {
+			return err
+		}
+	}
+	columns["updated_at"] = now
+	return db.Debug().Model(&UserProfile{}).Where("user_id = ?", uid).UpdateColumns(columns).Error
+}
+
+//Moves the address and custom fields of existing users to user_profiles, then drops the columns from users
+func MigrateUserProfiles(db *gorm.DB) {
+	if !db.HasTable(&User{}) || !db.Dialect().HasColumn("users", "address") {
+		return
+	}
+	err := db.AutoMigrate(&UserProfile{}).Error
+	if err != nil {
+		return
+	}
+
+	metadata := "null"
+	if db.Dialect().HasColumn("users", "metadata") {
+		metadata = "metadata"
+	}
+	//Users who already have a profile keep it, so running it again after a failed drop is harmless
+	err = db.Exec("insert into user_profiles (user_id, address, metadata, updated_at) select id, address, " + metadata + ", now() from users where id not in (select user_id from user_profiles)").Error
+	if err != nil {
+		return
+	}
+	if metadata == "metadata" {
+		db.Model(&User{}).DropColumn("metadata")
+	}
+	db.Model(&User{}).DropColumn("address")
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/geo"
+)
+
+//What other users and anonymous callers see of a user, anything about the account itself such as its
+//status, flags and settings is left out
+type PublicUser struct {
+	ID             uint32            `json:"id"`
+	Username       string            `json:"username"`
+	Email          string            `json:"email"`
+	Phone          string            `json:"phone_number"`
+	ImageURL       string            `json:"image_url"`
+	ThumbnailURL   string            `json:"thumbnail_url"`
+	MediumURL      string            `json:"medium_url"`
+	Role           string            `json:"role"`
+	Specialisation string            `json:"specialisation"`
+	Latitude       float32           `json:"latitude"`
+	Longitude      float32           `json:"longitude"`
+	PlusCode       string            `json:"plus_code"`
+	Region         string            `json:"region"`
+	Country        string            `json:"country"`
+	ServiceRadius  float64           `json:"service_radius_km"`
+	Languages      Languages         `json:"languages"`
+	Metadata       Metadata          `json:"metadata"`
+	Gallery        []GalleryItem     `json:"gallery,omitempty"`
+	Services       []ServiceOffering `json:"services,omitempty"`
+	Distance       *float64          `json:"distance_km,omitempty"`
+	Reputation
+	Stats     *ProviderStats `json:"stats,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+//The user as others see them, with the location blurred and without the street address, and the email and
+//phone number blank when the user hid them or the number is a placeholder
+func (u *User) Public() PublicUser {
+	public := PublicUser{
+		ID:             u.ID,
+		Username:       u.Username,
+		Email:          u.Email,
+		Phone:          u.PhoneNumber(),
+		ImageURL:       u.ImageURL,
+		ThumbnailURL:   u.ThumbnailURL,
+		MediumURL:      u.MediumURL,
+		Role:           u.Role,
+		Specialisation: u.Specialisation,
+		Latitude:       u.Latitude,
+		Longitude:      u.Longitude,
+		PlusCode:       u.PlusCode,
+		Region:         u.Region,
+		Country:        u.Country,
+		ServiceRadius:  u.ServiceRadius,
+		Languages:      u.Languages,
+		Metadata:       u.Metadata,
+		Gallery:        u.Gallery,
+		Services:       u.Services,
+		Distance:       u.Distance,
+		Reputation:     u.Reputation,
+		Stats:          u.Stats,
+		CreatedAt:      u.CreatedAt,
+	}
+	if u.Latitude != 0 || u.Longitude != 0 {
+		point := u.PublicLocation()
+		public.Latitude = float32(point.Latitude)
+		public.Longitude = float32(point.Longitude)
+		public.PlusCode = geo.EncodePlusCode(point, geo.PlusCodeLength)
+	}
+	if u.HideEmail {
+		public.Email = ""
+	}
+	if u.HidePhone {
+		public.Phone = ""
+	}
+	return public
+}
+
+//Location of the user blurred to PublicLocationPrecision, the same on every request
+func (u *User) PublicLocation() geo.Point {
+	return geo.Coarsen(geo.Point{Latitude: float64(u.Latitude), Longitude: float64(u.Longitude)}, PublicLocationPrecision(), uint64(u.ID))
+}
+
+//Serialize the whole account with the exact coordinates, only for responses to the user themselves
+func (u *User) ShowToOwner() {
+	u.owner = true
+}
+
+//Users are serialized as others see them, see Public, unless ShowToOwner was called. The exact coordinates
+//stay in the struct for distances.
+func (u User) MarshalJSON() ([]byte, error) {
+	if !u.owner {
+		return json.Marshal(u.Public())
+	}
+	type user User //Without the method, so marshalling it doesn't come back here
+	owned := user(u)
+	owned.Phone = u.PhoneNumber()
+	return json.Marshal(owned)
+}
+
+//What admins see of a user, the account's status and flags without its secrets
+type AdminUser struct {
+	ID                    uint32     `json:"id"`
+	Username              string     `json:"username"`
+	Email                 string     `json:"email"`
+	Phone                 string     `json:"phone_number"`
+	ImageURL              string     `json:"image_url"`
+	Role                  string     `json:"role"`
+	Specialisation        string     `json:"specialisation"`
+	Region                string     `json:"region"`
+	Country               string     `json:"country"`
+	Verified              bool       `json:"verified"`
+	PhoneVerified         bool       `json:"phone_verified"`
+	SMSOptedOut           bool       `json:"sms_opted_out"`
+	EmailStatus           string     `json:"email_status"`
+	KYCStatus             string     `json:"kyc_status"`
+	RiskStatus            string     `json:"risk_status"`
+	Locked                bool       `json:"locked"`
+	LockReason            string     `json:"lock_reason"`
+	BannedAt              *time.Time `json:"banned_at"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	DeletionScheduledAt   *time.Time `json:"deletion_scheduled_at"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+//The user as admins see them
+func (u *User) Admin() AdminUser {
+	admin := AdminUser{
+		ID:                    u.ID,
+		Username:              u.Username,
+		Email:                 u.Email,
+		Phone:                 u.PhoneNumber(),
+		ImageURL:              u.ImageURL,
+		Role:                  u.Role,
+		Specialisation:        u.Specialisation,
+		Region:                u.Region,
+		Country:               u.Country,
+		Verified:              u.Verified,
+		PhoneVerified:         u.PhoneVerified,
+		SMSOptedOut:           u.SMSOptedOut,
+		EmailStatus:           u.EmailStatus,
+		KYCStatus:             u.KYCStatus,
+		RiskStatus:            u.RiskStatus,
+		Locked:                u.Locked,
+		LockReason:            u.LockReason,
+		BannedAt:              u.BannedAt,
+		PasswordResetRequired: u.PasswordResetRequired,
+		DeletionScheduledAt:   u.DeletionScheduledAt,
+		CreatedAt:             u.CreatedAt,
+		UpdatedAt:             u.UpdatedAt,
+	}
+	return admin
+}
+
+//The users as admins see them, in the same order
+func AdminUsers(users []User) []AdminUser {
+	admins := make([]AdminUser, len(users))
+	for i := range users {
+		admins[i] = users[i].Admin()
+	}
+	return admins
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+)
+
+//What a user is entering codes for, each counted separately
+const (
+	AttemptsTwoFactor      = "two_factor" //Authenticator and recovery codes
+	AttemptsLoginCode      = "login_code"
+	AttemptsPhoneCode      = "phone_code"
+	AttemptsPasswordReset  = "password_reset"
+	AttemptsPasswordChange = "password_change" //Current password when changing it
+)
+
+//Wrong tries after which emailed codes and reset links are thrown away
+const MaxVerificationAttempts = 5
+
+//Longest wait between tries, and how long after the last try the count starts over
+const (
+	maxVerificationDelay = time.Hour
+	verificationCountTTL = 24 * time.Hour
+)
+
+//Tries at the codes of one user and scope. Every try is counted before the code is checked and
+//the count is cleared when it is right, so parallel guesses can't get around the delays.
+type VerificationAttempt struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32    `gorm:"not null;unique_index:idx_verification_attempts_user_scope" json:"user_id"`
+	Scope     string    `gorm:"size:20;not null;unique_index:idx_verification_attempts_user_scope" json:"scope"`
+	Attempts  int       `gorm:"not null;default:0" json:"attempts"`
+	RetryAt   time.Time `json:"retry_at"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+//Returned while the delay after earlier wrong tries runs
+type TooManyAttemptsError struct {
+	RetryAt time.Time
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("Too Many Attempts, Try Again In %d Seconds", e.RetryAfter())
+}
+
+//Whole seconds until the next try is allowed
+func (e *TooManyAttemptsError) RetryAfter() int {
+	return int(math.Ceil(time.Until(e.RetryAt).Seconds()))
+}
+
+//Wait before the next try once the given number of tries were made: none after the first,
+//then 1s, 2s, 4s and so on up to maxVerificationDelay
+func verificationDelay(attempts int) time.Duration {
+	if attempts < 2 {
+		return 0
+	}
+	if attempts > 14 {
+		return maxVerificationDelay
+	}
+	delay := time.Duration(1<<uint(attempts-2)) * time.Second
+	if delay > maxVerificationDelay {
+		return maxVerificationDelay
+	}
+	return delay
+}
+
+//Count a try before checking the code and return how many tries were made since the last right one.
+//Returns a *TooManyAttemptsError without counting while the delay after the previous try runs.
+func StartVerificationAttempt(ctx context.Context, db *gorm.DB, uid uint32, scope string) (int, error) {
+	db = database.WithContext(ctx, db)
+	now := time.Now()
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+
+	attempt := VerificationAttempt{}
+	err := tx.Debug().Model(&VerificationAttempt{}).Set("gorm:query_option", "FOR UPDATE").Where("user_id = ? and scope = ?", uid, scope).Take(&attempt).Error
+	if gorm.IsRecordNotFoundError(err) {
+		attempt = VerificationAttempt{UserID: uid, Scope: scope, RetryAt: now, UpdatedAt: now}
+		err = tx.Debug().Model(&VerificationAttempt{}).Create(&attempt).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		//Two first tries at once, the other one holds the count
+		if _, duplicate := duplicateKeyField(err); duplicate {
+			return 0, &TooManyAttemptsError{RetryAt: now.Add(time.Second)}
+		}
+		return 0, err
+	}
+
+	if now.Before(attempt.RetryAt) {
+		tx.Rollback()
+		return 0, &TooManyAttemptsError{RetryAt: attempt.RetryAt}
+	}
+	if now.Sub(attempt.UpdatedAt) > verificationCountTTL {
+		attempt.Attempts = 0
+	}
+
+	attempt.Attempts++
+	err = tx.Debug().Model(&VerificationAttempt{}).Where("id = ?", attempt.ID).UpdateColumns(
+		map[string]interface{}{
+			"attempts":   attempt.Attempts,
+			"retry_at":   now.Add(verificationDelay(attempt.Attempts)),
+			"updated_at": now,
+		},
+	).Error
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return attempt.Attempts, tx.Commit().Error
+}
+
+//Forget the tries after a right code, or after the code they were at was thrown away
+func ClearVerificationAttempts(ctx context.Context, db *gorm.DB, uid uint32, scope string) error {
+	db = database.WithContext(ctx, db)
+	return db.Debug().Where("user_id = ? and scope = ?", uid, scope).Delete(&VerificationAttempt{}).Error
+}
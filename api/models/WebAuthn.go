@@ -0,0 +1,195 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
+	"github.com/victorkabata/FixIt-API/api/webauthn"
+)
+
+//What a passkey challenge was issued for
+const (
+	PasskeyRegister = "register"
+	PasskeyLogin    = "login"
+)
+
+const (
+	//Most passkeys an account can have
+	MaxPasskeys = 10
+	//How long a passkey challenge can be answered, a little over the client timeout
+	PasskeyChallengeLifetime = 3 * time.Minute
+)
+
+var (
+	ErrInvalidPasskeyChallenge = errors.New("Passkey Challenge Expired Or Unknown")
+	ErrPasskeyRegistered       = errors.New("Passkey Already Registered")
+	ErrTooManyPasskeys         = errors.New("Too Many Passkeys")
+	ErrPasskeyCloned           = errors.New("Passkey Sign Count Went Backwards")
+)
+
+//Public key of a passkey the user registered, and the counter authenticators raise on each use so a
+//copied key shows up as a count going backwards
+type WebAuthnCredential struct {
+	ID             uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID         uint32     `gorm:"not null;index" json:"-"`
+	CredentialID   string     `gorm:"size:255;not null;unique_index" json:"credential_id"` //Base64url
+	PublicKey      []byte     `gorm:"type:blob;not null" json:"-"`                         //COSE encoded
+	Algorithm      int        `gorm:"not null" json:"algorithm"`
+	SignCount      uint32     `gorm:"not null" json:"-"`
+	Name           string     `gorm:"size:100;not null" json:"name"`
+	BackupEligible bool       `gorm:"not null" json:"synced"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	CreatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+//Challenge handed to a client to sign with a passkey, kept until answered. Login challenges have no user
+//since the passkey tells who is logging in.
+type WebAuthnChallenge struct {
+	ID            uint64    `gorm:"primary_key;auto_increment" json:"-"`
+	UserID        uint32    `gorm:"not null;index" json:"-"`
+	Purpose       string    `gorm:"size:20;not null" json:"-"`
+	ChallengeHash string    `gorm:"size:64;not null;unique_index" json:"-"`
+	ExpiresAt     time.Time `json:"-"`
+	CreatedAt     time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"-"`
+}
+
+//Store a challenge, clearing out expired ones on the way
+func SaveWebAuthnChallenge(ctx context.Context, db *gorm.DB, uid uint32, purpose, challenge string) error {
+	db = database.WithContext(ctx, db)
+
+	err := db.Debug().Where("expires_at < ?", time.Now()).Delete(&WebAuthnChallenge{}).Error
+	if err != nil {
+		return err
+	}
+	return db.Debug().Model(&WebAuthnChallenge{}).Create(&WebAuthnChallenge{
+		UserID:        uid,
+		Purpose:       purpose,
+		ChallengeHash: tokens.Hash(challenge),
+		ExpiresAt:     time.Now().Add(PasskeyChallengeLifetime),
+		CreatedAt:     time.Now(),
+	}).Error
+}
+
+//Use up a challenge the client answered, each one is only good once
+func UseWebAuthnChallenge(ctx context.Context, db *gorm.DB, uid uint32, purpose, challenge string) error {
+	db = database.WithContext(ctx, db)
+
+	deleted := db.Debug().Where("challenge_hash = ? and user_id = ? and purpose = ? and expires_at > ?", tokens.Hash(challenge), uid, purpose, time.Now()).Delete(&WebAuthnChallenge{})
+	if deleted.Error != nil {
+		return deleted.Error
+	}
+	if deleted.RowsAffected == 0 {
+		return ErrInvalidPasskeyChallenge
+	}
+	return nil
+}
+
+func (c *WebAuthnCredential) Prepare() {
+	c.ID = 0
+	c.Name = html.EscapeString(strings.TrimSpace(c.Name))
+	if c.Name == "" {
+		c.Name = "Passkey"
+	}
+	if len(c.Name) > 100 {
+		c.Name = c.Name[:100]
+	}
+	c.LastUsedAt = nil
+	c.CreatedAt = time.Now()
+}
+
+//Add a passkey to the user's account
+func (c *WebAuthnCredential) SaveWebAuthnCredential(ctx context.Context, db *gorm.DB) (*WebAuthnCredential, error) {
+	db = database.WithContext(ctx, db)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		count := 0
+		err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&WebAuthnCredential{}).Where("user_id = ?", c.UserID).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count >= MaxPasskeys {
+			return ErrTooManyPasskeys
+		}
+		err = tx.Debug().Model(&WebAuthnCredential{}).Create(&c).Error
+		if _, duplicate := duplicateKeyField(err); duplicate {
+			return ErrPasskeyRegistered
+		}
+		return err
+	})
+	if err != nil {
+		return &WebAuthnCredential{}, err
+	}
+	return c, nil
+}
+
+//Passkeys of the user, newest first
+func FindWebAuthnCredentials(ctx context.Context, db *gorm.DB, uid uint32) (*[]WebAuthnCredential, error) {
+	db = database.WithContext(ctx, db)
+
+	credentials := []WebAuthnCredential{}
+	err := db.Debug().Model(&WebAuthnCredential{}).Where("user_id = ?", uid).Order("id desc").Find(&credentials).Error
+	if err != nil {
+		return &[]WebAuthnCredential{}, err
+	}
+	return &credentials, nil
+}
+
+//Find a passkey by the credential ID the authenticator gave it
+func FindWebAuthnCredential(ctx context.Context, db *gorm.DB, credentialID string) (*WebAuthnCredential, error) {
+	db = database.WithContext(ctx, db)
+
+	credential := WebAuthnCredential{}
+	err := db.Debug().Model(&WebAuthnCredential{}).Where("credential_id = ?", credentialID).Take(&credential).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &WebAuthnCredential{}, errors.New("Passkey Not Found")
+	}
+	if err != nil {
+		return &WebAuthnCredential{}, err
+	}
+	return &credential, nil
+}
+
+//Remove one of the user's passkeys, logging in with the password still works
+func DeleteWebAuthnCredential(ctx context.Context, db *gorm.DB, uid uint32, id uint64) error {
+	db = database.WithContext(ctx, db)
+
+	deleted := db.Debug().Where("id = ? and user_id = ?", id, uid).Delete(&WebAuthnCredential{})
+	if deleted.Error != nil {
+		return deleted.Error
+	}
+	if deleted.RowsAffected == 0 {
+		return errors.New("Passkey Not Found")
+	}
+	return nil
+}
+
+//Record a login with the passkey, a sign count that didn't go up means the key was copied
+func (c *WebAuthnCredential) RecordUse(ctx context.Context, db *gorm.DB, signCount uint32) error {
+	db = database.WithContext(ctx, db)
+
+	if !webauthn.SignCountAdvanced(c.SignCount, signCount) {
+		return ErrPasskeyCloned
+	}
+	now := time.Now()
+	//Only from the count read, two logins racing with the same count can't both pass
+	update := db.Debug().Model(&WebAuthnCredential{}).Where("id = ? and sign_count = ?", c.ID, c.SignCount).UpdateColumns(
+		map[string]interface{}{
+			"sign_count":   signCount,
+			"last_used_at": now,
+		},
+	)
+	if update.Error != nil {
+		return update.Error
+	}
+	if update.RowsAffected == 0 && signCount != 0 {
+		return ErrPasskeyCloned
+	}
+	c.SignCount, c.LastUsedAt = signCount, &now
+	return nil
+}
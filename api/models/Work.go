@@ -1,10 +1,12 @@
 package models
 
 import (
-	"errors"
+	"context"
 	"time"
 
 	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/database"
 )
 
 type Work struct {
@@ -32,22 +34,23 @@ func (w *Work) Prepare() {
 
 func (w *Work) Validate() error {
 	if w.UserID < 1 {
-		return errors.New("Required User ID")
+		return apierror.Invalid("user_id", "Required User ID")
 	}
 	if w.WorkerID < 1 {
-		return errors.New("Required Worker ID")
+		return apierror.Invalid("worker_id", "Required Worker ID")
 	}
 	if w.PostID < 1 {
-		return errors.New("Required Post ID")
+		return apierror.Invalid("post_id", "Required Post ID")
 	}
 	if w.Status == "" {
-		return errors.New("Required Status")
+		return apierror.Invalid("status", "Required Status")
 	}
 	return nil
 }
 
 //Upload a new work
-func (w *Work) UploadWork(db *gorm.DB) (*Work, error) {
+func (w *Work) UploadWork(ctx context.Context, db *gorm.DB) (*Work, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 	err = db.Debug().Model(&Work{}).Create(&w).Error
 	if err != nil {
@@ -75,7 +78,8 @@ func (w *Work) UploadWork(db *gorm.DB) (*Work, error) {
 }
 
 //Get work for a particular post.
-func (w *Work) FindWorkByID(db *gorm.DB, pid uint64) (*Work, error) {
+func (w *Work) FindWorkByID(ctx context.Context, db *gorm.DB, pid uint64) (*Work, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 
 	err = db.Debug().Model(&Work{}).Where("post_id = ?", pid).Take(&w).Error
@@ -104,7 +108,8 @@ func (w *Work) FindWorkByID(db *gorm.DB, pid uint64) (*Work, error) {
 }
 
 //Update an existing work
-func (w *Work) UpdateWork(db *gorm.DB) (*Work, error) {
+func (w *Work) UpdateWork(ctx context.Context, db *gorm.DB) (*Work, error) {
+	db = database.WithContext(ctx, db)
 
 	var err error
 
@@ -134,7 +139,8 @@ func (w *Work) UpdateWork(db *gorm.DB) (*Work, error) {
 }
 
 //Find work based on user id
-func (w *Work) FindUserWorks(db *gorm.DB, pid uint64) (*[]Work, error) {
+func (w *Work) FindUserWorks(ctx context.Context, db *gorm.DB, pid uint64) (*[]Work, error) {
+	db = database.WithContext(ctx, db)
 	var err error
 
 	work := []Work{}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/geo"
+)
+
+//Largest service radius a provider can set
+const MaxServiceRadius = 500.0
+
+//Service radius of providers who haven't set one, DEFAULT_SERVICE_RADIUS_KM in the environment
+func DefaultServiceRadius() float64 {
+	radius, err := strconv.ParseFloat(os.Getenv("DEFAULT_SERVICE_RADIUS_KM"), 64)
+	if err != nil || radius <= 0 {
+		return 25
+	}
+	return radius
+}
+
+//Box holding every point the provider reaches, the searches from anywhere else never return them
+func (u *User) ServiceArea() geo.Box {
+	radius := u.ServiceRadius
+	if radius <= 0 {
+		radius = DefaultServiceRadius()
+	}
+	return geo.BoundingBox(geo.Point{Latitude: float64(u.Latitude), Longitude: float64(u.Longitude)}, radius)
+}
+
+//Users with only their location and service radius loaded, deleted ones included, see ServiceArea
+func FindServiceAreas(ctx context.Context, db *gorm.DB, uids []uint32) ([]User, error) {
+	db = database.WithContext(ctx, db)
+
+	users := []User{}
+	if len(uids) == 0 {
+		return users, nil
+	}
+	err := db.Debug().Unscoped().Model(&User{}).Select("id, latitude, longitude, service_radius").Where("id in (?)", uids).Find(&users).Error
+	return users, err
+}
+
+//SQL computing the distance in km from a point to the given columns, takes latitude, latitude and longitude as arguments
+func distanceSQL(latColumn, lngColumn string) string {
+	return fmt.Sprintf("(2 * %f * ASIN(SQRT(POWER(SIN(RADIANS(%s - ?) / 2), 2) + COS(RADIANS(?)) * COS(RADIANS(%s)) * POWER(SIN(RADIANS(%s - ?) / 2), 2))))",
+		geo.EarthRadiusKm, latColumn, latColumn, lngColumn)
+}
+
+//Distance from a point to a provider's base location
+var providerDistance = sqlClause(distanceSQL("latitude", "longitude"))
+
+//Where to look for providers who may reach a point, covers the longest service radius a provider can have
+func providerSearchBox(center geo.Point, radiusKm float64) geo.Box {
+	reach := math.Max(MaxServiceRadius, DefaultServiceRadius())
+	if radiusKm > 0 && radiusKm < reach {
+		reach = radiusKm
+	}
+	return geo.BoundingBox(center, reach)
+}
+
+//Narrows the search to the box so the latitude and longitude columns can be used before the exact distance
+func withinBox(search *searchBuilder, box geo.Box) {
+	search.where("latitude BETWEEN ? AND ?", box.MinLatitude, box.MaxLatitude)
+	if box.CrossesAntimeridian() {
+		search.where("longitude >= ? OR longitude <= ?", box.MinLongitude, box.MaxLongitude)
+		return
+	}
+	search.where("longitude BETWEEN ? AND ?", box.MinLongitude, box.MaxLongitude)
+}
+
+//Size in km of the area the public location of a user is blurred to, PUBLIC_LOCATION_PRECISION_KM in the environment, 0 shows exact locations
+func PublicLocationPrecision() float64 {
+	precision, err := strconv.ParseFloat(os.Getenv("PUBLIC_LOCATION_PRECISION_KM"), 64)
+	if err != nil || precision < 0 {
+		return 1
+	}
+	return precision
+}
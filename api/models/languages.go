@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//Most languages a user can list
+const MaxLanguages = 10
+
+//ISO 639-1 codes, and ISO 639-3 codes of languages spoken in the region that have no two letter code
+var languageCodes = map[string]bool{}
+
+func init() {
+	for _, code := range strings.Fields(`
+		aa ab ae af ak am an ar as av ay az ba be bg bi bm bn bo br bs ca ce ch co cr cs cu cv cy
+		da de dv dz ee el en eo es et eu fa ff fi fj fo fr fy ga gd gl gn gu gv ha he hi ho hr ht
+		hu hy hz ia id ie ig ii ik io is it iu ja jv ka kg ki kj kk kl km kn ko kr ks ku kv kw ky
+		la lb lg li ln lo lt lu lv mg mh mi mk ml mn mr ms mt my na nb nd ne ng nl nn no nr nv ny
+		oc oj om or os pa pi pl ps pt qu rm rn ro ru rw sa sc sd se sg si sk sl sm sn so sq sr ss
+		st su sv sw ta te tg th ti tk tl tn to tr ts tt tw ty ug uk ur uz ve vi vo wa wo xh yi yo
+		za zh zu
+		luo luy kln kam mer guz ebu dav saq teo mas kde`) {
+		languageCodes[code] = true
+	}
+}
+
+func ValidLanguage(code string) bool {
+	return languageCodes[code]
+}
+
+//Languages a user speaks as ISO 639 codes, stored comma separated
+type Languages []string
+
+func (l Languages) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+func (l *Languages) Scan(value interface{}) error {
+	var stored string
+	switch raw := value.(type) {
+	case nil:
+	case []byte:
+		stored = string(raw)
+	case string:
+		stored = raw
+	default:
+		return fmt.Errorf("Cannot read languages from %T", value)
+	}
+	*l = Languages{}
+	if stored != "" {
+		*l = strings.Split(stored, ",")
+	}
+	return nil
+}
+
+//Lower cased, without repeats and sorted, an error for codes that aren't ISO 639
+func (l Languages) normalize() (Languages, error) {
+	normalized := Languages{}
+	seen := map[string]bool{}
+	for _, code := range l {
+		code = strings.ToLower(strings.TrimSpace(code))
+		if !ValidLanguage(code) {
+			return l, errors.New("Invalid Language")
+		}
+		if !seen[code] {
+			seen[code] = true
+			normalized = append(normalized, code)
+		}
+	}
+	if len(normalized) > MaxLanguages {
+		return l, errors.New("Too Many Languages")
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+//Languages of a search query, a comma separated list, e.g. sw,en
+func ParseLanguages(list string) (Languages, error) {
+	languages := Languages{}
+	for _, code := range strings.Split(list, ",") {
+		if strings.TrimSpace(code) != "" {
+			languages = append(languages, code)
+		}
+	}
+	return languages.normalize()
+}
+
+//Narrows the search to users who speak any of the languages, in the same SQL for up to MaxLanguages of them
+func withLanguages(search *searchBuilder, languages Languages) {
+	search.anyOf("FIND_IN_SET(?, languages) > 0", languages, MaxLanguages)
+}
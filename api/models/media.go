@@ -0,0 +1,60 @@
+package models
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/storage"
+)
+
+//Records pointing at uploaded files, by the URL of public files or the key of private ones
+type MediaReferences struct {
+	DB *gorm.DB
+}
+
+func (m *MediaReferences) Referenced(ctx context.Context, keys []string) (map[string]bool, error) {
+	db := database.WithContext(ctx, m.DB)
+	referenced := map[string]bool{}
+	if len(keys) == 0 {
+		return referenced, nil
+	}
+
+	//Records of public files store the address of the bucket in front of the key
+	config := storage.S3Settings()
+	urls := []string{}
+	for _, key := range keys {
+		urls = append(urls, config.URL(key))
+	}
+	columns := []struct {
+		Model  interface{}
+		Column string
+		Values []string
+	}{
+		{&User{}, "image_url", urls},
+		{&User{}, "thumbnail_url", urls},
+		{&User{}, "medium_url", urls},
+		{&Post{}, "image_url", urls},
+		{&GalleryItem{}, "image_url", urls},
+		{&DisputeEvidence{}, "file_url", urls},
+		{&DisputeEvidence{}, "file_key", keys},
+		{&Upload{}, "`key`", keys}, //Resumable uploads not yet processed
+	}
+	for _, column := range columns {
+		found := []string{}
+		err := db.Debug().Model(column.Model).Where(column.Column+" IN (?)", column.Values).Pluck(column.Column, &found).Error
+		if err != nil {
+			return referenced, err
+		}
+		for _, value := range found {
+			referenced[strings.TrimPrefix(value, config.BaseURL)] = true
+		}
+	}
+	return referenced, nil
+}
+
+//Keeps the upload records of deleted files, marking them deleted
+func (m *MediaReferences) Deleted(ctx context.Context, keys []string) error {
+	return MarkStoredObjectsDeleted(ctx, m.DB, keys)
+}
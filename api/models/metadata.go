@@ -0,0 +1,287 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+//Types a custom profile field can have
+const (
+	MetadataString     = "string"
+	MetadataNumber     = "number"
+	MetadataInteger    = "integer"
+	MetadataBoolean    = "boolean"
+	MetadataStringList = "string_list"
+)
+
+//Most items a list field can have
+const maxMetadataListItems = 20
+
+var metadataKey = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+//A custom profile field of the deployment, such as years of experience
+type MetadataField struct {
+	Type       string   `json:"type"`
+	Enum       []string `json:"enum,omitempty"` //Allowed values of strings and string lists
+	Min        *float64 `json:"min,omitempty"`  //Bounds of numbers and integers
+	Max        *float64 `json:"max,omitempty"`
+	MaxLength  int      `json:"max_length,omitempty"` //Of strings and each item of a list, 255 by default
+	Searchable bool     `json:"searchable,omitempty"` //Whether provider searches can filter on it
+}
+
+//Custom profile fields by key, USER_METADATA_SCHEMA in the environment as a JSON object, e.g.
+//{"years_experience": {"type": "integer", "min": 0, "max": 60, "searchable": true}}.
+//Read on every use so a reload changes it.
+func MetadataSchema() (map[string]MetadataField, error) {
+	schema := map[string]MetadataField{}
+	configured := strings.TrimSpace(os.Getenv("USER_METADATA_SCHEMA"))
+	if configured == "" {
+		return schema, nil
+	}
+	err := json.Unmarshal([]byte(configured), &schema)
+	if err != nil {
+		return map[string]MetadataField{}, fmt.Errorf("Invalid USER_METADATA_SCHEMA: %v", err)
+	}
+	for key, field := range schema {
+		if !metadataKey.MatchString(key) {
+			return map[string]MetadataField{}, fmt.Errorf("Invalid USER_METADATA_SCHEMA: bad key %q", key)
+		}
+		switch field.Type {
+		case MetadataString, MetadataNumber, MetadataInteger, MetadataBoolean, MetadataStringList:
+		default:
+			return map[string]MetadataField{}, fmt.Errorf("Invalid USER_METADATA_SCHEMA: unknown type %q of %s", field.Type, key)
+		}
+	}
+	return schema, nil
+}
+
+//The schema, with no fields when it is invalid. The error is logged at start up and on reload.
+func metadataSchema() map[string]MetadataField {
+	schema, _ := MetadataSchema()
+	return schema
+}
+
+//Values of the deployment's custom profile fields, stored as a JSON column
+type Metadata map[string]interface{}
+
+func (m Metadata) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	raw, err := json.Marshal(m)
+	return string(raw), err
+}
+
+func (m *Metadata) Scan(value interface{}) error {
+	*m = Metadata{}
+	switch raw := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(raw, m)
+	case string:
+		return json.Unmarshal([]byte(raw), m)
+	}
+	return fmt.Errorf("Cannot read metadata from %T", value)
+}
+
+//Checks the values against the schema, dropping the null ones so a patch can remove a field
+func (m Metadata) validate() error {
+	if len(m) == 0 {
+		return nil
+	}
+	schema := metadataSchema()
+	for key, value := range m {
+		if value == nil {
+			delete(m, key)
+			continue
+		}
+		field, ok := schema[key]
+		if !ok {
+			return fmt.Errorf("Unknown Metadata Field %s", key)
+		}
+		normalized, err := field.check(value)
+		if err != nil {
+			return fmt.Errorf("Invalid Metadata Field %s", key)
+		}
+		m[key] = normalized
+	}
+	return nil
+}
+
+//The value as the field's type, an error when it isn't one
+func (f MetadataField) check(value interface{}) (interface{}, error) {
+	maxLength := f.MaxLength
+	if maxLength <= 0 {
+		maxLength = 255
+	}
+	checkString := func(value interface{}) (string, error) {
+		text, ok := value.(string)
+		text = strings.TrimSpace(text)
+		if !ok || text == "" || len([]rune(text)) > maxLength {
+			return "", errors.New("Invalid String")
+		}
+		if len(f.Enum) > 0 && !containsString(f.Enum, text) {
+			return "", errors.New("Not Allowed")
+		}
+		return text, nil
+	}
+
+	switch f.Type {
+	case MetadataString:
+		return checkString(value)
+	case MetadataNumber, MetadataInteger:
+		number, ok := value.(float64)
+		if !ok || math.IsNaN(number) || math.IsInf(number, 0) {
+			return nil, errors.New("Invalid Number")
+		}
+		if f.Type == MetadataInteger && number != math.Trunc(number) {
+			return nil, errors.New("Invalid Integer")
+		}
+		if (f.Min != nil && number < *f.Min) || (f.Max != nil && number > *f.Max) {
+			return nil, errors.New("Out Of Range")
+		}
+		return number, nil
+	case MetadataBoolean:
+		if _, ok := value.(bool); !ok {
+			return nil, errors.New("Invalid Boolean")
+		}
+		return value, nil
+	case MetadataStringList:
+		items, ok := value.([]interface{})
+		if !ok || len(items) > maxMetadataListItems {
+			return nil, errors.New("Invalid List")
+		}
+		list := []string{}
+		for _, item := range items {
+			text, err := checkString(item)
+			if err != nil {
+				return nil, err
+			}
+			if !containsString(list, text) {
+				list = append(list, text)
+			}
+		}
+		sort.Strings(list)
+		return list, nil
+	}
+	return nil, errors.New("Unknown Type")
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+//Filter of provider searches on a searchable custom field. Strings and booleans match the value, lists
+//match when they contain it and numbers are bounded by Min and Max.
+type MetadataFilter struct {
+	Key   string
+	Value string
+	Min   *float64
+	Max   *float64
+}
+
+//Filters from the search query, meta.<key>=value, meta.<key>.min= and meta.<key>.max=. Only searchable
+//fields of the schema are accepted.
+func ParseMetadataFilters(query map[string][]string) ([]MetadataFilter, error) {
+	schema := metadataSchema()
+	byKey := map[string]*MetadataFilter{}
+	keys := []string{}
+	for name, values := range query {
+		if !strings.HasPrefix(name, "meta.") || len(values) == 0 {
+			continue
+		}
+		key, bound := strings.TrimPrefix(name, "meta."), ""
+		if dot := strings.IndexByte(key, '.'); dot >= 0 {
+			key, bound = key[:dot], key[dot+1:]
+		}
+		field, ok := schema[key]
+		if !ok || !field.Searchable {
+			return nil, fmt.Errorf("Cannot Filter On %s", key)
+		}
+		value := strings.TrimSpace(values[0])
+		if value == "" {
+			continue
+		}
+		filter, ok := byKey[key]
+		if !ok {
+			filter = &MetadataFilter{Key: key}
+			byKey[key] = filter
+			keys = append(keys, key)
+		}
+
+		numeric := field.Type == MetadataNumber || field.Type == MetadataInteger
+		switch {
+		case bound == "" && !numeric:
+			filter.Value = value
+		case bound == "" || bound == "min" || bound == "max":
+			if !numeric {
+				return nil, fmt.Errorf("Cannot Filter On %s", name)
+			}
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid Filter %s", name)
+			}
+			//A number on its own is matched as both bounds
+			if bound != "max" {
+				filter.Min = &number
+			}
+			if bound != "min" {
+				filter.Max = &number
+			}
+		default:
+			return nil, fmt.Errorf("Cannot Filter On %s", name)
+		}
+	}
+
+	//Same order every time, so the same query builds the same SQL
+	sort.Strings(keys)
+	filters := []MetadataFilter{}
+	for _, key := range keys {
+		filters = append(filters, *byKey[key])
+	}
+	return filters, nil
+}
+
+//Narrows the search to users whose custom fields match the filters, which are kept in user_profiles.
+//Keys are checked against the schema by ParseMetadataFilters and passed as values all the same.
+func withMetadata(db *gorm.DB, search *searchBuilder, filters []MetadataFilter) {
+	if len(filters) == 0 {
+		return
+	}
+	profiles := &searchBuilder{}
+	schema := metadataSchema()
+	for _, filter := range filters {
+		path := "$." + filter.Key
+		switch schema[filter.Key].Type {
+		case MetadataStringList:
+			profiles.where("JSON_CONTAINS(metadata, JSON_QUOTE(?), ?)", filter.Value, path)
+		case MetadataNumber, MetadataInteger:
+			if filter.Min != nil {
+				profiles.where("JSON_EXTRACT(metadata, ?) >= ?", path, *filter.Min)
+			}
+			if filter.Max != nil {
+				profiles.where("JSON_EXTRACT(metadata, ?) <= ?", path, *filter.Max)
+			}
+		default:
+			//Booleans unquote to true and false
+			profiles.where("JSON_UNQUOTE(JSON_EXTRACT(metadata, ?)) = ?", path, filter.Value)
+		}
+	}
+	search.where("id IN (?)", profiles.apply(db.Model(&UserProfile{}).Select("user_id")).QueryExpr())
+}
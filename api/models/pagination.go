@@ -0,0 +1,78 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+//Page size when none is asked for, and the largest allowed
+const (
+	DefaultPerPage = 20
+	MaxPerPage     = 100
+)
+
+var ErrInvalidCursor = errors.New("Invalid Cursor")
+
+//Page asked for by a client, either by number or by the cursor returned with the previous page
+type PageRequest struct {
+	Page    int
+	PerPage int
+	Cursor  string
+}
+
+//Where a page sits in the whole list, NextCursor is empty on the last page
+type PageInfo struct {
+	Total      int    `json:"total"`
+	Page       int    `json:"page,omitempty"`
+	PerPage    int    `json:"per_page"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+//Fills in the defaults and caps the page size
+func (p *PageRequest) normalize() {
+	if p.PerPage <= 0 {
+		p.PerPage = DefaultPerPage
+	}
+	if p.PerPage > MaxPerPage {
+		p.PerPage = MaxPerPage
+	}
+	if p.Page <= 0 {
+		p.Page = 1
+	}
+}
+
+//Cursors point after the last row of a page in created_at desc, id desc order. They stay
+//right when rows are added while a client pages through, unlike page numbers.
+func encodeCursor(createdAt time.Time, id uint32) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d", createdAt.Unix(), id)))
+}
+
+func decodeCursor(cursor string) (time.Time, uint32, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	var seconds int64
+	var id uint32
+	_, err = fmt.Sscanf(string(raw), "%d.%d", &seconds, &id)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return time.Unix(seconds, 0), id, nil
+}
+
+//Limits a query ordered by created_at desc, id desc to the page, fetching one row more to tell whether another page follows
+func (p *PageRequest) apply(query *gorm.DB) (*gorm.DB, error) {
+	if p.Cursor == "" {
+		return query.Offset((p.Page - 1) * p.PerPage).Limit(p.PerPage + 1), nil
+	}
+	createdAt, id, err := decodeCursor(p.Cursor)
+	if err != nil {
+		return query, err
+	}
+	return query.Where("created_at < ? or (created_at = ? and id < ?)", createdAt, createdAt, id).Limit(p.PerPage + 1), nil
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/victorkabata/FixIt-API/api/passwords"
+)
+
+//Returned for new passwords that don't meet the policy, Message says why
+type WeakPasswordError struct {
+	Message string
+}
+
+func (e *WeakPasswordError) Error() string {
+	return e.Message
+}
+
+//Shortest password allowed, MIN_PASSWORD_LENGTH in the environment
+func MinPasswordLength() int {
+	length, err := strconv.Atoi(os.Getenv("MIN_PASSWORD_LENGTH"))
+	if err != nil || length < 6 {
+		return 8
+	}
+	return length
+}
+
+//Passwords tried first when guessing
+var commonPasswords = map[string]bool{
+	"password": true, "password1": true, "password123": true, "passw0rd": true, "12345678": true,
+	"123456789": true, "1234567890": true, "qwerty123": true, "qwertyuiop": true, "iloveyou": true,
+	"11111111": true, "abc12345": true, "letmein1": true, "welcome1": true, "fixit123": true,
+}
+
+//What new passwords must meet, read from the environment on every use
+type PasswordPolicy struct {
+	MinLength int
+	//Kinds of characters, of letters, digits and symbols, needed unless the password is a passphrase
+	MinClasses int
+	//Length from which a password counts as a passphrase, PASSWORD_PASSPHRASE_LENGTH
+	PassphraseLength int
+	//Lowest strength score from 0 to 4 allowed, 0 checks nothing, PASSWORD_MIN_SCORE
+	MinScore int
+	//Whether passwords are looked up in Have I Been Pwned, PASSWORD_BREACH_CHECK
+	BreachCheck bool
+}
+
+func envIntRange(key string, fallback, min, max int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < min || value > max {
+		return fallback
+	}
+	return value
+}
+
+func CurrentPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:        MinPasswordLength(),
+		MinClasses:       envIntRange("PASSWORD_MIN_CLASSES", 2, 1, 3),
+		PassphraseLength: envIntRange("PASSWORD_PASSPHRASE_LENGTH", 16, 0, 72),
+		MinScore:         envIntRange("PASSWORD_MIN_SCORE", 2, 0, 4),
+		BreachCheck:      os.Getenv("PASSWORD_BREACH_CHECK") == "true",
+	}
+}
+
+//Checks a new password of the user against the policy: long enough, not common, mixing enough kinds of
+//characters unless it is a long passphrase, not made from the username or email and hard enough to guess.
+//Needs no network, see ValidatePassword for the breach check.
+func checkPasswordPolicy(password string, u *User) error {
+	policy := CurrentPasswordPolicy()
+	if len(password) < policy.MinLength {
+		return &WeakPasswordError{Message: "Password Must Have At Least " + strconv.Itoa(policy.MinLength) + " Characters"}
+	}
+	//bcrypt ignores what comes after 72 bytes
+	if len(password) > 72 {
+		return &WeakPasswordError{Message: "Password Too Long"}
+	}
+	lower := strings.ToLower(password)
+	if commonPasswords[lower] {
+		return &WeakPasswordError{Message: "Password Too Common"}
+	}
+
+	var letters, digits, others bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letters = true
+		case unicode.IsDigit(r):
+			digits = true
+		default:
+			others = true
+		}
+	}
+	kinds := 0
+	for _, kind := range []bool{letters, digits, others} {
+		if kind {
+			kinds++
+		}
+	}
+	passphrase := policy.PassphraseLength > 0 && len(password) >= policy.PassphraseLength
+	if kinds < policy.MinClasses && !passphrase {
+		if policy.MinClasses == 3 {
+			return &WeakPasswordError{Message: "Password Needs Letters, Numbers And Symbols, Or " + strconv.Itoa(policy.PassphraseLength) + " Characters"}
+		}
+		return &WeakPasswordError{Message: "Password Needs Letters And Numbers Or Symbols, Or " + strconv.Itoa(policy.PassphraseLength) + " Characters"}
+	}
+
+	personal := []string{u.Username, u.Email[:strings.Index(u.Email+"@", "@")]}
+	for _, detail := range personal {
+		detail = strings.ToLower(detail)
+		if len(detail) >= 4 && strings.Contains(lower, detail) {
+			return &WeakPasswordError{Message: "Password Must Not Contain Your Username Or Email"}
+		}
+	}
+	if passwords.Score(password, personal...) < policy.MinScore {
+		return &WeakPasswordError{Message: "Password Too Easy To Guess"}
+	}
+	return nil
+}
+
+//Checks a new password against the policy and, when PASSWORD_BREACH_CHECK is on, against the passwords
+//of known breaches. A breach check that fails is logged and skipped rather than blocking the user.
+func ValidatePassword(ctx context.Context, password string, u *User) error {
+	err := checkPasswordPolicy(password, u)
+	if err != nil {
+		return err
+	}
+	return CheckPasswordBreach(ctx, password)
+}
+
+//Looks the password up in the breaches when PASSWORD_BREACH_CHECK is on, for new accounts whose
+//password Validate already checked against the policy
+func CheckPasswordBreach(ctx context.Context, password string) error {
+	if !CurrentPasswordPolicy().BreachCheck {
+		return nil
+	}
+	count, err := passwords.Breached(ctx, password)
+	if err != nil {
+		log.Printf("Checking a password against breaches failed: %v", err)
+		return nil
+	}
+	if count > 0 {
+		return &WeakPasswordError{Message: "Password Found In A Data Breach"}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"os"
+	"strings"
+
+	"github.com/victorkabata/FixIt-API/api/apierror"
+	"github.com/victorkabata/FixIt-API/api/auth"
+)
+
+//Profile fields a deployment can require, and the error for a profile missing one
+var requirableFields = map[string]struct {
+	missing func(u *User) bool
+	err     error
+}{
+	"phone":          {func(u *User) bool { return !u.HasPhone() }, apierror.Invalid("phone_number", "Required Phone Number")},
+	"specialisation": {func(u *User) bool { return u.Specialisation == "" }, apierror.Invalid("specialisation", "Required Specialisation")},
+	"address":        {func(u *User) bool { return u.Address == "" }, apierror.Invalid("address", "Required Address")},
+	"region":         {func(u *User) bool { return u.Region == "" }, apierror.Invalid("region", "Required Region")},
+	"country":        {func(u *User) bool { return u.Country == "" }, apierror.Invalid("country", "Required Country")},
+	"coordinates":    {func(u *User) bool { return u.Latitude == 0 && u.Longitude == 0 }, apierror.Invalid("coordinates", "Required Location")},
+}
+
+//Checked in this order, so the same profile always gets the same error
+var requirableOrder = []string{"phone", "specialisation", "address", "region", "country", "coordinates"}
+
+//What each role needs when nothing is configured
+var defaultRequiredFields = map[string]string{
+	auth.RoleCustomer: "phone",
+	auth.RoleProvider: "phone,specialisation",
+	auth.RoleAdmin:    "phone",
+}
+
+//Fields profiles of the role need, REQUIRED_FIELDS_<ROLE> in the environment as a comma separated
+//list. Read on every use, so a reload changes them. Unknown names are ignored.
+func RequiredFields(role string) []string {
+	if !auth.ValidRole(role) {
+		role = auth.RoleCustomer
+	}
+	configured, ok := os.LookupEnv("REQUIRED_FIELDS_" + strings.ToUpper(role))
+	if !ok {
+		configured = defaultRequiredFields[role]
+	}
+	wanted := map[string]bool{}
+	for _, field := range strings.Split(configured, ",") {
+		wanted[strings.ToLower(strings.TrimSpace(field))] = true
+	}
+	fields := []string{}
+	for _, field := range requirableOrder {
+		if wanted[field] {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+//The first field the user's role requires that the profile is missing
+func (u *User) checkRequiredFields() error {
+	for _, field := range RequiredFields(u.Role) {
+		if rule := requirableFields[field]; rule.missing(u) {
+			return rule.err
+		}
+	}
+	return nil
+}
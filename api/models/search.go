@@ -0,0 +1,75 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/jinzhu/gorm"
+)
+
+//Piece of SQL a search is built from. Only constants convert to it without a cast, so text read from a
+//request can't become SQL by mistake, it has to go in as a value behind a placeholder.
+type sqlClause string
+
+//Conditions of a search, joined with AND. The SQL depends only on which filters are used and never on
+//their values, so MySQL prepares each shape once and reuses its plan.
+type searchBuilder struct {
+	clauses []string
+	values  []interface{}
+}
+
+//Adds a condition with a placeholder for each of the values
+func (b *searchBuilder) where(clause sqlClause, values ...interface{}) *searchBuilder {
+	b.clauses = append(b.clauses, "("+string(clause)+")")
+	b.values = append(b.values, values...)
+	return b
+}
+
+//Wildcards of LIKE, matched as themselves in text searched for
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+//The column contains the text
+func (b *searchBuilder) contains(column sqlClause, text string) *searchBuilder {
+	return b.where(column+" LIKE ?", "%"+likeEscaper.Replace(text)+"%")
+}
+
+//The words of the text as a boolean mode full text search, where each has to start a word of the columns.
+//Anything else is dropped, so operators of the search can't be sent. Empty when there are no words.
+func fullTextWords(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = "+" + word + "*"
+	}
+	return strings.Join(words, " ")
+}
+
+//The condition holds for any of the values. It is repeated size times, the last value filling the rest,
+//so any number of values up to size gives the same SQL.
+func (b *searchBuilder) anyOf(clause sqlClause, values []string, size int) *searchBuilder {
+	if len(values) == 0 {
+		return b
+	}
+	if len(values) > size {
+		size = len(values)
+	}
+	clauses := make([]string, size)
+	padded := make([]interface{}, size)
+	for i := range clauses {
+		clauses[i] = string(clause)
+		padded[i] = values[len(values)-1]
+		if i < len(values) {
+			padded[i] = values[i]
+		}
+	}
+	return b.where(sqlClause(strings.Join(clauses, " OR ")), padded...)
+}
+
+//The query narrowed by the conditions
+func (b *searchBuilder) apply(query *gorm.DB) *gorm.DB {
+	if len(b.clauses) == 0 {
+		return query
+	}
+	return query.Where(strings.Join(b.clauses, " AND "), b.values...)
+}
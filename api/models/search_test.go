@@ -0,0 +1,109 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSearchBuilderClauses(t *testing.T) {
+	tests := []struct {
+		name        string
+		build       func(b *searchBuilder)
+		wantClauses []string
+		wantValues  []interface{}
+	}{
+		{"nothing", func(b *searchBuilder) {}, nil, nil},
+		{
+			"conditions in order",
+			func(b *searchBuilder) {
+				b.where("region = ?", "Nairobi").where("role = ? and verified = ?", "provider", true)
+			},
+			[]string{"(region = ?)", "(role = ? and verified = ?)"},
+			[]interface{}{"Nairobi", "provider", true},
+		},
+		{
+			"contains",
+			func(b *searchBuilder) { b.contains("username", "john") },
+			[]string{"(username LIKE ?)"},
+			[]interface{}{"%john%"},
+		},
+		{
+			"contains escapes wildcards",
+			func(b *searchBuilder) { b.contains("username", `50%_off\`) },
+			[]string{"(username LIKE ?)"},
+			[]interface{}{`%50\%\_off\\%`},
+		},
+		{
+			"empty anyOf adds nothing",
+			func(b *searchBuilder) { b.where("role = ?", "provider").anyOf("country = ?", nil, 4) },
+			[]string{"(role = ?)"},
+			[]interface{}{"provider"},
+		},
+		{
+			"anyOf padded with the last value",
+			func(b *searchBuilder) { b.anyOf("country = ?", []string{"KE", "UG"}, 4) },
+			[]string{"(country = ? OR country = ? OR country = ? OR country = ?)"},
+			[]interface{}{"KE", "UG", "UG", "UG"},
+		},
+		{
+			"anyOf past its size",
+			func(b *searchBuilder) { b.anyOf("country = ?", []string{"KE", "UG", "TZ"}, 2) },
+			[]string{"(country = ? OR country = ? OR country = ?)"},
+			[]interface{}{"KE", "UG", "TZ"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := &searchBuilder{}
+			test.build(b)
+			if !reflect.DeepEqual(b.clauses, test.wantClauses) {
+				t.Errorf("clauses = %q, want %q", b.clauses, test.wantClauses)
+			}
+			if !reflect.DeepEqual(b.values, test.wantValues) {
+				t.Errorf("values = %#v, want %#v", b.values, test.wantValues)
+			}
+			if placeholders := strings.Count(strings.Join(b.clauses, ""), "?"); placeholders != len(b.values) {
+				t.Errorf("%d placeholders for %d values", placeholders, len(b.values))
+			}
+		})
+	}
+}
+
+//The SQL of a search is the same whatever the values, as long as the same filters are used
+func TestSearchBuilderShapeIgnoresValues(t *testing.T) {
+	build := func(text string, countries []string) string {
+		b := &searchBuilder{}
+		b.contains("username", text).anyOf("country = ?", countries, 3)
+		return strings.Join(b.clauses, " AND ")
+	}
+	first := build("a", []string{"KE"})
+	for _, other := range []string{build("x' OR 1=1 --", []string{"KE", "UG"}), build("%", []string{"KE", "UG", "TZ"})} {
+		if other != first {
+			t.Errorf("SQL = %q, want %q", other, first)
+		}
+	}
+}
+
+func TestFullTextWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"john", "+john*"},
+		{"john  plumber", "+john* +plumber*"},
+		{"+john -plumber", "+john* +plumber*"},
+		{`"exact phrase"`, "+exact* +phrase*"},
+		{"jo* (a OR b) ~c <d >e @3", "+jo* +a* +OR* +b* +c* +d* +e* +3*"},
+		{"o'brien", "+o* +brien*"},
+		{"+-*~<>()\"@", ""},
+		{"Nairobi2 Ñandú", "+Nairobi2* +Ñandú*"},
+	}
+	for _, test := range tests {
+		if got := fullTextWords(test.text); got != test.want {
+			t.Errorf("fullTextWords(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
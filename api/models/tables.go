@@ -0,0 +1,6 @@
+package models
+
+//Every model with a table, in the order they are migrated
+func Tables() []interface{} {
+	return []interface{}{&User{}, &Post{}, &Booking{}, &Work{}, &Review{}, &Transaction{}, &DeepLink{}, &DeepLinkOpen{}, &Device{}, &RecoveryCode{}, &SecurityChange{}, &GalleryItem{}, &ServiceOffering{}, &Notification{}, &Quote{}, &Payment{}, &PayoutAccount{}, &Dispute{}, &DisputeEvidence{}, &DisputeEvent{}, &CalendarFeed{}, &ReviewRequest{}, &ReviewEdit{}, &RiskAssessment{}, &LoginCode{}, &PasswordReset{}, &Identity{}, &IdentityLink{}, &VerificationAttempt{}, &Upload{}, &UploadPart{}, &StoredObject{}, &EmailSuppression{}, &OutboundEmail{}, &Announcement{}, &RevokedToken{}, &DataExport{}, &MarketingConsent{}, &ProviderVerification{}, &AvailabilitySlot{}, &PhoneCode{}, &ProviderStats{}, &WebAuthnCredential{}, &WebAuthnChallenge{}, &Session{}, &UserProfile{}, &AdminAction{}}
+}
@@ -0,0 +1,106 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"html"
+	"log"
+
+	"github.com/jinzhu/gorm"
+	"github.com/victorkabata/FixIt-API/api/mailer"
+	"github.com/victorkabata/FixIt-API/api/models"
+	"github.com/victorkabata/FixIt-API/api/templates"
+)
+
+//Message for a user, delivered to the in-app inbox and by email
+type Notice struct {
+	Kind      string                 //Also the template the title and body are rendered from
+	Data      map[string]interface{} //Fields the template uses
+	Digest    bool                   //Low priority, emailed in the user's digest instead of right away
+	Marketing bool                   //Promotional, only delivered to users who opted in to marketing
+}
+
+//Returned by Send for marketing notices to users who didn't opt in, nothing was delivered
+var ErrNoMarketingConsent = errors.New("No Marketing Consent")
+
+//Store the notice in the user's inbox and email it, both in the user's locale. Email failures are only logged.
+//Digest notices are left for SendDigest, marketing ones need the user's consent.
+func Send(ctx context.Context, db *gorm.DB, uid uint32, notice Notice) error {
+	if notice.Marketing {
+		consented, err := models.HasMarketingConsent(ctx, db, uid)
+		if err != nil {
+			return err
+		}
+		if !consented {
+			return ErrNoMarketingConsent
+		}
+	}
+
+	user := models.User{}
+	recipient, err := user.FindUserByID(ctx, db, uid)
+	if err != nil {
+		//Still kept in the inbox, in the default locale
+		log.Printf("Emailing notification to user %d failed: %v", uid, err)
+		recipient = nil
+	}
+	locale := ""
+	if recipient != nil {
+		locale = recipient.Locale
+	}
+
+	message, err := templates.Render(notice.Kind, locale, notice.Data)
+	if err != nil {
+		return err
+	}
+	notification := models.Notification{
+		UserID:    uid,
+		Kind:      notice.Kind,
+		Title:     message.Subject,
+		Body:      message.Body,
+		Digest:    notice.Digest,
+		Marketing: notice.Marketing,
+	}
+	_, err = notification.SaveNotification(ctx, db)
+	if err != nil {
+		return err
+	}
+	if recipient == nil || notice.Digest {
+		return nil
+	}
+
+	err = Email(ctx, recipient, "notification_email", map[string]interface{}{"Title": message.Subject, "Body": message.Body})
+	if err != nil {
+		log.Printf("Emailing notification to user %d failed: %v", uid, err)
+	}
+	return nil
+}
+
+//Email the user the template rendered in their locale, Username is filled in for the template
+func Email(ctx context.Context, user *models.User, name string, data map[string]interface{}) error {
+	fields := map[string]interface{}{"Username": html.UnescapeString(user.Username)}
+	for key, value := range data {
+		fields[key] = value
+	}
+	message, err := templates.Render(name, user.Locale, fields)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(ctx, mailer.Message{
+		To:      html.UnescapeString(user.Email),
+		Subject: message.Subject,
+		Body:    message.Body,
+	})
+}
+
+//Email the user their waiting digest notifications in one message
+func SendDigest(ctx context.Context, digest models.PendingDigest) error {
+	items := []map[string]string{}
+	for _, notification := range digest.Notifications {
+		items = append(items, map[string]string{"Title": notification.Title, "Body": notification.Body})
+	}
+	return Email(ctx, &digest.User, "digest", map[string]interface{}{
+		"Frequency": digest.User.DigestFrequency,
+		"Items":     items,
+		"More":      digest.Total - len(items),
+	})
+}
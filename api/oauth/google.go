@@ -0,0 +1,271 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/victorkabata/FixIt-API/api/httpclient"
+)
+
+//Name the provider is stored under
+const ProviderGoogle = "google"
+
+const (
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+	googleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+)
+
+var (
+	ErrInvalidToken  = errors.New("Invalid Identity Token")
+	ErrNotConfigured = errors.New("Sign In Provider Not Configured")
+)
+
+//Account a provider vouches for
+type Claims struct {
+	Provider      string
+	Subject       string //Stable ID of the account at the provider
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+//Google sign in, with either an ID token from the app or an authorization code from the web
+type Google struct {
+	ClientIDs    []string //Web, Android and iOS clients, ID tokens for any of them are accepted
+	ClientSecret string   //Secret of the web client, needed to exchange codes
+	TokenURL     string
+	CertsURL     string
+	Client       *http.Client
+
+	mu         sync.Mutex
+	keys       map[string]*rsa.PublicKey
+	keysExpire time.Time
+	keysTried  time.Time
+}
+
+//GOOGLE_CLIENT_IDS and GOOGLE_CLIENT_SECRET from the environment, the first client ID is the web client
+func GoogleFromEnv() *Google {
+	clientIDs := []string{}
+	for _, clientID := range strings.Split(os.Getenv("GOOGLE_CLIENT_IDS"), ",") {
+		if clientID = strings.TrimSpace(clientID); clientID != "" {
+			clientIDs = append(clientIDs, clientID)
+		}
+	}
+	return &Google{
+		ClientIDs:    clientIDs,
+		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+		TokenURL:     googleTokenURL,
+		CertsURL:     googleCertsURL,
+		Client:       httpclient.New("google", 10*time.Second),
+	}
+}
+
+func (g *Google) Configured() bool {
+	return len(g.ClientIDs) > 0
+}
+
+//Trades an authorization code from the consent screen for the account's ID token
+func (g *Google) Exchange(ctx context.Context, code, redirectURI string) (*Claims, error) {
+	if !g.Configured() || g.ClientSecret == "" {
+		return nil, ErrNotConfigured
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("client_id", g.ClientIDs[0])
+	form.Set("client_secret", g.ClientSecret)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, g.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := g.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	//Google answers 400 for codes that are invalid, expired or already used
+	if response.StatusCode == http.StatusBadRequest || response.StatusCode == http.StatusUnauthorized {
+		return nil, ErrInvalidToken
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Google token exchange failed with status %d", response.StatusCode)
+	}
+
+	token := struct {
+		IDToken string `json:"id_token"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&token)
+	if err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, ErrInvalidToken
+	}
+	return g.VerifyIDToken(ctx, token.IDToken)
+}
+
+//Checks the signature, issuer, audience and expiry of an ID token and returns the account in it
+func (g *Google) VerifyIDToken(ctx context.Context, idToken string) (*Claims, error) {
+	if !g.Configured() {
+		return nil, ErrNotConfigured
+	}
+
+	var keyErr error
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, err := g.publicKey(ctx, kid)
+		keyErr = err
+		return key, err
+	})
+	if keyErr != nil && keyErr != ErrInvalidToken {
+		return nil, keyErr
+	}
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	if !claims.VerifyIssuer("accounts.google.com", true) && !claims.VerifyIssuer("https://accounts.google.com", true) {
+		return nil, ErrInvalidToken
+	}
+	audience := false
+	for _, clientID := range g.ClientIDs {
+		audience = audience || claims.VerifyAudience(clientID, true)
+	}
+	if !audience {
+		return nil, ErrInvalidToken
+	}
+
+	result := &Claims{Provider: ProviderGoogle}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	result.Picture, _ = claims["picture"].(string)
+	//Sent as a boolean, older tokens had it as a string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = verified
+	case string:
+		result.EmailVerified, _ = strconv.ParseBool(verified)
+	}
+	if result.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	return result, nil
+}
+
+//Signing key with the given ID, the keys are cached for as long as Google says and fetched again for unknown IDs
+func (g *Google) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key, ok := g.keys[kid]
+	if ok && time.Now().Before(g.keysExpire) {
+		return key, nil
+	}
+	//Tokens with made up key IDs shouldn't make every request fetch the keys
+	if !ok && time.Since(g.keysTried) < time.Minute && time.Now().Before(g.keysExpire) {
+		return nil, ErrInvalidToken
+	}
+	g.keysTried = time.Now()
+
+	keys, maxAge, err := g.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	g.keys = keys
+	g.keysExpire = time.Now().Add(maxAge)
+
+	key, ok = g.keys[kid]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return key, nil
+}
+
+func (g *Google) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, time.Duration, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, g.CertsURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	response, err := g.Client.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("Fetching Google signing keys failed with status %d", response.StatusCode)
+	}
+
+	set := struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&set)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		modulus, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			continue
+		}
+		exponent, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: int(new(big.Int).SetBytes(exponent).Int64()),
+		}
+	}
+
+	maxAge := time.Hour
+	for _, directive := range strings.Split(response.Header.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if strings.HasPrefix(directive, "max-age=") {
+			seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err == nil && seconds > 0 {
+				maxAge = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return keys, maxAge, nil
+}
@@ -0,0 +1,90 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+//Argon2id with its memory in KiB, passes over it and lanes. Hashes are stored in the PHC
+//format, $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>, so they carry their parameters.
+type Argon2id struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+type argon2Hash struct {
+	params Argon2id
+	salt   []byte
+	key    []byte
+}
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a Argon2id) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func decodeArgon2(encoded string) (*argon2Hash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrUnknownHash
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, ErrUnknownHash
+	}
+	hash := &argon2Hash{}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.params.Memory, &hash.params.Time, &hash.params.Threads)
+	if err != nil || hash.params.Time == 0 || hash.params.Threads == 0 {
+		return nil, ErrUnknownHash
+	}
+	hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, ErrUnknownHash
+	}
+	hash.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(hash.key) == 0 {
+		return nil, ErrUnknownHash
+	}
+	return hash, nil
+}
+
+//Checks with the parameters stored in the hash, not the configured ones
+func (a Argon2id) Verify(encoded, password string) error {
+	hash, err := decodeArgon2(encoded)
+	if err != nil {
+		return err
+	}
+	p := hash.params
+	key := argon2.IDKey([]byte(password), hash.salt, p.Time, p.Memory, p.Threads, uint32(len(hash.key)))
+	if subtle.ConstantTimeCompare(key, hash.key) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+func (a Argon2id) NeedsRehash(encoded string) bool {
+	hash, err := decodeArgon2(encoded)
+	return err != nil || hash.params != a || len(hash.key) != argon2KeyLength
+}
@@ -0,0 +1,55 @@
+package passwords
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/httpclient"
+)
+
+//Range API of Have I Been Pwned, which only ever sees the first 5 characters of the SHA-1
+const pwnedPasswordsURL = "https://api.pwnedpasswords.com/range/"
+
+var pwnedClient = httpclient.New("pwnedpasswords", 3*time.Second)
+
+//How many times the password showed up in known breaches, 0 for none. Only the first 5 characters of its
+//SHA-1 are sent and the matching suffixes compared here, padded answers hide which range was asked for.
+func Breached(ctx context.Context, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, pwnedPasswordsURL+prefix, nil)
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Add-Padding", "true")
+	request.Header.Set("User-Agent", "FixIt-API")
+	response, err := pwnedClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("Pwned Passwords answered %d", response.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 || line[:colon] != suffix {
+			continue
+		}
+		//Padding entries have a count of 0
+		return strconv.Atoi(line[colon+1:])
+	}
+	return 0, scanner.Err()
+}
@@ -0,0 +1,132 @@
+package passwords
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+//Returned when the password doesn't match the hash
+var ErrMismatch = errors.New("Incorrect Password")
+
+//Returned for hashes no hasher knows, such as ones stored in plain text
+var ErrUnknownHash = errors.New("Unknown Password Hash")
+
+//Hashes passwords and checks them against the hashes it made
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	//Whether the encoded hash is one of this hasher's
+	Recognizes(encoded string) bool
+	//ErrMismatch when the password doesn't match
+	Verify(encoded, password string) error
+	//Whether one of its hashes was made with other parameters and should be made again
+	NeedsRehash(encoded string) bool
+}
+
+//Hasher of new passwords and its parameters, read from the environment
+type Settings struct {
+	//argon2id or bcrypt, PASSWORD_HASHER
+	Hasher string
+	Argon2 Argon2id
+	Bcrypt Bcrypt
+}
+
+func envUint(key string, fallback, min, max uint64) uint64 {
+	value, err := strconv.ParseUint(os.Getenv(key), 10, 64)
+	if err != nil || value < min || value > max {
+		return fallback
+	}
+	return value
+}
+
+//Settings from PASSWORD_HASHER, ARGON2_MEMORY, ARGON2_TIME, ARGON2_THREADS and BCRYPT_COST.
+//Values out of range fall back to the defaults.
+func SettingsFromEnv() Settings {
+	settings := Settings{
+		Hasher: strings.ToLower(strings.TrimSpace(os.Getenv("PASSWORD_HASHER"))),
+		Argon2: Argon2id{
+			Memory:  uint32(envUint("ARGON2_MEMORY", 64*1024, 8*1024, 1024*1024)),
+			Time:    uint32(envUint("ARGON2_TIME", 3, 1, 20)),
+			Threads: uint8(envUint("ARGON2_THREADS", 2, 1, 64)),
+		},
+		Bcrypt: Bcrypt{Cost: int(envUint("BCRYPT_COST", 10, 10, 16))},
+	}
+	if settings.Hasher != "bcrypt" {
+		settings.Hasher = "argon2id"
+	}
+	return settings
+}
+
+//The hasher of new passwords, then the others whose hashes are still checked
+func (s Settings) hashers() []PasswordHasher {
+	if s.Hasher == "bcrypt" {
+		return []PasswordHasher{s.Bcrypt, s.Argon2}
+	}
+	return []PasswordHasher{s.Argon2, s.Bcrypt}
+}
+
+var settings atomic.Value
+
+func currentSettings() Settings {
+	current, ok := settings.Load().(Settings)
+	if !ok {
+		current = SettingsFromEnv()
+		settings.Store(current)
+	}
+	return current
+}
+
+//Changes how passwords are hashed from now on. Hashes made before keep working and are
+//reported by Verify as needing a rehash.
+func Configure(s Settings) {
+	settings.Store(s)
+}
+
+//Hashes a new password with the configured hasher
+func Hash(password string) (string, error) {
+	return currentSettings().hashers()[0].Hash(password)
+}
+
+//Checks the password against a hash made by any of the hashers. Rehash is true when it matched
+//a hash of another hasher or of other parameters, so the caller can store a new Hash of it.
+func Verify(encoded, password string) (rehash bool, err error) {
+	//Always replaced, checking one costs a hash of each layer
+	if strings.HasPrefix(encoded, wrapPrefix) {
+		err = verifyWrapped(encoded, password)
+		return err == nil, err
+	}
+	hashers := currentSettings().hashers()
+	for i, hasher := range hashers {
+		if !hasher.Recognizes(encoded) {
+			continue
+		}
+		err = hasher.Verify(encoded, password)
+		if err != nil {
+			return false, err
+		}
+		return i > 0 || hasher.NeedsRehash(encoded), nil
+	}
+	return false, ErrUnknownHash
+}
+
+var (
+	decoyLock   sync.Mutex
+	decoyHashes = map[Settings]string{}
+)
+
+//Checks the password against a hash of the current hasher that never matches, so checking
+//the password of an account that doesn't exist takes as long as a wrong password
+func Decoy(password string) {
+	current := currentSettings()
+	decoyLock.Lock()
+	decoy, ok := decoyHashes[current]
+	if !ok {
+		decoy, _ = current.hashers()[0].Hash("decoy password")
+		decoyHashes[current] = decoy
+	}
+	decoyLock.Unlock()
+	current.hashers()[0].Verify(decoy, password)
+}
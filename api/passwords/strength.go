@@ -0,0 +1,140 @@
+package passwords
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+//Guesses for a character outside any pattern as a power of ten, zxcvbn's cardinality of 10
+const bruteforceCost = 1
+
+//Rows of the keyboard, runs along them are guessed early
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"}
+
+//Score of a password from 0 to 4 like zxcvbn's, from an estimate of the guesses needed to find it.
+//The password is split into the patterns guessers try first, repeats, sequences, keyboard runs, years
+//and the user's own details, with the rest guessed character by character. Scores are
+//below 10^3 guesses 0, below 10^6 1, below 10^8 2, below 10^10 3 and 4 above.
+func Score(password string, userInputs ...string) int {
+	guesses := Guesses(password, userInputs...)
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	}
+	return 4
+}
+
+//Estimated guesses for the password as a power of ten
+func Guesses(password string, userInputs ...string) float64 {
+	runes := []rune(strings.ToLower(password))
+	if len(runes) == 0 {
+		return 0
+	}
+	personal := []string{}
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if len([]rune(input)) >= 3 {
+			personal = append(personal, input)
+		}
+	}
+
+	guesses := 0.0
+	for i := 0; i < len(runes); {
+		length, cost := longestPattern(runes[i:], personal)
+		if length == 0 {
+			guesses += bruteforceCost
+			i++
+			continue
+		}
+		guesses += cost
+		i += length
+	}
+	return guesses
+}
+
+//Length and cost, as a power of ten, of the longest pattern at the start of the runes. Patterns
+//shorter than 3 characters are left to be guessed character by character.
+func longestPattern(runes []rune, personal []string) (int, float64) {
+	best, cost := 0, 0.0
+	consider := func(length int, guesses float64) {
+		if length >= 3 && length > best {
+			best, cost = length, guesses
+		}
+	}
+
+	//Repeats of one character, aaaa
+	repeat := 1
+	for repeat < len(runes) && runes[repeat] == runes[0] {
+		repeat++
+	}
+	consider(repeat, math.Log10(float64(12*repeat)))
+
+	//Steps of one through the alphabet or digits, abcd or 4321
+	if len(runes) > 1 {
+		step := runes[1] - runes[0]
+		if step == 1 || step == -1 {
+			sequence := 2
+			for sequence < len(runes) && runes[sequence]-runes[sequence-1] == step {
+				sequence++
+			}
+			consider(sequence, math.Log10(float64(26*sequence)))
+		}
+	}
+
+	//Runs along a keyboard row, either way, qwerty or lkjh
+	text := string(runes)
+	for _, row := range keyboardRows {
+		for _, direction := range []string{row, reverse(row)} {
+			for length := len(runes); length >= 3; length-- {
+				if strings.Contains(direction, string(runes[:length])) {
+					consider(length, math.Log10(float64(len(keyboardRows)*4*length)))
+					break
+				}
+			}
+		}
+	}
+
+	//Years from 1900 to 2099
+	if len(runes) >= 4 && (strings.HasPrefix(text, "19") || strings.HasPrefix(text, "20")) &&
+		unicode.IsDigit(runes[2]) && unicode.IsDigit(runes[3]) {
+		consider(4, math.Log10(200))
+	}
+
+	//The user's own username or email, guessed first by anyone targeting them
+	for _, input := range personal {
+		if strings.HasPrefix(text, input) {
+			consider(len([]rune(input)), 1)
+		}
+	}
+
+	//Passwords everyone tries
+	for common := range commonPasswords {
+		if strings.HasPrefix(text, common) {
+			consider(len([]rune(common)), 2)
+		}
+	}
+	return best, cost
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+//Passwords and stems tried first when guessing
+var commonPasswords = map[string]bool{
+	"password": true, "passw0rd": true, "qwerty": true, "iloveyou": true, "letmein": true,
+	"welcome": true, "admin": true, "monkey": true, "dragon": true, "football": true,
+	"sunshine": true, "princess": true, "master": true, "fixit": true, "kenya": true,
+	"nairobi": true, "jesus": true, "baseball": true, "abc": true, "trustno1": true,
+}
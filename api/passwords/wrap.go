@@ -0,0 +1,182 @@
+package passwords
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/blowfish"
+)
+
+//Prefix of a hash made by hashing an older hash again with the current hasher, see Upgrade. After it
+//come the older hash's salt and parameters, base64url encoded, then the current hasher's hash of it.
+const wrapPrefix = "$wrap$"
+
+//Returned for hashes too long for bcrypt to hash again, when bcrypt is the configured hasher
+var ErrCannotUpgrade = errors.New("Hash Too Long For bcrypt")
+
+//Hash stored for the password with an older hasher or older parameters, upgraded without knowing the
+//password: the old hash is hashed again with the current hasher and only its salt and parameters are
+//kept. Checking it goes through both, and a login replaces it with a plain hash of the current hasher.
+//Hashes already protected by the current hasher and parameters are left as they are, changed is false.
+func Upgrade(encoded string) (upgraded string, changed bool, err error) {
+	current := currentSettings().hashers()[0]
+	outer := encoded
+	if strings.HasPrefix(encoded, wrapPrefix) {
+		_, outer, err = splitWrapped(encoded)
+		if err != nil {
+			return "", false, err
+		}
+	}
+	if current.Recognizes(outer) && !current.NeedsRehash(outer) {
+		return encoded, false, nil
+	}
+
+	//bcrypt only reads the first 72 bytes, most of a longer hash would go unprotected
+	if _, ok := current.(Bcrypt); ok && len(encoded) > 72 {
+		return "", false, ErrCannotUpgrade
+	}
+	salt, err := setting(encoded)
+	if err != nil {
+		return "", false, err
+	}
+	hashed, err := current.Hash(encoded)
+	if err != nil {
+		return "", false, err
+	}
+	return wrapPrefix + base64.RawURLEncoding.EncodeToString([]byte(salt)) + hashed, true, nil
+}
+
+//The salt and parameters of a wrapped hash's inner hash, and its outer hash
+func splitWrapped(encoded string) (string, string, error) {
+	rest := strings.TrimPrefix(encoded, wrapPrefix)
+	end := strings.IndexByte(rest, '$')
+	if end < 0 {
+		return "", "", ErrUnknownHash
+	}
+	inner, err := base64.RawURLEncoding.DecodeString(rest[:end])
+	if err != nil {
+		return "", "", ErrUnknownHash
+	}
+	return string(inner), rest[end:], nil
+}
+
+//The hash without its digest, enough to hash a password the same way again
+func setting(encoded string) (string, error) {
+	switch {
+	case strings.HasPrefix(encoded, wrapPrefix):
+		inner, outer, err := splitWrapped(encoded)
+		if err != nil {
+			return "", err
+		}
+		outerSetting, err := setting(outer)
+		if err != nil {
+			return "", err
+		}
+		return wrapPrefix + base64.RawURLEncoding.EncodeToString([]byte(inner)) + outerSetting, nil
+	case Argon2id{}.Recognizes(encoded):
+		if _, err := decodeArgon2(encoded); err != nil {
+			return "", err
+		}
+		return encoded[:strings.LastIndexByte(encoded, '$')], nil
+	case Bcrypt{}.Recognizes(encoded):
+		//$2b$10$ and the 22 characters of the salt
+		if len(encoded) != 60 {
+			return "", ErrUnknownHash
+		}
+		return encoded[:29], nil
+	}
+	return "", ErrUnknownHash
+}
+
+//Hashes the password with the salt and parameters of the setting, giving back the hash it was taken from
+func hashWithSetting(salt, password string) (string, error) {
+	switch {
+	case strings.HasPrefix(salt, wrapPrefix):
+		inner, outer, err := splitWrapped(salt)
+		if err != nil {
+			return "", err
+		}
+		innerHash, err := hashWithSetting(inner, password)
+		if err != nil {
+			return "", err
+		}
+		outerHash, err := hashWithSetting(outer, innerHash)
+		if err != nil {
+			return "", err
+		}
+		return wrapPrefix + base64.RawURLEncoding.EncodeToString([]byte(inner)) + outerHash, nil
+	case Argon2id{}.Recognizes(salt):
+		hash, err := decodeArgon2(salt + "$AA")
+		if err != nil {
+			return "", err
+		}
+		p := hash.params
+		key := argon2.IDKey([]byte(password), hash.salt, p.Time, p.Memory, p.Threads, argon2KeyLength)
+		return salt + "$" + base64.RawStdEncoding.EncodeToString(key), nil
+	case Bcrypt{}.Recognizes(salt):
+		return bcryptWithSalt(salt, password)
+	}
+	return "", ErrUnknownHash
+}
+
+//Checks the password against a wrapped hash by hashing it again through every layer
+func verifyWrapped(encoded, password string) error {
+	salt, err := setting(encoded)
+	if err != nil {
+		return err
+	}
+	hashed, err := hashWithSetting(salt, password)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashed), []byte(encoded)) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+//Alphabet of bcrypt's base64, and the text it encrypts
+var (
+	bcryptEncoding = base64.NewEncoding("./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789").WithPadding(base64.NoPadding)
+	bcryptMagic    = []byte("OrpheanBeholderScryDoubt")
+)
+
+//bcrypt of the password with the cost and salt of the setting. The bcrypt package only hashes with a salt
+//of its own, checking a wrapped hash needs the one the old hash was made with.
+func bcryptWithSalt(salt, password string) (string, error) {
+	parts := strings.Split(salt, "$")
+	if len(parts) != 4 || len(parts[3]) != 22 {
+		return "", ErrUnknownHash
+	}
+	cost, err := strconv.Atoi(parts[2])
+	if err != nil || cost < 4 || cost > 31 {
+		return "", ErrUnknownHash
+	}
+	rawSalt, err := bcryptEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", ErrUnknownHash
+	}
+
+	//C implementations hash the key's trailing NUL too
+	key := append([]byte(password), 0)
+	cipher, err := blowfish.NewSaltedCipher(key, rawSalt)
+	if err != nil {
+		return "", err
+	}
+	for i := uint64(0); i < 1<<uint(cost); i++ {
+		blowfish.ExpandKey(key, cipher)
+		blowfish.ExpandKey(rawSalt, cipher)
+	}
+	data := append([]byte{}, bcryptMagic...)
+	for i := 0; i < len(data); i += 8 {
+		for j := 0; j < 64; j++ {
+			cipher.Encrypt(data[i:i+8], data[i:i+8])
+		}
+	}
+	//Only 23 of the 24 bytes are kept, as C implementations do
+	return salt + bcryptEncoding.EncodeToString(data[:23]), nil
+}
@@ -0,0 +1,165 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//Parameters small enough to keep the tests fast
+var (
+	testArgon2 = Argon2id{Memory: 64, Time: 1, Threads: 1}
+	testBcrypt = Bcrypt{Cost: 4}
+)
+
+func configureForTest(s Settings) func() {
+	previous := currentSettings()
+	Configure(s)
+	return func() { Configure(previous) }
+}
+
+func TestBcryptWithSaltMatchesBcrypt(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		cost     int
+		prefix   string
+	}{
+		{"empty", "", 4, "$2a$"},
+		{"ascii", "correct horse battery staple", 4, "$2a$"},
+		{"unicode", "pässwörd ✓ 密码", 4, "$2a$"},
+		{"72 bytes", strings.Repeat("a", 72), 4, "$2a$"},
+		{"past 72 bytes", strings.Repeat("b", 100), 4, "$2a$"},
+		{"2b prefix", "password", 4, "$2b$"},
+		{"2y prefix", "password", 4, "$2y$"},
+		{"cost 6", "password", 6, "$2a$"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hashed, err := bcrypt.GenerateFromPassword([]byte(test.password), test.cost)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := test.prefix + string(hashed[4:])
+
+			got, err := bcryptWithSalt(want[:29], test.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("bcryptWithSalt = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestBcryptWithSaltRejectsBadSettings(t *testing.T) {
+	for _, salt := range []string{
+		"",
+		"$2a$04$",
+		"$2a$xx$abcdefghijklmnopqrstuv",
+		"$2a$03$abcdefghijklmnopqrstuv",
+		"$2a$32$abcdefghijklmnopqrstuv",
+		"$2a$04$abcdefghijklmnopqrstu",
+		"$2a$04$abcdefghijklmnopqrstu!",
+	} {
+		if _, err := bcryptWithSalt(salt, "password"); err != ErrUnknownHash {
+			t.Errorf("bcryptWithSalt(%q) error = %v, want ErrUnknownHash", salt, err)
+		}
+	}
+}
+
+func TestUpgradeRoundTrip(t *testing.T) {
+	slowArgon2 := Argon2id{Memory: 128, Time: 2, Threads: 1}
+	tests := []struct {
+		name string
+		//Hashers the password is hashed with then upgraded to, in order
+		layers []Settings
+	}{
+		{"bcrypt to argon2id", []Settings{
+			{Hasher: "bcrypt", Bcrypt: testBcrypt, Argon2: testArgon2},
+			{Hasher: "argon2id", Bcrypt: testBcrypt, Argon2: testArgon2},
+		}},
+		{"bcrypt cost", []Settings{
+			{Hasher: "bcrypt", Bcrypt: testBcrypt, Argon2: testArgon2},
+			{Hasher: "bcrypt", Bcrypt: Bcrypt{Cost: 5}, Argon2: testArgon2},
+		}},
+		{"argon2id parameters", []Settings{
+			{Hasher: "argon2id", Bcrypt: testBcrypt, Argon2: testArgon2},
+			{Hasher: "argon2id", Bcrypt: testBcrypt, Argon2: slowArgon2},
+		}},
+		{"nested", []Settings{
+			{Hasher: "bcrypt", Bcrypt: testBcrypt, Argon2: testArgon2},
+			{Hasher: "argon2id", Bcrypt: testBcrypt, Argon2: testArgon2},
+			{Hasher: "argon2id", Bcrypt: testBcrypt, Argon2: slowArgon2},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			restore := configureForTest(test.layers[0])
+			defer restore()
+
+			const password = "correct horse battery staple"
+			encoded, err := Hash(password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, layer := range test.layers[1:] {
+				Configure(layer)
+				upgraded, changed, err := Upgrade(encoded)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !changed || !strings.HasPrefix(upgraded, wrapPrefix) {
+					t.Fatalf("Upgrade(%q) = %q, %v, want a wrapped hash", encoded, upgraded, changed)
+				}
+				encoded = upgraded
+			}
+
+			if err := verifyWrapped(encoded, password); err != nil {
+				t.Errorf("verifyWrapped with the password: %v", err)
+			}
+			if err := verifyWrapped(encoded, password+"!"); err != ErrMismatch {
+				t.Errorf("verifyWrapped with another password = %v, want ErrMismatch", err)
+			}
+			rehash, err := Verify(encoded, password)
+			if err != nil || !rehash {
+				t.Errorf("Verify = %v, %v, want a match to rehash", rehash, err)
+			}
+
+			again, changed, err := Upgrade(encoded)
+			if err != nil || changed || again != encoded {
+				t.Errorf("Upgrade of an upgraded hash = %q, %v, %v, want it unchanged", again, changed, err)
+			}
+		})
+	}
+}
+
+func TestUpgradeLeavesCurrentHashes(t *testing.T) {
+	restore := configureForTest(Settings{Hasher: "argon2id", Bcrypt: testBcrypt, Argon2: testArgon2})
+	defer restore()
+
+	encoded, err := Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upgraded, changed, err := Upgrade(encoded)
+	if err != nil || changed || upgraded != encoded {
+		t.Errorf("Upgrade = %q, %v, %v, want the hash unchanged", upgraded, changed, err)
+	}
+}
+
+func TestUpgradeToBcryptRefusesLongHashes(t *testing.T) {
+	restore := configureForTest(Settings{Hasher: "argon2id", Bcrypt: testBcrypt, Argon2: testArgon2})
+	defer restore()
+
+	encoded, err := Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Configure(Settings{Hasher: "bcrypt", Bcrypt: testBcrypt, Argon2: testArgon2})
+	if _, _, err := Upgrade(encoded); err != ErrCannotUpgrade {
+		t.Errorf("Upgrade of an argon2id hash to bcrypt = %v, want ErrCannotUpgrade", err)
+	}
+}
@@ -0,0 +1,191 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/httpclient"
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
+)
+
+//Mobile money payments through the M-Pesa Daraja STK push API
+type Mpesa struct {
+	ConsumerKey    string
+	ConsumerSecret string
+	ShortCode      string
+	PassKey        string
+	CallbackURL    string //Public URL of the mpesa webhook endpoint
+	CallbackSecret string //Daraja does not sign callbacks, so the callback URL carries our own signature
+	BaseURL        string
+	Client         *http.Client
+}
+
+func NewMpesaFromEnv() *Mpesa {
+	baseURL := os.Getenv("MPESA_BASE_URL")
+	if baseURL == "" {
+		baseURL = "https://sandbox.safaricom.co.ke"
+	}
+	return &Mpesa{
+		ConsumerKey:    os.Getenv("MPESA_CONSUMER_KEY"),
+		ConsumerSecret: os.Getenv("MPESA_CONSUMER_SECRET"),
+		ShortCode:      os.Getenv("MPESA_SHORTCODE"),
+		PassKey:        os.Getenv("MPESA_PASSKEY"),
+		CallbackURL:    os.Getenv("MPESA_CALLBACK_URL"),
+		CallbackSecret: os.Getenv("MPESA_CALLBACK_SECRET"),
+		BaseURL:        baseURL,
+		Client:         httpclient.New("mpesa", 15*time.Second),
+	}
+}
+
+func (m *Mpesa) Name() string {
+	return "mpesa"
+}
+
+//Gets an OAuth access token for the Daraja API
+func (m *Mpesa) accessToken(ctx context.Context) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, m.BaseURL+"/oauth/v1/generate?grant_type=client_credentials", nil)
+	if err != nil {
+		return "", err
+	}
+	request.SetBasicAuth(m.ConsumerKey, m.ConsumerSecret)
+
+	response, err := m.Client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	result := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return "", fmt.Errorf("M-Pesa authentication failed with status %d", response.StatusCode)
+	}
+	return result.AccessToken, nil
+}
+
+func (m *Mpesa) CreateIntent(ctx context.Context, intent Intent) (*IntentResult, error) {
+	token, err := m.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	phone := strings.TrimPrefix(strings.TrimSpace(intent.Phone), "+")
+	if phone == "" {
+		return nil, fmt.Errorf("M-Pesa payments require a phone number")
+	}
+
+	timestamp := time.Now().Format("20060102150405")
+	callbackURL := m.CallbackURL + "?reference=" + url.QueryEscape(intent.Reference) + "&signature=" + tokens.Sign(m.CallbackSecret, intent.Reference)
+	payload, err := json.Marshal(map[string]interface{}{
+		"BusinessShortCode": m.ShortCode,
+		"Password":          base64.StdEncoding.EncodeToString([]byte(m.ShortCode + m.PassKey + timestamp)),
+		"Timestamp":         timestamp,
+		"TransactionType":   "CustomerPayBillOnline",
+		"Amount":            int64(math.Ceil(intent.Amount)),
+		"PartyA":            phone,
+		"PartyB":            m.ShortCode,
+		"PhoneNumber":       phone,
+		"CallBackURL":       callbackURL,
+		"AccountReference":  intent.Reference,
+		"TransactionDesc":   intent.Description,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, m.BaseURL+"/mpesa/stkpush/v1/processrequest", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := m.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	result := struct {
+		CheckoutRequestID string `json:"CheckoutRequestID"`
+		ResponseCode      string `json:"ResponseCode"`
+		CustomerMessage   string `json:"CustomerMessage"`
+		ErrorMessage      string `json:"errorMessage"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK || result.ResponseCode != "0" {
+		return nil, fmt.Errorf("M-Pesa payment request failed: %s", result.ErrorMessage)
+	}
+
+	return &IntentResult{GatewayReference: result.CheckoutRequestID, Instructions: result.CustomerMessage}, nil
+}
+
+func (m *Mpesa) ParseWebhook(r *http.Request, body []byte) (*Event, error) {
+	reference := r.URL.Query().Get("reference")
+	if m.CallbackSecret == "" || !tokens.Verify(m.CallbackSecret, reference, r.URL.Query().Get("signature")) {
+		return nil, ErrInvalidSignature
+	}
+
+	callback := struct {
+		Body struct {
+			StkCallback struct {
+				CheckoutRequestID string `json:"CheckoutRequestID"`
+				ResultCode        int    `json:"ResultCode"`
+				CallbackMetadata  struct {
+					Item []struct {
+						Name  string      `json:"Name"`
+						Value interface{} `json:"Value"`
+					} `json:"Item"`
+				} `json:"CallbackMetadata"`
+			} `json:"stkCallback"`
+		} `json:"Body"`
+	}{}
+	err := json.Unmarshal(body, &callback)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &Event{
+		GatewayReference: callback.Body.StkCallback.CheckoutRequestID,
+		Reference:        reference,
+		Status:           StatusSucceeded,
+	}
+	if callback.Body.StkCallback.ResultCode != 0 {
+		event.Status = StatusFailed
+		return event, nil
+	}
+	//Successful payments report what was paid, to be checked against the payment
+	for _, item := range callback.Body.StkCallback.CallbackMetadata.Item {
+		if amount, ok := item.Value.(float64); ok && item.Name == "Amount" {
+			event.Amount = amount
+		}
+	}
+	if event.Amount <= 0 {
+		return nil, errors.New("M-Pesa Callback Without An Amount")
+	}
+	return event, nil
+}
+
+//STK push payments can only be reversed with the M-Pesa receipt and an initiator credential,
+//so refunds are made from the M-Pesa portal
+func (m *Mpesa) Refund(ctx context.Context, gatewayReference string, amount float64) error {
+	return ErrRefundUnsupported
+}
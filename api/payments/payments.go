@@ -0,0 +1,94 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+)
+
+//Payment states, shared by every gateway
+const (
+	StatusPending   = "Pending"
+	StatusSucceeded = "Succeeded"
+	StatusFailed    = "Failed"
+	StatusRefunded  = "Refunded"
+)
+
+var (
+	ErrUnknownGateway    = errors.New("Unknown Payment Gateway")
+	ErrInvalidSignature  = errors.New("Invalid Webhook Signature")
+	ErrRefundUnsupported = errors.New("Refunds Must Be Made Manually For This Gateway")
+)
+
+//Payment to collect through a gateway
+type Intent struct {
+	Reference   string //Our own reference of the payment, echoed back by some gateways
+	Amount      float64
+	Currency    string
+	Phone       string //Payer's number for mobile money
+	Description string
+}
+
+//Gateway's answer to a new payment
+type IntentResult struct {
+	GatewayReference string `json:"gateway_reference"`
+	ClientSecret     string `json:"client_secret,omitempty"` //Used by the app to complete card payments
+	Instructions     string `json:"instructions,omitempty"`  //Shown to the payer, e.g. to confirm on their phone
+}
+
+//Payment status change reported by a gateway webhook
+type Event struct {
+	GatewayReference string
+	Reference        string //Set when the gateway echoes our reference back
+	Status           string
+	Amount           float64 //Amount collected, set when the gateway reports it
+}
+
+//Payment provider such as Stripe or M-Pesa
+type Gateway interface {
+	Name() string
+	//Start collecting a payment
+	CreateIntent(ctx context.Context, intent Intent) (*IntentResult, error)
+	//Verify a webhook and read the status change in it, nil when the event is irrelevant
+	ParseWebhook(r *http.Request, body []byte) (*Event, error)
+	//Return all or part of a successful payment
+	Refund(ctx context.Context, gatewayReference string, amount float64) error
+}
+
+var (
+	gateways     = map[string]Gateway{}
+	gatewaysLock sync.RWMutex
+	gatewaysOnce sync.Once
+)
+
+//Make a gateway available by its name
+func Register(gateway Gateway) {
+	gatewaysLock.Lock()
+	defer gatewaysLock.Unlock()
+	gateways[gateway.Name()] = gateway
+}
+
+//Register the gateways configured in the environment
+func registerFromEnv() {
+	if os.Getenv("STRIPE_SECRET_KEY") != "" {
+		Register(NewStripeFromEnv())
+	}
+	if os.Getenv("MPESA_CONSUMER_KEY") != "" {
+		Register(NewMpesaFromEnv())
+	}
+}
+
+//Find a registered gateway by name
+func Get(name string) (Gateway, error) {
+	gatewaysOnce.Do(registerFromEnv)
+
+	gatewaysLock.RLock()
+	defer gatewaysLock.RUnlock()
+	gateway, ok := gateways[name]
+	if !ok {
+		return nil, ErrUnknownGateway
+	}
+	return gateway, nil
+}
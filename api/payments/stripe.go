@@ -0,0 +1,171 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/httpclient"
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
+)
+
+//How old a Stripe webhook may be before it is rejected as a replay
+const stripeWebhookTolerance = 5 * time.Minute
+
+//Card payments through Stripe payment intents
+type Stripe struct {
+	SecretKey     string
+	WebhookSecret string
+	BaseURL       string
+	Client        *http.Client
+}
+
+func NewStripeFromEnv() *Stripe {
+	return &Stripe{
+		SecretKey:     os.Getenv("STRIPE_SECRET_KEY"),
+		WebhookSecret: os.Getenv("STRIPE_WEBHOOK_SECRET"),
+		BaseURL:       "https://api.stripe.com",
+		Client:        httpclient.New("stripe", 15*time.Second),
+	}
+}
+
+func (s *Stripe) Name() string {
+	return "stripe"
+}
+
+func (s *Stripe) CreateIntent(ctx context.Context, intent Intent) (*IntentResult, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(int64(math.Round(intent.Amount*100)), 10))
+	form.Set("currency", strings.ToLower(intent.Currency))
+	form.Set("description", intent.Description)
+	form.Set("metadata[reference]", intent.Reference)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.BaseURL+"/v1/payment_intents", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.SetBasicAuth(s.SecretKey, "")
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Idempotency-Key", intent.Reference)
+
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	result := struct {
+		ID           string `json:"id"`
+		ClientSecret string `json:"client_secret"`
+		Error        struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Stripe payment intent failed: %s", result.Error.Message)
+	}
+
+	return &IntentResult{GatewayReference: result.ID, ClientSecret: result.ClientSecret}, nil
+}
+
+//Verifies the Stripe-Signature header, "t=<timestamp>,v1=<hmac of timestamp.body>"
+func (s *Stripe) verifySignature(header string, body []byte) bool {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		pair := strings.SplitN(part, "=", 2)
+		if len(pair) != 2 {
+			continue
+		}
+		switch pair[0] {
+		case "t":
+			timestamp = pair[1]
+		case "v1":
+			signatures = append(signatures, pair[1])
+		}
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(seconds, 0)) > stripeWebhookTolerance {
+		return false
+	}
+	for _, signature := range signatures {
+		if tokens.Verify(s.WebhookSecret, timestamp+"."+string(body), signature) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Stripe) ParseWebhook(r *http.Request, body []byte) (*Event, error) {
+	if s.WebhookSecret == "" || !s.verifySignature(r.Header.Get("Stripe-Signature"), body) {
+		return nil, ErrInvalidSignature
+	}
+
+	event := struct {
+		Type string `json:"type"`
+		Data struct {
+			Object struct {
+				ID            string            `json:"id"`
+				PaymentIntent string            `json:"payment_intent"`
+				Metadata      map[string]string `json:"metadata"`
+			} `json:"object"`
+		} `json:"data"`
+	}{}
+	err := json.Unmarshal(body, &event)
+	if err != nil {
+		return nil, err
+	}
+
+	object := event.Data.Object
+	switch event.Type {
+	case "payment_intent.succeeded":
+		return &Event{GatewayReference: object.ID, Reference: object.Metadata["reference"], Status: StatusSucceeded}, nil
+	case "payment_intent.payment_failed", "payment_intent.canceled":
+		return &Event{GatewayReference: object.ID, Reference: object.Metadata["reference"], Status: StatusFailed}, nil
+	case "charge.refunded":
+		return &Event{GatewayReference: object.PaymentIntent, Status: StatusRefunded}, nil
+	}
+	return nil, nil
+}
+
+func (s *Stripe) Refund(ctx context.Context, gatewayReference string, amount float64) error {
+	form := url.Values{}
+	form.Set("payment_intent", gatewayReference)
+	form.Set("amount", strconv.FormatInt(int64(math.Round(amount*100)), 10))
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.BaseURL+"/v1/refunds", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.SetBasicAuth(s.SecretKey, "")
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		result := struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}{}
+		json.NewDecoder(response.Body).Decode(&result)
+		return fmt.Errorf("Stripe refund failed: %s", result.Error.Message)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "whsec_test"
+
+//Stripe-Signature header for the body as Stripe makes it, signed with the secret at the time
+func stripeHeader(secret string, at time.Time, body string) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//The signature with its last digit changed
+func flipHex(signature string) string {
+	last := "0"
+	if strings.HasSuffix(signature, "0") {
+		last = "1"
+	}
+	return signature[:len(signature)-1] + last
+}
+
+func TestStripeVerifySignature(t *testing.T) {
+	body := `{"type":"payment_intent.succeeded","data":{"object":{"id":"pi_1"}}}`
+	now := time.Now()
+	valid := stripeHeader(testWebhookSecret, now, body)
+	signature := valid[strings.Index(valid, "v1=")+3:]
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	tests := []struct {
+		name   string
+		header string
+		body   string
+		want   bool
+	}{
+		{"valid", valid, body, true},
+		{"another signature first", "t=" + timestamp + ",v1=" + strings.Repeat("0", 64) + ",v1=" + signature, body, true},
+		{"test mode signature alongside", valid + ",v0=" + strings.Repeat("0", 64), body, true},
+		{"tampered body", valid, strings.Replace(body, "pi_1", "pi_2", 1), false},
+		{"tampered signature", "t=" + timestamp + ",v1=" + flipHex(signature), body, false},
+		{"other secret", stripeHeader("whsec_other", now, body), body, false},
+		{"timestamp changed", "t=" + strconv.FormatInt(now.Unix()+1, 10) + ",v1=" + signature, body, false},
+		{"older than the tolerance", stripeHeader(testWebhookSecret, now.Add(-stripeWebhookTolerance-time.Minute), body), body, false},
+		{"no timestamp", "v1=" + signature, body, false},
+		{"no signature", "t=" + timestamp, body, false},
+		{"empty header", "", body, false},
+	}
+	s := &Stripe{WebhookSecret: testWebhookSecret}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := s.verifySignature(test.header, []byte(test.body)); got != test.want {
+				t.Errorf("verifySignature = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStripeParseWebhookRejectsUnsigned(t *testing.T) {
+	body := `{"type":"payment_intent.succeeded","data":{"object":{"id":"pi_1"}}}`
+	r := httptest.NewRequest("POST", "/payments/webhooks/stripe", strings.NewReader(body))
+	r.Header.Set("Stripe-Signature", stripeHeader(testWebhookSecret, time.Now(), body))
+
+	if _, err := (&Stripe{}).ParseWebhook(r, []byte(body)); err != ErrInvalidSignature {
+		t.Errorf("ParseWebhook without a webhook secret = %v, want ErrInvalidSignature", err)
+	}
+	if _, err := (&Stripe{WebhookSecret: testWebhookSecret}).ParseWebhook(r, []byte(body)); err == ErrInvalidSignature {
+		t.Errorf("ParseWebhook refused a valid signature")
+	}
+}
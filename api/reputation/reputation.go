@@ -0,0 +1,146 @@
+package reputation
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/cache"
+)
+
+//Metrics of lookups and block decisions, served with the other expvars on /admin/metrics
+var (
+	lookups   = expvar.NewMap("ip_reputation_lookups") //By source
+	cacheHits = expvar.NewInt("ip_reputation_cache_hits")
+	failures  = expvar.NewMap("ip_reputation_errors") //By source
+	blocks    = expvar.NewMap("ip_reputation_blocks") //By consumer e.g. risk, ratelimit
+)
+
+//What a source knows about an address, scores go from 0 (clean) to 100 (known abuser)
+type Verdict struct {
+	Score  int    `json:"score"`
+	Source string `json:"source"`
+	Reason string `json:"reason"`
+}
+
+//Place to look up the reputation of an address
+type Source interface {
+	Name() string
+	Lookup(ctx context.Context, ip string) (Verdict, error)
+}
+
+//Asks the sources about an address and remembers the worst verdict for a while
+type Checker struct {
+	mu         sync.RWMutex
+	sources    []Source
+	cache      *cache.Cache
+	ttl        time.Duration
+	blockScore int //Score from which consumers should turn the address away
+}
+
+func NewChecker(ttl time.Duration, blockScore int) *Checker {
+	return &Checker{cache: cache.New(), ttl: ttl, blockScore: blockScore}
+}
+
+//Change how long verdicts are cached and the score from which addresses are blocked
+func (c *Checker) Configure(ttl time.Duration, blockScore int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+	c.blockScore = blockScore
+}
+
+//Score from which addresses are blocked
+func (c *Checker) BlockScore() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.blockScore
+}
+
+//Add sources to the checker
+func (c *Checker) Use(sources ...Source) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sources = append(c.sources, sources...)
+}
+
+//Worst verdict of the sources on the address. Failing sources are skipped and the result isn't cached so they are asked again.
+func (c *Checker) Check(ctx context.Context, ip string) Verdict {
+	if ip == "" {
+		return Verdict{}
+	}
+	if cached, ok := c.cache.Get(ip); ok {
+		cacheHits.Add(1)
+		return cached.(Verdict)
+	}
+
+	c.mu.RLock()
+	sources, ttl := c.sources, c.ttl
+	c.mu.RUnlock()
+
+	worst := Verdict{}
+	complete := true
+	for _, source := range sources {
+		lookups.Add(source.Name(), 1)
+		verdict, err := source.Lookup(ctx, ip)
+		if err != nil {
+			failures.Add(source.Name(), 1)
+			log.Printf("IP reputation lookup of %s in %s failed: %v", ip, source.Name(), err)
+			complete = false
+			continue
+		}
+		if verdict.Score > worst.Score {
+			verdict.Source = source.Name()
+			worst = verdict
+		}
+	}
+
+	if complete {
+		c.cache.Set(ip, worst, ttl)
+	}
+	return worst
+}
+
+//Whether the address should be turned away, consumer names who asked in the metrics
+func (c *Checker) Blocked(ctx context.Context, ip, consumer string) (bool, Verdict) {
+	verdict := c.Check(ctx, ip)
+	if verdict.Score < c.BlockScore() {
+		return false, verdict
+	}
+	blocks.Add(consumer, 1)
+	return true, verdict
+}
+
+var (
+	defaultChecker *Checker
+	defaultOnce    sync.Once
+)
+
+//Shared checker with the sources configured in the environment
+func Default() *Checker {
+	defaultOnce.Do(func() {
+		defaultChecker = NewChecker(SettingsFromEnv())
+		defaultChecker.Use(NewStaticList(os.Getenv("IP_DENYLIST")))
+		if key := os.Getenv("ABUSEIPDB_API_KEY"); key != "" {
+			defaultChecker.Use(NewAbuseIPDB(key))
+		}
+	})
+	return defaultChecker
+}
+
+//Cache lifetime from IP_REPUTATION_CACHE_TTL and block score from IP_BLOCK_SCORE
+func SettingsFromEnv() (time.Duration, int) {
+	ttl, err := time.ParseDuration(os.Getenv("IP_REPUTATION_CACHE_TTL"))
+	if err != nil || ttl <= 0 {
+		ttl = time.Hour
+	}
+	blockScore, err := strconv.Atoi(os.Getenv("IP_BLOCK_SCORE"))
+	if err != nil || blockScore <= 0 {
+		blockScore = 75
+	}
+	return ttl, blockScore
+}
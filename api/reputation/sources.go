@@ -0,0 +1,122 @@
+package reputation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/httpclient"
+)
+
+//Fixed list of denied addresses and networks, e.g. 203.0.113.7,198.51.100.0/24
+type StaticList struct {
+	networks []*net.IPNet
+}
+
+func NewStaticList(list string) *StaticList {
+	static := &StaticList{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if strings.Contains(entry, ":") {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("Ignoring invalid IP_DENYLIST entry %q", entry)
+			continue
+		}
+		static.networks = append(static.networks, network)
+	}
+	return static
+}
+
+func (s *StaticList) Name() string {
+	return "denylist"
+}
+
+func (s *StaticList) Lookup(ctx context.Context, ip string) (Verdict, error) {
+	address := net.ParseIP(ip)
+	if address == nil {
+		return Verdict{}, nil
+	}
+	for _, network := range s.networks {
+		if network.Contains(address) {
+			return Verdict{Score: 100, Reason: "Listed in " + network.String()}, nil
+		}
+	}
+	return Verdict{}, nil
+}
+
+//Abuse confidence scores from AbuseIPDB
+type AbuseIPDB struct {
+	APIKey     string
+	BaseURL    string
+	MaxAgeDays int
+	Client     *http.Client
+}
+
+func NewAbuseIPDB(apiKey string) *AbuseIPDB {
+	return &AbuseIPDB{
+		APIKey:     apiKey,
+		BaseURL:    "https://api.abuseipdb.com",
+		MaxAgeDays: 90,
+		Client:     httpclient.New("reputation", 5*time.Second),
+	}
+}
+
+func (a *AbuseIPDB) Name() string {
+	return "abuseipdb"
+}
+
+func (a *AbuseIPDB) Lookup(ctx context.Context, ip string) (Verdict, error) {
+	query := url.Values{}
+	query.Set("ipAddress", ip)
+	query.Set("maxAgeInDays", fmt.Sprint(a.MaxAgeDays))
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, a.BaseURL+"/api/v2/check?"+query.Encode(), nil)
+	if err != nil {
+		return Verdict{}, err
+	}
+	request.Header.Set("Key", a.APIKey)
+	request.Header.Set("Accept", "application/json")
+
+	response, err := a.Client.Do(request)
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("AbuseIPDB check failed with status %d", response.StatusCode)
+	}
+
+	result := struct {
+		Data struct {
+			AbuseConfidenceScore int `json:"abuseConfidenceScore"`
+			TotalReports         int `json:"totalReports"`
+		} `json:"data"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	verdict := Verdict{Score: result.Data.AbuseConfidenceScore}
+	if verdict.Score > 0 {
+		verdict.Reason = fmt.Sprintf("%d abuse reports", result.Data.TotalReports)
+	}
+	return verdict, nil
+}
@@ -1,11 +1,16 @@
 package responses
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/victorkabata/FixIt-API/api/apierror"
 	"github.com/victorkabata/FixIt-API/api/auth"
+	"github.com/victorkabata/FixIt-API/api/database"
+	"github.com/victorkabata/FixIt-API/api/dependency"
 	"github.com/victorkabata/FixIt-API/api/models"
 )
 
@@ -17,34 +22,71 @@ func JSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	}
 }
 
+//Whether the error comes from the request running out of its deadline budget, also through
+//AWS errors, which keep the cause as OrigErr
+func timedOut(err error) bool {
+	for err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return true
+		}
+		var wrapper interface{ OrigErr() error }
+		if !errors.As(err, &wrapper) {
+			return false
+		}
+		err = wrapper.OrigErr()
+	}
+	return false
+}
+
 func ERROR(w http.ResponseWriter, statusCode int, err error) {
+	if timedOut(err) {
+		statusCode, err = http.StatusGatewayTimeout, errors.New("Request Timed Out")
+	}
+	//Handlers that don't tell dependency failures apart get the status of their kind
+	if status, ok := dependency.Status(err); ok && statusCode == http.StatusInternalServerError {
+		statusCode = status
+		if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "30")
+		}
+		if status != http.StatusUnprocessableEntity {
+			err = errors.New("Service Unavailable")
+		}
+	}
 	if err != nil {
-		JSON(w, statusCode, struct {
-			Error string `json:"message"`
-		}{
-			Error: err.Error(),
-		})
+		//Unique indexes refusing a write are conflicts, whichever handler let them through
+		if duplicate, ok := database.DuplicateKey(err); ok {
+			err = duplicate
+		}
+		apiErr := apierror.From(statusCode, err)
+		JSON(w, apiErr.Status, apiErr)
 		return
 	}
 	JSON(w, http.StatusBadRequest, nil)
 }
 
 func PrepareResponse(user *models.User) map[string]interface{} {
-	token, _ := auth.CreateToken(user.ID)
+	token, _ := auth.CreateToken(user.ID, user.Role)
 
 	responseUser := &models.ResponseUser{
 		ID:             user.ID,
 		Username:       user.Username,
 		Email:          user.Email,
-		Phone:          user.Phone,
+		Phone:          user.PhoneNumber(),
 		ImageURL:       user.ImageURL,
+		ThumbnailURL:   user.ThumbnailURL,
+		MediumURL:      user.MediumURL,
 		Specialisation: user.Specialisation,
 		Latitude:       user.Latitude,
 		Longitude:      user.Longitude,
+		PlusCode:       user.PlusCode,
 		Address:        user.Address,
 		Region:         user.Region,
 		Country:        user.Country,
+		KYCStatus:      user.KYCStatus,
+		Languages:      user.Languages,
 		Token:          token,
+		AverageRating:  user.AverageRating,
+		ReviewCount:    user.ReviewCount,
 	}
 
 	var response = map[string]interface{}{"message": "Successful"}
@@ -0,0 +1,135 @@
+package risk
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/victorkabata/FixIt-API/api/reputation"
+)
+
+//Actions that are scored
+const (
+	Register = "register"
+	Login    = "login"
+)
+
+//What to do with a scored action
+const (
+	Allow  = "allow"
+	Verify = "verify" //Ask for proof of ownership before going on
+	Review = "review" //Hold the account for manual review
+)
+
+//Facts about an action the rules look at
+type Signal struct {
+	Action string
+	UserID uint32
+	Email  string
+	Phone  string
+	IP     string
+}
+
+//Risk a rule found in a signal
+type Finding struct {
+	Rule   string `json:"rule"`
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+}
+
+//Check contributing to the risk score, returns nil when the signal looks fine
+type Rule interface {
+	Name() string
+	Evaluate(ctx context.Context, signal Signal) (*Finding, error)
+}
+
+//Total score of a signal and the decision it leads to
+type Assessment struct {
+	Score    int       `json:"score"`
+	Decision string    `json:"decision"`
+	Findings []Finding `json:"findings"`
+}
+
+//Runs the registered rules and turns their scores into a decision
+type Scorer struct {
+	mu       sync.RWMutex
+	rules    []Rule
+	verifyAt int
+	reviewAt int
+}
+
+func NewScorer(verifyAt, reviewAt int) *Scorer {
+	return &Scorer{verifyAt: verifyAt, reviewAt: reviewAt}
+}
+
+//Change the scores from which actions need verification or a review
+func (s *Scorer) SetThresholds(verifyAt, reviewAt int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.verifyAt = verifyAt
+	s.reviewAt = reviewAt
+}
+
+//Add rules to the scorer
+func (s *Scorer) Use(rules ...Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, rules...)
+}
+
+//Score a signal. Rules that fail are logged and skipped so an outage of a reputation source doesn't block sign ups.
+func (s *Scorer) Assess(ctx context.Context, signal Signal) Assessment {
+	s.mu.RLock()
+	rules, verifyAt, reviewAt := s.rules, s.verifyAt, s.reviewAt
+	s.mu.RUnlock()
+
+	assessment := Assessment{Decision: Allow, Findings: []Finding{}}
+	for _, rule := range rules {
+		finding, err := rule.Evaluate(ctx, signal)
+		if err != nil {
+			log.Printf("Risk rule %s failed: %v", rule.Name(), err)
+			continue
+		}
+		if finding == nil {
+			continue
+		}
+		finding.Rule = rule.Name()
+		assessment.Score += finding.Score
+		assessment.Findings = append(assessment.Findings, *finding)
+	}
+
+	switch {
+	case assessment.Score >= reviewAt:
+		assessment.Decision = Review
+	case assessment.Score >= verifyAt:
+		assessment.Decision = Verify
+	}
+	return assessment
+}
+
+func envInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+//Verify and review thresholds from RISK_VERIFY_SCORE and RISK_REVIEW_SCORE
+func ThresholdsFromEnv() (int, int) {
+	return envInt("RISK_VERIFY_SCORE", 50), envInt("RISK_REVIEW_SCORE", 80)
+}
+
+//Scorer with the built in rules configured from the environment
+func Default() *Scorer {
+	scorer := NewScorer(ThresholdsFromEnv())
+	scorer.Use(
+		NewDisposableEmailRule(os.Getenv("RISK_DISPOSABLE_DOMAINS")),
+		NewVoIPPhoneRule(os.Getenv("RISK_VOIP_PREFIXES")),
+		NewIPReputationRule(reputation.Default()),
+		NewVelocityRule(),
+	)
+	return scorer
+}
@@ -0,0 +1,167 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/reputation"
+)
+
+//Splits a comma separated setting
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+//Throwaway email providers, extended with RISK_DISPOSABLE_DOMAINS
+var disposableDomains = []string{
+	"mailinator.com", "guerrillamail.com", "10minutemail.com", "tempmail.com", "temp-mail.org",
+	"yopmail.com", "trashmail.com", "getnada.com", "dispostable.com", "sharklasers.com",
+	"maildrop.cc", "throwawaymail.com", "fakeinbox.com", "mailnesia.com", "mintemail.com",
+}
+
+//Flags email addresses at throwaway providers
+type DisposableEmailRule struct {
+	domains map[string]bool
+	Score   int
+}
+
+func NewDisposableEmailRule(extra string) *DisposableEmailRule {
+	rule := &DisposableEmailRule{domains: map[string]bool{}, Score: 40}
+	for _, domain := range append(disposableDomains, splitList(extra)...) {
+		rule.domains[domain] = true
+	}
+	return rule
+}
+
+func (d *DisposableEmailRule) Name() string {
+	return "disposable_email"
+}
+
+func (d *DisposableEmailRule) Evaluate(ctx context.Context, signal Signal) (*Finding, error) {
+	at := strings.LastIndex(signal.Email, "@")
+	if at < 0 {
+		return nil, nil
+	}
+	domain := strings.ToLower(signal.Email[at+1:])
+	if !d.domains[domain] {
+		return nil, nil
+	}
+	return &Finding{Score: d.Score, Reason: "Disposable email domain " + domain}, nil
+}
+
+//Flags phone numbers in ranges assigned to VoIP providers, set with RISK_VOIP_PREFIXES e.g. +1555,+44701
+type VoIPPhoneRule struct {
+	prefixes []string
+	Score    int
+}
+
+func NewVoIPPhoneRule(prefixes string) *VoIPPhoneRule {
+	return &VoIPPhoneRule{prefixes: splitList(prefixes), Score: 30}
+}
+
+func (v *VoIPPhoneRule) Name() string {
+	return "voip_phone"
+}
+
+func (v *VoIPPhoneRule) Evaluate(ctx context.Context, signal Signal) (*Finding, error) {
+	phone := strings.Replace(signal.Phone, " ", "", -1)
+	for _, prefix := range v.prefixes {
+		if phone != "" && strings.HasPrefix(phone, prefix) {
+			return &Finding{Score: v.Score, Reason: "VoIP phone range " + prefix}, nil
+		}
+	}
+	return nil, nil
+}
+
+//Scores requests by the reputation of their IP address
+type IPReputationRule struct {
+	Checker  *reputation.Checker
+	MaxScore int //Risk added for an address with the worst reputation
+}
+
+func NewIPReputationRule(checker *reputation.Checker) *IPReputationRule {
+	return &IPReputationRule{Checker: checker, MaxScore: 60}
+}
+
+func (i *IPReputationRule) Name() string {
+	return "ip_reputation"
+}
+
+func (i *IPReputationRule) Evaluate(ctx context.Context, signal Signal) (*Finding, error) {
+	blocked, verdict := i.Checker.Blocked(ctx, signal.IP, "risk")
+	if verdict.Score == 0 {
+		return nil, nil
+	}
+	reason := fmt.Sprintf("IP address scored %d by %s", verdict.Score, verdict.Source)
+	if verdict.Reason != "" {
+		reason += ", " + verdict.Reason
+	}
+	if blocked {
+		reason += ", blocked"
+	}
+	return &Finding{Score: verdict.Score * i.MaxScore / 100, Reason: reason}, nil
+}
+
+//Flags many actions from the same IP address in a short time
+type VelocityRule struct {
+	mu     sync.Mutex
+	events map[string][]time.Time
+	Limits map[string]int //Allowed actions per window by action
+	Window time.Duration
+	Score  int
+}
+
+func NewVelocityRule() *VelocityRule {
+	return &VelocityRule{
+		events: map[string][]time.Time{},
+		Limits: map[string]int{Register: envInt("RISK_REGISTRATIONS_PER_HOUR", 3), Login: envInt("RISK_LOGINS_PER_HOUR", 20)},
+		Window: time.Hour,
+		Score:  50,
+	}
+}
+
+func (v *VelocityRule) Name() string {
+	return "velocity"
+}
+
+func (v *VelocityRule) Evaluate(ctx context.Context, signal Signal) (*Finding, error) {
+	limit, ok := v.Limits[signal.Action]
+	if !ok || signal.IP == "" {
+		return nil, nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := time.Now()
+	key := signal.Action + ":" + signal.IP
+	recent := []time.Time{now}
+	for _, at := range v.events[key] {
+		if now.Sub(at) < v.Window {
+			recent = append(recent, at)
+		}
+	}
+	v.events[key] = recent
+
+	//Forget addresses that went quiet so the map doesn't grow forever
+	for other, times := range v.events {
+		if len(times) > 0 && now.Sub(times[0]) >= v.Window {
+			delete(v.events, other)
+		}
+	}
+
+	if len(recent) <= limit {
+		return nil, nil
+	}
+	return &Finding{Score: v.Score, Reason: fmt.Sprintf("%d %s attempts from %s within %s", len(recent), signal.Action, signal.IP, v.Window)}, nil
+}
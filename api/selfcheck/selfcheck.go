@@ -0,0 +1,87 @@
+package selfcheck
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+//Check outcomes
+const (
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+//Returned by checks that don't apply to this deployment, e.g. no SMTP server configured
+var ErrSkipped = errors.New("Skipped")
+
+//One item of the checklist, the detail describes what was checked
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) (detail string, err error)
+}
+
+//Outcome of one check
+type Result struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Detail     string  `json:"detail,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+//Outcome of the whole checklist
+type Report struct {
+	OK      bool      `json:"ok"`
+	RanAt   time.Time `json:"ran_at"`
+	Results []Result  `json:"results"`
+}
+
+//Runs the checklist and keeps the last report
+type Runner struct {
+	mu      sync.RWMutex
+	checks  []Check
+	last    *Report
+	Timeout time.Duration //Per check
+}
+
+func NewRunner(checks ...Check) *Runner {
+	return &Runner{checks: checks, Timeout: 15 * time.Second}
+}
+
+//Run every check in order, failures don't stop the later checks
+func (r *Runner) Run(ctx context.Context) Report {
+	report := Report{OK: true, RanAt: time.Now(), Results: []Result{}}
+
+	for _, check := range r.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, r.Timeout)
+		started := time.Now()
+		detail, err := check.Run(checkCtx)
+		cancel()
+
+		result := Result{Name: check.Name, Status: StatusOK, Detail: detail, DurationMs: float64(time.Since(started).Microseconds()) / 1000}
+		switch {
+		case err == ErrSkipped:
+			result.Status = StatusSkipped
+		case err != nil:
+			result.Status = StatusFailed
+			result.Error = err.Error()
+			report.OK = false
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	r.mu.Lock()
+	r.last = &report
+	r.mu.Unlock()
+	return report
+}
+
+//Report of the last run, nil before the first
+func (r *Runner) Last() *Report {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.last
+}
@@ -16,13 +16,7 @@ func Run() {
 
 	//var port = os.Getenv("PORT")
 
-	var err error
-	err = godotenv.Load()
-	if err != nil {
-		log.Fatalf("Error fetching env, not coming through %v", err)
-	} else {
-		fmt.Println("Fetching the env values")
-	}
+	loadEnv()
 
 	server.Initialize(os.Getenv("DB_DRIVER"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_NAME"))
 
@@ -30,3 +24,13 @@ func Run() {
 	server.Run(":" + "8081") //Port for listening and serving requests.
 
 }
+
+//Reads the .env file into the environment
+func loadEnv() {
+	err := godotenv.Load()
+	if err != nil {
+		log.Fatalf("Error fetching env, not coming through %v", err)
+	} else {
+		fmt.Println("Fetching the env values")
+	}
+}
@@ -0,0 +1,121 @@
+package sms
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/dependency"
+	"github.com/victorkabata/FixIt-API/api/httpclient"
+)
+
+//Africa's Talking bulk SMS API, which reaches East African networks cheaply
+type AfricasTalking struct {
+	BaseURL  string
+	Username string
+	APIKey   string
+	SenderID string //Registered short code or alphanumeric sender, the shared one when empty
+	//Secret in the callback URLs, as Africa's Talking doesn't sign its callbacks
+	WebhookSecret string
+	Client        *http.Client
+}
+
+func NewAfricasTalkingFromEnv() *AfricasTalking {
+	username := os.Getenv("AT_USERNAME")
+	baseURL := "https://api.africastalking.com/version1"
+	//The sandbox account has its own host
+	if username == "sandbox" {
+		baseURL = "https://api.sandbox.africastalking.com/version1"
+	}
+	return &AfricasTalking{
+		BaseURL:       baseURL,
+		Username:      username,
+		APIKey:        os.Getenv("AT_API_KEY"),
+		SenderID:      os.Getenv("AT_SENDER_ID"),
+		WebhookSecret: os.Getenv("AT_WEBHOOK_SECRET"),
+		Client:        httpclient.New("africastalking", 10*time.Second),
+	}
+}
+
+func (a *AfricasTalking) Name() string {
+	return "africastalking"
+}
+
+func (a *AfricasTalking) Send(ctx context.Context, message Message) error {
+	form := url.Values{}
+	form.Set("username", a.Username)
+	form.Set("to", message.To)
+	form.Set("message", message.Body)
+	if a.SenderID != "" {
+		form.Set("from", a.SenderID)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, a.BaseURL+"/messaging", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("apiKey", a.APIKey)
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := a.Client.Do(request)
+	if err != nil {
+		return dependency.Wrap(dependency.SMS, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusOK {
+		return dependency.FromStatus(dependency.SMS, response.StatusCode, fmt.Errorf("Sending SMS failed with status %d", response.StatusCode))
+	}
+
+	//A batch is accepted as a whole, each recipient has its own status
+	result := struct {
+		SMSMessageData struct {
+			Recipients []struct {
+				Status     string `json:"status"`
+				StatusCode int    `json:"statusCode"`
+			} `json:"Recipients"`
+		} `json:"SMSMessageData"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return dependency.Wrap(dependency.SMS, err)
+	}
+	for _, recipient := range result.SMSMessageData.Recipients {
+		//100 to 102 are processed, queued and sent
+		if recipient.StatusCode < 100 || recipient.StatusCode > 102 {
+			return dependency.New(dependency.SMS, dependency.Rejected, fmt.Errorf("Sending SMS to %s failed: %s", message.To, recipient.Status))
+		}
+	}
+	if len(result.SMSMessageData.Recipients) == 0 {
+		return dependency.New(dependency.SMS, dependency.Rejected, fmt.Errorf("Sending SMS to %s failed: no recipients accepted", message.To))
+	}
+	return nil
+}
+
+//Reads the incoming messages and delivery reports callbacks, both posted as forms with the secret in the
+//URL. Reports of messages that failed or were rejected are failures, other statuses carry nothing relevant.
+func (a *AfricasTalking) ParseWebhook(r *http.Request, body []byte) ([]Event, error) {
+	if a.WebhookSecret == "" || subtle.ConstantTimeCompare([]byte(a.WebhookSecret), []byte(r.URL.Query().Get("secret"))) != 1 {
+		return nil, ErrInvalidSignature
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+
+	//Delivery reports carry a status, incoming messages the text
+	switch status := form.Get("status"); {
+	case status == "Failed" || status == "Rejected":
+		return []Event{{Phone: form.Get("phoneNumber"), Type: EventFailed, Reason: status + " " + form.Get("failureReason")}}, nil
+	case status == "" && form.Get("from") != "":
+		return []Event{{Phone: form.Get("from"), Type: EventReply, Text: form.Get("text")}}, nil
+	}
+	return []Event{}, nil
+}
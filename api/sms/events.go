@@ -0,0 +1,96 @@
+package sms
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+//What SMS providers report to the webhook
+const (
+	EventReply  = "reply"  //Text a user sent to our number
+	EventFailed = "failed" //Message of ours the network couldn't deliver
+)
+
+//Keywords of replies, carriers and providers stop texting a number that replies STOP
+const (
+	KeywordStop  = "stop"
+	KeywordStart = "start"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("Unknown SMS Provider")
+	ErrInvalidSignature = errors.New("Invalid Webhook Signature")
+)
+
+//Reply or delivery failure reported by the provider, Phone is the user's number in E.164
+type Event struct {
+	Phone  string
+	Type   string
+	Text   string //Body of replies
+	Reason string //Error of failures as the provider gives it
+}
+
+//SMS provider such as Twilio or Africa's Talking that posts replies and delivery reports to a webhook
+type EventSource interface {
+	Name() string
+	//Verify a webhook and read the events in it, none when it carries nothing relevant
+	ParseWebhook(r *http.Request, body []byte) ([]Event, error)
+}
+
+var (
+	eventSources     = map[string]EventSource{}
+	eventSourcesLock sync.RWMutex
+	eventSourcesOnce sync.Once
+)
+
+//Make an event source available by its name
+func RegisterEventSource(source EventSource) {
+	eventSourcesLock.Lock()
+	defer eventSourcesLock.Unlock()
+	eventSources[source.Name()] = source
+}
+
+//Register the event sources configured in the environment
+func registerEventSourcesFromEnv() {
+	if os.Getenv("TWILIO_AUTH_TOKEN") != "" {
+		RegisterEventSource(NewTwilioFromEnv())
+	}
+	if os.Getenv("AT_WEBHOOK_SECRET") != "" {
+		RegisterEventSource(NewAfricasTalkingFromEnv())
+	}
+}
+
+//Find a registered event source by name
+func GetEventSource(name string) (EventSource, error) {
+	eventSourcesOnce.Do(registerEventSourcesFromEnv)
+
+	eventSourcesLock.RLock()
+	defer eventSourcesLock.RUnlock()
+	source, ok := eventSources[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return source, nil
+}
+
+//Words Twilio and the carriers take as opting out of texts and back in, whatever the case
+var keywords = map[string]string{
+	"stop":        KeywordStop,
+	"stopall":     KeywordStop,
+	"unsubscribe": KeywordStop,
+	"cancel":      KeywordStop,
+	"end":         KeywordStop,
+	"quit":        KeywordStop,
+	"optout":      KeywordStop,
+	"start":       KeywordStart,
+	"unstop":      KeywordStart,
+	"yes":         KeywordStart,
+}
+
+//KeywordStop or KeywordStart when the reply is one of their words alone, empty for other texts
+func Keyword(text string) string {
+	return keywords[strings.ToLower(strings.Trim(text, " \t\r\n.!"))]
+}
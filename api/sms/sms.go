@@ -0,0 +1,56 @@
+package sms
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+type Message struct {
+	To   string //E.164 number, +254712345678
+	Body string
+}
+
+//Delivers text messages, implemented by Twilio, Africa's Talking and a logger for development
+type Sender interface {
+	Name() string
+	Send(ctx context.Context, message Message) error
+}
+
+//Prints messages instead of sending them, used when no SMS provider is configured
+type LogSender struct{}
+
+func (s *LogSender) Name() string {
+	return "log"
+}
+
+func (s *LogSender) Send(ctx context.Context, message Message) error {
+	log.Printf("SMS to %s: %s", message.To, message.Body)
+	return nil
+}
+
+//Picks the sender from SMS_PROVIDER, twilio or africastalking, logging the messages when it is unset
+func New() Sender {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("SMS_PROVIDER"))) {
+	case "twilio":
+		return NewTwilioFromEnv()
+	case "africastalking":
+		return NewAfricasTalkingFromEnv()
+	}
+	return &LogSender{}
+}
+
+var (
+	defaultSender Sender
+	defaultOnce   sync.Once
+)
+
+//Sends a text message with the default sender
+func Send(ctx context.Context, message Message) error {
+	defaultOnce.Do(func() {
+		defaultSender = New()
+	})
+	return defaultSender.Send(ctx, message)
+}
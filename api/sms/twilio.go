@@ -0,0 +1,125 @@
+package sms
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/dependency"
+	"github.com/victorkabata/FixIt-API/api/httpclient"
+)
+
+//Twilio's Messages API
+type Twilio struct {
+	BaseURL    string
+	AccountSID string
+	AuthToken  string
+	From       string //Number or messaging service the messages come from
+	//Scheme and host Twilio calls the webhook on, such as https://api.example.com, the request's host when empty
+	WebhookURL string
+	Client     *http.Client
+}
+
+func NewTwilioFromEnv() *Twilio {
+	return &Twilio{
+		BaseURL:    "https://api.twilio.com/2010-04-01",
+		AccountSID: os.Getenv("TWILIO_ACCOUNT_SID"),
+		AuthToken:  os.Getenv("TWILIO_AUTH_TOKEN"),
+		From:       os.Getenv("TWILIO_FROM"),
+		WebhookURL: strings.TrimSuffix(os.Getenv("TWILIO_WEBHOOK_URL"), "/"),
+		Client:     httpclient.New("twilio", 10*time.Second),
+	}
+}
+
+func (t *Twilio) Name() string {
+	return "twilio"
+}
+
+func (t *Twilio) Send(ctx context.Context, message Message) error {
+	form := url.Values{}
+	form.Set("To", message.To)
+	form.Set("Body", message.Body)
+	//Messaging service IDs start with MG, anything else is a number
+	if strings.HasPrefix(t.From, "MG") {
+		form.Set("MessagingServiceSid", t.From)
+	} else {
+		form.Set("From", t.From)
+	}
+
+	endpoint := fmt.Sprintf("%s/Accounts/%s/Messages.json", t.BaseURL, url.PathEscape(t.AccountSID))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.SetBasicAuth(t.AccountSID, t.AuthToken)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := t.Client.Do(request)
+	if err != nil {
+		return dependency.Wrap(dependency.SMS, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusOK {
+		return dependency.FromStatus(dependency.SMS, response.StatusCode, fmt.Errorf("Sending SMS failed with status %d", response.StatusCode))
+	}
+	return nil
+}
+
+//Verifies X-Twilio-Signature, an HMAC-SHA1 with the auth token of the URL Twilio called followed by each
+//form field's name and value, sorted by name
+func (t *Twilio) verifySignature(r *http.Request, form url.Values) bool {
+	if t.AuthToken == "" {
+		return false
+	}
+	base := t.WebhookURL
+	if base == "" {
+		base = "https://" + r.Host
+	}
+	signed := base + r.URL.RequestURI()
+	names := make([]string, 0, len(form))
+	for name := range form {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range form[name] {
+			signed += name + value
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(t.AuthToken))
+	mac.Write([]byte(signed))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Twilio-Signature")))
+}
+
+//Reads incoming messages and status callbacks, both posted as forms. Messages that failed or went
+//undelivered are failures, other statuses carry nothing relevant.
+func (t *Twilio) ParseWebhook(r *http.Request, body []byte) ([]Event, error) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	if !t.verifySignature(r, form) {
+		return nil, ErrInvalidSignature
+	}
+
+	switch status := form.Get("MessageStatus"); {
+	case status == "failed" || status == "undelivered":
+		return []Event{{Phone: form.Get("To"), Type: EventFailed, Reason: status + " " + form.Get("ErrorCode")}}, nil
+	case status == "" || status == "received":
+		if form.Get("From") == "" {
+			return []Event{}, nil
+		}
+		return []Event{{Phone: form.Get("From"), Type: EventReply, Text: form.Get("Body")}}, nil
+	}
+	return []Event{}, nil
+}
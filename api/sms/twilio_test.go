@@ -0,0 +1,70 @@
+package sms
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+//The example of Twilio's webhook security documentation
+const (
+	twilioExampleToken     = "12345"
+	twilioExampleSignature = "0/KCTR6DLpKmkAf8muzZqo1nDgQ="
+)
+
+func twilioExampleForm() url.Values {
+	return url.Values{
+		"CallSid": {"CA1234567890ABCDE"},
+		"Caller":  {"+12349013030"},
+		"Digits":  {"1234"},
+		"From":    {"+12349013030"},
+		"To":      {"+18005551212"},
+	}
+}
+
+func TestTwilioVerifySignature(t *testing.T) {
+	tampered := twilioExampleForm()
+	tampered.Set("Digits", "1235")
+	added := twilioExampleForm()
+	added.Set("Body", "hello")
+
+	tests := []struct {
+		name       string
+		token      string
+		webhookURL string
+		host       string
+		target     string
+		form       url.Values
+		signature  string
+		want       bool
+	}{
+		{"documented example", twilioExampleToken, "https://mycompany.com", "internal:8080", "/myapp.php?foo=1&bar=2", twilioExampleForm(), twilioExampleSignature, true},
+		{"request host when no webhook URL", twilioExampleToken, "", "mycompany.com", "/myapp.php?foo=1&bar=2", twilioExampleForm(), twilioExampleSignature, true},
+		{"tampered field", twilioExampleToken, "https://mycompany.com", "", "/myapp.php?foo=1&bar=2", tampered, twilioExampleSignature, false},
+		{"added field", twilioExampleToken, "https://mycompany.com", "", "/myapp.php?foo=1&bar=2", added, twilioExampleSignature, false},
+		{"other query", twilioExampleToken, "https://mycompany.com", "", "/myapp.php?foo=1&bar=3", twilioExampleForm(), twilioExampleSignature, false},
+		{"other host", twilioExampleToken, "https://example.com", "", "/myapp.php?foo=1&bar=2", twilioExampleForm(), twilioExampleSignature, false},
+		{"other auth token", "54321", "https://mycompany.com", "", "/myapp.php?foo=1&bar=2", twilioExampleForm(), twilioExampleSignature, false},
+		{"tampered signature", twilioExampleToken, "https://mycompany.com", "", "/myapp.php?foo=1&bar=2", twilioExampleForm(), "1" + twilioExampleSignature[1:], false},
+		{"no signature", twilioExampleToken, "https://mycompany.com", "", "/myapp.php?foo=1&bar=2", twilioExampleForm(), "", false},
+		{"no auth token", "", "https://mycompany.com", "", "/myapp.php?foo=1&bar=2", twilioExampleForm(), twilioExampleSignature, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := test.form.Encode()
+			r := httptest.NewRequest("POST", test.target, strings.NewReader(body))
+			if test.host != "" {
+				r.Host = test.host
+			}
+			r.Header.Set("X-Twilio-Signature", test.signature)
+			twilio := &Twilio{AuthToken: test.token, WebhookURL: test.webhookURL}
+			if got := twilio.verifySignature(r, test.form); got != test.want {
+				t.Errorf("verifySignature = %v, want %v", got, test.want)
+			}
+			if _, err := twilio.ParseWebhook(r, []byte(body)); (err != ErrInvalidSignature) != test.want {
+				t.Errorf("ParseWebhook = %v, want the signature accepted: %v", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+//Settings of the S3 bucket uploads go to
+type S3Config struct {
+	Bucket       string //S3_BUCKET
+	Region       string //AWS_REGION
+	BaseURL      string //S3_BASE_URL, public address of the bucket ending with a slash, such as a CDN in front of it
+	ACL          string //S3_ACL, canned ACL of public files, private files are always private
+	StorageClass string //S3_STORAGE_CLASS
+}
+
+//The settings the app started with
+var defaultS3Config = S3Config{
+	Bucket:       "vickikbt-fixit-app",
+	Region:       "us-east-2",
+	ACL:          s3.ObjectCannedACLPublicRead,
+	StorageClass: s3.StorageClassIntelligentTiering,
+}
+
+//Settings from the environment, unset ones keep the defaults and the base URL defaults to the bucket's own address
+func S3ConfigFromEnv() S3Config {
+	config := defaultS3Config
+	for setting, value := range map[*string]string{
+		&config.Bucket:       os.Getenv("S3_BUCKET"),
+		&config.Region:       os.Getenv("AWS_REGION"),
+		&config.BaseURL:      os.Getenv("S3_BASE_URL"),
+		&config.ACL:          os.Getenv("S3_ACL"),
+		&config.StorageClass: os.Getenv("S3_STORAGE_CLASS"),
+	} {
+		if value = strings.TrimSpace(value); value != "" {
+			*setting = value
+		}
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = "https://" + config.Bucket + ".s3." + config.Region + ".amazonaws.com/"
+	}
+	if !strings.HasSuffix(config.BaseURL, "/") {
+		config.BaseURL += "/"
+	}
+	return config
+}
+
+var (
+	bucketPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+	regionPattern = regexp.MustCompile(`^[a-z]{2}(-gov)?-[a-z]+-[0-9]$`)
+	cannedACLs    = map[string]bool{
+		s3.ObjectCannedACLPrivate:                true,
+		s3.ObjectCannedACLPublicRead:             true,
+		s3.ObjectCannedACLPublicReadWrite:        true,
+		s3.ObjectCannedACLAuthenticatedRead:      true,
+		s3.ObjectCannedACLAwsExecRead:            true,
+		s3.ObjectCannedACLBucketOwnerRead:        true,
+		s3.ObjectCannedACLBucketOwnerFullControl: true,
+	}
+	storageClasses = map[string]bool{
+		s3.StorageClassStandard:           true,
+		s3.StorageClassReducedRedundancy:  true,
+		s3.StorageClassStandardIa:         true,
+		s3.StorageClassOnezoneIa:          true,
+		s3.StorageClassIntelligentTiering: true,
+		s3.StorageClassGlacier:            true,
+		s3.StorageClassDeepArchive:        true,
+	}
+)
+
+func (c S3Config) Validate() error {
+	if !bucketPattern.MatchString(c.Bucket) {
+		return fmt.Errorf("Invalid S3_BUCKET %q", c.Bucket)
+	}
+	if !regionPattern.MatchString(c.Region) {
+		return fmt.Errorf("Invalid AWS_REGION %q", c.Region)
+	}
+	base, err := url.Parse(c.BaseURL)
+	if err != nil || (base.Scheme != "https" && base.Scheme != "http") || base.Host == "" || base.RawQuery != "" || !strings.HasSuffix(c.BaseURL, "/") {
+		return fmt.Errorf("Invalid S3_BASE_URL %q", c.BaseURL)
+	}
+	if !cannedACLs[c.ACL] {
+		return fmt.Errorf("Invalid S3_ACL %q", c.ACL)
+	}
+	if !storageClasses[c.StorageClass] {
+		return fmt.Errorf("Invalid S3_STORAGE_CLASS %q", c.StorageClass)
+	}
+	return nil
+}
+
+//Public address of the file
+func (c S3Config) URL(key string) string {
+	return c.BaseURL + key
+}
+
+var (
+	s3ConfigMu     sync.Mutex
+	s3ConfigLoaded *S3Config
+)
+
+//Read and validate the settings from the environment, called at start up so a bad setting stops the server
+func LoadS3Config() (S3Config, error) {
+	config := S3ConfigFromEnv()
+	err := config.Validate()
+	if err != nil {
+		return config, err
+	}
+	s3ConfigMu.Lock()
+	s3ConfigLoaded = &config
+	s3ConfigMu.Unlock()
+	return config, nil
+}
+
+//The settings in use, those of LoadS3Config or the environment when it didn't run, such as in commands
+func S3Settings() S3Config {
+	s3ConfigMu.Lock()
+	defer s3ConfigMu.Unlock()
+	if s3ConfigLoaded == nil {
+		config := S3ConfigFromEnv()
+		s3ConfigLoaded = &config
+	}
+	return *s3ConfigLoaded
+}
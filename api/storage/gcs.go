@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/victorkabata/FixIt-API/api/dependency"
+	"github.com/victorkabata/FixIt-API/api/httpclient"
+)
+
+const (
+	gcsUploadURL = "https://storage.googleapis.com/upload/storage/v1/b/"
+	gcsObjectURL = "https://storage.googleapis.com/storage/v1/b/"
+	gcsPublicURL = "https://storage.googleapis.com/"
+	gcsScope     = "https://www.googleapis.com/auth/devstorage.read_write"
+)
+
+//Files in a Google Cloud Storage bucket, through its JSON API with a service account.
+//The bucket has to be readable by allUsers for the URLs to open, private files go to a second bucket
+//that isn't and are opened with links signed by the service account.
+type GCS struct {
+	Bucket        string
+	PrivateBucket string
+	Email         string //Of the service account
+	Key           *rsa.PrivateKey
+	TokenURL      string
+	Client        *http.Client
+
+	mu           sync.Mutex
+	token        string
+	tokenExpires time.Time
+}
+
+//Service account from the key file at GCS_CREDENTIALS_FILE, or GOOGLE_APPLICATION_CREDENTIALS
+func NewGCSFromEnv(bucket, privateBucket string) (*GCS, error) {
+	path := os.Getenv("GCS_CREDENTIALS_FILE")
+	if path == "" {
+		path = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	if path == "" {
+		return nil, errors.New("GCS_CREDENTIALS_FILE is required with the gcs backend")
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	account := struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}{}
+	err = json.Unmarshal(content, &account)
+	if err != nil {
+		return nil, err
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &GCS{
+		Bucket:        bucket,
+		PrivateBucket: privateBucket,
+		Email:         account.ClientEmail,
+		Key:           key,
+		TokenURL:      account.TokenURI,
+		Client:        httpclient.New("gcs", 30*time.Second),
+	}, nil
+}
+
+//Access token of the service account, exchanged for a signed assertion and reused until shortly before it expires
+func (g *GCS) accessToken(ctx context.Context) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.token != "" && time.Now().Before(g.tokenExpires) {
+		return g.token, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   g.Email,
+		"scope": gcsScope,
+		"aud":   g.TokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(g.Key)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	request, err := http.NewRequest("POST", g.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := g.Client.Do(request.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	//A refused assertion is a broken service account, whatever the status says
+	if response.StatusCode == http.StatusBadRequest || response.StatusCode == http.StatusUnauthorized {
+		return "", dependency.New(dependency.GCS, dependency.Permanent, gcsMessage(response))
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", gcsError(response)
+	}
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&token)
+	if err != nil {
+		return "", err
+	}
+	g.token = token.AccessToken
+	g.tokenExpires = now.Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return g.token, nil
+}
+
+//Sends an authorized request to the JSON API
+func (g *GCS) do(ctx context.Context, method, address, contentType string, body io.Reader) (*http.Response, error) {
+	token, err := g.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(method, address, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	return g.Client.Do(request.WithContext(ctx))
+}
+
+func (g *GCS) Upload(ctx context.Context, key string, body []byte, contentType string) error {
+	return g.upload(ctx, g.Bucket, key, bytes.NewReader(body), contentType)
+}
+
+func (g *GCS) UploadPrivate(ctx context.Context, key string, body io.Reader, contentType string) error {
+	return g.upload(ctx, g.PrivateBucket, key, body, contentType)
+}
+
+func (g *GCS) upload(ctx context.Context, bucket, key string, body io.Reader, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	address := gcsUploadURL + url.PathEscape(bucket) + "/o?uploadType=media&name=" + url.QueryEscape(key)
+	response, err := g.do(ctx, "POST", address, contentType, body)
+	if err != nil {
+		return dependency.Wrap(dependency.GCS, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return gcsError(response)
+	}
+	return nil
+}
+
+//The key is removed from both buckets, callers don't track which one a file went to
+func (g *GCS) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	for _, bucket := range []string{g.Bucket, g.PrivateBucket} {
+		if bucket == "" {
+			continue
+		}
+		response, err := g.do(ctx, "DELETE", gcsObjectURL+url.PathEscape(bucket)+"/o/"+url.PathEscape(key), "", nil)
+		if err != nil {
+			return dependency.Wrap(dependency.GCS, err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusNotFound {
+			return gcsError(response)
+		}
+	}
+	return nil
+}
+
+func (g *GCS) URL(key string) string {
+	return gcsPublicURL + g.Bucket + "/" + key
+}
+
+//V4 signed link to a file of the private bucket, signed with the service account's key
+func (g *GCS) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	timestamp := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/auto/storage/goog4_request"
+
+	segments := strings.Split(key, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	path := "/" + url.PathEscape(g.PrivateBucket) + "/" + strings.Join(segments, "/")
+	query := url.Values{
+		"X-Goog-Algorithm":     {"GOOG4-RSA-SHA256"},
+		"X-Goog-Credential":    {g.Email + "/" + scope},
+		"X-Goog-Date":          {timestamp},
+		"X-Goog-Expires":       {strconv.Itoa(int(expires.Seconds()))},
+		"X-Goog-SignedHeaders": {"host"},
+	}
+	//Encode sorts by key, spaces can't occur in the values
+	canonicalQuery := query.Encode()
+	canonicalRequest := strings.Join([]string{"GET", path, canonicalQuery, "host:storage.googleapis.com", "", "host", "UNSIGNED-PAYLOAD"}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"GOOG4-RSA-SHA256", timestamp, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	digest := sha256.Sum256([]byte(stringToSign))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, g.Key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return "https://storage.googleapis.com" + path + "?" + canonicalQuery + "&X-Goog-Signature=" + hex.EncodeToString(signature), nil
+}
+
+//Error of a failed request typed by its status
+func gcsError(response *http.Response) error {
+	return dependency.FromStatus(dependency.GCS, response.StatusCode, gcsMessage(response))
+}
+
+//Error with the message Google sent
+func gcsMessage(response *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 4096))
+	return fmt.Errorf("Google Cloud Storage answered %s: %s", response.Status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/victorkabata/FixIt-API/api/utils/tokens"
+)
+
+//Files in a directory on the server's disk, served by Handler. Private files are kept in a second directory
+//and served by PrivateHandler to signed links. Only fits a single instance.
+type Local struct {
+	Dir        string
+	BaseURL    string //Address Handler is reachable at
+	PrivateDir string
+	PrivateURL string //Address PrivateHandler is reachable at
+	Secret     string //Signs the links to private files
+}
+
+//Directory from STORAGE_DIR, uploads by default, served at STORAGE_URL, /media by default. Private files go
+//to STORAGE_PRIVATE_DIR, private-uploads by default, and their links are signed with API_SECRET.
+func NewLocalFromEnv() *Local {
+	local := &Local{
+		Dir:        os.Getenv("STORAGE_DIR"),
+		BaseURL:    os.Getenv("STORAGE_URL"),
+		PrivateDir: os.Getenv("STORAGE_PRIVATE_DIR"),
+		PrivateURL: "/private-media",
+		Secret:     os.Getenv("API_SECRET"),
+	}
+	if local.Dir == "" {
+		local.Dir = "uploads"
+	}
+	if local.BaseURL == "" {
+		local.BaseURL = "/media"
+	}
+	if local.PrivateDir == "" {
+		local.PrivateDir = "private-uploads"
+	}
+	local.BaseURL = strings.TrimSuffix(local.BaseURL, "/")
+	return local
+}
+
+func (l *Local) path(dir, key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) Upload(ctx context.Context, key string, body []byte, contentType string) error {
+	return l.write(ctx, l.Dir, key, bytes.NewReader(body))
+}
+
+func (l *Local) UploadPrivate(ctx context.Context, key string, body io.Reader, contentType string) error {
+	return l.write(ctx, l.PrivateDir, key, body)
+}
+
+func (l *Local) write(ctx context.Context, dir, key string, body io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	path, err := l.path(dir, key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	//Written next to the file and renamed over it, so readers never see half a file
+	temp, err := ioutil.TempFile(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(temp, body)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	for _, dir := range []string{l.Dir, l.PrivateDir} {
+		path, err := l.path(dir, key)
+		if err != nil {
+			return err
+		}
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Local) URL(key string) string {
+	return l.BaseURL + "/" + key
+}
+
+func (l *Local) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	expiry := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	query := url.Values{"expires": {expiry}, "signature": {tokens.Sign(l.Secret, key+":"+expiry)}}
+	return l.PrivateURL + "/" + key + "?" + query.Encode(), nil
+}
+
+//Serves the private files under prefix to links made by SignedURL until they expire
+func (l *Local) PrivateHandler(prefix string) http.Handler {
+	files := http.StripPrefix(prefix, http.FileServer(http.Dir(l.PrivateDir)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, prefix)
+		expiry := r.URL.Query().Get("expires")
+		expires, err := strconv.ParseInt(expiry, 10, 64)
+		if checkKey(key) != nil || err != nil || time.Now().Unix() > expires || !tokens.Verify(l.Secret, key+":"+expiry, r.URL.Query().Get("signature")) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Disposition", "attachment")
+		w.Header().Set("Cache-Control", "private, no-store")
+		files.ServeHTTP(w, r)
+	})
+}
+
+//Serves the files under prefix as downloads, like the S3 backend does, without directory listings
+func (l *Local) Handler(prefix string) http.Handler {
+	files := http.StripPrefix(prefix, http.FileServer(http.Dir(l.Dir)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") || strings.Contains(r.URL.Path, "/.") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Disposition", "attachment")
+		files.ServeHTTP(w, r)
+	})
+}
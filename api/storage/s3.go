@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/victorkabata/FixIt-API/api/dependency"
+)
+
+//Files in an S3 bucket, readable by anyone unless they were uploaded private
+type S3 struct {
+	Client *s3.S3
+	Config S3Config
+}
+
+//Session in the configured region with the AWS_SECRET_ID and AWS_SECRET_KEY credentials
+func NewAWSSession(config S3Config) (*session.Session, error) {
+	return session.NewSession(&aws.Config{
+		Region:      aws.String(config.Region),
+		Credentials: credentials.NewStaticCredentials(os.Getenv("AWS_SECRET_ID"), os.Getenv("AWS_SECRET_KEY"), ""),
+	})
+}
+
+func NewS3(config S3Config) (*S3, error) {
+	s, err := NewAWSSession(config)
+	if err != nil {
+		return nil, err
+	}
+	return &S3{Client: s3.New(s), Config: config}, nil
+}
+
+func (s *S3) Upload(ctx context.Context, key string, body []byte, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	_, err := s.Client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(s.Config.Bucket),
+		Key:                  aws.String(key),
+		ACL:                  aws.String(s.Config.ACL),
+		Body:                 bytes.NewReader(body),
+		ContentLength:        aws.Int64(int64(len(body))),
+		ContentType:          aws.String(contentType),
+		ContentDisposition:   aws.String("attachment"),
+		ServerSideEncryption: aws.String("AES256"),
+		StorageClass:         aws.String(s.Config.StorageClass),
+	})
+	return S3Error(err)
+}
+
+//Sent in parts, holding one in memory at a time whatever the size of the file
+func (s *S3) UploadPrivate(ctx context.Context, key string, body io.Reader, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	uploader := s3manager.NewUploaderWithClient(s.Client, func(u *s3manager.Uploader) {
+		u.Concurrency = 1
+	})
+	_, err := uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:               aws.String(s.Config.Bucket),
+		Key:                  aws.String(key),
+		ACL:                  aws.String(s3.ObjectCannedACLPrivate),
+		Body:                 body,
+		ContentType:          aws.String(contentType),
+		ContentDisposition:   aws.String("attachment"),
+		ServerSideEncryption: aws.String("AES256"),
+		StorageClass:         aws.String(s.Config.StorageClass),
+	})
+	return S3Error(err)
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	_, err := s.Client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Config.Bucket),
+		Key:    aws.String(key),
+	})
+	return S3Error(err)
+}
+
+func (s *S3) URL(key string) string {
+	return s.Config.URL(key)
+}
+
+func (s *S3) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	request, _ := s.Client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.Config.Bucket),
+		Key:    aws.String(key),
+	})
+	return request.Presign(expires)
+}
+
+func (s *S3) PresignUpload(key, contentType string, expires time.Duration) (string, http.Header, error) {
+	if err := checkKey(key); err != nil {
+		return "", nil, err
+	}
+	request, _ := s.Client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:               aws.String(s.Config.Bucket),
+		Key:                  aws.String(key),
+		ACL:                  aws.String(s.Config.ACL),
+		ContentType:          aws.String(contentType),
+		ContentDisposition:   aws.String("attachment"),
+		ServerSideEncryption: aws.String("AES256"),
+		StorageClass:         aws.String(s.Config.StorageClass),
+	})
+	return request.PresignRequest(expires)
+}
+
+func (s *S3) Inspect(ctx context.Context, key string) (int64, string, error) {
+	if err := checkKey(key); err != nil {
+		return 0, "", err
+	}
+	//Only the bytes http.DetectContentType looks at
+	output, err := s.Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Config.Bucket),
+		Key:    aws.String(key),
+		Range:  aws.String("bytes=0-511"),
+	})
+	if failure, ok := err.(awserr.RequestFailure); ok {
+		switch failure.StatusCode() {
+		case http.StatusNotFound:
+			return 0, "", ErrNotFound
+		case http.StatusRequestedRangeNotSatisfiable:
+			//Empty files have no first byte to start the range at
+			return 0, http.DetectContentType(nil), nil
+		}
+	}
+	if err != nil {
+		return 0, "", S3Error(err)
+	}
+	defer output.Body.Close()
+	head, err := ioutil.ReadAll(io.LimitReader(output.Body, 512))
+	if err != nil {
+		return 0, "", S3Error(err)
+	}
+
+	//The range answer gives the size of the whole file after the slash, such as bytes 0-511/20480
+	size := aws.Int64Value(output.ContentLength)
+	if contentRange := aws.StringValue(output.ContentRange); strings.Contains(contentRange, "/") {
+		size, err = strconv.ParseInt(contentRange[strings.LastIndex(contentRange, "/")+1:], 10, 64)
+		if err != nil {
+			return 0, "", err
+		}
+	}
+	return size, http.DetectContentType(head), nil
+}
+
+func (s *S3) Download(ctx context.Context, key string, limit int64) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	output, err := s.Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Config.Bucket),
+		Key:    aws.String(key),
+	})
+	if failure, ok := err.(awserr.RequestFailure); ok && failure.StatusCode() == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, S3Error(err)
+	}
+	defer output.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(output.Body, limit+1))
+	if err != nil {
+		return nil, S3Error(err)
+	}
+	if int64(len(body)) > limit {
+		return nil, ErrTooLarge
+	}
+	return body, nil
+}
+
+//Types a failure of an S3 call by the status S3 answered with, or by whether the SDK would retry it,
+//see dependency.Error. The multipart uploader keeps the failed part's error as OrigErr.
+func S3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	for cause := err; cause != nil; {
+		if failure, ok := cause.(awserr.RequestFailure); ok {
+			return dependency.FromStatus(dependency.S3, failure.StatusCode(), err)
+		}
+		wrapper, ok := cause.(awserr.Error)
+		if !ok {
+			break
+		}
+		cause = wrapper.OrigErr()
+	}
+	if request.IsErrorRetryable(err) || request.IsErrorThrottle(err) {
+		return dependency.New(dependency.S3, dependency.Retryable, err)
+	}
+	if failure, ok := err.(awserr.Error); ok && failure.Code() == request.CanceledErrorCode {
+		return dependency.New(dependency.S3, dependency.Retryable, err)
+	}
+	return dependency.Wrap(dependency.S3, err)
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+//Where files such as profile pictures and dispute evidence are kept, picked by STORAGE_BACKEND
+type Storage interface {
+	//Store the body under the key, replacing any file already there
+	Upload(ctx context.Context, key string, body []byte, contentType string) error
+	//Store the body under the key where only signed links open it, reading it as it is sent
+	UploadPrivate(ctx context.Context, key string, body io.Reader, contentType string) error
+	//Remove the file, public or private, keys that don't exist are not an error
+	Delete(ctx context.Context, key string) error
+	//Public address of the file
+	URL(key string) string
+	//Link to a private file that works until expires has passed
+	SignedURL(ctx context.Context, key string, expires time.Duration) (string, error)
+}
+
+//Backends clients can upload to directly with a signed link, so large bodies skip the API
+type Presigner interface {
+	//Link the client PUTs the file to before it expires, with the headers it has to send along
+	PresignUpload(key, contentType string, expires time.Duration) (string, http.Header, error)
+	//Size of an uploaded file and its type sniffed from the first bytes, ErrNotFound when nothing was uploaded
+	Inspect(ctx context.Context, key string) (int64, string, error)
+	//Contents of an uploaded file, failing with ErrTooLarge past limit bytes
+	Download(ctx context.Context, key string, limit int64) ([]byte, error)
+}
+
+var (
+	ErrInvalidKey = errors.New("Invalid Storage Key")
+	ErrNotFound   = errors.New("File Not Found")
+	ErrTooLarge   = errors.New("File too large")
+)
+
+//Reader counting what it reads and failing with ErrTooLarge past Limit bytes, where io.LimitReader stops quietly
+type LimitedReader struct {
+	Reader io.Reader
+	Limit  int64
+	Count  int64
+}
+
+func (l *LimitedReader) Read(p []byte) (int, error) {
+	n, err := l.Reader.Read(p)
+	l.Count += int64(n)
+	if l.Count > l.Limit {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
+
+//Keys are relative slash separated paths, so a key can't reach outside the bucket or directory
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+//Key of a file stored with the backend from its URL, false for URLs elsewhere such as pictures of identity providers
+func KeyFromURL(store Storage, url string) (string, bool) {
+	prefix := store.URL("")
+	if !strings.HasPrefix(url, prefix) {
+		return "", false
+	}
+	key := strings.TrimPrefix(url, prefix)
+	return key, checkKey(key) == nil
+}
+
+//The backend named by STORAGE_BACKEND: s3, the default, gcs or local
+func FromEnv() (Storage, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "s3":
+		return NewS3(S3Settings())
+	case "gcs":
+		bucket, privateBucket := os.Getenv("GCS_BUCKET"), os.Getenv("GCS_PRIVATE_BUCKET")
+		if bucket == "" || privateBucket == "" {
+			return nil, errors.New("GCS_BUCKET and GCS_PRIVATE_BUCKET are required with the gcs backend")
+		}
+		return NewGCSFromEnv(bucket, privateBucket)
+	case "local":
+		return NewLocalFromEnv(), nil
+	default:
+		return nil, fmt.Errorf("Unknown STORAGE_BACKEND %q", backend)
+	}
+}
@@ -0,0 +1,271 @@
+package templates
+
+//Every message sent to users. Notification templates are named after the kind of notification.
+func init() {
+	register("email_verification", map[string]Variant{
+		"en": {
+			Subject: "Verify your FixIt email",
+			Body: "Hi {{.Username}},\n\nOpen the link below within {{.Hours}} hours to verify your email address:\n\n{{.URL}}\n\n" +
+				"If you didn't sign up for FixIt, ignore this email.\n",
+		},
+		"sw": {
+			Subject: "Thibitisha barua pepe yako ya FixIt",
+			Body: "Habari {{.Username}},\n\nFungua kiungo kilicho hapa chini ndani ya saa {{.Hours}} ili kuthibitisha anwani yako ya barua pepe:\n\n{{.URL}}\n\n" +
+				"Ikiwa hukujisajili kwenye FixIt, puuza barua pepe hii.\n",
+		},
+	})
+
+	register("password_reset", map[string]Variant{
+		"en": {
+			Subject: "Reset your FixIt password",
+			Body: "Hi {{.Username}},\n\nOpen the link below within {{.Minutes}} minutes to choose a new password:\n\n{{.URL}}\n\n" +
+				"If you didn't ask for this, ignore this email and your password stays the same.\n",
+		},
+		"sw": {
+			Subject: "Weka upya nenosiri lako la FixIt",
+			Body: "Habari {{.Username}},\n\nFungua kiungo kilicho hapa chini ndani ya dakika {{.Minutes}} ili kuchagua nenosiri jipya:\n\n{{.URL}}\n\n" +
+				"Ikiwa hukuomba hili, puuza barua pepe hii na nenosiri lako litabaki vilevile.\n",
+		},
+	})
+
+	register("password_reset_done", map[string]Variant{
+		"en": {
+			Subject: "Your FixIt password was reset",
+			Body: "Hi {{.Username}},\n\nThe password on your FixIt account was just reset and every device was logged out. " +
+				"If this wasn't you, reset it again and check the email on your account.\n",
+		},
+		"sw": {
+			Subject: "Nenosiri lako la FixIt limewekwa upya",
+			Body: "Habari {{.Username}},\n\nNenosiri la akaunti yako ya FixIt limewekwa upya sasa hivi na vifaa vyote vimetolewa. " +
+				"Ikiwa si wewe, liweke upya tena na uangalie barua pepe iliyo kwenye akaunti yako.\n",
+		},
+	})
+
+	register("login_code", map[string]Variant{
+		"en": {
+			Subject: "Your FixIt verification code",
+			Body: "Hi {{.Username}},\n\nUse the code below to finish logging in to FixIt. It expires in {{.Minutes}} minutes.\n\n{{.Code}}\n\n" +
+				"If this wasn't you, change your password.\n",
+		},
+		"sw": {
+			Subject: "Nambari yako ya uthibitisho ya FixIt",
+			Body: "Habari {{.Username}},\n\nTumia nambari iliyo hapa chini kumaliza kuingia kwenye FixIt. Itaisha baada ya dakika {{.Minutes}}.\n\n{{.Code}}\n\n" +
+				"Ikiwa si wewe, badilisha nenosiri lako.\n",
+		},
+	})
+
+	//Texted, only the body is sent
+	register("phone_code", map[string]Variant{
+		"en": {
+			Subject: "FixIt phone verification",
+			Body:    "Your FixIt verification code is {{.Code}}. It expires in {{.Minutes}} minutes. Don't share it with anyone.",
+		},
+		"sw": {
+			Subject: "Uthibitisho wa simu wa FixIt",
+			Body:    "Nambari yako ya uthibitisho ya FixIt ni {{.Code}}. Itaisha baada ya dakika {{.Minutes}}. Usimpe mtu yeyote.",
+		},
+	})
+
+	register("data_export_ready", map[string]Variant{
+		"en": {
+			Subject: "Your FixIt data is ready",
+			Body: "Hi {{.Username}},\n\nThe archive of your FixIt data is ready. Open the link below within {{.Hours}} hours to download it, the link works once:\n\n{{.URL}}\n\n" +
+				"{{if .Protected}}When you open it, we'll email you a code to confirm it's you.\n\n{{end}}" +
+				"If you didn't ask for your data, change your password.\n",
+		},
+		"sw": {
+			Subject: "Data yako ya FixIt iko tayari",
+			Body: "Habari {{.Username}},\n\nKumbukumbu ya data yako ya FixIt iko tayari. Fungua kiungo kilicho hapa chini ndani ya saa {{.Hours}} ili kuipakua, kiungo kinafanya kazi mara moja tu:\n\n{{.URL}}\n\n" +
+				"{{if .Protected}}Ukikifungua, tutakutumia nambari kwa barua pepe ili kuthibitisha kuwa ni wewe.\n\n{{end}}" +
+				"Ikiwa hukuomba data yako, badilisha nenosiri lako.\n",
+		},
+	})
+
+	register("data_export_code", map[string]Variant{
+		"en": {
+			Subject: "Your FixIt download code",
+			Body: "Hi {{.Username}},\n\nUse the code below to download the archive of your FixIt data. It expires in {{.Minutes}} minutes.\n\n{{.Code}}\n\n" +
+				"If this wasn't you, change your password.\n",
+		},
+		"sw": {
+			Subject: "Nambari yako ya kupakua ya FixIt",
+			Body: "Habari {{.Username}},\n\nTumia nambari iliyo hapa chini kupakua kumbukumbu ya data yako ya FixIt. Itaisha baada ya dakika {{.Minutes}}.\n\n{{.Code}}\n\n" +
+				"Ikiwa si wewe, badilisha nenosiri lako.\n",
+		},
+	})
+
+	//Field is email, phone or password
+	register("security_change", map[string]Variant{
+		"en": {
+			Subject: "Your FixIt {{.Field}} was changed",
+			Body: "Hi {{.Username}},\n\nThe {{.Field}} on your FixIt account was just changed. " +
+				"If this wasn't you, open the link below within {{.Hours}} hours to undo the change and lock your account:\n\n{{.URL}}\n",
+		},
+		"sw": {
+			Subject: `{{if eq .Field "email"}}Barua pepe ya akaunti yako ya FixIt imebadilishwa{{else if eq .Field "phone"}}Nambari ya simu ya akaunti yako ya FixIt imebadilishwa{{else}}Nenosiri la akaunti yako ya FixIt limebadilishwa{{end}}`,
+			Body: `Habari {{.Username}},` + "\n\n" +
+				`{{if eq .Field "email"}}Barua pepe ya akaunti yako ya FixIt imebadilishwa sasa hivi.{{else if eq .Field "phone"}}Nambari ya simu ya akaunti yako ya FixIt imebadilishwa sasa hivi.{{else}}Nenosiri la akaunti yako ya FixIt limebadilishwa sasa hivi.{{end}} ` +
+				"Ikiwa si wewe, fungua kiungo kilicho hapa chini ndani ya saa {{.Hours}} ili kutendua mabadiliko na kufunga akaunti yako:\n\n{{.URL}}\n",
+		},
+	})
+
+	//Email carrying a notification, Body is the rendered notification
+	register("notification_email", map[string]Variant{
+		"en": {Subject: "{{.Title}}", Body: "Hi {{.Username}},\n\n{{.Body}}\n"},
+		"sw": {Subject: "{{.Title}}", Body: "Habari {{.Username}},\n\n{{.Body}}\n"},
+	})
+
+	//Written by the admins in one language, so every locale shows it as is
+	register("announcement", map[string]Variant{
+		"en": {Subject: "{{.Title}}", Body: "{{.Body}}"},
+		"sw": {Subject: "{{.Title}}", Body: "{{.Body}}"},
+	})
+
+	//Frequency is daily or weekly, Items have a Title and Body, More counts the items left out
+	register("digest", map[string]Variant{
+		"en": {
+			Subject: `Your {{if eq .Frequency "weekly"}}weekly{{else}}daily{{end}} FixIt digest`,
+			Body: "Hi {{.Username}},\n\nHere is what happened since your last digest.\n" +
+				"{{range .Items}}\n{{.Title}}\n{{.Body}}\n{{end}}" +
+				"{{if gt .More 0}}\nAnd {{.More}} more in the app.\n{{end}}" +
+				"\nChange how often you get this under digest_frequency in your profile.\n",
+		},
+		"sw": {
+			Subject: `Muhtasari wako wa FixIt wa {{if eq .Frequency "weekly"}}wiki{{else}}siku{{end}}`,
+			Body: "Habari {{.Username}},\n\nHaya ndiyo yaliyotokea tangu muhtasari wako uliopita.\n" +
+				"{{range .Items}}\n{{.Title}}\n{{.Body}}\n{{end}}" +
+				"{{if gt .More 0}}\nNa mengine {{.More}} kwenye programu.\n{{end}}" +
+				"\nBadilisha mara unazopokea hiki chini ya digest_frequency kwenye wasifu wako.\n",
+		},
+	})
+
+	//Distance is in km from the provider
+	register("nearby_job", map[string]Variant{
+		"en": {
+			Subject: "New {{.Category}} job near you",
+			Body:    `{{.Description}}{{if .Address}} in {{.Address}}{{end}}, {{printf "%.1f" .Distance}} km away.`,
+		},
+		"sw": {
+			Subject: "Kazi mpya ya {{.Category}} karibu nawe",
+			Body:    `{{.Description}}{{if .Address}} huko {{.Address}}{{end}}, umbali wa km {{printf "%.1f" .Distance}}.`,
+		},
+	})
+
+	register("weekly_stats", map[string]Variant{
+		"en": {
+			Subject: "Your week on FixIt",
+			Body: "Bookings completed: {{.BookingsCompleted}}\nNew reviews: {{.Reviews}}" +
+				`{{if gt .Reviews 0}}, averaging {{printf "%.1f" .AverageRating}} stars{{end}}`,
+		},
+		"sw": {
+			Subject: "Wiki yako kwenye FixIt",
+			Body: "Miadi iliyokamilika: {{.BookingsCompleted}}\nMaoni mapya: {{.Reviews}}" +
+				`{{if gt .Reviews 0}}, wastani wa nyota {{printf "%.1f" .AverageRating}}{{end}}`,
+		},
+	})
+
+	register("review_request", map[string]Variant{
+		"en": {
+			Subject: "How did {{.Provider}} do?",
+			Body:    "Your booking #{{.BookingID}} is complete. Leave a review to help others find good providers:\n\n{{.URL}}",
+		},
+		"sw": {
+			Subject: "{{.Provider}} alifanyaje kazi?",
+			Body:    "Miadi yako #{{.BookingID}} imekamilika. Acha maoni ili kuwasaidia wengine kupata mafundi wazuri:\n\n{{.URL}}",
+		},
+	})
+
+	register("dispute_opened", map[string]Variant{
+		"en": {
+			Subject: "Dispute opened on booking #{{.BookingID}}",
+			Body:    "A dispute was opened on booking #{{.BookingID}}. Both parties can add evidence until it is resolved.",
+		},
+		"sw": {
+			Subject: "Mzozo umefunguliwa kwenye miadi #{{.BookingID}}",
+			Body:    "Mzozo umefunguliwa kwenye miadi #{{.BookingID}}. Pande zote mbili zinaweza kuongeza ushahidi hadi utakapotatuliwa.",
+		},
+	})
+
+	register("dispute_evidence", map[string]Variant{
+		"en": {
+			Subject: "New evidence on the dispute over booking #{{.BookingID}}",
+			Body:    "The other party added evidence to the dispute over booking #{{.BookingID}}.",
+		},
+		"sw": {
+			Subject: "Ushahidi mpya kwenye mzozo wa miadi #{{.BookingID}}",
+			Body:    "Upande mwingine umeongeza ushahidi kwenye mzozo wa miadi #{{.BookingID}}.",
+		},
+	})
+
+	//Status is Resolved or Rejected, Refund is 0 when nothing was refunded
+	register("dispute_closed", map[string]Variant{
+		"en": {
+			Subject: "Dispute over booking #{{.BookingID}} closed",
+			Body: `The dispute over booking #{{.BookingID}} was {{if eq .Status "Resolved"}}resolved{{else}}rejected{{end}}.` +
+				`{{if gt .Refund 0.0}} A refund of {{printf "%.2f" .Refund}} {{.Currency}} was issued to the customer.{{end}}`,
+		},
+		"sw": {
+			Subject: "Mzozo wa miadi #{{.BookingID}} umefungwa",
+			Body: `Mzozo wa miadi #{{.BookingID}} {{if eq .Status "Resolved"}}umetatuliwa{{else}}umekataliwa{{end}}.` +
+				`{{if gt .Refund 0.0}} Mteja amerudishiwa {{printf "%.2f" .Refund}} {{.Currency}}.{{end}}`,
+		},
+	})
+
+	register("quote_submitted", map[string]Variant{
+		"en": {
+			Subject: "New quote on booking #{{.BookingID}}",
+			Body:    `A quote of {{printf "%.2f" .Amount}} was submitted on booking #{{.BookingID}} and is awaiting a response.`,
+		},
+		"sw": {
+			Subject: "Bei mpya kwenye miadi #{{.BookingID}}",
+			Body:    `Bei ya {{printf "%.2f" .Amount}} imetolewa kwenye miadi #{{.BookingID}} na inasubiri jibu.`,
+		},
+	})
+
+	register("booking_confirmed", map[string]Variant{
+		"en": {
+			Subject: "Booking #{{.BookingID}} confirmed",
+			Body:    `The quote of {{printf "%.2f" .Amount}} on booking #{{.BookingID}} was accepted and the booking is confirmed.`,
+		},
+		"sw": {
+			Subject: "Miadi #{{.BookingID}} imethibitishwa",
+			Body:    `Bei ya {{printf "%.2f" .Amount}} kwenye miadi #{{.BookingID}} imekubaliwa na miadi imethibitishwa.`,
+		},
+	})
+
+	register("quote_declined", map[string]Variant{
+		"en": {
+			Subject: "Quote declined on booking #{{.BookingID}}",
+			Body:    `The quote of {{printf "%.2f" .Amount}} on booking #{{.BookingID}} was declined.`,
+		},
+		"sw": {
+			Subject: "Bei imekataliwa kwenye miadi #{{.BookingID}}",
+			Body:    `Bei ya {{printf "%.2f" .Amount}} kwenye miadi #{{.BookingID}} imekataliwa.`,
+		},
+	})
+
+	register("quote_countered", map[string]Variant{
+		"en": {
+			Subject: "Counter offer on booking #{{.BookingID}}",
+			Body:    `A counter offer of {{printf "%.2f" .Amount}} was made on booking #{{.BookingID}} and is awaiting a response.`,
+		},
+		"sw": {
+			Subject: "Bei mbadala kwenye miadi #{{.BookingID}}",
+			Body:    `Bei mbadala ya {{printf "%.2f" .Amount}} imetolewa kwenye miadi #{{.BookingID}} na inasubiri jibu.`,
+		},
+	})
+
+	//Status is approved or rejected, Reason says why it was rejected
+	register("kyc_reviewed", map[string]Variant{
+		"en": {
+			Subject: `Identity check {{if eq .Status "approved"}}approved{{else}}not approved{{end}}`,
+			Body: `{{if eq .Status "approved"}}Your identity was confirmed and customers can now find you in searches.` +
+				`{{else}}We couldn't confirm your identity: {{.Reason}}. Submit your document again to retry.{{end}}`,
+		},
+		"sw": {
+			Subject: `Uthibitisho wa utambulisho {{if eq .Status "approved"}}umekubaliwa{{else}}haukukubaliwa{{end}}`,
+			Body: `{{if eq .Status "approved"}}Utambulisho wako umethibitishwa na wateja sasa wanaweza kukupata kwenye utafutaji.` +
+				`{{else}}Hatukuweza kuthibitisha utambulisho wako: {{.Reason}}. Wasilisha hati yako tena ili kujaribu upya.{{end}}`,
+		},
+	})
+}
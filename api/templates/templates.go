@@ -0,0 +1,191 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+//Locale every template has, the end of every fallback chain
+const DefaultLocale = "en"
+
+//Text of a message in one locale, in text/template syntax
+type Variant struct {
+	Subject string //Subject of emails, title of notifications
+	Body    string
+}
+
+//Message rendered for a recipient
+type Message struct {
+	Subject string
+	Body    string
+	Locale  string //Locale the variant used is in
+}
+
+type parsedVariant struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+//Variants of every template by name and then locale, filled in by catalog.go
+var catalog = map[string]map[string]parsedVariant{}
+
+//Add a template, panicking on a variant that doesn't parse so mistakes show at start up
+func register(name string, variants map[string]Variant) {
+	if _, ok := variants[DefaultLocale]; !ok {
+		panic(fmt.Sprintf("Template %s has no %s variant", name, DefaultLocale))
+	}
+	parsed := map[string]parsedVariant{}
+	for locale, variant := range variants {
+		parsed[locale] = parsedVariant{
+			subject: template.Must(template.New(name + "." + locale + ".subject").Parse(variant.Subject)),
+			body:    template.Must(template.New(name + "." + locale + ".body").Parse(variant.Body)),
+		}
+	}
+	catalog[name] = parsed
+}
+
+//Lowercase with hyphens, so sw_KE and sw-ke are the same locale
+func Normalize(locale string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(locale), "_", "-", -1))
+}
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{1,8})*$`)
+
+//Whether the locale is a language tag that fits on a user, such as sw or sw-ke
+func Valid(locale string) bool {
+	locale = Normalize(locale)
+	return len(locale) <= 20 && localePattern.MatchString(locale)
+}
+
+//The locale and the more general ones it falls back to, sw-KE gives sw-ke and sw
+func parents(locale string) []string {
+	chain := []string{}
+	for locale = Normalize(locale); locale != ""; {
+		chain = append(chain, locale)
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	return chain
+}
+
+//Locales tried for a requested locale, most specific first and ending with the default, sw-KE gives sw-ke, sw and en
+func Chain(locale string) []string {
+	chain := parents(locale)
+	if len(chain) == 0 || chain[len(chain)-1] != DefaultLocale {
+		chain = append(chain, DefaultLocale)
+	}
+	return chain
+}
+
+//Render the template in the first locale of the chain that has a variant of it
+func Render(name, locale string, data interface{}) (Message, error) {
+	variants, ok := catalog[name]
+	if !ok {
+		return Message{}, fmt.Errorf("Unknown template %s", name)
+	}
+	for _, candidate := range Chain(locale) {
+		variant, ok := variants[candidate]
+		if !ok {
+			continue
+		}
+		var subject, body bytes.Buffer
+		err := variant.subject.Execute(&subject, data)
+		if err == nil {
+			err = variant.body.Execute(&body, data)
+		}
+		if err != nil {
+			return Message{}, err
+		}
+		return Message{Subject: subject.String(), Body: body.String(), Locale: candidate}, nil
+	}
+	return Message{}, fmt.Errorf("Template %s has no variant for %s", name, locale)
+}
+
+//Locales with at least one template, sorted
+func Locales() []string {
+	seen := map[string]bool{}
+	for _, variants := range catalog {
+		for locale := range variants {
+			seen[locale] = true
+		}
+	}
+	locales := []string{}
+	for locale := range seen {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+//Templates each locale has no variant of its own for, sorted, whatever its fallbacks have
+func Missing() map[string][]string {
+	missing := map[string][]string{}
+	for _, locale := range Locales() {
+		missing[locale] = []string{}
+		for name, variants := range catalog {
+			if _, ok := variants[locale]; !ok {
+				missing[locale] = append(missing[locale], name)
+			}
+		}
+		sort.Strings(missing[locale])
+	}
+	return missing
+}
+
+//Whether any template has a variant in the locale
+func supported(locale string) bool {
+	for _, variants := range catalog {
+		if _, ok := variants[locale]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+//Most preferred locale of an Accept-Language header that has templates, or one of its fallbacks,
+//empty when there is none
+func FromAcceptLanguage(header string) string {
+	type preference struct {
+		locale string
+		weight float64
+	}
+	preferences := []preference{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		locale := Normalize(fields[0])
+		if !Valid(locale) {
+			continue
+		}
+		weight := 1.0
+		for _, field := range fields[1:] {
+			field = strings.TrimSpace(field)
+			if strings.HasPrefix(field, "q=") {
+				if q, err := strconv.ParseFloat(field[2:], 64); err == nil {
+					weight = q
+				}
+			}
+		}
+		if weight > 0 {
+			preferences = append(preferences, preference{locale, weight})
+		}
+	}
+	sort.SliceStable(preferences, func(i, j int) bool { return preferences[i].weight > preferences[j].weight })
+
+	for _, preference := range preferences {
+		//Every chain ends with the default, so only the locale and its own parents count
+		for _, locale := range parents(preference.locale) {
+			if supported(locale) {
+				return preference.locale
+			}
+		}
+	}
+	return ""
+}
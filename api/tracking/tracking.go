@@ -0,0 +1,251 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/victorkabata/FixIt-API/api/cache"
+)
+
+//How long the last location of a booking is kept after the provider stops sending updates
+const LocationTTL = 10 * time.Minute
+
+//Position of a provider on the way to a job
+type Location struct {
+	BookingID uint32    `json:"booking_id"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Heading   float64   `json:"heading,omitempty"`
+	Accuracy  float64   `json:"accuracy,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+//What is sent to the subscribers of a booking, a location or the end of the tracking
+type event struct {
+	Location *Location `json:"location,omitempty"`
+	Ended    bool      `json:"ended,omitempty"`
+}
+
+//Fans out location updates of a booking to its subscribers, nothing is written to the database. With Redis
+//the updates go through its pub/sub, so the provider and the customer can be connected to different instances.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[uint32]map[chan Location]bool
+	last        *cache.Cache
+
+	redis  *redis.Client
+	pubsub *redis.PubSub
+	//Held while changing which bookings pubsub listens to
+	following sync.Mutex
+}
+
+//Hub for a single instance, keeping everything in memory
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: map[uint32]map[chan Location]bool{},
+		last:        cache.New(),
+	}
+}
+
+//Hub sharing the updates and last locations through Redis
+func NewRedisHub(client *redis.Client) *Hub {
+	h := NewHub()
+	h.redis = client
+	h.pubsub = client.Subscribe(context.Background())
+	go h.listen()
+	return h
+}
+
+//Hub through Redis at REDIS_URL, or in memory when it isn't set or is invalid
+func HubFromEnv() *Hub {
+	rawURL := os.Getenv("REDIS_URL")
+	if rawURL == "" {
+		return NewHub()
+	}
+	client, err := cache.NewRedisClient(rawURL)
+	if err != nil {
+		log.Printf("%v, tracking in memory instead", err)
+		return NewHub()
+	}
+	return NewRedisHub(client)
+}
+
+func locationKey(bid uint32) string {
+	return "location:" + strconv.FormatUint(uint64(bid), 10)
+}
+
+const channelPrefix = "tracking:"
+
+func channel(bid uint32) string {
+	return channelPrefix + strconv.FormatUint(uint64(bid), 10)
+}
+
+//Store the latest location of a booking and send it to every subscriber
+func (h *Hub) Publish(ctx context.Context, location Location) error {
+	if h.redis == nil {
+		h.last.Set(locationKey(location.BookingID), location, LocationTTL)
+		h.deliver(location.BookingID, event{Location: &location})
+		return nil
+	}
+	stored, err := json.Marshal(location)
+	if err != nil {
+		return err
+	}
+	message, err := json.Marshal(event{Location: &location})
+	if err != nil {
+		return err
+	}
+	_, err = h.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, locationKey(location.BookingID), stored, LocationTTL)
+		pipe.Publish(ctx, channel(location.BookingID), message)
+		return nil
+	})
+	return err
+}
+
+//Stop tracking a booking that is no longer active, its subscribers are let go and its last location dropped
+func (h *Hub) End(ctx context.Context, bid uint32) error {
+	if h.redis == nil {
+		h.last.Delete(locationKey(bid))
+		h.deliver(bid, event{Ended: true})
+		return nil
+	}
+	message, err := json.Marshal(event{Ended: true})
+	if err != nil {
+		return err
+	}
+	_, err = h.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, locationKey(bid))
+		pipe.Publish(ctx, channel(bid), message)
+		return nil
+	})
+	return err
+}
+
+//Last known location of a booking
+func (h *Hub) Last(ctx context.Context, bid uint32) (Location, bool, error) {
+	if h.redis == nil {
+		value, ok := h.last.Get(locationKey(bid))
+		if !ok {
+			return Location{}, false, nil
+		}
+		return value.(Location), true, nil
+	}
+	stored, err := h.redis.Get(ctx, locationKey(bid)).Bytes()
+	if err == redis.Nil {
+		return Location{}, false, nil
+	}
+	if err != nil {
+		return Location{}, false, err
+	}
+	location := Location{}
+	err = json.Unmarshal(stored, &location)
+	return location, err == nil, err
+}
+
+//Receive the location updates of a booking until unsubscribe is called. The channel is closed when the
+//tracking of the booking ends.
+func (h *Hub) Subscribe(ctx context.Context, bid uint32) (<-chan Location, func(), error) {
+	subscriber := make(chan Location, 8)
+
+	h.mu.Lock()
+	if h.subscribers[bid] == nil {
+		h.subscribers[bid] = map[chan Location]bool{}
+	}
+	h.subscribers[bid][subscriber] = true
+	h.mu.Unlock()
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		if _, ok := h.subscribers[bid][subscriber]; ok {
+			delete(h.subscribers[bid], subscriber)
+			close(subscriber)
+			if len(h.subscribers[bid]) == 0 {
+				delete(h.subscribers, bid)
+			}
+		}
+		h.mu.Unlock()
+		go h.follow(context.Background(), bid)
+	}
+
+	err := h.follow(ctx, bid)
+	if err != nil {
+		unsubscribe()
+		return nil, nil, err
+	}
+	return subscriber, unsubscribe, nil
+}
+
+//Listens to the booking's channel while it has subscribers here and stops once they are gone. The state is
+//read again under the lock, so calls racing each other leave it as the last one saw it.
+func (h *Hub) follow(ctx context.Context, bid uint32) error {
+	if h.pubsub == nil {
+		return nil
+	}
+	h.following.Lock()
+	defer h.following.Unlock()
+
+	h.mu.Lock()
+	wanted := h.subscribers[bid] != nil
+	h.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if wanted {
+		return h.pubsub.Subscribe(ctx, channel(bid))
+	}
+	err := h.pubsub.Unsubscribe(ctx, channel(bid))
+	if err != nil {
+		log.Printf("Unsubscribing from the locations of booking %d failed: %v", bid, err)
+	}
+	return err
+}
+
+//Hands the updates of the bookings this instance listens to over to their subscribers
+func (h *Hub) listen() {
+	for message := range h.pubsub.Channel() {
+		bid, err := strconv.ParseUint(strings.TrimPrefix(message.Channel, channelPrefix), 10, 32)
+		if err != nil {
+			continue
+		}
+		received := event{}
+		if json.Unmarshal([]byte(message.Payload), &received) != nil {
+			continue
+		}
+		h.deliver(uint32(bid), received)
+	}
+}
+
+//Sends the event to the subscribers of the booking here
+func (h *Hub) deliver(bid uint32, e event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if e.Ended {
+		if _, ok := h.subscribers[bid]; !ok {
+			return
+		}
+		for subscriber := range h.subscribers[bid] {
+			close(subscriber)
+		}
+		delete(h.subscribers, bid)
+		go h.follow(context.Background(), bid)
+		return
+	}
+	if e.Location == nil {
+		return
+	}
+	for subscriber := range h.subscribers[bid] {
+		select {
+		case subscriber <- *e.Location:
+		default:
+			//Slow subscribers miss updates rather than block the provider
+		}
+	}
+}
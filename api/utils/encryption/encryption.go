@@ -0,0 +1,84 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+)
+
+var (
+	ErrMissingKey = errors.New("DATA_ENCRYPTION_KEY must be a base64 encoded 32 byte key")
+	ErrCiphertext = errors.New("Invalid ciphertext")
+)
+
+//Reads the AES-256 key from DATA_ENCRYPTION_KEY
+func key() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(os.Getenv("DATA_ENCRYPTION_KEY"))
+	if err != nil || len(key) != 32 {
+		return nil, ErrMissingKey
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//Encrypts with AES-GCM and DATA_ENCRYPTION_KEY, the result is base64 with the nonce in front
+func Encrypt(plaintext []byte) (string, error) {
+	key, err := key()
+	if err != nil {
+		return "", err
+	}
+	return EncryptWithKey(key, plaintext)
+}
+
+//Decrypts a value produced by Encrypt
+func Decrypt(ciphertext string) ([]byte, error) {
+	key, err := key()
+	if err != nil {
+		return nil, err
+	}
+	return DecryptWithKey(key, ciphertext)
+}
+
+//Encrypt with a 32 byte key of the caller's instead of DATA_ENCRYPTION_KEY
+func EncryptWithKey(key, plaintext []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+//Decrypts a value produced by EncryptWithKey with the same key
+func DecryptWithKey(key []byte, ciphertext string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return nil, ErrCiphertext
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrCiphertext
+	}
+	return plaintext, nil
+}
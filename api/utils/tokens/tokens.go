@@ -0,0 +1,43 @@
+package tokens
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+)
+
+const alphanumeric = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+//Generates a random alphanumeric string of the given length
+func Generate(length int) (string, error) {
+	code := make([]byte, length)
+	max := big.NewInt(int64(len(alphanumeric)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = alphanumeric[n.Int64()]
+	}
+	return string(code), nil
+}
+
+//Hashes a token so that only the digest is stored in the database
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+//Signs a message with HMAC-SHA256 using the given secret
+func Sign(secret, message string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//Checks a signature produced by Sign
+func Verify(secret, message, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, message)), []byte(signature))
+}
@@ -0,0 +1,120 @@
+package webauthn
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  interface{}
+	}{
+		{"small integer", []byte{0x17}, int64(23)},
+		{"one byte integer", []byte{0x18, 0x18}, int64(24)},
+		{"two byte integer", []byte{0x19, 0x01, 0x00}, int64(256)},
+		{"four byte integer", []byte{0x1a, 0x00, 0x01, 0x00, 0x00}, int64(65536)},
+		{"eight byte integer", []byte{0x1b, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, int64(1<<63 - 1)},
+		{"negative integer", []byte{0x26}, int64(-7)},
+		{"two byte negative integer", []byte{0x39, 0x01, 0x00}, int64(-257)},
+		{"byte string", []byte{0x43, 0x01, 0x02, 0x03}, []byte{0x01, 0x02, 0x03}},
+		{"empty byte string", []byte{0x40}, []byte{}},
+		{"text string", []byte{0x64, 'n', 'o', 'n', 'e'}, "none"},
+		{"array", []byte{0x82, 0x01, 0x20}, []interface{}{int64(1), int64(-1)}},
+		{"map", []byte{0xa2, 0x01, 0x02, 0x63, 'f', 'm', 't', 0xf6}, map[interface{}]interface{}{int64(1): int64(2), "fmt": nil}},
+		{"empty map", []byte{0xa0}, map[interface{}]interface{}{}},
+		{"false", []byte{0xf4}, false},
+		{"true", []byte{0xf5}, true},
+		{"null", []byte{0xf6}, nil},
+		{"nested", []byte{0xa1, 0x01, 0x81, 0xa1, 0x02, 0x41, 0xff}, map[interface{}]interface{}{int64(1): []interface{}{map[interface{}]interface{}{int64(2): []byte{0xff}}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trailing := []byte{0xde, 0xad}
+			got, rest, err := decodeCBOR(append(append([]byte{}, test.input...), trailing...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("decodeCBOR = %#v, want %#v", got, test.want)
+			}
+			if !bytes.Equal(rest, trailing) {
+				t.Errorf("rest = %x, want %x", rest, trailing)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORRejects(t *testing.T) {
+	nested := func(depth int) []byte {
+		return append(bytes.Repeat([]byte{0x81}, depth), 0x01)
+	}
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{"empty", nil},
+		{"missing integer byte", []byte{0x18}},
+		{"short two byte integer", []byte{0x19, 0x01}},
+		{"short eight byte integer", []byte{0x1b, 0x00, 0x00, 0x00}},
+		{"integer past int64", []byte{0x1b, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{"negative integer past int64", []byte{0x3b, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{"reserved additional information", []byte{0x1c}},
+		{"byte string longer than the data", []byte{0x45, 0x01, 0x02}},
+		{"byte string of 4GB", []byte{0x5a, 0xff, 0xff, 0xff, 0xff, 0x00}},
+		{"byte string of 2^64 bytes", []byte{0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"text string longer than the data", []byte{0x6a, 'n', 'o'}},
+		{"array longer than the data", []byte{0x83, 0x01, 0x02}},
+		{"array of 2^32 items", []byte{0x9a, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{"map longer than the data", []byte{0xa2, 0x01, 0x02}},
+		{"map of 2^64 entries", []byte{0xbb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 0x02}},
+		{"map key without a value", []byte{0xa1, 0x01}},
+		{"byte string map key", []byte{0xa1, 0x41, 0x01, 0x02}},
+		{"array map key", []byte{0xa1, 0x80, 0x02}},
+		{"indefinite byte string", []byte{0x5f, 0x41, 0x01, 0xff}},
+		{"indefinite array", []byte{0x9f, 0x01, 0xff}},
+		{"indefinite map", []byte{0xbf, 0x01, 0x02, 0xff}},
+		{"half float", []byte{0xf9, 0x3c, 0x00}},
+		{"double float", []byte{0xfb, 0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{"undefined", []byte{0xf7}},
+		{"tag", []byte{0xc2, 0x41, 0x01}},
+		{"too deep", nested(maxCBORDepth + 1)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, _, err := decodeCBOR(test.input); err != errCBOR {
+				t.Errorf("decodeCBOR(%x) = %#v, %v, want errCBOR", test.input, got, err)
+			}
+		})
+	}
+
+	if _, _, err := decodeCBOR(nested(maxCBORDepth)); err != nil {
+		t.Errorf("decodeCBOR at the deepest nesting allowed: %v", err)
+	}
+}
+
+//Cut and corrupted attestation objects are refused with an error rather than a panic
+func TestDecodeCBORMangled(t *testing.T) {
+	attestation := mustDecode(t, loadFixture(t, "es256").Registration.AttestationObject)
+	for cut := 0; cut < len(attestation); cut++ {
+		if _, _, err := decodeCBOR(attestation[:cut]); err == nil {
+			t.Fatalf("decodeCBOR accepted the attestation object cut to %d bytes", cut)
+		}
+	}
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		mangled := append([]byte{}, attestation...)
+		for j := random.Intn(4); j >= 0; j-- {
+			mangled[random.Intn(len(mangled))] = byte(random.Intn(256))
+		}
+		decodeCBOR(mangled)
+
+		garbage := make([]byte, random.Intn(64))
+		random.Read(garbage)
+		decodeCBOR(garbage)
+	}
+}
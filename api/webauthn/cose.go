@@ -0,0 +1,105 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+//COSE algorithms accepted for credentials, in the order they are offered
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+var Algorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+var (
+	ErrUnsupportedKey = errors.New("Unsupported Passkey Algorithm")
+	ErrBadSignature   = errors.New("Invalid Passkey Signature")
+)
+
+//Public key of a credential, from its COSE form
+type publicKey struct {
+	Algorithm int
+	key       interface{}
+}
+
+func parsePublicKey(raw []byte) (*publicKey, error) {
+	decoded, rest, err := decodeCBOR(raw)
+	if err != nil || len(rest) != 0 {
+		return nil, ErrUnsupportedKey
+	}
+	fields, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+	integer := func(label int64) int64 {
+		value, _ := fields[label].(int64)
+		return value
+	}
+	bytes := func(label int64) []byte {
+		value, _ := fields[label].([]byte)
+		return value
+	}
+
+	//Labels from RFC 8152: 1 is the key type, 3 the algorithm, the negative ones depend on the type
+	kty, alg := integer(1), integer(3)
+	switch {
+	case kty == 2 && alg == AlgES256 && integer(-1) == 1:
+		x, y := bytes(-2), bytes(-3)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, ErrUnsupportedKey
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, ErrUnsupportedKey
+		}
+		return &publicKey{Algorithm: AlgES256, key: key}, nil
+	case kty == 1 && alg == AlgEdDSA && integer(-1) == 6:
+		x := bytes(-2)
+		if len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedKey
+		}
+		return &publicKey{Algorithm: AlgEdDSA, key: ed25519.PublicKey(x)}, nil
+	case kty == 3 && alg == AlgRS256:
+		n, e := bytes(-1), bytes(-2)
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) < 256 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31 {
+			return nil, ErrUnsupportedKey
+		}
+		return &publicKey{Algorithm: AlgRS256, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}}, nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+//Checks the signature of message, ECDSA signatures are ASN.1 encoded
+func (p *publicKey) verify(message, signature []byte) error {
+	digest := sha256.Sum256(message)
+	switch key := p.key.(type) {
+	case *ecdsa.PublicKey:
+		parsed := struct{ R, S *big.Int }{}
+		rest, err := asn1.Unmarshal(signature, &parsed)
+		if err != nil || len(rest) != 0 || !ecdsa.Verify(key, digest[:], parsed.R, parsed.S) {
+			return ErrBadSignature
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, message, signature) {
+			return ErrBadSignature
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return ErrBadSignature
+		}
+	default:
+		return ErrUnsupportedKey
+	}
+	return nil
+}
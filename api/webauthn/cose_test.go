@@ -0,0 +1,158 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestParsePublicKey(t *testing.T) {
+	tests := []struct {
+		fixture   string
+		algorithm int
+	}{
+		{"es256", AlgES256},
+		{"eddsa", AlgEdDSA},
+		{"rs256", AlgRS256},
+	}
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			f := loadFixture(t, test.fixture)
+			key, err := parsePublicKey(mustDecode(t, f.Registration.PublicKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.Algorithm != test.algorithm {
+				t.Errorf("Algorithm = %d, want %d", key.Algorithm, test.algorithm)
+			}
+
+			authData := mustDecode(t, f.Assertion.AuthenticatorData)
+			signature := mustDecode(t, f.Assertion.Signature)
+			clientDataHash := sha256Of(mustDecode(t, f.Assertion.ClientDataJSON))
+			message := append(append([]byte{}, authData...), clientDataHash...)
+			if err := key.verify(message, signature); err != nil {
+				t.Errorf("verify of the fixture's signature: %v", err)
+			}
+			tampered := append([]byte{}, message...)
+			tampered[len(tampered)-1] ^= 0x01
+			if err := key.verify(tampered, signature); err != ErrBadSignature {
+				t.Errorf("verify of a tampered message = %v, want ErrBadSignature", err)
+			}
+		})
+	}
+}
+
+func TestParsePublicKeyRejects(t *testing.T) {
+	es256 := mustDecode(t, loadFixture(t, "es256").Registration.PublicKey)
+	rs256 := mustDecode(t, loadFixture(t, "rs256").Registration.PublicKey)
+	x, y := bytes.Repeat([]byte{0x01}, 32), bytes.Repeat([]byte{0x02}, 32)
+
+	tests := []struct {
+		name string
+		key  []byte
+	}{
+		{"empty", nil},
+		{"not a map", []byte{0x82, 0x01, 0x02}},
+		{"trailing bytes", append(append([]byte{}, es256...), 0x00)},
+		{"ES384", mustDecode(t, loadFixture(t, "es384").Registration.PublicKey)},
+		{"RS1", coseKey(3, -65535, rs256Fields(t, rs256)...)},
+		{"PS256", coseKey(3, -37, rs256Fields(t, rs256)...)},
+		{"no algorithm", []byte{0xa1, 0x01, 0x02}},
+		{"ES256 on P-384", coseKey(2, AlgES256, -1, 2, -2, x, -3, y)},
+		{"ES256 with an EdDSA key type", coseKey(1, AlgES256, -1, 1, -2, x, -3, y)},
+		{"ES256 point off the curve", coseKey(2, AlgES256, -1, 1, -2, x, -3, y)},
+		{"ES256 short coordinate", coseKey(2, AlgES256, -1, 1, -2, x[:31], -3, y)},
+		{"EdDSA on X25519", coseKey(1, AlgEdDSA, -1, 4, -2, x)},
+		{"EdDSA short key", coseKey(1, AlgEdDSA, -1, 6, -2, x[:31])},
+		{"RS256 1024 bit modulus", coseKey(3, AlgRS256, -1, bytes.Repeat([]byte{0xff}, 128), -2, []byte{0x01, 0x00, 0x01})},
+		{"RS256 exponent of 1", coseKey(3, AlgRS256, -1, bytes.Repeat([]byte{0xff}, 256), -2, []byte{0x01})},
+		{"RS256 huge exponent", coseKey(3, AlgRS256, -1, bytes.Repeat([]byte{0xff}, 256), -2, bytes.Repeat([]byte{0xff}, 9))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if key, err := parsePublicKey(test.key); err != ErrUnsupportedKey {
+				t.Errorf("parsePublicKey = %+v, %v, want ErrUnsupportedKey", key, err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsMalformedSignatures(t *testing.T) {
+	f := loadFixture(t, "es256")
+	key, err := parsePublicKey(mustDecode(t, f.Registration.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := append(mustDecode(t, f.Assertion.AuthenticatorData), sha256Of(mustDecode(t, f.Assertion.ClientDataJSON))...)
+	signature := mustDecode(t, f.Assertion.Signature)
+
+	for name, malformed := range map[string][]byte{
+		"empty":          nil,
+		"cut":            signature[:len(signature)-1],
+		"trailing bytes": append(append([]byte{}, signature...), 0x00),
+		"not ASN.1":      bytes.Repeat([]byte{0xff}, 64),
+		"raw r and s":    bytes.Repeat([]byte{0x01}, 64),
+	} {
+		if err := key.verify(message, malformed); err != ErrBadSignature {
+			t.Errorf("verify with a %s signature = %v, want ErrBadSignature", name, err)
+		}
+	}
+}
+
+//COSE key of the key type and algorithm with the labels and values that follow, in pairs
+func coseKey(kty, alg int, params ...interface{}) []byte {
+	key := []byte{0xa0 | byte(2+len(params)/2)}
+	key = append(key, encodeInt(1)...)
+	key = append(key, encodeInt(int64(kty))...)
+	key = append(key, encodeInt(3)...)
+	key = append(key, encodeInt(int64(alg))...)
+	for i := 0; i < len(params); i += 2 {
+		key = append(key, encodeInt(int64(params[i].(int)))...)
+		switch value := params[i+1].(type) {
+		case int:
+			key = append(key, encodeInt(int64(value))...)
+		case []byte:
+			key = append(key, encodeBytes(value)...)
+		}
+	}
+	return key
+}
+
+//Modulus and exponent labels of the RS256 fixture key, to put under another algorithm
+func rs256Fields(t *testing.T, key []byte) []interface{} {
+	decoded, _, err := decodeCBOR(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := decoded.(map[interface{}]interface{})
+	return []interface{}{-1, fields[int64(-1)], -2, fields[int64(-2)]}
+}
+
+func sha256Of(value []byte) []byte {
+	sum := sha256.Sum256(value)
+	return sum[:]
+}
+
+func encodeInt(value int64) []byte {
+	major := byte(0)
+	if value < 0 {
+		major, value = 1, -1-value
+	}
+	return cborHead(major, uint64(value))
+}
+
+func encodeBytes(value []byte) []byte {
+	return append(cborHead(2, uint64(len(value))), value...)
+}
+
+func cborHead(major byte, argument uint64) []byte {
+	switch {
+	case argument < 24:
+		return []byte{major<<5 | byte(argument)}
+	case argument < 1<<8:
+		return []byte{major<<5 | 24, byte(argument)}
+	case argument < 1<<16:
+		return []byte{major<<5 | 25, byte(argument >> 8), byte(argument)}
+	}
+	return []byte{major<<5 | 26, byte(argument >> 24), byte(argument >> 16), byte(argument >> 8), byte(argument)}
+}
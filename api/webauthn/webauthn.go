@@ -0,0 +1,247 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+)
+
+//How long a client has to answer a challenge
+const TimeoutMillis = 120000
+
+//Flags of the authenticator data
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagBackupEligible   = 0x08
+	flagAttestedCredData = 0x40
+)
+
+var (
+	ErrInvalidClientData = errors.New("Invalid Passkey Client Data")
+	ErrOriginNotAllowed  = errors.New("Passkey Origin Not Allowed")
+	ErrInvalidAuthData   = errors.New("Invalid Passkey Authenticator Data")
+	ErrWrongRelyingParty = errors.New("Passkey Is For Another Site")
+	ErrUserNotPresent    = errors.New("Passkey Use Was Not Confirmed")
+)
+
+//Relying party the passkeys are made for. WEBAUTHN_RP_ID is the domain, by default the host of
+//APP_LINK_BASE_URL, and WEBAUTHN_ORIGINS the comma separated origins allowed to use them, by default
+//APP_LINK_BASE_URL. Apps add their own origins, such as android:apk-key-hash:<hash>.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+func RelyingPartyFromEnv() RelyingParty {
+	appURL := os.Getenv("APP_LINK_BASE_URL")
+	if appURL == "" {
+		appURL = "https://fixit.app"
+	}
+	appURL = strings.TrimRight(appURL, "/")
+
+	party := RelyingParty{ID: os.Getenv("WEBAUTHN_RP_ID"), Name: os.Getenv("WEBAUTHN_RP_NAME")}
+	if party.ID == "" {
+		if parsed, err := url.Parse(appURL); err == nil {
+			party.ID = parsed.Hostname()
+		}
+	}
+	if party.Name == "" {
+		party.Name = "FixIt"
+	}
+	for _, origin := range strings.Split(os.Getenv("WEBAUTHN_ORIGINS"), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			party.Origins = append(party.Origins, origin)
+		}
+	}
+	if len(party.Origins) == 0 {
+		party.Origins = []string{appURL}
+	}
+	return party
+}
+
+//Random challenge for the client to sign, base64url encoded as clients send it back
+func NewChallenge() (string, error) {
+	challenge := make([]byte, 32)
+	_, err := rand.Read(challenge)
+	if err != nil {
+		return "", err
+	}
+	return Encode(challenge), nil
+}
+
+//Base64url without padding, how WebAuthn JSON carries binary values
+func Encode(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
+
+//Base64url with or without padding
+func Decode(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+//Checks what the browser or app says it was asked to do, and returns the challenge it answered
+func (p RelyingParty) checkClientData(raw []byte, ceremony string) (string, error) {
+	data := clientData{}
+	err := json.Unmarshal(raw, &data)
+	if err != nil || data.Type != ceremony || data.Challenge == "" {
+		return "", ErrInvalidClientData
+	}
+	for _, origin := range p.Origins {
+		if data.Origin == origin {
+			return data.Challenge, nil
+		}
+	}
+	return "", ErrOriginNotAllowed
+}
+
+type authenticatorData struct {
+	Flags        byte
+	SignCount    uint32
+	CredentialID []byte
+	PublicKey    []byte //COSE encoded, only on registration
+}
+
+func (p RelyingParty) parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	//RP ID hash, flags and the sign count come first
+	if len(raw) < 37 {
+		return nil, ErrInvalidAuthData
+	}
+	rpIDHash := sha256.Sum256([]byte(p.ID))
+	if !bytes.Equal(raw[:32], rpIDHash[:]) {
+		return nil, ErrWrongRelyingParty
+	}
+	data := authenticatorData{Flags: raw[32], SignCount: binary.BigEndian.Uint32(raw[33:37])}
+	if data.Flags&flagUserPresent == 0 {
+		return nil, ErrUserNotPresent
+	}
+	if data.Flags&flagAttestedCredData == 0 {
+		return &data, nil
+	}
+
+	//Then the AAGUID, the length of the credential ID, the ID and its key
+	rest := raw[37:]
+	if len(rest) < 18 {
+		return nil, ErrInvalidAuthData
+	}
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+		return nil, ErrInvalidAuthData
+	}
+	data.CredentialID, rest = rest[:idLength], rest[idLength:]
+	_, extensions, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, ErrInvalidAuthData
+	}
+	data.PublicKey = rest[:len(rest)-len(extensions)]
+	return &data, nil
+}
+
+//A new passkey, to be stored once Challenge is found to be one the API issued
+type Registration struct {
+	Challenge      string
+	CredentialID   []byte
+	PublicKey      []byte
+	Algorithm      int
+	SignCount      uint32
+	UserVerified   bool
+	BackupEligible bool //Synced passkeys, such as ones in a password manager
+}
+
+//Checks the response to navigator.credentials.create(). The API asks for no attestation so the
+//attestation statement isn't checked, only that the key was made for this site after the user confirmed.
+func (p RelyingParty) VerifyRegistration(clientDataJSON, attestationObject []byte) (*Registration, error) {
+	challenge, err := p.checkClientData(clientDataJSON, "webauthn.create")
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, ErrInvalidAuthData
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrInvalidAuthData
+	}
+	raw, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, ErrInvalidAuthData
+	}
+	data, err := p.parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+	if data.PublicKey == nil {
+		return nil, ErrInvalidAuthData
+	}
+	key, err := parsePublicKey(data.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Registration{
+		Challenge:      challenge,
+		CredentialID:   data.CredentialID,
+		PublicKey:      data.PublicKey,
+		Algorithm:      key.Algorithm,
+		SignCount:      data.SignCount,
+		UserVerified:   data.Flags&flagUserVerified != 0,
+		BackupEligible: data.Flags&flagBackupEligible != 0,
+	}, nil
+}
+
+//A passkey login, to be accepted once Challenge is found to be one the API issued
+type Assertion struct {
+	Challenge    string
+	SignCount    uint32
+	UserVerified bool
+}
+
+//Checks the response to navigator.credentials.get() against the stored public key of the passkey
+func (p RelyingParty) VerifyAssertion(clientDataJSON, authData, signature, storedKey []byte) (*Assertion, error) {
+	challenge, err := p.checkClientData(clientDataJSON, "webauthn.get")
+	if err != nil {
+		return nil, err
+	}
+	data, err := p.parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parsePublicKey(storedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	err = key.verify(append(append([]byte{}, authData...), clientDataHash[:]...), signature)
+	if err != nil {
+		return nil, err
+	}
+	return &Assertion{
+		Challenge:    challenge,
+		SignCount:    data.SignCount,
+		UserVerified: data.Flags&flagUserVerified != 0,
+	}, nil
+}
+
+//Whether the sign count of a login shows the passkey wasn't copied. Authenticators that count raise it every
+//time, synced passkeys always send 0.
+func SignCountAdvanced(stored, received uint32) bool {
+	return received > stored || stored == 0 && received == 0
+}
@@ -0,0 +1,250 @@
+package webauthn
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+//A registration with "none" attestation and a login signed by the same key for fixit.app, one per algorithm
+//in testdata. The keys were made for the fixtures, the bytes are laid out as authenticators send them.
+type fixture struct {
+	RPID         string `json:"rp_id"`
+	Origin       string `json:"origin"`
+	Registration struct {
+		Challenge         string `json:"challenge"`
+		ClientDataJSON    string `json:"client_data_json"`
+		AttestationObject string `json:"attestation_object"`
+		CredentialID      string `json:"credential_id"`
+		PublicKey         string `json:"public_key"`
+	} `json:"registration"`
+	Assertion *struct {
+		Challenge         string `json:"challenge"`
+		ClientDataJSON    string `json:"client_data_json"`
+		AuthenticatorData string `json:"authenticator_data"`
+		Signature         string `json:"signature"`
+		SignCount         uint32 `json:"sign_count"`
+	} `json:"assertion"`
+}
+
+func loadFixture(t *testing.T, name string) fixture {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := fixture{}
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func (f fixture) party() RelyingParty {
+	return RelyingParty{ID: f.RPID, Name: "FixIt", Origins: []string{f.Origin}}
+}
+
+func mustDecode(t *testing.T, value string) []byte {
+	t.Helper()
+	decoded, err := Decode(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+//Copy of the attestation object with the authenticator data in it changed by edit, which keeps its length
+func editAuthData(t *testing.T, attestationObject []byte, edit func(authData []byte)) []byte {
+	t.Helper()
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authData := decoded.(map[interface{}]interface{})["authData"].([]byte)
+	at := bytes.Index(attestationObject, authData)
+	edited := append([]byte{}, attestationObject...)
+	edit(edited[at : at+len(authData)])
+	return edited
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	tests := []struct {
+		fixture        string
+		algorithm      int
+		backupEligible bool
+	}{
+		{"es256", AlgES256, false},
+		{"eddsa", AlgEdDSA, true},
+		{"rs256", AlgRS256, false},
+	}
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			f := loadFixture(t, test.fixture)
+			registration, err := f.party().VerifyRegistration(mustDecode(t, f.Registration.ClientDataJSON), mustDecode(t, f.Registration.AttestationObject))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if registration.Challenge != f.Registration.Challenge {
+				t.Errorf("Challenge = %q, want %q", registration.Challenge, f.Registration.Challenge)
+			}
+			if !bytes.Equal(registration.CredentialID, mustDecode(t, f.Registration.CredentialID)) {
+				t.Errorf("CredentialID = %x, want the fixture's", registration.CredentialID)
+			}
+			if !bytes.Equal(registration.PublicKey, mustDecode(t, f.Registration.PublicKey)) {
+				t.Errorf("PublicKey = %x, want the fixture's", registration.PublicKey)
+			}
+			if registration.Algorithm != test.algorithm {
+				t.Errorf("Algorithm = %d, want %d", registration.Algorithm, test.algorithm)
+			}
+			if !registration.UserVerified || registration.BackupEligible != test.backupEligible || registration.SignCount != 0 {
+				t.Errorf("UserVerified, BackupEligible, SignCount = %v, %v, %d, want true, %v, 0", registration.UserVerified, registration.BackupEligible, registration.SignCount, test.backupEligible)
+			}
+		})
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	f := loadFixture(t, "es256")
+	clientData := mustDecode(t, f.Registration.ClientDataJSON)
+	attestation := mustDecode(t, f.Registration.AttestationObject)
+	es384 := loadFixture(t, "es384")
+
+	tests := []struct {
+		name        string
+		party       RelyingParty
+		clientData  []byte
+		attestation []byte
+		want        error
+	}{
+		{"other relying party", RelyingParty{ID: "evil.example", Origins: []string{f.Origin}}, clientData, attestation, ErrWrongRelyingParty},
+		{"wrong rpIdHash", f.party(), clientData, editAuthData(t, attestation, func(authData []byte) { authData[0] ^= 0xff }), ErrWrongRelyingParty},
+		{"user not present", f.party(), clientData, editAuthData(t, attestation, func(authData []byte) { authData[32] &^= flagUserPresent }), ErrUserNotPresent},
+		{"no attested credential", f.party(), clientData, editAuthData(t, attestation, func(authData []byte) { authData[32] &^= flagAttestedCredData }), ErrInvalidAuthData},
+		{"empty credential ID", f.party(), clientData, editAuthData(t, attestation, func(authData []byte) { authData[53], authData[54] = 0, 0 }), ErrInvalidAuthData},
+		{"credential ID past the end", f.party(), clientData, editAuthData(t, attestation, func(authData []byte) { authData[53], authData[54] = 0x03, 0xff }), ErrInvalidAuthData},
+		{"unsupported algorithm", es384.party(), mustDecode(t, es384.Registration.ClientDataJSON), mustDecode(t, es384.Registration.AttestationObject), ErrUnsupportedKey},
+		{"other origin", RelyingParty{ID: f.RPID, Origins: []string{"https://evil.example"}}, clientData, attestation, ErrOriginNotAllowed},
+		{"login client data", f.party(), bytes.Replace(clientData, []byte("webauthn.create"), []byte("webauthn.get"), 1), attestation, ErrInvalidClientData},
+		{"client data not JSON", f.party(), clientData[1:], attestation, ErrInvalidClientData},
+		{"attestation not a map", f.party(), clientData, []byte{0x80}, ErrInvalidAuthData},
+		{"authData not bytes", f.party(), clientData, []byte{0xa1, 0x68, 'a', 'u', 't', 'h', 'D', 'a', 't', 'a', 0x01}, ErrInvalidAuthData},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := test.party.VerifyRegistration(test.clientData, test.attestation); err != test.want {
+				t.Errorf("VerifyRegistration = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	for _, name := range []string{"es256", "eddsa", "rs256"} {
+		t.Run(name, func(t *testing.T) {
+			f := loadFixture(t, name)
+			assertion, err := f.party().VerifyAssertion(mustDecode(t, f.Assertion.ClientDataJSON), mustDecode(t, f.Assertion.AuthenticatorData), mustDecode(t, f.Assertion.Signature), mustDecode(t, f.Registration.PublicKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if assertion.Challenge != f.Assertion.Challenge || assertion.SignCount != f.Assertion.SignCount || !assertion.UserVerified {
+				t.Errorf("VerifyAssertion = %+v, want challenge %q and sign count %d, user verified", assertion, f.Assertion.Challenge, f.Assertion.SignCount)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	f := loadFixture(t, "es256")
+	clientData := mustDecode(t, f.Assertion.ClientDataJSON)
+	authData := mustDecode(t, f.Assertion.AuthenticatorData)
+	signature := mustDecode(t, f.Assertion.Signature)
+	key := mustDecode(t, f.Registration.PublicKey)
+
+	edited := func(value []byte, edit func([]byte)) []byte {
+		value = append([]byte{}, value...)
+		edit(value)
+		return value
+	}
+	otherChallenge := bytes.Replace(clientData, []byte(f.Assertion.Challenge), []byte(loadFixture(t, "rs256").Assertion.Challenge), 1)
+
+	tests := []struct {
+		name       string
+		party      RelyingParty
+		clientData []byte
+		authData   []byte
+		signature  []byte
+		key        []byte
+		want       error
+	}{
+		{"wrong rpIdHash", f.party(), clientData, edited(authData, func(b []byte) { b[31] ^= 0x01 }), signature, key, ErrWrongRelyingParty},
+		{"other relying party", RelyingParty{ID: "evil.example", Origins: []string{f.Origin}}, clientData, authData, signature, key, ErrWrongRelyingParty},
+		{"user not present", f.party(), clientData, edited(authData, func(b []byte) { b[32] &^= flagUserPresent }), signature, key, ErrUserNotPresent},
+		{"raised sign count", f.party(), clientData, edited(authData, func(b []byte) { b[36]++ }), signature, key, ErrBadSignature},
+		{"other challenge", f.party(), otherChallenge, authData, signature, key, ErrBadSignature},
+		{"tampered signature", f.party(), clientData, authData, edited(signature, func(b []byte) { b[len(b)-1] ^= 0x01 }), key, ErrBadSignature},
+		{"empty signature", f.party(), clientData, authData, nil, key, ErrBadSignature},
+		{"another passkey's key", f.party(), clientData, authData, signature, mustDecode(t, loadFixture(t, "eddsa").Registration.PublicKey), ErrBadSignature},
+		{"unsupported stored key", f.party(), clientData, authData, signature, mustDecode(t, loadFixture(t, "es384").Registration.PublicKey), ErrUnsupportedKey},
+		{"short authenticator data", f.party(), clientData, authData[:36], signature, key, ErrInvalidAuthData},
+		{"registration client data", f.party(), bytes.Replace(clientData, []byte("webauthn.get"), []byte("webauthn.create"), 1), authData, signature, key, ErrInvalidClientData},
+		{"other origin", RelyingParty{ID: f.RPID, Origins: []string{"https://evil.example"}}, clientData, authData, signature, key, ErrOriginNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := test.party.VerifyAssertion(test.clientData, test.authData, test.signature, test.key); err != test.want {
+				t.Errorf("VerifyAssertion = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestSignCountAdvanced(t *testing.T) {
+	tests := []struct {
+		stored, received uint32
+		want             bool
+	}{
+		{0, 0, true},
+		{0, 1, true},
+		{7, 8, true},
+		{7, 1000, true},
+		{7, 7, false},
+		{7, 6, false},
+		{7, 0, false},
+		{1<<32 - 1, 0, false},
+	}
+	for _, test := range tests {
+		if got := SignCountAdvanced(test.stored, test.received); got != test.want {
+			t.Errorf("SignCountAdvanced(%d, %d) = %v, want %v", test.stored, test.received, got, test.want)
+		}
+	}
+}
+
+//Every cut of the responses is refused with an error rather than a panic
+func TestTruncatedResponses(t *testing.T) {
+	f := loadFixture(t, "rs256")
+	party := f.party()
+	registrationData := mustDecode(t, f.Registration.ClientDataJSON)
+	attestation := mustDecode(t, f.Registration.AttestationObject)
+	for cut := 0; cut < len(attestation); cut++ {
+		if _, err := party.VerifyRegistration(registrationData, attestation[:cut]); err == nil {
+			t.Fatalf("VerifyRegistration accepted the attestation object cut to %d bytes", cut)
+		}
+	}
+
+	loginData := mustDecode(t, f.Assertion.ClientDataJSON)
+	authData := mustDecode(t, f.Assertion.AuthenticatorData)
+	signature := mustDecode(t, f.Assertion.Signature)
+	key := mustDecode(t, f.Registration.PublicKey)
+	for cut := 0; cut < len(authData); cut++ {
+		if _, err := party.VerifyAssertion(loginData, authData[:cut], signature, key); err == nil {
+			t.Fatalf("VerifyAssertion accepted the authenticator data cut to %d bytes", cut)
+		}
+	}
+	for cut := 0; cut < len(key); cut++ {
+		if _, err := party.VerifyAssertion(loginData, authData, signature, key[:cut]); err == nil {
+			t.Fatalf("VerifyAssertion accepted the public key cut to %d bytes", cut)
+		}
+	}
+}
@@ -1,7 +1,16 @@
 package main
 
-import "github.com/victorkabata/FixIt-API/api"
+import (
+	"os"
+
+	"github.com/victorkabata/FixIt-API/api"
+)
 
 func main() {
+	//e.g. go run main.go backup
+	if len(os.Args) > 1 {
+		api.RunCommand(os.Args[1:])
+		return
+	}
 	api.Run()
 }